@@ -1,17 +1,64 @@
 package agent
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/pipeline"
 	"go.uber.org/zap"
 )
 
+// stateSaveShare is the share of the timeout of StopWithin in which the state
+// of the operators is saved, as a divisor of the timeout
+const stateSaveShare = 5
+
+// stateCheckpointInterval is the interval at which batched writes are committed
+// while the operators save their state
+const stateCheckpointInterval = 10 * time.Millisecond
+
 // LogAgent is an entity that handles log monitoring.
 type LogAgent struct {
-	database database.Database
-	pipeline pipeline.Pipeline
+	database    database.Database
+	writeBehind *database.WriteBehind
+	pipeline    pipeline.Pipeline
+	throttles   *operator.Throttles
+	recovery    *helper.RecoveryReport
+	started     time.Time
+	upSince     time.Time
+	running     bool
+
+	// builder and config are used to build the pipeline again when the
+	// agent is reloaded. mux guards the pipeline and throttles, which are
+	// replaced by a reload, and the state read by Stats and Status.
+	// reloadMux keeps a reload from running at the same time as another
+	// reload or a stop.
+	builder   *LogAgentBuilder
+	config    *Config
+	mux       sync.RWMutex
+	reloadMux sync.Mutex
+	stopped   bool
+
+	statsInterval  time.Duration
+	statsRetention time.Duration
+	privileges     *privilegeDrop
+	watchdog       *watchdog
+	remote         *remotePoller
+	checkpoints    *checkpointExporter
+	// drainProgressInterval is the interval at which the work left in the
+	// pipeline is logged while it stops
+	drainProgressInterval time.Duration
+	cancel                context.CancelFunc
+	wg                    sync.WaitGroup
+
+	// done is closed once the operators that stop the agent have completed
+	done             chan struct{}
+	doneOnce         sync.Once
+	completionCancel context.CancelFunc
 
 	startOnce sync.Once
 	stopOnce  sync.Once
@@ -22,10 +69,59 @@ type LogAgent struct {
 // Start will start the log monitoring process
 func (a *LogAgent) Start() (err error) {
 	a.startOnce.Do(func() {
+		a.reloadMux.Lock()
+		defer a.reloadMux.Unlock()
+
+		a.mux.Lock()
+		a.started = time.Now()
+		a.mux.Unlock()
+
+		if a.writeBehind != nil {
+			a.writeBehind.Start()
+		}
+
+		// Listeners are bound while the agent is privileged, and the rest of
+		// the pipeline, such as file inputs, starts as the unprivileged user
+		if a.privileges != nil {
+			if err = bindListeners(a.pipeline); err != nil {
+				return
+			}
+			if err = a.privileges.drop(); err != nil {
+				return
+			}
+			a.Infow("Dropped privileges", "user", a.privileges.user, "group", a.privileges.group)
+		}
+
 		err = a.pipeline.Start()
 		if err != nil {
 			return
 		}
+		a.setRunning(true)
+		a.reportRecovery()
+		a.watchCompletion(a.pipeline)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		a.cancel = cancel
+		if a.statsInterval > 0 {
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				a.persistStats(ctx)
+			}()
+		}
+		if a.watchdog != nil {
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				a.watchdog.run(ctx)
+			}()
+		}
+		if a.remote != nil {
+			a.remote.start()
+		}
+		if a.checkpoints != nil {
+			a.checkpoints.start(a.currentBufferDepths)
+		}
 	})
 	return
 }
@@ -33,11 +129,51 @@ func (a *LogAgent) Start() (err error) {
 // Stop will stop the log monitoring process
 func (a *LogAgent) Stop() (err error) {
 	a.stopOnce.Do(func() {
+		// The poller is stopped before the reload lock is taken, since a
+		// poll in progress may be waiting for it to apply a remote config
+		if a.remote != nil {
+			a.remote.stop()
+		}
+		if a.checkpoints != nil {
+			a.checkpoints.stop()
+		}
+
+		a.reloadMux.Lock()
+		defer a.reloadMux.Unlock()
+		a.stopped = true
+		a.setRunning(false)
+
+		a.stopWatchingCompletion()
+		if a.cancel != nil {
+			a.cancel()
+		}
+		a.wg.Wait()
+
+		stopLogging := a.logDrainProgress(a.pipeline)
 		err = a.pipeline.Stop()
+		stopLogging()
 		if err != nil {
 			return
 		}
 
+		// Save the final counters so they are not lost when the agent stops
+		if a.statsInterval > 0 {
+			a.saveStats()
+		}
+
+		// The writes staged by the stopped operators are committed before
+		// the database is closed
+		if a.writeBehind != nil {
+			if err = a.writeBehind.Stop(); err != nil {
+				return
+			}
+		}
+
+		// A final checkpoint has the offsets of the stopped operators
+		if a.checkpoints != nil {
+			a.exportFinalCheckpoint()
+		}
+
 		err = a.database.Close()
 		if err != nil {
 			return
@@ -45,3 +181,264 @@ func (a *LogAgent) Stop() (err error) {
 	})
 	return
 }
+
+// StopWithin stops the agent in two phases when it must stop within a
+// timeout, such as when a service manager kills the process shortly after
+// asking it to stop. The state of the operators, such as bookmarks, offsets,
+// and buffer metadata, is saved first within a fifth of the timeout. The
+// pipeline is then stopped and drained with the rest of the timeout. If the
+// agent does not stop in time, an error is returned, and the agent resumes
+// from the saved state after a restart.
+func (a *LogAgent) StopWithin(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout/stateSaveShare)
+	err := a.SaveState(ctx)
+	cancel()
+	if err != nil {
+		a.Errorw("Failed to save operator state before stopping", zap.Error(err))
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- a.Stop()
+	}()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-time.After(time.Until(deadline)):
+		return errors.NewError(
+			"agent did not stop within the timeout",
+			"the agent will resume from the state saved before stopping",
+			"timeout", timeout.String(),
+		)
+	}
+}
+
+// SaveState saves the state of every operator that persists one, without
+// stopping the pipeline, and commits the writes batched for the database.
+// It returns once the state is saved, or with an error once the context is
+// done.
+func (a *LogAgent) SaveState(ctx context.Context) error {
+	a.mux.RLock()
+	pipeline := a.pipeline
+	a.mux.RUnlock()
+
+	saved := make(chan error, 1)
+	go func() {
+		saved <- a.saveState(pipeline)
+	}()
+
+	select {
+	case err := <-saved:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "save operator state")
+	}
+}
+
+// saveState saves the state of the operators of a pipeline concurrently. The
+// batched writes are committed while the operators save their state, so an
+// operator that waits for its writes to be committed is not held until the
+// next write interval.
+func (a *LogAgent) saveState(pipeline pipeline.Pipeline) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(pipeline.Operators()))
+	for _, op := range pipeline.Operators() {
+		saver, ok := op.(helper.StateSaver)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(op operator.Operator) {
+			defer wg.Done()
+			if err := saver.SaveState(); err != nil {
+				errs <- errors.Wrap(err, "save state").WithDetails("operator_id", op.ID())
+			}
+		}(op)
+	}
+
+	saved := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(saved)
+	}()
+
+	ticker := time.NewTicker(stateCheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-saved:
+			close(errs)
+			if err := <-errs; err != nil {
+				return err
+			}
+			return a.checkpoint()
+		case <-ticker.C:
+			if err := a.checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkpoint commits the writes batched for the database, if writes are batched
+func (a *LogAgent) checkpoint() error {
+	if a.writeBehind == nil {
+		return nil
+	}
+	return a.writeBehind.Checkpoint()
+}
+
+// Reload reads the config files again and replaces the running pipeline with
+// a pipeline built from them. A config that cannot be read leaves the running
+// pipeline in place. Operators such as buffers load their saved state when
+// they are built, so the running pipeline is stopped before the new one is
+// built, which saves the offsets of file inputs and the entries of buffers
+// for the new pipeline to resume from. If the new pipeline fails to build or
+// start, the previous config is built and started again. A remote config
+// replaced by the config files is applied again at the next poll.
+func (a *LogAgent) Reload() error {
+	a.reloadMux.Lock()
+	defer a.reloadMux.Unlock()
+
+	if a.started.IsZero() || a.stopped {
+		return errors.NewError("agent can only be reloaded while it is running", "")
+	}
+	if a.builder == nil {
+		return errors.NewError("agent cannot be reloaded without config files", "build the agent WithConfigFiles to reload it")
+	}
+
+	config, err := a.builder.readConfigFiles()
+	if err != nil {
+		return err
+	}
+
+	if err := a.replacePipeline(config); err != nil {
+		return err
+	}
+	if a.remote != nil {
+		a.remote.reset()
+	}
+	return nil
+}
+
+// restartPipeline stops the pipeline, and starts it again with the same
+// config. It is used by the watchdog to restart a stalled pipeline, and waits
+// for the operators of the stalled pipeline to stop.
+func (a *LogAgent) restartPipeline() error {
+	a.reloadMux.Lock()
+	defer a.reloadMux.Unlock()
+
+	if a.started.IsZero() || a.stopped {
+		return nil
+	}
+	return a.replacePipeline(a.config)
+}
+
+// replacePipeline stops the running pipeline, and replaces it with a
+// pipeline built from a config. The config is validated against a stub
+// database first, so a config that does not build leaves the running
+// pipeline untouched. If the new pipeline fails to build or start anyway,
+// the previous config is built and started again. The reload lock must be
+// held when calling this.
+func (a *LogAgent) replacePipeline(config *Config) error {
+	if err := a.builder.validateConfig(config); err != nil {
+		return err
+	}
+
+	a.stopWatchingCompletion()
+	if err := a.pipeline.Stop(); err != nil {
+		a.Warnw("Failed to stop pipeline gracefully before reload", zap.Error(err))
+	}
+
+	// The counters of the new pipeline start at zero, so the final counters
+	// of the stopped pipeline are saved first
+	if a.statsInterval > 0 {
+		a.saveStats()
+	}
+
+	if err := a.startPipeline(config); err != nil {
+		a.Errorw("Failed to start reloaded pipeline. Restoring the previous config", zap.Error(err))
+		if restoreErr := a.startPipeline(a.config); restoreErr != nil {
+			a.setRunning(false)
+			return errors.Wrap(restoreErr, "restore previous pipeline after failed reload")
+		}
+		return errors.Wrap(err, "reload pipeline")
+	}
+	return nil
+}
+
+// startPipeline builds and starts the pipeline of a config, and replaces the
+// pipeline of the agent with it
+func (a *LogAgent) startPipeline(config *Config) error {
+	pipeline, throttles, err := a.builder.buildPipeline(a.database, a.writeBehind, config)
+	if err != nil {
+		return err
+	}
+	if err := pipeline.Start(); err != nil {
+		_ = pipeline.Stop()
+		return err
+	}
+
+	a.mux.Lock()
+	a.pipeline = pipeline
+	a.throttles = throttles
+	a.config = config
+	a.started = time.Now()
+	a.mux.Unlock()
+
+	a.watchCompletion(pipeline)
+	return nil
+}
+
+// Recovery returns a summary of the persisted state restored by the operators
+// when the agent started. It returns nil if the agent has not started.
+func (a *LogAgent) Recovery() *helper.RecoveryReport {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	return a.recovery
+}
+
+// reportRecovery collects the state restored by each operator and logs a
+// single summary of it
+func (a *LogAgent) reportRecovery() {
+	report := &helper.RecoveryReport{}
+	restored := false
+	for _, op := range a.pipeline.Operators() {
+		reporter, ok := op.(helper.RecoveryReporter)
+		if !ok {
+			continue
+		}
+		if r := reporter.RecoveryReport(); r != nil {
+			report.Merge(r)
+			restored = true
+		}
+	}
+	a.mux.Lock()
+	a.recovery = report
+	a.mux.Unlock()
+
+	if !restored {
+		return
+	}
+
+	fields := []interface{}{
+		"known_files", report.KnownFiles,
+		"unread_bytes", report.UnreadBytes,
+		"buffered_entries", report.BufferedEntries,
+		"buffered_bytes", report.BufferedBytes,
+	}
+	if !report.OldestBuffered.IsZero() {
+		fields = append(fields, "oldest_buffered_age", time.Since(report.OldestBuffered).Round(time.Second).String())
+	}
+
+	if len(report.Discarded) > 0 {
+		fields = append(fields, "discarded", report.Discarded)
+		a.Warnw("Restored state at startup with discarded state", fields...)
+		return
+	}
+	a.Infow("Restored state at startup", fields...)
+}
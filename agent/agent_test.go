@@ -2,17 +2,28 @@ package agent
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestStartAgentSuccess(t *testing.T) {
 	logger := zap.NewNop().Sugar()
 	pipeline := &testutil.Pipeline{}
 	pipeline.On("Start").Return(nil)
+	pipeline.On("Operators").Return([]operator.Operator{})
 
 	agent := LogAgent{
 		SugaredLogger: logger,
@@ -38,6 +49,61 @@ func TestStartAgentFailure(t *testing.T) {
 	pipeline.AssertCalled(t, "Start")
 }
 
+type recoveringOperator struct {
+	*testutil.Operator
+	report *helper.RecoveryReport
+}
+
+func (o recoveringOperator) RecoveryReport() *helper.RecoveryReport {
+	return o.report
+}
+
+func TestStartAgentRecovery(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	oldest := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	operators := []operator.Operator{
+		recoveringOperator{
+			Operator: &testutil.Operator{},
+			report:   &helper.RecoveryReport{KnownFiles: 2, UnreadBytes: 100},
+		},
+		recoveringOperator{
+			Operator: &testutil.Operator{},
+			report: &helper.RecoveryReport{
+				BufferedEntries: 3,
+				BufferedBytes:   300,
+				OldestBuffered:  oldest,
+				Discarded:       []string{"corrupt"},
+			},
+		},
+		recoveringOperator{Operator: &testutil.Operator{}},
+		&testutil.Operator{},
+	}
+
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Start").Return(nil)
+	pipeline.On("Operators").Return(operators)
+
+	agent := LogAgent{
+		SugaredLogger: logger,
+		pipeline:      pipeline,
+	}
+	require.Nil(t, agent.Recovery())
+	require.NoError(t, agent.Start())
+
+	expected := &helper.RecoveryReport{
+		KnownFiles:      2,
+		UnreadBytes:     100,
+		BufferedEntries: 3,
+		BufferedBytes:   300,
+		OldestBuffered:  oldest,
+		Discarded:       []string{"corrupt"},
+	}
+	require.Equal(t, expected, agent.Recovery())
+
+	pipeline.On("Status").Return(nil)
+	require.Equal(t, expected, agent.Status().Recovery)
+}
+
 func TestStopAgentSuccess(t *testing.T) {
 	logger := zap.NewNop().Sugar()
 	pipeline := &testutil.Pipeline{}
@@ -93,3 +159,174 @@ func TestStopAgentDatabaseFailure(t *testing.T) {
 	pipeline.AssertCalled(t, "Stop")
 	database.AssertCalled(t, "Close")
 }
+
+func TestAgentDatabaseWriteInterval(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(reloadConfig(tempDir, "")), 0600))
+	input := filepath.Join(tempDir, "in.log")
+
+	start := func() *LogAgent {
+		agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+			WithConfigFiles([]string{configFile}).
+			WithDatabaseFile(filepath.Join(tempDir, "stanza.db")).
+			WithDatabaseWriteInterval(50 * time.Millisecond).
+			Build()
+		require.NoError(t, err)
+		require.NoError(t, agent.Start())
+		return agent
+	}
+
+	// The offsets saved by the first agent are written in batches, so the
+	// second agent does not read the first lines again
+	require.NoError(t, ioutil.WriteFile(input, []byte("a\nb\n"), 0600))
+	agent := start()
+	waitForOutput(t, tempDir, 2)
+	require.NoError(t, agent.Stop())
+
+	file, err := os.OpenFile(input, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString("c\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	agent = start()
+	defer agent.Stop()
+	waitForOutput(t, tempDir, 3)
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, readOutput(t, tempDir), 3)
+}
+
+type savingOperator struct {
+	*testutil.Operator
+	persister helper.Persister
+	saved     chan time.Time
+}
+
+func (o savingOperator) SaveState() error {
+	o.persister.Set("bookmark", []byte("event 10"))
+	if err := o.persister.Sync(); err != nil {
+		return err
+	}
+	o.saved <- time.Now()
+	return nil
+}
+
+func TestStopAgentWithin(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	db, err := database.OpenDatabase(filepath.Join(tempDir, "stanza.db"))
+	require.NoError(t, err)
+	writeBehind := database.NewWriteBehind(db, time.Hour)
+	writeBehind.Start()
+
+	op := &testutil.Operator{}
+	op.On("ID").Return("saving")
+	saver := savingOperator{
+		Operator:  op,
+		persister: helper.NewScopedDBPersister(db, "saving").WithWriteBehind(writeBehind),
+		saved:     make(chan time.Time, 1),
+	}
+
+	// The pipeline takes longer to drain than the first second of the timeout
+	drained := make(chan struct{})
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Operators").Return([]operator.Operator{saver, &testutil.Operator{}})
+	pipeline.On("Stop").Return(nil).Run(func(mock.Arguments) { <-drained })
+
+	agent := LogAgent{
+		SugaredLogger: zaptest.NewLogger(t).Sugar(),
+		pipeline:      pipeline,
+		database:      db,
+		writeBehind:   writeBehind,
+	}
+
+	start := time.Now()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- agent.StopWithin(5 * time.Second)
+	}()
+
+	// The state is saved and committed within the first second, before the
+	// pipeline has drained
+	select {
+	case savedAt := <-saver.saved:
+		require.Less(t, int64(savedAt.Sub(start)), int64(time.Second))
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for the state to be saved")
+	}
+
+	reopened := helper.NewScopedDBPersister(db, "saving")
+	require.NoError(t, reopened.Load())
+	require.Equal(t, []byte("event 10"), reopened.Get("bookmark"))
+
+	close(drained)
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(4 * time.Second):
+		require.FailNow(t, "Timed out waiting for the agent to stop")
+	}
+}
+
+func TestStopAgentWithinTimeout(t *testing.T) {
+	drained := make(chan struct{})
+	defer close(drained)
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Operators").Return([]operator.Operator{})
+	pipeline.On("Stop").Return(nil).Run(func(mock.Arguments) { <-drained })
+
+	agent := LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		database:      database.NewStubDatabase(),
+	}
+
+	start := time.Now()
+	err := agent.StopWithin(200 * time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not stop within the timeout")
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestStopAgentDrainProgress(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	input := pendingOperator{newCountingOperator("$.input", &helper.OperatorStats{}), 300}
+	input.On("CanOutput").Return(true)
+	output := pendingOperator{newCountingOperator("$.output", &helper.OperatorStats{}), 20}
+	output.On("CanOutput").Return(false)
+	idle := pendingOperator{newCountingOperator("$.idle", &helper.OperatorStats{}), 0}
+	idle.On("CanOutput").Return(false)
+
+	drained := make(chan struct{})
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Operators").Return([]operator.Operator{input, output, idle})
+	pipeline.On("Stop").Return(nil).Run(func(mock.Arguments) { <-drained })
+
+	agent := LogAgent{
+		SugaredLogger:         zap.New(core).Sugar(),
+		pipeline:              pipeline,
+		database:              database.NewStubDatabase(),
+		drainProgressInterval: 10 * time.Millisecond,
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- agent.Stop()
+	}()
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("Draining pipeline").Len() >= 2
+	}, time.Second, time.Millisecond)
+	close(drained)
+	require.NoError(t, <-stopped)
+
+	fields := logs.FilterMessage("Draining pipeline").All()[0].ContextMap()
+	require.Equal(t, map[string]int64{"$.output": 20}, fields["buffered_entries"])
+	require.Equal(t, map[string]int64{"$.input": 300}, fields["unread_bytes"])
+
+	// No progress is logged once the pipeline has stopped
+	logged := logs.FilterMessage("Draining pipeline").Len()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, logged, logs.FilterMessage("Draining pipeline").Len())
+}
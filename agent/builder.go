@@ -1,11 +1,14 @@
 package agent
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/observiq/stanza/database"
 	"github.com/observiq/stanza/errors"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/pipeline"
 	"github.com/observiq/stanza/plugin"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -19,6 +22,17 @@ type LogAgentBuilder struct {
 	pluginDir     string
 	databaseFile  string
 	defaultOutput operator.Operator
+
+	sampleBackpressure bool
+	strictDeprecations bool
+	statsInterval      time.Duration
+	statsRetention     time.Duration
+	runAsUser          string
+	runAsGroup         string
+	writeInterval      time.Duration
+	watchdogTimeout    time.Duration
+	watchdogRestart    bool
+	resumeFrom         string
 }
 
 // NewBuilder creates a new LogAgentBuilder
@@ -58,17 +72,90 @@ func (b *LogAgentBuilder) WithDefaultOutput(defaultOutput operator.Operator) *Lo
 	return b
 }
 
+// WithBackpressureSampling enables sampling of the time operators spend
+// blocked while handing entries off to their outputs
+func (b *LogAgentBuilder) WithBackpressureSampling(enabled bool) *LogAgentBuilder {
+	b.sampleBackpressure = enabled
+	return b
+}
+
+// WithStrictDeprecations fails the build if the config uses deprecated fields,
+// instead of logging a warning
+func (b *LogAgentBuilder) WithStrictDeprecations(strict bool) *LogAgentBuilder {
+	b.strictDeprecations = strict
+	return b
+}
+
+// WithStatsPersistence saves a snapshot of the operator stats to the database
+// at each interval, keeping snapshots for the retention period. Snapshots are
+// not saved if the interval is zero, and are kept forever if the retention is zero.
+func (b *LogAgentBuilder) WithStatsPersistence(interval, retention time.Duration) *LogAgentBuilder {
+	b.statsInterval = interval
+	b.statsRetention = retention
+	return b
+}
+
+// WithDatabaseWriteInterval batches the writes of the operators that persist
+// state into a single database transaction per interval. The writes of the
+// last interval are lost if the agent exits without stopping. Each write is
+// committed by its operator if the interval is zero.
+func (b *LogAgentBuilder) WithDatabaseWriteInterval(interval time.Duration) *LogAgentBuilder {
+	b.writeInterval = interval
+	return b
+}
+
+// WithPrivilegeDrop switches the agent to a user and group, given by name or
+// ID, once the listeners of the pipeline are bound and before the pipeline
+// starts. The group defaults to the primary group of the user. Privileges are
+// not dropped if neither is set.
+func (b *LogAgentBuilder) WithPrivilegeDrop(user, group string) *LogAgentBuilder {
+	b.runAsUser = user
+	b.runAsGroup = group
+	return b
+}
+
+// WithWatchdog reports the agent as unhealthy and logs the stacks of every
+// goroutine when its pipeline makes no progress for the timeout while work is
+// pending, such as unread bytes of files or entries in buffers. The pipeline
+// is restarted with the same config if restart is set. The watchdog is
+// disabled if the timeout is zero.
+func (b *LogAgentBuilder) WithWatchdog(timeout time.Duration, restart bool) *LogAgentBuilder {
+	b.watchdogTimeout = timeout
+	b.watchdogRestart = restart
+	return b
+}
+
+// WithResumeFromCheckpoint resumes the agent from the checkpoint at a
+// location, which replaces the offsets saved in its database. It is required
+// to start an agent while another agent has recently exported a checkpoint to
+// the location of its checkpoint config, so that two agents are not active at
+// the same time by accident.
+func (b *LogAgentBuilder) WithResumeFromCheckpoint(location string) *LogAgentBuilder {
+	b.resumeFrom = location
+	return b
+}
+
 // Build will build a new log agent using the values defined on the builder
 func (b *LogAgentBuilder) Build() (*LogAgent, error) {
+	// A privilege drop that cannot be done fails the build, rather than
+	// leaving the agent running with the privileges it started with
+	privileges, err := newPrivilegeDrop(b.runAsUser, b.runAsGroup)
+	if err != nil {
+		return nil, errors.Wrap(err, "drop privileges")
+	}
+
 	db, err := database.OpenDatabase(b.databaseFile)
 	if err != nil {
 		return nil, errors.Wrap(err, "open database")
 	}
 
-	if b.pluginDir != "" {
-		if err := plugin.RegisterPlugins(b.pluginDir, operator.DefaultRegistry); err != nil {
-			return nil, err
-		}
+	var writeBehind *database.WriteBehind
+	if b.writeInterval > 0 {
+		writeBehind = database.NewWriteBehind(db, b.writeInterval)
+	}
+
+	if err := b.registerPlugins(); err != nil {
+		return nil, err
 	}
 
 	if b.config != nil && len(b.configFiles) > 0 {
@@ -82,21 +169,199 @@ func (b *LogAgentBuilder) Build() (*LogAgent, error) {
 		}
 	}
 
+	if err := b.checkDeprecations(b.config); err != nil {
+		return nil, err
+	}
+
+	// The offsets of a checkpoint are imported before the pipeline is built,
+	// so the operators load them
+	checkpoints, err := b.buildCheckpoints(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "build checkpoint")
+	}
+
+	pipeline, throttles, err := b.buildPipeline(db, writeBehind, b.config)
+	if err != nil {
+		return nil, err
+	}
+
+	agent := &LogAgent{
+		pipeline:       pipeline,
+		database:       db,
+		writeBehind:    writeBehind,
+		throttles:      throttles,
+		builder:        b,
+		config:         b.config,
+		statsInterval:  b.statsInterval,
+		statsRetention: b.statsRetention,
+		privileges:     privileges,
+		checkpoints:    checkpoints,
+		done:           make(chan struct{}),
+		SugaredLogger:  b.logger,
+	}
+
+	if b.config.RemoteConfig != nil {
+		agent.remote, err = newRemotePoller(*b.config.RemoteConfig, agent.applyRemoteConfig, b.logger)
+		if err != nil {
+			_ = db.Close()
+			return nil, errors.Wrap(err, "build remote config")
+		}
+	}
+
+	if b.watchdogTimeout > 0 {
+		var restart func() error
+		if b.watchdogRestart {
+			restart = agent.restartPipeline
+		}
+		agent.watchdog = newWatchdog(b.watchdogTimeout, agent.sampleProgress, restart, b.logger)
+	}
+	return agent, nil
+}
+
+// registerPlugins registers the plugins in the plugin directory
+func (b *LogAgentBuilder) registerPlugins() error {
+	if b.pluginDir == "" {
+		return nil
+	}
+	return plugin.RegisterPlugins(b.pluginDir, operator.DefaultRegistry)
+}
+
+// buildCheckpoints builds the exporter of the checkpoints of the agent, if its
+// config has one. If the agent resumes from a checkpoint, the checkpoint is
+// imported into the database. Otherwise, the agent fails to build if another
+// agent may still be active.
+func (b *LogAgentBuilder) buildCheckpoints(db database.Database) (*checkpointExporter, error) {
+	if b.config.Checkpoint == nil {
+		if b.resumeFrom != "" {
+			return nil, errors.NewError(
+				"resuming from a checkpoint requires a checkpoint config",
+				"add a checkpoint block with the key of the checkpoint to the config",
+			)
+		}
+		return nil, nil
+	}
+
+	checkpoints, err := newCheckpointExporter(*b.config.Checkpoint, db, b.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.resumeFrom == "" {
+		if err := checkpoints.checkActive(context.Background()); err != nil {
+			return nil, err
+		}
+		return checkpoints, nil
+	}
+
+	checkpoint, err := checkpoints.resume(context.Background(), b.resumeFrom)
+	if err != nil {
+		return nil, err
+	}
+	b.logger.Infow("Resumed from checkpoint",
+		"location", b.resumeFrom,
+		"agent_id", checkpoint.AgentID,
+		"age", time.Since(checkpoint.Created).Round(time.Second).String(),
+		"operators", len(checkpoint.Offsets),
+	)
+
+	var buffered int64
+	for _, stats := range checkpoint.Buffers {
+		buffered += stats.Entries
+	}
+	if buffered > 0 {
+		b.logger.Warnw("Entries buffered by the agent that exported the checkpoint are not sent again", "agent_id", checkpoint.AgentID, "buffered_entries", buffered)
+	}
+	return checkpoints, nil
+}
+
+// readConfigFiles reads the config files again, along with the plugins they
+// may use, for an agent that is reloaded
+func (b *LogAgentBuilder) readConfigFiles() (*Config, error) {
+	if len(b.configFiles) == 0 {
+		return nil, errors.NewError(
+			"agent cannot be reloaded without config files",
+			"build the agent WithConfigFiles to reload it",
+		)
+	}
+
+	if err := b.registerPlugins(); err != nil {
+		return nil, err
+	}
+
+	config, err := NewConfigFromGlobs(b.configFiles)
+	if err != nil {
+		return nil, errors.Wrap(err, "read configs from globs")
+	}
+
+	if err := b.checkDeprecations(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// buildPipeline builds the pipeline and throttles of a config
+func (b *LogAgentBuilder) buildPipeline(db database.Database, writeBehind *database.WriteBehind, config *Config) (pipeline.Pipeline, *operator.Throttles, error) {
 	sampledLogger := b.logger.Desugar().WithOptions(
 		zap.WrapCore(func(core zapcore.Core) zapcore.Core {
 			return zapcore.NewSamplerWithOptions(core, time.Second, 5, 100)
 		}),
 	).Sugar()
 
+	throttles, err := operator.NewThrottles(config.Throttles)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "build throttles")
+	}
+
 	buildContext := operator.NewBuildContext(db, sampledLogger)
-	pipeline, err := b.config.Pipeline.BuildPipeline(buildContext, b.defaultOutput)
+	buildContext.SampleBackpressure = b.sampleBackpressure
+	buildContext.CollectStats = true
+	buildContext.Throttles = throttles
+	buildContext.WriteBehind = writeBehind
+	pipeline, err := config.BuildPipeline(buildContext, b.defaultOutput)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return pipeline, throttles, nil
+}
+
+// validateConfig builds the operators of a config against a stub database,
+// without starting them, so that a config that does not build is rejected
+// before the running pipeline is stopped
+func (b *LogAgentBuilder) validateConfig(config *Config) error {
+	throttles, err := operator.NewThrottles(config.Throttles)
+	if err != nil {
+		return errors.Wrap(err, "build throttles")
+	}
+
+	buildContext := operator.NewBuildContext(database.NewStubDatabase(), b.logger)
+	buildContext.Throttles = throttles
+	if errs := config.Validate(buildContext); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// checkDeprecations logs a single warning that lists each use of a deprecated
+// field in the config, or returns an error if deprecations are strict
+func (b *LogAgentBuilder) checkDeprecations(config *Config) error {
+	if len(config.Deprecations) == 0 {
+		return nil
+	}
+
+	usages := make([]string, 0, len(config.Deprecations))
+	for _, deprecation := range config.Deprecations {
+		usages = append(usages, deprecation.String())
+	}
+
+	if b.strictDeprecations {
+		return errors.NewError(
+			"config uses deprecated fields",
+			"rename the deprecated fields to their replacements",
+			"deprecations", strings.Join(usages, "; "),
+		)
 	}
 
-	return &LogAgent{
-		pipeline:      pipeline,
-		database:      db,
-		SugaredLogger: b.logger,
-	}, nil
+	b.logger.Warnw("Config uses deprecated fields that will be removed in a future release", "deprecations", usages)
+	return nil
 }
@@ -5,9 +5,12 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestBuildAgentSuccess(t *testing.T) {
@@ -27,6 +30,41 @@ func TestBuildAgentSuccess(t *testing.T) {
 	require.Equal(t, mockLogger, agent.SugaredLogger)
 }
 
+func TestBuildAgentThrottles(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	configFile := filepath.Join(tempDir, "config.yaml")
+	configContents := `
+throttles:
+  replay:
+    max_entries_per_second: 100
+pipeline:
+  - type: stanza_input
+    throttle: replay
+`
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(configContents), 0755))
+
+	agent, err := NewBuilder(zap.NewNop().Sugar()).
+		WithConfigFiles([]string{configFile}).
+		WithDefaultOutput(testutil.NewFakeOutput(t)).
+		Build()
+	require.NoError(t, err)
+	require.Contains(t, agent.Stats().Throttles, "replay")
+
+	configContents = `
+pipeline:
+  - type: stanza_input
+    throttle: missing
+`
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(configContents), 0755))
+
+	_, err = NewBuilder(zap.NewNop().Sugar()).
+		WithConfigFiles([]string{configFile}).
+		WithDefaultOutput(testutil.NewFakeOutput(t)).
+		Build()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "throttle 'missing' is not defined")
+}
+
 func TestBuildAgentFailureOnDatabase(t *testing.T) {
 	tempDir := testutil.NewTempDir(t)
 	invalidDatabaseFile := filepath.Join(tempDir, "test.db")
@@ -117,3 +155,43 @@ func TestBuildAgentFailureNonexistGlobs(t *testing.T) {
 	require.Contains(t, err.Error(), "read configs from globs")
 	require.Nil(t, agent)
 }
+
+func TestBuildAgentDeprecations(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Deprecations: []operator.Deprecation{
+				{File: "a.yaml", OperatorID: "stanza_input", Field: "buffer_size", Replacement: "queue_size"},
+				{File: "b.yaml", OperatorID: "elastic_output", Field: "buffer.max_size", Replacement: "buffer.max_bytes"},
+			},
+		}
+	}
+
+	t.Run("Warning", func(t *testing.T) {
+		core, logs := observer.New(zapcore.WarnLevel)
+		agent, err := NewBuilder(zap.New(core).Sugar()).
+			WithConfig(newConfig()).
+			WithDefaultOutput(testutil.NewFakeOutput(t)).
+			Build()
+		require.NoError(t, err)
+		require.NotNil(t, agent)
+
+		require.Equal(t, 1, logs.Len())
+		entry := logs.All()[0]
+		require.Equal(t, []interface{}{
+			"stanza_input (a.yaml): 'buffer_size' is deprecated, use 'queue_size' instead",
+			"elastic_output (b.yaml): 'buffer.max_size' is deprecated, use 'buffer.max_bytes' instead",
+		}, entry.ContextMap()["deprecations"])
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		agent, err := NewBuilder(zap.NewNop().Sugar()).
+			WithConfig(newConfig()).
+			WithDefaultOutput(testutil.NewFakeOutput(t)).
+			WithStrictDeprecations(true).
+			Build()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "config uses deprecated fields")
+		require.Contains(t, err.Error(), "buffer.max_size")
+		require.Nil(t, agent)
+	})
+}
@@ -0,0 +1,695 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/helper"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+const (
+	// checkpointVersion is the version of the format of checkpoints
+	checkpointVersion = 1
+
+	// defaultCheckpointInterval is the interval at which checkpoints are
+	// exported if none is set
+	defaultCheckpointInterval = 30 * time.Second
+
+	// defaultCheckpointMaxAge is the age of the oldest checkpoint that a
+	// standby agent resumes from if none is set
+	defaultCheckpointMaxAge = 5 * time.Minute
+
+	// defaultCheckpointTimeout is the timeout of reading or writing a
+	// checkpoint at an HTTP location if none is set
+	defaultCheckpointTimeout = 10 * time.Second
+
+	// minCheckpointKeySize is the smallest key that checkpoints are signed
+	// with, in bytes
+	minCheckpointKeySize = 16
+
+	// maxCheckpointSize is the largest checkpoint that is read
+	maxCheckpointSize = 64 << 20
+)
+
+// CheckpointConfig is the configuration of the checkpoints that an agent
+// exports for a standby agent. A checkpoint holds the offsets saved by the
+// operators and the depth of the buffers, and is signed with a key that the
+// active and standby agents share.
+type CheckpointConfig struct {
+	// Location is the path of a file on shared storage, or the HTTP URL, that
+	// checkpoints are written to and read from
+	Location string `json:"location" yaml:"location"`
+
+	// Key is the secret that checkpoints are signed with
+	Key helper.SecretConfig `json:"key" yaml:"key"`
+
+	// AgentID identifies the agent that exported a checkpoint, and is the
+	// hostname if it is not set
+	AgentID string `json:"agent_id,omitempty" yaml:"agent_id,omitempty"`
+
+	Interval helper.Duration   `json:"interval,omitempty" yaml:"interval,omitempty"`
+	MaxAge   helper.Duration   `json:"max_age,omitempty"  yaml:"max_age,omitempty"`
+	Timeout  helper.Duration   `json:"timeout,omitempty"  yaml:"timeout,omitempty"`
+	TLS      *helper.TLSConfig `json:"tls,omitempty"      yaml:"tls,omitempty"`
+}
+
+// Checkpoint is the persisted state of an agent, which a standby agent
+// resumes from
+type Checkpoint struct {
+	Version int       `json:"version"`
+	AgentID string    `json:"agent_id"`
+	Created time.Time `json:"created"`
+
+	// Offsets are the values saved by each operator, by operator ID and key
+	Offsets map[string]map[string][]byte `json:"offsets"`
+
+	// Buffers are the depths of the buffer of each output. Entries in the
+	// buffers of the exporting agent are not resent by a standby agent.
+	Buffers map[string]buffer.Stats `json:"buffers,omitempty"`
+}
+
+// signedCheckpoint is a checkpoint with the HMAC-SHA256 of its encoding
+type signedCheckpoint struct {
+	Checkpoint json.RawMessage `json:"checkpoint"`
+	Signature  string          `json:"signature"`
+}
+
+// CheckpointStatus is the state of the checkpoints of the agent, as reported
+// on the `/status` path
+type CheckpointStatus struct {
+	Location   string     `json:"location"`
+	AgentID    string     `json:"agent_id"`
+	LastExport *time.Time `json:"last_export,omitempty"`
+	ClaimedBy  string     `json:"claimed_by,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// checkpointStore reads and writes the checkpoint at a location
+type checkpointStore interface {
+	// read returns the checkpoint, or nil if there is none
+	read(ctx context.Context) ([]byte, error)
+	write(ctx context.Context, checkpoint []byte) error
+}
+
+// checkpointExporter exports a checkpoint of the state of the agent at each
+// interval. It stops exporting once another agent claims the location by
+// exporting a checkpoint of its own, such as a standby agent that resumed
+// from it.
+type checkpointExporter struct {
+	config   CheckpointConfig
+	agentID  string
+	key      []byte
+	store    checkpointStore
+	interval time.Duration
+	maxAge   time.Duration
+	timeout  time.Duration
+	db       database.Database
+
+	mux        sync.Mutex
+	lastExport time.Time
+	status     CheckpointStatus
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	*zap.SugaredLogger
+}
+
+// newCheckpointExporter creates an exporter of checkpoints. The key and TLS
+// files are loaded here, so that their errors fail the build of the agent.
+func newCheckpointExporter(config CheckpointConfig, db database.Database, logger *zap.SugaredLogger) (*checkpointExporter, error) {
+	if config.Location == "" {
+		return nil, errors.NewError(
+			"checkpoint requires a location",
+			"set the path of a file on shared storage, or the URL, to export checkpoints to",
+		)
+	}
+	if _, ok := db.(*database.StubDatabase); ok {
+		return nil, errors.NewError(
+			"checkpoint requires a database",
+			"set the path of the offsets database with --database",
+		)
+	}
+
+	key, err := config.Key.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read checkpoint key")
+	}
+	if len(key) < minCheckpointKeySize {
+		return nil, errors.NewError(
+			fmt.Sprintf("checkpoint key must be at least %d bytes", minCheckpointKeySize),
+			"use a random key, shared by the active and standby agents",
+		)
+	}
+
+	agentID := config.AgentID
+	if agentID == "" {
+		if agentID, err = os.Hostname(); err != nil {
+			return nil, errors.Wrap(err, "get hostname for checkpoint agent_id")
+		}
+	}
+
+	interval := config.Interval.Raw()
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	maxAge := config.MaxAge.Raw()
+	if maxAge <= 0 {
+		maxAge = defaultCheckpointMaxAge
+	}
+	if maxAge <= interval {
+		return nil, errors.NewError(
+			"checkpoint max_age must be longer than its interval",
+			"set max_age to a few intervals, so that the checkpoint of a running agent is never too old",
+			"interval", interval.String(),
+			"max_age", maxAge.String(),
+		)
+	}
+	timeout := config.Timeout.Raw()
+	if timeout <= 0 {
+		timeout = defaultCheckpointTimeout
+	}
+
+	store, err := newCheckpointStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &checkpointExporter{
+		config:        config,
+		agentID:       agentID,
+		key:           key,
+		store:         store,
+		interval:      interval,
+		maxAge:        maxAge,
+		timeout:       timeout,
+		db:            db,
+		status:        CheckpointStatus{Location: config.Location, AgentID: agentID},
+		SugaredLogger: logger.With("component", "checkpoint"),
+	}, nil
+}
+
+// newCheckpointStore returns the store of the location of a config, which
+// is an HTTP location if it is a URL, and a file otherwise
+func newCheckpointStore(config CheckpointConfig) (checkpointStore, error) {
+	location := config.Location
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return &fileCheckpointStore{path: strings.TrimPrefix(location, "file://")}, nil
+	}
+
+	timeout := config.Timeout.Raw()
+	if timeout <= 0 {
+		timeout = defaultCheckpointTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	if config.TLS != nil {
+		tlsConfig, err := config.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "load checkpoint tls")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+	return &httpCheckpointStore{url: location, client: client}, nil
+}
+
+// start exports a checkpoint at each interval, starting immediately, until
+// the exporter is stopped or another agent claims the location.
+// The buffers function returns the depths of the buffers of the running pipeline.
+func (c *checkpointExporter) start(buffers func() map[string]buffer.Stats) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.mux.Lock()
+	c.cancel, c.done = cancel, done
+	c.mux.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			err := c.export(ctx, buffers(), false)
+			status := c.currentStatus()
+			switch {
+			case ctx.Err() != nil:
+				return
+			case status.ClaimedBy != "":
+				c.Errorw("Checkpoint location was claimed by another agent. No longer exporting checkpoints", "claimed_by", status.ClaimedBy)
+				return
+			case err != nil:
+				c.Warnw("Failed to export checkpoint", zap.Any("error", err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop stops exporting, and waits for an export in progress to complete. It
+// does nothing if the exporter was not started.
+func (c *checkpointExporter) stop() {
+	c.mux.Lock()
+	cancel, done := c.cancel, c.done
+	c.mux.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// export writes a checkpoint of the offsets in the database and the depths of
+// the buffers to the location, unless another agent has claimed it by
+// exporting a checkpoint since the last export of this agent. The location is
+// written regardless when claim is set.
+func (c *checkpointExporter) export(ctx context.Context, buffers map[string]buffer.Stats, claim bool) error {
+	err := c.write(ctx, buffers, claim)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err != nil {
+		c.status.Error = err.Error()
+		return err
+	}
+	c.status.Error = ""
+	now := c.lastExport
+	c.status.LastExport = &now
+	return nil
+}
+
+// write exports a checkpoint, and records the claim of another agent
+func (c *checkpointExporter) write(ctx context.Context, buffers map[string]buffer.Stats, claim bool) error {
+	c.mux.Lock()
+	claimedBy, lastExport := c.status.ClaimedBy, c.lastExport
+	c.mux.Unlock()
+	if claimedBy != "" && !claim {
+		return errors.NewError(
+			fmt.Sprintf("checkpoint location was claimed by agent %s", claimedBy),
+			"this agent no longer exports checkpoints. Stop it, or restart it with --resume_from_checkpoint to take over again",
+		)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	current, err := c.load(ctx)
+	if err != nil && !claim {
+		return err
+	}
+	if !claim && current != nil && current.AgentID != c.agentID && current.Created.After(lastExport) {
+		c.mux.Lock()
+		c.status.ClaimedBy = current.AgentID
+		c.mux.Unlock()
+		return errors.NewError(
+			fmt.Sprintf("checkpoint location was claimed by agent %s", current.AgentID),
+			"only one agent should be active. Stop this agent, or restart it with --resume_from_checkpoint to take over again",
+		)
+	}
+
+	checkpoint, err := ExportCheckpoint(c.db, c.agentID)
+	if err != nil {
+		return err
+	}
+	checkpoint.Buffers = buffers
+
+	signed, err := c.sign(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := c.store.write(ctx, signed); err != nil {
+		return errors.Wrap(err, "write checkpoint").WithDetails("location", c.config.Location)
+	}
+
+	c.mux.Lock()
+	c.lastExport = checkpoint.Created
+	c.status.ClaimedBy = ""
+	c.mux.Unlock()
+	return nil
+}
+
+// checkActive returns an error if another agent exported a checkpoint to the
+// location within the max age, which means that it may still be active. It is
+// checked when an agent starts without resuming from the checkpoint, since two
+// active agents would both read and send the same files. A location that
+// cannot be read is logged, and does not keep the agent from starting.
+func (c *checkpointExporter) checkActive(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	current, err := c.load(ctx)
+	if err != nil {
+		c.Warnw("Failed to check whether another agent is active", zap.Any("error", err))
+		return nil
+	}
+	if current == nil || current.AgentID == c.agentID {
+		return nil
+	}
+
+	age := time.Since(current.Created)
+	if age > c.maxAge {
+		c.Warnw("Taking over checkpoint location from an agent that stopped exporting", "agent_id", current.AgentID, "age", age.Round(time.Second).String())
+		c.mux.Lock()
+		c.lastExport = current.Created
+		c.mux.Unlock()
+		return nil
+	}
+	return errors.NewError(
+		fmt.Sprintf("agent %s exported a checkpoint %s ago and may still be active", current.AgentID, age.Round(time.Second)),
+		"stop the other agent, or start this agent with --resume_from_checkpoint to take over from it",
+		"location", c.config.Location,
+	)
+}
+
+// resume imports the checkpoint at a location into the database, replacing
+// the offsets saved in it, and then claims the location by exporting a
+// checkpoint of its own. A checkpoint that cannot be verified, or that is
+// older than the max age, is an error.
+func (c *checkpointExporter) resume(ctx context.Context, location string) (*Checkpoint, error) {
+	store := c.store
+	if location != c.config.Location {
+		config := c.config
+		config.Location = location
+		var err error
+		if store, err = newCheckpointStore(config); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	contents, err := store.read(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "read checkpoint").WithDetails("location", location)
+	}
+	if contents == nil {
+		return nil, errors.NewError(
+			"no checkpoint found",
+			"check that the active agent exports checkpoints to this location",
+			"location", location,
+		)
+	}
+
+	checkpoint, err := c.verify(contents)
+	if err != nil {
+		return nil, errors.WithDetails(err, "location", location)
+	}
+
+	age := time.Since(checkpoint.Created)
+	if age > c.maxAge {
+		return nil, errors.NewError(
+			fmt.Sprintf("checkpoint is %s old, which is older than the max_age of %s", age.Round(time.Second), c.maxAge),
+			"check that the active agent is exporting checkpoints, or raise max_age to accept an older checkpoint",
+			"location", location,
+			"agent_id", checkpoint.AgentID,
+		)
+	}
+
+	if err := ImportCheckpoint(c.db, checkpoint); err != nil {
+		return nil, errors.Wrap(err, "import checkpoint")
+	}
+
+	// Exporting a checkpoint claims the location, so the agent that exported
+	// the imported checkpoint stops exporting
+	if err := c.export(ctx, nil, true); err != nil {
+		return nil, errors.Wrap(err, "claim checkpoint location")
+	}
+	return checkpoint, nil
+}
+
+// load reads and verifies the checkpoint at the location, and returns nil if
+// there is none
+func (c *checkpointExporter) load(ctx context.Context) (*Checkpoint, error) {
+	contents, err := c.store.read(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "read checkpoint").WithDetails("location", c.config.Location)
+	}
+	if contents == nil {
+		return nil, nil
+	}
+	return c.verify(contents)
+}
+
+// sign encodes a checkpoint with its signature
+func (c *checkpointExporter) sign(checkpoint *Checkpoint) ([]byte, error) {
+	encoded, err := json.Marshal(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signedCheckpoint{
+		Checkpoint: encoded,
+		Signature:  c.signature(encoded),
+	})
+}
+
+// verify decodes a signed checkpoint, and checks its signature and version
+func (c *checkpointExporter) verify(contents []byte) (*Checkpoint, error) {
+	var signed signedCheckpoint
+	if err := json.Unmarshal(contents, &signed); err != nil {
+		return nil, errors.Wrap(err, "decode checkpoint")
+	}
+	if !hmac.Equal([]byte(signed.Signature), []byte(c.signature(signed.Checkpoint))) {
+		return nil, errors.NewError(
+			"checkpoint signature is invalid",
+			"check that the active and standby agents use the same checkpoint key",
+		)
+	}
+
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(signed.Checkpoint, checkpoint); err != nil {
+		return nil, errors.Wrap(err, "decode checkpoint")
+	}
+	if checkpoint.Version != checkpointVersion {
+		return nil, errors.NewError(
+			fmt.Sprintf("checkpoint version %d is not supported", checkpoint.Version),
+			"run the same version of the agent on the active and standby hosts",
+		)
+	}
+	return checkpoint, nil
+}
+
+// signature returns the hex encoded HMAC-SHA256 of an encoded checkpoint
+func (c *checkpointExporter) signature(encoded []byte) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// currentStatus returns the state of the checkpoints
+func (c *checkpointExporter) currentStatus() *CheckpointStatus {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	status := c.status
+	return &status
+}
+
+// warning returns the error of the last export, if it failed
+func (c *checkpointExporter) warning() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.status.Error == "" {
+		return ""
+	}
+	return "checkpoint: " + c.status.Error
+}
+
+// currentBufferDepths returns the depths of the buffers of the running pipeline
+func (a *LogAgent) currentBufferDepths() map[string]buffer.Stats {
+	a.mux.RLock()
+	pipeline := a.pipeline
+	a.mux.RUnlock()
+	return bufferDepths(pipeline)
+}
+
+// exportFinalCheckpoint exports a checkpoint once the pipeline is stopped, so
+// that a standby agent resumes from the offsets saved by the stopped operators
+func (a *LogAgent) exportFinalCheckpoint() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.checkpoints.timeout)
+	defer cancel()
+
+	if err := a.checkpoints.export(ctx, a.currentBufferDepths(), false); err != nil {
+		a.Warnw("Failed to export final checkpoint", zap.Any("error", err))
+		return
+	}
+	a.Infow("Exported final checkpoint", "location", a.checkpoints.config.Location)
+}
+
+// ExportCheckpoint returns a checkpoint of the offsets saved in a database
+func ExportCheckpoint(db database.Database, agentID string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		Version: checkpointVersion,
+		AgentID: agentID,
+		Created: time.Now(),
+		Offsets: make(map[string]map[string][]byte),
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		offsetsBucket := tx.Bucket(helper.OffsetsBucket)
+		if offsetsBucket == nil {
+			return nil
+		}
+
+		return offsetsBucket.ForEach(func(operatorID, _ []byte) error {
+			bucket := offsetsBucket.Bucket(operatorID)
+			if bucket == nil {
+				return nil
+			}
+
+			// Values are copied, since they are only valid in the transaction
+			offsets := make(map[string][]byte)
+			err := bucket.ForEach(func(key, value []byte) error {
+				offsets[string(key)] = append([]byte{}, value...)
+				return nil
+			})
+			checkpoint.Offsets[string(operatorID)] = offsets
+			return err
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "read offsets")
+	}
+	return checkpoint, nil
+}
+
+// ImportCheckpoint replaces the offsets saved in a database with the offsets
+// of a checkpoint
+func ImportCheckpoint(db database.Database, checkpoint *Checkpoint) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(helper.OffsetsBucket) != nil {
+			if err := tx.DeleteBucket(helper.OffsetsBucket); err != nil {
+				return err
+			}
+		}
+
+		offsetsBucket, err := tx.CreateBucket(helper.OffsetsBucket)
+		if err != nil {
+			return err
+		}
+		for operatorID, offsets := range checkpoint.Offsets {
+			bucket, err := offsetsBucket.CreateBucket([]byte(operatorID))
+			if err != nil {
+				return err
+			}
+			for key, value := range offsets {
+				if err := bucket.Put([]byte(key), value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// fileCheckpointStore stores a checkpoint in a file, such as a file on
+// storage shared by the active and standby hosts
+type fileCheckpointStore struct {
+	path string
+}
+
+func (s *fileCheckpointStore) read(_ context.Context) ([]byte, error) {
+	contents, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return contents, err
+}
+
+// write writes the checkpoint to a temporary file that is renamed over the
+// checkpoint, so that a reader never sees a partial checkpoint
+func (s *fileCheckpointStore) write(_ context.Context, checkpoint []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(checkpoint); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// httpCheckpointStore stores a checkpoint at an HTTP URL, which it reads with
+// GET and writes with PUT
+type httpCheckpointStore struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpCheckpointStore) read(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("server responded with %s", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxCheckpointSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCheckpointSize {
+		return nil, fmt.Errorf("checkpoint is larger than %d bytes", maxCheckpointSize)
+	}
+	return body, nil
+}
+
+func (s *httpCheckpointStore) write(ctx context.Context, checkpoint []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.url, bytes.NewReader(checkpoint))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("server responded with %s", res.Status)
+	}
+	return nil
+}
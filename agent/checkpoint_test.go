@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// newCheckpointConfig returns a checkpoint config of an agent, with a key
+// file shared by every agent of the test
+func newCheckpointConfig(t *testing.T, location, agentID string) CheckpointConfig {
+	keyFile := filepath.Join(filepath.Dir(location), "checkpoint.key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef\n"), 0600))
+	return CheckpointConfig{
+		Location: location,
+		Key:      helper.SecretConfig{File: keyFile},
+		AgentID:  agentID,
+	}
+}
+
+func newTestExporter(t *testing.T, config CheckpointConfig, db database.Database) *checkpointExporter {
+	exporter, err := newCheckpointExporter(config, db, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	return exporter
+}
+
+// setOffset saves an offset in a database, as an operator does
+func setOffset(t *testing.T, db database.Database, operatorID, key, value string) {
+	persister := helper.NewScopedDBPersister(db, operatorID)
+	require.NoError(t, persister.Load())
+	persister.Set(key, []byte(value))
+	require.NoError(t, persister.Sync())
+}
+
+func TestCheckpointResume(t *testing.T) {
+	location := filepath.Join(testutil.NewTempDir(t), "checkpoint.json")
+
+	activeDB := testutil.NewTestDatabase(t)
+	setOffset(t, activeDB, "$.file_input", "knownFiles", "active offsets")
+	active := newTestExporter(t, newCheckpointConfig(t, location, "active"), activeDB)
+	require.NoError(t, active.export(context.Background(), map[string]buffer.Stats{"$.output": {Type: "disk", Entries: 3}}, false))
+	require.NotNil(t, active.currentStatus().LastExport)
+
+	standbyDB := testutil.NewTestDatabase(t)
+	setOffset(t, standbyDB, "$.old_input", "knownFiles", "standby offsets")
+	standby := newTestExporter(t, newCheckpointConfig(t, location, "standby"), standbyDB)
+	checkpoint, err := standby.resume(context.Background(), location)
+	require.NoError(t, err)
+	require.Equal(t, "active", checkpoint.AgentID)
+	require.Equal(t, int64(3), checkpoint.Buffers["$.output"].Entries)
+
+	// The offsets of the standby agent are replaced by those of the checkpoint
+	exported, err := ExportCheckpoint(standbyDB, "standby")
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string][]byte{
+		"$.file_input": {"knownFiles": []byte("active offsets")},
+	}, exported.Offsets)
+
+	// The standby agent claimed the location, so the active agent stops exporting
+	err = active.export(context.Background(), nil, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "claimed by agent standby")
+	require.Equal(t, "standby", active.currentStatus().ClaimedBy)
+	require.Contains(t, active.warning(), "claimed by agent standby")
+
+	current, err := standby.load(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "standby", current.AgentID)
+	require.NoError(t, standby.export(context.Background(), nil, false))
+}
+
+func TestCheckpointRejected(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+	location := filepath.Join(dir, "checkpoint.json")
+	config := newCheckpointConfig(t, location, "active")
+	config.Interval = helper.NewDuration(time.Second)
+	config.MaxAge = helper.NewDuration(time.Minute)
+	active := newTestExporter(t, config, testutil.NewTestDatabase(t))
+	standby := newTestExporter(t, newCheckpointConfig(t, location, "standby"), testutil.NewTestDatabase(t))
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := standby.resume(context.Background(), filepath.Join(dir, "missing.json"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no checkpoint found")
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		checkpoint, err := ExportCheckpoint(active.db, "active")
+		require.NoError(t, err)
+		checkpoint.Created = time.Now().Add(-time.Hour)
+		signed, err := active.sign(checkpoint)
+		require.NoError(t, err)
+		require.NoError(t, active.store.write(context.Background(), signed))
+
+		_, err = active.resume(context.Background(), location)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "older than the max_age of 1m0s")
+	})
+
+	t.Run("InvalidSignature", func(t *testing.T) {
+		require.NoError(t, active.export(context.Background(), nil, false))
+
+		otherKey := filepath.Join(dir, "other.key")
+		require.NoError(t, ioutil.WriteFile(otherKey, []byte("fedcba9876543210fedcba9876543210"), 0600))
+		config := newCheckpointConfig(t, filepath.Join(dir, "other.json"), "other")
+		config.Key = helper.SecretConfig{File: otherKey}
+		other := newTestExporter(t, config, testutil.NewTestDatabase(t))
+
+		_, err := other.resume(context.Background(), location)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "checkpoint signature is invalid")
+	})
+}
+
+func TestCheckpointCheckActive(t *testing.T) {
+	location := filepath.Join(testutil.NewTempDir(t), "checkpoint.json")
+	config := newCheckpointConfig(t, location, "active")
+	config.Interval = helper.NewDuration(time.Second)
+	config.MaxAge = helper.NewDuration(time.Minute)
+	active := newTestExporter(t, config, testutil.NewTestDatabase(t))
+
+	config.AgentID = "standby"
+	standby := newTestExporter(t, config, testutil.NewTestDatabase(t))
+
+	// Any agent can start while there is no checkpoint
+	require.NoError(t, standby.checkActive(context.Background()))
+
+	// An agent cannot start without resuming while another agent is active,
+	// but the agent that exported the checkpoint can restart
+	require.NoError(t, active.export(context.Background(), nil, false))
+	err := standby.checkActive(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "may still be active")
+	require.NoError(t, active.checkActive(context.Background()))
+
+	// An agent takes over the checkpoint of an agent that stopped exporting
+	checkpoint, err := ExportCheckpoint(active.db, "active")
+	require.NoError(t, err)
+	checkpoint.Created = time.Now().Add(-time.Hour)
+	signed, err := active.sign(checkpoint)
+	require.NoError(t, err)
+	require.NoError(t, active.store.write(context.Background(), signed))
+	require.NoError(t, standby.checkActive(context.Background()))
+	require.NoError(t, standby.export(context.Background(), nil, false))
+}
+
+func TestCheckpointHTTPLocation(t *testing.T) {
+	var mux sync.Mutex
+	var stored []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		switch {
+		case r.Method == http.MethodPut:
+			stored, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		case stored == nil:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write(stored)
+		}
+	}))
+	defer server.Close()
+
+	location := server.URL + "/checkpoint.json"
+	keyDir := filepath.Join(testutil.NewTempDir(t), "checkpoint.json")
+	config := newCheckpointConfig(t, keyDir, "active")
+	config.Location = location
+
+	activeDB := testutil.NewTestDatabase(t)
+	setOffset(t, activeDB, "$.file_input", "knownFiles", "active offsets")
+	active := newTestExporter(t, config, activeDB)
+	require.NoError(t, active.checkActive(context.Background()))
+	require.NoError(t, active.export(context.Background(), nil, false))
+
+	config.AgentID = "standby"
+	standbyDB := testutil.NewTestDatabase(t)
+	standby := newTestExporter(t, config, standbyDB)
+	_, err := standby.resume(context.Background(), location)
+	require.NoError(t, err)
+
+	exported, err := ExportCheckpoint(standbyDB, "standby")
+	require.NoError(t, err)
+	require.Equal(t, []byte("active offsets"), exported.Offsets["$.file_input"]["knownFiles"])
+}
+
+func TestNewCheckpointExporter(t *testing.T) {
+	location := filepath.Join(testutil.NewTempDir(t), "checkpoint.json")
+	shortKey := filepath.Join(filepath.Dir(location), "short.key")
+	require.NoError(t, ioutil.WriteFile(shortKey, []byte("short"), 0600))
+
+	cases := []struct {
+		name   string
+		modify func(*CheckpointConfig)
+		db     database.Database
+		err    string
+	}{
+		{"Default", func(c *CheckpointConfig) {}, nil, ""},
+		{"NoLocation", func(c *CheckpointConfig) { c.Location = "" }, nil, "checkpoint requires a location"},
+		{"NoDatabase", func(c *CheckpointConfig) {}, database.NewStubDatabase(), "checkpoint requires a database"},
+		{"NoKey", func(c *CheckpointConfig) { c.Key = helper.SecretConfig{} }, nil, "one of 'file' or 'env' must be set"},
+		{"ShortKey", func(c *CheckpointConfig) { c.Key.File = shortKey }, nil, "checkpoint key must be at least 16 bytes"},
+		{"MaxAgeBelowInterval", func(c *CheckpointConfig) { c.MaxAge = helper.NewDuration(10 * time.Second) }, nil, "max_age must be longer than its interval"},
+		{"MaxAgeBelowExplicitInterval", func(c *CheckpointConfig) {
+			c.Interval = helper.NewDuration(2 * time.Minute)
+			c.MaxAge = helper.NewDuration(time.Minute)
+		}, nil, "max_age must be longer than its interval"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newCheckpointConfig(t, location, "active")
+			tc.modify(&config)
+			db := tc.db
+			if db == nil {
+				db = testutil.NewTestDatabase(t)
+			}
+
+			exporter, err := newCheckpointExporter(config, db, zaptest.NewLogger(t).Sugar())
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.Equal(t, defaultCheckpointInterval, exporter.interval)
+				require.Equal(t, defaultCheckpointMaxAge, exporter.maxAge)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestBuildCheckpointsRequiresConfig(t *testing.T) {
+	builder := NewBuilder(zaptest.NewLogger(t).Sugar()).WithResumeFromCheckpoint("/mnt/shared/checkpoint.json")
+	builder.config = &Config{}
+	_, err := builder.buildCheckpoints(testutil.NewTestDatabase(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires a checkpoint config")
+}
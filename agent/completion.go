@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+)
+
+// Done returns a channel that is closed once every operator that stops the
+// agent when it completes, such as a file input with exit_after_backfill,
+// has completed. It is never closed if no operator stops the agent.
+func (a *LogAgent) Done() <-chan struct{} {
+	return a.done
+}
+
+// watchCompletion closes the done channel of the agent once the operators of
+// a pipeline that stop the agent have completed. The watch ends when the
+// pipeline is replaced by a reload or the agent stops.
+func (a *LogAgent) watchCompletion(pipeline pipeline.Pipeline) {
+	a.stopWatchingCompletion()
+	if a.done == nil {
+		return
+	}
+
+	var completed []<-chan struct{}
+	for _, op := range pipeline.Operators() {
+		completer, ok := op.(helper.Completer)
+		if !ok {
+			continue
+		}
+		if c := completer.Completed(); c != nil {
+			completed = append(completed, c)
+		}
+	}
+	if len(completed) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.completionCancel = cancel
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		for _, c := range completed {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c:
+			}
+		}
+		a.Infow("Every operator that stops the agent has completed", "operators", len(completed))
+		a.doneOnce.Do(func() { close(a.done) })
+	}()
+}
+
+// stopWatchingCompletion ends the watch of the operators of the current pipeline
+func (a *LogAgent) stopWatchingCompletion() {
+	if a.completionCancel != nil {
+		a.completionCancel()
+		a.completionCancel = nil
+	}
+}
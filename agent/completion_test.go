@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// completingOperator is an operator that completes when its channel is closed
+type completingOperator struct {
+	*testutil.Operator
+	completed chan struct{}
+}
+
+func (o completingOperator) Completed() <-chan struct{} {
+	if o.completed == nil {
+		return nil
+	}
+	return o.completed
+}
+
+func newCompletionTestAgent(operators ...operator.Operator) *LogAgent {
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Start").Return(nil)
+	pipeline.On("Operators").Return(operators)
+
+	return &LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		done:          make(chan struct{}),
+	}
+}
+
+func TestAgentDone(t *testing.T) {
+	first := completingOperator{Operator: &testutil.Operator{}, completed: make(chan struct{})}
+	second := completingOperator{Operator: &testutil.Operator{}, completed: make(chan struct{})}
+	// An operator that does not stop the agent is not waited for
+	never := completingOperator{Operator: &testutil.Operator{}}
+
+	agent := newCompletionTestAgent(first, never, second, &testutil.Operator{})
+	require.NoError(t, agent.Start())
+
+	close(first.completed)
+	select {
+	case <-agent.Done():
+		require.FailNow(t, "Agent done before every operator completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(second.completed)
+	select {
+	case <-agent.Done():
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for agent to be done")
+	}
+}
+
+func TestAgentNotDoneWithoutCompleters(t *testing.T) {
+	agent := newCompletionTestAgent(completingOperator{Operator: &testutil.Operator{}}, &testutil.Operator{})
+	require.NoError(t, agent.Start())
+
+	select {
+	case <-agent.Done():
+		require.FailNow(t, "Agent done without operators that stop it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Nil(t, agent.completionCancel)
+}
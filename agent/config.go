@@ -4,14 +4,38 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"sort"
 
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/pipeline"
+	"go.uber.org/zap"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// DefaultPipelineName is the name of the top-level pipeline of a config in
+// logs and graphs, when the config also has named pipelines
+const DefaultPipelineName = "default"
+
+// pipelineNamePattern matches the names of named pipelines, which are used
+// in the namespace of their operator IDs
+var pipelineNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 // Config is the configuration of the stanza log agent.
 type Config struct {
-	Pipeline pipeline.Config `json:"pipeline"                yaml:"pipeline"`
+	Vars            map[string]interface{}             `json:"vars,omitempty"             yaml:"vars,omitempty"`
+	Throttles       map[string]operator.ThrottleConfig `json:"throttles,omitempty"        yaml:"throttles,omitempty"`
+	DefaultTimezone string                             `json:"default_timezone,omitempty" yaml:"default_timezone,omitempty"`
+	Pipeline        pipeline.Config                    `json:"pipeline"                   yaml:"pipeline"`
+	Pipelines       map[string]pipeline.Config         `json:"pipelines,omitempty"        yaml:"pipelines,omitempty"`
+	RemoteConfig    *RemoteConfig                      `json:"remote_config,omitempty"    yaml:"remote_config,omitempty"`
+	ReadPriority    *operator.PriorityConfig           `json:"read_priority,omitempty"    yaml:"read_priority,omitempty"`
+	Checkpoint      *CheckpointConfig                  `json:"checkpoint,omitempty"       yaml:"checkpoint,omitempty"`
+
+	// Deprecations are the uses of deprecated fields in the config files
+	Deprecations []operator.Deprecation `json:"-" yaml:"-"`
 }
 
 // NewConfigFromFile will create a new agent config from a YAML file.
@@ -20,12 +44,30 @@ func NewConfigFromFile(file string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %s", err)
 	}
+	return newConfigFromBytes(contents, file)
+}
+
+// newConfigFromBytes will create a new agent config from YAML contents. The
+// source, such as the path of a file, is recorded in its deprecations.
+func newConfigFromBytes(contents []byte, source string) (*Config, error) {
+	contents, err := resolveVars(contents)
+	if err != nil {
+		return nil, err
+	}
 
 	config := Config{}
-	if err := yaml.UnmarshalStrict(contents, &config); err != nil {
+	deprecations, err := operator.CollectDeprecations(func() error {
+		return yaml.UnmarshalStrict(contents, &config)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to read config file as yaml: %s", err)
 	}
 
+	for _, deprecation := range deprecations {
+		deprecation.File = source
+		config.Deprecations = append(config.Deprecations, deprecation)
+	}
+
 	return &config, nil
 }
 
@@ -59,6 +101,252 @@ func NewConfigFromGlobs(globs []string) (*Config, error) {
 
 // mergeConfigs will merge two agent configs.
 func mergeConfigs(dst *Config, src *Config) *Config {
+	if len(src.Vars) > 0 && dst.Vars == nil {
+		dst.Vars = make(map[string]interface{}, len(src.Vars))
+	}
+	for key, value := range src.Vars {
+		dst.Vars[key] = value
+	}
+	if len(src.Throttles) > 0 && dst.Throttles == nil {
+		dst.Throttles = make(map[string]operator.ThrottleConfig, len(src.Throttles))
+	}
+	for name, throttle := range src.Throttles {
+		dst.Throttles[name] = throttle
+	}
+	if src.DefaultTimezone != "" {
+		dst.DefaultTimezone = src.DefaultTimezone
+	}
 	dst.Pipeline = append(dst.Pipeline, src.Pipeline...)
+	if len(src.Pipelines) > 0 && dst.Pipelines == nil {
+		dst.Pipelines = make(map[string]pipeline.Config, len(src.Pipelines))
+	}
+	for name, operators := range src.Pipelines {
+		dst.Pipelines[name] = append(dst.Pipelines[name], operators...)
+	}
+	if src.RemoteConfig != nil {
+		dst.RemoteConfig = src.RemoteConfig
+	}
+	if src.ReadPriority != nil {
+		dst.ReadPriority = src.ReadPriority
+	}
+	if src.Checkpoint != nil {
+		dst.Checkpoint = src.Checkpoint
+	}
+	dst.Deprecations = append(dst.Deprecations, src.Deprecations...)
 	return dst
 }
+
+// BuildPipeline builds the pipelines of a config. A config without named
+// pipelines builds its top-level pipeline, as a single pipeline. Otherwise,
+// each named pipeline is built on its own, with the IDs of its operators in
+// the namespace of its name, such as $.system.file_input, so operator IDs only
+// need to be unique within a pipeline, and the state the operators save does
+// not collide. A named pipeline that fails to build is logged and left out of
+// the group, so the other pipelines still run. The default output, if any,
+// is only added to the top-level pipeline.
+func (c *Config) BuildPipeline(bc operator.BuildContext, defaultOutput operator.Operator) (pipeline.Pipeline, error) {
+	bc, err := c.withDefaults(bc)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Pipelines) == 0 {
+		built, err := c.Pipeline.BuildPipeline(bc, defaultOutput)
+		if err != nil {
+			return nil, err
+		}
+		return built, nil
+	}
+
+	if err := c.validatePipelineNames(); err != nil {
+		return nil, err
+	}
+
+	var logger *zap.SugaredLogger
+	if bc.Logger != nil {
+		logger = bc.Logger.SugaredLogger
+	} else {
+		logger = zap.NewNop().Sugar()
+	}
+
+	names := make([]string, 0, len(c.Pipelines))
+	for name := range c.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	group := pipeline.NewGroup(logger)
+	operators := make([][]operator.Operator, 0, len(names)+1)
+	var firstErr error
+	build := func(name string, config pipeline.Config, bc operator.BuildContext, defaultOutput operator.Operator) {
+		built, err := config.BuildPipeline(bc, defaultOutput)
+		if err != nil {
+			err = errors.WithDetails(err, "pipeline", name)
+			logger.Errorw("Failed to build pipeline", "pipeline", name, zap.Any("error", err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		group.Add(name, built)
+		operators = append(operators, built.Operators())
+	}
+
+	if len(c.Pipeline) > 0 {
+		build(DefaultPipelineName, c.Pipeline, bc, defaultOutput)
+	}
+	for _, name := range names {
+		build(name, c.Pipelines[name], bc.WithSubNamespace(name), nil)
+	}
+
+	if len(group.Names()) == 0 {
+		return nil, firstErr
+	}
+
+	// Operators of different pipelines, such as file inputs that read the
+	// same files, can collect the same data
+	if err := pipeline.CheckOverlapsBetween(operators, logger); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// Validate builds the operators of each pipeline of the config and connects
+// them, without starting them, and returns each error that it finds. The
+// errors of a named pipeline have the name of the pipeline in their details.
+func (c *Config) Validate(bc operator.BuildContext) []error {
+	bc, err := c.withDefaults(bc)
+	if err != nil {
+		return []error{err}
+	}
+
+	if len(c.Pipelines) == 0 {
+		return c.Pipeline.Validate(bc)
+	}
+
+	if err := c.validatePipelineNames(); err != nil {
+		return []error{err}
+	}
+
+	names := make([]string, 0, len(c.Pipelines))
+	for name := range c.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, 0)
+	validate := func(name string, config pipeline.Config, bc operator.BuildContext) {
+		for _, err := range config.Validate(bc) {
+			errs = append(errs, errors.WithDetails(err, "pipeline", name))
+		}
+	}
+
+	if len(c.Pipeline) > 0 {
+		validate(DefaultPipelineName, c.Pipeline, bc)
+	}
+	for _, name := range names {
+		validate(name, c.Pipelines[name], bc.WithSubNamespace(name))
+	}
+	return errs
+}
+
+// CheckExpectations runs the expectations of the operators of each pipeline,
+// and returns an error for each one that fails
+func (c *Config) CheckExpectations(bc operator.BuildContext) []error {
+	bc, err := c.withDefaults(bc)
+	if err != nil {
+		return []error{err}
+	}
+
+	if len(c.Pipelines) == 0 {
+		return c.Pipeline.CheckExpectations(bc)
+	}
+
+	names := make([]string, 0, len(c.Pipelines))
+	for name := range c.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, 0)
+	check := func(name string, config pipeline.Config, bc operator.BuildContext) {
+		for _, err := range config.CheckExpectations(bc) {
+			errs = append(errs, errors.WithDetails(err, "pipeline", name))
+		}
+	}
+
+	if len(c.Pipeline) > 0 {
+		check(DefaultPipelineName, c.Pipeline, bc)
+	}
+	for _, name := range names {
+		check(name, c.Pipelines[name], bc.WithSubNamespace(name))
+	}
+	return errs
+}
+
+// withDefaults returns a build context with the settings of the config that
+// apply to every pipeline
+func (c *Config) withDefaults(bc operator.BuildContext) (operator.BuildContext, error) {
+	bc, err := c.withDefaultLocation(bc)
+	if err != nil {
+		return bc, err
+	}
+
+	if c.ReadPriority != nil {
+		if err := c.ReadPriority.Validate(); err != nil {
+			return bc, errors.Wrap(err, "read_priority")
+		}
+		bc = bc.Copy()
+		bc.ReadPriority = c.ReadPriority
+	}
+	return bc, nil
+}
+
+// withDefaultLocation returns a build context with the location of the
+// default timezone of the config, which parsers use for timestamps that do
+// not have a time zone
+func (c *Config) withDefaultLocation(bc operator.BuildContext) (operator.BuildContext, error) {
+	if c.DefaultTimezone == "" {
+		return bc, nil
+	}
+
+	location, err := helper.LoadLocation(c.DefaultTimezone)
+	if err != nil {
+		return bc, errors.Wrap(err, "load default_timezone")
+	}
+	bc = bc.Copy()
+	bc.DefaultLocation = location
+	return bc, nil
+}
+
+// validatePipelineNames checks that the names of the named pipelines can be
+// used as namespaces of operator IDs
+func (c *Config) validatePipelineNames() error {
+	topLevel := make(map[string]bool, len(c.Pipeline))
+	for _, config := range c.Pipeline {
+		topLevel[config.ID()] = true
+	}
+
+	for name := range c.Pipelines {
+		switch {
+		case name == DefaultPipelineName:
+			return errors.NewError(
+				fmt.Sprintf("pipeline name '%s' is reserved for the top-level pipeline", name),
+				"rename the pipeline",
+			)
+		case !pipelineNamePattern.MatchString(name):
+			return errors.NewError(
+				fmt.Sprintf("pipeline name '%s' is invalid", name),
+				"use only letters, digits, underscores and dashes in pipeline names",
+			)
+		case topLevel[name]:
+			// The operators of the pipeline would share the namespace of the
+			// operator, such as the operators of a plugin
+			return errors.NewError(
+				fmt.Sprintf("pipeline name '%s' is the same as the ID of an operator of the top-level pipeline", name),
+				"rename the pipeline or the operator",
+			)
+		}
+	}
+	return nil
+}
@@ -1,15 +1,23 @@
 package agent
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/observiq/stanza/operator"
-	_ "github.com/observiq/stanza/operator/builtin/transformer/noop"
+	_ "github.com/observiq/stanza/operator/builtin/input/stanza"
+	"github.com/observiq/stanza/operator/builtin/transformer/noop"
 	"github.com/observiq/stanza/pipeline"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestNewConfigFromFile(t *testing.T) {
@@ -27,6 +35,28 @@ pipeline:
 	require.Equal(t, len(config.Pipeline), 1)
 }
 
+func TestNewConfigFromFileWithDeprecations(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	configFile := filepath.Join(tempDir, "config.yaml")
+	configContents := `
+pipeline:
+  - type: stanza_input
+    buffer_size: 10
+  - type: noop
+`
+	err := ioutil.WriteFile(configFile, []byte(configContents), 0755)
+	require.NoError(t, err)
+
+	config, err := NewConfigFromFile(configFile)
+	require.NoError(t, err)
+	require.Equal(t, len(config.Pipeline), 2)
+
+	expected := []operator.Deprecation{
+		{File: configFile, OperatorID: "stanza_input", Field: "buffer_size", Replacement: "queue_size"},
+	}
+	require.Equal(t, expected, config.Deprecations)
+}
+
 func TestNewConfigWithMissingFile(t *testing.T) {
 	tempDir := testutil.NewTempDir(t)
 	configFile := filepath.Join(tempDir, "config.yaml")
@@ -114,3 +144,387 @@ func TestMergeConfigs(t *testing.T) {
 	config3 := mergeConfigs(&config1, &config2)
 	require.Equal(t, len(config3.Pipeline), 2)
 }
+
+func TestMergeConfigsWithPipelines(t *testing.T) {
+	config1 := Config{
+		Pipelines: map[string]pipeline.Config{
+			"system": {operator.Config{}},
+		},
+	}
+
+	config2 := Config{
+		Pipelines: map[string]pipeline.Config{
+			"system": {operator.Config{}},
+			"app":    {operator.Config{}},
+		},
+	}
+
+	config3 := mergeConfigs(&Config{}, &config1)
+	config3 = mergeConfigs(config3, &config2)
+	require.Len(t, config3.Pipelines["system"], 2)
+	require.Len(t, config3.Pipelines["app"], 1)
+}
+
+func TestMergeConfigsWithThrottles(t *testing.T) {
+	config1 := Config{
+		Throttles: map[string]operator.ThrottleConfig{
+			"live": {MaxEntriesPerSecond: 1000},
+		},
+	}
+
+	config2 := Config{
+		Throttles: map[string]operator.ThrottleConfig{
+			"replay": {MaxEntriesPerSecond: 100, MaxConcurrentReads: 2},
+		},
+	}
+
+	config3 := mergeConfigs(&Config{}, &config1)
+	config3 = mergeConfigs(config3, &config2)
+	require.Equal(t, map[string]operator.ThrottleConfig{
+		"live":   {MaxEntriesPerSecond: 1000},
+		"replay": {MaxEntriesPerSecond: 100, MaxConcurrentReads: 2},
+	}, config3.Throttles)
+}
+
+func TestMergeConfigsWithDefaultTimezone(t *testing.T) {
+	config := mergeConfigs(&Config{}, &Config{DefaultTimezone: "America/New_York"})
+	config = mergeConfigs(config, &Config{})
+	require.Equal(t, "America/New_York", config.DefaultTimezone)
+
+	config = mergeConfigs(config, &Config{DefaultTimezone: "Europe/Paris"})
+	require.Equal(t, "Europe/Paris", config.DefaultTimezone)
+}
+
+func TestConfigDefaultTimezone(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		config := &Config{}
+		bc, err := config.withDefaultLocation(testutil.NewBuildContext(t))
+		require.NoError(t, err)
+		require.Nil(t, bc.DefaultLocation)
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		config := &Config{DefaultTimezone: "America/New_York"}
+		bc, err := config.withDefaultLocation(testutil.NewBuildContext(t))
+		require.NoError(t, err)
+		require.Equal(t, "America/New_York", bc.DefaultLocation.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		config := &Config{DefaultTimezone: "Mars/Olympus"}
+		_, err := config.BuildPipeline(testutil.NewBuildContext(t), nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown time zone 'Mars/Olympus'")
+
+		errs := config.Validate(testutil.NewBuildContext(t))
+		require.Len(t, errs, 1)
+		require.Contains(t, errs[0].Error(), "load default_timezone")
+	})
+}
+
+func TestNewConfigWithVars(t *testing.T) {
+	cases := []struct {
+		name        string
+		contents    string
+		expected    string
+		expectedErr []string
+	}{
+		{
+			"Scalar",
+			`
+vars:
+  cluster: prod
+pipeline:
+  - type: noop
+    id: '{{ .vars.cluster }}'
+`,
+			"prod",
+			nil,
+		},
+		{
+			"Embedded",
+			`
+vars:
+  cluster: prod
+  region: east
+pipeline:
+  - type: noop
+    id: 'noop-{{ .vars.cluster }}-{{.vars.region}}'
+`,
+			"noop-prod-east",
+			nil,
+		},
+		{
+			"Nested",
+			`
+vars:
+  k8s:
+    cluster: prod
+pipeline:
+  - type: noop
+    id: '{{ .vars.k8s.cluster }}'
+`,
+			"prod",
+			nil,
+		},
+		{
+			"Undefined",
+			`
+vars:
+  cluster: prod
+pipeline:
+  - type: noop
+    id: '{{ .vars.region }}'
+  - type: noop
+    output: '{{ .vars.region }}'
+`,
+			"",
+			[]string{"undefined variable 'region'", "pipeline[0].id", "pipeline[1].output"},
+		},
+		{
+			"StructuredEmbedded",
+			`
+vars:
+  regions: [east, west]
+pipeline:
+  - type: noop
+    id: 'noop-{{ .vars.regions }}'
+`,
+			"",
+			[]string{"structured variable regions (pipeline[0].id) cannot be embedded"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testutil.NewTempDir(t)
+			configFile := filepath.Join(tempDir, "config.yaml")
+			err := ioutil.WriteFile(configFile, []byte(tc.contents), 0755)
+			require.NoError(t, err)
+
+			config, err := NewConfigFromFile(configFile)
+			if len(tc.expectedErr) > 0 {
+				require.Error(t, err)
+				for _, expected := range tc.expectedErr {
+					require.Contains(t, err.Error(), expected)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, config.Pipeline, 1)
+			require.Equal(t, tc.expected, config.Pipeline[0].ID())
+		})
+	}
+}
+
+func TestResolveVarsStructured(t *testing.T) {
+	contents := `
+vars:
+  include:
+    - /var/log/a.log
+    - /var/log/b.log
+pipeline:
+  - type: file_input
+    include: '{{ .vars.include }}'
+`
+	resolved, err := resolveVars([]byte(contents))
+	require.NoError(t, err)
+
+	var raw struct {
+		Pipeline []map[string]interface{} `yaml:"pipeline"`
+	}
+	err = yaml.Unmarshal(resolved, &raw)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"/var/log/a.log", "/var/log/b.log"}, raw.Pipeline[0]["include"])
+}
+
+// pipelineConfig is a pipeline that reads a file into another file, both in
+// a directory. An output that does not exist is set if broken is true.
+func pipelineConfig(dir string, broken bool) string {
+	output := "file_output"
+	if broken {
+		output = "missing"
+	}
+	return fmt.Sprintf(`
+    - id: file_input
+      type: file_input
+      include: [%s]
+      start_at: beginning
+      poll_interval: 10ms
+      output: %s
+    - id: file_output
+      type: file_output
+      path: %s
+`, filepath.Join(dir, "in.log"), output, filepath.Join(dir, "out.log"))
+}
+
+// newPipelinesAgent builds an agent with a named pipeline for each of the
+// directories
+func newPipelinesAgent(t *testing.T, logger *zap.SugaredLogger, dirs map[string]string, broken map[string]bool) (*LogAgent, error) {
+	tempDir := testutil.NewTempDir(t)
+	config := "pipelines:\n"
+	for name, dir := range dirs {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		config += fmt.Sprintf("  %s:", name) + pipelineConfig(dir, broken[name])
+	}
+
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(config), 0600))
+	return NewBuilder(logger).
+		WithConfigFiles([]string{configFile}).
+		WithDatabaseFile(filepath.Join(tempDir, "stanza.db")).
+		Build()
+}
+
+func TestNamedPipelines(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	dirs := map[string]string{
+		"system": filepath.Join(tempDir, "system"),
+		"app":    filepath.Join(tempDir, "app"),
+	}
+
+	agent, err := newPipelinesAgent(t, zaptest.NewLogger(t).Sugar(), dirs, nil)
+	require.NoError(t, err)
+
+	// Operator IDs are only unique within their pipeline
+	require.Equal(t, []string{
+		"$.app.file_input", "$.app.file_output",
+		"$.system.file_input", "$.system.file_output",
+	}, statusIDs(agent.Status()))
+
+	for name, dir := range dirs {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "in.log"), []byte(name+"\n"), 0600))
+	}
+	require.NoError(t, agent.Start())
+	defer agent.Stop()
+
+	for name, dir := range dirs {
+		entries := waitForOutput(t, dir, 1)
+		require.Len(t, entries, 1)
+		require.Equal(t, name, entries[0].Record)
+	}
+}
+
+func TestNamedPipelinesBuildError(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	dirs := map[string]string{
+		"system": filepath.Join(tempDir, "system"),
+		"app":    filepath.Join(tempDir, "app"),
+	}
+
+	t.Run("OneBroken", func(t *testing.T) {
+		core, logs := observer.New(zap.ErrorLevel)
+		agent, err := newPipelinesAgent(t, zap.New(core).Sugar(), dirs, map[string]bool{"app": true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"$.system.file_input", "$.system.file_output"}, statusIDs(agent.Status()))
+
+		entries := logs.FilterMessage("Failed to build pipeline").All()
+		require.Len(t, entries, 1)
+		require.Equal(t, "app", entries[0].ContextMap()["pipeline"])
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dirs["system"], "in.log"), []byte("system\n"), 0600))
+		require.NoError(t, agent.Start())
+		defer agent.Stop()
+		waitForOutput(t, dirs["system"], 1)
+	})
+
+	t.Run("AllBroken", func(t *testing.T) {
+		_, err := newPipelinesAgent(t, zap.NewNop().Sugar(), dirs, map[string]bool{"system": true, "app": true})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not exist")
+		require.Contains(t, err.Error(), "pipeline")
+	})
+}
+
+func TestNamedPipelinesOverlap(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	dir := filepath.Join(tempDir, "shared")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	// The file inputs of both pipelines read the same file
+	build := func(logger *zap.SugaredLogger, strict bool) (*LogAgent, error) {
+		app := pipelineConfig(dir, false)
+		if strict {
+			app = strings.Replace(app, "start_at: beginning", "start_at: beginning\n      strict_includes: true", 1)
+		}
+		config := "pipelines:\n  app:" + app + "  system:" + pipelineConfig(dir, false)
+		buildDir := testutil.NewTempDir(t)
+		configFile := filepath.Join(buildDir, "config.yaml")
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(config), 0600))
+		return NewBuilder(logger).
+			WithConfigFiles([]string{configFile}).
+			WithDatabaseFile(filepath.Join(buildDir, "stanza.db")).
+			Build()
+	}
+
+	t.Run("Warn", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		_, err := build(zap.New(core).Sugar(), false)
+		require.NoError(t, err)
+
+		entries := logs.FilterMessage("Operators collect overlapping data, which may be ingested twice").All()
+		require.Len(t, entries, 1)
+		require.Equal(t, "$.app.file_input", entries[0].ContextMap()["first_operator"])
+		require.Equal(t, "$.system.file_input", entries[0].ContextMap()["second_operator"])
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		_, err := build(zap.NewNop().Sugar(), true)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "overlapping")
+	})
+}
+
+func TestNamedPipelinesWithTopLevelPipeline(t *testing.T) {
+	config := &Config{
+		Pipeline: pipeline.Config{
+			operator.Config{Builder: noop.NewNoopOperatorConfig("noop")},
+		},
+		Pipelines: map[string]pipeline.Config{
+			"app": {operator.Config{Builder: noop.NewNoopOperatorConfig("noop")}},
+		},
+	}
+
+	built, err := config.BuildPipeline(testutil.NewBuildContext(t), nil)
+	require.NoError(t, err)
+	group, ok := built.(*pipeline.Group)
+	require.True(t, ok)
+	require.Equal(t, []string{DefaultPipelineName, "app"}, group.Names())
+
+	ids := make([]string, 0)
+	for _, op := range built.Operators() {
+		ids = append(ids, op.ID())
+	}
+	require.ElementsMatch(t, []string{"$.noop", "$.app.noop"}, ids)
+}
+
+func TestNamedPipelinesInvalidNames(t *testing.T) {
+	cases := []struct {
+		name     string
+		pipeline string
+		expected string
+	}{
+		{"Reserved", DefaultPipelineName, "reserved"},
+		{"Dot", "sys.tem", "invalid"},
+		{"Dollar", "$system", "invalid"},
+		{"Empty", "", "invalid"},
+		{"TopLevelOperator", "noop", "same as the ID of an operator"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{
+				Pipeline: pipeline.Config{
+					operator.Config{Builder: noop.NewNoopOperatorConfig("noop")},
+				},
+				Pipelines: map[string]pipeline.Config{
+					tc.pipeline: {operator.Config{Builder: noop.NewNoopOperatorConfig("noop")}},
+				},
+			}
+			_, err := config.BuildPipeline(testutil.NewBuildContext(t), nil)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
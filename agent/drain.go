@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+)
+
+// defaultDrainProgressInterval is the interval at which the progress of a
+// draining pipeline is logged while the agent stops
+const defaultDrainProgressInterval = 5 * time.Second
+
+// logDrainProgress logs the work left in a pipeline at each interval while it
+// is stopped, so that a slow stop can be told apart from a hung one. Buffered
+// outputs report the entries they have yet to flush, and inputs report the
+// bytes left to read in their files. The returned function stops the logging.
+func (a *LogAgent) logDrainProgress(pipeline pipeline.Pipeline) func() {
+	interval := a.drainProgressInterval
+	if interval <= 0 {
+		interval = defaultDrainProgressInterval
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		started := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				entries, bytes := drainPending(pipeline)
+				a.Infow("Draining pipeline",
+					"elapsed", time.Since(started).Round(time.Second).String(),
+					"buffered_entries", entries,
+					"unread_bytes", bytes,
+				)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// drainPending returns the work pending for each operator of a pipeline that
+// has any, by operator ID. Outputs report entries and inputs report bytes.
+func drainPending(pipeline pipeline.Pipeline) (entries map[string]int64, bytes map[string]int64) {
+	entries = make(map[string]int64)
+	bytes = make(map[string]int64)
+	for _, op := range pipeline.Operators() {
+		reporter, ok := op.(helper.PendingReporter)
+		if !ok {
+			continue
+		}
+		pending := reporter.PendingWork()
+		if pending <= 0 {
+			continue
+		}
+		if op.CanOutput() {
+			bytes[op.ID()] = pending
+		} else {
+			entries[op.ID()] = pending
+		}
+	}
+	return entries, bytes
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Handler returns an HTTP handler that serves the live state of the agent.
+// The `/stats` path serves a snapshot of the operator stats as JSON, the
+// `/status` path serves the status of the agent as JSON, the
+// `/maintenance` path parks and resumes buffered outputs, and the
+// `/log_level` path changes the log level of single operators. The
+// `/healthz` path serves the health of the agent as JSON, with a status of
+// 503 while the agent is unhealthy.
+func (a *LogAgent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", a.serveStats)
+	mux.HandleFunc("/status", a.serveStatus)
+	mux.HandleFunc("/maintenance", a.serveMaintenance)
+	mux.HandleFunc("/log_level", a.serveLogLevel)
+	mux.HandleFunc("/healthz", a.serveHealth)
+	return mux
+}
+
+// serveStats writes a snapshot of the operator stats as JSON
+func (a *LogAgent) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.Stats()); err != nil {
+		a.Warnw("Failed to write stats response", zap.Error(err))
+	}
+}
+
+// serveStatus writes the status of the agent as JSON
+func (a *LogAgent) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.Status()); err != nil {
+		a.Warnw("Failed to write status response", zap.Error(err))
+	}
+}
+
+// serveHealth writes the health of the agent as JSON
+func (a *LogAgent) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	health := a.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		a.Warnw("Failed to write health response", zap.Error(err))
+	}
+}
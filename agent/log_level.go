@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// OperatorLogLevel is the runtime log level and debug sample rate of an operator
+type OperatorLogLevel struct {
+	// Level is the overridden level of the operator's logger, or empty if the
+	// operator logs at the level of the agent
+	Level string `json:"level,omitempty"`
+
+	// DebugSample is the number of entries per minute the operator logs at the debug level
+	DebugSample int `json:"debug_sample"`
+}
+
+// SetLogLevel overrides the level of an operator's logger. If debugSample is
+// not nil, it also changes the number of entries per minute the operator logs.
+func (a *LogAgent) SetLogLevel(operatorID, level string, debugSample *int) (OperatorLogLevel, error) {
+	logLevel, sampler, err := a.operatorLogLevel(operatorID)
+	if err != nil {
+		return OperatorLogLevel{}, err
+	}
+
+	var zapLevel zapcore.Level
+	if level != "" {
+		if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+			return OperatorLogLevel{}, fmt.Errorf("invalid level '%s'", level)
+		}
+	}
+	if debugSample != nil {
+		if sampler == nil {
+			return OperatorLogLevel{}, fmt.Errorf("operator '%s' does not write entries, so it can't sample them", operatorID)
+		}
+		if err := sampler.SetRate(*debugSample); err != nil {
+			return OperatorLogLevel{}, err
+		}
+	}
+	if level != "" {
+		logLevel.Set(zapLevel)
+	}
+
+	a.Infow("Changed the log level of an operator", "operator_id", operatorID, "level", level, "debug_sample", debugSample)
+	return describeLogLevel(logLevel, sampler), nil
+}
+
+// ResetLogLevel returns an operator to the log level of the agent and its configured debug sample rate
+func (a *LogAgent) ResetLogLevel(operatorID string) (OperatorLogLevel, error) {
+	logLevel, sampler, err := a.operatorLogLevel(operatorID)
+	if err != nil {
+		return OperatorLogLevel{}, err
+	}
+
+	logLevel.Reset()
+	if sampler != nil {
+		sampler.Reset()
+	}
+	return describeLogLevel(logLevel, sampler), nil
+}
+
+// LogLevels returns the runtime log level of each operator
+func (a *LogAgent) LogLevels() map[string]OperatorLogLevel {
+	levels := make(map[string]OperatorLogLevel)
+	p := a.currentPipeline()
+	if p == nil {
+		return levels
+	}
+
+	for _, op := range p.Operators() {
+		reporter, ok := op.(helper.LogLevelReporter)
+		if !ok || reporter.OperatorLogLevel() == nil {
+			continue
+		}
+		levels[op.ID()] = describeLogLevel(reporter.OperatorLogLevel(), debugSampler(op))
+	}
+	return levels
+}
+
+// operatorLogLevel returns the log level and debug sampler of an operator.
+// The sampler is nil if the operator does not write entries.
+func (a *LogAgent) operatorLogLevel(operatorID string) (*helper.LogLevel, *helper.DebugSampler, error) {
+	p := a.currentPipeline()
+	if p != nil {
+		for _, op := range p.Operators() {
+			if op.ID() != operatorID {
+				continue
+			}
+			if reporter, ok := op.(helper.LogLevelReporter); ok && reporter.OperatorLogLevel() != nil {
+				return reporter.OperatorLogLevel(), debugSampler(op), nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("operator '%s' does not exist or its log level can't be changed", operatorID)
+}
+
+// debugSampler returns the debug sampler of an operator, or nil if it has none
+func debugSampler(op interface{}) *helper.DebugSampler {
+	if reporter, ok := op.(helper.DebugSampleReporter); ok {
+		return reporter.DebugSample()
+	}
+	return nil
+}
+
+// describeLogLevel returns the runtime log level of an operator
+func describeLogLevel(logLevel *helper.LogLevel, sampler *helper.DebugSampler) OperatorLogLevel {
+	var described OperatorLogLevel
+	if level, ok := logLevel.Level(); ok {
+		described.Level = level.String()
+	}
+	if sampler != nil {
+		described.DebugSample = sampler.Rate()
+	}
+	return described
+}
+
+// serveLogLevel lists and changes the log levels of operators. A GET lists the
+// log level of each operator. A POST sets the `level` of the operator in the
+// `operator` query parameter, and its `debug_sample` rate. A DELETE returns the
+// operator to the level of the agent and its configured debug sample rate.
+func (a *LogAgent) serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	var response interface{}
+	var err error
+
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		response = a.LogLevels()
+	case http.MethodPost:
+		var debugSample *int
+		if value := query.Get("debug_sample"); value != "" {
+			rate, parseErr := strconv.Atoi(value)
+			if parseErr != nil {
+				http.Error(w, "'debug_sample' must be an integer", http.StatusBadRequest)
+				return
+			}
+			debugSample = &rate
+		}
+		if query.Get("level") == "" && debugSample == nil {
+			http.Error(w, "one of 'level' or 'debug_sample' is required", http.StatusBadRequest)
+			return
+		}
+		response, err = a.SetLogLevel(query.Get("operator"), query.Get("level"), debugSample)
+	case http.MethodDelete:
+		response, err = a.ResetLogLevel(query.Get("operator"))
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		a.Warnw("Failed to write log level response", zap.Error(err))
+	}
+}
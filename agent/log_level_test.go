@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type levelOperator struct {
+	countingOperator
+	logLevel *helper.LogLevel
+	sampler  *helper.DebugSampler
+}
+
+func (o levelOperator) OperatorLogLevel() *helper.LogLevel {
+	return o.logLevel
+}
+
+func (o levelOperator) DebugSample() *helper.DebugSampler {
+	return o.sampler
+}
+
+func newLogLevelAgent(t *testing.T) (*LogAgent, levelOperator) {
+	parser := levelOperator{newCountingOperator("$.parser", nil), &helper.LogLevel{}, helper.NewDebugSampler(5, zap.NewNop().Sugar())}
+	operators := []operator.Operator{
+		parser,
+		levelOperator{newCountingOperator("$.output", nil), &helper.LogLevel{}, nil},
+		newCountingOperator("$.fixed", nil),
+	}
+
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Start").Return(nil)
+	pipeline.On("Stop").Return(nil)
+	pipeline.On("Operators").Return(operators)
+
+	agent := &LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		database:      testutil.NewTestDatabase(t),
+	}
+	require.NoError(t, agent.Start())
+	return agent, parser
+}
+
+func TestAgentLogLevel(t *testing.T) {
+	agent, parser := newLogLevelAgent(t)
+	defer agent.Stop()
+
+	require.Equal(t, map[string]OperatorLogLevel{
+		"$.parser": {DebugSample: 5},
+		"$.output": {},
+	}, agent.LogLevels())
+
+	rate := 20
+	level, err := agent.SetLogLevel("$.parser", "debug", &rate)
+	require.NoError(t, err)
+	require.Equal(t, OperatorLogLevel{Level: "debug", DebugSample: 20}, level)
+	override, ok := parser.logLevel.Level()
+	require.True(t, ok)
+	require.Equal(t, zapcore.DebugLevel, override)
+
+	level, err = agent.ResetLogLevel("$.parser")
+	require.NoError(t, err)
+	require.Equal(t, OperatorLogLevel{DebugSample: 5}, level)
+
+	_, err = agent.SetLogLevel("$.output", "debug", nil)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		id     string
+		level  string
+		sample int
+	}{
+		{"Missing", "$.missing", "debug", -1},
+		{"Fixed", "$.fixed", "debug", -1},
+		{"InvalidLevel", "$.parser", "verbose", -1},
+		{"SampleTooHigh", "$.parser", "", helper.MaxDebugSample + 1},
+		{"NoSampler", "$.output", "", 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sample *int
+			if tc.sample >= 0 {
+				sample = &tc.sample
+			}
+			_, err := agent.SetLogLevel(tc.id, tc.level, sample)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestHandlerLogLevel(t *testing.T) {
+	agent, parser := newLogLevelAgent(t)
+	defer agent.Stop()
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		agent.Handler().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/log_level?operator=$.parser&level=debug&debug_sample=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var level OperatorLogLevel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &level))
+	require.Equal(t, OperatorLogLevel{Level: "debug", DebugSample: 10}, level)
+
+	rec = serve(http.MethodGet, "/log_level")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var levels map[string]OperatorLogLevel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &levels))
+	require.Equal(t, level, levels["$.parser"])
+
+	rec = serve(http.MethodDelete, "/log_level?operator=$.parser")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, 5, parser.sampler.Rate())
+
+	cases := []struct {
+		name     string
+		method   string
+		target   string
+		expected int
+	}{
+		{"NoChange", http.MethodPost, "/log_level?operator=$.parser", http.StatusBadRequest},
+		{"InvalidSample", http.MethodPost, "/log_level?operator=$.parser&debug_sample=many", http.StatusBadRequest},
+		{"UnknownOperator", http.MethodDelete, "/log_level?operator=$.missing", http.StatusBadRequest},
+		{"Method", http.MethodPut, "/log_level", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, serve(tc.method, tc.target).Code)
+		})
+	}
+}
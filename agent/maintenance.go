@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+	"go.uber.org/zap"
+)
+
+// Park parks a buffered output until a time. Its entries accumulate in its
+// buffer until the time passes or the output is resumed.
+func (a *LogAgent) Park(operatorID string, until time.Time) (helper.MaintenanceStatus, error) {
+	maintenance, err := a.maintenance(operatorID)
+	if err != nil {
+		return helper.MaintenanceStatus{}, err
+	}
+
+	maintenance.Park(until)
+	status := maintenance.Status()
+	if status.MemoryBuffer {
+		a.Warnw("Output parked for maintenance with a memory buffer. Buffered entries are lost if the agent stops", "operator_id", operatorID)
+	}
+	return status, nil
+}
+
+// Resume ends the maintenance of a buffered output
+func (a *LogAgent) Resume(operatorID string) (helper.MaintenanceStatus, error) {
+	maintenance, err := a.maintenance(operatorID)
+	if err != nil {
+		return helper.MaintenanceStatus{}, err
+	}
+
+	maintenance.Resume()
+	return maintenance.Status(), nil
+}
+
+// Maintenance returns the maintenance state of each output that can be parked
+func (a *LogAgent) Maintenance() map[string]helper.MaintenanceStatus {
+	statuses := make(map[string]helper.MaintenanceStatus)
+	for id, maintenance := range maintenanceOutputs(a.currentPipeline()) {
+		statuses[id] = maintenance.Status()
+	}
+	return statuses
+}
+
+// maintenance returns the maintenance of an output that can be parked
+func (a *LogAgent) maintenance(operatorID string) (*helper.Maintenance, error) {
+	maintenance, ok := maintenanceOutputs(a.currentPipeline())[operatorID]
+	if !ok {
+		return nil, fmt.Errorf("operator '%s' is not a buffered output that can be parked", operatorID)
+	}
+	return maintenance, nil
+}
+
+// currentPipeline returns the running pipeline
+func (a *LogAgent) currentPipeline() pipeline.Pipeline {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	return a.pipeline
+}
+
+// maintenanceOutputs returns the maintenance of each output in a pipeline that
+// has a flusher to park
+func maintenanceOutputs(p pipeline.Pipeline) map[string]*helper.Maintenance {
+	outputs := make(map[string]*helper.Maintenance)
+	if p == nil {
+		return outputs
+	}
+
+	for _, op := range p.Operators() {
+		reporter, ok := op.(helper.MaintenanceReporter)
+		if !ok {
+			continue
+		}
+		if maintenance := reporter.MaintenanceMode(); maintenance != nil && maintenance.Attached() {
+			outputs[op.ID()] = maintenance
+		}
+	}
+	return outputs
+}
+
+// parkedOutputs returns the maintenance state of each parked output in a pipeline
+func parkedOutputs(p pipeline.Pipeline) map[string]helper.MaintenanceStatus {
+	parked := make(map[string]helper.MaintenanceStatus)
+	for id, maintenance := range maintenanceOutputs(p) {
+		if status := maintenance.Status(); status.Parked {
+			parked[id] = status
+		}
+	}
+	return parked
+}
+
+// serveMaintenance lists, parks and resumes buffered outputs. A GET lists the
+// maintenance state of each output. A POST parks the output in the `operator`
+// query parameter until the RFC 3339 timestamp in `until`, or for the duration
+// in `for`. A DELETE resumes the output.
+func (a *LogAgent) serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	var response interface{}
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response = a.Maintenance()
+	case http.MethodPost:
+		var until time.Time
+		until, err = parseParkUntil(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err = a.Park(r.URL.Query().Get("operator"), until)
+	case http.MethodDelete:
+		response, err = a.Resume(r.URL.Query().Get("operator"))
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		a.Warnw("Failed to write maintenance response", zap.Error(err))
+	}
+}
+
+// parseParkUntil returns the end of a maintenance requested with either an
+// `until` timestamp or a `for` duration
+func parseParkUntil(r *http.Request, now time.Time) (time.Time, error) {
+	query := r.URL.Query()
+	untilValue, forValue := query.Get("until"), query.Get("for")
+
+	switch {
+	case untilValue != "" && forValue != "":
+		return time.Time{}, fmt.Errorf("only one of 'until' and 'for' can be set")
+	case untilValue != "":
+		until, err := time.Parse(time.RFC3339, untilValue)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'until' must be an RFC 3339 timestamp, such as 2006-01-02T15:04:05Z")
+		}
+		return until, nil
+	case forValue != "":
+		duration, err := time.ParseDuration(forValue)
+		if err != nil || duration <= 0 {
+			return time.Time{}, fmt.Errorf("'for' must be a positive duration, such as 2h")
+		}
+		return now.Add(duration), nil
+	default:
+		return time.Time{}, fmt.Errorf("one of 'until' or 'for' is required")
+	}
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type parkableOperator struct {
+	countingOperator
+	maintenance *helper.Maintenance
+}
+
+func (o parkableOperator) MaintenanceMode() *helper.Maintenance {
+	return o.maintenance
+}
+
+func newMaintenanceAgent(t *testing.T) (*LogAgent, *helper.OperatorStats) {
+	stats := &helper.OperatorStats{}
+	attached := helper.NewMaintenance(time.Time{}, stats)
+	attached.Attach(false)
+
+	operators := []operator.Operator{
+		parkableOperator{newCountingOperator("$.buffered", stats), attached},
+		parkableOperator{newCountingOperator("$.unbuffered", nil), helper.NewMaintenance(time.Time{}, nil)},
+		newCountingOperator("$.input", nil),
+	}
+
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Start").Return(nil)
+	pipeline.On("Stop").Return(nil)
+	pipeline.On("Operators").Return(operators)
+
+	agent := &LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		database:      testutil.NewTestDatabase(t),
+	}
+	require.NoError(t, agent.Start())
+	return agent, stats
+}
+
+func TestAgentMaintenance(t *testing.T) {
+	agent, stats := newMaintenanceAgent(t)
+	defer agent.Stop()
+
+	require.Equal(t, map[string]helper.MaintenanceStatus{
+		"$.buffered": {},
+	}, agent.Maintenance())
+	require.Nil(t, agent.Stats().Maintenance)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	status, err := agent.Park("$.buffered", until)
+	require.NoError(t, err)
+	require.True(t, status.Parked)
+
+	stats.AddIn(4)
+	snapshot := agent.Stats()
+	require.Equal(t, map[string]helper.MaintenanceStatus{
+		"$.buffered": {Parked: true, Until: &until, Backlog: 4},
+	}, snapshot.Maintenance)
+
+	status, err = agent.Resume("$.buffered")
+	require.NoError(t, err)
+	require.False(t, status.Parked)
+	require.Nil(t, agent.Stats().Maintenance)
+
+	for _, id := range []string{"$.unbuffered", "$.input", "$.missing"} {
+		_, err = agent.Park(id, until)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "is not a buffered output that can be parked")
+	}
+}
+
+func TestHandlerMaintenance(t *testing.T) {
+	agent, _ := newMaintenanceAgent(t)
+	defer agent.Stop()
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		agent.Handler().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/maintenance?operator=$.buffered&for=2h")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status helper.MaintenanceStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.True(t, status.Parked)
+	require.WithinDuration(t, time.Now().Add(2*time.Hour), *status.Until, time.Minute)
+
+	rec = serve(http.MethodGet, "/maintenance")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var statuses map[string]helper.MaintenanceStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	require.True(t, statuses["$.buffered"].Parked)
+
+	rec = serve(http.MethodDelete, "/maintenance?operator=$.buffered")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.False(t, agent.Maintenance()["$.buffered"].Parked)
+
+	cases := []struct {
+		name     string
+		method   string
+		target   string
+		expected int
+	}{
+		{"UntilAndFor", http.MethodPost, "/maintenance?operator=$.buffered&for=2h&until=2020-10-01T00:00:00Z", http.StatusBadRequest},
+		{"NoEnd", http.MethodPost, "/maintenance?operator=$.buffered", http.StatusBadRequest},
+		{"InvalidUntil", http.MethodPost, "/maintenance?operator=$.buffered&until=tomorrow", http.StatusBadRequest},
+		{"NegativeFor", http.MethodPost, "/maintenance?operator=$.buffered&for=-1h", http.StatusBadRequest},
+		{"UnknownOperator", http.MethodPost, "/maintenance?operator=$.missing&for=2h", http.StatusNotFound},
+		{"Unparkable", http.MethodDelete, "/maintenance?operator=$.unbuffered", http.StatusNotFound},
+		{"Method", http.MethodPut, "/maintenance", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, serve(tc.method, tc.target).Code)
+		})
+	}
+}
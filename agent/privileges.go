@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+)
+
+// privilegeDrop switches the agent to an unprivileged user and group once
+// the listeners of the pipeline are bound
+type privilegeDrop struct {
+	user  string
+	group string
+	uid   int
+	gid   int
+
+	// setIDs sets the user and group IDs of the process. A negative ID is left as it is.
+	setIDs func(uid, gid int) error
+}
+
+// newPrivilegeDrop looks up the user and group to switch to. It returns nil
+// if neither is set, and an error if they do not exist, or if privileges
+// cannot be dropped on this platform.
+func newPrivilegeDrop(user, group string) (*privilegeDrop, error) {
+	if user == "" && group == "" {
+		return nil, nil
+	}
+
+	uid, gid, err := lookupIDs(user, group)
+	if err != nil {
+		return nil, err
+	}
+
+	return &privilegeDrop{
+		user:   user,
+		group:  group,
+		uid:    uid,
+		gid:    gid,
+		setIDs: setIDs,
+	}, nil
+}
+
+// drop switches the process to the user and group
+func (p *privilegeDrop) drop() error {
+	if err := p.setIDs(p.uid, p.gid); err != nil {
+		return fmt.Errorf("drop privileges to user '%s' and group '%s': %s", p.user, p.group, err)
+	}
+	return nil
+}
+
+// bindListeners binds the listeners of the operators of a pipeline that
+// listen on network addresses
+func bindListeners(pipeline pipeline.Pipeline) error {
+	for _, op := range pipeline.Operators() {
+		binder, ok := op.(helper.Binder)
+		if !ok {
+			continue
+		}
+		if err := binder.Bind(); err != nil {
+			return fmt.Errorf("bind listener of operator '%s': %s", op.ID(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// +build linux,go1.16
+
+package agent
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupIDs returns the IDs of a user and group, given by name or ID. The
+// group defaults to the primary group of the user, and a user that is not
+// set is returned as -1.
+func lookupIDs(userName, groupName string) (int, int, error) {
+	uid, gid := -1, -1
+
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			if u, err = user.LookupId(userName); err != nil {
+				return 0, 0, fmt.Errorf("look up user '%s': %s", userName, err)
+			}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("parse uid of user '%s': %s", userName, err)
+		}
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return 0, 0, fmt.Errorf("parse gid of user '%s': %s", userName, err)
+		}
+	}
+
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return 0, 0, fmt.Errorf("look up group '%s': %s", groupName, err)
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("parse gid of group '%s': %s", groupName, err)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// setIDs sets the group, then the user of every thread of the process. The
+// supplementary groups of the privileged user are dropped as well, since
+// they cannot be changed once the user is switched. Before Go 1.16, these
+// calls failed on linux rather than change the IDs of every thread.
+func setIDs(uid, gid int) error {
+	if gid >= 0 {
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return fmt.Errorf("setgroups: %s", err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("setgid: %s", err)
+		}
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("setuid: %s", err)
+		}
+	}
+	return nil
+}
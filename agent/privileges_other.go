@@ -0,0 +1,27 @@
+// +build !linux !go1.16
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// lookupIDs fails, since privileges can only be dropped on linux
+func lookupIDs(_, _ string) (int, int, error) {
+	return 0, 0, fmt.Errorf("dropping privileges to a user or group is not supported %s", unsupportedBy())
+}
+
+// setIDs fails, since privileges can only be dropped on linux
+func setIDs(_, _ int) error {
+	return fmt.Errorf("dropping privileges is not supported %s", unsupportedBy())
+}
+
+// unsupportedBy describes why privileges cannot be dropped. Go only sets the
+// IDs of every thread of a linux process since Go 1.16.
+func unsupportedBy() string {
+	if runtime.GOOS == "linux" {
+		return fmt.Sprintf("by binaries built with %s, which is older than Go 1.16", runtime.Version())
+	}
+	return "on " + runtime.GOOS
+}
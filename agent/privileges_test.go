@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// bindingOperator is an operator that records when its listener is bound
+type bindingOperator struct {
+	*testutil.Operator
+	calls   *[]string
+	bindErr error
+}
+
+func (o bindingOperator) Bind() error {
+	*o.calls = append(*o.calls, "bind")
+	return o.bindErr
+}
+
+func newPrivilegeTestAgent(calls *[]string, bindErr, dropErr error) (*LogAgent, *testutil.Pipeline) {
+	op := &testutil.Operator{}
+	op.On("ID").Return("tcp_input")
+
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Operators").Return([]operator.Operator{
+		bindingOperator{Operator: op, calls: calls, bindErr: bindErr},
+		&testutil.Operator{},
+	})
+	pipeline.On("Start").Run(func(mock.Arguments) {
+		*calls = append(*calls, "start")
+	}).Return(nil)
+
+	agent := &LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		privileges: &privilegeDrop{
+			user: "stanza",
+			uid:  1000,
+			gid:  1000,
+			setIDs: func(uid, gid int) error {
+				*calls = append(*calls, fmt.Sprintf("drop %d:%d", uid, gid))
+				return dropErr
+			},
+		},
+	}
+	return agent, pipeline
+}
+
+func TestStartAgentDropsPrivileges(t *testing.T) {
+	cases := []struct {
+		name     string
+		bindErr  error
+		dropErr  error
+		expected []string
+		errorMsg string
+	}{
+		{"Success", nil, nil, []string{"bind", "drop 1000:1000", "start"}, ""},
+		{"BindFailure", fmt.Errorf("permission denied"), nil, []string{"bind"}, "bind listener of operator 'tcp_input': permission denied"},
+		{"DropFailure", nil, fmt.Errorf("operation not permitted"), []string{"bind", "drop 1000:1000"}, "drop privileges to user 'stanza'"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			agent, _ := newPrivilegeTestAgent(&calls, tc.bindErr, tc.dropErr)
+
+			err := agent.Start()
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expected, calls)
+		})
+	}
+}
+
+func TestNewPrivilegeDrop(t *testing.T) {
+	privileges, err := newPrivilegeDrop("", "")
+	require.NoError(t, err)
+	require.Nil(t, privileges)
+
+	if runtime.GOOS != "linux" {
+		_, err := newPrivilegeDrop("root", "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not supported")
+		return
+	}
+
+	privileges, err = newPrivilegeDrop("root", "")
+	require.NoError(t, err)
+	require.Equal(t, 0, privileges.uid)
+	require.Equal(t, 0, privileges.gid)
+
+	privileges, err = newPrivilegeDrop("0", "0")
+	require.NoError(t, err)
+	require.Equal(t, 0, privileges.uid)
+	require.Equal(t, 0, privileges.gid)
+
+	privileges, err = newPrivilegeDrop("", "root")
+	require.NoError(t, err)
+	require.Equal(t, -1, privileges.uid)
+	require.Equal(t, 0, privileges.gid)
+
+	_, err = newPrivilegeDrop("stanza-missing-user", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "look up user 'stanza-missing-user'")
+
+	_, err = newPrivilegeDrop("root", "stanza-missing-group")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "look up group 'stanza-missing-group'")
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	_ "github.com/observiq/stanza/operator/builtin/input/file"
+	_ "github.com/observiq/stanza/operator/builtin/output/file"
+	_ "github.com/observiq/stanza/operator/builtin/parser/regex"
+	_ "github.com/observiq/stanza/operator/builtin/transformer/metadata"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// reloadConfig is a pipeline that reads a file into another file. The label
+// operator is only in the config when label is not empty.
+func reloadConfig(tempDir, label string) string {
+	config := fmt.Sprintf(`
+pipeline:
+  - id: file_input
+    type: file_input
+    include: [%s]
+    start_at: beginning
+    poll_interval: 10ms
+`, filepath.Join(tempDir, "in.log"))
+
+	if label != "" {
+		config += fmt.Sprintf(`
+  - id: label
+    type: metadata
+    labels:
+      config: %s
+`, label)
+	}
+
+	return config + fmt.Sprintf(`
+  - id: file_output
+    type: file_output
+    path: %s
+`, filepath.Join(tempDir, "out.log"))
+}
+
+// readOutput returns the entries written to the output file
+func readOutput(t *testing.T, tempDir string) []*entry.Entry {
+	file, err := os.Open(filepath.Join(tempDir, "out.log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries := []*entry.Entry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		e := &entry.Entry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), e))
+		entries = append(entries, e)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+// waitForOutput waits until the output file holds a number of entries
+func waitForOutput(t *testing.T, tempDir string, expected int) []*entry.Entry {
+	var entries []*entry.Entry
+	require.Eventually(t, func() bool {
+		entries = readOutput(t, tempDir)
+		return len(entries) >= expected
+	}, 10*time.Second, 10*time.Millisecond)
+	return entries
+}
+
+func TestReloadAgent(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(reloadConfig(tempDir, "")), 0600))
+
+	agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+		WithConfigFiles([]string{configFile}).
+		WithDatabaseFile(filepath.Join(tempDir, "stanza.db")).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, agent.Start())
+	defer agent.Stop()
+
+	input, err := os.OpenFile(filepath.Join(tempDir, "in.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	defer input.Close()
+
+	// Lines are written while the agent is reloaded several times
+	const lineCount = 300
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < lineCount; i++ {
+			fmt.Fprintf(input, "line %d\n", i)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	for i := 2; i <= 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(reloadConfig(tempDir, fmt.Sprint(i))), 0600))
+		require.NoError(t, agent.Reload())
+	}
+	<-written
+
+	// Each line is written to the output once, and the last entries are
+	// labeled by the last config
+	waitForOutput(t, tempDir, lineCount)
+	require.NoError(t, agent.Stop())
+	entries := readOutput(t, tempDir)
+	require.Len(t, entries, lineCount)
+	for i, e := range entries {
+		require.Equal(t, fmt.Sprintf("line %d", i), e.Record)
+	}
+	require.Equal(t, "4", entries[lineCount-1].Labels["config"])
+}
+
+func TestReloadAgentFailure(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			"InvalidYAML",
+			"pipeline: [",
+			"read configs from globs",
+		},
+		{
+			"BuildFailure",
+			`
+pipeline:
+  - type: regex_parser
+`,
+			"missing required field 'regex'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testutil.NewTempDir(t)
+			configFile := filepath.Join(tempDir, "config.yaml")
+			require.NoError(t, ioutil.WriteFile(configFile, []byte(reloadConfig(tempDir, "1")), 0600))
+
+			agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+				WithConfigFiles([]string{configFile}).
+				WithDatabaseFile(filepath.Join(tempDir, "stanza.db")).
+				Build()
+			require.NoError(t, err)
+			require.NoError(t, agent.Start())
+			defer agent.Stop()
+
+			inputPath := filepath.Join(tempDir, "in.log")
+			require.NoError(t, ioutil.WriteFile(inputPath, []byte("line 0\n"), 0600))
+			waitForOutput(t, tempDir, 1)
+
+			require.NoError(t, ioutil.WriteFile(configFile, []byte(tc.config), 0600))
+			err = agent.Reload()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expected)
+
+			// The agent keeps running with the previous config
+			input, err := os.OpenFile(inputPath, os.O_WRONLY|os.O_APPEND, 0600)
+			require.NoError(t, err)
+			defer input.Close()
+			fmt.Fprintln(input, "line 1")
+
+			entries := waitForOutput(t, tempDir, 2)
+			require.Len(t, entries, 2)
+			require.Equal(t, "line 1", entries[1].Record)
+			require.Equal(t, "1", entries[1].Labels["config"])
+		})
+	}
+}
+
+func TestReloadAgentWithoutConfigFiles(t *testing.T) {
+	agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+		WithConfig(&Config{}).
+		WithDefaultOutput(testutil.NewFakeOutput(t)).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, agent.Start())
+	defer agent.Stop()
+
+	err = agent.Reload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "agent cannot be reloaded without config files")
+}
+
+func TestReloadStoppedAgent(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(reloadConfig(tempDir, "")), 0600))
+
+	agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+		WithConfigFiles([]string{configFile}).
+		Build()
+	require.NoError(t, err)
+
+	err = agent.Reload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "agent can only be reloaded while it is running")
+
+	require.NoError(t, agent.Start())
+	require.NoError(t, agent.Stop())
+	err = agent.Reload()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "agent can only be reloaded while it is running")
+}
@@ -0,0 +1,407 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRemotePollInterval is the interval at which the remote config is
+	// fetched if none is set
+	defaultRemotePollInterval = time.Minute
+
+	// defaultRemoteTimeout is the timeout of fetching the remote config and
+	// its signature if none is set
+	defaultRemoteTimeout = 10 * time.Second
+
+	// maxRemoteBundleSize is the largest remote config that is read
+	maxRemoteBundleSize = 16 << 20
+)
+
+// RemoteConfig is the configuration of an HTTPS endpoint that the agent polls
+// for its config. The config fetched from the endpoint, called a bundle, is
+// only applied once its detached ed25519 signature is verified with the
+// public key.
+type RemoteConfig struct {
+	// URL is the address of the bundle
+	URL string `json:"url" yaml:"url"`
+
+	// SignatureURL is the address of the signature of the bundle, which is
+	// the URL of the bundle with a .sig suffix if it is not set
+	SignatureURL string `json:"signature_url,omitempty" yaml:"signature_url,omitempty"`
+
+	// PublicKeyFile is a PEM file with the ed25519 public key that the
+	// signatures are verified with
+	PublicKeyFile string `json:"public_key_file" yaml:"public_key_file"`
+
+	PollInterval helper.Duration   `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty"`
+	Timeout      helper.Duration   `json:"timeout,omitempty"       yaml:"timeout,omitempty"`
+	TLS          *helper.TLSConfig `json:"tls,omitempty"           yaml:"tls,omitempty"`
+}
+
+// RemoteConfigStatus is the state of the remote config of the agent, as
+// reported on the `/status` path
+type RemoteConfigStatus struct {
+	URL         string     `json:"url"`
+	AppliedHash string     `json:"applied_hash,omitempty"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	LastPoll    *time.Time `json:"last_poll,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// remotePoller polls the endpoint of a remote config, and applies each bundle
+// that changed once it is verified and validated. A bundle that cannot be
+// fetched, verified or applied leaves the running config in place, and is
+// reported as a health warning until a poll succeeds.
+type remotePoller struct {
+	config       RemoteConfig
+	signatureURL string
+	publicKey    ed25519.PublicKey
+	client       *http.Client
+	interval     time.Duration
+	apply        func(*Config) error
+
+	mux    sync.Mutex
+	etag   string
+	status RemoteConfigStatus
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	*zap.SugaredLogger
+}
+
+// newRemotePoller creates a poller of a remote config. The public key and
+// TLS files are loaded here, so that their errors fail the build of the agent.
+func newRemotePoller(config RemoteConfig, apply func(*Config) error, logger *zap.SugaredLogger) (*remotePoller, error) {
+	if config.URL == "" {
+		return nil, errors.NewError("remote_config requires a url", "set the url of the remote config")
+	}
+	if config.PublicKeyFile == "" {
+		return nil, errors.NewError(
+			"remote_config requires a public_key_file",
+			"set the path of the PEM file with the public key that signs the remote config",
+		)
+	}
+
+	publicKey, err := loadPublicKey(config.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureURL := config.SignatureURL
+	if signatureURL == "" {
+		signatureURL = config.URL + ".sig"
+	}
+
+	interval := config.PollInterval.Raw()
+	if interval <= 0 {
+		interval = defaultRemotePollInterval
+	}
+
+	timeout := config.Timeout.Raw()
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+	if config.TLS != nil {
+		tlsConfig, err := config.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "load remote_config tls")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+
+	return &remotePoller{
+		config:        config,
+		signatureURL:  signatureURL,
+		publicKey:     publicKey,
+		client:        client,
+		interval:      interval,
+		apply:         apply,
+		status:        RemoteConfigStatus{URL: config.URL},
+		SugaredLogger: logger.With("component", "remote_config"),
+	}, nil
+}
+
+// loadPublicKey loads an ed25519 public key from a PEM file
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read remote_config public_key_file")
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.NewError(
+			fmt.Sprintf("remote_config public_key_file %s is not PEM encoded", path),
+			"use a PEM file with a PUBLIC KEY block",
+		)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse remote_config public_key_file %s", path))
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.NewError(
+			fmt.Sprintf("remote_config public_key_file %s is not an ed25519 key", path),
+			"sign the remote config with an ed25519 key",
+		)
+	}
+	return publicKey, nil
+}
+
+// start polls the remote config at each interval, starting immediately,
+// until the poller is stopped
+func (p *remotePoller) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.mux.Lock()
+	p.cancel, p.done = cancel, done
+	p.mux.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.poll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop stops polling, and waits for a poll in progress to complete. It does
+// nothing if the poller was not started.
+func (p *remotePoller) stop() {
+	p.mux.Lock()
+	cancel, done := p.cancel, p.done
+	p.mux.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// reset forgets the bundle that was applied, so the next poll applies the
+// bundle again even if it did not change
+func (p *remotePoller) reset() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.etag = ""
+	p.status.AppliedHash = ""
+	p.status.AppliedAt = nil
+}
+
+// poll fetches the remote config, and applies it if it changed
+func (p *remotePoller) poll(ctx context.Context) {
+	err := p.update(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	p.mux.Lock()
+	p.status.LastPoll = &now
+	previous := p.status.Error
+	if err != nil {
+		p.status.Error = err.Error()
+	} else {
+		p.status.Error = ""
+	}
+	p.mux.Unlock()
+
+	switch {
+	case err != nil:
+		p.Warnw("Failed to update remote config. Keeping the current config", zap.Any("error", err))
+	case previous != "":
+		p.Infow("Remote config is updating again")
+	}
+}
+
+// update fetches the bundle, and verifies, validates and applies it if its
+// hash differs from the bundle that was applied last
+func (p *remotePoller) update(ctx context.Context) error {
+	p.mux.Lock()
+	etag, applied := p.etag, p.status.AppliedHash
+	p.mux.Unlock()
+
+	bundle, newETag, err := p.fetch(ctx, p.config.URL, etag)
+	if err != nil {
+		return errors.Wrap(err, "fetch remote config")
+	}
+	if bundle == nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(bundle)
+	hash := hex.EncodeToString(sum[:])
+	if hash == applied {
+		p.mux.Lock()
+		p.etag = newETag
+		p.mux.Unlock()
+		return nil
+	}
+
+	signature, _, err := p.fetch(ctx, p.signatureURL, "")
+	if err != nil {
+		return errors.Wrap(err, "fetch remote config signature")
+	}
+	if err := p.verify(bundle, signature); err != nil {
+		return errors.WithDetails(err, "hash", hash)
+	}
+
+	config, err := newConfigFromBytes(bundle, p.config.URL)
+	if err != nil {
+		return errors.WithDetails(errors.Wrap(err, "read remote config"), "hash", hash)
+	}
+	if config.RemoteConfig != nil {
+		return errors.NewError(
+			"remote config cannot set remote_config",
+			"set remote_config in the local config files",
+			"hash", hash,
+		)
+	}
+	config.RemoteConfig = &p.config
+
+	if err := p.apply(config); err != nil {
+		return errors.WithDetails(errors.Wrap(err, "apply remote config"), "hash", hash)
+	}
+
+	now := time.Now()
+	p.mux.Lock()
+	p.etag = newETag
+	p.status.AppliedHash = hash
+	p.status.AppliedAt = &now
+	p.mux.Unlock()
+
+	p.Infow("Applied remote config", "hash", hash)
+	return nil
+}
+
+// fetch gets the body of a URL. If the server responds that the body has not
+// changed since the ETag, a nil body is returned.
+func (p *remotePoller) fetch(ctx context.Context, url, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req = req.WithContext(ctx)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && etag != "":
+		return nil, etag, nil
+	case res.StatusCode != http.StatusOK:
+		return nil, "", errors.NewError(
+			fmt.Sprintf("server responded with %s", res.Status),
+			"check that the url is correct and that the server is available",
+			"url", url,
+		)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxRemoteBundleSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > maxRemoteBundleSize {
+		return nil, "", errors.NewError(
+			fmt.Sprintf("response is larger than %d bytes", maxRemoteBundleSize),
+			"",
+			"url", url,
+		)
+	}
+	return body, res.Header.Get("ETag"), nil
+}
+
+// verify checks the detached signature of a bundle, given either as raw bytes
+// or encoded as base64
+func (p *remotePoller) verify(bundle, signature []byte) error {
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return errors.Wrap(err, "decode remote config signature")
+		}
+		signature = decoded
+	}
+
+	if !ed25519.Verify(p.publicKey, bundle, signature) {
+		return errors.NewError(
+			"remote config signature is invalid",
+			"check that the remote config is signed with the private key of public_key_file",
+		)
+	}
+	return nil
+}
+
+// currentStatus returns the state of the remote config
+func (p *remotePoller) currentStatus() *RemoteConfigStatus {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	status := p.status
+	return &status
+}
+
+// warning returns the error of the last poll, if it failed
+func (p *remotePoller) warning() string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.status.Error == "" {
+		return ""
+	}
+	return "remote config: " + p.status.Error
+}
+
+// applyRemoteConfig replaces the running pipeline with the pipeline of a
+// remote config. A config that does not build leaves the running pipeline
+// untouched.
+func (a *LogAgent) applyRemoteConfig(config *Config) error {
+	a.reloadMux.Lock()
+	defer a.reloadMux.Unlock()
+
+	if a.started.IsZero() || a.stopped {
+		return errors.NewError("agent can only be reloaded while it is running", "")
+	}
+
+	if err := a.builder.checkDeprecations(config); err != nil {
+		return err
+	}
+	return a.replacePipeline(config)
+}
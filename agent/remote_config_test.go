@@ -0,0 +1,396 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// remoteServer serves a bundle and its signature, with the hash of the
+// bundle as its ETag
+type remoteServer struct {
+	*httptest.Server
+
+	mux       sync.Mutex
+	bundle    []byte
+	signature []byte
+	requests  int
+	notMod    int
+}
+
+// newRemoteServer starts a server of a bundle signed with a private key
+func newRemoteServer(t *testing.T, bundle string, key ed25519.PrivateKey) *remoteServer {
+	s := &remoteServer{}
+	s.set(bundle, key)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		switch r.URL.Path {
+		case "/stanza.yaml":
+			s.requests++
+			sum := sha256.Sum256(s.bundle)
+			etag := fmt.Sprintf(`"%x"`, sum)
+			if r.Header.Get("If-None-Match") == etag {
+				s.notMod++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write(s.bundle)
+		case "/stanza.yaml.sig":
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(s.signature)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// set replaces the bundle and its signature
+func (s *remoteServer) set(bundle string, key ed25519.PrivateKey) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.bundle = []byte(bundle)
+	s.signature = ed25519.Sign(key, s.bundle)
+}
+
+// counts returns the number of requests for the bundle, and the number of
+// them that were not modified
+func (s *remoteServer) counts() (int, int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.requests, s.notMod
+}
+
+// writePublicKey writes a public key to a PEM file in a directory
+func writePublicKey(t *testing.T, dir string, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "remote.pub")
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+	return path
+}
+
+// bundleHash returns the hash that a bundle is reported with
+func bundleHash(bundle string) string {
+	sum := sha256.Sum256([]byte(bundle))
+	return hex.EncodeToString(sum[:])
+}
+
+// startRemoteAgent starts an agent with the local config and a remote config
+// served by a server
+func startRemoteAgent(t *testing.T, tempDir, url, publicKeyFile string) *LogAgent {
+	config := reloadConfig(tempDir, "local") + fmt.Sprintf(`
+remote_config:
+  url: %s/stanza.yaml
+  public_key_file: %s
+  poll_interval: 10ms
+`, url, publicKeyFile)
+
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(config), 0600))
+
+	agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+		WithConfigFiles([]string{configFile}).
+		WithDatabaseFile(filepath.Join(tempDir, "stanza.db")).
+		Build()
+	require.NoError(t, err)
+	require.NoError(t, agent.Start())
+	t.Cleanup(func() { _ = agent.Stop() })
+	return agent
+}
+
+// appendLine appends a line to the input file of the reload config
+func appendLine(t *testing.T, tempDir, line string) {
+	input, err := os.OpenFile(filepath.Join(tempDir, "in.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	defer input.Close()
+	fmt.Fprintln(input, line)
+}
+
+func TestRemoteConfig(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	bundle := reloadConfig(tempDir, "remote")
+	server := newRemoteServer(t, bundle, privateKey)
+	agent := startRemoteAgent(t, tempDir, server.URL, writePublicKey(t, tempDir, publicKey))
+
+	require.Eventually(t, func() bool {
+		return agent.Status().RemoteConfig.AppliedHash == bundleHash(bundle)
+	}, 10*time.Second, 10*time.Millisecond)
+
+	appendLine(t, tempDir, "line 0")
+	entries := waitForOutput(t, tempDir, 1)
+	require.Equal(t, "remote", entries[0].Labels["config"])
+
+	// The unchanged bundle is not fetched again
+	require.Eventually(t, func() bool {
+		_, notModified := server.counts()
+		return notModified > 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// A changed bundle replaces the remote config
+	changed := reloadConfig(tempDir, "changed")
+	server.set(changed, privateKey)
+	require.Eventually(t, func() bool {
+		return agent.Status().RemoteConfig.AppliedHash == bundleHash(changed)
+	}, 10*time.Second, 10*time.Millisecond)
+
+	appendLine(t, tempDir, "line 1")
+	entries = waitForOutput(t, tempDir, 2)
+	require.Equal(t, "line 1", entries[1].Record)
+	require.Equal(t, "changed", entries[1].Labels["config"])
+	require.Empty(t, agent.Health().Warnings)
+}
+
+func TestRemoteConfigFailure(t *testing.T) {
+	cases := []struct {
+		name     string
+		bundle   func(tempDir string) string
+		signer   func(t *testing.T, key ed25519.PrivateKey) ed25519.PrivateKey
+		expected string
+	}{
+		{
+			"InvalidSignature",
+			func(tempDir string) string { return reloadConfig(tempDir, "remote") },
+			func(t *testing.T, _ ed25519.PrivateKey) ed25519.PrivateKey {
+				_, other, err := ed25519.GenerateKey(rand.Reader)
+				require.NoError(t, err)
+				return other
+			},
+			"remote config signature is invalid",
+		},
+		{
+			"InvalidYAML",
+			func(string) string { return "pipeline: [" },
+			func(_ *testing.T, key ed25519.PrivateKey) ed25519.PrivateKey { return key },
+			"read remote config",
+		},
+		{
+			"BuildFailure",
+			func(string) string { return "pipeline:\n  - type: regex_parser\n" },
+			func(_ *testing.T, key ed25519.PrivateKey) ed25519.PrivateKey { return key },
+			"apply remote config",
+		},
+		{
+			"NestedRemoteConfig",
+			func(tempDir string) string {
+				return reloadConfig(tempDir, "remote") + "remote_config:\n  url: https://example.com\n"
+			},
+			func(_ *testing.T, key ed25519.PrivateKey) ed25519.PrivateKey { return key },
+			"remote config cannot set remote_config",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := testutil.NewTempDir(t)
+			publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			require.NoError(t, err)
+
+			server := newRemoteServer(t, tc.bundle(tempDir), tc.signer(t, privateKey))
+			agent := startRemoteAgent(t, tempDir, server.URL, writePublicKey(t, tempDir, publicKey))
+
+			var health *Health
+			require.Eventually(t, func() bool {
+				health = agent.Health()
+				return len(health.Warnings) > 0
+			}, 10*time.Second, 10*time.Millisecond)
+			require.True(t, health.Healthy)
+			require.Contains(t, health.Warnings[0], tc.expected)
+
+			status := agent.Status().RemoteConfig
+			require.Empty(t, status.AppliedHash)
+			require.Contains(t, status.Error, tc.expected)
+
+			// The agent keeps running with the local config
+			appendLine(t, tempDir, "line 0")
+			entries := waitForOutput(t, tempDir, 1)
+			require.Equal(t, "local", entries[0].Labels["config"])
+		})
+	}
+}
+
+func TestRemoteConfigUnavailable(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	agent := startRemoteAgent(t, tempDir, server.URL, writePublicKey(t, tempDir, publicKey))
+	require.Eventually(t, func() bool {
+		return len(agent.Health().Warnings) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Contains(t, agent.Health().Warnings[0], "server responded with 503")
+	require.True(t, agent.Health().Healthy)
+}
+
+func TestRemoteConfigReload(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	bundle := reloadConfig(tempDir, "remote")
+	server := newRemoteServer(t, bundle, privateKey)
+	agent := startRemoteAgent(t, tempDir, server.URL, writePublicKey(t, tempDir, publicKey))
+	require.Eventually(t, func() bool {
+		return agent.Status().RemoteConfig.AppliedHash == bundleHash(bundle)
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// The remote config is applied again after the local files are reloaded
+	require.NoError(t, agent.Reload())
+	require.Eventually(t, func() bool {
+		return agent.Status().RemoteConfig.AppliedHash == bundleHash(bundle)
+	}, 10*time.Second, 10*time.Millisecond)
+
+	appendLine(t, tempDir, "line 0")
+	entries := waitForOutput(t, tempDir, 1)
+	require.Equal(t, "remote", entries[0].Labels["config"])
+}
+
+func TestRemotePollerETag(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	server := newRemoteServer(t, reloadConfig(tempDir, "remote"), privateKey)
+
+	applied := 0
+	apply := func(*Config) error {
+		applied++
+		return nil
+	}
+	config := RemoteConfig{URL: server.URL + "/stanza.yaml", PublicKeyFile: writePublicKey(t, tempDir, publicKey)}
+	poller, err := newRemotePoller(config, apply, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+
+	require.NoError(t, poller.update(context.Background()))
+	require.NoError(t, poller.update(context.Background()))
+	require.Equal(t, 1, applied)
+	requests, notModified := server.counts()
+	require.Equal(t, 2, requests)
+	require.Equal(t, 1, notModified)
+
+	// A reset applies the bundle again
+	poller.reset()
+	require.NoError(t, poller.update(context.Background()))
+	require.Equal(t, 2, applied)
+}
+
+func TestRemotePollerRawSignature(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	bundle := []byte(reloadConfig(tempDir, "remote"))
+	config := RemoteConfig{URL: "https://example.com/stanza.yaml", PublicKeyFile: writePublicKey(t, tempDir, publicKey)}
+	poller, err := newRemotePoller(config, nil, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+
+	require.NoError(t, poller.verify(bundle, ed25519.Sign(privateKey, bundle)))
+	require.Error(t, poller.verify(append(bundle, '\n'), ed25519.Sign(privateKey, bundle)))
+}
+
+func TestNewRemotePoller(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKeyFile := writePublicKey(t, tempDir, publicKey)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecdsaDir := filepath.Join(tempDir, "ecdsa")
+	require.NoError(t, os.Mkdir(ecdsaDir, 0700))
+	ecdsaKeyFile := writePublicKey(t, ecdsaDir, &ecdsaKey.PublicKey)
+
+	notPEM := filepath.Join(tempDir, "not.pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("not a key"), 0600))
+
+	cases := []struct {
+		name     string
+		config   RemoteConfig
+		expected string
+	}{
+		{
+			"Default",
+			RemoteConfig{URL: "https://example.com/stanza.yaml", PublicKeyFile: publicKeyFile},
+			"",
+		},
+		{
+			"MissingURL",
+			RemoteConfig{PublicKeyFile: publicKeyFile},
+			"remote_config requires a url",
+		},
+		{
+			"MissingPublicKey",
+			RemoteConfig{URL: "https://example.com/stanza.yaml"},
+			"remote_config requires a public_key_file",
+		},
+		{
+			"MissingPublicKeyFile",
+			RemoteConfig{URL: "https://example.com/stanza.yaml", PublicKeyFile: filepath.Join(tempDir, "missing.pub")},
+			"read remote_config public_key_file",
+		},
+		{
+			"NotPEM",
+			RemoteConfig{URL: "https://example.com/stanza.yaml", PublicKeyFile: notPEM},
+			"is not PEM encoded",
+		},
+		{
+			"NotEd25519",
+			RemoteConfig{URL: "https://example.com/stanza.yaml", PublicKeyFile: ecdsaKeyFile},
+			"is not an ed25519 key",
+		},
+		{
+			"InvalidTLS",
+			RemoteConfig{
+				URL:           "https://example.com/stanza.yaml",
+				PublicKeyFile: publicKeyFile,
+				TLS:           &helper.TLSConfig{CAFile: filepath.Join(tempDir, "missing.pem")},
+			},
+			"load remote_config tls",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			poller, err := newRemotePoller(tc.config, nil, zaptest.NewLogger(t).Sugar())
+			if tc.expected != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expected)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "https://example.com/stanza.yaml.sig", poller.signatureURL)
+			require.Equal(t, defaultRemotePollInterval, poller.interval)
+		})
+	}
+}
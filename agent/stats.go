@@ -0,0 +1,248 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// StatsBucket is the database bucket that holds snapshots of operator stats,
+// keyed by the time of the snapshot
+var StatsBucket = []byte("stats")
+
+// StatsSnapshot is a snapshot of the counters of each operator in the
+// pipeline. Counters start at zero when the agent starts or is reloaded,
+// which is the time in Started. Operators with
+// counters of their own, such as routers, also have them in Counters, and the
+// counters of each throttle are in Throttles. Outputs that are parked for
+// maintenance are in Maintenance, and the depth of the buffer of each output
+// that has one is in Buffers.
+type StatsSnapshot struct {
+	Timestamp   time.Time                           `json:"timestamp"`
+	Started     time.Time                           `json:"started"`
+	Operators   map[string]helper.OperatorStats     `json:"operators"`
+	Counters    map[string]map[string]uint64        `json:"counters,omitempty"`
+	Throttles   map[string]map[string]uint64        `json:"throttles,omitempty"`
+	Maintenance map[string]helper.MaintenanceStatus `json:"maintenance,omitempty"`
+	Buffers     map[string]buffer.Stats             `json:"buffers,omitempty"`
+}
+
+// Stats returns a snapshot of the counters of each operator in the pipeline
+func (a *LogAgent) Stats() *StatsSnapshot {
+	a.mux.RLock()
+	pipeline, throttles, started := a.pipeline, a.throttles, a.started
+	a.mux.RUnlock()
+
+	snapshot := &StatsSnapshot{
+		Timestamp: time.Now(),
+		Started:   started,
+		Operators: make(map[string]helper.OperatorStats),
+	}
+
+	if counters := throttles.Counters(); len(counters) > 0 {
+		snapshot.Throttles = counters
+	}
+	if maintenance := parkedOutputs(pipeline); len(maintenance) > 0 {
+		snapshot.Maintenance = maintenance
+	}
+	if buffers := bufferDepths(pipeline); len(buffers) > 0 {
+		snapshot.Buffers = buffers
+	}
+	for _, op := range pipeline.Operators() {
+		if reporter, ok := op.(helper.CounterReporter); ok {
+			if counters := reporter.Counters(); len(counters) > 0 {
+				if snapshot.Counters == nil {
+					snapshot.Counters = make(map[string]map[string]uint64)
+				}
+				snapshot.Counters[op.ID()] = counters
+			}
+		}
+
+		reporter, ok := op.(helper.StatsReporter)
+		if !ok {
+			continue
+		}
+		if stats := reporter.OperatorStats(); stats != nil {
+			snapshot.Operators[op.ID()] = stats.Snapshot()
+		}
+	}
+	return snapshot
+}
+
+// bufferDepths returns the depth of the buffer of each output that reports
+// one in its status
+func bufferDepths(p pipeline.Pipeline) map[string]buffer.Stats {
+	depths := make(map[string]buffer.Stats)
+	for _, op := range p.Operators() {
+		statuser, ok := op.(operator.Statuser)
+		if !ok {
+			continue
+		}
+		if stats, ok := statuser.Status()["buffer"].(*buffer.Stats); ok {
+			depths[op.ID()] = *stats
+		}
+	}
+	return depths
+}
+
+// persistStats saves a snapshot of the operator stats at each interval, and
+// logs the depth of each buffer, until the context is cancelled
+func (a *LogAgent) persistStats(ctx context.Context) {
+	ticker := time.NewTicker(a.statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshot := a.saveStats()
+			a.logBufferDepths(snapshot.Buffers)
+		}
+	}
+}
+
+// saveStats saves a snapshot of the operator stats and removes snapshots that
+// are older than the retention period. It returns the snapshot.
+func (a *LogAgent) saveStats() *StatsSnapshot {
+	snapshot := a.Stats()
+	if err := SaveStatsSnapshot(a.database, snapshot, a.statsRetention); err != nil {
+		a.Warnw("Failed to save operator stats", zap.Error(err))
+	}
+	return snapshot
+}
+
+// logBufferDepths logs the depth of the buffer of each output, so that a
+// buffer that fills up because its output is slow shows in the logs before
+// entries are blocked
+func (a *LogAgent) logBufferDepths(buffers map[string]buffer.Stats) {
+	ids := make([]string, 0, len(buffers))
+	for id := range buffers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		stats := buffers[id]
+		fields := []interface{}{
+			"operator_id", id,
+			"type", stats.Type,
+			"entries", stats.Entries,
+		}
+		if stats.Type == "disk" {
+			fields = append(fields, "bytes", stats.Bytes, "file_bytes", stats.FileBytes, "max_bytes", stats.MaxBytes)
+		} else {
+			fields = append(fields, "max_entries", stats.MaxEntries)
+		}
+		fields = append(fields, "added", stats.Added, "flushed", stats.Flushed, "dropped", stats.Dropped)
+		a.Infow("Buffer depth", fields...)
+	}
+}
+
+// SaveStatsSnapshot saves a snapshot to the database, removing snapshots that
+// are older than the retention period
+func SaveStatsSnapshot(db database.Database, snapshot *StatsSnapshot, retention time.Duration) error {
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(StatsBucket)
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put(statsKey(snapshot.Timestamp), encoded); err != nil {
+			return err
+		}
+
+		if retention <= 0 {
+			return nil
+		}
+
+		// Keys sort by time, so expired snapshots are at the start of the bucket
+		cutoff := statsKey(snapshot.Timestamp.Add(-retention))
+		expired := make([][]byte, 0)
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, cutoff) < 0; key, _ = cursor.Next() {
+			expired = append(expired, key)
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReadStatsSnapshots reads the saved snapshots taken at or after a time,
+// oldest first
+func ReadStatsSnapshots(db database.Database, since time.Time) ([]*StatsSnapshot, error) {
+	snapshots := make([]*StatsSnapshot, 0)
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(StatsBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for key, value := cursor.Seek(statsKey(since)); key != nil; key, value = cursor.Next() {
+			snapshot := &StatsSnapshot{}
+			if err := json.Unmarshal(value, snapshot); err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// SummarizeStats returns the counters accumulated by each operator over a
+// series of snapshots, oldest first. Counters are reset when the agent
+// restarts, so each run of the agent is summarized separately and the results
+// are added together. A run that started at or after the given time is counted
+// from zero, while a run that started earlier is counted from its first snapshot.
+func SummarizeStats(snapshots []*StatsSnapshot, since time.Time) map[string]helper.OperatorStats {
+	summary := make(map[string]helper.OperatorStats)
+	for i := 0; i < len(snapshots); {
+		first := snapshots[i]
+		last := first
+		for i++; i < len(snapshots) && snapshots[i].Started.Equal(first.Started); i++ {
+			last = snapshots[i]
+		}
+
+		for id, stats := range last.Operators {
+			if first.Started.Before(since) {
+				stats = stats.Sub(first.Operators[id])
+			}
+			total := summary[id]
+			total.Add(stats)
+			summary[id] = total
+		}
+	}
+	return summary
+}
+
+// statsKey returns the database key of a snapshot taken at a time. Times
+// before the Unix epoch, including the zero time, share the lowest key.
+func statsKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	if t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	return key
+}
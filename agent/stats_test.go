@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type countingOperator struct {
+	*testutil.Operator
+	stats *helper.OperatorStats
+}
+
+func (o countingOperator) OperatorStats() *helper.OperatorStats {
+	return o.stats
+}
+
+func newCountingOperator(id string, stats *helper.OperatorStats) countingOperator {
+	op := countingOperator{
+		Operator: &testutil.Operator{},
+		stats:    stats,
+	}
+	op.On("ID").Return(id)
+	return op
+}
+
+type routingOperator struct {
+	countingOperator
+}
+
+func (o routingOperator) Counters() map[string]uint64 {
+	return map[string]uint64{"json": 7, "default": 3}
+}
+
+type bufferedOperator struct {
+	countingOperator
+}
+
+func (o bufferedOperator) Status() map[string]interface{} {
+	return map[string]interface{}{
+		"buffer": &buffer.Stats{Type: "memory", Entries: 2, MaxEntries: 10, Added: 5, Flushed: 3},
+	}
+}
+
+func newStatsAgent(t *testing.T) *LogAgent {
+	operators := []operator.Operator{
+		newCountingOperator("$.input", &helper.OperatorStats{EntriesOut: 10, Bytes: 1000}),
+		newCountingOperator("$.output", &helper.OperatorStats{EntriesIn: 10, Errored: 1}),
+		newCountingOperator("$.uncounted", nil),
+		routingOperator{newCountingOperator("$.router", &helper.OperatorStats{EntriesOut: 10})},
+		bufferedOperator{newCountingOperator("$.buffered", nil)},
+		testutil.NewMockOperator("$.mock"),
+	}
+
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Start").Return(nil)
+	pipeline.On("Stop").Return(nil)
+	pipeline.On("Operators").Return(operators)
+
+	return &LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		database:      testutil.NewTestDatabase(t),
+	}
+}
+
+func TestAgentStats(t *testing.T) {
+	agent := newStatsAgent(t)
+	require.NoError(t, agent.Start())
+
+	snapshot := agent.Stats()
+	require.Equal(t, agent.started, snapshot.Started)
+	require.Equal(t, map[string]helper.OperatorStats{
+		"$.input":  {EntriesOut: 10, Bytes: 1000},
+		"$.output": {EntriesIn: 10, Errored: 1},
+		"$.router": {EntriesOut: 10},
+	}, snapshot.Operators)
+	require.Equal(t, map[string]map[string]uint64{
+		"$.router": {"json": 7, "default": 3},
+	}, snapshot.Counters)
+	require.Equal(t, map[string]buffer.Stats{
+		"$.buffered": {Type: "memory", Entries: 2, MaxEntries: 10, Added: 5, Flushed: 3},
+	}, snapshot.Buffers)
+}
+
+func TestLogBufferDepths(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	agent := &LogAgent{SugaredLogger: zap.New(core).Sugar()}
+
+	agent.logBufferDepths(map[string]buffer.Stats{
+		"$.memory": {Type: "memory", Entries: 2, MaxEntries: 10, Added: 5, Flushed: 3},
+		"$.disk":   {Type: "disk", Entries: 1, MaxBytes: 1000, Bytes: 100, FileBytes: 400, Added: 4, Flushed: 3},
+	})
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	require.Equal(t, "Buffer depth", entries[0].Message)
+	disk := entries[0].ContextMap()
+	require.Equal(t, "$.disk", disk["operator_id"])
+	require.Equal(t, int64(400), disk["file_bytes"])
+	require.NotContains(t, disk, "max_entries")
+	memory := entries[1].ContextMap()
+	require.Equal(t, "$.memory", memory["operator_id"])
+	require.Equal(t, int64(10), memory["max_entries"])
+	require.Equal(t, uint64(3), memory["flushed"])
+}
+
+func TestAgentSavesStatsOnStop(t *testing.T) {
+	agent := newStatsAgent(t)
+	agent.statsInterval = time.Hour
+	require.NoError(t, agent.Start())
+
+	path := agent.database.(*bbolt.DB).Path()
+	require.NoError(t, agent.Stop())
+
+	db, err := database.OpenDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	snapshots, err := ReadStatsSnapshots(db, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.Equal(t, uint64(10), snapshots[0].Operators["$.input"].EntriesOut)
+}
+
+func TestSaveStatsSnapshotRetention(t *testing.T) {
+	db := testutil.NewTestDatabase(t)
+	start := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		snapshot := &StatsSnapshot{
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Started:   start,
+			Operators: map[string]helper.OperatorStats{
+				"$.input": {EntriesOut: uint64(i)},
+			},
+		}
+		require.NoError(t, SaveStatsSnapshot(db, snapshot, 90*time.Minute))
+	}
+
+	snapshots, err := ReadStatsSnapshots(db, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	require.True(t, start.Add(2*time.Hour).Equal(snapshots[0].Timestamp))
+	require.True(t, start.Add(3*time.Hour).Equal(snapshots[1].Timestamp))
+
+	snapshots, err = ReadStatsSnapshots(db, start.Add(150*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+}
+
+func TestSummarizeStats(t *testing.T) {
+	since := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	firstRun := since.Add(-time.Hour)
+	secondRun := since.Add(2 * time.Hour)
+
+	snapshot := func(offset time.Duration, started time.Time, in uint64) *StatsSnapshot {
+		return &StatsSnapshot{
+			Timestamp: since.Add(offset),
+			Started:   started,
+			Operators: map[string]helper.OperatorStats{
+				"$.output": {EntriesIn: in},
+			},
+		}
+	}
+
+	cases := []struct {
+		name      string
+		snapshots []*StatsSnapshot
+		expected  uint64
+	}{
+		{"Empty", nil, 0},
+		{"RunStartedBefore", []*StatsSnapshot{
+			snapshot(0, firstRun, 100),
+			snapshot(time.Hour, firstRun, 150),
+		}, 50},
+		{"RunStartedWithin", []*StatsSnapshot{
+			snapshot(3*time.Hour, secondRun, 20),
+			snapshot(4*time.Hour, secondRun, 30),
+		}, 30},
+		{"Restart", []*StatsSnapshot{
+			snapshot(0, firstRun, 100),
+			snapshot(time.Hour, firstRun, 150),
+			snapshot(3*time.Hour, secondRun, 20),
+			snapshot(4*time.Hour, secondRun, 30),
+		}, 80},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			summary := SummarizeStats(tc.snapshots, since)
+			require.Equal(t, tc.expected, summary["$.output"].EntriesIn)
+		})
+	}
+}
+
+func TestHandlerStats(t *testing.T) {
+	agent := newStatsAgent(t)
+	require.NoError(t, agent.Start())
+
+	rec := httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var snapshot StatsSnapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snapshot))
+	require.Equal(t, uint64(1), snapshot.Operators["$.output"].Errored)
+
+	rec = httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/stats", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// Status is the state of the agent and of each operator in its pipeline
+type Status struct {
+	Running   bool                      `json:"running"`
+	Started   time.Time                 `json:"started"`
+	Uptime    helper.Duration           `json:"uptime"`
+	Operators []operator.OperatorStatus `json:"operators"`
+
+	// RemoteConfig is the state of the remote config, if the agent has one
+	RemoteConfig *RemoteConfigStatus `json:"remote_config,omitempty"`
+
+	// Checkpoint is the state of the checkpoints of the agent, if it exports them
+	Checkpoint *CheckpointStatus `json:"checkpoint,omitempty"`
+
+	// Recovery is the state restored by the operators when the agent started
+	Recovery *helper.RecoveryReport `json:"recovery,omitempty"`
+}
+
+// Status returns the state of the agent and of each operator in its
+// pipeline. The uptime is counted from the first start of the agent, and is
+// not reset when the agent is reloaded. It is safe to call while the agent
+// starts, stops or reloads.
+func (a *LogAgent) Status() *Status {
+	a.mux.RLock()
+	pipeline, running, upSince, recovery := a.pipeline, a.running, a.upSince, a.recovery
+	a.mux.RUnlock()
+
+	status := &Status{
+		Running:   running,
+		Started:   upSince,
+		Operators: pipeline.Status(),
+		Recovery:  recovery,
+	}
+	if running {
+		status.Uptime = helper.NewDuration(time.Since(upSince).Round(time.Second))
+	}
+	if a.remote != nil {
+		status.RemoteConfig = a.remote.currentStatus()
+	}
+	if a.checkpoints != nil {
+		status.Checkpoint = a.checkpoints.currentStatus()
+	}
+	return status
+}
+
+// setRunning records whether the pipeline of the agent is running
+func (a *LogAgent) setRunning(running bool) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if running && a.upSince.IsZero() {
+		a.upSince = time.Now()
+	}
+	a.running = running
+}
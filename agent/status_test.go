@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAgentStatus(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	configFile := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(reloadConfig(tempDir, "1")), 0600))
+
+	agent, err := NewBuilder(zaptest.NewLogger(t).Sugar()).
+		WithConfigFiles([]string{configFile}).
+		WithDatabaseFile(filepath.Join(tempDir, "stanza.db")).
+		Build()
+	require.NoError(t, err)
+
+	status := agent.Status()
+	require.False(t, status.Running)
+	require.Len(t, status.Operators, 3)
+	for _, op := range status.Operators {
+		require.False(t, op.Started)
+	}
+
+	// Status is read while the agent starts, reloads and stops
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				agent.Status()
+			}
+		}
+	}()
+
+	require.NoError(t, agent.Start())
+	status = agent.Status()
+	require.True(t, status.Running)
+	require.False(t, status.Started.IsZero())
+	require.Equal(t, []string{"$.file_input", "$.file_output", "$.label"}, statusIDs(status))
+	for _, op := range status.Operators {
+		require.True(t, op.Started, op.ID)
+	}
+
+	require.NoError(t, agent.Reload())
+	require.True(t, agent.Status().Running)
+	require.Equal(t, status.Started, agent.Status().Started)
+
+	require.NoError(t, agent.Stop())
+	close(done)
+	wg.Wait()
+
+	status = agent.Status()
+	require.False(t, status.Running)
+	for _, op := range status.Operators {
+		require.False(t, op.Started)
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	agent := newStatsAgent(t)
+	agent.pipeline.(*testutil.Pipeline).On("Status").Return(nil)
+	require.NoError(t, agent.Start())
+
+	rec := httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.True(t, status.Running)
+
+	rec = httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// statusIDs returns the IDs of the operators in a status
+func statusIDs(status *Status) []string {
+	ids := make([]string, 0, len(status.Operators))
+	for _, op := range status.Operators {
+		ids = append(ids, op.ID)
+	}
+	return ids
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// Exit codes of a run that ends by itself, such as an agent whose file
+// inputs have exit_after_backfill, or a replay. A run with several kinds of
+// failures exits with the code of the most severe.
+const (
+	ExitDelivered    = 0
+	ExitQuarantined  = 3
+	ExitDropped      = 4
+	ExitOutputFailed = 5
+)
+
+// intentionalDrops are the types of the operators that drop entries on
+// purpose, which are not counted as dropped in a run summary
+var intentionalDrops = map[string]bool{
+	"filter":     true,
+	"rate_limit": true,
+}
+
+// RunSummary counts the entries of a run that were not delivered
+type RunSummary struct {
+	// Dropped is the number of entries that operators dropped, other than
+	// the entries that filters and rate limits drop on purpose
+	Dropped uint64 `json:"dropped"`
+
+	// Quarantined is the number of entries sent to the catch operator
+	Quarantined uint64 `json:"quarantined"`
+
+	// OutputFailed is the number of sends by outputs that failed permanently,
+	// or that were not retried again
+	OutputFailed uint64 `json:"output_failed"`
+
+	ExitCode int `json:"exit_code"`
+}
+
+// SummarizeRun counts the entries that the operators of a run did not
+// deliver, and sets the exit code of the run
+func SummarizeRun(operators []operator.Operator) *RunSummary {
+	summary := &RunSummary{}
+	for _, op := range operators {
+		reporter, ok := op.(helper.StatsReporter)
+		if ok && reporter.OperatorStats() != nil {
+			stats := reporter.OperatorStats().Snapshot()
+			if _, catcher := op.(helper.Catcher); catcher {
+				summary.Quarantined += stats.EntriesIn
+			}
+			if !intentionalDrops[op.Type()] {
+				summary.Dropped += stats.Dropped
+			}
+		}
+		if counters, ok := op.(helper.CounterReporter); ok {
+			summary.OutputFailed += counters.Counters()["retry_failures"]
+		}
+	}
+
+	switch {
+	case summary.OutputFailed > 0:
+		summary.ExitCode = ExitOutputFailed
+	case summary.Dropped > 0:
+		summary.ExitCode = ExitDropped
+	case summary.Quarantined > 0:
+		summary.ExitCode = ExitQuarantined
+	default:
+		summary.ExitCode = ExitDelivered
+	}
+	return summary
+}
+
+// RunSummary summarizes the run of the agent. It is meant for an agent that
+// stopped once its operators completed, such as a backfill.
+func (a *LogAgent) RunSummary() *RunSummary {
+	a.mux.RLock()
+	pipeline := a.pipeline
+	a.mux.RUnlock()
+	return SummarizeRun(pipeline.Operators())
+}
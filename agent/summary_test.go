@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// summaryOperator is an operator with stats and counters
+type summaryOperator struct {
+	*testutil.Operator
+	stats    *helper.OperatorStats
+	counters map[string]uint64
+}
+
+func (o *summaryOperator) OperatorStats() *helper.OperatorStats { return o.stats }
+func (o *summaryOperator) Counters() map[string]uint64          { return o.counters }
+
+func newSummaryOperator(operatorType string, stats helper.OperatorStats, counters map[string]uint64) *summaryOperator {
+	op := testutil.NewMockOperator("$." + operatorType)
+	op.On("Type").Return(operatorType)
+	return &summaryOperator{Operator: op, stats: &stats, counters: counters}
+}
+
+// summaryCatcher is a catch operator with stats
+type summaryCatcher struct {
+	*summaryOperator
+}
+
+func (c *summaryCatcher) Catch(ctx context.Context, e *entry.Entry, operatorID string, err error) bool {
+	return true
+}
+
+func TestSummarizeRun(t *testing.T) {
+	cases := []struct {
+		name      string
+		operators []operator.Operator
+		expected  RunSummary
+	}{
+		{
+			"Delivered",
+			[]operator.Operator{
+				newSummaryOperator("json_parser", helper.OperatorStats{EntriesIn: 10, EntriesOut: 10}, nil),
+			},
+			RunSummary{ExitCode: ExitDelivered},
+		},
+		{
+			"IntentionalDrops",
+			[]operator.Operator{
+				newSummaryOperator("filter", helper.OperatorStats{EntriesIn: 10, Dropped: 5}, nil),
+				newSummaryOperator("rate_limit", helper.OperatorStats{EntriesIn: 5, Dropped: 1}, nil),
+			},
+			RunSummary{ExitCode: ExitDelivered},
+		},
+		{
+			"Quarantined",
+			[]operator.Operator{
+				&summaryCatcher{newSummaryOperator("catch", helper.OperatorStats{EntriesIn: 2}, nil)},
+			},
+			RunSummary{Quarantined: 2, ExitCode: ExitQuarantined},
+		},
+		{
+			"Dropped",
+			[]operator.Operator{
+				&summaryCatcher{newSummaryOperator("catch", helper.OperatorStats{EntriesIn: 2}, nil)},
+				newSummaryOperator("regex_parser", helper.OperatorStats{EntriesIn: 10, Errored: 3, Dropped: 3}, nil),
+			},
+			RunSummary{Dropped: 3, Quarantined: 2, ExitCode: ExitDropped},
+		},
+		{
+			"OutputFailed",
+			[]operator.Operator{
+				newSummaryOperator("regex_parser", helper.OperatorStats{EntriesIn: 10, Errored: 3, Dropped: 3}, nil),
+				newSummaryOperator("elastic_output", helper.OperatorStats{EntriesIn: 7}, map[string]uint64{"retries": 4, "retry_failures": 1}),
+			},
+			RunSummary{Dropped: 3, OutputFailed: 1, ExitCode: ExitOutputFailed},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, &tc.expected, SummarizeRun(tc.operators))
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// varsKey is the top level config key that holds pipeline variables.
+const varsKey = "vars"
+
+// varRefRegex matches a variable reference such as `{{ .vars.cluster }}`.
+var varRefRegex = regexp.MustCompile(`\{\{\s*\.vars\.([A-Za-z0-9_\-]+(?:\.[A-Za-z0-9_\-]+)*)\s*\}\}`)
+
+// resolveVars will replace every variable reference in the raw config with
+// the value defined in its top level `vars` section. A string that consists of
+// a single reference is replaced with the variable's value as is, which allows
+// structured values such as lists to be substituted. References that are
+// embedded within a larger string must resolve to scalar values.
+func resolveVars(contents []byte) ([]byte, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("failed to read config file as yaml: %s", err)
+	}
+
+	var vars interface{}
+	for _, item := range raw {
+		if key, ok := item.Key.(string); ok && key == varsKey {
+			vars = item.Value
+		}
+	}
+
+	r := varResolver{vars: vars}
+	for i, item := range raw {
+		key := fmt.Sprint(item.Key)
+		if key == varsKey {
+			continue
+		}
+		raw[i].Value = r.resolve(key, item.Value)
+	}
+
+	if err := r.err(); err != nil {
+		return nil, err
+	}
+
+	if !r.replaced {
+		return contents, nil
+	}
+
+	return yaml.Marshal(raw)
+}
+
+// varResolver walks a raw config and resolves variable references.
+type varResolver struct {
+	vars      interface{}
+	replaced  bool
+	undefined map[string][]string
+	invalid   []string
+}
+
+// resolve returns the value with every variable reference replaced.
+func (r *varResolver) resolve(site string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for i, item := range v {
+			v[i].Value = r.resolve(fmt.Sprintf("%s.%v", site, item.Key), item.Value)
+		}
+		return v
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = r.resolve(fmt.Sprintf("%s.%v", site, key), item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.resolve(fmt.Sprintf("%s[%d]", site, i), item)
+		}
+		return v
+	case string:
+		return r.resolveString(site, v)
+	default:
+		return value
+	}
+}
+
+// resolveString returns the string with every variable reference replaced.
+func (r *varResolver) resolveString(site, value string) interface{} {
+	matches := varRefRegex.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value
+	}
+
+	// A lone reference is substituted with the raw value to support structured vars
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(value) {
+		name := value[matches[0][2]:matches[0][3]]
+		resolved, ok := r.lookup(name)
+		if !ok {
+			r.addUndefined(name, site)
+			return value
+		}
+		r.replaced = true
+		return resolved
+	}
+
+	return varRefRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		name := varRefRegex.FindStringSubmatch(ref)[1]
+		resolved, ok := r.lookup(name)
+		if !ok {
+			r.addUndefined(name, site)
+			return ref
+		}
+
+		switch resolved.(type) {
+		case yaml.MapSlice, map[interface{}]interface{}, []interface{}:
+			r.invalid = append(r.invalid, fmt.Sprintf("%s (%s)", name, site))
+			return ref
+		}
+
+		r.replaced = true
+		return fmt.Sprint(resolved)
+	})
+}
+
+// lookup finds the value of a dot separated variable name.
+func (r *varResolver) lookup(name string) (interface{}, bool) {
+	current := r.vars
+	for _, key := range strings.Split(name, ".") {
+		switch v := current.(type) {
+		case yaml.MapSlice:
+			found := false
+			for _, item := range v {
+				if fmt.Sprint(item.Key) == key {
+					current, found = item.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case map[interface{}]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// addUndefined records a reference to a variable that is not defined.
+func (r *varResolver) addUndefined(name, site string) {
+	if r.undefined == nil {
+		r.undefined = make(map[string][]string)
+	}
+	r.undefined[name] = append(r.undefined[name], site)
+}
+
+// err returns an error describing every unresolvable reference.
+func (r *varResolver) err() error {
+	if len(r.undefined) == 0 && len(r.invalid) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(r.undefined)+len(r.invalid))
+	names := make([]string, 0, len(r.undefined))
+	for name := range r.undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, fmt.Sprintf("undefined variable '%s' referenced at %s", name, strings.Join(r.undefined[name], ", ")))
+	}
+	for _, ref := range r.invalid {
+		problems = append(problems, fmt.Sprintf("structured variable %s cannot be embedded in a string", ref))
+	}
+
+	return fmt.Errorf("failed to resolve vars: %s", strings.Join(problems, "; "))
+}
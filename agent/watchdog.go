@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+	"go.uber.org/zap"
+)
+
+// maxStackDump is the largest goroutine dump logged by the watchdog
+const maxStackDump = 64 << 20
+
+// progress is a sample of the progress of a pipeline
+type progress struct {
+	// Delivered is the sum of the progress counters of the outputs
+	Delivered uint64
+	// Pending is the work waiting for the pipeline, such as the unread bytes
+	// of files and the unflushed entries of buffers
+	Pending int64
+}
+
+// watchdog detects a pipeline that makes no progress while work is pending
+// for it, such as when an operator is deadlocked. A pipeline without pending
+// work is idle rather than stalled, so it is never reported. When the
+// pipeline stalls, the watchdog logs the stacks of every goroutine, reports
+// the agent as unhealthy, and restarts the pipeline if restart is set.
+type watchdog struct {
+	timeout    time.Duration
+	interval   time.Duration
+	sample     func() progress
+	restart    func() error
+	now        func() time.Time
+	dumpStacks func() []byte
+
+	mux          sync.Mutex
+	delivered    uint64
+	progressAt   time.Time
+	stalledSince time.Time
+	pending      int64
+	restarting   bool
+
+	*zap.SugaredLogger
+}
+
+// newWatchdog creates a watchdog that reports a pipeline as stalled once it
+// has made no progress for the timeout while work is pending
+func newWatchdog(timeout time.Duration, sample func() progress, restart func() error, logger *zap.SugaredLogger) *watchdog {
+	interval := timeout / 4
+	if interval > 10*time.Second {
+		interval = 10 * time.Second
+	}
+	return &watchdog{
+		timeout:       timeout,
+		interval:      interval,
+		sample:        sample,
+		restart:       restart,
+		now:           time.Now,
+		dumpStacks:    dumpStacks,
+		SugaredLogger: logger.With("component", "watchdog"),
+	}
+}
+
+// run checks the progress of the pipeline at each interval until the context
+// is cancelled
+func (w *watchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check samples the progress of the pipeline, and reports it as stalled if
+// it has made no progress for the timeout while work is pending
+func (w *watchdog) check() {
+	now := w.now()
+	sample := w.sample()
+
+	w.mux.Lock()
+	w.pending = sample.Pending
+	if w.progressAt.IsZero() || sample.Delivered != w.delivered || sample.Pending <= 0 {
+		w.delivered = sample.Delivered
+		w.progressAt = now
+		recovered := !w.stalledSince.IsZero()
+		w.stalledSince = time.Time{}
+		w.mux.Unlock()
+
+		if recovered {
+			w.Infow("Pipeline is making progress again")
+		}
+		return
+	}
+
+	if !w.stalledSince.IsZero() || now.Sub(w.progressAt) < w.timeout {
+		w.mux.Unlock()
+		return
+	}
+	w.stalledSince = w.progressAt
+	restart := w.restart != nil && !w.restarting
+	w.restarting = w.restarting || restart
+	w.mux.Unlock()
+
+	w.Errorw("Pipeline made no progress while work is pending",
+		"timeout", w.timeout.String(),
+		"pending", sample.Pending,
+		"goroutines", string(w.dumpStacks()),
+	)
+
+	if restart {
+		// The restart waits for the operators to stop, so it does not hold
+		// up the checks that detect its recovery
+		go func() {
+			w.Warnw("Restarting stalled pipeline")
+			if err := w.restart(); err != nil {
+				w.Errorw("Failed to restart stalled pipeline", zap.Error(err))
+			}
+			w.mux.Lock()
+			w.restarting = false
+			w.mux.Unlock()
+		}()
+	}
+}
+
+// stalled returns the time since which the pipeline has made no progress,
+// and the pending work, if the pipeline is stalled
+func (w *watchdog) stalled() (time.Time, int64, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.stalledSince, w.pending, !w.stalledSince.IsZero()
+}
+
+// Health is the health of the agent, as reported on the `/healthz` path
+type Health struct {
+	Healthy      bool       `json:"healthy"`
+	Reason       string     `json:"reason,omitempty"`
+	StalledSince *time.Time `json:"stalled_since,omitempty"`
+	Pending      int64      `json:"pending,omitempty"`
+	Warnings     []string   `json:"warnings,omitempty"`
+}
+
+// Health returns the health of the agent. The agent is unhealthy while its
+// pipeline is not running, or while the watchdog reports it as stalled.
+// Problems that leave the pipeline running, such as a remote config that
+// cannot be fetched, are reported as warnings without making it unhealthy.
+func (a *LogAgent) Health() *Health {
+	health := a.health()
+	if a.remote != nil {
+		if warning := a.remote.warning(); warning != "" {
+			health.Warnings = append(health.Warnings, warning)
+		}
+	}
+	if a.checkpoints != nil {
+		if warning := a.checkpoints.warning(); warning != "" {
+			health.Warnings = append(health.Warnings, warning)
+		}
+	}
+	return health
+}
+
+// health returns the health of the agent, without its warnings
+func (a *LogAgent) health() *Health {
+	a.mux.RLock()
+	running := a.running
+	a.mux.RUnlock()
+
+	if !running {
+		return &Health{Reason: "pipeline is not running"}
+	}
+	if a.watchdog != nil {
+		if since, pending, ok := a.watchdog.stalled(); ok {
+			return &Health{
+				Reason:       "pipeline made no progress while work is pending",
+				StalledSince: &since,
+				Pending:      pending,
+			}
+		}
+	}
+	return &Health{Healthy: true}
+}
+
+// dumpStacks returns the stacks of every goroutine
+func dumpStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackDump {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+// sampleProgress sums the progress of the outputs of the pipeline, and the
+// work pending for its operators. Outputs make progress as they receive
+// entries, unless they report their own progress, such as buffered outputs.
+func (a *LogAgent) sampleProgress() progress {
+	return pipelineProgress(a.currentPipeline())
+}
+
+// pipelineProgress sums the progress and pending work of the operators of a pipeline
+func pipelineProgress(pipeline pipeline.Pipeline) progress {
+	var sample progress
+	for _, op := range pipeline.Operators() {
+		if reporter, ok := op.(helper.PendingReporter); ok {
+			sample.Pending += reporter.PendingWork()
+		}
+
+		if op.CanOutput() {
+			continue
+		}
+		if reporter, ok := op.(helper.ProgressReporter); ok {
+			sample.Delivered += reporter.Progress()
+			continue
+		}
+		if reporter, ok := op.(helper.StatsReporter); ok {
+			if stats := reporter.OperatorStats(); stats != nil {
+				sample.Delivered += stats.Snapshot().EntriesIn
+			}
+		}
+	}
+	return sample
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeProgress struct {
+	sync.Mutex
+	sample progress
+}
+
+func (f *fakeProgress) set(delivered uint64, pending int64) {
+	f.Lock()
+	defer f.Unlock()
+	f.sample = progress{Delivered: delivered, Pending: pending}
+}
+
+func (f *fakeProgress) get() progress {
+	f.Lock()
+	defer f.Unlock()
+	return f.sample
+}
+
+func newTestWatchdog(timeout time.Duration, restart func() error) (*watchdog, *fakeProgress, *time.Time, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.InfoLevel)
+	sample := &fakeProgress{}
+	now := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	w := newWatchdog(timeout, sample.get, restart, zap.New(core).Sugar())
+	w.now = func() time.Time { return now }
+	w.dumpStacks = func() []byte { return []byte("goroutine 1 [running]") }
+	return w, sample, &now, logs
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Run("StalledWithPendingWork", func(t *testing.T) {
+		restarted := make(chan struct{}, 1)
+		w, sample, now, logs := newTestWatchdog(time.Minute, func() error {
+			restarted <- struct{}{}
+			return nil
+		})
+
+		sample.set(10, 100)
+		w.check()
+		*now = now.Add(30 * time.Second)
+		w.check()
+		_, _, stalled := w.stalled()
+		require.False(t, stalled)
+
+		started := *now
+		*now = now.Add(31 * time.Second)
+		w.check()
+		since, pending, stalled := w.stalled()
+		require.True(t, stalled)
+		require.Equal(t, started.Add(-30*time.Second), since)
+		require.Equal(t, int64(100), pending)
+
+		entries := logs.FilterMessage("Pipeline made no progress while work is pending").All()
+		require.Len(t, entries, 1)
+		require.Equal(t, "goroutine 1 [running]", entries[0].ContextMap()["goroutines"])
+
+		select {
+		case <-restarted:
+		case <-time.After(time.Second):
+			require.FailNow(t, "Timed out waiting for the pipeline to restart")
+		}
+
+		// A stall is only reported once
+		*now = now.Add(time.Minute)
+		w.check()
+		require.Len(t, logs.FilterMessage("Pipeline made no progress while work is pending").All(), 1)
+	})
+
+	t.Run("IdleWithoutPendingWork", func(t *testing.T) {
+		w, sample, now, logs := newTestWatchdog(time.Minute, nil)
+
+		sample.set(10, 0)
+		for i := 0; i < 10; i++ {
+			w.check()
+			*now = now.Add(time.Minute)
+		}
+		_, _, stalled := w.stalled()
+		require.False(t, stalled)
+		require.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("ProgressPreventsStall", func(t *testing.T) {
+		w, sample, now, _ := newTestWatchdog(time.Minute, nil)
+
+		for i := uint64(0); i < 10; i++ {
+			sample.set(i, 100)
+			w.check()
+			*now = now.Add(50 * time.Second)
+		}
+		_, _, stalled := w.stalled()
+		require.False(t, stalled)
+	})
+
+	t.Run("Recovers", func(t *testing.T) {
+		w, sample, now, logs := newTestWatchdog(time.Minute, nil)
+
+		sample.set(10, 100)
+		w.check()
+		*now = now.Add(2 * time.Minute)
+		w.check()
+		_, _, stalled := w.stalled()
+		require.True(t, stalled)
+
+		sample.set(11, 100)
+		*now = now.Add(time.Second)
+		w.check()
+		_, _, stalled = w.stalled()
+		require.False(t, stalled)
+		require.Equal(t, 1, logs.FilterMessage("Pipeline is making progress again").Len())
+	})
+}
+
+type progressOperator struct {
+	countingOperator
+	pending  int64
+	progress uint64
+}
+
+func (o progressOperator) PendingWork() int64 {
+	return o.pending
+}
+
+func (o progressOperator) Progress() uint64 {
+	return o.progress
+}
+
+type pendingOperator struct {
+	countingOperator
+	pending int64
+}
+
+func (o pendingOperator) PendingWork() int64 {
+	return o.pending
+}
+
+func TestPipelineProgress(t *testing.T) {
+	inputStats := &helper.OperatorStats{}
+	inputStats.AddIn(5)
+	outputStats := &helper.OperatorStats{}
+	outputStats.AddIn(7)
+
+	input := pendingOperator{newCountingOperator("$.input", inputStats), 300}
+	input.On("CanOutput").Return(true)
+	output := newCountingOperator("$.output", outputStats)
+	output.On("CanOutput").Return(false)
+	buffered := progressOperator{newCountingOperator("$.buffered", outputStats), 20, 3}
+	buffered.On("CanOutput").Return(false)
+
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Operators").Return([]operator.Operator{input, output, buffered})
+
+	require.Equal(t, progress{Delivered: 10, Pending: 320}, pipelineProgress(pipeline))
+}
+
+func TestAgentHealth(t *testing.T) {
+	w, sample, now, _ := newTestWatchdog(time.Minute, nil)
+	pipeline := &testutil.Pipeline{}
+	pipeline.On("Start").Return(nil)
+	pipeline.On("Stop").Return(nil)
+	pipeline.On("Operators").Return([]operator.Operator{})
+
+	agent := &LogAgent{
+		SugaredLogger: zap.NewNop().Sugar(),
+		pipeline:      pipeline,
+		database:      testutil.NewTestDatabase(t),
+		watchdog:      w,
+	}
+
+	health := agent.Health()
+	require.False(t, health.Healthy)
+	require.Equal(t, "pipeline is not running", health.Reason)
+
+	require.NoError(t, agent.Start())
+	defer agent.Stop()
+	require.Equal(t, &Health{Healthy: true}, agent.Health())
+
+	rec := httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	sample.set(1, 50)
+	w.check()
+	*now = now.Add(time.Hour)
+	w.check()
+
+	health = agent.Health()
+	require.False(t, health.Healthy)
+	require.Equal(t, int64(50), health.Pending)
+	require.NotNil(t, health.StalledSince)
+
+	rec = httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var served Health
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	require.False(t, served.Healthy)
+	require.Equal(t, int64(50), served.Pending)
+
+	rec = httptest.NewRecorder()
+	agent.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -1,6 +1,6 @@
 module github.com/observiq/stanza/cmd/stanza
 
-go 1.14
+go 1.16
 
 require (
 	github.com/armon/consul-api v0.0.0-20180202201655-eb2c6b5be1b6 // indirect
@@ -19,6 +19,7 @@ require (
 	github.com/xordataexchange/crypt v0.0.3-0.20170626215501-b2862e3d0a77 // indirect
 	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.15.0
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 replace github.com/observiq/stanza => ../../
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/observiq/stanza/agent"
 	"github.com/observiq/stanza/database"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/pipeline"
 	"github.com/observiq/stanza/plugin"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -15,19 +18,34 @@ import (
 // GraphFlags are the flags that can be supplied when running the graph command
 type GraphFlags struct {
 	*RootFlags
+
+	Format    string
+	Annotated bool
 }
 
 // NewGraphCommand creates a command for printing the pipeline as a graph
 func NewGraphCommand(rootFlags *RootFlags) *cobra.Command {
-	return &cobra.Command{
+	flags := &GraphFlags{RootFlags: rootFlags}
+	graph := &cobra.Command{
 		Use:   "graph",
 		Args:  cobra.NoArgs,
-		Short: "Export a dot-formatted representation of the operator graph",
-		Run:   func(command *cobra.Command, args []string) { runGraph(command, args, rootFlags) },
+		Short: "Export a dot or mermaid representation of the operator graph",
+		Long: `Build the pipeline without starting it, and write it as a graph. Each node is
+labeled with the ID and type of its operator, and the operators of each named
+pipeline, and each plugin, are drawn in a box.
+
+With --annotated, each edge is labeled and colored by the fraction of time
+its sending operator spent blocked on it, as sampled by the agent running at
+--http_addr with --sample_backpressure.`,
+		Run: func(command *cobra.Command, args []string) { runGraph(command, args, flags) },
 	}
+
+	graph.Flags().StringVar(&flags.Format, "format", pipeline.DotFormat, "the format of the graph, dot or mermaid")
+	graph.Flags().BoolVar(&flags.Annotated, "annotated", false, "annotate the dot graph with the back-pressure sampled by the agent at --http_addr")
+	return graph
 }
 
-func runGraph(_ *cobra.Command, _ []string, flags *RootFlags) {
+func runGraph(_ *cobra.Command, _ []string, flags *GraphFlags) {
 	var sugaredLogger *zap.SugaredLogger
 	if flags.Debug {
 		sugaredLogger = newDefaultLoggerAt(zapcore.DebugLevel, "")
@@ -38,34 +56,54 @@ func runGraph(_ *cobra.Command, _ []string, flags *RootFlags) {
 		_ = sugaredLogger.Sync()
 	}()
 
-	cfg, err := agent.NewConfigFromGlobs(flags.ConfigFiles)
-	if err != nil {
-		sugaredLogger.Errorw("Failed to read configs from glob", zap.Any("error", err))
+	if err := plugin.RegisterPlugins(flags.PluginDir, operator.DefaultRegistry); err != nil {
+		sugaredLogger.Errorw("Failed to register plugins", zap.Any("error", err))
 		os.Exit(1)
 	}
 
-	if err := plugin.RegisterPlugins(flags.PluginDir, operator.DefaultRegistry); err != nil {
-		sugaredLogger.Errorw("Failed to register plugins", zap.Any("error", err))
+	cfg, err := agent.NewConfigFromGlobs(flags.ConfigFiles)
+	if err != nil {
+		sugaredLogger.Errorw("Failed to read configs from glob", zap.Any("error", err))
 		os.Exit(1)
 	}
 
 	buildContext := operator.NewBuildContext(database.NewStubDatabase(), sugaredLogger)
-	pipeline, err := cfg.Pipeline.BuildPipeline(buildContext, nil)
+	built, err := cfg.BuildPipeline(buildContext, nil)
 	if err != nil {
 		sugaredLogger.Errorw("Failed to build operator pipeline", zap.Any("error", err))
 		os.Exit(1)
 	}
 
-	dotGraph, err := pipeline.Render()
+	graph, err := renderGraph(built, flags)
 	if err != nil {
-		sugaredLogger.Errorw("Failed to marshal dot graph", zap.Any("error", err))
+		sugaredLogger.Errorw("Failed to render graph", zap.Any("error", err))
 		os.Exit(1)
 	}
 
-	dotGraph = append(dotGraph, '\n')
-	_, err = stdout.Write(dotGraph)
+	if graph[len(graph)-1] != '\n' {
+		graph = append(graph, '\n')
+	}
+	_, err = stdout.Write(graph)
 	if err != nil {
-		sugaredLogger.Errorw("Failed to write dot graph to stdout", zap.Any("error", err))
+		sugaredLogger.Errorw("Failed to write graph to stdout", zap.Any("error", err))
 		os.Exit(1)
 	}
 }
+
+// renderGraph renders a pipeline in the format of the flags. An annotated
+// graph is rendered with the back-pressure in the status of the running agent.
+func renderGraph(p pipeline.Pipeline, flags *GraphFlags) ([]byte, error) {
+	if !flags.Annotated {
+		return pipeline.RenderAs(p, flags.Format)
+	}
+	if flags.Format != pipeline.DotFormat {
+		return nil, fmt.Errorf("--annotated requires the %s format", pipeline.DotFormat)
+	}
+
+	client := &http.Client{Timeout: statusTimeout}
+	status, err := fetchStatus(client, flags.HTTPAddr)
+	if err != nil {
+		return nil, fmt.Errorf("read status of agent: %s", err)
+	}
+	return pipeline.RenderAnnotated(p, pipeline.BackpressureOf(status.Operators)), nil
+}
@@ -2,16 +2,22 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 )
 
-func graphTest(config, output string) func(t *testing.T) {
+func graphTest(config, output string, args ...string) func(t *testing.T) {
 	return func(t *testing.T) {
 		tempDir, err := ioutil.TempDir("", "")
 		require.NoError(t, err)
@@ -25,6 +31,7 @@ func graphTest(config, output string) func(t *testing.T) {
 			ConfigFiles: []string{configPath},
 		}
 		graphCmd := NewGraphCommand(rootFlags)
+		graphCmd.SetArgs(args)
 
 		// replace stdout
 		buf := bytes.NewBuffer([]byte{})
@@ -59,13 +66,13 @@ pipeline:
 	expected := `
     strict digraph G {
       // Node definitions.
-      "$.json_parser";
-      "$.generate";
-      "$.google_cloud";
+      "$.generate" [label="$.generate\ngenerate_input"];
+      "$.google_cloud" [label="$.google_cloud\ngoogle_cloud_output"];
+      "$.json_parser" [label="$.json_parser\njson_parser"];
 
       // Edge definitions.
-      "$.json_parser" -> "$.google_cloud";
       "$.generate" -> "$.json_parser";
+      "$.json_parser" -> "$.google_cloud";
     }`
 
 	graphTest(config, expected)(t)
@@ -90,13 +97,13 @@ pipeline:
 	expected := `
     strict digraph G {
       // Node definitions.
-      "$.json_parser";
-      "$.google_cloud_output";
-      "$.generate_input";
+      "$.generate_input" [label="$.generate_input\ngenerate_input"];
+      "$.google_cloud_output" [label="$.google_cloud_output\ngoogle_cloud_output"];
+      "$.json_parser" [label="$.json_parser\njson_parser"];
 
       // Edge definitions.
-      "$.json_parser" -> "$.google_cloud_output";
       "$.generate_input" -> "$.json_parser";
+      "$.json_parser" -> "$.google_cloud_output";
     }`
 
 	graphTest(config, expected)(t)
@@ -122,13 +129,13 @@ pipeline:
 	expected := `
     strict digraph G {
       // Node definitions.
-      "$.json_parser";
-      "$.generate";
-      "$.google_cloud";
+      "$.generate" [label="$.generate\ngenerate_input"];
+      "$.google_cloud" [label="$.google_cloud\ngoogle_cloud_output"];
+      "$.json_parser" [label="$.json_parser\njson_parser"];
 
       // Edge definitions.
-      "$.json_parser" -> "$.google_cloud";
       "$.generate" -> "$.json_parser";
+      "$.json_parser" -> "$.google_cloud";
     }`
 
 	graphTest(config, expected)(t)
@@ -151,13 +158,13 @@ pipeline:
 	expected := `
     strict digraph G {
       // Node definitions.
-      "$.json_parser";
-      "$.google_cloud_output";
-      "$.generate_input";
+      "$.generate_input" [label="$.generate_input\ngenerate_input"];
+      "$.google_cloud_output" [label="$.google_cloud_output\ngoogle_cloud_output"];
+      "$.json_parser" [label="$.json_parser\njson_parser"];
 
       // Edge definitions.
-      "$.json_parser" -> "$.google_cloud_output";
       "$.generate_input" -> "$.json_parser";
+      "$.json_parser" -> "$.google_cloud_output";
     }`
 
 	graphTest(config, expected)(t)
@@ -184,15 +191,191 @@ pipeline:
 	expected := `
     strict digraph G {
       // Node definitions.
-      "$.json_parser";
-      "$.google_cloud_output";
-      "$.my_stdout";
-      "$.generate_input";
+      "$.generate_input" [label="$.generate_input\ngenerate_input"];
+      "$.google_cloud_output" [label="$.google_cloud_output\ngoogle_cloud_output"];
+      "$.json_parser" [label="$.json_parser\njson_parser"];
+      "$.my_stdout" [label="$.my_stdout\nstdout"];
 
       // Edge definitions.
-      "$.json_parser" -> "$.my_stdout";
       "$.generate_input" -> "$.json_parser";
+      "$.json_parser" -> "$.my_stdout";
     }`
 
 	graphTest(config, expected)(t)
 }
+
+func TestGraphMermaid(t *testing.T) {
+	config := `
+pipeline:
+  - type: generate_input
+    entry:
+      record:
+        test: value
+
+  - type: stdout
+`
+
+	expected := `
+    flowchart LR
+      n0["$.generate_input<br>generate_input"]
+      n1["$.stdout<br>stdout"]
+      n0 --> n1`
+
+	graphTest(config, expected, "--format", "mermaid")(t)
+}
+
+func TestGraphNamedPipelines(t *testing.T) {
+	config := `
+pipelines:
+  app:
+    - type: generate_input
+      entry:
+        record:
+          test: value
+    - type: stdout
+  audit:
+    - type: generate_input
+      entry:
+        record:
+          test: value
+      output: drop
+    - id: drop
+      type: drop_output
+    - id: unused
+      type: drop_output
+`
+
+	expected := `
+    strict digraph G {
+      // Node definitions.
+      subgraph "cluster_app" {
+        label="app";
+        "$.app.generate_input" [label="$.app.generate_input\ngenerate_input"];
+        "$.app.stdout" [label="$.app.stdout\nstdout"];
+      }
+      subgraph "cluster_audit" {
+        label="audit";
+        "$.audit.drop" [label="$.audit.drop\ndrop_output"];
+        "$.audit.generate_input" [label="$.audit.generate_input\ngenerate_input"];
+        "$.audit.unused" [label="$.audit.unused\ndrop_output"];
+      }
+
+      // Edge definitions.
+      "$.app.generate_input" -> "$.app.stdout";
+      "$.audit.generate_input" -> "$.audit.drop";
+    }`
+
+	graphTest(config, expected)(t)
+}
+
+func TestGraphPlugin(t *testing.T) {
+	pluginDir := testutil.NewTempDir(t)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(pluginDir, "access.yaml"), []byte(`
+pipeline:
+  - id: {{ .input }}
+    type: json_parser
+    output: parser
+  - id: parser
+    type: regex_parser
+    regex: '^(?P<message>.*)$'
+    output: {{ .output }}
+`), 0666))
+
+	configPath := filepath.Join(testutil.NewTempDir(t), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+pipeline:
+  - type: generate_input
+    entry:
+      record: test
+  - id: access_logs
+    type: access
+  - type: stdout
+`), 0666))
+
+	buf := bytes.NewBuffer([]byte{})
+	stdout = buf
+	graphCmd := NewGraphCommand(&RootFlags{ConfigFiles: []string{configPath}, PluginDir: pluginDir})
+	require.NoError(t, graphCmd.Execute())
+
+	expected := `
+    strict digraph G {
+      // Node definitions.
+      "$.generate_input" [label="$.generate_input\ngenerate_input"];
+      "$.stdout" [label="$.stdout\nstdout"];
+      subgraph "cluster_$.access_logs" {
+        label="$.access_logs";
+        "$.access_logs" [label="$.access_logs\njson_parser"];
+        "$.access_logs.parser" [label="$.access_logs.parser\nregex_parser"];
+      }
+
+      // Edge definitions.
+      "$.access_logs" -> "$.access_logs.parser";
+      "$.access_logs.parser" -> "$.stdout";
+      "$.generate_input" -> "$.access_logs";
+    }`
+	require.Equal(t, testutil.Trim(expected), testutil.Trim(buf.String()))
+}
+
+func TestGraphAnnotated(t *testing.T) {
+	config := `
+pipeline:
+  - id: generate
+    type: generate_input
+    output: json_parser
+    entry:
+      record:
+        test: value
+
+  - id: json_parser
+    type: json_parser
+    output: stdout
+
+  - id: stdout
+    type: stdout
+`
+
+	status := &agent.Status{
+		Running: true,
+		Operators: []operator.OperatorStatus{
+			{ID: "$.generate", Type: "generate_input", Backpressure: map[string]float64{"$.json_parser": 0.75}},
+			{ID: "$.json_parser", Type: "json_parser"},
+			{ID: "$.stdout", Type: "stdout"},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(status))
+	}))
+	defer server.Close()
+
+	configPath := filepath.Join(testutil.NewTempDir(t), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(config), 0666))
+
+	buf := bytes.NewBuffer([]byte{})
+	stdout = buf
+	graphCmd := NewGraphCommand(&RootFlags{ConfigFiles: []string{configPath}, HTTPAddr: strings.TrimPrefix(server.URL, "http://")})
+	graphCmd.SetArgs([]string{"--annotated"})
+	require.NoError(t, graphCmd.Execute())
+
+	expected := `
+    strict digraph G {
+      // Node definitions.
+      "$.generate" [label="$.generate\ngenerate_input"];
+      "$.json_parser" [label="$.json_parser\njson_parser"];
+      "$.stdout" [label="$.stdout\nstdout"];
+
+      // Edge definitions.
+      "$.generate" -> "$.json_parser" [label="75.0%", color=red];
+      "$.json_parser" -> "$.stdout";
+    }`
+	require.Equal(t, testutil.Trim(expected), testutil.Trim(buf.String()))
+}
+
+func TestRenderGraphAnnotatedErrors(t *testing.T) {
+	_, err := renderGraph(nil, &GraphFlags{RootFlags: &RootFlags{}, Format: "mermaid", Annotated: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--annotated requires the dot format")
+
+	_, err = renderGraph(nil, &GraphFlags{RootFlags: &RootFlags{}, Format: "dot", Annotated: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--http_addr is required")
+}
@@ -1,17 +1,22 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator/builtin/input/file"
 	"github.com/observiq/stanza/operator/helper"
 	"github.com/spf13/cobra"
 	"go.etcd.io/bbolt"
 )
 
 var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
 
 // NewOffsetsCmd returns the root command for managing offsets
 func NewOffsetsCmd(rootFlags *RootFlags) *cobra.Command {
@@ -26,6 +31,9 @@ func NewOffsetsCmd(rootFlags *RootFlags) *cobra.Command {
 
 	offsets.AddCommand(NewOffsetsClearCmd(rootFlags))
 	offsets.AddCommand(NewOffsetsListCmd(rootFlags))
+	offsets.AddCommand(NewOffsetsDumpCmd(rootFlags))
+	offsets.AddCommand(NewOffsetsSetCmd(rootFlags))
+	offsets.AddCommand(NewOffsetsRenameCmd(rootFlags))
 
 	return offsets
 }
@@ -114,6 +122,253 @@ func NewOffsetsListCmd(rootFlags *RootFlags) *cobra.Command {
 	return offsetsList
 }
 
+// fingerprintPrefixSize is the number of fingerprint bytes printed by offsets dump
+const fingerprintPrefixSize = 16
+
+// OffsetsDumpRow is the saved offset of a file, as printed by offsets dump
+type OffsetsDumpRow struct {
+	Operator    string `json:"operator"`
+	Path        string `json:"path"`
+	Offset      int64  `json:"offset"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// NewOffsetsDumpCmd returns the command for printing the saved offsets of each file
+func NewOffsetsDumpCmd(rootFlags *RootFlags) *cobra.Command {
+	var jsonOutput bool
+
+	offsetsDump := &cobra.Command{
+		Use:   "dump [flags] [operator_id]",
+		Short: "Print the persisted offsets of each file",
+		Long: "Print the path, offset, and fingerprint prefix of each file known to the file inputs, " +
+			"or to a single operator. The database is opened read-only, so it cannot be dumped while the agent is running",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(command *cobra.Command, args []string) {
+			db, err := database.OpenDatabaseReadOnly(rootFlags.DatabaseFile)
+			exitOnErr("Failed to open database", err)
+			defer db.Close()
+
+			err = runOffsetsDump(stdout, db, args, jsonOutput)
+			exitOnErr("Failed to dump offsets", err)
+		},
+	}
+
+	offsetsDump.Flags().BoolVar(&jsonOutput, "json", false, "print the offsets as JSON")
+
+	return offsetsDump
+}
+
+func runOffsetsDump(out io.Writer, db database.Database, operatorIDs []string, jsonOutput bool) error {
+	rows := []OffsetsDumpRow{}
+	err := db.View(func(tx *bbolt.Tx) error {
+		offsetsBucket := tx.Bucket(helper.OffsetsBucket)
+		if offsetsBucket == nil {
+			if len(operatorIDs) > 0 {
+				return fmt.Errorf("no offsets saved for operator '%s'", operatorIDs[0])
+			}
+			return nil
+		}
+
+		// Without an operator ID, every operator that saved known files is dumped
+		explicit := len(operatorIDs) > 0
+		if !explicit {
+			err := offsetsBucket.ForEach(func(key, value []byte) error {
+				if value == nil {
+					operatorIDs = append(operatorIDs, string(key))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, operatorID := range operatorIDs {
+			bucket := offsetsBucket.Bucket([]byte(operatorID))
+			if bucket == nil {
+				return fmt.Errorf("no offsets saved for operator '%s'", operatorID)
+			}
+
+			encoded := bucket.Get([]byte(file.KnownFilesKey))
+			if encoded == nil {
+				if explicit {
+					return fmt.Errorf("operator '%s' has no saved file offsets", operatorID)
+				}
+				continue
+			}
+
+			knownFiles, err := file.DecodeKnownFiles(encoded)
+			if err != nil {
+				return fmt.Errorf("saved file offsets of operator '%s' are corrupt: %s", operatorID, err)
+			}
+			for _, knownFile := range knownFiles {
+				rows = append(rows, OffsetsDumpRow{
+					Operator:    operatorID,
+					Path:        knownFile.Path,
+					Offset:      knownFile.Offset,
+					Fingerprint: fingerprintPrefix(knownFile.Fingerprint),
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	if len(rows) == 0 {
+		_, err := io.WriteString(out, "No file offsets have been saved\n")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATOR\tPATH\tOFFSET\tFINGERPRINT")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", row.Operator, row.Path, row.Offset, row.Fingerprint)
+	}
+	return w.Flush()
+}
+
+// fingerprintPrefix formats the first bytes of a fingerprint as a quoted string
+func fingerprintPrefix(fp *file.Fingerprint) string {
+	if fp == nil {
+		return `""`
+	}
+	if len(fp.FirstBytes) > fingerprintPrefixSize {
+		return fmt.Sprintf("%q...", fp.FirstBytes[:fingerprintPrefixSize])
+	}
+	return fmt.Sprintf("%q", fp.FirstBytes)
+}
+
+// NewOffsetsSetCmd returns the command for setting the offset of a single file
+func NewOffsetsSetCmd(rootFlags *RootFlags) *cobra.Command {
+	var toBeginning bool
+
+	offsetsSet := &cobra.Command{
+		Use:   "set [flags] operator_id file_path [offset]",
+		Short: "Set the persisted offset of a file",
+		Long: "Set the persisted offset of a file, so that the file input reads it from that offset when the agent starts. " +
+			"Use --to_beginning to read the whole file again. The agent must be stopped, since it holds the database open",
+		Args: func(command *cobra.Command, args []string) error {
+			if toBeginning {
+				return cobra.ExactArgs(2)(command, args)
+			}
+			return cobra.ExactArgs(3)(command, args)
+		},
+		Run: func(command *cobra.Command, args []string) {
+			offset := int64(0)
+			if !toBeginning {
+				var err error
+				offset, err = strconv.ParseInt(args[2], 10, 64)
+				if err == nil && offset < 0 {
+					err = fmt.Errorf("must not be negative")
+				}
+				exitOnErr(fmt.Sprintf("Invalid offset '%s'", args[2]), err)
+			}
+
+			db, err := database.OpenDatabase(rootFlags.DatabaseFile)
+			exitOnErr("Failed to open database", err)
+			defer db.Close()
+
+			err = setFileOffset(db, args[0], args[1], offset)
+			exitOnErr("Failed to set offset", err)
+			fmt.Fprintf(stdout, "Set the offset of %s to %d\n", args[1], offset)
+		},
+	}
+
+	offsetsSet.Flags().BoolVar(&toBeginning, "to_beginning", false, "set the offset to the beginning of the file")
+
+	return offsetsSet
+}
+
+// setFileOffset sets the offset of each known file of an operator with the
+// path. A file is known several times when it was seen by several polls.
+func setFileOffset(db database.Database, operatorID, path string, offset int64) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		offsetsBucket := tx.Bucket(helper.OffsetsBucket)
+		if offsetsBucket == nil {
+			return fmt.Errorf("no offsets saved for operator '%s'", operatorID)
+		}
+		bucket := offsetsBucket.Bucket([]byte(operatorID))
+		if bucket == nil {
+			return fmt.Errorf("no offsets saved for operator '%s'", operatorID)
+		}
+
+		encoded := bucket.Get([]byte(file.KnownFilesKey))
+		if encoded == nil {
+			return fmt.Errorf("operator '%s' has no saved file offsets", operatorID)
+		}
+		knownFiles, err := file.DecodeKnownFiles(encoded)
+		if err != nil {
+			return fmt.Errorf("saved file offsets of operator '%s' are corrupt: %s", operatorID, err)
+		}
+
+		updated := 0
+		for _, knownFile := range knownFiles {
+			if knownFile.Path != path {
+				continue
+			}
+			knownFile.Offset = offset
+			knownFile.Complete = false
+
+			// A header that ends past the offset is read again
+			if offset < knownFile.HeaderEnd {
+				knownFile.HeaderLabels = nil
+				knownFile.HeaderEnd = 0
+				knownFile.HeaderRead = false
+			}
+
+			// The elements of a JSON array are counted again from the start
+			if offset == 0 {
+				knownFile.ArrayIndex = 0
+			}
+
+			// Every output profile resumes from the offset, rather than skipping
+			// the entries it wrote before
+			knownFile.ProfileOffsets = nil
+			updated++
+		}
+		if updated == 0 {
+			return fmt.Errorf("operator '%s' has no saved offset for file '%s'", operatorID, path)
+		}
+
+		encoded, err = file.EncodeKnownFiles(knownFiles)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(file.KnownFilesKey), encoded)
+	})
+}
+
+// NewOffsetsRenameCmd returns the command for moving the offsets of an operator to a new ID
+func NewOffsetsRenameCmd(rootFlags *RootFlags) *cobra.Command {
+	offsetsRename := &cobra.Command{
+		Use:   "rename old_id new_id",
+		Short: "Move the persisted offsets of an operator to a new ID",
+		Long: "Move the persisted offsets of an operator to a new ID, so that an operator renamed in the config " +
+			"continues from its saved offsets. Fails if the new ID already has saved offsets. " +
+			"The agent must be stopped, since it holds the database open",
+		Args: cobra.ExactArgs(2),
+		Run: func(command *cobra.Command, args []string) {
+			db, err := database.OpenDatabase(rootFlags.DatabaseFile)
+			exitOnErr("Failed to open database", err)
+			defer db.Close()
+
+			err = helper.RenameScope(db, args[0], args[1])
+			exitOnErr("Failed to rename offsets", err)
+			fmt.Fprintf(stdout, "Moved the offsets of %s to %s\n", args[0], args[1])
+		},
+	}
+
+	return offsetsRename
+}
+
 func exitOnErr(msg string, err error) {
 	if err != nil {
 		os.Stderr.WriteString(fmt.Sprintf("%s: %s\n", msg, err))
@@ -2,15 +2,21 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/builtin/input/file"
 	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 	"go.etcd.io/bbolt"
+	"go.uber.org/zap/zaptest"
 )
 
 func TestOffsets(t *testing.T) {
@@ -71,3 +77,388 @@ func TestOffsets(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "$.testoperatorid1\n", buf.String())
 }
+
+func TestOffsetsDump(t *testing.T) {
+	newDatabase := func(t *testing.T, knownFiles map[string]string) string {
+		tempDir, err := ioutil.TempDir("", "")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+		databasePath := filepath.Join(tempDir, "logagent.db")
+		db, err := database.OpenDatabase(databasePath)
+		require.NoError(t, err)
+		err = db.Update(func(tx *bbolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(helper.OffsetsBucket)
+			if err != nil {
+				return err
+			}
+			for operatorID, encoded := range knownFiles {
+				operatorBucket, err := bucket.CreateBucket([]byte(operatorID))
+				if err != nil {
+					return err
+				}
+				if encoded == "" {
+					continue
+				}
+				if err := operatorBucket.Put([]byte(file.KnownFilesKey), []byte(encoded)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+		return databasePath
+	}
+
+	savedFiles := map[string]string{
+		"$.file_input": `2
+{"Fingerprint":{"FirstBytes":"Zmlyc3Q="},"Offset":6,"Path":"/var/log/first.log","Complete":false}
+{"Fingerprint":{"FirstBytes":"YSBmaW5nZXJwcmludCBsb25nZXIgdGhhbiB0aGUgcHJlZml4"},"Offset":1024,"Path":"/var/log/second.log","Complete":false}
+`,
+		"$.journald_input": "",
+	}
+
+	cases := []struct {
+		name        string
+		knownFiles  map[string]string
+		operatorIDs []string
+		json        bool
+		expected    string
+		errorMsg    string
+	}{
+		{
+			"Table",
+			savedFiles,
+			nil,
+			false,
+			`OPERATOR      PATH                 OFFSET  FINGERPRINT
+$.file_input  /var/log/first.log   6       "first"
+$.file_input  /var/log/second.log  1024    "a fingerprint lo"...
+`,
+			"",
+		},
+		{
+			"JSON",
+			savedFiles,
+			[]string{"$.file_input"},
+			true,
+			`[
+  {
+    "operator": "$.file_input",
+    "path": "/var/log/first.log",
+    "offset": 6,
+    "fingerprint": "\"first\""
+  },
+  {
+    "operator": "$.file_input",
+    "path": "/var/log/second.log",
+    "offset": 1024,
+    "fingerprint": "\"a fingerprint lo\"..."
+  }
+]
+`,
+			"",
+		},
+		{
+			"NoOffsets",
+			map[string]string{},
+			nil,
+			false,
+			"No file offsets have been saved\n",
+			"",
+		},
+		{
+			"MissingOperator",
+			savedFiles,
+			[]string{"$.missing"},
+			false,
+			"",
+			"no offsets saved for operator '$.missing'",
+		},
+		{
+			"OperatorWithoutKnownFiles",
+			savedFiles,
+			[]string{"$.journald_input"},
+			false,
+			"",
+			"operator '$.journald_input' has no saved file offsets",
+		},
+		{
+			"Corrupt",
+			map[string]string{"$.file_input": "2\n{\"Offset\":"},
+			nil,
+			false,
+			"",
+			"saved file offsets of operator '$.file_input' are corrupt",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := database.OpenDatabaseReadOnly(newDatabase(t, tc.knownFiles))
+			require.NoError(t, err)
+			defer db.Close()
+
+			var buf bytes.Buffer
+			err = runOffsetsDump(&buf, db, tc.operatorIDs, tc.json)
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+
+	t.Run("Command", func(t *testing.T) {
+		databasePath := newDatabase(t, savedFiles)
+		configPath := filepath.Join(filepath.Dir(databasePath), "config.yaml")
+		require.NoError(t, ioutil.WriteFile(configPath, []byte{}, 0666))
+
+		buf := bytes.NewBuffer([]byte{})
+		stdout = buf
+
+		offsetsDump := NewRootCmd()
+		offsetsDump.SetArgs([]string{
+			"offsets", "dump",
+			"--database", databasePath,
+			"--config", configPath,
+			"$.file_input",
+		})
+
+		err := offsetsDump.Execute()
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "/var/log/second.log  1024")
+	})
+}
+
+// readFileInput runs a file input with the database until it has sent the
+// expected number of entries, and returns their records
+func readFileInput(t *testing.T, databasePath, include string, expected int, cfgMods ...func(*file.InputConfig)) []interface{} {
+	db, err := database.OpenDatabase(databasePath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg := file.NewInputConfig("file_input")
+	cfg.PollInterval = helper.Duration{Duration: 10 * time.Millisecond}
+	cfg.StartAt = "beginning"
+	cfg.Include = []string{include}
+	cfg.OutputIDs = []string{"fake"}
+	for _, cfgMod := range cfgMods {
+		cfgMod(cfg)
+	}
+	ops, err := cfg.Build(operator.NewBuildContext(db, zaptest.NewLogger(t).Sugar()))
+	require.NoError(t, err)
+	input := ops[0]
+
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, input.SetOutputs([]operator.Operator{fake}))
+	require.NoError(t, input.Start())
+	defer input.Stop()
+
+	records := []interface{}{}
+	for len(records) < expected {
+		select {
+		case e := <-fake.Received:
+			records = append(records, e.Record)
+		case <-time.After(time.Second):
+			require.FailNow(t, "Timed out waiting for entries", "received %v", records)
+		}
+	}
+
+	select {
+	case e := <-fake.Received:
+		require.FailNow(t, "Received unexpected entry", "record %v", e.Record)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return records
+}
+
+func TestOffsetsSet(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	databasePath := filepath.Join(tempDir, "logagent.db")
+	configPath := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte{}, 0666))
+
+	logPath := filepath.Join(tempDir, "app.log")
+	require.NoError(t, ioutil.WriteFile(logPath, []byte("line1\nline2\nline3\n"), 0666))
+	include := filepath.Join(tempDir, "*.log")
+
+	buf := bytes.NewBuffer([]byte{})
+	stdout = buf
+
+	// The file is read once, and not again after a restart
+	require.Equal(t, []interface{}{"line1", "line2", "line3"}, readFileInput(t, databasePath, include, 3))
+	readFileInput(t, databasePath, include, 0)
+
+	// Rewinding the offset replays the entries after it
+	offsetsSet := NewRootCmd()
+	offsetsSet.SetArgs([]string{
+		"offsets", "set",
+		"--database", databasePath,
+		"--config", configPath,
+		"file_input", logPath, "6",
+	})
+	require.NoError(t, offsetsSet.Execute())
+	require.Equal(t, fmt.Sprintf("Set the offset of %s to 6\n", logPath), buf.String())
+	require.Equal(t, []interface{}{"line2", "line3"}, readFileInput(t, databasePath, include, 2))
+
+	offsetsSet = NewRootCmd()
+	offsetsSet.SetArgs([]string{
+		"offsets", "set",
+		"--database", databasePath,
+		"--config", configPath,
+		"--to_beginning",
+		"file_input", logPath,
+	})
+	require.NoError(t, offsetsSet.Execute())
+	require.Equal(t, []interface{}{"line1", "line2", "line3"}, readFileInput(t, databasePath, include, 3))
+
+	// Setting the offset to the end skips the file
+	require.NoError(t, ioutil.WriteFile(logPath, []byte("line1\nline2\nline3\nline4\n"), 0666))
+	db, err := database.OpenDatabase(databasePath)
+	require.NoError(t, err)
+	err = setFileOffset(db, "file_input", logPath, 24)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	readFileInput(t, databasePath, include, 0)
+}
+
+func TestOffsetsRename(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	databasePath := filepath.Join(tempDir, "logagent.db")
+	configPath := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte{}, 0666))
+
+	logPath := filepath.Join(tempDir, "app.log")
+	require.NoError(t, ioutil.WriteFile(logPath, []byte("line1\nline2\n"), 0666))
+	include := filepath.Join(tempDir, "*.log")
+
+	buf := bytes.NewBuffer([]byte{})
+	stdout = buf
+
+	withID := func(id string, previousIDs ...string) func(*file.InputConfig) {
+		return func(cfg *file.InputConfig) {
+			cfg.OperatorID = id
+			cfg.PreviousIDs = previousIDs
+		}
+	}
+
+	require.Equal(t, []interface{}{"line1", "line2"}, readFileInput(t, databasePath, include, 2))
+
+	// The renamed operator continues from the moved offsets
+	offsetsRename := NewRootCmd()
+	offsetsRename.SetArgs([]string{
+		"offsets", "rename",
+		"--database", databasePath,
+		"--config", configPath,
+		"file_input", "renamed",
+	})
+	require.NoError(t, offsetsRename.Execute())
+	require.Equal(t, "Moved the offsets of file_input to renamed\n", buf.String())
+	readFileInput(t, databasePath, include, 0, withID("renamed"))
+
+	// An operator with the ID in its previous_ids takes over the offsets
+	readFileInput(t, databasePath, include, 0, withID("again", "renamed"))
+
+	buf.Reset()
+	offsetsList := NewRootCmd()
+	offsetsList.SetArgs([]string{
+		"offsets", "list",
+		"--database", databasePath,
+		"--config", configPath,
+	})
+	require.NoError(t, offsetsList.Execute())
+	require.Equal(t, "again\n", buf.String())
+}
+
+func TestSetFileOffsetErrors(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	databasePath := filepath.Join(tempDir, "logagent.db")
+	db, err := database.OpenDatabase(databasePath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = setFileOffset(db, "file_input", "/var/log/app.log", 0)
+	require.EqualError(t, err, "no offsets saved for operator 'file_input'")
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(helper.OffsetsBucket)
+		if err != nil {
+			return err
+		}
+		operatorBucket, err := bucket.CreateBucket([]byte("file_input"))
+		if err != nil {
+			return err
+		}
+		_, err = bucket.CreateBucket([]byte("journald_input"))
+		if err != nil {
+			return err
+		}
+		return operatorBucket.Put([]byte(file.KnownFilesKey), []byte("1\n{\"Offset\":6,\"Path\":\"/var/log/app.log\"}\n"))
+	})
+	require.NoError(t, err)
+
+	err = setFileOffset(db, "journald_input", "/var/log/app.log", 0)
+	require.EqualError(t, err, "operator 'journald_input' has no saved file offsets")
+
+	err = setFileOffset(db, "file_input", "/var/log/other.log", 0)
+	require.EqualError(t, err, "operator 'file_input' has no saved offset for file '/var/log/other.log'")
+
+	err = setFileOffset(db, "file_input", "/var/log/app.log", 2)
+	require.NoError(t, err)
+}
+
+func TestSetFileOffsetProfiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	databasePath := filepath.Join(tempDir, "logagent.db")
+	db, err := database.OpenDatabase(databasePath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	encoded, err := file.EncodeKnownFiles([]*file.KnownFile{{
+		Offset:         12,
+		Path:           "/var/log/app.log",
+		ProfileOffsets: map[string]int64{"primary": 18, "archive": 12},
+	}})
+	require.NoError(t, err)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(helper.OffsetsBucket)
+		if err != nil {
+			return err
+		}
+		operatorBucket, err := bucket.CreateBucket([]byte("file_input"))
+		if err != nil {
+			return err
+		}
+		return operatorBucket.Put([]byte(file.KnownFilesKey), encoded)
+	})
+	require.NoError(t, err)
+
+	// The profiles are not left ahead of the offset that was set
+	require.NoError(t, setFileOffset(db, "file_input", "/var/log/app.log", 6))
+	err = db.View(func(tx *bbolt.Tx) error {
+		encoded := tx.Bucket(helper.OffsetsBucket).Bucket([]byte("file_input")).Get([]byte(file.KnownFilesKey))
+		knownFiles, err := file.DecodeKnownFiles(encoded)
+		require.NoError(t, err)
+		require.Len(t, knownFiles, 1)
+		require.Equal(t, int64(6), knownFiles[0].Offset)
+		require.Nil(t, knownFiles[0].ProfileOffsets)
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// NewOperatorsCmd returns the root command for describing the operators
+// supported by the agent
+func NewOperatorsCmd() *cobra.Command {
+	operators := &cobra.Command{
+		Use:   "operators",
+		Short: "Describe the operators supported by the agent",
+		Args:  cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			stdout.Write([]byte("No operators subcommand specified. See `stanza operators help` for details\n"))
+		},
+	}
+
+	operators.AddCommand(NewOperatorsListCmd())
+	operators.AddCommand(NewOperatorsDescribeCmd())
+
+	return operators
+}
+
+// NewOperatorsListCmd returns the command for listing the operator types
+func NewOperatorsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the operator types supported by the agent",
+		Args:  cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			for _, operatorType := range operator.DefaultRegistry.Types() {
+				fmt.Fprintln(stdout, operatorType)
+			}
+		},
+	}
+}
+
+// NewOperatorsDescribeCmd returns the command for describing the config
+// fields of an operator type
+func NewOperatorsDescribeCmd() *cobra.Command {
+	var asJSON bool
+
+	describe := &cobra.Command{
+		Use:   "describe [flags] operator_type",
+		Short: "Show the config fields of an operator type, with their types and defaults",
+		Args:  cobra.ExactArgs(1),
+		Run: func(command *cobra.Command, args []string) {
+			err := runOperatorsDescribe(stdout, args[0], asJSON)
+			exitOnErr("Failed to describe operator", err)
+		},
+	}
+
+	describe.Flags().BoolVar(&asJSON, "json", false, "print the schema as JSON instead of YAML")
+
+	return describe
+}
+
+func runOperatorsDescribe(out io.Writer, operatorType string, asJSON bool) error {
+	schema, ok := operator.DefaultRegistry.Schema(operatorType)
+	if !ok {
+		return fmt.Errorf("unsupported type '%s'. See `stanza operators list` for the supported types", operatorType)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	}
+
+	encoded, err := yaml.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(encoded)
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperators(t *testing.T) {
+	// capture stdout
+	buf := bytes.NewBuffer([]byte{})
+	stdout = buf
+
+	runOperatorsCmd := func(args ...string) {
+		buf.Reset()
+		cmd := NewRootCmd()
+		cmd.SetArgs(append([]string{"operators"}, args...))
+		require.NoError(t, cmd.Execute())
+	}
+
+	runOperatorsCmd("list")
+	require.Contains(t, buf.String(), "file_input\n")
+	require.Contains(t, buf.String(), "router\n")
+
+	runOperatorsCmd("describe", "file_input")
+	require.Contains(t, buf.String(), "type: file_input\n")
+	require.Contains(t, buf.String(), "- name: include\n  type: '[]string'\n  required: true\n")
+	require.Contains(t, buf.String(), "- name: poll_interval\n  type: helper.Duration\n  default: 200ms\n")
+
+	runOperatorsCmd("describe", "file_input", "--json")
+	var schema operator.Schema
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &schema))
+	require.Equal(t, "file_input", schema.Type)
+	require.Contains(t, schema.FieldNames(), "start_at")
+}
+
+func TestOperatorsDescribeUnsupported(t *testing.T) {
+	err := runOperatorsDescribe(&bytes.Buffer{}, "missing_operator", false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported type 'missing_operator'")
+}
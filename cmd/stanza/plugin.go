@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/plugin"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewPluginCmd returns the root command for working with plugins
+func NewPluginCmd(rootFlags *RootFlags) *cobra.Command {
+	plugins := &cobra.Command{
+		Use:   "plugin",
+		Short: "Work with the plugins in the plugin directory",
+		Args:  cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			stdout.Write([]byte("No plugin subcommand specified. See `stanza plugin help` for details\n"))
+		},
+	}
+
+	plugins.AddCommand(NewPluginTestCmd(rootFlags))
+
+	return plugins
+}
+
+// NewPluginTestCmd returns the command for rendering a plugin and running its fixture tests
+func NewPluginTestCmd(rootFlags *RootFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "test plugin_type params_file",
+		Short: "Render a plugin with the parameters in a file, and run the tests in the file",
+		Long: `Render a plugin from the plugin directory with the parameters in a file, and print the rendered pipeline.
+
+The file holds the parameters of the plugin, and optionally tests that send input
+lines through the rendered pipeline and compare the entries it writes:
+
+  parameters:
+    path: /var/log/app.log
+  tests:
+    - name: parses a request
+      input:
+        - GET /index.html 200
+      expected:
+        - record:
+            method: GET
+            path: /index.html
+            status: "200"
+`,
+		Args: cobra.ExactArgs(2),
+		Run: func(command *cobra.Command, args []string) {
+			logger := newDefaultLoggerAt(zapcore.WarnLevel, "")
+			defer func() {
+				_ = logger.Sync()
+			}()
+
+			err := runPluginTest(stdout, rootFlags.PluginDir, args[0], args[1], logger)
+			exitOnErr("Failed to test plugin", err)
+		},
+	}
+}
+
+// runPluginTest renders a plugin with the parameters of a fixture file, and
+// runs the tests of the fixture. It returns an error if any test fails.
+func runPluginTest(out io.Writer, pluginDir, pluginType, fixturePath string, logger *zap.SugaredLogger) error {
+	p, err := plugin.NewPluginFromFile(filepath.Join(pluginDir, pluginType+".yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("plugin '%s' is not in the plugin directory %s", pluginType, pluginDir)
+		}
+		return err
+	}
+
+	// Register the other plugins, which the plugin may use in its pipeline
+	if err := plugin.RegisterPlugins(pluginDir, operator.DefaultRegistry); err != nil {
+		return err
+	}
+
+	fixture, err := plugin.NewFixtureFromFile(fixturePath)
+	if err != nil {
+		return err
+	}
+
+	buildContext := operator.NewBuildContext(database.NewStubDatabase(), logger)
+	_, rendered, err := p.NewTestConfig(fixture.Parameters).Render(buildContext)
+	if rendered != nil {
+		fmt.Fprintf(out, "# Rendered pipeline of plugin %s\n%s\n", pluginType, rendered)
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, test := range fixture.Tests {
+		result, err := p.RunFixtureTest(buildContext, fixture.Parameters, test)
+		if err != nil {
+			return fmt.Errorf("test '%s': %s", test.Name, err)
+		}
+		if result.Passed() {
+			fmt.Fprintf(out, "PASS %s\n", result.Name)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(out, "FAIL %s\n", result.Name)
+		for _, failure := range result.Failures {
+			fmt.Fprintf(out, "    %s\n", failure)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(fixture.Tests))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPluginTest(t *testing.T) {
+	pluginDir := testutil.NewTempDir(t)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(pluginDir, "access.yaml"), []byte(`
+parameters:
+  pattern:
+    type: string
+    required: true
+pipeline:
+  - id: source
+    type: generate_input
+    record: unused
+  - id: parser
+    type: regex_parser
+    regex: '{{ .pattern }}'
+    output: {{ .output }}
+`), 0666))
+
+	writeFixture := func(contents string) string {
+		path := filepath.Join(testutil.NewTempDir(t), "params.yaml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0666))
+		return path
+	}
+
+	t.Run("Pass", func(t *testing.T) {
+		var out bytes.Buffer
+		fixture := writeFixture(`
+parameters:
+  pattern: '^(?P<method>\w+)$'
+tests:
+  - name: parses the method
+    input: [GET]
+    expected:
+      - record:
+          method: GET
+`)
+		require.NoError(t, runPluginTest(&out, pluginDir, "access", fixture, zap.NewNop().Sugar()))
+		require.Contains(t, out.String(), "regex: '^(?P<method>\\w+)$'")
+		require.Contains(t, out.String(), "PASS parses the method\n")
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		var out bytes.Buffer
+		fixture := writeFixture(`
+parameters:
+  pattern: '^(?P<method>\w+)$'
+tests:
+  - name: expects another method
+    input: [GET]
+    expected:
+      - record:
+          method: POST
+`)
+		err := runPluginTest(&out, pluginDir, "access", fixture, zap.NewNop().Sugar())
+		require.EqualError(t, err, "1 of 1 tests failed")
+		require.Contains(t, out.String(), "FAIL expects another method\n")
+		require.Contains(t, out.String(), `expected record {"method":"POST"}, got {"method":"GET"}`)
+	})
+
+	t.Run("RenderOnly", func(t *testing.T) {
+		var out bytes.Buffer
+		fixture := writeFixture("parameters:\n  pattern: '^$'\n")
+		require.NoError(t, runPluginTest(&out, pluginDir, "access", fixture, zap.NewNop().Sugar()))
+		require.Contains(t, out.String(), "# Rendered pipeline of plugin access\n")
+	})
+
+	t.Run("MissingParameter", func(t *testing.T) {
+		fixture := writeFixture("parameters: {}\n")
+		err := runPluginTest(&bytes.Buffer{}, pluginDir, "access", fixture, zap.NewNop().Sugar())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "missing required parameter")
+	})
+
+	t.Run("MissingPlugin", func(t *testing.T) {
+		fixture := writeFixture("parameters: {}\n")
+		err := runPluginTest(&bytes.Buffer{}, pluginDir, "missing", fixture, zap.NewNop().Sugar())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "plugin 'missing' is not in the plugin directory")
+	})
+}
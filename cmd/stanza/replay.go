@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+	"github.com/observiq/stanza/plugin"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxReplayLineSize is the size of the longest line that can be replayed
+const maxReplayLineSize = 1024 * 1024
+
+// ReplayFlags are the flags that can be supplied when running the replay command
+type ReplayFlags struct {
+	*RootFlags
+
+	Input         string
+	Count         int
+	Rate          float64
+	EntryPoint    string
+	DiscardOutput bool
+}
+
+// NewReplayCmd creates a command that feeds the lines of a file through the pipeline
+func NewReplayCmd(rootFlags *RootFlags) *cobra.Command {
+	flags := &ReplayFlags{RootFlags: rootFlags}
+	replay := &cobra.Command{
+		Use:   "replay",
+		Short: "Feed the lines of a file through the pipeline as fast as possible, and report the throughput",
+		Long: `Build the pipeline, and send each line of a file, or of stdin, as an entry to the
+operators that the inputs send entries to, without starting the inputs. Once
+every entry has been processed, the pipeline is stopped, and the throughput and
+the counters of each operator are reported. The lines are read before the
+replay starts, so reading them is not timed.`,
+		Args: cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			logger := newDefaultLoggerAt(zapcore.WarnLevel, "")
+			defer func() {
+				_ = logger.Sync()
+			}()
+
+			var in io.Reader = os.Stdin
+			if flags.Input != "" && flags.Input != "-" {
+				file, err := os.Open(flags.Input)
+				exitOnErr("Failed to open input", err)
+				defer file.Close()
+				in = file
+			}
+
+			report, err := runReplay(context.Background(), flags, in, logger)
+			exitOnErr("Failed to replay entries", err)
+			err = writeReplayReport(stdout, report)
+			exitOnErr("Failed to write replay report", err)
+			err = writeRunSummary(stderr, report.Summary)
+			exitOnErr("Failed to write run summary", err)
+			_ = logger.Sync()
+			os.Exit(report.Summary.ExitCode)
+		},
+	}
+
+	replay.Flags().StringVar(&flags.Input, "input", "-", "the file to read lines from, or - for stdin")
+	replay.Flags().IntVar(&flags.Count, "count", 0, "the number of entries to send, repeating the lines if needed (default is each line once)")
+	replay.Flags().Float64Var(&flags.Rate, "rate", 0, "the number of entries to send per second (default is as fast as possible)")
+	replay.Flags().StringVar(&flags.EntryPoint, "entry_point", "", "the ID of the operator to send entries to (default is the operators that the inputs send entries to)")
+	replay.Flags().BoolVar(&flags.DiscardOutput, "discard_output", false, "replace each output with one that drops entries")
+	return replay
+}
+
+// replayReport is the result of a replay
+type replayReport struct {
+	Entries   int
+	Elapsed   time.Duration
+	Operators map[string]helper.OperatorStats
+	Blocked   map[string]map[string]float64
+
+	// Summary counts the entries that were not delivered, and sets the exit
+	// code of the replay
+	Summary *agent.RunSummary
+}
+
+// Throughput returns the number of entries processed per second
+func (r *replayReport) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Entries) / r.Elapsed.Seconds()
+}
+
+// runReplay builds the pipeline of the config without its inputs, sends the
+// lines of a reader through it, and stops it once every entry is processed
+func runReplay(ctx context.Context, flags *ReplayFlags, in io.Reader, logger *zap.SugaredLogger) (*replayReport, error) {
+	if err := plugin.RegisterPlugins(flags.PluginDir, operator.DefaultRegistry); err != nil {
+		return nil, errors.Wrap(err, "register plugins")
+	}
+
+	cfg, err := agent.NewConfigFromGlobs(flags.ConfigFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	buildContext := operator.NewBuildContext(database.NewStubDatabase(), logger)
+	buildContext.CollectStats = true
+	buildContext.SampleBackpressure = true
+	built, err := cfg.BuildPipeline(buildContext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	processors, entryPoints := pipeline.WithoutInputs(built.Operators())
+	if flags.EntryPoint != "" {
+		entryPoint, ok := pipeline.FindOperator(processors, flags.EntryPoint)
+		if !ok {
+			return nil, errors.NewError(
+				fmt.Sprintf("operator '%s' is not in the pipeline, or is an input", flags.EntryPoint),
+				"set --entry_point to the ID of an operator that processes entries",
+			)
+		}
+		entryPoints = []operator.Operator{entryPoint}
+	}
+	if len(entryPoints) == 0 {
+		return nil, errors.NewError(
+			"the pipeline has no inputs to send entries in place of",
+			"set --entry_point to the ID of the operator to send entries to",
+		)
+	}
+
+	if flags.DiscardOutput {
+		processors, err = pipeline.ReplaceOutputs(processors, func(output operator.Operator) (operator.Operator, error) {
+			outputOperator, err := helper.NewOutputConfig(output.ID(), "discard_output").Build(buildContext)
+			if err != nil {
+				return nil, err
+			}
+			return &discardOutput{OutputOperator: outputOperator}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	replayPipeline, err := pipeline.NewDirectedPipeline(processors)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := readReplayLines(in)
+	if err != nil {
+		return nil, err
+	}
+	count := flags.Count
+	if count <= 0 {
+		count = len(lines)
+	}
+
+	if err := replayPipeline.Start(); err != nil {
+		return nil, errors.Wrap(err, "start pipeline")
+	}
+
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		if flags.Rate > 0 {
+			next := start.Add(time.Duration(float64(i) / flags.Rate * float64(time.Second)))
+			time.Sleep(time.Until(next))
+		}
+
+		e := entry.New()
+		e.Record = lines[i%len(lines)]
+		for j, target := range entryPoints {
+			if j < len(entryPoints)-1 {
+				_ = pipeline.Inject(ctx, target, e.Copy())
+				continue
+			}
+			_ = pipeline.Inject(ctx, target, e)
+		}
+	}
+
+	// Stopping the pipeline flushes the entries its operators hold
+	if err := replayPipeline.Stop(); err != nil {
+		return nil, errors.Wrap(err, "stop pipeline")
+	}
+
+	report := &replayReport{
+		Entries:   count,
+		Elapsed:   time.Since(start),
+		Operators: make(map[string]helper.OperatorStats),
+		Blocked:   make(map[string]map[string]float64),
+		Summary:   agent.SummarizeRun(processors),
+	}
+	for _, op := range processors {
+		if reporter, ok := op.(helper.StatsReporter); ok && reporter.OperatorStats() != nil {
+			report.Operators[op.ID()] = reporter.OperatorStats().Snapshot()
+		}
+		if reporter, ok := op.(helper.BackpressureReporter); ok {
+			if ratios := reporter.BackpressureRatios(); len(ratios) > 0 {
+				report.Blocked[op.ID()] = ratios
+			}
+		}
+	}
+	return report, nil
+}
+
+// readReplayLines reads the lines of a reader
+func readReplayLines(in io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReplayLineSize)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read input")
+	}
+	if len(lines) == 0 {
+		return nil, errors.NewError("the input has no lines to replay", "")
+	}
+	return lines, nil
+}
+
+// writeReplayReport writes the throughput of a replay, and the counters and
+// back-pressure of each operator
+func writeReplayReport(out io.Writer, report *replayReport) error {
+	fmt.Fprintf(out, "Replayed %d entries in %s (%.1f entries/sec)\n\n", report.Entries, report.Elapsed.Round(time.Millisecond), report.Throughput())
+	if err := writeStatsTable(out, report.Operators); err != nil {
+		return err
+	}
+	if len(report.Blocked) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(report.Blocked))
+	for id := range report.Blocked {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATOR\tOUTPUT\tBLOCKED")
+	for _, id := range ids {
+		outputs := make([]string, 0, len(report.Blocked[id]))
+		for output := range report.Blocked[id] {
+			outputs = append(outputs, output)
+		}
+		sort.Strings(outputs)
+
+		for _, output := range outputs {
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\n", id, output, report.Blocked[id][output]*100)
+		}
+	}
+	return w.Flush()
+}
+
+// discardOutput replaces an output during a replay. It drops each entry,
+// which is counted in its stats.
+type discardOutput struct {
+	helper.OutputOperator
+}
+
+// Process drops the entry
+func (o *discardOutput) Process(ctx context.Context, e *entry.Entry) error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newReplayTestFlags(t *testing.T) (*ReplayFlags, string) {
+	tempDir := testutil.NewTempDir(t)
+	outputPath := filepath.Join(tempDir, "out.log")
+	config := fmt.Sprintf(`
+pipeline:
+  - type: generate_input
+    entry:
+      record: generated
+  - type: regex_parser
+    regex: '^(?P<level>\w+) (?P<message>.*)$'
+  - id: out
+    type: file_output
+    path: %s
+    format: "{{ .Record }}\n"
+`, outputPath)
+	configPath := filepath.Join(tempDir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(config), 0666))
+
+	flags := &ReplayFlags{
+		RootFlags: &RootFlags{
+			ConfigFiles: []string{configPath},
+			PluginDir:   testutil.NewTempDir(t),
+		},
+	}
+	return flags, outputPath
+}
+
+func TestRunReplay(t *testing.T) {
+	input := "info first\nerror second\n"
+
+	t.Run("EachLineOnce", func(t *testing.T) {
+		flags, outputPath := newReplayTestFlags(t)
+		report, err := runReplay(context.Background(), flags, strings.NewReader(input), zap.NewNop().Sugar())
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Entries)
+		require.Equal(t, uint64(2), report.Operators["$.regex_parser"].EntriesIn)
+		require.Equal(t, uint64(2), report.Operators["$.out"].EntriesIn)
+		require.Equal(t, &agent.RunSummary{ExitCode: agent.ExitDelivered}, report.Summary)
+
+		// The input is not started, so only the replayed lines are written
+		require.NotContains(t, report.Operators, "$.generate_input")
+		written, err := ioutil.ReadFile(outputPath)
+		require.NoError(t, err)
+		require.Equal(t, "map[level:info message:first]\nmap[level:error message:second]\n", string(written))
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		flags, _ := newReplayTestFlags(t)
+		flags.Count = 5
+		report, err := runReplay(context.Background(), flags, strings.NewReader(input), zap.NewNop().Sugar())
+		require.NoError(t, err)
+		require.Equal(t, 5, report.Entries)
+		require.Equal(t, uint64(5), report.Operators["$.out"].EntriesIn)
+	})
+
+	t.Run("Rate", func(t *testing.T) {
+		flags, _ := newReplayTestFlags(t)
+		flags.Count = 4
+		flags.Rate = 20
+		report, err := runReplay(context.Background(), flags, strings.NewReader(input), zap.NewNop().Sugar())
+		require.NoError(t, err)
+		require.True(t, report.Elapsed >= 150*time.Millisecond, report.Elapsed.String())
+	})
+
+	t.Run("DiscardOutput", func(t *testing.T) {
+		flags, outputPath := newReplayTestFlags(t)
+		flags.DiscardOutput = true
+		report, err := runReplay(context.Background(), flags, strings.NewReader(input), zap.NewNop().Sugar())
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), report.Operators["$.out"].EntriesIn)
+		require.NoFileExists(t, outputPath)
+	})
+
+	t.Run("EntryPoint", func(t *testing.T) {
+		flags, outputPath := newReplayTestFlags(t)
+		flags.EntryPoint = "out"
+		report, err := runReplay(context.Background(), flags, strings.NewReader(input), zap.NewNop().Sugar())
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), report.Operators["$.regex_parser"].EntriesIn)
+		require.Equal(t, uint64(2), report.Operators["$.out"].EntriesIn)
+
+		written, err := ioutil.ReadFile(outputPath)
+		require.NoError(t, err)
+		require.Equal(t, input, string(written))
+	})
+
+	t.Run("MissingEntryPoint", func(t *testing.T) {
+		flags, _ := newReplayTestFlags(t)
+		flags.EntryPoint = "generate_input"
+		_, err := runReplay(context.Background(), flags, strings.NewReader(input), zap.NewNop().Sugar())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "operator 'generate_input' is not in the pipeline, or is an input")
+	})
+
+	t.Run("EmptyInput", func(t *testing.T) {
+		flags, _ := newReplayTestFlags(t)
+		_, err := runReplay(context.Background(), flags, strings.NewReader(""), zap.NewNop().Sugar())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the input has no lines to replay")
+	})
+}
+
+func TestWriteReplayReport(t *testing.T) {
+	report := &replayReport{
+		Entries: 1000,
+		Elapsed: 2 * time.Second,
+		Operators: map[string]helper.OperatorStats{
+			"$.parser": {EntriesIn: 1000, EntriesOut: 990, Errored: 10},
+			"$.out":    {EntriesIn: 990},
+		},
+		Blocked: map[string]map[string]float64{
+			"$.parser": {"$.out": 0.25},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, writeReplayReport(&out, report))
+	expected := `Replayed 1000 entries in 2s (500.0 entries/sec)
+
+OPERATOR  IN    OUT  DROPPED  ERRORED  BYTES
+$.out     990   0    0        0        0
+$.parser  1000  990  0        10       0
+
+OPERATOR  OUTPUT  BLOCKED
+$.parser  $.out   25.0%
+`
+	require.Equal(t, expected, out.String())
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 
@@ -31,8 +33,22 @@ type RootFlags struct {
 	MemProfile         string
 	MemProfileDelay    time.Duration
 
-	LogFile string
-	Debug   bool
+	LogFile              string
+	Debug                bool
+	SampleBackpressure   bool
+	StrictDeprecations   bool
+	StatsInterval        time.Duration
+	StatsRetention       time.Duration
+	WriteInterval        time.Duration
+	StopTimeout          time.Duration
+	OnSigterm            string
+	OnSigint             string
+	WatchdogTimeout      time.Duration
+	WatchdogRestart      bool
+	HTTPAddr             string
+	User                 string
+	Group                string
+	ResumeFromCheckpoint string
 }
 
 // NewRootCmd will return a root level command
@@ -53,6 +69,20 @@ func NewRootCmd() *cobra.Command {
 	rootFlagSet.StringVar(&rootFlags.PluginDir, "plugin_dir", defaultPluginDir(), "path to the plugin directory")
 	rootFlagSet.StringVar(&rootFlags.DatabaseFile, "database", "", "path to the stanza offset database")
 	rootFlagSet.BoolVar(&rootFlags.Debug, "debug", false, "debug logging")
+	rootFlagSet.BoolVar(&rootFlags.SampleBackpressure, "sample_backpressure", false, "sample the time operators spend blocked on their outputs")
+	rootFlagSet.BoolVar(&rootFlags.StrictDeprecations, "strict_deprecations", false, "fail to start if the config uses deprecated fields")
+	rootFlagSet.DurationVar(&rootFlags.WriteInterval, "database_write_interval", 0, "interval at which to batch the writes of offsets to the database, instead of writing each one")
+	rootFlagSet.DurationVar(&rootFlags.StopTimeout, "stop_timeout", 0, "time the agent has to stop before it is killed when stopped as a service. Operator state is saved first. Detected for windows services and systemd units when unset")
+	rootFlagSet.StringVar(&rootFlags.OnSigterm, "on_sigterm", string(policyDrain), "how the agent stops on SIGTERM: drain, immediate, or drain_then_immediate")
+	rootFlagSet.StringVar(&rootFlags.OnSigint, "on_sigint", string(policyDrainThenImmediate), "how the agent stops on SIGINT: drain, immediate, or drain_then_immediate")
+	rootFlagSet.DurationVar(&rootFlags.StatsInterval, "stats_interval", 0, "interval at which to save operator stats to the database")
+	rootFlagSet.DurationVar(&rootFlags.StatsRetention, "stats_retention", 7*24*time.Hour, "how long to keep saved operator stats")
+	rootFlagSet.DurationVar(&rootFlags.WatchdogTimeout, "watchdog_timeout", 0, "report the agent as unhealthy and log goroutine stacks when the pipeline makes no progress for this long while work is pending. Disabled when 0")
+	rootFlagSet.BoolVar(&rootFlags.WatchdogRestart, "watchdog_restart", false, "restart the pipeline when the watchdog reports it as stalled")
+	rootFlagSet.StringVar(&rootFlags.HTTPAddr, "http_addr", "", "listen address of the local HTTP endpoint that serves operator stats and status")
+	rootFlagSet.StringVar(&rootFlags.User, "user", "", "user to run as once network listeners are bound (linux only)")
+	rootFlagSet.StringVar(&rootFlags.Group, "group", "", "group to run as once network listeners are bound, instead of the primary group of --user (linux only)")
+	rootFlagSet.StringVar(&rootFlags.ResumeFromCheckpoint, "resume_from_checkpoint", "", "take over from an active agent by loading the offsets of the checkpoint at this file path or URL, signed with the key of the checkpoint config")
 
 	// Profiling flags
 	rootFlagSet.IntVar(&rootFlags.PprofPort, "pprof_port", 0, "listen port for pprof profiling")
@@ -74,6 +104,12 @@ func NewRootCmd() *cobra.Command {
 	root.AddCommand(NewGraphCommand(rootFlags))
 	root.AddCommand(NewVersionCommand())
 	root.AddCommand(NewOffsetsCmd(rootFlags))
+	root.AddCommand(NewStatsCmd(rootFlags))
+	root.AddCommand(NewStatusCmd(rootFlags))
+	root.AddCommand(NewOperatorsCmd())
+	root.AddCommand(NewPluginCmd(rootFlags))
+	root.AddCommand(NewValidateCmd(rootFlags))
+	root.AddCommand(NewReplayCmd(rootFlags))
 
 	return root
 }
@@ -89,10 +125,23 @@ func runRoot(command *cobra.Command, _ []string, flags *RootFlags) {
 		_ = logger.Sync()
 	}()
 
+	policies, err := newSignalPolicies(flags.OnSigterm, flags.OnSigint)
+	if err != nil {
+		logger.Errorw("Invalid signal policy", zap.Any("error", err))
+		os.Exit(1)
+	}
+
 	agent, err := agent.NewBuilder(logger).
 		WithConfigFiles(flags.ConfigFiles).
 		WithPluginDir(flags.PluginDir).
 		WithDatabaseFile(flags.DatabaseFile).
+		WithBackpressureSampling(flags.SampleBackpressure).
+		WithStrictDeprecations(flags.StrictDeprecations).
+		WithStatsPersistence(flags.StatsInterval, flags.StatsRetention).
+		WithDatabaseWriteInterval(flags.WriteInterval).
+		WithPrivilegeDrop(flags.User, flags.Group).
+		WithWatchdog(flags.WatchdogTimeout, flags.WatchdogRestart).
+		WithResumeFromCheckpoint(flags.ResumeFromCheckpoint).
 		Build()
 	if err != nil {
 		logger.Errorw("Failed to build agent", zap.Any("error", err))
@@ -100,13 +149,16 @@ func runRoot(command *cobra.Command, _ []string, flags *RootFlags) {
 	}
 
 	ctx, cancel := context.WithCancel(command.Context())
-	service, err := newAgentService(ctx, agent, cancel)
+	service, err := newAgentService(ctx, agent, cancel, stopTimeout(flags.StopTimeout), policies)
 	if err != nil {
 		logger.Errorf("Failed to create agent service", zap.Any("error", err))
 		os.Exit(1)
 	}
 
 	profilingWg := startProfiling(ctx, flags, logger)
+	if flags.HTTPAddr != "" {
+		startHTTPServer(ctx, profilingWg, flags.HTTPAddr, agent.Handler(), logger)
+	}
 
 	err = service.Run()
 	if err != nil {
@@ -115,6 +167,51 @@ func runRoot(command *cobra.Command, _ []string, flags *RootFlags) {
 	}
 
 	profilingWg.Wait()
+
+	// An agent that stopped once its operators completed, such as after a
+	// backfill, reports what happened to its entries in its exit code
+	select {
+	case <-agent.Done():
+		summary := agent.RunSummary()
+		if err := writeRunSummary(stderr, summary); err != nil {
+			logger.Errorw("Failed to write run summary", zap.Error(err))
+		}
+		_ = logger.Sync()
+		os.Exit(summary.ExitCode)
+	default:
+	}
+}
+
+// writeRunSummary writes the summary of a run that ended by itself as JSON
+func writeRunSummary(out io.Writer, summary *agent.RunSummary) error {
+	return json.NewEncoder(out).Encode(summary)
+}
+
+// startHTTPServer serves the handler on the address until the context is cancelled
+func startHTTPServer(ctx context.Context, wg *sync.WaitGroup, addr string, handler http.Handler, logger *zap.SugaredLogger) {
+	srv := http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			logger.Errorw("HTTP server failed", zap.Error(err))
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warnw("Errored shutting down HTTP server", zap.Error(err))
+		}
+	}()
 }
 
 func startProfiling(ctx context.Context, flags *RootFlags, logger *zap.SugaredLogger) *sync.WaitGroup {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/observiq/stanza/agent"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,3 +74,10 @@ pipeline:
 
 	require.Regexp(t, expectedPattern, string(actual))
 }
+
+func TestWriteRunSummary(t *testing.T) {
+	var out bytes.Buffer
+	summary := &agent.RunSummary{Dropped: 3, Quarantined: 2, ExitCode: agent.ExitDropped}
+	require.NoError(t, writeRunSummary(&out, summary))
+	require.Equal(t, `{"dropped":3,"quarantined":2,"output_failed":0,"exit_code":4}`+"\n", out.String())
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/kardianos/service"
 	"github.com/observiq/stanza/agent"
@@ -15,8 +16,26 @@ import (
 type AgentService struct {
 	cancel context.CancelFunc
 	agent  *agent.LogAgent
+
+	// stopTimeout is the time the agent has to stop when it is stopped by a
+	// service control or SIGTERM. It is zero if the agent has no deadline.
+	stopTimeout time.Duration
+	// unhurried is set when the agent stops without a deadline, such as when
+	// it is interrupted or its operators complete
+	unhurried bool
+
+	// policies are how the agent stops for each signal, signals receives the
+	// signals that stop or reload the agent, and stopSignal is the signal that
+	// stopped it, if any
+	policies   signalPolicies
+	signals    chan os.Signal
+	stopSignal os.Signal
 }
 
+// immediateSaveTimeout is the time the operators have to save their state
+// when the agent exits without draining its pipeline
+const immediateSaveTimeout = 5 * time.Second
+
 // Start will start the stanza agent.
 func (a *AgentService) Start(s service.Service) error {
 	a.agent.Info("Starting stanza agent")
@@ -30,34 +49,119 @@ func (a *AgentService) Start(s service.Service) error {
 	return nil
 }
 
-// Stop will stop the stanza agent.
+// Stop will stop the stanza agent. The agent drains its pipeline, unless
+// the policy of the signal that stopped it is immediate, or a signal received
+// while it drains forces it to exit.
 func (a *AgentService) Stop(s service.Service) error {
-	a.agent.Info("Stopping stanza agent")
-	if err := a.agent.Stop(); err != nil {
-		a.agent.Errorw("Failed to stop stanza agent gracefully", zap.Any("error", err))
-		a.cancel()
+	defer a.cancel()
+	if !a.policies.drains(a.stopSignal) {
+		a.agent.Infow("Stopping stanza agent without draining", "signal", a.stopSignal.String())
+		a.stopImmediately()
 		return nil
 	}
 
-	a.agent.Info("Stanza agent stopped")
-	a.cancel()
-	return nil
+	a.agent.Info("Stopping stanza agent")
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- a.stopAgent()
+	}()
+
+	for {
+		select {
+		case err := <-stopped:
+			if err != nil {
+				a.agent.Errorw("Failed to stop stanza agent gracefully", zap.Any("error", err))
+				return nil
+			}
+			a.agent.Info("Stanza agent stopped")
+			return nil
+		case sig := <-a.signals:
+			if !a.policies.forcesExit(sig) {
+				a.agent.Infow("Ignoring signal while the pipeline drains", "signal", sig.String())
+				continue
+			}
+			a.agent.Warnw("Stopping stanza agent without draining", "signal", sig.String())
+			a.stopImmediately()
+			return nil
+		}
+	}
+}
+
+// stopImmediately saves the state of the operators, so the agent resumes
+// from it after a restart, and returns without draining the pipeline. Entries
+// that are not yet delivered are read again after a restart.
+func (a *AgentService) stopImmediately() {
+	ctx, cancel := context.WithTimeout(context.Background(), immediateSaveTimeout)
+	defer cancel()
+	if err := a.agent.SaveState(ctx); err != nil {
+		a.agent.Errorw("Failed to save operator state before exiting", zap.Any("error", err))
+		return
+	}
+	a.agent.Info("Saved operator state. Exiting without draining the pipeline")
+}
+
+// stopAgent stops the agent, saving the state of its operators first if it
+// must stop within a timeout
+func (a *AgentService) stopAgent() error {
+	if a.stopTimeout <= 0 || a.unhurried {
+		return a.agent.Stop()
+	}
+
+	a.agent.Infow("Saving operator state before stopping", "timeout", a.stopTimeout.String())
+	return a.agent.StopWithin(a.stopTimeout)
+}
+
+// Reload will reload the config of the stanza agent. The agent keeps running
+// with its previous config if the reload fails.
+func (a *AgentService) Reload() {
+	a.agent.Info("Reloading stanza agent config")
+	if err := a.agent.Reload(); err != nil {
+		a.agent.Errorw("Failed to reload stanza agent config", zap.Any("error", err))
+		return
+	}
+	a.agent.Info("Stanza agent config reloaded")
 }
 
 // newAgentService creates a new agent service with the provided agent.
-func newAgentService(ctx context.Context, agent *agent.LogAgent, cancel context.CancelFunc) (service.Service, error) {
-	agentService := &AgentService{cancel, agent}
+// The agent saves the state of its operators before it drains the pipeline
+// when it must stop within stopTimeout, and stops as set by the policies
+// when it receives a signal.
+func newAgentService(ctx context.Context, agent *agent.LogAgent, cancel context.CancelFunc, stopTimeout time.Duration, policies signalPolicies) (service.Service, error) {
+	agentService := &AgentService{
+		cancel:      cancel,
+		agent:       agent,
+		stopTimeout: stopTimeout,
+		policies:    policies,
+		signals:     make(chan os.Signal, 3),
+	}
+	// Signals are received until the process exits, so that a signal
+	// received while the pipeline drains can force the agent to exit
+	signal.Notify(agentService.signals, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+
 	config := &service.Config{
 		Name:        "stanza",
 		DisplayName: "Stanza Log Agent",
 		Description: "Monitors and processes log entries",
 		Option: service.KeyValue{
 			"RunWait": func() {
-				var sigChan = make(chan os.Signal, 3)
-				signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
-				select {
-				case <-sigChan:
-				case <-ctx.Done():
+				for {
+					select {
+					case sig := <-agentService.signals:
+						if sig == syscall.SIGHUP {
+							agentService.Reload()
+							continue
+						}
+						agentService.stopSignal = sig
+						agentService.unhurried = sig == os.Interrupt
+						return
+					case <-agent.Done():
+						agent.Info("Operators completed. Stopping stanza agent")
+						agentService.unhurried = true
+						return
+					case <-ctx.Done():
+						agentService.unhurried = true
+						return
+					}
 				}
 			},
 		},
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// signalPolicy is how the agent stops when it receives a signal
+type signalPolicy string
+
+const (
+	// policyDrain drains the pipeline before the agent exits. Further
+	// signals with the same policy are ignored while it drains.
+	policyDrain signalPolicy = "drain"
+	// policyImmediate saves the state of the operators and exits without
+	// draining the pipeline
+	policyImmediate signalPolicy = "immediate"
+	// policyDrainThenImmediate drains the pipeline, unless a second signal
+	// is received while it drains, in which case the agent exits immediately
+	policyDrainThenImmediate signalPolicy = "drain_then_immediate"
+)
+
+// parseSignalPolicy parses the policy set by a flag
+func parseSignalPolicy(flag, value string) (signalPolicy, error) {
+	switch policy := signalPolicy(value); policy {
+	case policyDrain, policyImmediate, policyDrainThenImmediate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid value '%s' for --%s, expected one of %s, %s, or %s",
+			value, flag, policyDrain, policyImmediate, policyDrainThenImmediate)
+	}
+}
+
+// signalPolicies are the policies of the signals that stop the agent
+type signalPolicies struct {
+	sigterm signalPolicy
+	sigint  signalPolicy
+}
+
+// newSignalPolicies parses the policies set by --on_sigterm and --on_sigint
+func newSignalPolicies(sigterm, sigint string) (signalPolicies, error) {
+	var policies signalPolicies
+	var err error
+	if policies.sigterm, err = parseSignalPolicy("on_sigterm", sigterm); err != nil {
+		return policies, err
+	}
+	if policies.sigint, err = parseSignalPolicy("on_sigint", sigint); err != nil {
+		return policies, err
+	}
+	return policies, nil
+}
+
+// policy returns the policy of a signal. The agent drains when it is stopped
+// without a signal, such as by a service manager or when its operators
+// complete.
+func (p signalPolicies) policy(sig os.Signal) signalPolicy {
+	switch sig {
+	case syscall.SIGTERM:
+		return p.sigterm
+	case os.Interrupt:
+		return p.sigint
+	default:
+		return policyDrain
+	}
+}
+
+// drains returns true if the agent drains its pipeline when it is stopped by
+// the signal
+func (p signalPolicies) drains(sig os.Signal) bool {
+	return p.policy(sig) != policyImmediate
+}
+
+// forcesExit returns true if a signal received while the agent drains its
+// pipeline makes it exit immediately
+func (p signalPolicies) forcesExit(sig os.Signal) bool {
+	return p.policy(sig) != policyDrain
+}
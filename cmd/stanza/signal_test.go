@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSignalPolicies(t *testing.T) {
+	cases := []struct {
+		name     string
+		sigterm  string
+		sigint   string
+		expected signalPolicies
+		errorMsg string
+	}{
+		{"Defaults", "drain", "drain_then_immediate", signalPolicies{policyDrain, policyDrainThenImmediate}, ""},
+		{"Immediate", "immediate", "immediate", signalPolicies{policyImmediate, policyImmediate}, ""},
+		{"InvalidSigterm", "kill", "drain", signalPolicies{}, "--on_sigterm"},
+		{"InvalidSigint", "drain", "", signalPolicies{}, "--on_sigint"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policies, err := newSignalPolicies(tc.sigterm, tc.sigint)
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, policies)
+		})
+	}
+}
+
+func TestSignalPolicies(t *testing.T) {
+	defaults := signalPolicies{sigterm: policyDrain, sigint: policyDrainThenImmediate}
+	immediate := signalPolicies{sigterm: policyImmediate, sigint: policyImmediate}
+
+	cases := []struct {
+		name       string
+		policies   signalPolicies
+		signal     os.Signal
+		drains     bool
+		forcesExit bool
+	}{
+		{"DefaultSigterm", defaults, syscall.SIGTERM, true, false},
+		{"DefaultSigint", defaults, os.Interrupt, true, true},
+		{"ImmediateSigterm", immediate, syscall.SIGTERM, false, true},
+		{"ImmediateSigint", immediate, os.Interrupt, false, true},
+		{"Sighup", immediate, syscall.SIGHUP, true, false},
+		{"NoSignal", immediate, nil, true, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.drains, tc.policies.drains(tc.signal))
+			require.Equal(t, tc.forcesExit, tc.policies.forcesExit(tc.signal))
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/spf13/cobra"
+)
+
+// StatsFlags are the flags that can be supplied when running the stats command
+type StatsFlags struct {
+	Since time.Duration
+	JSON  bool
+}
+
+// NewStatsCmd returns the command for reading persisted operator stats
+func NewStatsCmd(rootFlags *RootFlags) *cobra.Command {
+	statsFlags := &StatsFlags{}
+
+	stats := &cobra.Command{
+		Use:   "stats",
+		Short: "Show the operator stats saved by the agent",
+		Long: "Show the operator stats saved by the agent. By default, the most recent snapshot is shown. " +
+			"With --since, the counters accumulated over that period are shown, including across restarts. " +
+			"Snapshots are only saved when the agent runs with --stats_interval",
+		Args: cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			db, err := database.OpenDatabase(rootFlags.DatabaseFile)
+			exitOnErr("Failed to open database", err)
+			defer db.Close()
+
+			err = runStats(stdout, db, statsFlags, time.Now())
+			exitOnErr("Failed to read stats", err)
+		},
+	}
+
+	stats.Flags().DurationVar(&statsFlags.Since, "since", 0, "show the counters accumulated over this period, such as 24h")
+	stats.Flags().BoolVar(&statsFlags.JSON, "json", false, "print the stats as JSON")
+
+	return stats
+}
+
+func runStats(out io.Writer, db database.Database, flags *StatsFlags, now time.Time) error {
+	var since time.Time
+	if flags.Since > 0 {
+		since = now.Add(-flags.Since)
+	}
+
+	snapshots, err := agent.ReadStatsSnapshots(db, since)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		_, err := io.WriteString(out, "No stats have been saved. Run the agent with --stats_interval to save stats\n")
+		return err
+	}
+
+	latest := snapshots[len(snapshots)-1]
+	operators := latest.Operators
+	if flags.Since > 0 {
+		operators = agent.SummarizeStats(snapshots, since)
+	}
+
+	if flags.JSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if flags.Since > 0 {
+			return enc.Encode(operators)
+		}
+		return enc.Encode(latest)
+	}
+
+	if flags.Since > 0 {
+		fmt.Fprintf(out, "Stats from %s to %s\n\n", snapshots[0].Timestamp.Format(time.RFC3339), latest.Timestamp.Format(time.RFC3339))
+		return writeStatsTable(out, operators)
+	}
+
+	fmt.Fprintf(out, "Stats at %s, agent started at %s\n\n", latest.Timestamp.Format(time.RFC3339), latest.Started.Format(time.RFC3339))
+	if err := writeStatsTable(out, operators); err != nil {
+		return err
+	}
+	if len(latest.Counters) > 0 {
+		fmt.Fprintln(out)
+		if err := writeCountersTable(out, "OPERATOR", latest.Counters); err != nil {
+			return err
+		}
+	}
+	if len(latest.Throttles) > 0 {
+		fmt.Fprintln(out)
+		if err := writeCountersTable(out, "THROTTLE", latest.Throttles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStatsTable writes the counters of each operator as an aligned table
+func writeStatsTable(out io.Writer, operators map[string]helper.OperatorStats) error {
+	ids := make([]string, 0, len(operators))
+	for id := range operators {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATOR\tIN\tOUT\tDROPPED\tERRORED\tBYTES")
+	for _, id := range ids {
+		stats := operators[id]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", id, stats.EntriesIn, stats.EntriesOut, stats.Dropped, stats.Errored, stats.Bytes)
+	}
+	return w.Flush()
+}
+
+// writeCountersTable writes the named counters of each operator or throttle as
+// an aligned table
+func writeCountersTable(out io.Writer, header string, counters map[string]map[string]uint64) error {
+	ids := make([]string, 0, len(counters))
+	for id := range counters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCOUNTER\tVALUE\n", header)
+	for _, id := range ids {
+		names := make([]string, 0, len(counters[id]))
+		for name := range counters[id] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", id, name, counters[id][name])
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	databasePath := filepath.Join(tempDir, "logagent.db")
+	configPath := filepath.Join(tempDir, "config.yaml")
+	ioutil.WriteFile(configPath, []byte{}, 0666)
+
+	// capture stdout
+	buf := bytes.NewBuffer([]byte{})
+	stdout = buf
+
+	runStatsCmd := func(args ...string) {
+		buf.Reset()
+		cmd := NewRootCmd()
+		cmd.SetArgs(append([]string{"stats", "--database", databasePath, "--config", configPath}, args...))
+		require.NoError(t, cmd.Execute())
+	}
+
+	runStatsCmd()
+	require.Contains(t, buf.String(), "No stats have been saved")
+
+	// save snapshots from two runs of the agent
+	db, err := database.OpenDatabase(databasePath)
+	require.NoError(t, err)
+	now := time.Now()
+	firstRun := now.Add(-3 * time.Hour)
+	secondRun := now.Add(-time.Hour)
+	for _, snapshot := range []*agent.StatsSnapshot{
+		{Timestamp: now.Add(-150 * time.Minute), Started: firstRun, Operators: map[string]helper.OperatorStats{
+			"$.file_input": {EntriesOut: 100, Bytes: 10000},
+		}},
+		{Timestamp: now.Add(-90 * time.Minute), Started: firstRun, Operators: map[string]helper.OperatorStats{
+			"$.file_input": {EntriesOut: 150, Bytes: 15000},
+		}},
+		{Timestamp: now.Add(-30 * time.Minute), Started: secondRun, Operators: map[string]helper.OperatorStats{
+			"$.file_input": {EntriesOut: 20, Bytes: 2000},
+			"$.stdout":     {EntriesIn: 20, Errored: 1},
+		}, Counters: map[string]map[string]uint64{
+			"$.router": {"json": 15, "default": 5},
+		}, Throttles: map[string]map[string]uint64{
+			"replay": {"entries": 20, "entries_throttled": 4},
+		}},
+	} {
+		require.NoError(t, agent.SaveStatsSnapshot(db, snapshot, 0))
+	}
+	require.NoError(t, db.Close())
+
+	// the latest snapshot is shown by default
+	runStatsCmd()
+	require.Contains(t, buf.String(), "OPERATOR      IN  OUT  DROPPED  ERRORED  BYTES\n")
+	require.Contains(t, buf.String(), "$.file_input  0   20   0        0        2000\n")
+	require.Contains(t, buf.String(), "$.stdout      20  0    0        1        0\n")
+	require.Contains(t, buf.String(), "OPERATOR  COUNTER  VALUE\n")
+	require.Contains(t, buf.String(), "$.router  default  5\n")
+	require.Contains(t, buf.String(), "$.router  json     15\n")
+	require.Contains(t, buf.String(), "THROTTLE  COUNTER            VALUE\n")
+	require.Contains(t, buf.String(), "replay    entries_throttled  4\n")
+
+	// counters are accumulated across restarts
+	runStatsCmd("--since", "2h", "--json")
+	var summary map[string]helper.OperatorStats
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &summary))
+	require.Equal(t, helper.OperatorStats{EntriesOut: 20, Bytes: 2000}, summary["$.file_input"])
+
+	runStatsCmd("--since", "3h", "--json")
+	summary = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &summary))
+	require.Equal(t, helper.OperatorStats{EntriesOut: 70, Bytes: 7000}, summary["$.file_input"])
+	require.Equal(t, helper.OperatorStats{EntriesIn: 20, Errored: 1}, summary["$.stdout"])
+}
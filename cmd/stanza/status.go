@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/spf13/cobra"
+)
+
+// statusTimeout is the time to wait for a running agent to serve its status
+const statusTimeout = 5 * time.Second
+
+// NewStatusCmd returns the command for reading the status of a running agent
+func NewStatusCmd(rootFlags *RootFlags) *cobra.Command {
+	var jsonOutput bool
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of a running agent",
+		Long: "Show the status of a running agent and of each operator in its pipeline. " +
+			"The status is read from the HTTP endpoint of the agent, so --http_addr must match the address the agent listens on",
+		Args: cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			client := &http.Client{Timeout: statusTimeout}
+			err := runStatus(stdout, client, rootFlags.HTTPAddr, jsonOutput)
+			exitOnErr("Failed to read status", err)
+		},
+	}
+
+	status.Flags().BoolVar(&jsonOutput, "json", false, "print the status as JSON")
+
+	return status
+}
+
+func runStatus(out io.Writer, client *http.Client, addr string, jsonOutput bool) error {
+	status, err := fetchStatus(client, addr)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+
+	if status.Running {
+		fmt.Fprintf(out, "Agent running for %s, started at %s\n\n", status.Uptime.Raw(), status.Started.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(out, "Agent is not running\n\n")
+	}
+
+	if remote := status.RemoteConfig; remote != nil {
+		if remote.AppliedHash != "" && remote.AppliedAt != nil {
+			fmt.Fprintf(out, "Remote config %s applied at %s from %s\n", remote.AppliedHash, remote.AppliedAt.Format(time.RFC3339), remote.URL)
+		} else {
+			fmt.Fprintf(out, "Remote config not applied from %s\n", remote.URL)
+		}
+		if remote.Error != "" {
+			fmt.Fprintf(out, "Remote config failed to update: %s\n", remote.Error)
+		}
+		fmt.Fprintln(out)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATOR\tTYPE\tSTARTED\tIN\tOUT\tDROPPED\tERRORED")
+	for _, op := range status.Operators {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%d\t%d\t%d\t%d\n", op.ID, op.Type, op.Started, op.EntriesIn, op.EntriesOut, op.Dropped, op.Errored)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := writeBufferStatus(out, status.Operators); err != nil {
+		return err
+	}
+	return writeBackpressureStatus(out, status.Operators)
+}
+
+// fetchStatus reads the status of the agent listening on an address
+func fetchStatus(client *http.Client, addr string) (*agent.Status, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("--http_addr is required to reach the running agent")
+	}
+
+	res, err := client.Get(statusURL(addr))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent responded with %s", res.Status)
+	}
+
+	status := &agent.Status{}
+	if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("decode status: %s", err)
+	}
+	return status, nil
+}
+
+// writeBufferStatus writes a table of the depth of the buffer of each output
+// that has one. Memory buffers have a capacity in entries, and disk buffers
+// in bytes.
+func writeBufferStatus(out io.Writer, operators []operator.OperatorStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	wroteHeader := false
+	for _, op := range operators {
+		raw, ok := op.Details["buffer"]
+		if !ok {
+			continue
+		}
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		var stats buffer.Stats
+		if err := json.Unmarshal(encoded, &stats); err != nil {
+			return fmt.Errorf("decode buffer status of %s: %s", op.ID, err)
+		}
+
+		if !wroteHeader {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "BUFFER\tTYPE\tENTRIES\tCAPACITY\tBYTES\tFILE BYTES\tADDED\tFLUSHED\tDROPPED")
+			wroteHeader = true
+		}
+		capacity := stats.MaxEntries
+		if stats.Type == "disk" {
+			capacity = stats.MaxBytes
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", op.ID, stats.Type, stats.Entries, capacity,
+			stats.Bytes, stats.FileBytes, stats.Added, stats.Flushed, stats.Dropped)
+	}
+	return w.Flush()
+}
+
+// writeBackpressureStatus writes a table of the sampled blocked time ratio of
+// each edge, if the agent samples back-pressure
+func writeBackpressureStatus(out io.Writer, operators []operator.OperatorStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	wroteHeader := false
+	for _, op := range operators {
+		outputIDs := make([]string, 0, len(op.Backpressure))
+		for outputID := range op.Backpressure {
+			outputIDs = append(outputIDs, outputID)
+		}
+		sort.Strings(outputIDs)
+
+		for _, outputID := range outputIDs {
+			if !wroteHeader {
+				fmt.Fprintln(w)
+				fmt.Fprintln(w, "FROM\tTO\tBLOCKED")
+				wroteHeader = true
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\n", op.ID, outputID, op.Backpressure[outputID]*100)
+		}
+	}
+	return w.Flush()
+}
+
+// statusURL returns the URL of the status endpoint of an agent listening on
+// an address. An address that listens on every interface is reached locally.
+func statusURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Sprintf("http://%s/status", addr)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s/status", net.JoinHostPort(host, port))
+}
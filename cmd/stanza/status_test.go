@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	status := &agent.Status{
+		Running: true,
+		Started: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		Uptime:  helper.NewDuration(90 * time.Second),
+		Operators: []operator.OperatorStatus{
+			{ID: "$.file_input", Type: "file_input", Started: true, EntriesOut: 10},
+			{ID: "$.stdout", Type: "stdout", Started: true, EntriesIn: 10, Dropped: 2, Errored: 1},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/status", r.URL.Path)
+		require.NoError(t, json.NewEncoder(w).Encode(status))
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, runStatus(buf, server.Client(), addr, false))
+	require.Contains(t, buf.String(), "Agent running for 1m30s, started at 2020-10-01T00:00:00Z")
+	require.Regexp(t, `\$\.file_input\s+file_input\s+true\s+0\s+10\s+0\s+0`, buf.String())
+	require.Regexp(t, `\$\.stdout\s+stdout\s+true\s+10\s+0\s+2\s+1`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, runStatus(buf, server.Client(), addr, true))
+	decoded := &agent.Status{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), decoded))
+	require.Equal(t, status.Operators, decoded.Operators)
+}
+
+func TestStatusRemoteConfig(t *testing.T) {
+	appliedAt := time.Date(2020, 10, 1, 0, 5, 0, 0, time.UTC)
+	status := &agent.Status{
+		Running: true,
+		RemoteConfig: &agent.RemoteConfigStatus{
+			URL:         "https://config.example.com/stanza.yaml",
+			AppliedHash: "abc123",
+			AppliedAt:   &appliedAt,
+			Error:       "fetch remote config: server responded with 503 Service Unavailable",
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(status))
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, runStatus(buf, server.Client(), strings.TrimPrefix(server.URL, "http://"), false))
+	require.Contains(t, buf.String(), "Remote config abc123 applied at 2020-10-01T00:05:00Z from https://config.example.com/stanza.yaml")
+	require.Contains(t, buf.String(), "Remote config failed to update: fetch remote config: server responded with 503")
+}
+
+func TestStatusBuffers(t *testing.T) {
+	status := &agent.Status{
+		Running: true,
+		Operators: []operator.OperatorStatus{
+			{ID: "$.elastic_output", Type: "elastic_output", Started: true, Details: map[string]interface{}{
+				"buffer": &buffer.Stats{Type: "disk", Entries: 5, MaxBytes: 1000, Bytes: 200, FileBytes: 500, Added: 8, Flushed: 3},
+			}},
+			{ID: "$.newrelic_output", Type: "newrelic_output", Started: true, Details: map[string]interface{}{
+				"buffer": &buffer.Stats{Type: "memory", Entries: 2, MaxEntries: 10, Added: 14, Flushed: 10, Dropped: 2},
+			}},
+			{ID: "$.stdout", Type: "stdout", Started: true},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(status))
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, runStatus(buf, server.Client(), strings.TrimPrefix(server.URL, "http://"), false))
+	require.Contains(t, buf.String(), "BUFFER")
+	require.Regexp(t, `\$\.elastic_output\s+disk\s+5\s+1000\s+200\s+500\s+8\s+3\s+0\n`, buf.String())
+	require.Regexp(t, `\$\.newrelic_output\s+memory\s+2\s+10\s+0\s+0\s+14\s+10\s+2\n`, buf.String())
+
+	// The table is left out when no output has a buffer
+	status.Operators = status.Operators[2:]
+	buf.Reset()
+	require.NoError(t, runStatus(buf, server.Client(), strings.TrimPrefix(server.URL, "http://"), false))
+	require.NotContains(t, buf.String(), "BUFFER")
+}
+
+func TestStatusBackpressure(t *testing.T) {
+	status := &agent.Status{
+		Running: true,
+		Operators: []operator.OperatorStatus{
+			{ID: "$.file_input", Type: "file_input", Started: true, Backpressure: map[string]float64{"$.router": 0.125}},
+			{ID: "$.router", Type: "router", Started: true, Backpressure: map[string]float64{"$.stdout": 0, "$.elastic": 0.75}},
+			{ID: "$.stdout", Type: "stdout", Started: true},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(status))
+	}))
+	defer server.Close()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, runStatus(buf, server.Client(), strings.TrimPrefix(server.URL, "http://"), false))
+	require.Regexp(t, `FROM\s+TO\s+BLOCKED\n\$\.file_input\s+\$\.router\s+12\.5%\n\$\.router\s+\$\.elastic\s+75\.0%\n\$\.router\s+\$\.stdout\s+0\.0%\n`, buf.String())
+
+	// The table is left out when the agent does not sample back-pressure
+	status.Operators = status.Operators[2:]
+	buf.Reset()
+	require.NoError(t, runStatus(buf, server.Client(), strings.TrimPrefix(server.URL, "http://"), false))
+	require.NotContains(t, buf.String(), "BLOCKED")
+}
+
+func TestStatusErrors(t *testing.T) {
+	err := runStatus(&bytes.Buffer{}, http.DefaultClient, "", false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--http_addr is required")
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	err = runStatus(&bytes.Buffer{}, server.Client(), strings.TrimPrefix(server.URL, "http://"), false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "agent responded with 404")
+}
+
+func TestStatusURL(t *testing.T) {
+	cases := []struct {
+		addr     string
+		expected string
+	}{
+		{":8080", "http://localhost:8080/status"},
+		{"0.0.0.0:8080", "http://localhost:8080/status"},
+		{"[::]:8080", "http://localhost:8080/status"},
+		{"127.0.0.1:8080", "http://127.0.0.1:8080/status"},
+		{"[::1]:8080", "http://[::1]:8080/status"},
+		{"localhost", "http://localhost/status"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.addr, func(t *testing.T) {
+			require.Equal(t, tc.expected, statusURL(tc.addr))
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+// stopTimeout returns the time the agent has to stop before it is killed when
+// a service manager stops it. A timeout set with --stop_timeout is used as is.
+// Otherwise, it is detected from the service manager running the agent, or is
+// zero if the agent is not run by one.
+func stopTimeout(flagTimeout time.Duration) time.Duration {
+	if flagTimeout > 0 {
+		return flagTimeout
+	}
+	if service.Interactive() {
+		return 0
+	}
+	return detectStopTimeout()
+}
@@ -0,0 +1,22 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// defaultSystemdStopTimeout is the time systemd waits for a unit to stop
+// after SIGTERM, unless the unit sets TimeoutStopSec
+const defaultSystemdStopTimeout = 90 * time.Second
+
+// detectStopTimeout returns the time systemd waits for the agent to stop
+// before it kills it, if the agent is run by systemd. systemd sets
+// INVOCATION_ID in the environment of the units it starts.
+func detectStopTimeout() time.Duration {
+	if os.Getenv("INVOCATION_ID") == "" {
+		return 0
+	}
+	return defaultSystemdStopTimeout
+}
@@ -0,0 +1,35 @@
+// +build windows
+
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// defaultServiceKillTimeout is the time the service control manager waits for
+// services to stop at shutdown when it is not configured in the registry
+const defaultServiceKillTimeout = 5 * time.Second
+
+// detectStopTimeout returns the time the service control manager waits for
+// services to stop before it kills them
+func detectStopTimeout() time.Duration {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control`, registry.QUERY_VALUE)
+	if err != nil {
+		return defaultServiceKillTimeout
+	}
+	defer key.Close()
+
+	value, _, err := key.GetStringValue("WaitToKillServiceTimeout")
+	if err != nil {
+		return defaultServiceKillTimeout
+	}
+
+	millis, err := strconv.Atoi(value)
+	if err != nil || millis <= 0 {
+		return defaultServiceKillTimeout
+	}
+	return time.Duration(millis) * time.Millisecond
+}
@@ -0,0 +1,9 @@
+// +build tzdata
+
+package main
+
+import (
+	// Embed the time zone database, for container images that do not have
+	// one, such as those built from scratch
+	_ "time/tzdata"
+)
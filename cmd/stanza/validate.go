@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/observiq/stanza/agent"
+	"github.com/observiq/stanza/database"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/plugin"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ValidateFlags are the flags that can be supplied when running the validate command
+type ValidateFlags struct {
+	*RootFlags
+
+	JSON         bool
+	CheckOutputs bool
+	CheckTimeout time.Duration
+}
+
+// NewValidateCmd creates a command that checks that a config builds
+func NewValidateCmd(rootFlags *RootFlags) *cobra.Command {
+	flags := &ValidateFlags{RootFlags: rootFlags}
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Check that the config builds, without starting the agent",
+		Long: `Load the config files and plugins, and build each operator and the pipeline they
+make, without starting them. No file is read, no port is bound, and the database
+is not opened. Exits with 1 and lists each error if the config does not build.
+
+The sample inputs in the expect block of each operator are then sent to the
+operator, built on its own, and the entries it writes are compared to the
+expected fields. Exits with 1 and lists each expectation that fails.
+
+With --check_outputs, each output that supports it also checks that it can
+reach its destination, without starting any input or sending any entries.
+Exits with 1 if any of these checks fail.`,
+		Args: cobra.NoArgs,
+		Run: func(command *cobra.Command, args []string) {
+			logger := newDefaultLoggerAt(zapcore.WarnLevel, "")
+			defer func() {
+				_ = logger.Sync()
+			}()
+
+			cfg, problems := validateConfig(flags.ConfigFiles, flags.PluginDir, logger)
+
+			var checks []outputCheck
+			if flags.CheckOutputs && len(problems) == 0 {
+				buildContext := operator.NewBuildContext(database.NewStubDatabase(), logger)
+				pipeline, err := cfg.BuildPipeline(buildContext, nil)
+				exitOnErr("Failed to build pipeline", err)
+				checks = checkOutputs(context.Background(), pipeline.Operators(), flags.CheckTimeout)
+			}
+
+			err := writeValidation(stdout, problems, checks, flags.JSON)
+			exitOnErr("Failed to write validation result", err)
+			if len(problems) > 0 || anyCheckFailed(checks) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	validate.Flags().BoolVar(&flags.JSON, "json", false, "write the result as JSON")
+	validate.Flags().BoolVar(&flags.CheckOutputs, "check_outputs", false, "check that each output can reach its destination")
+	validate.Flags().DurationVar(&flags.CheckTimeout, "check_timeout", 10*time.Second, "the time to wait for the check of each output")
+	return validate
+}
+
+// validationError is an error that keeps a config from building
+type validationError struct {
+	Pipeline   string `json:"pipeline,omitempty"`
+	OperatorID string `json:"operator_id,omitempty"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// String returns the error with the pipeline and operator it belongs to
+func (e validationError) String() string {
+	message := e.Message
+	if e.OperatorID != "" {
+		message = fmt.Sprintf("%s: %s", e.OperatorID, message)
+	}
+	if e.Pipeline != "" {
+		message = fmt.Sprintf("pipeline %s: %s", e.Pipeline, message)
+	}
+	return message
+}
+
+// validateConfig loads the config files and plugins, builds the pipeline
+// against a stub database without starting it, and runs the expectations of
+// its operators. It returns the config and each error found.
+func validateConfig(configFiles []string, pluginDir string, logger *zap.SugaredLogger) (*agent.Config, []validationError) {
+	if err := plugin.RegisterPlugins(pluginDir, operator.DefaultRegistry); err != nil {
+		return nil, []validationError{newValidationError(errors.Wrap(err, "register plugins"))}
+	}
+
+	cfg, err := agent.NewConfigFromGlobs(configFiles)
+	if err != nil {
+		return nil, []validationError{newValidationError(err)}
+	}
+
+	buildContext := operator.NewBuildContext(database.NewStubDatabase(), logger)
+	problems := make([]validationError, 0)
+	for _, err := range cfg.Validate(buildContext) {
+		problems = append(problems, newValidationError(err))
+	}
+	if len(problems) > 0 {
+		return cfg, problems
+	}
+
+	// Expectations are only run once every operator builds, so that an
+	// operator that fails to build is not reported twice
+	for _, err := range cfg.CheckExpectations(buildContext) {
+		problems = append(problems, newValidationError(err))
+	}
+	return cfg, problems
+}
+
+// The statuses of an output check
+const (
+	checkPassed       = "passed"
+	checkFailed       = "failed"
+	checkNotSupported = "not_supported"
+)
+
+// outputCheck is the result of checking that an output can reach its destination
+type outputCheck struct {
+	OperatorID string `json:"operator_id"`
+	Status     string `json:"status"`
+	Latency    string `json:"latency,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// String returns the result of the check with the output it belongs to
+func (c outputCheck) String() string {
+	switch c.Status {
+	case checkPassed:
+		return fmt.Sprintf("%s: %s in %s", c.OperatorID, c.Status, c.Latency)
+	case checkFailed:
+		return fmt.Sprintf("%s: %s in %s: %s", c.OperatorID, c.Status, c.Latency, c.Error)
+	default:
+		return fmt.Sprintf("%s: not supported", c.OperatorID)
+	}
+}
+
+// checkOutputs runs the connectivity check of each output of a pipeline
+// that was built but not started, in order of operator ID
+func checkOutputs(ctx context.Context, operators []operator.Operator, timeout time.Duration) []outputCheck {
+	outputs := make([]operator.Operator, 0, len(operators))
+	for _, op := range operators {
+		if op.CanProcess() && !op.CanOutput() {
+			outputs = append(outputs, op)
+		}
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].ID() < outputs[j].ID()
+	})
+
+	checks := make([]outputCheck, 0, len(outputs))
+	for _, output := range outputs {
+		check := outputCheck{OperatorID: output.ID()}
+		checker, ok := output.(helper.ConnectivityChecker)
+		if !ok {
+			check.Status = checkNotSupported
+			checks = append(checks, check)
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := checker.ConnectivityCheck(checkCtx)
+		check.Latency = time.Since(start).Round(time.Millisecond).String()
+		cancel()
+
+		if err != nil {
+			check.Status = checkFailed
+			check.Error = err.Error()
+		} else {
+			check.Status = checkPassed
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// anyCheckFailed returns true if any output failed its check
+func anyCheckFailed(checks []outputCheck) bool {
+	for _, check := range checks {
+		if check.Status == checkFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// newValidationError creates a validation error from an error, taking the
+// pipeline and operator from its details
+func newValidationError(err error) validationError {
+	agentErr, ok := err.(errors.AgentError)
+	if !ok {
+		return validationError{Message: err.Error()}
+	}
+
+	details := make(errors.ErrorDetails, len(agentErr.Details))
+	for key, value := range agentErr.Details {
+		details[key] = value
+	}
+	problem := validationError{
+		Pipeline:   details["pipeline"],
+		OperatorID: details["operator_id"],
+		Suggestion: agentErr.Suggestion,
+	}
+	delete(details, "pipeline")
+	delete(details, "operator_id")
+	problem.Message = errors.NewError(agentErr.Description, "", flatten(details)...).Error()
+	return problem
+}
+
+// flatten returns the keys and values of error details as a list
+func flatten(details errors.ErrorDetails) []string {
+	keyValues := make([]string, 0, len(details)*2)
+	for key, value := range details {
+		keyValues = append(keyValues, key, value)
+	}
+	return keyValues
+}
+
+// writeValidation writes the result of a validation and of the output
+// checks, if any, as text or as JSON
+func writeValidation(out io.Writer, problems []validationError, checks []outputCheck, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Valid   bool              `json:"valid"`
+			Errors  []validationError `json:"errors"`
+			Outputs []outputCheck     `json:"outputs,omitempty"`
+		}{len(problems) == 0, problems, checks})
+	}
+
+	if len(problems) == 0 {
+		if _, err := fmt.Fprintln(out, "Config is valid"); err != nil {
+			return err
+		}
+		return writeOutputChecks(out, checks)
+	}
+	if _, err := fmt.Fprintln(out, "Config is invalid:"); err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		if _, err := fmt.Fprintf(out, "  %s\n", problem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutputChecks writes the result of each output check as text
+func writeOutputChecks(out io.Writer, checks []outputCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(out, "Outputs:"); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if _, err := fmt.Fprintf(out, "  %s\n", check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
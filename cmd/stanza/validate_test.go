@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected []validationError
+	}{
+		{
+			"Valid",
+			`
+pipeline:
+  - type: tcp_input
+    listen_address: 127.0.0.1:0
+  - type: regex_parser
+    regex: '^(?P<message>.*)$'
+  - type: drop_output
+`,
+			[]validationError{},
+		},
+		{
+			"UnknownType",
+			`
+pipeline:
+  - type: generate_input
+    entry:
+      record: test
+  - type: missing_output
+`,
+			[]validationError{{Message: "unsupported type 'missing_output'"}},
+		},
+		{
+			"BadOutput",
+			`
+pipeline:
+  - type: generate_input
+    entry:
+      record: test
+    output: parser
+  - type: drop_output
+`,
+			[]validationError{{OperatorID: "$.generate_input", Message: "operator '$.parser' does not exist"}},
+		},
+		{
+			"EachOperatorError",
+			`
+pipeline:
+  - type: generate_input
+    entry:
+      record: test
+  - id: first
+    type: regex_parser
+    regex: '('
+  - id: second
+    type: regex_parser
+  - type: drop_output
+`,
+			[]validationError{
+				{OperatorID: "$.first", Message: "compiling regex: error parsing regexp: missing closing ): `(`"},
+				{OperatorID: "$.second", Message: "missing required field 'regex'"},
+			},
+		},
+		{
+			"NamedPipeline",
+			`
+pipelines:
+  app:
+    - type: generate_input
+      entry:
+        record: test
+      output: parser
+    - type: drop_output
+`,
+			[]validationError{{Pipeline: "app", OperatorID: "$.app.generate_input", Message: "operator '$.app.parser' does not exist"}},
+		},
+		{
+			"Expect",
+			`
+pipeline:
+  - type: generate_input
+    entry:
+      record: test
+  - id: parser
+    type: regex_parser
+    regex: '^(?P<level>\w+) (?P<message>.*)$'
+    expect:
+      - name: info
+        input: INFO started
+        fields:
+          level: INFO
+          message: started
+          $labels.env: null
+  - type: drop_output
+`,
+			[]validationError{},
+		},
+		{
+			"ExpectFailure",
+			`
+pipelines:
+  app:
+    - type: generate_input
+      entry:
+        record: test
+    - id: parser
+      type: regex_parser
+      regex: '^(?P<level>\w+) (?P<message>.*)$'
+      expect:
+        - name: info
+          input: INFO started
+          fields:
+            level: WARN
+            message: started
+        - input: started
+          fields:
+            message: started
+    - type: drop_output
+`,
+			[]validationError{
+				{Pipeline: "app", OperatorID: "$.app.parser", Message: `expect case 'info' failed: level: expected "WARN", got "INFO"`},
+				{Pipeline: "app", OperatorID: "$.app.parser", Message: `message: expected "started", got no value`},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(testutil.NewTempDir(t), "config.yaml")
+			require.NoError(t, ioutil.WriteFile(configPath, []byte(tc.config), 0666))
+
+			// The message of an error is checked by its end, since an error
+			// that fails to load the config starts with its path
+			_, problems := validateConfig([]string{configPath}, testutil.NewTempDir(t), zap.NewNop().Sugar())
+			require.Len(t, problems, len(tc.expected))
+			for i, expected := range tc.expected {
+				require.Equal(t, expected.Pipeline, problems[i].Pipeline)
+				require.Equal(t, expected.OperatorID, problems[i].OperatorID)
+				require.True(t, strings.HasSuffix(problems[i].Message, expected.Message), problems[i].Message)
+			}
+		})
+	}
+}
+
+func TestWriteValidation(t *testing.T) {
+	problems := []validationError{
+		{Pipeline: "app", OperatorID: "$.app.generate_input", Message: "operator '$.app.parser' does not exist"},
+		{Message: "failed to read config"},
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, writeValidation(&out, problems, nil, false))
+		expected := "Config is invalid:\n" +
+			"  pipeline app: $.app.generate_input: operator '$.app.parser' does not exist\n" +
+			"  failed to read config\n"
+		require.Equal(t, expected, out.String())
+
+		out.Reset()
+		require.NoError(t, writeValidation(&out, []validationError{}, nil, false))
+		require.Equal(t, "Config is valid\n", out.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, writeValidation(&out, problems, nil, true))
+
+		var result struct {
+			Valid  bool              `json:"valid"`
+			Errors []validationError `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+		require.False(t, result.Valid)
+		require.Equal(t, problems, result.Errors)
+
+		out.Reset()
+		require.NoError(t, writeValidation(&out, []validationError{}, nil, true))
+		require.JSONEq(t, `{"valid": true, "errors": []}`, out.String())
+	})
+}
+
+type checkedOperator struct {
+	*testutil.Operator
+	err error
+}
+
+func (o checkedOperator) ConnectivityCheck(ctx context.Context) error {
+	return o.err
+}
+
+func newCheckOperator(id string, canOutput bool) *testutil.Operator {
+	op := &testutil.Operator{}
+	op.On("ID").Return(id)
+	op.On("CanProcess").Return(true)
+	op.On("CanOutput").Return(canOutput)
+	return op
+}
+
+func TestCheckOutputs(t *testing.T) {
+	operators := []operator.Operator{
+		checkedOperator{newCheckOperator("parser", true), nil},
+		checkedOperator{newCheckOperator("unreachable", false), fmt.Errorf("connection refused")},
+		newCheckOperator("stdout", false),
+		checkedOperator{newCheckOperator("elastic", false), nil},
+	}
+
+	checks := checkOutputs(context.Background(), operators, time.Second)
+	require.Len(t, checks, 3)
+
+	require.Equal(t, "elastic", checks[0].OperatorID)
+	require.Equal(t, checkPassed, checks[0].Status)
+	require.NotEmpty(t, checks[0].Latency)
+	require.Empty(t, checks[0].Error)
+
+	require.Equal(t, outputCheck{OperatorID: "stdout", Status: checkNotSupported}, checks[1])
+
+	require.Equal(t, "unreachable", checks[2].OperatorID)
+	require.Equal(t, checkFailed, checks[2].Status)
+	require.NotEmpty(t, checks[2].Latency)
+	require.Equal(t, "connection refused", checks[2].Error)
+
+	require.True(t, anyCheckFailed(checks))
+	require.False(t, anyCheckFailed(checks[:2]))
+}
+
+func TestWriteOutputChecks(t *testing.T) {
+	checks := []outputCheck{
+		{OperatorID: "elastic", Status: checkPassed, Latency: "12ms"},
+		{OperatorID: "stdout", Status: checkNotSupported},
+		{OperatorID: "unreachable", Status: checkFailed, Latency: "3ms", Error: "connection refused"},
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, writeValidation(&out, []validationError{}, checks, false))
+		expected := "Config is valid\n" +
+			"Outputs:\n" +
+			"  elastic: passed in 12ms\n" +
+			"  stdout: not supported\n" +
+			"  unreachable: failed in 3ms: connection refused\n"
+		require.Equal(t, expected, out.String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, writeValidation(&out, []validationError{}, checks, true))
+
+		var result struct {
+			Valid   bool          `json:"valid"`
+			Outputs []outputCheck `json:"outputs"`
+		}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+		require.True(t, result.Valid)
+		require.Equal(t, checks, result.Outputs)
+	})
+}
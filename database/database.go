@@ -59,5 +59,34 @@ func OpenDatabase(file string) (Database, error) {
 	}
 
 	options := &bbolt.Options{Timeout: 1 * time.Second}
-	return bbolt.Open(file, 0666, options)
+	return open(file, options)
+}
+
+// OpenDatabaseReadOnly will open an existing database without modifying it.
+// Several processes can open a database read-only at the same time, but not
+// while it is open for writing, such as by a running agent.
+func OpenDatabaseReadOnly(file string) (Database, error) {
+	if file == "" {
+		return nil, fmt.Errorf("no database file specified")
+	}
+
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+
+	options := &bbolt.Options{Timeout: 1 * time.Second, ReadOnly: true}
+	return open(file, options)
+}
+
+// open opens a bbolt database. Only one process can open a database for
+// writing, so opening fails with a timeout while another process holds it.
+func open(file string, options *bbolt.Options) (Database, error) {
+	db, err := bbolt.Open(file, 0666, options)
+	if err == bbolt.ErrTimeout {
+		return nil, fmt.Errorf("database '%s' is locked by another process, such as a running agent", file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
 )
 
 // NewTempDir will return a new temp directory for testing
@@ -73,6 +74,56 @@ func TestOpenDatabase(t *testing.T) {
 
 }
 
+func TestOpenDatabaseReadOnly(t *testing.T) {
+	t.Run("Simple", func(t *testing.T) {
+		tempDir := NewTempDir(t)
+		file := filepath.Join(tempDir, "test.db")
+		db, err := OpenDatabase(file)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		db, err = OpenDatabaseReadOnly(file)
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Update(func(tx *bbolt.Tx) error { return nil })
+		require.Error(t, err)
+	})
+
+	t.Run("NoFile", func(t *testing.T) {
+		db, err := OpenDatabaseReadOnly("")
+		require.Error(t, err)
+		require.Nil(t, db)
+	})
+
+	t.Run("NonexistentFileIsNotCreated", func(t *testing.T) {
+		tempDir := NewTempDir(t)
+		file := filepath.Join(tempDir, "test.db")
+		db, err := OpenDatabaseReadOnly(file)
+		require.Error(t, err)
+		require.Nil(t, db)
+		require.NoFileExists(t, file)
+	})
+}
+
+func TestOpenDatabaseLocked(t *testing.T) {
+	tempDir := NewTempDir(t)
+	file := filepath.Join(tempDir, "test.db")
+	db, err := OpenDatabase(file)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// bbolt locks the database per open file description, so a second open
+	// in the same process is blocked the same as one in another process
+	_, err = OpenDatabase(file)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is locked by another process")
+
+	_, err = OpenDatabaseReadOnly(file)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is locked by another process")
+}
+
 func TestStubDatabase(t *testing.T) {
 	stubDatabase := NewStubDatabase()
 	err := stubDatabase.Close()
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// WriteBehind stages the writes of many writers in memory, and commits them
+// to a database in a single transaction per interval. Writes staged since the
+// last commit are lost if the process exits without stopping the WriteBehind,
+// so at most one interval of writes is lost in a crash.
+type WriteBehind struct {
+	db       Database
+	interval time.Duration
+
+	mux      sync.Mutex
+	current  *batch
+	inflight *batch
+	running  bool
+
+	// commitMux keeps commits in order, so that a batch is never committed
+	// after a newer batch that writes the same key
+	commitMux  sync.Mutex
+	checkpoint chan chan error
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// batch is the writes committed in a single transaction
+type batch struct {
+	buckets map[string]*stagedBucket
+	done    chan struct{}
+	err     error
+}
+
+// stagedBucket is the values staged for a bucket, nested under the buckets
+// of its path
+type stagedBucket struct {
+	path   [][]byte
+	values map[string][]byte
+}
+
+func newBatch() *batch {
+	return &batch{
+		buckets: make(map[string]*stagedBucket),
+		done:    make(chan struct{}),
+	}
+}
+
+// NewWriteBehind creates a new WriteBehind that commits to a database every interval
+func NewWriteBehind(db Database, interval time.Duration) *WriteBehind {
+	return &WriteBehind{
+		db:         db,
+		interval:   interval,
+		current:    newBatch(),
+		checkpoint: make(chan chan error),
+	}
+}
+
+// Start starts the goroutine that commits the staged writes
+func (w *WriteBehind) Start() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.running {
+		return
+	}
+	w.running = true
+	w.stop = make(chan struct{})
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run()
+	}()
+}
+
+// Stop commits the staged writes and stops the goroutine that commits them.
+// Writes staged after Stop are committed by Sync and Checkpoint.
+func (w *WriteBehind) Stop() error {
+	w.mux.Lock()
+	if !w.running {
+		w.mux.Unlock()
+		return w.commit()
+	}
+	w.running = false
+	close(w.stop)
+	w.mux.Unlock()
+
+	w.wg.Wait()
+	return w.commit()
+}
+
+// Set stages a value to be written to a key of the bucket at a path
+func (w *WriteBehind) Set(path [][]byte, key string, value []byte) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.current.set(path, key, value)
+}
+
+// Sync waits until the writes staged before it are committed. It returns the
+// error of the commit, if any.
+func (w *WriteBehind) Sync() error {
+	w.mux.Lock()
+	if !w.running {
+		w.mux.Unlock()
+		return w.commit()
+	}
+
+	// The inflight batch commits before the current batch, so waiting on the
+	// current batch also waits on the inflight batch
+	b := w.current
+	if len(b.buckets) == 0 {
+		b = w.inflight
+	}
+	w.mux.Unlock()
+
+	if b == nil {
+		return nil
+	}
+	<-b.done
+	return b.err
+}
+
+// Checkpoint commits the staged writes without waiting for the interval
+func (w *WriteBehind) Checkpoint() error {
+	w.mux.Lock()
+	if !w.running {
+		w.mux.Unlock()
+		return w.commit()
+	}
+	stop := w.stop
+	w.mux.Unlock()
+
+	errChan := make(chan error, 1)
+	select {
+	case w.checkpoint <- errChan:
+		return <-errChan
+	case <-stop:
+		// The writer stopped, and committed the staged writes while stopping
+		return w.Sync()
+	}
+}
+
+// run commits the staged writes every interval, and when a checkpoint is requested
+func (w *WriteBehind) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			_ = w.commit()
+		case errChan := <-w.checkpoint:
+			errChan <- w.commit()
+		}
+	}
+}
+
+// commit writes the staged writes in a single transaction. Writes that fail
+// to commit are staged again, unless a newer value is staged for the key.
+func (w *WriteBehind) commit() error {
+	w.commitMux.Lock()
+	defer w.commitMux.Unlock()
+
+	w.mux.Lock()
+	b := w.current
+	w.current = newBatch()
+	w.inflight = b
+	w.mux.Unlock()
+
+	if len(b.buckets) > 0 {
+		b.err = w.db.Update(b.write)
+	}
+
+	w.mux.Lock()
+	w.inflight = nil
+	if b.err != nil {
+		w.current.restage(b)
+	}
+	w.mux.Unlock()
+
+	close(b.done)
+	return b.err
+}
+
+func (b *batch) set(path [][]byte, key string, value []byte) {
+	id := bucketID(path)
+	bucket, ok := b.buckets[id]
+	if !ok {
+		bucket = &stagedBucket{path: path, values: make(map[string][]byte)}
+		b.buckets[id] = bucket
+	}
+	bucket.values[key] = value
+}
+
+// restage stages the writes of a failed batch that have not been staged again since
+func (b *batch) restage(failed *batch) {
+	for id, failedBucket := range failed.buckets {
+		for key, value := range failedBucket.values {
+			if bucket, ok := b.buckets[id]; ok {
+				if _, ok := bucket.values[key]; ok {
+					continue
+				}
+			}
+			b.set(failedBucket.path, key, value)
+		}
+	}
+}
+
+// write puts the values of a batch in a transaction
+func (b *batch) write(tx *bbolt.Tx) error {
+	for _, staged := range b.buckets {
+		bucket, err := tx.CreateBucketIfNotExists(staged.path[0])
+		if err != nil {
+			return err
+		}
+		for _, name := range staged.path[1:] {
+			bucket, err = bucket.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		for key, value := range staged.values {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bucketID identifies the bucket at a path
+func bucketID(path [][]byte) string {
+	parts := make([]string, 0, len(path))
+	for _, name := range path {
+		parts = append(parts, string(name))
+	}
+	return strings.Join(parts, "\x00")
+}
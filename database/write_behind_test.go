@@ -0,0 +1,174 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+var testPath = [][]byte{[]byte("offsets"), []byte("test")}
+
+func openTestDatabase(t *testing.T, file string) Database {
+	db, err := OpenDatabase(file)
+	require.NoError(t, err)
+	return db
+}
+
+// readValue returns the committed value of a key in the test bucket
+func readValue(t *testing.T, db Database, key string) []byte {
+	var value []byte
+	err := db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(testPath[0])
+		if bucket == nil {
+			return nil
+		}
+		if bucket = bucket.Bucket(testPath[1]); bucket == nil {
+			return nil
+		}
+		value = append(value, bucket.Get([]byte(key))...)
+		return nil
+	})
+	require.NoError(t, err)
+	if len(value) == 0 {
+		return nil
+	}
+	return value
+}
+
+func TestWriteBehindInterval(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(NewTempDir(t), "test.db"))
+	defer db.Close()
+
+	wb := NewWriteBehind(db, 50*time.Millisecond)
+	wb.Start()
+	defer wb.Stop()
+
+	wb.Set(testPath, "key", []byte("value"))
+	require.Nil(t, readValue(t, db, "key"))
+	require.Eventually(t, func() bool {
+		return string(readValue(t, db, "key")) == "value"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWriteBehindSync(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(NewTempDir(t), "test.db"))
+	defer db.Close()
+
+	wb := NewWriteBehind(db, 20*time.Millisecond)
+	wb.Start()
+	defer wb.Stop()
+
+	// Nothing is staged, so there is nothing to wait for
+	require.NoError(t, wb.Sync())
+
+	for i := 0; i < 10; i++ {
+		wb.Set(testPath, "key", []byte(fmt.Sprint(i)))
+		require.NoError(t, wb.Sync())
+		require.Equal(t, []byte(fmt.Sprint(i)), readValue(t, db, "key"))
+	}
+}
+
+func TestWriteBehindCheckpoint(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(NewTempDir(t), "test.db"))
+	defer db.Close()
+
+	wb := NewWriteBehind(db, time.Hour)
+	wb.Start()
+	defer wb.Stop()
+
+	wb.Set(testPath, "key", []byte("value"))
+	require.NoError(t, wb.Checkpoint())
+	require.Equal(t, []byte("value"), readValue(t, db, "key"))
+}
+
+func TestWriteBehindStop(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(NewTempDir(t), "test.db"))
+	defer db.Close()
+
+	wb := NewWriteBehind(db, time.Hour)
+	wb.Start()
+	wb.Set(testPath, "key", []byte("value"))
+	require.NoError(t, wb.Stop())
+	require.Equal(t, []byte("value"), readValue(t, db, "key"))
+
+	// Writes staged after Stop are committed by Sync
+	wb.Set(testPath, "key", []byte("after"))
+	require.NoError(t, wb.Sync())
+	require.Equal(t, []byte("after"), readValue(t, db, "key"))
+}
+
+func TestWriteBehindRestage(t *testing.T) {
+	file := filepath.Join(NewTempDir(t), "test.db")
+	db := openTestDatabase(t, file)
+	wb := NewWriteBehind(db, time.Hour)
+
+	// A commit to a closed database fails, and the writes are staged again
+	require.NoError(t, db.Close())
+	wb.Set(testPath, "key", []byte("value"))
+	require.Error(t, wb.Checkpoint())
+
+	db = openTestDatabase(t, file)
+	defer db.Close()
+	wb.db = db
+	require.NoError(t, wb.Checkpoint())
+	require.Equal(t, []byte("value"), readValue(t, db, "key"))
+}
+
+// TestWriteBehindKill kills a process that has staged writes, and checks that
+// only the writes staged since the last commit are lost
+func TestWriteBehindKill(t *testing.T) {
+	file := filepath.Join(NewTempDir(t), "test.db")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWriteBehindKillHelper$")
+	cmd.Env = append(os.Environ(), "WRITE_BEHIND_DATABASE="+file)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	scanner := bufio.NewScanner(stdout)
+	ready := false
+	for scanner.Scan() {
+		if scanner.Text() == "ready" {
+			ready = true
+			break
+		}
+	}
+	require.True(t, ready, "helper process did not stage its writes")
+
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+
+	db := openTestDatabase(t, file)
+	defer db.Close()
+	require.Equal(t, []byte("committed"), readValue(t, db, "first"))
+	require.Equal(t, []byte("committed"), readValue(t, db, "second"))
+	require.Nil(t, readValue(t, db, "third"))
+}
+
+// TestWriteBehindKillHelper runs in the process killed by TestWriteBehindKill
+func TestWriteBehindKillHelper(t *testing.T) {
+	file := os.Getenv("WRITE_BEHIND_DATABASE")
+	if file == "" {
+		t.Skip("run by TestWriteBehindKill")
+	}
+
+	db := openTestDatabase(t, file)
+	wb := NewWriteBehind(db, time.Hour)
+	wb.Start()
+
+	wb.Set(testPath, "first", []byte("staged"))
+	wb.Set(testPath, "first", []byte("committed"))
+	wb.Set(testPath, "second", []byte("committed"))
+	require.NoError(t, wb.Checkpoint())
+	wb.Set(testPath, "third", []byte("staged"))
+
+	fmt.Println("ready")
+	select {}
+}
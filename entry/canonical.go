@@ -0,0 +1,247 @@
+package entry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CanonicalVersion is the version of the canonical serialization. It starts
+// every serialization, and would only change with a new format, so values
+// serialized by one release are serialized to the same bytes by every later
+// release.
+const CanonicalVersion = "v1"
+
+// Canonical returns a canonical serialization of an entry, or of a subset of
+// its fields. Operators that identify entries by their content, such as to
+// deduplicate them or to derive an idempotent ID, should use it rather than
+// formatting the entry themselves, so that equal entries are always
+// serialized the same way.
+//
+// The serialization starts with CanonicalVersion, and is stable across
+// releases: values that serialize without an error are always serialized to
+// the same bytes. Values are tagged with their type, so the string "1", the
+// integer 1, and the float 1 are serialized differently:
+//
+//   nil          n
+//   bool         t or f
+//   string       s<length>:<bytes>
+//   []byte       b<length>:<bytes>
+//   int types    i<decimal>;
+//   uint types   u<decimal>;
+//   float types  d<shortest decimal that parses to the float64 value>; or dNaN;, d+Inf;, d-Inf;
+//   time.Time    T<RFC 3339 with nanoseconds, in UTC>;
+//   maps         m<count>{<key><value>...} with string keys sorted by their bytes
+//   slices       l<count>[<value>...]
+//   absent       x, for a field that does not exist on the entry
+//
+// Without fields, the whole entry is serialized as a map of its timestamp,
+// severity, labels, resource, trace context, and record, where nil labels and
+// resource serialize as empty maps, and nil trace context as empty bytes.
+// With fields, the serialization is a list of each field name followed by its
+// value, in the order of the field names, so the order in which the fields are
+// configured does not change the serialization. Types other than the above
+// return an error.
+func (entry *Entry) Canonical(fields ...Field) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(CanonicalVersion)
+	buf.WriteByte(';')
+
+	if len(fields) == 0 {
+		whole := map[string]interface{}{
+			"timestamp":   entry.Timestamp,
+			"severity":    int(entry.Severity),
+			"labels":      nonNilMap(entry.Labels),
+			"resource":    nonNilMap(entry.Resource),
+			"trace_id":    nonNilBytes(entry.TraceID),
+			"span_id":     nonNilBytes(entry.SpanID),
+			"trace_flags": nonNilBytes(entry.TraceFlags),
+			"record":      entry.Record,
+		}
+		if err := writeCanonical(&buf, whole); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	names := make([]string, 0, len(fields))
+	byName := make(map[string]Field, len(fields))
+	for _, field := range fields {
+		name := field.String()
+		if _, ok := byName[name]; ok {
+			continue
+		}
+		byName[name] = field
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(&buf, "l%d[", len(names)*2)
+	for _, name := range names {
+		writeCanonicalString(&buf, 's', name)
+		value, ok := entry.Get(byName[name])
+		if !ok {
+			buf.WriteByte('x')
+			continue
+		}
+		if err := writeCanonical(&buf, value); err != nil {
+			return nil, fmt.Errorf("field %s: %s", name, err)
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of the canonical
+// serialization of an entry, or of a subset of its fields. It is as stable
+// across releases as Canonical.
+func (entry *Entry) Fingerprint(fields ...Field) (string, error) {
+	canonical, err := entry.Canonical(fields...)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeCanonical writes the canonical serialization of a value
+func writeCanonical(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte('n')
+	case bool:
+		if v {
+			buf.WriteByte('t')
+		} else {
+			buf.WriteByte('f')
+		}
+	case string:
+		writeCanonicalString(buf, 's', v)
+	case []byte:
+		writeCanonicalString(buf, 'b', string(v))
+	case int:
+		writeCanonicalInt(buf, int64(v))
+	case int8:
+		writeCanonicalInt(buf, int64(v))
+	case int16:
+		writeCanonicalInt(buf, int64(v))
+	case int32:
+		writeCanonicalInt(buf, int64(v))
+	case int64:
+		writeCanonicalInt(buf, v)
+	case uint:
+		writeCanonicalUint(buf, uint64(v))
+	case uint8:
+		writeCanonicalUint(buf, uint64(v))
+	case uint16:
+		writeCanonicalUint(buf, uint64(v))
+	case uint32:
+		writeCanonicalUint(buf, uint64(v))
+	case uint64:
+		writeCanonicalUint(buf, v)
+	case float32:
+		writeCanonicalFloat(buf, float64(v))
+	case float64:
+		writeCanonicalFloat(buf, v)
+	case time.Time:
+		buf.WriteByte('T')
+		buf.WriteString(v.UTC().Format(time.RFC3339Nano))
+		buf.WriteByte(';')
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(buf, "m%d{", len(keys))
+		for _, key := range keys {
+			writeCanonicalString(buf, 's', key)
+			writeCanonicalString(buf, 's', v[key])
+		}
+		buf.WriteByte('}')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(buf, "m%d{", len(keys))
+		for _, key := range keys {
+			writeCanonicalString(buf, 's', key)
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []string:
+		fmt.Fprintf(buf, "l%d[", len(v))
+		for _, s := range v {
+			writeCanonicalString(buf, 's', s)
+		}
+		buf.WriteByte(']')
+	case []interface{}:
+		fmt.Fprintf(buf, "l%d[", len(v))
+		for _, item := range v {
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return fmt.Errorf("cannot serialize type %T canonically", value)
+	}
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, tag byte, s string) {
+	buf.WriteByte(tag)
+	buf.WriteString(strconv.Itoa(len(s)))
+	buf.WriteByte(':')
+	buf.WriteString(s)
+}
+
+func writeCanonicalInt(buf *bytes.Buffer, i int64) {
+	buf.WriteByte('i')
+	buf.WriteString(strconv.FormatInt(i, 10))
+	buf.WriteByte(';')
+}
+
+func writeCanonicalUint(buf *bytes.Buffer, u uint64) {
+	buf.WriteByte('u')
+	buf.WriteString(strconv.FormatUint(u, 10))
+	buf.WriteByte(';')
+}
+
+// writeCanonicalFloat writes the shortest decimal that parses to the value.
+// Negative zero is written as -0, and infinities as +Inf and -Inf.
+func writeCanonicalFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteByte('d')
+	switch {
+	case math.IsInf(f, 1):
+		buf.WriteString("+Inf")
+	case math.IsInf(f, -1):
+		buf.WriteString("-Inf")
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	buf.WriteByte(';')
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+func nonNilBytes(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
@@ -0,0 +1,156 @@
+package entry
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The canonical serializations are locked by a golden file, since IDs derived
+// from them may already be stored by downstream systems. Run the tests with
+// -update only when the format version changes.
+var updateGolden = flag.Bool("update", false, "update the golden file of canonical serializations")
+
+var canonicalGoldenFile = filepath.Join("testdata", "canonical.golden")
+
+func canonicalTestEntry() *Entry {
+	return &Entry{
+		Timestamp: time.Date(2020, 10, 7, 12, 30, 45, 123456789, time.FixedZone("EST", -5*60*60)),
+		Severity:  Error,
+		Labels:    map[string]string{"host": "web-1", "env": "prod"},
+		Resource:  map[string]string{"region": "us-east-1"},
+		TraceID:   []byte{0x48, 0x01},
+		Record: map[string]interface{}{
+			"message": "request failed",
+			"status":  503,
+			"latency": 0.25,
+			"retried": true,
+			"user":    nil,
+			"tags":    []interface{}{"a", int64(1), float32(1.5)},
+			"req": map[string]interface{}{
+				"path":   "/api",
+				"method": "GET",
+				"bytes":  uint64(1024),
+			},
+			"names": []string{"x", "y"},
+			"raw":   []byte("raw"),
+		},
+	}
+}
+
+func TestCanonicalGolden(t *testing.T) {
+	cases := []struct {
+		name   string
+		entry  *Entry
+		fields []Field
+	}{
+		{"WholeEntry", canonicalTestEntry(), nil},
+		{"EmptyEntry", &Entry{Timestamp: time.Unix(0, 0)}, nil},
+		{"StringRecord", &Entry{Timestamp: time.Unix(0, 0), Record: "a message"}, nil},
+		{
+			"Fields",
+			canonicalTestEntry(),
+			[]Field{NewRecordField("req", "path"), NewLabelField("host"), NewRecordField("status")},
+		},
+		{"AbsentField", canonicalTestEntry(), []Field{NewRecordField("missing"), NewResourceField("region")}},
+		{"NestedMap", canonicalTestEntry(), []Field{NewRecordField("req")}},
+		{
+			"Floats",
+			&Entry{Record: []interface{}{0.1, float32(0.1), 1.0, -0.0, math.Copysign(0, -1), 1e21, 1e-7, math.Inf(1), math.Inf(-1), math.NaN()}},
+			[]Field{NewRecordField()},
+		},
+		{
+			"Integers",
+			&Entry{Record: []interface{}{int8(-8), int16(16), int32(-32), int64(math.MinInt64), uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64), 0}},
+			[]Field{NewRecordField()},
+		},
+		{
+			"TypeTags",
+			&Entry{Record: []interface{}{"1", 1, uint(1), 1.0, true, nil, []byte("1")}},
+			[]Field{NewRecordField()},
+		},
+		{
+			"Unicode",
+			&Entry{Record: map[string]interface{}{"é": "日本語", "e": "\x00\n"}},
+			[]Field{NewRecordField()},
+		},
+	}
+
+	var golden strings.Builder
+	for _, tc := range cases {
+		canonical, err := tc.entry.Canonical(tc.fields...)
+		require.NoError(t, err, tc.name)
+		fingerprint, err := tc.entry.Fingerprint(tc.fields...)
+		require.NoError(t, err, tc.name)
+		fmt.Fprintf(&golden, "%s %q %s\n", tc.name, canonical, fingerprint)
+	}
+
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(canonicalGoldenFile, []byte(golden.String()), 0600))
+	}
+
+	expected, err := ioutil.ReadFile(canonicalGoldenFile)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), golden.String())
+}
+
+func TestCanonicalMapOrder(t *testing.T) {
+	// Maps built in different orders serialize the same way
+	a := map[string]interface{}{}
+	b := map[string]interface{}{}
+	for i := 0; i < 100; i++ {
+		a[fmt.Sprintf("key%d", i)] = i
+		b[fmt.Sprintf("key%d", 99-i)] = 99 - i
+	}
+
+	first, err := (&Entry{Record: a}).Canonical()
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		again, err := (&Entry{Record: b}).Canonical()
+		require.NoError(t, err)
+		require.Equal(t, first, again)
+	}
+}
+
+func TestCanonicalFieldOrder(t *testing.T) {
+	entry := canonicalTestEntry()
+	forward, err := entry.Canonical(NewRecordField("message"), NewLabelField("env"))
+	require.NoError(t, err)
+	reverse, err := entry.Canonical(NewLabelField("env"), NewRecordField("message"), NewLabelField("env"))
+	require.NoError(t, err)
+	require.Equal(t, forward, reverse)
+}
+
+func TestCanonicalNilEqualsEmpty(t *testing.T) {
+	withNil := &Entry{Timestamp: time.Unix(0, 0)}
+	withEmpty := &Entry{
+		Timestamp: time.Unix(0, 0),
+		Labels:    map[string]string{},
+		Resource:  map[string]string{},
+		TraceID:   []byte{},
+	}
+
+	a, err := withNil.Fingerprint()
+	require.NoError(t, err)
+	b, err := withEmpty.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+}
+
+func TestCanonicalUnsupportedType(t *testing.T) {
+	entry := &Entry{Record: map[string]interface{}{"ch": make(chan int)}}
+	_, err := entry.Canonical()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot serialize type chan int canonically")
+
+	_, err = entry.Fingerprint(NewRecordField("ch"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field ch:")
+}
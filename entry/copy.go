@@ -1,12 +1,17 @@
 package entry
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // copyValue will deep copy a value based on its type.
 func copyValue(v interface{}) interface{} {
 	switch value := v.(type) {
 	case string, int, bool, byte, nil:
 		return value
+	case int8, int16, int32, int64, uint, uint16, uint32, uint64, float32, float64, json.Number, time.Time, time.Duration:
+		return value
 	case map[string]string:
 		return copyStringMap(value)
 	case map[string]interface{}:
@@ -19,6 +24,8 @@ func copyValue(v interface{}) interface{} {
 		return copyIntArray(value)
 	case []interface{}:
 		return copyInterfaceArray(value)
+	case []map[string]interface{}:
+		return copyInterfaceMapArray(value)
 	default:
 		return copyUnknown(value)
 	}
@@ -56,6 +63,15 @@ func copyByteArray(a []byte) []byte {
 	return arrayCopy
 }
 
+// copyTraceBytes will deep copy the bytes of a trace field, which stay nil
+// if the field is not set.
+func copyTraceBytes(a []byte) []byte {
+	if a == nil {
+		return nil
+	}
+	return copyByteArray(a)
+}
+
 // copyIntArray will deep copy an array of ints.
 func copyIntArray(a []int) []int {
 	arrayCopy := make([]int, len(a))
@@ -72,6 +88,15 @@ func copyInterfaceArray(a []interface{}) []interface{} {
 	return arrayCopy
 }
 
+// copyInterfaceMapArray will deep copy an array of interface maps.
+func copyInterfaceMapArray(a []map[string]interface{}) []map[string]interface{} {
+	arrayCopy := make([]map[string]interface{}, 0, len(a))
+	for _, m := range a {
+		arrayCopy = append(arrayCopy, copyInterfaceMap(m))
+	}
+	return arrayCopy
+}
+
 // copyUnknown will copy an unknown value using json encoding.
 // If this process fails, the result will be an empty interface.
 func copyUnknown(value interface{}) interface{} {
@@ -1,7 +1,9 @@
 package entry
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -36,6 +38,56 @@ func TestCopyValueNil(t *testing.T) {
 	require.Equal(t, nil, copy)
 }
 
+func TestCopyValueScalarTypes(t *testing.T) {
+	values := []interface{}{
+		int8(1), int16(1), int32(1), int64(1),
+		uint(1), uint16(1), uint32(1), uint64(1),
+		float32(1.5), float64(1.5),
+		json.Number("12345678901234567890"),
+		time.Unix(1, 0), time.Second,
+	}
+	for _, value := range values {
+		// Scalars keep their type rather than being round tripped through json
+		require.Equal(t, value, copyValue(value))
+	}
+}
+
+func TestCopyValueInterfaceMapArray(t *testing.T) {
+	value := []map[string]interface{}{{"test": "value"}}
+	copy := copyValue(value).([]map[string]interface{})
+	require.Equal(t, value, copy)
+
+	value[0]["test"] = "new"
+	require.Equal(t, "value", copy[0]["test"])
+}
+
+func TestCopyValueNested(t *testing.T) {
+	value := map[string]interface{}{
+		"map": map[string]interface{}{
+			"inner": map[string]interface{}{"key": "value"},
+			"list":  []interface{}{map[string]interface{}{"key": "value"}, "item"},
+		},
+		"labels": map[string]string{"key": "value"},
+		"count":  int64(3),
+	}
+	copy := copyValue(value).(map[string]interface{})
+
+	outer := value["map"].(map[string]interface{})
+	outer["inner"].(map[string]interface{})["key"] = "new"
+	outer["list"].([]interface{})[0].(map[string]interface{})["key"] = "new"
+	outer["list"].([]interface{})[1] = "new"
+	value["labels"].(map[string]string)["key"] = "new"
+
+	require.Equal(t, map[string]interface{}{
+		"map": map[string]interface{}{
+			"inner": map[string]interface{}{"key": "value"},
+			"list":  []interface{}{map[string]interface{}{"key": "value"}, "item"},
+		},
+		"labels": map[string]string{"key": "value"},
+		"count":  int64(3),
+	}, copy)
+}
+
 func TestCopyValueStringArray(t *testing.T) {
 	value := []string{"test"}
 	copy := copyValue(value)
@@ -154,3 +206,39 @@ func TestCopyUnknownValueInalid(t *testing.T) {
 	var expectedValue interface{}
 	require.Equal(t, expectedValue, copiedValue)
 }
+
+// nestedRecord returns a record nested three levels deep
+func nestedRecord() map[string]interface{} {
+	record := make(map[string]interface{})
+	for i := 0; i < 5; i++ {
+		middle := make(map[string]interface{})
+		for j := 0; j < 5; j++ {
+			middle[string(rune('a'+j))] = map[string]interface{}{
+				"message": "test",
+				"count":   int64(j),
+				"tags":    []interface{}{"x", "y"},
+			}
+		}
+		record[string(rune('a'+i))] = middle
+	}
+	return record
+}
+
+func BenchmarkCopyNestedRecord(b *testing.B) {
+	record := nestedRecord()
+
+	b.Run("Shallow", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			shallow := make(map[string]interface{}, len(record))
+			for k, v := range record {
+				shallow[k] = v
+			}
+		}
+	})
+
+	b.Run("Deep", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			copyValue(record)
+		}
+	})
+}
@@ -6,12 +6,22 @@ import (
 )
 
 // Entry is a flexible representation of log data associated with a timestamp.
+//
+// The labels of an entry may be shared with other entries, so they should be
+// changed with AddLabel or a label field rather than by writing to the map.
 type Entry struct {
-	Timestamp time.Time         `json:"timestamp"        yaml:"timestamp"`
-	Severity  Severity          `json:"severity"         yaml:"severity"`
-	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
-	Resource  map[string]string `json:"resource,omitempty" yaml:"resource,omitempty"`
-	Record    interface{}       `json:"record"           yaml:"record"`
+	Timestamp  time.Time         `json:"timestamp"             yaml:"timestamp"`
+	Severity   Severity          `json:"severity"              yaml:"severity"`
+	Labels     map[string]string `json:"labels,omitempty"      yaml:"labels,omitempty"`
+	Resource   map[string]string `json:"resource,omitempty"    yaml:"resource,omitempty"`
+	TraceID    HexBytes          `json:"trace_id,omitempty"    yaml:"trace_id,omitempty"`
+	SpanID     HexBytes          `json:"span_id,omitempty"     yaml:"span_id,omitempty"`
+	TraceFlags HexBytes          `json:"trace_flags,omitempty" yaml:"trace_flags,omitempty"`
+	Record     interface{}       `json:"record"                yaml:"record"`
+
+	// labelSet is the set that Labels is shared with, or nil if the entry
+	// owns its labels
+	labelSet *LabelSet
 }
 
 // New will create a new log entry with current timestamp and an empty record.
@@ -23,10 +33,44 @@ func New() *Entry {
 
 // AddLabel will add a key/value pair to the entry's labels.
 func (entry *Entry) AddLabel(key, value string) {
-	if entry.Labels == nil {
-		entry.Labels = make(map[string]string)
+	entry.mutableLabels(1)[key] = value
+}
+
+// AddLabelSet will add the labels of a shared set to the entry's labels,
+// replacing labels with the same keys. An entry without labels, or that
+// shares a set the new set was derived from, shares the new set rather than
+// copying it.
+func (entry *Entry) AddLabelSet(set *LabelSet) {
+	if set.Len() == 0 {
+		return
+	}
+	if len(entry.Labels) == 0 || set.extends(entry.labelSet) {
+		entry.Labels = set.labels
+		entry.labelSet = set
+		return
+	}
+
+	labels := entry.mutableLabels(set.Len())
+	for k, v := range set.labels {
+		labels[k] = v
 	}
-	entry.Labels[key] = value
+}
+
+// mutableLabels returns the labels of the entry, which are copied first if
+// they are shared, with room for extra labels if they are allocated
+func (entry *Entry) mutableLabels(extra int) map[string]string {
+	switch {
+	case entry.labelSet != nil:
+		labels := make(map[string]string, len(entry.Labels)+extra)
+		for k, v := range entry.Labels {
+			labels[k] = v
+		}
+		entry.Labels = labels
+		entry.labelSet = nil
+	case entry.Labels == nil:
+		entry.Labels = make(map[string]string, extra)
+	}
+	return entry.Labels
 }
 
 // AddResourceKey wil add a key/value pair to the entry's resource.
@@ -151,13 +195,23 @@ func (entry *Entry) readToStringMap(field FieldInterface, dest *map[string]strin
 	return nil
 }
 
-// Copy will return a deep copy of the entry.
+// Copy will return a deep copy of the entry. Shared labels are shared by the
+// copy rather than copied.
 func (entry *Entry) Copy() *Entry {
+	labels := entry.Labels
+	if entry.labelSet == nil {
+		labels = copyStringMap(entry.Labels)
+	}
+
 	return &Entry{
-		Timestamp: entry.Timestamp,
-		Severity:  entry.Severity,
-		Labels:    copyStringMap(entry.Labels),
-		Resource:  copyStringMap(entry.Resource),
-		Record:    copyValue(entry.Record),
+		Timestamp:  entry.Timestamp,
+		Severity:   entry.Severity,
+		Labels:     labels,
+		labelSet:   entry.labelSet,
+		Resource:   copyStringMap(entry.Resource),
+		TraceID:    copyTraceBytes(entry.TraceID),
+		SpanID:     copyTraceBytes(entry.SpanID),
+		TraceFlags: copyTraceBytes(entry.TraceFlags),
+		Record:     copyValue(entry.Record),
 	}
 }
@@ -1,6 +1,7 @@
 package entry
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -140,6 +141,49 @@ func TestCopy(t *testing.T) {
 	require.Equal(t, "test", copy.Record)
 }
 
+func TestCopyTrace(t *testing.T) {
+	entry := New()
+	entry.TraceID = HexBytes{0x4b, 0xf9}
+	entry.SpanID = HexBytes{0x00, 0xf0}
+	copy := entry.Copy()
+
+	entry.TraceID[0] = 0
+	entry.SpanID[1] = 0
+
+	require.Equal(t, HexBytes{0x4b, 0xf9}, copy.TraceID)
+	require.Equal(t, HexBytes{0x00, 0xf0}, copy.SpanID)
+	require.Nil(t, copy.TraceFlags)
+}
+
+func TestCopyIsIndependent(t *testing.T) {
+	entry := New()
+	entry.Labels = map[string]string{"label": "value"}
+	entry.Resource = map[string]string{"resource": "value"}
+	entry.Record = map[string]interface{}{
+		"nested": map[string]interface{}{
+			"key":  "value",
+			"list": []interface{}{"a", map[string]interface{}{"key": "value"}},
+		},
+	}
+	copy := entry.Copy()
+
+	// Mutating the nested fields of the copy does not affect the original
+	nested := copy.Record.(map[string]interface{})["nested"].(map[string]interface{})
+	nested["key"] = "new"
+	nested["list"].([]interface{})[1].(map[string]interface{})["key"] = "new"
+	copy.Labels["label"] = "new"
+	copy.Resource["resource"] = "new"
+
+	require.Equal(t, map[string]interface{}{
+		"nested": map[string]interface{}{
+			"key":  "value",
+			"list": []interface{}{"a", map[string]interface{}{"key": "value"}},
+		},
+	}, entry.Record)
+	require.Equal(t, map[string]string{"label": "value"}, entry.Labels)
+	require.Equal(t, map[string]string{"resource": "value"}, entry.Resource)
+}
+
 func TestFieldFromString(t *testing.T) {
 	cases := []struct {
 		name          string
@@ -177,6 +221,48 @@ func TestFieldFromString(t *testing.T) {
 			Field{},
 			true,
 		},
+		{
+			"BracketedLabel",
+			`$labels["k8s.namespace"]`,
+			Field{LabelField{"k8s.namespace"}},
+			false,
+		},
+		{
+			"SimpleResource",
+			"$resource.host",
+			Field{ResourceField{"host"}},
+			false,
+		},
+		{
+			"BracketedResource",
+			`$resource['host.name']`,
+			Field{ResourceField{"host.name"}},
+			false,
+		},
+		{
+			"BracketedRecord",
+			`$record['file.path'].name`,
+			Field{RecordField{[]string{"file.path", "name"}}},
+			false,
+		},
+		{
+			"BareLabels",
+			"$labels",
+			Field{},
+			true,
+		},
+		{
+			"BareResource",
+			"$resource",
+			Field{},
+			true,
+		},
+		{
+			"Empty",
+			"",
+			Field{},
+			true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -232,3 +318,46 @@ func TestReadToInterfaceMissingField(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "can not be read as a interface{}")
 }
+
+func TestEntryMarshalJSON(t *testing.T) {
+	entry := &Entry{
+		Timestamp:  time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC),
+		Severity:   Info,
+		Labels:     map[string]string{"env": "prod"},
+		Resource:   map[string]string{"host": "server1", "file_path": "/var/log/app.log"},
+		TraceID:    HexBytes{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     HexBytes{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: HexBytes{0x01},
+		Record:     map[string]interface{}{"file_path": "parsed"},
+	}
+
+	marshalled, err := json.Marshal(entry)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"timestamp": "2020-10-01T12:00:00Z",
+		"severity": 30,
+		"labels": {"env": "prod"},
+		"resource": {"host": "server1", "file_path": "/var/log/app.log"},
+		"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id": "00f067aa0ba902b7",
+		"trace_flags": "01",
+		"record": {"file_path": "parsed"}
+	}`, string(marshalled))
+
+	var unmarshalled Entry
+	require.NoError(t, json.Unmarshal(marshalled, &unmarshalled))
+	require.Equal(t, entry.Labels, unmarshalled.Labels)
+	require.Equal(t, entry.Resource, unmarshalled.Resource)
+	require.Equal(t, entry.TraceID, unmarshalled.TraceID)
+	require.Equal(t, entry.SpanID, unmarshalled.SpanID)
+	require.Equal(t, entry.TraceFlags, unmarshalled.TraceFlags)
+
+	// Entries buffered by earlier versions hold the trace context as base64
+	var buffered Entry
+	require.NoError(t, json.Unmarshal([]byte(`{"trace_id":"S/kvNXezTaajzpKdDg5HNg==","span_id":"APBnqgupArc=","trace_flags":"AQ==","record":null}`), &buffered))
+	require.Equal(t, entry.TraceID, buffered.TraceID)
+	require.Equal(t, entry.SpanID, buffered.SpanID)
+	require.Equal(t, entry.TraceFlags, buffered.TraceFlags)
+
+	require.Error(t, json.Unmarshal([]byte(`{"trace_id":"not hex!","record":null}`), &buffered))
+}
@@ -3,6 +3,7 @@ package entry
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -48,19 +49,34 @@ func (f *Field) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return err
 }
 
+// ParseField parses a field written as it is in configs, such as
+// $labels.env or message.level
+func ParseField(s string) (Field, error) {
+	return fieldFromString(s)
+}
+
 func fieldFromString(s string) (Field, error) {
 	split, err := splitField(s)
 	if err != nil {
 		return Field{}, fmt.Errorf("splitting field: %s", err)
 	}
+	if len(split) == 0 {
+		return Field{}, fmt.Errorf("field is empty")
+	}
 
 	switch split[0] {
 	case labelsPrefix:
+		if len(split) == 1 {
+			return Field{}, fmt.Errorf("labels field must name a label, such as $labels.env")
+		}
 		if len(split) != 2 {
 			return Field{}, fmt.Errorf("labels cannot be nested")
 		}
 		return Field{LabelField{split[1]}}, nil
 	case resourcePrefix:
+		if len(split) == 1 {
+			return Field{}, fmt.Errorf("resource field must name a resource key, such as $resource.host")
+		}
 		if len(split) != 2 {
 			return Field{}, fmt.Errorf("resource fields cannot be nested")
 		}
@@ -72,6 +88,21 @@ func fieldFromString(s string) (Field, error) {
 	}
 }
 
+// needsBrackets returns whether a key must be written in bracket syntax to be
+// parsed back to the same key
+func needsBrackets(key string) bool {
+	return strings.ContainsAny(key, `.[]'"`)
+}
+
+// bracketed returns a key in bracket syntax, quoted with a quote that it does
+// not contain. Keys that contain both quotes cannot be parsed.
+func bracketed(key string) string {
+	if strings.Contains(key, "'") {
+		return `["` + key + `"]`
+	}
+	return `['` + key + `']`
+}
+
 // MarshalJSON will marshal a field into JSON
 func (f Field) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%s"`, f.String())), nil
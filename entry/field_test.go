@@ -259,3 +259,33 @@ func TestFieldFromStringWithInvalidResource(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "resource fields cannot be nested")
 }
+
+func TestFieldStringRoundTrip(t *testing.T) {
+	cases := []struct {
+		name     string
+		field    Field
+		expected string
+	}{
+		{"Record", NewRecordField("a", "b"), "a.b"},
+		{"RecordDot", NewRecordField("a.b", "c"), "$record['a.b']['c']"},
+		{"RecordSingleQuote", NewRecordField("it's"), `$record["it's"]`},
+		{"RecordBracket", NewRecordField("a[0]"), "$record['a[0]']"},
+		{"RecordDollar", NewRecordField("$labels"), "$record['$labels']"},
+		{"Label", NewLabelField("env"), "$labels.env"},
+		{"LabelDot", NewLabelField("k8s.pod"), "$labels['k8s.pod']"},
+		{"LabelSingleQuote", NewLabelField("it's"), `$labels["it's"]`},
+		{"LabelDoubleQuote", NewLabelField(`say "hi"`), `$labels['say "hi"']`},
+		{"Resource", NewResourceField("host"), "$resource.host"},
+		{"ResourceBracket", NewResourceField("a]b"), "$resource['a]b']"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.field.String())
+
+			parsed, err := fieldFromString(tc.field.String())
+			require.NoError(t, err)
+			require.Equal(t, tc.field, parsed)
+		})
+	}
+}
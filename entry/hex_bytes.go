@@ -0,0 +1,69 @@
+package entry
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// HexBytes are the bytes of a trace ID, span ID, or trace flags. They are
+// encoded as a hex string, which is how trace context is written everywhere
+// else, rather than as the base64 string of a plain byte slice.
+type HexBytes []byte
+
+// String returns the bytes as a lowercase hex string
+func (b HexBytes) String() string {
+	return hex.EncodeToString(b)
+}
+
+// MarshalJSON encodes the bytes as a hex string
+func (b HexBytes) MarshalJSON() ([]byte, error) {
+	if b == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(b.String())
+}
+
+// UnmarshalJSON decodes the bytes from a hex string. Entries that were
+// buffered by earlier versions hold base64 strings, which are decoded too.
+func (b *HexBytes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*b = nil
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return b.decode(s)
+}
+
+// MarshalYAML encodes the bytes as a hex string
+func (b HexBytes) MarshalYAML() (interface{}, error) {
+	return b.String(), nil
+}
+
+// UnmarshalYAML decodes the bytes from a hex string
+func (b *HexBytes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return b.decode(s)
+}
+
+// decode decodes a hex string, or a base64 string that is not valid hex
+func (b *HexBytes) decode(s string) error {
+	decoded, err := hex.DecodeString(s)
+	if err == nil {
+		*b = decoded
+		return nil
+	}
+	decoded, base64Err := base64.StdEncoding.DecodeString(s)
+	if base64Err != nil {
+		return fmt.Errorf("invalid hex value '%s': %s", s, err)
+	}
+	*b = decoded
+	return nil
+}
@@ -2,7 +2,6 @@ package entry
 
 import (
 	"fmt"
-	"strings"
 )
 
 // LabelField is the path to an entry label
@@ -21,15 +20,11 @@ func (l LabelField) Get(entry *Entry) (interface{}, bool) {
 
 // Set will set the label value on an entry
 func (l LabelField) Set(entry *Entry, val interface{}) error {
-	if entry.Labels == nil {
-		entry.Labels = make(map[string]string, 1)
-	}
-
 	str, ok := val.(string)
 	if !ok {
 		return fmt.Errorf("cannot set a label to a non-string value")
 	}
-	entry.Labels[l.key] = str
+	entry.mutableLabels(1)[l.key] = str
 	return nil
 }
 
@@ -40,13 +35,16 @@ func (l LabelField) Delete(entry *Entry) (interface{}, bool) {
 	}
 
 	val, ok := entry.Labels[l.key]
-	delete(entry.Labels, l.key)
-	return val, ok
+	if !ok {
+		return "", false
+	}
+	delete(entry.mutableLabels(0), l.key)
+	return val, true
 }
 
 func (l LabelField) String() string {
-	if strings.Contains(l.key, ".") {
-		return fmt.Sprintf(`$labels['%s']`, l.key)
+	if needsBrackets(l.key) {
+		return "$labels" + bracketed(l.key)
 	}
 	return "$labels." + l.key
 }
@@ -0,0 +1,60 @@
+package entry
+
+// LabelSet is an immutable set of labels that many entries can share, such
+// as the labels that a file adds to each entry read from it. An entry given a
+// set refers to its labels rather than copying them, and copies them only
+// when one of its labels is set or deleted.
+type LabelSet struct {
+	parent *LabelSet
+	labels map[string]string
+}
+
+// NewLabelSet creates a set with a copy of the labels
+func NewLabelSet(labels map[string]string) *LabelSet {
+	var empty *LabelSet
+	return empty.With(labels)
+}
+
+// With returns a set with the labels of the set and the labels supplied,
+// which replace the labels of the set with the same keys. The set returned
+// extends the set, so an entry that shares the set can switch to it without
+// copying its labels.
+func (s *LabelSet) With(labels map[string]string) *LabelSet {
+	merged := make(map[string]string, s.Len()+len(labels))
+	if s != nil {
+		for k, v := range s.labels {
+			merged[k] = v
+		}
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return &LabelSet{parent: s, labels: merged}
+}
+
+// Len returns the number of labels in the set
+func (s *LabelSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.labels)
+}
+
+// Get returns the value of a label in the set
+func (s *LabelSet) Get(key string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	val, ok := s.labels[key]
+	return val, ok
+}
+
+// extends returns true if the set is other, or was derived from it with With
+func (s *LabelSet) extends(other *LabelSet) bool {
+	for set := s; set != nil; set = set.parent {
+		if set == other {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package entry
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sameMap returns true if two label maps are the same map
+func sameMap(a, b map[string]string) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+func TestLabelSet(t *testing.T) {
+	labels := map[string]string{"env": "prod"}
+	set := NewLabelSet(labels)
+	labels["env"] = "dev"
+
+	val, ok := set.Get("env")
+	require.True(t, ok)
+	require.Equal(t, "prod", val)
+	require.Equal(t, 1, set.Len())
+
+	derived := set.With(map[string]string{"env": "test", "host": "server1"})
+	require.Equal(t, 2, derived.Len())
+	val, _ = derived.Get("env")
+	require.Equal(t, "test", val)
+	val, _ = set.Get("env")
+	require.Equal(t, "prod", val)
+
+	var empty *LabelSet
+	require.Equal(t, 0, empty.Len())
+	_, ok = empty.Get("env")
+	require.False(t, ok)
+}
+
+func TestAddLabelSet(t *testing.T) {
+	set := NewLabelSet(map[string]string{"env": "prod", "host": "server1"})
+
+	t.Run("Empty", func(t *testing.T) {
+		e := New()
+		e.AddLabelSet(set)
+		require.Equal(t, map[string]string{"env": "prod", "host": "server1"}, e.Labels)
+		require.True(t, sameMap(set.labels, e.Labels))
+	})
+
+	t.Run("Derived", func(t *testing.T) {
+		derived := set.With(map[string]string{"file_name": "app.log"})
+		e := New()
+		e.AddLabelSet(set)
+		e.AddLabelSet(derived)
+		require.Equal(t, map[string]string{"env": "prod", "host": "server1", "file_name": "app.log"}, e.Labels)
+		require.True(t, sameMap(derived.labels, e.Labels))
+	})
+
+	t.Run("Merged", func(t *testing.T) {
+		e := New()
+		e.AddLabel("env", "dev")
+		e.AddLabel("label", "value")
+		e.AddLabelSet(set)
+		require.Equal(t, map[string]string{"env": "prod", "host": "server1", "label": "value"}, e.Labels)
+		require.False(t, sameMap(set.labels, e.Labels))
+	})
+
+	t.Run("NilSet", func(t *testing.T) {
+		e := New()
+		e.AddLabelSet(nil)
+		require.Nil(t, e.Labels)
+	})
+}
+
+func TestSharedLabelsCopyOnWrite(t *testing.T) {
+	newEntries := func() (*LabelSet, *Entry, *Entry) {
+		set := NewLabelSet(map[string]string{"env": "prod", "host": "server1"})
+		first, second := New(), New()
+		first.AddLabelSet(set)
+		second.AddLabelSet(set)
+		return set, first, second
+	}
+	unchanged := map[string]string{"env": "prod", "host": "server1"}
+
+	t.Run("AddLabel", func(t *testing.T) {
+		set, first, second := newEntries()
+		first.AddLabel("env", "dev")
+		require.Equal(t, map[string]string{"env": "dev", "host": "server1"}, first.Labels)
+		require.Equal(t, unchanged, second.Labels)
+		require.Equal(t, unchanged, set.labels)
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		set, first, second := newEntries()
+		require.NoError(t, first.Set(NewLabelField("new"), "value"))
+		require.Equal(t, map[string]string{"env": "prod", "host": "server1", "new": "value"}, first.Labels)
+		require.Equal(t, unchanged, second.Labels)
+		require.Equal(t, unchanged, set.labels)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		set, first, second := newEntries()
+		val, ok := first.Delete(NewLabelField("host"))
+		require.True(t, ok)
+		require.Equal(t, "server1", val)
+		require.Equal(t, map[string]string{"env": "prod"}, first.Labels)
+		require.Equal(t, unchanged, second.Labels)
+		require.Equal(t, unchanged, set.labels)
+	})
+
+	t.Run("DeleteMissing", func(t *testing.T) {
+		set, first, _ := newEntries()
+		_, ok := first.Delete(NewLabelField("missing"))
+		require.False(t, ok)
+		require.True(t, sameMap(set.labels, first.Labels))
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		set, first, _ := newEntries()
+		copied := first.Copy()
+		require.True(t, sameMap(set.labels, copied.Labels))
+
+		copied.AddLabel("env", "dev")
+		require.Equal(t, "dev", copied.Labels["env"])
+		require.Equal(t, unchanged, first.Labels)
+		require.Equal(t, unchanged, set.labels)
+	})
+}
+
+func TestSharedLabelsConcurrent(t *testing.T) {
+	set := NewLabelSet(map[string]string{"env": "prod", "host": "server1"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e := New()
+				e.AddLabelSet(set)
+				copied := e.Copy()
+				copied.AddLabel("env", "dev")
+				_, _ = e.Delete(NewLabelField("host"))
+				_, _ = e.Get(NewLabelField("env"))
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, map[string]string{"env": "prod", "host": "server1"}, set.labels)
+}
+
+func BenchmarkLabels(b *testing.B) {
+	labels := map[string]string{
+		"file_name":          "app.log",
+		"file_path":          "/var/log/app.log",
+		"file_path_resolved": "/var/log/app.log",
+		"file_mtime":         "2020-10-01T12:00:00Z",
+		"host":               "server1",
+		"env":                "prod",
+	}
+
+	b.Run("AddLabel", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			e := &Entry{}
+			for k, v := range labels {
+				e.AddLabel(k, v)
+			}
+		}
+	})
+
+	b.Run("AddLabelSet", func(b *testing.B) {
+		set := NewLabelSet(labels)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			e := &Entry{}
+			e.AddLabelSet(set)
+		}
+	})
+}
@@ -167,7 +167,11 @@ func (f *RecordField) UnmarshalJSON(raw []byte) error {
 		return fmt.Errorf("the field is not a string: %s", err)
 	}
 
-	*f = fromJSONDot(value)
+	field, err := recordFieldFromString(value)
+	if err != nil {
+		return err
+	}
+	*f = field
 	return nil
 }
 
@@ -184,7 +188,11 @@ func (f *RecordField) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return fmt.Errorf("the field is not a string: %s", err)
 	}
 
-	*f = fromJSONDot(value)
+	field, err := recordFieldFromString(value)
+	if err != nil {
+		return err
+	}
+	*f = field
 	return nil
 }
 
@@ -193,6 +201,20 @@ func (f RecordField) MarshalYAML() (interface{}, error) {
 	return toJSONDot(f), nil
 }
 
+// recordFieldFromString creates a record field from a field string, which may
+// use bracket syntax. Fields of labels or resource are an error.
+func recordFieldFromString(value string) (RecordField, error) {
+	field, err := fieldFromString(value)
+	if err != nil {
+		return RecordField{}, err
+	}
+	recordField, ok := field.FieldInterface.(RecordField)
+	if !ok {
+		return RecordField{}, fmt.Errorf("field %s is not a record field", value)
+	}
+	return recordField, nil
+}
+
 // fromJSONDot creates a field from JSON dot notation.
 func fromJSONDot(value string) RecordField {
 	keys := strings.Split(value, ".")
@@ -210,20 +232,19 @@ func toJSONDot(field RecordField) string {
 		return recordPrefix
 	}
 
-	containsDots := false
+	// A first key that starts with $ would be read as a prefix
+	useBrackets := strings.HasPrefix(field.Keys[0], "$")
 	for _, key := range field.Keys {
-		if strings.Contains(key, ".") {
-			containsDots = true
+		if needsBrackets(key) {
+			useBrackets = true
 		}
 	}
 
 	var b strings.Builder
-	if containsDots {
+	if useBrackets {
 		b.WriteString(recordPrefix)
 		for _, key := range field.Keys {
-			b.WriteString(`['`)
-			b.WriteString(key)
-			b.WriteString(`']`)
+			b.WriteString(bracketed(key))
 		}
 	} else {
 		for i, key := range field.Keys {
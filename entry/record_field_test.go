@@ -323,6 +323,20 @@ func TestRecordFieldUnmarshalJSONFailure(t *testing.T) {
 	require.Contains(t, err.Error(), "the field is not a string: json")
 }
 
+func TestRecordFieldUnmarshalJSONBrackets(t *testing.T) {
+	var f RecordField
+	err := json.Unmarshal([]byte(`"$record['k8s.pod'].name"`), &f)
+	require.NoError(t, err)
+	require.Equal(t, RecordField{Keys: []string{"k8s.pod", "name"}}, f)
+}
+
+func TestRecordFieldUnmarshalJSONNotRecord(t *testing.T) {
+	var f RecordField
+	err := json.Unmarshal([]byte(`"$labels.env"`), &f)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not a record field")
+}
+
 func TestRecordFieldMarshalYAML(t *testing.T) {
 	recordField := RecordField{Keys: []string{"test"}}
 	yaml, err := recordField.MarshalYAML()
@@ -2,7 +2,6 @@ package entry
 
 import (
 	"fmt"
-	"strings"
 )
 
 // ResourceField is the path to an entry's resource key
@@ -45,8 +44,8 @@ func (r ResourceField) Delete(entry *Entry) (interface{}, bool) {
 }
 
 func (r ResourceField) String() string {
-	if strings.Contains(r.key, ".") {
-		return fmt.Sprintf(`$resource['%s']`, r.key)
+	if needsBrackets(r.key) {
+		return "$resource" + bracketed(r.key)
 	}
 	return "$resource." + r.key
 }
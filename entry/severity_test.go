@@ -1,6 +1,7 @@
 package entry
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -20,3 +21,26 @@ func TestStringer(t *testing.T) {
 	require.Equal(t, "catastrophe", Catastrophe.String())
 	require.Equal(t, "12", Severity(12).String())
 }
+
+func TestSeverityOrder(t *testing.T) {
+	levels := []Severity{Default, Trace, Debug, Info, Notice, Warning, Error, Critical, Alert, Emergency, Catastrophe}
+	for i := 1; i < len(levels); i++ {
+		require.Less(t, int(levels[i-1]), int(levels[i]))
+	}
+
+	// Custom levels fall between the standard levels
+	require.Greater(t, int(Severity(55)), int(Warning))
+	require.Less(t, int(Severity(55)), int(Error))
+}
+
+func TestSeverityJSONRoundTrip(t *testing.T) {
+	for _, severity := range []Severity{Default, Warning, Severity(55), Catastrophe} {
+		entry := &Entry{Severity: severity, Record: "test"}
+		marshalled, err := json.Marshal(entry)
+		require.NoError(t, err)
+
+		var unmarshalled Entry
+		require.NoError(t, json.Unmarshal(marshalled, &unmarshalled))
+		require.Equal(t, severity, unmarshalled.Severity)
+	}
+}
@@ -0,0 +1,232 @@
+package entry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// EncodingJSON is the encoding of entries with encoding/json, which is used
+// by buffers and by most outputs
+const EncodingJSON = "json"
+
+// maxJSONEscape is the most bytes that escaping adds for each byte of a
+// string encoded as JSON, such as when < is encoded as \u003c
+const maxJSONEscape = 5
+
+// Size returns the exact size of an entry serialized with the named encoding.
+// It serializes the entry, so it is as slow as the encoding, and returns an
+// error if the entry cannot be serialized.
+func (entry *Entry) Size(encoding string) (int, error) {
+	switch encoding {
+	case EncodingJSON:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	default:
+		return 0, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// ApproximateSize returns the approximate size of an entry serialized with
+// the named encoding. Rather than serializing the entry, it walks its fields
+// and counts each string by its length, so it is much faster than Size.
+//
+// For EncodingJSON, the approximate size is exact, except for strings that
+// must be escaped, which are counted as if they were not. The approximate
+// size is never more than the exact size, and the exact size is at most the
+// approximate size plus maxJSONEscape bytes for each byte of the strings of
+// the entry, including map keys. Values that cannot be serialized, such as
+// NaN, are counted as if they could, and values of types other than those of
+// decoded JSON are serialized to count them.
+func (entry *Entry) ApproximateSize(encoding string) (int, error) {
+	switch encoding {
+	case EncodingJSON:
+		return approximateJSONSize(entry), nil
+	default:
+		return 0, fmt.Errorf("unknown encoding %q", encoding)
+	}
+}
+
+// approximateJSONSize counts the fields of an entry in the order that
+// encoding/json writes them
+func approximateJSONSize(entry *Entry) int {
+	// {"timestamp":...,"severity":...,"record":...}
+	size := len(`{"timestamp":,"severity":,"record":}`)
+	size += jsonTimeSize(entry.Timestamp)
+	size += jsonIntSize(int64(entry.Severity))
+	size += jsonValueSize(entry.Record)
+
+	if len(entry.Labels) > 0 {
+		size += len(`,"labels":`) + jsonStringMapSize(entry.Labels)
+	}
+	if len(entry.Resource) > 0 {
+		size += len(`,"resource":`) + jsonStringMapSize(entry.Resource)
+	}
+	if len(entry.TraceID) > 0 {
+		size += len(`,"trace_id":`) + jsonHexSize(entry.TraceID)
+	}
+	if len(entry.SpanID) > 0 {
+		size += len(`,"span_id":`) + jsonHexSize(entry.SpanID)
+	}
+	if len(entry.TraceFlags) > 0 {
+		size += len(`,"trace_flags":`) + jsonHexSize(entry.TraceFlags)
+	}
+	return size
+}
+
+func jsonValueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return len("null")
+	case bool:
+		if v {
+			return len("true")
+		}
+		return len("false")
+	case string:
+		return len(v) + 2
+	case []byte:
+		return jsonBytesSize(v)
+	case int:
+		return jsonIntSize(int64(v))
+	case int8:
+		return jsonIntSize(int64(v))
+	case int16:
+		return jsonIntSize(int64(v))
+	case int32:
+		return jsonIntSize(int64(v))
+	case int64:
+		return jsonIntSize(v)
+	case uint:
+		return jsonUintSize(uint64(v))
+	case uint8:
+		return jsonUintSize(uint64(v))
+	case uint16:
+		return jsonUintSize(uint64(v))
+	case uint32:
+		return jsonUintSize(uint64(v))
+	case uint64:
+		return jsonUintSize(v)
+	case float32:
+		return jsonFloatSize(float64(v), 32)
+	case float64:
+		return jsonFloatSize(v, 64)
+	case time.Time:
+		return jsonTimeSize(v)
+	case map[string]string:
+		return jsonStringMapSize(v)
+	case map[string]interface{}:
+		if v == nil {
+			return len("null")
+		}
+		size := 2
+		for key, item := range v {
+			size += len(key) + 3 + jsonValueSize(item)
+		}
+		if len(v) > 1 {
+			size += len(v) - 1
+		}
+		return size
+	case []string:
+		if v == nil {
+			return len("null")
+		}
+		size := 2
+		for _, item := range v {
+			size += len(item) + 2
+		}
+		if len(v) > 1 {
+			size += len(v) - 1
+		}
+		return size
+	case []interface{}:
+		if v == nil {
+			return len("null")
+		}
+		size := 2
+		for _, item := range v {
+			size += jsonValueSize(item)
+		}
+		if len(v) > 1 {
+			size += len(v) - 1
+		}
+		return size
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return 0
+		}
+		return len(data)
+	}
+}
+
+func jsonStringMapSize(m map[string]string) int {
+	if m == nil {
+		return len("null")
+	}
+	size := 2
+	for key, value := range m {
+		size += len(key) + len(value) + 5
+	}
+	if len(m) > 1 {
+		size += len(m) - 1
+	}
+	return size
+}
+
+func jsonBytesSize(b []byte) int {
+	if b == nil {
+		return len("null")
+	}
+	return base64.StdEncoding.EncodedLen(len(b)) + 2
+}
+
+func jsonHexSize(b HexBytes) int {
+	return 2*len(b) + 2
+}
+
+func jsonIntSize(i int64) int {
+	var buf [20]byte
+	return len(strconv.AppendInt(buf[:0], i, 10))
+}
+
+func jsonUintSize(u uint64) int {
+	var buf [20]byte
+	return len(strconv.AppendUint(buf[:0], u, 10))
+}
+
+// jsonFloatSize counts a float the way that encoding/json formats it
+func jsonFloatSize(f float64, bits int) int {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return len("null")
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	var buf [32]byte
+	b := strconv.AppendFloat(buf[:0], f, format, -1, bits)
+	if format == 'e' {
+		// encoding/json writes e-09 as e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			return n - 1
+		}
+	}
+	return len(b)
+}
+
+func jsonTimeSize(t time.Time) int {
+	var buf [64]byte
+	return len(t.AppendFormat(buf[:0], time.RFC3339Nano)) + 2
+}
@@ -0,0 +1,184 @@
+package entry
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSize(t *testing.T) {
+	cases := []struct {
+		name  string
+		entry *Entry
+	}{
+		{"Empty", &Entry{}},
+		{"StringRecord", &Entry{Record: "message"}},
+		{"MapRecord", &Entry{Record: map[string]interface{}{"a": "b", "c": 1, "d": []interface{}{true, nil, 1.5}}}},
+		{"Labels", &Entry{Labels: map[string]string{"env": "prod", "team": "ops"}, Record: "message"}},
+		{"Resource", &Entry{Resource: map[string]string{"host": "server1"}}},
+		{"Trace", &Entry{TraceID: []byte{1, 2, 3, 4, 5}, SpanID: []byte{1}, TraceFlags: []byte{}}},
+		{"Floats", &Entry{Record: []interface{}{0.0, -1e-7, 1e21, 123456.789, float32(1e-7), float32(3.25)}}},
+		{"Integers", &Entry{Record: []interface{}{math.MinInt64, uint64(math.MaxUint64), int8(-8), uint16(16)}}},
+		{"Time", &Entry{Timestamp: time.Date(2020, 10, 1, 12, 0, 0, 123, time.FixedZone("", 3600)), Record: time.Unix(0, 0).UTC()}},
+		{"OtherType", &Entry{Record: struct{ A int }{1}}},
+		{"NilValues", &Entry{Record: map[string]interface{}{"m": map[string]interface{}(nil), "l": []interface{}(nil), "s": []string(nil), "b": []byte(nil)}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			exact, err := tc.entry.Size(EncodingJSON)
+			require.NoError(t, err)
+			approximate, err := tc.entry.ApproximateSize(EncodingJSON)
+			require.NoError(t, err)
+			require.Equal(t, exact, approximate)
+		})
+	}
+}
+
+func TestSizeUnknownEncoding(t *testing.T) {
+	_, err := New().Size("xml")
+	require.Error(t, err)
+	_, err = New().ApproximateSize("xml")
+	require.Error(t, err)
+}
+
+func TestSizeUnserializable(t *testing.T) {
+	entry := &Entry{Record: math.NaN()}
+	_, err := entry.Size(EncodingJSON)
+	require.Error(t, err)
+
+	approximate, err := entry.ApproximateSize(EncodingJSON)
+	require.NoError(t, err)
+	require.Greater(t, approximate, 0)
+}
+
+// TestApproximateSizeBound checks that the approximate size of randomized
+// entries is within the documented bound of their exact size, and equal to it
+// when no string must be escaped
+func TestApproximateSizeBound(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		escape := i%2 == 0
+		g := &entryGenerator{rand: r, escape: escape}
+		entry := g.entry()
+
+		exact, err := entry.Size(EncodingJSON)
+		require.NoError(t, err)
+		approximate, err := entry.ApproximateSize(EncodingJSON)
+		require.NoError(t, err)
+
+		require.LessOrEqual(t, approximate, exact, "entry %d", i)
+		require.LessOrEqual(t, exact, approximate+maxJSONEscape*g.stringBytes, "entry %d", i)
+		if !escape {
+			require.Equal(t, exact, approximate, "entry %d", i)
+		}
+	}
+}
+
+// entryGenerator generates random entries, and counts the bytes of their strings
+type entryGenerator struct {
+	rand        *rand.Rand
+	escape      bool
+	stringBytes int
+}
+
+func (g *entryGenerator) entry() *Entry {
+	e := &Entry{
+		Timestamp: time.Unix(g.rand.Int63n(1<<33), g.rand.Int63n(1e9)),
+		Severity:  Severity(g.rand.Intn(120)),
+		Record:    g.value(3),
+	}
+	if g.rand.Intn(2) == 0 {
+		e.Labels = g.stringMap()
+	}
+	if g.rand.Intn(2) == 0 {
+		e.Resource = g.stringMap()
+	}
+	if g.rand.Intn(2) == 0 {
+		e.TraceID = g.bytes()
+		e.SpanID = g.bytes()
+		e.TraceFlags = g.bytes()
+	}
+	return e
+}
+
+func (g *entryGenerator) value(depth int) interface{} {
+	kinds := 8
+	if depth > 0 {
+		kinds = 10
+	}
+	switch g.rand.Intn(kinds) {
+	case 0:
+		return nil
+	case 1:
+		return g.rand.Intn(2) == 0
+	case 2:
+		return g.string()
+	case 3:
+		return g.rand.Int63() - g.rand.Int63()
+	case 4:
+		return g.rand.Uint64()
+	case 5:
+		return g.float()
+	case 6:
+		return g.bytes()
+	case 7:
+		return float32(g.float())
+	case 8:
+		m := make(map[string]interface{})
+		for i := g.rand.Intn(5); i > 0; i-- {
+			m[g.string()] = g.value(depth - 1)
+		}
+		return m
+	default:
+		l := make([]interface{}, g.rand.Intn(5))
+		for i := range l {
+			l[i] = g.value(depth - 1)
+		}
+		return l
+	}
+}
+
+func (g *entryGenerator) float() float64 {
+	f := g.rand.NormFloat64() * math.Pow(10, float64(g.rand.Intn(60)-30))
+	if g.rand.Intn(4) == 0 {
+		return math.Round(f)
+	}
+	return f
+}
+
+func (g *entryGenerator) stringMap() map[string]string {
+	m := make(map[string]string)
+	for i := g.rand.Intn(5); i > 0; i-- {
+		m[g.string()] = g.string()
+	}
+	return m
+}
+
+func (g *entryGenerator) bytes() []byte {
+	b := make([]byte, g.rand.Intn(20))
+	g.rand.Read(b)
+	return b
+}
+
+// string returns a random string. Strings that must be escaped include
+// quotes, control characters, HTML characters, line separators, and invalid
+// UTF-8.
+func (g *entryGenerator) string() string {
+	plain := []string{"a", "B", "7", " ", "é", "日本", "_", "."}
+	escaped := []string{`"`, `\`, "\n", "\t", "\x00", "<", ">", "&", "\u2028", "\xff"}
+
+	var s string
+	for i := g.rand.Intn(12); i > 0; i-- {
+		if g.escape && g.rand.Intn(3) == 0 {
+			s += escaped[g.rand.Intn(len(escaped))]
+		} else {
+			s += plain[g.rand.Intn(len(plain))]
+		}
+	}
+	g.stringBytes += len(s)
+	return s
+}
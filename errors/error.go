@@ -1,8 +1,10 @@
 package errors
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"go.uber.org/zap/zapcore"
 )
@@ -19,8 +21,13 @@ func (e AgentError) Error() string {
 	if len(e.Details) == 0 {
 		return e.Description
 	}
-	marshalled, _ := json.Marshal(e.Details)
-	return fmt.Sprintf("%s: %s", e.Description, string(marshalled))
+	// HTML characters are not escaped, so a detail such as a cycle of
+	// operators reads as a -> b rather than a -\u003e b
+	var marshalled bytes.Buffer
+	encoder := json.NewEncoder(&marshalled)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(e.Details)
+	return fmt.Sprintf("%s: %s", e.Description, strings.TrimSuffix(marshalled.String(), "\n"))
 }
 
 // MarshalLogObject will define the representation of this error when logging.
@@ -7,6 +7,7 @@ import (
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 )
 
 // Buffer is an interface for an entry buffer
@@ -17,6 +18,26 @@ type Buffer interface {
 	Close() error
 }
 
+// Recovery returns a summary of the entries a buffer restored when it was
+// built, or nil if the buffer does not report its restored state
+func Recovery(b Buffer) *helper.RecoveryReport {
+	reporter, ok := b.(helper.RecoveryReporter)
+	if !ok {
+		return nil
+	}
+	return reporter.RecoveryReport()
+}
+
+// SaveState persists the state a buffer resumes from after a restart, without
+// closing it. Buffers that do not persist their state return immediately.
+func SaveState(b Buffer) error {
+	saver, ok := b.(helper.StateSaver)
+	if !ok {
+		return nil
+	}
+	return saver.SaveState()
+}
+
 // Config is a struct that wraps a Builder
 type Config struct {
 	Builder
@@ -38,15 +59,15 @@ type Builder interface {
 func (bc *Config) UnmarshalJSON(data []byte) error {
 	return bc.unmarshal(func(dst interface{}) error {
 		return json.Unmarshal(data, dst)
-	})
+	}, operator.UnmarshalRenamedJSON)
 }
 
 // UnmarshalYAML unmarshals YAML
 func (bc *Config) UnmarshalYAML(f func(interface{}) error) error {
-	return bc.unmarshal(f)
+	return bc.unmarshal(f, operator.UnmarshalRenamedYAML)
 }
 
-func (bc *Config) unmarshal(unmarshal func(interface{}) error) error {
+func (bc *Config) unmarshal(unmarshal func(interface{}) error, unmarshalRenamed func(map[string]interface{}, interface{}) error) error {
 	var m map[string]interface{}
 	err := unmarshal(&m)
 	if err != nil {
@@ -56,13 +77,20 @@ func (bc *Config) unmarshal(unmarshal func(interface{}) error) error {
 	switch m["type"] {
 	case "memory":
 		bc.Builder = NewMemoryBufferConfig()
-		return unmarshal(bc.Builder)
 	case "disk":
 		bc.Builder = NewDiskBufferConfig()
-		return unmarshal(bc.Builder)
 	default:
 		return fmt.Errorf("unknown buffer type '%s'", m["type"])
 	}
+
+	renamed, err := operator.RenameDeprecatedFields(m, bc.Builder, "buffer.")
+	if err != nil {
+		return err
+	}
+	if renamed {
+		return unmarshalRenamed(m, bc.Builder)
+	}
+	return unmarshal(bc.Builder)
 }
 
 func (bc Config) MarshalYAML() (interface{}, error) {
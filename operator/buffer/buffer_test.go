@@ -3,6 +3,9 @@ package buffer
 import (
 	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
 
 	"github.com/stretchr/testify/require"
 	yaml "gopkg.in/yaml.v2"
@@ -28,30 +31,90 @@ func TestBufferUnmarshalYAML(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"MemoryFlush",
+			[]byte("type: memory\nmax_entries: 30\nflush_max_entries: 100\nflush_max_bytes: 65536\nflush_interval: 5s\n"),
+			[]byte(`{"type": "memory", "max_entries": 30, "flush_max_entries": 100, "flush_max_bytes": 65536, "flush_interval": "5s"}`),
+			Config{
+				Builder: &MemoryBufferConfig{
+					Type:       "memory",
+					MaxEntries: 30,
+					FlushConfig: FlushConfig{
+						FlushMaxEntries: 100,
+						FlushMaxBytes:   65536,
+						FlushInterval:   helper.Duration{Duration: 5 * time.Second},
+					},
+				},
+			},
+			false,
+		},
 		{
 			"SimpleDisk",
+			[]byte("type: disk\nmax_bytes: 1234\npath: /var/log/testpath\n"),
+			[]byte(`{"type": "disk", "max_bytes": 1234, "path": "/var/log/testpath"}`),
+			Config{
+				Builder: &DiskBufferConfig{
+					Type:             "disk",
+					MaxBytes:         1234,
+					Path:             "/var/log/testpath",
+					Sync:             true,
+					CompactThreshold: 0.5,
+					CompactInterval:  helper.Duration{Duration: 5 * time.Second},
+				},
+			},
+			false,
+		},
+		{
+			"DiskCompaction",
+			[]byte("type: disk\npath: /var/log/testpath\ncompact_threshold: 2\ncompact_interval: 1m\n"),
+			[]byte(`{"type": "disk", "path": "/var/log/testpath", "compact_threshold": 2, "compact_interval": "1m"}`),
+			Config{
+				Builder: &DiskBufferConfig{
+					Type:             "disk",
+					MaxBytes:         1 << 32,
+					Path:             "/var/log/testpath",
+					Sync:             true,
+					CompactThreshold: 2,
+					CompactInterval:  helper.Duration{Duration: time.Minute},
+				},
+			},
+			false,
+		},
+		{
+			"DeprecatedMaxSize",
 			[]byte("type: disk\nmax_size: 1234\npath: /var/log/testpath\n"),
 			[]byte(`{"type": "disk", "max_size": 1234, "path": "/var/log/testpath"}`),
 			Config{
 				Builder: &DiskBufferConfig{
-					Type:    "disk",
-					MaxSize: 1234,
-					Path:    "/var/log/testpath",
-					Sync:    true,
+					Type:             "disk",
+					MaxBytes:         1234,
+					Path:             "/var/log/testpath",
+					Sync:             true,
+					CompactThreshold: 0.5,
+					CompactInterval:  helper.Duration{Duration: 5 * time.Second},
 				},
 			},
 			false,
 		},
+		{
+			"DeprecatedAndReplacement",
+			[]byte("type: disk\nmax_size: 1234\nmax_bytes: 1234\npath: /var/log/testpath\n"),
+			[]byte(`{"type": "disk", "max_size": 1234, "max_bytes": 1234, "path": "/var/log/testpath"}`),
+			Config{},
+			true,
+		},
 		{
 			"UnknownType",
 			[]byte("type: invalid\n"),
 			[]byte(`{"type": "invalid"}`),
 			Config{
 				Builder: &DiskBufferConfig{
-					Type:    "disk",
-					MaxSize: 1234,
-					Path:    "/var/log/testpath",
-					Sync:    true,
+					Type:             "disk",
+					MaxBytes:         1234,
+					Path:             "/var/log/testpath",
+					Sync:             true,
+					CompactThreshold: 0.5,
+					CompactInterval:  helper.Duration{Duration: 5 * time.Second},
 				},
 			},
 			true,
@@ -62,10 +125,12 @@ func TestBufferUnmarshalYAML(t *testing.T) {
 			[]byte(`{"type": 12}`),
 			Config{
 				Builder: &DiskBufferConfig{
-					Type:    "disk",
-					MaxSize: 1234,
-					Path:    "/var/log/testpath",
-					Sync:    true,
+					Type:             "disk",
+					MaxBytes:         1234,
+					Path:             "/var/log/testpath",
+					Sync:             true,
+					CompactThreshold: 0.5,
+					CompactInterval:  helper.Duration{Duration: 5 * time.Second},
 				},
 			},
 			true,
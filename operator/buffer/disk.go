@@ -1,9 +1,8 @@
 package buffer
 
 import (
-	"bytes"
+	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +12,7 @@ import (
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -20,8 +20,8 @@ import (
 type DiskBufferConfig struct {
 	Type string `json:"type" yaml:"type"`
 
-	// MaxSize is the maximum size in bytes of the data file on disk
-	MaxSize int64 `json:"max_size" yaml:"max_size"`
+	// MaxBytes is the maximum size in bytes of the data file on disk
+	MaxBytes int64 `json:"max_bytes" yaml:"max_bytes"`
 
 	// Path is a path to a directory which contains the data and metadata files
 	Path string `json:"path" yaml:"path"`
@@ -30,14 +30,36 @@ type DiskBufferConfig struct {
 	// in cases like power failures or unclean shutdowns, logs may be lost or the
 	// database may become corrupted.
 	Sync bool `json:"sync" yaml:"sync"`
+
+	// CompactThreshold is the ratio of flushed bytes to unflushed bytes in the data
+	// file at which the flushed entries are removed from the file
+	CompactThreshold float64 `json:"compact_threshold" yaml:"compact_threshold"`
+
+	// CompactInterval is the minimum time between compactions, and the interval at
+	// which the buffer checks whether it should be compacted
+	CompactInterval helper.Duration `json:"compact_interval" yaml:"compact_interval"`
+
+	// WhenFull is the policy applied when an entry is added to a full buffer
+	WhenFull string `json:"when_full,omitempty" yaml:"when_full,omitempty"`
+
+	FlushConfig `yaml:",inline"`
 }
 
 // NewDiskBufferConfig creates a new default disk buffer config
 func NewDiskBufferConfig() *DiskBufferConfig {
 	return &DiskBufferConfig{
-		Type:    "disk",
-		MaxSize: 1 << 32, // 4GiB
-		Sync:    true,
+		Type:             "disk",
+		MaxBytes:         1 << 32, // 4GiB
+		Sync:             true,
+		CompactThreshold: defaultCompactThreshold,
+		CompactInterval:  helper.Duration{Duration: defaultCompactInterval},
+	}
+}
+
+// DeprecatedFields returns the renamed fields of a DiskBufferConfig
+func (c DiskBufferConfig) DeprecatedFields() []operator.DeprecatedField {
+	return []operator.DeprecatedField{
+		{Name: "max_size", Replacement: "max_bytes"},
 	}
 }
 
@@ -46,21 +68,47 @@ func (c DiskBufferConfig) Build(context operator.BuildContext, _ string) (Buffer
 	if c.Path == "" {
 		return nil, fmt.Errorf("missing required field 'path'")
 	}
-	b := NewDiskBuffer(c.MaxSize)
+	if err := c.FlushConfig.validate(); err != nil {
+		return nil, err
+	}
+	if c.CompactThreshold < 0 {
+		return nil, fmt.Errorf("compact_threshold must not be negative")
+	}
+	if c.CompactInterval.Raw() <= 0 {
+		return nil, fmt.Errorf("compact_interval must be greater than zero")
+	}
+	if err := validateWhenFull(c.WhenFull); err != nil {
+		return nil, err
+	}
+	b := NewDiskBuffer(c.MaxBytes)
+	b.policy = c.WhenFull
+	b.flush = c.FlushConfig
+	b.compactThreshold = c.CompactThreshold
+	b.compactInterval = c.CompactInterval.Raw()
 	if err := b.Open(c.Path, c.Sync); err != nil {
 		return nil, err
 	}
 	return b, nil
 }
 
+const (
+	// defaultCompactThreshold compacts the data file once the flushed entries take
+	// up a third of it
+	defaultCompactThreshold = 0.5
+
+	// defaultCompactInterval is the default minimum time between compactions
+	defaultCompactInterval = 5 * time.Second
+)
+
 // DiskBuffer is a buffer for storing entries on disk until they are flushed to their
 // final destination.
 type DiskBuffer struct {
 	// Metadata holds information about the current state of the buffered entries
 	metadata *Metadata
 
-	// Data is the file that stores the buffered entries
-	data *os.File
+	// Data is the file that stores the buffered entries, as records
+	data      *os.File
+	dataFlags int
 	sync.Mutex
 
 	// atEnd indicates whether the data file descriptor is currently seeked to the
@@ -77,6 +125,17 @@ type DiskBuffer struct {
 	flushedBytes   int64
 	lastCompaction time.Time
 
+	// compactThreshold is the ratio of flushed bytes to unflushed bytes at which
+	// the data file is compacted
+	compactThreshold float64
+
+	// compactInterval is the minimum time between compactions. The compactor
+	// checks at this interval whether the data file should be compacted, so that
+	// the file shrinks once the buffer drains, even if nothing else is flushed.
+	compactInterval time.Duration
+	stopCompactor   chan struct{}
+	compactorWG     sync.WaitGroup
+
 	// readerLock ensures that there is only ever one reader listening to the
 	// entryAdded channel at a time.
 	readerLock sync.Mutex
@@ -87,6 +146,22 @@ type DiskBuffer struct {
 
 	// copyBuffer is a pre-allocated byte slice that is used during compaction
 	copyBuffer []byte
+
+	// recovery summarizes the entries restored when the buffer was opened
+	recovery *helper.RecoveryReport
+
+	// unreadBytes is the size on disk of the unread entries
+	unreadBytes int64
+
+	// added and flushed count the entries that went through the buffer
+	added   uint64
+	flushed uint64
+
+	// flush holds the thresholds at which a batch of entries is released
+	flush FlushConfig
+
+	// dropCounter counts the entries dropped by the when_full policy
+	*dropCounter
 }
 
 // NewDiskBuffer creates a new DiskBuffer
@@ -96,6 +171,9 @@ func NewDiskBuffer(maxDiskSize int64) *DiskBuffer {
 		entryAdded:        make(chan int64, 1),
 		copyBuffer:        make([]byte, 1<<16),
 		diskSizeSemaphore: semaphore.NewWeighted(int64(maxDiskSize)),
+		compactThreshold:  defaultCompactThreshold,
+		compactInterval:   defaultCompactInterval,
+		dropCounter:       &dropCounter{},
 	}
 }
 
@@ -103,11 +181,11 @@ func NewDiskBuffer(maxDiskSize int64) *DiskBuffer {
 func (d *DiskBuffer) Open(path string, sync bool) error {
 	var err error
 	dataPath := filepath.Join(path, "data")
-	flags := os.O_CREATE | os.O_RDWR
+	d.dataFlags = os.O_CREATE | os.O_RDWR
 	if sync {
-		flags |= os.O_SYNC
+		d.dataFlags |= os.O_SYNC
 	}
-	if d.data, err = os.OpenFile(dataPath, flags, 0755); err != nil {
+	if d.data, err = os.OpenFile(dataPath, d.dataFlags, 0755); err != nil {
 		return err
 	}
 
@@ -140,11 +218,110 @@ func (d *DiskBuffer) Open(path string, sync bool) error {
 	d.metadata.unreadStartOffset = 0
 	d.addUnreadCount(int64(len(d.metadata.read)))
 	d.metadata.read = d.metadata.read[:0]
-	return d.metadata.Sync()
+
+	// The unread count is only synced with the metadata, so the records that
+	// survived in the data file are counted again
+	discarded, err := d.recoverRecords()
+	if err != nil {
+		return err
+	}
+	if err = d.metadata.Sync(); err != nil {
+		return err
+	}
+
+	if info, err = d.data.Stat(); err != nil {
+		return err
+	}
+	d.unreadBytes = info.Size()
+	d.added = uint64(d.metadata.unreadCount)
+
+	if d.recovery, err = d.readRecovery(); err != nil {
+		return err
+	}
+	d.recovery.Discarded = discarded
+
+	d.startCompactor()
+	return nil
+}
+
+// startCompactor starts checking at the compaction interval whether the data
+// file should be compacted
+func (d *DiskBuffer) startCompactor() {
+	d.stopCompactor = make(chan struct{})
+	d.compactorWG.Add(1)
+	go func() {
+		defer d.compactorWG.Done()
+		ticker := time.NewTicker(d.compactInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stopCompactor:
+				return
+			case <-ticker.C:
+				// An error is returned again by the next compaction or flush,
+				// which reports it
+				_ = d.checkCompact()
+			}
+		}
+	}()
+}
+
+// readRecovery summarizes the unread entries found when the buffer was opened
+func (d *DiskBuffer) readRecovery() (*helper.RecoveryReport, error) {
+	info, err := d.data.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &helper.RecoveryReport{
+		BufferedEntries: d.metadata.unreadCount,
+		BufferedBytes:   info.Size(),
+	}
+	if report.BufferedEntries == 0 {
+		return report, nil
+	}
+
+	if err := d.seekToUnread(); err != nil {
+		return nil, fmt.Errorf("seek to unread: %s", err)
+	}
+
+	var oldest entry.Entry
+	if _, err := decodeRecord(d.data, info.Size(), &oldest); err != nil {
+		return nil, fmt.Errorf("decode oldest entry: %s", err)
+	}
+	report.OldestBuffered = oldest.Timestamp
+	return report, nil
+}
+
+// RecoveryReport returns a summary of the entries restored when the buffer was opened
+func (d *DiskBuffer) RecoveryReport() *helper.RecoveryReport {
+	return d.recovery
+}
+
+// SaveState writes the current metadata to disk, and syncs the metadata and
+// data files, so that the buffer resumes from its current read position if
+// the process is killed before it is closed
+func (d *DiskBuffer) SaveState() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.metadata.Sync(); err != nil {
+		return err
+	}
+	if err := d.metadata.file.Sync(); err != nil {
+		return err
+	}
+	return d.data.Sync()
 }
 
 // Close flushes the current metadata to disk, then closes the underlying files
 func (d *DiskBuffer) Close() error {
+	if d.stopCompactor != nil {
+		close(d.stopCompactor)
+		d.compactorWG.Wait()
+		d.stopCompactor = nil
+	}
+
 	d.Lock()
 	defer d.Unlock()
 
@@ -154,18 +331,30 @@ func (d *DiskBuffer) Close() error {
 	return d.data.Close()
 }
 
-// Add adds an entry to the buffer, blocking until it is either added or the context
-// is cancelled.
+// Add adds an entry to the buffer. If the buffer is full, it blocks until the entry
+// is either added or the context is cancelled, or drops an entry, depending on the
+// when_full policy.
 func (d *DiskBuffer) Add(ctx context.Context, newEntry *entry.Entry) error {
-	var buf bytes.Buffer
-	var err error
-	enc := json.NewEncoder(&buf)
-	if err := enc.Encode(newEntry); err != nil {
+	record, err := encodeRecord(newEntry)
+	if err != nil {
 		return err
 	}
+	size := int64(len(record))
 
-	if err = d.diskSizeSemaphore.Acquire(ctx, int64(buf.Len())); err != nil {
-		return err
+	switch d.policy {
+	case WhenFullDropNewest, WhenFullDropOldest:
+		acquired, err := d.tryAcquire(size)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			d.drop(1, false)
+			return nil
+		}
+	default:
+		if err = d.diskSizeSemaphore.Acquire(ctx, size); err != nil {
+			return err
+		}
 	}
 
 	d.Lock()
@@ -176,15 +365,98 @@ func (d *DiskBuffer) Add(ctx context.Context, newEntry *entry.Entry) error {
 		return err
 	}
 
-	if _, err = d.data.Write(buf.Bytes()); err != nil {
+	if _, err = d.data.Write(record); err != nil {
 		return err
 	}
 
+	d.unreadBytes += size
+	d.added++
 	d.addUnreadCount(1)
 
 	return nil
 }
 
+// tryAcquire reserves space for an entry of the given size without blocking. With
+// the drop_oldest policy, the oldest unread entries are dropped to make space.
+// It returns false if there is no space for the entry.
+func (d *DiskBuffer) tryAcquire(size int64) (bool, error) {
+	if d.diskSizeSemaphore.TryAcquire(size) {
+		return true, nil
+	}
+
+	// Reclaim the space of flushed entries before dropping any
+	d.Lock()
+	flushed := d.flushedBytes > 0
+	d.Unlock()
+	if flushed {
+		if err := d.Compact(); err != nil {
+			return false, err
+		}
+		if d.diskSizeSemaphore.TryAcquire(size) {
+			return true, nil
+		}
+	}
+
+	if d.policy != WhenFullDropOldest {
+		return false, nil
+	}
+
+	// Entries that were read are in flight, and only their space can be reclaimed
+	// once they are flushed, so only unread entries are dropped
+	dropped, err := d.dropOldest(size)
+	if err != nil {
+		return false, err
+	}
+	if dropped == 0 {
+		return false, nil
+	}
+	d.drop(dropped, true)
+
+	if err := d.Compact(); err != nil {
+		return false, err
+	}
+	return d.diskSizeSemaphore.TryAcquire(size), nil
+}
+
+// dropOldest drops the oldest unread entries until at least size bytes are
+// dropped or there are no unread entries left, and returns the number of entries
+// dropped. The dropped entries are skipped by the read cursor and marked as
+// flushed, so they are never read and their space is reclaimed by the next compaction.
+func (d *DiskBuffer) dropOldest(size int64) (uint64, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.metadata.unreadCount == 0 {
+		return 0, nil
+	}
+	if err := d.seekToUnread(); err != nil {
+		return 0, fmt.Errorf("seek to unread: %s", err)
+	}
+
+	rd := bufio.NewReader(d.data)
+	var droppedBytes int64
+	var dropped []*readEntry
+	for droppedBytes < size && int64(len(dropped)) < d.metadata.unreadCount {
+		record, err := readRecord(rd, d.unreadBytes-droppedBytes)
+		if err != nil {
+			return 0, fmt.Errorf("read unread entry: %s", err)
+		}
+		dropped = append(dropped, &readEntry{
+			startOffset: d.metadata.unreadStartOffset + droppedBytes,
+			length:      int64(len(record)),
+			flushed:     true,
+		})
+		droppedBytes += int64(len(record))
+	}
+
+	d.metadata.unreadStartOffset += droppedBytes
+	d.metadata.read = append(d.metadata.read, dropped...)
+	d.flushedBytes += droppedBytes
+	d.unreadBytes -= droppedBytes
+	d.addUnreadCount(-int64(len(dropped)))
+	return uint64(len(dropped)), nil
+}
+
 // addUnreadCount adds i to the unread count and notifies any callers of
 // ReadWait that an entry has been added. The disk buffer lock must be held when
 // calling this.
@@ -201,19 +473,23 @@ func (d *DiskBuffer) addUnreadCount(i int64) {
 }
 
 // ReadWait reads entries from the buffer, waiting until either there are enough entries in the
-// buffer to fill dst or the context is cancelled. This amortizes the cost of reading from the
-// disk. It returns a function that, when called, marks the read entries as flushed, the
-// number of entries read, and an error.
+// buffer to fill dst, a flush threshold is hit, or the context is cancelled. This amortizes the
+// cost of reading from the disk. It returns a function that, when called, marks the read entries
+// as flushed, the number of entries read, and an error.
 func (d *DiskBuffer) ReadWait(ctx context.Context, dst []*entry.Entry) (FlushFunc, int, error) {
 	d.readerLock.Lock()
 	defer d.readerLock.Unlock()
 
+	ctx, cancel := d.flush.withInterval(ctx)
+	defer cancel()
+	dst = d.flush.limit(dst)
+
 	// Wait until the timeout is hit, or there are enough unread entries to fill the destination buffer
 LOOP:
 	for {
 		select {
 		case n := <-d.entryAdded:
-			if n >= int64(len(dst)) {
+			if n >= int64(len(dst)) || d.unreadBytesFull() {
 				break LOOP
 			}
 		case <-ctx.Done():
@@ -224,11 +500,20 @@ LOOP:
 	return d.Read(dst)
 }
 
-// Read copies entries from the disk into the destination buffer. It returns a function that,
-// when called, marks the entries as flushed, the number of entries read, and an error.
+// unreadBytesFull returns true if the unread entries hit the byte threshold of a batch
+func (d *DiskBuffer) unreadBytesFull() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.flush.fullBytes(d.unreadBytes)
+}
+
+// Read copies entries from the disk into the destination buffer, until it is full or a flush
+// threshold is hit. It returns a function that, when called, marks the entries as flushed, the
+// number of entries read, and an error.
 func (d *DiskBuffer) Read(dst []*entry.Entry) (f FlushFunc, i int, err error) {
 	d.Lock()
 	defer d.Unlock()
+	dst = d.flush.limit(dst)
 
 	// Return fast if there are no unread entries
 	if d.metadata.unreadCount == 0 {
@@ -243,27 +528,31 @@ func (d *DiskBuffer) Read(dst []*entry.Entry) (f FlushFunc, i int, err error) {
 	readCount := min(len(dst), int(d.metadata.unreadCount))
 	newRead := make([]*readEntry, readCount)
 
-	dec := json.NewDecoder(d.data)
+	rd := bufio.NewReader(d.data)
 	startOffset := d.metadata.unreadStartOffset
+	var size int64
 	for i := 0; i < readCount; i++ {
+		if d.flush.fullBytes(size) {
+			readCount = i
+			newRead = newRead[:i]
+			break
+		}
+
 		// Decode an entry from the file
 		var entry entry.Entry
-		err := dec.Decode(&entry)
+		length, err := decodeRecord(rd, d.unreadBytes-size, &entry)
 		if err != nil {
 			return nil, 0, fmt.Errorf("decode: %s", err)
 		}
 		dst[i] = &entry
-
-		// Calculate the end offset of the entry. We add one because
-		// the decoder doesn't consume the newline at the end of every entry
-		endOffset := d.metadata.unreadStartOffset + dec.InputOffset() + 1
 		newRead[i] = &readEntry{
 			startOffset: startOffset,
-			length:      endOffset - startOffset,
+			length:      length,
 		}
 
 		// The start offset of the next entry is the end offset of the current
-		startOffset = endOffset
+		startOffset += length
+		size += length
 	}
 
 	// Set the offset for the next unread entry
@@ -273,11 +562,17 @@ func (d *DiskBuffer) Read(dst []*entry.Entry) (f FlushFunc, i int, err error) {
 	d.metadata.read = append(d.metadata.read, newRead...)
 
 	// Remove the read entries from the unread count
+	d.unreadBytes -= size
 	d.addUnreadCount(-int64(readCount))
 
 	return d.newFlushFunc(newRead), readCount, nil
 }
 
+// FlushInterval returns the maximum time that ReadWait waits for a batch to fill
+func (d *DiskBuffer) FlushInterval() time.Duration {
+	return d.flush.FlushInterval.Raw()
+}
+
 // newFlushFunc returns a function that marks read entries as flushed
 func (d *DiskBuffer) newFlushFunc(newRead []*readEntry) FlushFunc {
 	return func() error {
@@ -286,28 +581,73 @@ func (d *DiskBuffer) newFlushFunc(newRead []*readEntry) FlushFunc {
 			entry.flushed = true
 			d.flushedBytes += entry.length
 		}
+		d.flushed += uint64(len(newRead))
 		d.Unlock()
 		return d.checkCompact()
 	}
 }
 
-// checkCompact checks if a compaction should be performed, then kicks one off
+// Stats returns the depth of the buffer. The entries that were flushed, or
+// dropped to make room, take space in the data file until it is compacted.
+func (d *DiskBuffer) Stats() Stats {
+	d.Lock()
+	defer d.Unlock()
+
+	entries := d.metadata.unreadCount
+	for _, read := range d.metadata.read {
+		if !read.flushed {
+			entries++
+		}
+	}
+
+	var fileBytes int64
+	if info, err := d.data.Stat(); err == nil {
+		fileBytes = info.Size()
+	}
+
+	return Stats{
+		Type:      "disk",
+		Entries:   entries,
+		MaxBytes:  d.maxBytes,
+		Bytes:     fileBytes - d.flushedBytes,
+		FileBytes: fileBytes,
+		Added:     d.added,
+		Flushed:   d.flushed,
+		Dropped:   d.Dropped(),
+	}
+}
+
+// checkCompact checks if a compaction should be performed, then kicks one off. The data file is
+// compacted if the flushed entries take up more than half of the max size, or if the ratio of
+// flushed bytes to unflushed bytes exceeds the threshold and the last compaction was at least
+// the compaction interval ago.
 func (d *DiskBuffer) checkCompact() error {
 	d.Lock()
-	switch {
-	case d.flushedBytes > d.maxBytes/2:
-		fallthrough
-	case time.Since(d.lastCompaction) > 5*time.Second:
-		d.Unlock()
-		if err := d.Compact(); err != nil {
+	compact := d.flushedBytes > d.maxBytes/2
+	if !compact && d.flushedBytes > 0 && time.Since(d.lastCompaction) >= d.compactInterval {
+		info, err := d.data.Stat()
+		if err != nil {
+			d.Unlock()
 			return err
 		}
-	default:
-		d.Unlock()
+		compact = exceedsRatio(d.flushedBytes, info.Size()-d.flushedBytes, d.compactThreshold)
+	}
+	d.Unlock()
+
+	if compact {
+		return d.Compact()
 	}
 	return nil
 }
 
+// exceedsRatio returns true if the ratio of dead bytes to live bytes is greater than the threshold
+func exceedsRatio(dead, live int64, threshold float64) bool {
+	if live <= 0 {
+		return dead > 0
+	}
+	return float64(dead)/float64(live) > threshold
+}
+
 // Compact removes all flushed entries from disk
 func (d *DiskBuffer) Compact() error {
 	d.Lock()
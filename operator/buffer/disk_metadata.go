@@ -8,6 +8,10 @@ import (
 	"os"
 )
 
+// metadataVersion is the version of a data file of records. Version 1 data
+// files hold one JSON entry per line.
+const metadataVersion = 2
+
 // Metadata is a representation of the on-disk metadata file. It contains
 // information about the layout, location, and flushed status of entries
 // stored in the data file
@@ -15,7 +19,8 @@ type Metadata struct {
 	// File is a handle to the on-disk metadata store
 	//
 	// The layout of the file is as follows:
-	// - 8 byte DatabaseVersion as LittleEndian int64
+	// - 8 byte DatabaseVersion as LittleEndian int64, metadataVersion when the
+	//   data file holds records
 	// - 8 byte DeadRangeStartOffset as LittleEndian int64
 	// - 8 byte DeadRangeLength as LittleEndian int64
 	// - 8 byte UnreadStartOffset as LittleEndian int64
@@ -27,6 +32,9 @@ type Metadata struct {
 	//     - 8 byte StartOffset as LittleEndian int64
 	file *os.File
 
+	// version is the version of the layout of the data file
+	version int64
+
 	// read is the collection of entries that have been read
 	read []*readEntry
 
@@ -71,6 +79,7 @@ func OpenMetadata(path string, sync bool) (*Metadata, error) {
 			return &Metadata{}, fmt.Errorf("read metadata file: %s", err)
 		}
 	} else {
+		m.version = metadataVersion
 		m.read = make([]*readEntry, 0, 1000)
 	}
 
@@ -130,8 +139,8 @@ func (m *Metadata) setDeadRange(start, length int64) error {
 
 // MarshalBinary marshals a metadata struct to a binary stream
 func (m *Metadata) MarshalBinary(wr io.Writer) (err error) {
-	// Version (currently unused)
-	if err = binary.Write(wr, binary.LittleEndian, int64(1)); err != nil {
+	// Version
+	if err = binary.Write(wr, binary.LittleEndian, m.version); err != nil {
 		return
 	}
 
@@ -166,8 +175,7 @@ func (m *Metadata) MarshalBinary(wr io.Writer) (err error) {
 // UnmarshalBinary unmarshals metadata from a binary stream (usually a file)
 func (m *Metadata) UnmarshalBinary(r io.Reader) error {
 	// Read version
-	var version int64
-	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &m.version); err != nil {
 		return fmt.Errorf("failed to read version: %s", err)
 	}
 
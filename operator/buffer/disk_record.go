@@ -0,0 +1,311 @@
+package buffer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/observiq/stanza/entry"
+)
+
+// The data file of a disk buffer is a sequence of records, one per entry.
+//
+// The layout of a record is as follows:
+// - 4 byte recordMagic
+// - 4 byte PayloadLength as LittleEndian uint32
+// - 4 byte PayloadChecksum as LittleEndian uint32, the CRC-32C of the payload
+// - PayloadLength bytes of payload, the entry encoded as JSON
+//
+// A write that is torn by a crash leaves a record that is cut short, and a
+// corrupted record fails its checksum. The magic starts with a byte that is
+// never part of a JSON payload, so that the next record can be found after a
+// damaged one.
+var recordMagic = []byte{0xff, 'S', 'B', 0x01}
+
+const recordHeaderSize = 12
+
+var recordTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errInvalidRecord is returned when a record is torn or corrupted
+var errInvalidRecord = fmt.Errorf("invalid record")
+
+// encodeRecord encodes an entry as a record of the data file
+func encodeRecord(e *entry.Entry) ([]byte, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, recordHeaderSize+len(payload))
+	copy(record, recordMagic)
+	binary.LittleEndian.PutUint32(record[4:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[8:], crc32.Checksum(payload, recordTable))
+	copy(record[recordHeaderSize:], payload)
+	return record, nil
+}
+
+// readRecord reads the next record, of at most limit bytes, and returns it
+// with its header. It returns errInvalidRecord if the record is torn or
+// corrupted.
+func readRecord(r io.Reader, limit int64) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errInvalidRecord
+		}
+		return nil, err
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[4:]))
+	if !bytes.Equal(header[:4], recordMagic) || recordHeaderSize+length > limit {
+		return nil, errInvalidRecord
+	}
+
+	record := make([]byte, recordHeaderSize+length)
+	copy(record, header)
+	if _, err := io.ReadFull(r, record[recordHeaderSize:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errInvalidRecord
+		}
+		return nil, err
+	}
+
+	if crc32.Checksum(record[recordHeaderSize:], recordTable) != binary.LittleEndian.Uint32(header[8:]) {
+		return nil, errInvalidRecord
+	}
+	return record, nil
+}
+
+// decodeRecord reads the next record into an entry, and returns the size of
+// the record
+func decodeRecord(r io.Reader, limit int64, e *entry.Entry) (int64, error) {
+	record, err := readRecord(r, limit)
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(record[recordHeaderSize:], e); err != nil {
+		return 0, err
+	}
+	return int64(len(record)), nil
+}
+
+// recordScan summarizes the records found in a data file
+type recordScan struct {
+	// records is the number of valid records
+	records int64
+
+	// end is the offset of the end of the last valid record
+	end int64
+
+	// gaps is true if there are damaged bytes between valid records
+	gaps bool
+
+	// discardedBytes is the number of bytes that are not part of a valid record
+	discardedBytes int64
+
+	// discardedRecords is the number of damaged records that were skipped
+	discardedRecords int64
+}
+
+// scanRecords reads the records of a data file, and calls keep with each valid
+// record, in order. A damaged record is skipped up to the next valid record.
+func scanRecords(r io.ReaderAt, size int64, keep func(record []byte) error) (*recordScan, error) {
+	scan := &recordScan{}
+	rd := bufio.NewReader(io.NewSectionReader(r, 0, size))
+	for pos := int64(0); pos < size; {
+		record, err := readRecord(rd, size-pos)
+		if err == nil {
+			if keep != nil {
+				if err := keep(record); err != nil {
+					return nil, err
+				}
+			}
+			scan.gaps = scan.gaps || pos != scan.end
+			scan.records++
+			pos += int64(len(record))
+			scan.end = pos
+			continue
+		}
+		if err != errInvalidRecord {
+			return nil, err
+		}
+
+		// Every position that is retried starts with the magic, so each one
+		// that fails is a damaged record
+		scan.discardedRecords++
+		next, err := findRecordMagic(r, pos+1, size)
+		if err != nil {
+			return nil, err
+		}
+		scan.discardedBytes += next - pos
+		pos = next
+		rd.Reset(io.NewSectionReader(r, pos, size-pos))
+	}
+	return scan, nil
+}
+
+// findRecordMagic returns the offset of the next record magic at or after
+// start, or size if there is none
+func findRecordMagic(r io.ReaderAt, start, size int64) (int64, error) {
+	chunk := make([]byte, 1<<16)
+	for start < size {
+		n, err := r.ReadAt(chunk, start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if int64(n) > size-start {
+			n = int(size - start)
+		}
+		if i := bytes.Index(chunk[:n], recordMagic); i >= 0 {
+			return start + int64(i), nil
+		}
+		if start+int64(n) >= size {
+			break
+		}
+		// The magic may be split across chunks
+		start += int64(n - len(recordMagic) + 1)
+	}
+	return size, nil
+}
+
+// recoverRecords removes the records of the data file that were torn by a
+// crash or corrupted, so that every record left can be read, and counts them
+// as the unread entries. Data files written before entries were framed as
+// records are converted. It returns a description of the discarded data.
+func (d *DiskBuffer) recoverRecords() ([]string, error) {
+	info, err := d.data.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	// The data file may have been converted before the metadata was synced
+	var discarded []string
+	magic := make([]byte, len(recordMagic))
+	if _, err := d.data.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if d.metadata.version < metadataVersion && size > 0 && !bytes.Equal(magic, recordMagic) {
+		if discarded, err = d.convertLegacyData(size); err != nil {
+			return nil, fmt.Errorf("convert data file: %s", err)
+		}
+		if info, err = d.data.Stat(); err != nil {
+			return nil, err
+		}
+	}
+	d.metadata.version = metadataVersion
+
+	scan, err := scanRecords(d.data, info.Size(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("scan data file: %s", err)
+	}
+
+	switch {
+	case scan.gaps:
+		err = d.rewriteData(func(w io.Writer) error {
+			_, err := scanRecords(d.data, info.Size(), func(record []byte) error {
+				_, err := w.Write(record)
+				return err
+			})
+			return err
+		})
+	case scan.end < info.Size():
+		err = d.data.Truncate(scan.end)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remove damaged records: %s", err)
+	}
+
+	if scan.discardedBytes > 0 {
+		discarded = append(discarded, fmt.Sprintf("disk buffer %s: discarded %d bytes of %d damaged entries",
+			d.data.Name(), scan.discardedBytes, scan.discardedRecords))
+	}
+	d.addUnreadCount(scan.records - d.metadata.unreadCount)
+
+	// The size of the file was reserved when it was opened
+	if info, err = d.data.Stat(); err != nil {
+		return nil, err
+	}
+	switch {
+	case info.Size() < size:
+		d.diskSizeSemaphore.Release(size - info.Size())
+	case info.Size() > size:
+		if ok := d.diskSizeSemaphore.TryAcquire(info.Size() - size); !ok {
+			return nil, fmt.Errorf("current on-disk size is larger than max size")
+		}
+	}
+	return discarded, nil
+}
+
+// convertLegacyData converts a data file of JSON lines to records. The lines
+// after one that cannot be decoded are discarded.
+func (d *DiskBuffer) convertLegacyData(size int64) ([]string, error) {
+	var discarded []string
+	err := d.rewriteData(func(w io.Writer) error {
+		dec := json.NewDecoder(io.NewSectionReader(d.data, 0, size))
+		var end int64
+		for {
+			var e entry.Entry
+			err := dec.Decode(&e)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				discarded = append(discarded, fmt.Sprintf("disk buffer %s: discarded %d bytes that could not be decoded",
+					d.data.Name(), size-end))
+				return nil
+			}
+			end = dec.InputOffset()
+
+			record, err := encodeRecord(&e)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	})
+	return discarded, err
+}
+
+// rewriteData replaces the data file with the contents written by write. The
+// contents are written to a temporary file that is renamed over the data
+// file, so that the data file is left as it was if the process is killed.
+func (d *DiskBuffer) rewriteData(write func(w io.Writer) error) error {
+	path := d.data.Name()
+	tmp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	if err = write(w); err == nil {
+		if err = w.Flush(); err == nil {
+			err = tmp.Sync()
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	// The data file is closed first, since an open file cannot be replaced on
+	// Windows, and it is opened again even if it is not replaced
+	d.data.Close()
+	renameErr := os.Rename(tmp.Name(), path)
+	if d.data, err = os.OpenFile(path, d.dataFlags, 0755); err != nil {
+		return err
+	}
+	d.atEnd = false
+	return renameErr
+}
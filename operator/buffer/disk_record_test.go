@@ -0,0 +1,175 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	record, err := encodeRecord(intEntry(10))
+	require.NoError(t, err)
+	require.Equal(t, recordSize(intEntry(10)), int64(len(record)))
+
+	var e entry.Entry
+	n, err := decodeRecord(bytes.NewReader(record), int64(len(record)), &e)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(record)), n)
+	require.Equal(t, intEntry(10), &e)
+
+	t.Run("Torn", func(t *testing.T) {
+		for i := 0; i < len(record); i++ {
+			_, err := readRecord(bytes.NewReader(record[:i]), int64(len(record)))
+			require.Equal(t, errInvalidRecord, err)
+		}
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		for i := 0; i < len(record); i++ {
+			corrupted := append([]byte{}, record...)
+			corrupted[i] ^= 0x20
+			_, err := readRecord(bytes.NewReader(corrupted), int64(len(record)))
+			require.Equal(t, errInvalidRecord, err)
+		}
+	})
+
+	t.Run("PastLimit", func(t *testing.T) {
+		_, err := readRecord(bytes.NewReader(record), int64(len(record)-1))
+		require.Equal(t, errInvalidRecord, err)
+	})
+}
+
+func TestDiskBufferDamagedData(t *testing.T) {
+	// Entries 10 to 99 have the same size, so the records are at fixed offsets
+	const count = 20
+	size := recordSize(intEntry(10))
+
+	rand.Seed(time.Now().Unix())
+	seed := rand.Int63()
+	t.Run(strconv.Itoa(int(seed)), func(t *testing.T) {
+		t.Parallel()
+		r := rand.New(rand.NewSource(seed))
+
+		for i := 0; i < 200; i++ {
+			dir := testutil.NewTempDir(t)
+			b := NewDiskBuffer(1 << 20)
+			require.NoError(t, b.Open(dir, false))
+			writeN(t, b, count, 10)
+			require.NoError(t, b.Close())
+
+			// Either tear the data file at a random offset, as a crash during
+			// a write would, or corrupt a random byte
+			dataPath := filepath.Join(dir, "data")
+			data, err := ioutil.ReadFile(dataPath)
+			require.NoError(t, err)
+			offset := r.Int63n(int64(len(data)))
+			torn := r.Intn(2) == 0
+			if torn {
+				data = data[:offset]
+			} else {
+				data[offset] ^= byte(r.Intn(255) + 1)
+			}
+			require.NoError(t, ioutil.WriteFile(dataPath, data, 0755))
+
+			b = NewDiskBuffer(1 << 20)
+			require.NoError(t, b.Open(dir, false), "offset %d torn %t", offset, torn)
+
+			// Every record before the damage is intact, and only the damaged
+			// record is discarded
+			damaged := int(offset / size)
+			expected := make([]int, 0, count)
+			for j := 0; j < count; j++ {
+				if j < damaged || (!torn && j > damaged) {
+					expected = append(expected, 10+j)
+				}
+			}
+
+			dst := make([]*entry.Entry, 2*count)
+			_, n, err := b.Read(dst)
+			require.NoError(t, err)
+			require.Equal(t, len(expected), n, "offset %d torn %t", offset, torn)
+			for j, k := range expected {
+				require.Equal(t, intEntry(k), dst[j])
+			}
+
+			if torn && offset%size == 0 {
+				require.Empty(t, b.RecoveryReport().Discarded)
+			} else {
+				require.Len(t, b.RecoveryReport().Discarded, 1)
+			}
+			require.Equal(t, int64(len(expected)), b.RecoveryReport().BufferedEntries)
+
+			// The buffer continues after the last valid record
+			writeN(t, b, 1, 99)
+			readN(t, b, 1, 99)
+			require.NoError(t, b.Close())
+		}
+	})
+}
+
+func TestDiskBufferUncountedRecords(t *testing.T) {
+	// Records that were written after the metadata was last synced are counted
+	dir := testutil.NewTempDir(t)
+	b := NewDiskBuffer(1 << 20)
+	require.NoError(t, b.Open(dir, false))
+	writeN(t, b, 5, 10)
+	require.NoError(t, b.SaveState())
+	writeN(t, b, 5, 15)
+	close(b.stopCompactor)
+	b.compactorWG.Wait()
+	require.NoError(t, b.data.Close())
+	require.NoError(t, b.metadata.file.Close())
+
+	b = NewDiskBuffer(1 << 20)
+	require.NoError(t, b.Open(dir, false))
+	defer b.Close()
+	require.Equal(t, int64(10), b.RecoveryReport().BufferedEntries)
+	readN(t, b, 10, 10)
+}
+
+func TestDiskBufferLegacyData(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+
+	// Data files of version 1 hold one entry per line
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for i := 10; i < 15; i++ {
+		require.NoError(t, enc.Encode(intEntry(i)))
+	}
+	// The newline after the last entry is discarded with the torn entry
+	end := data.Len() - 1
+	require.NoError(t, enc.Encode(intEntry(15)))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data"), data.Bytes()[:data.Len()-10], 0755))
+
+	metadata := &Metadata{version: 1, unreadCount: 6}
+	file, err := os.Create(filepath.Join(dir, "metadata"))
+	require.NoError(t, err)
+	require.NoError(t, metadata.MarshalBinary(file))
+	require.NoError(t, file.Close())
+
+	b := NewDiskBuffer(1 << 20)
+	require.NoError(t, b.Open(dir, false))
+	require.Equal(t, int64(5), b.RecoveryReport().BufferedEntries)
+	require.Len(t, b.RecoveryReport().Discarded, 1)
+	require.Contains(t, b.RecoveryReport().Discarded[0], strconv.Itoa(data.Len()-10-end)+" bytes")
+	readN(t, b, 5, 10)
+	require.NoError(t, b.Close())
+
+	// The converted data file is opened as records
+	b = NewDiskBuffer(1 << 20)
+	require.NoError(t, b.Open(dir, false))
+	defer b.Close()
+	require.Equal(t, int64(metadataVersion), b.metadata.version)
+	require.Empty(t, b.RecoveryReport().Discarded)
+	readN(t, b, 5, 10)
+}
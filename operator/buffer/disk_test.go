@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -162,6 +163,51 @@ func TestDiskBuffer(t *testing.T) {
 		readN(t, b2, 10, 10)
 	})
 
+	t.Run("Write20Flush10CloseRecovery", func(t *testing.T) {
+		t.Parallel()
+		b := NewDiskBuffer(1 << 30)
+		dir := testutil.NewTempDir(t)
+		err := b.Open(dir, false)
+		require.NoError(t, err)
+		require.Equal(t, &helper.RecoveryReport{}, Recovery(b))
+
+		writeN(t, b, 20, 0)
+		flushN(t, b, 10, 0)
+		err = b.Close()
+		require.NoError(t, err)
+
+		b2 := NewDiskBuffer(1 << 30)
+		err = b2.Open(dir, false)
+		require.NoError(t, err)
+
+		report := Recovery(b2)
+		require.Equal(t, int64(10), report.BufferedEntries)
+		require.Greater(t, report.BufferedBytes, int64(0))
+		require.Equal(t, intEntry(10).Timestamp, report.OldestBuffered)
+
+		// Reading the oldest entry for the report must not affect reads
+		readN(t, b2, 10, 10)
+	})
+
+	t.Run("Write20Flush10SaveStateKillRead10", func(t *testing.T) {
+		t.Parallel()
+		b := NewDiskBuffer(1 << 30)
+		dir := testutil.NewTempDir(t)
+		err := b.Open(dir, false)
+		require.NoError(t, err)
+		defer b.Close()
+
+		writeN(t, b, 20, 0)
+		flushN(t, b, 10, 0)
+		require.NoError(t, SaveState(b))
+
+		// The first buffer is never closed, as if the process was killed
+		b2 := NewDiskBuffer(1 << 30)
+		err = b2.Open(dir, false)
+		require.NoError(t, err)
+		readN(t, b2, 10, 10)
+	})
+
 	t.Run("ReadWaitTimesOut", func(t *testing.T) {
 		t.Parallel()
 		b := openBuffer(t)
@@ -256,6 +302,104 @@ func TestDiskBufferBuild(t *testing.T) {
 	})
 }
 
+func TestDiskBufferCompaction(t *testing.T) {
+	newBuffer := func(t *testing.T, path string, interval time.Duration) *DiskBuffer {
+		cfg := NewDiskBufferConfig()
+		cfg.MaxBytes = 1 << 24
+		cfg.Path = path
+		cfg.Sync = false
+		cfg.CompactInterval = helper.Duration{Duration: interval}
+		b, err := cfg.Build(testutil.NewBuildContext(t), "test")
+		require.NoError(t, err)
+		return b.(*DiskBuffer)
+	}
+
+	dataSize := func(t *testing.T, b *DiskBuffer) int64 {
+		b.Lock()
+		defer b.Unlock()
+		info, err := b.data.Stat()
+		require.NoError(t, err)
+		return info.Size()
+	}
+
+	t.Run("ShrinksAfterDrain", func(t *testing.T) {
+		t.Parallel()
+		b := newBuffer(t, testutil.NewTempDir(t), 20*time.Millisecond)
+		defer b.Close()
+
+		writeN(t, b, 1000, 0)
+		full := dataSize(t, b)
+		var live int64
+		for i := 990; i < 1000; i++ {
+			live += recordSize(intEntry(i))
+		}
+
+		// The compactor shrinks the file to the unflushed entries, without
+		// anything else being flushed
+		flushN(t, b, 990, 0)
+		require.Eventually(t, func() bool {
+			return dataSize(t, b) == live
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Less(t, live, full)
+
+		// The unflushed entries are intact and in order
+		flushN(t, b, 10, 990)
+		require.Eventually(t, func() bool {
+			return dataSize(t, b) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("OnStart", func(t *testing.T) {
+		t.Parallel()
+		path := testutil.NewTempDir(t)
+		b := newBuffer(t, path, time.Hour)
+		writeN(t, b, 100, 0)
+		flushN(t, b, 50, 0)
+		readN(t, b, 20, 50)
+		full := dataSize(t, b)
+		require.NoError(t, b.Close())
+
+		// Flushed entries are removed when the buffer is opened, and entries
+		// that were read but not flushed are read again
+		b = newBuffer(t, path, time.Hour)
+		defer b.Close()
+		require.Less(t, dataSize(t, b), full)
+		readN(t, b, 50, 50)
+	})
+
+	t.Run("Threshold", func(t *testing.T) {
+		cases := []struct {
+			dead, live int64
+			threshold  float64
+			expected   bool
+		}{
+			{0, 100, 0.5, false},
+			{50, 100, 0.5, false},
+			{51, 100, 0.5, true},
+			{1, 100, 0, true},
+			{10, 0, 0.5, true},
+			{0, 0, 0.5, false},
+		}
+		for _, tc := range cases {
+			require.Equal(t, tc.expected, exceedsRatio(tc.dead, tc.live, tc.threshold), "%+v", tc)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		cfg := NewDiskBufferConfig()
+		cfg.Path = testutil.NewTempDir(t)
+		cfg.CompactThreshold = -1
+		_, err := cfg.Build(testutil.NewBuildContext(t), "test")
+		require.Error(t, err)
+
+		cfg = NewDiskBufferConfig()
+		cfg.Path = testutil.NewTempDir(t)
+		cfg.CompactInterval = helper.Duration{}
+		_, err = cfg.Build(testutil.NewBuildContext(t), "test")
+		require.Error(t, err)
+	})
+}
+
 func BenchmarkDiskBuffer(b *testing.B) {
 	b.Run("NoSync", func(b *testing.B) {
 		buffer := openBuffer(b)
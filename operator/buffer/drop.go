@@ -0,0 +1,121 @@
+package buffer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+)
+
+const (
+	// WhenFullBlock blocks the caller of Add until there is space in the buffer
+	WhenFullBlock = "block"
+	// WhenFullDropNewest drops the entry being added when the buffer is full
+	WhenFullDropNewest = "drop_newest"
+	// WhenFullDropOldest drops the oldest unread entries to make space for the
+	// entry being added when the buffer is full
+	WhenFullDropOldest = "drop_oldest"
+
+	// dropLogInterval is the minimum time between warnings about dropped entries
+	dropLogInterval = 10 * time.Second
+)
+
+// validateWhenFull checks that a when_full policy is known. An empty policy blocks.
+func validateWhenFull(policy string) error {
+	switch policy {
+	case "", WhenFullBlock, WhenFullDropNewest, WhenFullDropOldest:
+		return nil
+	default:
+		return fmt.Errorf("invalid when_full '%s': must be '%s', '%s' or '%s'",
+			policy, WhenFullBlock, WhenFullDropNewest, WhenFullDropOldest)
+	}
+}
+
+// dropCounter counts the entries a buffer drops because it is full. Drops are
+// added to the stats of the output that owns the buffer, and logged at most
+// once per dropLogInterval so that a sustained overflow does not flood the logs.
+type dropCounter struct {
+	policy string
+
+	mux      sync.Mutex
+	dropped  uint64
+	unlogged uint64
+	lastLog  time.Time
+	stats    *helper.OperatorStats
+	logger   *zap.SugaredLogger
+	now      func() time.Time
+
+	// onDrop is called with every drop, so that a flush tracker can stop
+	// waiting for the dropped entries
+	onDrop func(n uint64, oldest bool)
+}
+
+// drop counts n dropped entries. Oldest is true if the entries were the
+// oldest unread entries in the buffer, and false if the entries dropped were
+// the ones being added.
+func (d *dropCounter) drop(n uint64, oldest bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.dropped += n
+	d.unlogged += n
+	d.stats.AddDropped(n)
+	if d.onDrop != nil {
+		d.onDrop(n, oldest)
+	}
+
+	if d.logger == nil {
+		return
+	}
+	now := time.Now
+	if d.now != nil {
+		now = d.now
+	}
+	if t := now(); t.Sub(d.lastLog) >= dropLogInterval {
+		d.logger.Warnw("Buffer is full, dropped entries", "when_full", d.policy, "dropped", d.unlogged, "total_dropped", d.dropped)
+		d.unlogged = 0
+		d.lastLog = t
+	}
+}
+
+// Dropped returns the number of entries dropped because the buffer was full
+func (d *dropCounter) Dropped() uint64 {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.dropped
+}
+
+// ReportDropsTo adds the entries dropped from now on to stats, and logs them with logger
+func (d *dropCounter) ReportDropsTo(stats *helper.OperatorStats, logger *zap.SugaredLogger) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.stats = stats
+	d.logger = logger
+}
+
+// notifyDrops sets a function that is called with every drop
+func (d *dropCounter) notifyDrops(onDrop func(n uint64, oldest bool)) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.onDrop = onDrop
+}
+
+// dropReporter is implemented by buffers that can drop entries when they are full
+type dropReporter interface {
+	ReportDropsTo(*helper.OperatorStats, *zap.SugaredLogger)
+}
+
+// ReportDrops counts the entries a buffer drops because it is full in the
+// dropped stat of its output, and logs them with the output's logger
+func ReportDrops(b Buffer, stats *helper.OperatorStats, logger *zap.SugaredLogger) {
+	if reporter, ok := unwrap(b).(dropReporter); ok {
+		reporter.ReportDropsTo(stats, logger)
+	}
+}
+
+// dropNotifier is implemented by buffers that can drop entries when they are full
+type dropNotifier interface {
+	notifyDrops(func(n uint64, oldest bool))
+}
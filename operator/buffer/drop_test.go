@@ -0,0 +1,162 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBufferWhenFull(t *testing.T) {
+	// Entries 10 to 99 have the same size, so the buffers below hold 10 of them.
+	// Every buffer is wrapped in a flush tracker, which must not wait for the
+	// dropped entries.
+	builders := map[string]func(t *testing.T, whenFull string) (Buffer, error){
+		"Memory": func(t *testing.T, whenFull string) (Buffer, error) {
+			cfg := NewMemoryBufferConfig()
+			cfg.MaxEntries = 10
+			cfg.WhenFull = whenFull
+			return Config{Builder: cfg}.Build(testutil.NewBuildContext(t), "test")
+		},
+		"Disk": func(t *testing.T, whenFull string) (Buffer, error) {
+			cfg := NewDiskBufferConfig()
+			cfg.MaxBytes = 10 * recordSize(intEntry(10))
+			cfg.Path = testutil.NewTempDir(t)
+			cfg.Sync = false
+			cfg.WhenFull = whenFull
+			b, err := Config{Builder: cfg}.Build(testutil.NewBuildContext(t), "test")
+			if err == nil {
+				t.Cleanup(func() { b.Close() })
+			}
+			return b, err
+		},
+	}
+
+	for name, build := range builders {
+		build := build
+		t.Run(name, func(t *testing.T) {
+			t.Run("Block", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, WhenFullBlock)
+				require.NoError(t, err)
+				writeN(t, b, 10, 10)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				require.Error(t, b.Add(ctx, intEntry(20)))
+				flushN(t, b, 10, 10)
+			})
+
+			t.Run("DropNewest", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, WhenFullDropNewest)
+				require.NoError(t, err)
+				stats := &helper.OperatorStats{}
+				core, logs := observer.New(zap.WarnLevel)
+				ReportDrops(b, stats, zap.New(core).Sugar())
+
+				writeN(t, b, 90, 10)
+				flushN(t, b, 10, 10)
+				require.Equal(t, uint64(80), stats.Snapshot().Dropped)
+
+				// A sustained overflow is logged once per interval
+				require.Equal(t, 1, logs.Len())
+
+				// Once there is space again, new entries are added
+				writeN(t, b, 10, 10)
+				require.Equal(t, int64(10), Pending(b))
+				flushN(t, b, 10, 10)
+				requireFlushed(t, b, 20)
+			})
+
+			t.Run("DropOldest", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, WhenFullDropOldest)
+				require.NoError(t, err)
+				stats := &helper.OperatorStats{}
+				ReportDrops(b, stats, nil)
+
+				writeN(t, b, 90, 10)
+				require.Equal(t, int64(10), Pending(b))
+				flushN(t, b, 10, 90)
+				require.Equal(t, uint64(80), stats.Snapshot().Dropped)
+				requireFlushed(t, b, 10)
+			})
+
+			t.Run("DropOldestInFlight", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, WhenFullDropOldest)
+				require.NoError(t, err)
+				writeN(t, b, 10, 10)
+
+				// Entries that were read are never dropped, so the
+				// newest entries are dropped instead
+				f := readN(t, b, 10, 10)
+				writeN(t, b, 5, 20)
+				require.NoError(t, f())
+				_, n, err := b.Read(make([]*entry.Entry, 20))
+				require.NoError(t, err)
+				require.Equal(t, 0, n)
+
+				// Once the entries are flushed, their space is reused
+				writeN(t, b, 10, 30)
+				flushN(t, b, 10, 30)
+				requireFlushed(t, b, 20)
+			})
+
+			t.Run("DropOldestPartiallyRead", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, WhenFullDropOldest)
+				require.NoError(t, err)
+				writeN(t, b, 10, 10)
+
+				// The unread entries are dropped, and the read cursor skips them
+				f := readN(t, b, 5, 10)
+				writeN(t, b, 10, 20)
+				require.NoError(t, f())
+				flushN(t, b, 5, 25)
+				requireFlushed(t, b, 10)
+			})
+
+			t.Run("Invalid", func(t *testing.T) {
+				_, err := build(t, "drop_random")
+				require.Error(t, err)
+			})
+		})
+	}
+}
+
+func TestDropCounterThrottlesLogs(t *testing.T) {
+	now := time.Now()
+	core, logs := observer.New(zap.WarnLevel)
+	counter := &dropCounter{policy: WhenFullDropNewest, now: func() time.Time { return now }}
+	counter.ReportDropsTo(nil, zap.New(core).Sugar())
+
+	counter.drop(1, false)
+	counter.drop(2, false)
+	now = now.Add(dropLogInterval)
+	counter.drop(3, false)
+
+	require.Equal(t, uint64(6), counter.Dropped())
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	require.Equal(t, uint64(1), entries[0].ContextMap()["dropped"])
+	require.Equal(t, uint64(5), entries[1].ContextMap()["dropped"])
+}
+
+// requireFlushed checks that a buffer has no pending entries, that waiting for
+// its entries to be flushed returns, and that it flushed the given number of entries
+func requireFlushed(t *testing.T, b Buffer, flushed uint64) {
+	require.Equal(t, int64(0), Pending(b))
+	require.Equal(t, flushed, Flushed(b))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, WaitFlushed(ctx, b))
+}
@@ -0,0 +1,82 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// FlushConfig holds the thresholds at which a buffer releases a batch of
+// entries to its flusher. A batch is released as soon as any threshold is hit.
+type FlushConfig struct {
+	// FlushMaxEntries is the maximum number of entries in a batch
+	FlushMaxEntries int `json:"flush_max_entries,omitempty" yaml:"flush_max_entries,omitempty"`
+
+	// FlushMaxBytes is the serialized size of the entries at which a batch is released
+	FlushMaxBytes int64 `json:"flush_max_bytes,omitempty" yaml:"flush_max_bytes,omitempty"`
+
+	// FlushInterval is the maximum time to wait for a batch to fill
+	FlushInterval helper.Duration `json:"flush_interval,omitempty" yaml:"flush_interval,omitempty"`
+}
+
+// validate checks that the flush thresholds are not negative
+func (c FlushConfig) validate() error {
+	switch {
+	case c.FlushMaxEntries < 0:
+		return fmt.Errorf("flush_max_entries must not be negative")
+	case c.FlushMaxBytes < 0:
+		return fmt.Errorf("flush_max_bytes must not be negative")
+	case c.FlushInterval.Raw() < 0:
+		return fmt.Errorf("flush_interval must not be negative")
+	}
+	return nil
+}
+
+// limit shortens dst to the maximum number of entries in a batch
+func (c FlushConfig) limit(dst []*entry.Entry) []*entry.Entry {
+	if c.FlushMaxEntries > 0 && c.FlushMaxEntries < len(dst) {
+		return dst[:c.FlushMaxEntries]
+	}
+	return dst
+}
+
+// fullBytes returns true if a batch of the given serialized size should be released
+func (c FlushConfig) fullBytes(size int64) bool {
+	return c.FlushMaxBytes > 0 && size >= c.FlushMaxBytes
+}
+
+// withInterval returns a context that is done when the flush interval passes
+func (c FlushConfig) withInterval(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.FlushInterval.Raw() <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.FlushInterval.Raw())
+}
+
+// flushIntervaler is implemented by buffers that release batches on an interval
+type flushIntervaler interface {
+	FlushInterval() time.Duration
+}
+
+// FlushInterval returns the interval at which a buffer releases a batch that
+// is not full, or zero if the buffer does not set one
+func FlushInterval(b Buffer) time.Duration {
+	intervaler, ok := unwrap(b).(flushIntervaler)
+	if !ok {
+		return 0
+	}
+	return intervaler.FlushInterval()
+}
+
+// entrySize returns the approximate serialized size of an entry, including
+// the newline that separates entries in a batch
+func entrySize(e *entry.Entry) int64 {
+	size, err := e.ApproximateSize(entry.EncodingJSON)
+	if err != nil {
+		return 0
+	}
+	return int64(size) + 1
+}
@@ -0,0 +1,101 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferFlushThresholds(t *testing.T) {
+	builders := map[string]func(t *testing.T, flush FlushConfig) (Buffer, error){
+		"Memory": func(t *testing.T, flush FlushConfig) (Buffer, error) {
+			cfg := NewMemoryBufferConfig()
+			cfg.FlushConfig = flush
+			return Config{Builder: cfg}.Build(testutil.NewBuildContext(t), "test")
+		},
+		"Disk": func(t *testing.T, flush FlushConfig) (Buffer, error) {
+			cfg := NewDiskBufferConfig()
+			cfg.MaxBytes = 1 << 20
+			cfg.Path = testutil.NewTempDir(t)
+			cfg.Sync = false
+			cfg.FlushConfig = flush
+			b, err := Config{Builder: cfg}.Build(testutil.NewBuildContext(t), "test")
+			if err == nil {
+				t.Cleanup(func() { b.Close() })
+			}
+			return b, err
+		},
+	}
+
+	for name, build := range builders {
+		build := build
+		t.Run(name, func(t *testing.T) {
+			t.Run("IntervalReleasesPartialBatch", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, FlushConfig{
+					FlushMaxEntries: 100,
+					FlushInterval:   helper.Duration{Duration: 50 * time.Millisecond},
+				})
+				require.NoError(t, err)
+				require.Equal(t, 50*time.Millisecond, FlushInterval(b))
+				writeN(t, b, 3, 0)
+
+				start := time.Now()
+				_, n, err := b.ReadWait(context.Background(), make([]*entry.Entry, 1000))
+				require.NoError(t, err)
+				require.Equal(t, 3, n)
+				require.True(t, time.Since(start) >= 50*time.Millisecond)
+			})
+
+			t.Run("BytesBeforeEntries", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, FlushConfig{
+					FlushMaxEntries: 10,
+					FlushMaxBytes:   3 * entrySize(intEntry(0)),
+				})
+				require.NoError(t, err)
+				writeN(t, b, 5, 0)
+
+				dst := make([]*entry.Entry, 1000)
+				_, n, err := b.ReadWait(context.Background(), dst)
+				require.NoError(t, err)
+				require.Equal(t, 3, n)
+				for i := 0; i < n; i++ {
+					require.Equal(t, intEntry(i), dst[i])
+				}
+
+				// The rest of the entries are released on the next read
+				_, n, err = b.Read(dst)
+				require.NoError(t, err)
+				require.Equal(t, 2, n)
+			})
+
+			t.Run("Entries", func(t *testing.T) {
+				t.Parallel()
+				b, err := build(t, FlushConfig{FlushMaxEntries: 4})
+				require.NoError(t, err)
+				writeN(t, b, 10, 0)
+
+				_, n, err := b.ReadWait(context.Background(), make([]*entry.Entry, 1000))
+				require.NoError(t, err)
+				require.Equal(t, 4, n)
+			})
+
+			t.Run("Invalid", func(t *testing.T) {
+				for _, flush := range []FlushConfig{
+					{FlushMaxEntries: -1},
+					{FlushMaxBytes: -1},
+					{FlushInterval: helper.Duration{Duration: -time.Second}},
+				} {
+					_, err := build(t, flush)
+					require.Error(t, err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package buffer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// Build builds the configured buffer, wrapped so that callers can wait until
+// the entries added to it have been flushed
+func (bc Config) Build(context operator.BuildContext, pluginID string) (Buffer, error) {
+	b, err := bc.Builder.Build(context, pluginID)
+	if err != nil {
+		return nil, err
+	}
+	return newFlushTracker(b), nil
+}
+
+// WaitFlushed blocks until every entry added to a buffer before the call has
+// been flushed, or until the context is done. Buffers that do not track their
+// flushed entries return immediately.
+func WaitFlushed(ctx context.Context, b Buffer) error {
+	tracker, ok := b.(*flushTracker)
+	if !ok {
+		return nil
+	}
+	return tracker.WaitFlushed(ctx)
+}
+
+// Pending returns the number of entries added to a buffer that have not been
+// flushed yet. Buffers that do not track their flushed entries return zero.
+func Pending(b Buffer) int64 {
+	tracker, ok := b.(*flushTracker)
+	if !ok {
+		return 0
+	}
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+	// An entry added concurrently with a drop may be read before it is counted
+	if tracker.flushed > tracker.added {
+		return 0
+	}
+	return int64(tracker.added - tracker.flushed)
+}
+
+// Flushed returns the number of entries flushed from a buffer since it was
+// built. Buffers that do not track their flushed entries return zero.
+func Flushed(b Buffer) uint64 {
+	tracker, ok := b.(*flushTracker)
+	if !ok {
+		return 0
+	}
+	tracker.mux.Lock()
+	defer tracker.mux.Unlock()
+	return tracker.flushed - tracker.dropped
+}
+
+// unwrap returns the buffer that a flush tracker wraps, or the buffer itself
+// if it is not wrapped
+func unwrap(b Buffer) Buffer {
+	if tracker, ok := b.(*flushTracker); ok {
+		return tracker.Buffer
+	}
+	return b
+}
+
+// flushTracker counts the entries added to and flushed from a buffer. Buffers
+// return entries in the order they were added, so the entries added before a
+// point are flushed once every entry up to that count has been flushed,
+// regardless of the order in which the flushes complete. The oldest entries
+// that the buffer drops count as flushed, and the entries it drops instead of
+// adding them are not counted at all.
+type flushTracker struct {
+	Buffer
+
+	// readMux keeps the count of read entries in the order of the reads
+	readMux sync.Mutex
+
+	mux   sync.Mutex
+	added uint64
+	// read is the number of entries that left the buffer, either read or
+	// dropped as the oldest
+	read    uint64
+	flushed uint64
+	// dropped is the number of entries counted as flushed because they were
+	// dropped, and rejected is the number of entries dropped while being
+	// added that Add has not discounted yet
+	dropped  uint64
+	rejected uint64
+	// ranges holds the flushed ranges of entries past flushed, as a map of
+	// the first entry in each range to the last
+	ranges map[uint64]uint64
+	// changed is closed and replaced whenever flushed advances
+	changed chan struct{}
+}
+
+func newFlushTracker(b Buffer) *flushTracker {
+	t := &flushTracker{
+		Buffer:  b,
+		ranges:  make(map[uint64]uint64),
+		changed: make(chan struct{}),
+	}
+
+	// Entries restored from a previous run are read before any new entries
+	if report := Recovery(b); report != nil && report.BufferedEntries > 0 {
+		t.added = uint64(report.BufferedEntries)
+	}
+	if notifier, ok := b.(dropNotifier); ok {
+		notifier.notifyDrops(t.drop)
+	}
+	return t
+}
+
+// Add adds an entry to the buffer
+func (t *flushTracker) Add(ctx context.Context, e *entry.Entry) error {
+	if err := t.Buffer.Add(ctx, e); err != nil {
+		return err
+	}
+	t.mux.Lock()
+	if t.rejected > 0 {
+		t.rejected--
+	} else {
+		t.added++
+	}
+	t.mux.Unlock()
+	return nil
+}
+
+// Read reads entries from the buffer, returning a function that marks them flushed
+func (t *flushTracker) Read(dst []*entry.Entry) (FlushFunc, int, error) {
+	t.readMux.Lock()
+	defer t.readMux.Unlock()
+
+	flush, n, err := t.Buffer.Read(dst)
+	return t.track(flush, n), n, err
+}
+
+// ReadWait reads entries from the buffer, returning a function that marks them flushed
+func (t *flushTracker) ReadWait(ctx context.Context, dst []*entry.Entry) (FlushFunc, int, error) {
+	t.readMux.Lock()
+	defer t.readMux.Unlock()
+
+	flush, n, err := t.Buffer.ReadWait(ctx, dst)
+	return t.track(flush, n), n, err
+}
+
+// RecoveryReport returns the recovery report of the wrapped buffer
+func (t *flushTracker) RecoveryReport() *helper.RecoveryReport {
+	return Recovery(t.Buffer)
+}
+
+// SaveState saves the state of the wrapped buffer
+func (t *flushTracker) SaveState() error {
+	return SaveState(t.Buffer)
+}
+
+// track assigns the next n entries to a read, and wraps its flush function
+// to record them as flushed
+func (t *flushTracker) track(flush FlushFunc, n int) FlushFunc {
+	if n == 0 || flush == nil {
+		return flush
+	}
+
+	t.mux.Lock()
+	first := t.read + 1
+	t.read += uint64(n)
+	last := t.read
+	t.mux.Unlock()
+	return func() error {
+		if err := flush(); err != nil {
+			return err
+		}
+		t.markFlushed(first, last)
+		return nil
+	}
+}
+
+// drop records entries dropped by the buffer. The oldest unread entries are
+// marked as flushed, so that waiters do not wait for them, and entries
+// dropped while being added are discounted by Add.
+func (t *flushTracker) drop(n uint64, oldest bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if !oldest {
+		t.rejected += n
+		return
+	}
+	first := t.read + 1
+	t.read += n
+	t.dropped += n
+	t.markFlushedLocked(first, t.read)
+}
+
+// markFlushed records a range of entries as flushed
+func (t *flushTracker) markFlushed(first, last uint64) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.markFlushedLocked(first, last)
+}
+
+// markFlushedLocked records a range of entries as flushed while holding mux
+func (t *flushTracker) markFlushedLocked(first, last uint64) {
+	if first != t.flushed+1 {
+		t.ranges[first] = last
+		return
+	}
+
+	t.flushed = last
+	for {
+		next, ok := t.ranges[t.flushed+1]
+		if !ok {
+			break
+		}
+		delete(t.ranges, t.flushed+1)
+		t.flushed = next
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// WaitFlushed blocks until every entry added before the call has been
+// flushed, or until the context is done
+func (t *flushTracker) WaitFlushed(ctx context.Context) error {
+	t.mux.Lock()
+	target := t.added
+	t.mux.Unlock()
+
+	for {
+		t.mux.Lock()
+		if t.flushed >= target {
+			t.mux.Unlock()
+			return nil
+		}
+		changed := t.changed
+		t.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitFlushed(t *testing.T) {
+	b, err := NewConfig().Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+
+	// Nothing has been added, so there is nothing to wait for
+	require.NoError(t, WaitFlushed(context.Background(), b))
+
+	writeN(t, b, 10, 0)
+	first := readN(t, b, 4, 0)
+	second := readN(t, b, 4, 4)
+
+	waitFlushed := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return WaitFlushed(ctx, b)
+	}
+
+	// The second read is flushed first, so the first entries are still pending
+	require.NoError(t, second())
+	require.Equal(t, context.DeadlineExceeded, waitFlushed())
+
+	// Entries added after the wait began are not waited for
+	done := make(chan error)
+	go func() {
+		done <- WaitFlushed(context.Background(), b)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	writeN(t, b, 5, 10)
+
+	require.NoError(t, first())
+	require.Equal(t, context.DeadlineExceeded, waitFlushed())
+	flushN(t, b, 2, 8)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for entries to be flushed")
+	}
+	require.Equal(t, context.DeadlineExceeded, waitFlushed())
+}
+
+func TestWaitFlushedUntracked(t *testing.T) {
+	b, err := NewMemoryBufferConfig().Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+	writeN(t, b, 1, 0)
+	require.NoError(t, WaitFlushed(context.Background(), b))
+}
+
+func TestPendingAndFlushed(t *testing.T) {
+	b, err := NewConfig().Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), Pending(b))
+	require.Equal(t, uint64(0), Flushed(b))
+
+	writeN(t, b, 10, 0)
+	require.Equal(t, int64(10), Pending(b))
+
+	// Entries that are read but not flushed are still pending
+	flush := readN(t, b, 4, 0)
+	require.Equal(t, int64(10), Pending(b))
+	require.NoError(t, flush())
+	require.Equal(t, int64(6), Pending(b))
+	require.Equal(t, uint64(4), Flushed(b))
+
+	// Buffers that do not track their flushed entries report nothing
+	untracked, err := NewMemoryBufferConfig().Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+	writeN(t, untracked, 1, 0)
+	require.Equal(t, int64(0), Pending(untracked))
+	require.Equal(t, uint64(0), Flushed(untracked))
+}
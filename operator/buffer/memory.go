@@ -8,18 +8,22 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/observiq/stanza/database"
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"go.etcd.io/bbolt"
 	"golang.org/x/sync/semaphore"
 )
 
 // MemoryBufferConfig holds the configuration for a memory buffer
 type MemoryBufferConfig struct {
-	Type       string `json:"type" yaml:"type"`
-	MaxEntries int    `json:"max_entries" yaml:"max_entries"`
+	Type        string `json:"type" yaml:"type"`
+	MaxEntries  int    `json:"max_entries" yaml:"max_entries"`
+	WhenFull    string `json:"when_full,omitempty" yaml:"when_full,omitempty"`
+	FlushConfig `yaml:",inline"`
 }
 
 // NewMemoryBufferConfig creates a new default MemoryBufferConfig
@@ -30,15 +34,31 @@ func NewMemoryBufferConfig() *MemoryBufferConfig {
 	}
 }
 
+// IsMemory returns true if a buffer holds its entries in memory
+func IsMemory(b Buffer) bool {
+	_, ok := unwrap(b).(*MemoryBuffer)
+	return ok
+}
+
 // Build builds a MemoryBufferConfig into a Buffer, loading any entries that were previously unflushed
 // back into memory
 func (c MemoryBufferConfig) Build(context operator.BuildContext, pluginID string) (Buffer, error) {
+	if err := c.FlushConfig.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateWhenFull(c.WhenFull); err != nil {
+		return nil, err
+	}
+
 	mb := &MemoryBuffer{
-		db:       context.Database,
-		pluginID: pluginID,
-		buf:      make(chan *entry.Entry, c.MaxEntries),
-		sem:      semaphore.NewWeighted(int64(c.MaxEntries)),
-		inFlight: make(map[uint64]*entry.Entry, c.MaxEntries),
+		flush:       c.FlushConfig,
+		dropCounter: &dropCounter{policy: c.WhenFull},
+		db:          context.Database,
+		pluginID:    pluginID,
+		buf:         make(chan *entry.Entry, c.MaxEntries),
+		maxEntries:  int64(c.MaxEntries),
+		sem:         semaphore.NewWeighted(int64(c.MaxEntries)),
+		inFlight:    make(map[uint64]*entry.Entry, c.MaxEntries),
 	}
 	if err := mb.loadFromDB(); err != nil {
 		return nil, err
@@ -58,64 +78,111 @@ type MemoryBuffer struct {
 	inFlightMux sync.Mutex
 	entryID     uint64
 	sem         *semaphore.Weighted
+	recovery    *helper.RecoveryReport
+	flush       FlushConfig
+	maxEntries  int64
+
+	// added and flushed count the entries that went through the buffer
+	added   uint64
+	flushed uint64
+
+	*dropCounter
 }
 
-// Add inserts an entry into the memory database, blocking until there is space
+// Add inserts an entry into the memory database. If the buffer is full, it
+// blocks until there is space, or drops an entry, depending on the when_full policy.
 func (m *MemoryBuffer) Add(ctx context.Context, e *entry.Entry) error {
-	if err := m.sem.Acquire(ctx, 1); err != nil {
-		return err
+	switch m.policy {
+	case WhenFullDropNewest, WhenFullDropOldest:
+		if m.sem.TryAcquire(1) {
+			break
+		}
+		if m.policy == WhenFullDropOldest {
+			// Replace the oldest unread entry, which hands its slot to the new entry.
+			// Entries that were already read are in flight, and can't be dropped.
+			select {
+			case <-m.buf:
+				m.buf <- e
+				atomic.AddUint64(&m.added, 1)
+				m.drop(1, true)
+				return nil
+			default:
+			}
+		}
+		m.drop(1, false)
+		return nil
+	default:
+		if err := m.sem.Acquire(ctx, 1); err != nil {
+			return err
+		}
 	}
 
 	m.buf <- e
+	atomic.AddUint64(&m.added, 1)
 	return nil
 }
 
-// Read reads entries until either there are no entries left in the buffer
-// or the destination slice is full. The returned function must be called
-// once the entries are flushed to remove them from the memory buffer.
+// Read reads entries until either there are no entries left in the buffer,
+// the destination slice is full, or a flush threshold is hit. The returned
+// function must be called once the entries are flushed to remove them from
+// the memory buffer.
 func (m *MemoryBuffer) Read(dst []*entry.Entry) (FlushFunc, int, error) {
-	inFlight := make([]uint64, len(dst))
-	i := 0
-	for ; i < len(dst); i++ {
-		select {
-		case e := <-m.buf:
-			dst[i] = e
-			id := atomic.AddUint64(&m.entryID, 1)
-			m.inFlightMux.Lock()
-			m.inFlight[id] = e
-			m.inFlightMux.Unlock()
-			inFlight[i] = id
-		default:
-			return m.newFlushFunc(inFlight[:i]), i, nil
-		}
-	}
-
-	return m.newFlushFunc(inFlight[:i]), i, nil
+	return m.read(nil, dst)
 }
 
-// ReadWait reads entries until either the destination slice is full, or the context passed to it
-// is cancelled. The returned function must be called once the entries are flushed to remove them
-// from the memory buffer
+// ReadWait reads entries until either the destination slice is full, a flush threshold is hit,
+// or the context passed to it is cancelled. The returned function must be called once the
+// entries are flushed to remove them from the memory buffer
 func (m *MemoryBuffer) ReadWait(ctx context.Context, dst []*entry.Entry) (FlushFunc, int, error) {
+	ctx, cancel := m.flush.withInterval(ctx)
+	defer cancel()
+	return m.read(ctx.Done(), dst)
+}
+
+// read reads entries into dst until it is full or a flush threshold is hit.
+// If done is nil, it returns as soon as the buffer is empty. Otherwise, it
+// waits for entries until done is closed.
+func (m *MemoryBuffer) read(done <-chan struct{}, dst []*entry.Entry) (FlushFunc, int, error) {
+	dst = m.flush.limit(dst)
 	inFlightIDs := make([]uint64, len(dst))
+	var size int64
 	i := 0
-	for ; i < len(dst); i++ {
-		select {
-		case e := <-m.buf:
-			dst[i] = e
-			id := atomic.AddUint64(&m.entryID, 1)
-			m.inFlightMux.Lock()
-			m.inFlight[id] = e
-			m.inFlightMux.Unlock()
-			inFlightIDs[i] = id
-		case <-ctx.Done():
-			return m.newFlushFunc(inFlightIDs[:i]), i, nil
+	for ; i < len(dst) && !m.flush.fullBytes(size); i++ {
+		var e *entry.Entry
+		if done == nil {
+			select {
+			case e = <-m.buf:
+			default:
+				return m.newFlushFunc(inFlightIDs[:i]), i, nil
+			}
+		} else {
+			select {
+			case e = <-m.buf:
+			case <-done:
+				return m.newFlushFunc(inFlightIDs[:i]), i, nil
+			}
+		}
+
+		dst[i] = e
+		id := atomic.AddUint64(&m.entryID, 1)
+		m.inFlightMux.Lock()
+		m.inFlight[id] = e
+		m.inFlightMux.Unlock()
+		inFlightIDs[i] = id
+
+		if m.flush.FlushMaxBytes > 0 {
+			size += entrySize(e)
 		}
 	}
 
 	return m.newFlushFunc(inFlightIDs[:i]), i, nil
 }
 
+// FlushInterval returns the maximum time that ReadWait waits for a batch to fill
+func (m *MemoryBuffer) FlushInterval() time.Duration {
+	return m.flush.FlushInterval.Raw()
+}
+
 // newFlushFunc returns a function that will remove the entries identified by `ids` from the buffer
 func (m *MemoryBuffer) newFlushFunc(ids []uint64) FlushFunc {
 	return func() error {
@@ -125,10 +192,33 @@ func (m *MemoryBuffer) newFlushFunc(ids []uint64) FlushFunc {
 		}
 		m.inFlightMux.Unlock()
 		m.sem.Release(int64(len(ids)))
+		atomic.AddUint64(&m.flushed, uint64(len(ids)))
 		return nil
 	}
 }
 
+// Stats returns the depth of the buffer
+func (m *MemoryBuffer) Stats() Stats {
+	m.inFlightMux.Lock()
+	inFlight := len(m.inFlight)
+	m.inFlightMux.Unlock()
+
+	return Stats{
+		Type:       "memory",
+		Entries:    int64(len(m.buf) + inFlight),
+		MaxEntries: m.maxEntries,
+		Added:      atomic.LoadUint64(&m.added),
+		Flushed:    atomic.LoadUint64(&m.flushed),
+		Dropped:    m.Dropped(),
+	}
+}
+
+// RecoveryReport returns a summary of the entries loaded from the database when
+// the buffer was built
+func (m *MemoryBuffer) RecoveryReport() *helper.RecoveryReport {
+	return m.recovery
+}
+
 // Close closes the memory buffer, saving all entries currently in the memory buffer to the
 // agent's database.
 func (m *MemoryBuffer) Close() error {
@@ -180,6 +270,7 @@ func putKeyValue(b *bbolt.Bucket, k uint64, v *entry.Entry) error {
 // loadFromDB loads any entries saved to the database previously into the memory buffer,
 // allowing them to be flushed
 func (m *MemoryBuffer) loadFromDB() error {
+	m.recovery = &helper.RecoveryReport{}
 	return m.db.Update(func(tx *bbolt.Tx) error {
 		memBufBucket := tx.Bucket([]byte("memory_buffer"))
 		if memBufBucket == nil {
@@ -204,6 +295,12 @@ func (m *MemoryBuffer) loadFromDB() error {
 
 			select {
 			case m.buf <- &e:
+				m.added++
+				m.recovery.BufferedEntries++
+				m.recovery.BufferedBytes += int64(len(v))
+				if m.recovery.OldestBuffered.IsZero() || e.Timestamp.Before(m.recovery.OldestBuffered) {
+					m.recovery.OldestBuffered = e.Timestamp
+				}
 				return nil
 			default:
 				return fmt.Errorf("max_entries is smaller than the number of entries stored in the database")
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -153,6 +154,25 @@ func TestMemoryBuffer(t *testing.T) {
 		require.Equal(t, 0, n)
 	})
 
+	t.Run("WriteCloseRecovery", func(t *testing.T) {
+		t.Parallel()
+		bc := testutil.NewBuildContext(t)
+		b, err := NewMemoryBufferConfig().Build(bc, "test")
+		require.NoError(t, err)
+		require.Equal(t, &helper.RecoveryReport{}, Recovery(b))
+		writeN(t, b, 10, 0)
+		flushN(t, b, 5, 0)
+		require.NoError(t, b.Close())
+
+		b, err = NewMemoryBufferConfig().Build(bc, "test")
+		require.NoError(t, err)
+
+		report := Recovery(b)
+		require.Equal(t, int64(5), report.BufferedEntries)
+		require.Greater(t, report.BufferedBytes, int64(0))
+		require.Equal(t, intEntry(5).Timestamp, report.OldestBuffered)
+	})
+
 	t.Run("AddTimesOut", func(t *testing.T) {
 		t.Parallel()
 		cfg := MemoryBufferConfig{
@@ -271,3 +291,16 @@ func BenchmarkMemoryBuffer(b *testing.B) {
 
 	wg.Wait()
 }
+
+func TestIsMemory(t *testing.T) {
+	memory, err := NewConfig().Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+	require.True(t, IsMemory(memory))
+
+	diskConfig := NewDiskBufferConfig()
+	diskConfig.Path = testutil.NewTempDir(t)
+	disk, err := Config{Builder: diskConfig}.Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+	defer disk.Close()
+	require.False(t, IsMemory(disk))
+}
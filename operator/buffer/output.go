@@ -0,0 +1,53 @@
+package buffer
+
+import (
+	"context"
+
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// Output is embedded by outputs that buffer their entries before sending
+// them, in place of helper.OutputOperator. It reports the state of the
+// buffer on behalf of the output.
+type Output struct {
+	helper.OutputOperator
+	Buffer Buffer
+}
+
+// NewOutput returns an Output that reports on the given buffer
+func NewOutput(outputOperator helper.OutputOperator, b Buffer) Output {
+	return Output{
+		OutputOperator: outputOperator,
+		Buffer:         b,
+	}
+}
+
+// Status reports the maintenance state of the output and the depth of its buffer
+func (o *Output) Status() map[string]interface{} {
+	return WithStatus(o.OutputOperator.Status(), o.Buffer)
+}
+
+// PendingWork returns the number of buffered entries that have not been sent
+func (o *Output) PendingWork() int64 {
+	return Pending(o.Buffer)
+}
+
+// Progress returns the number of buffered entries that have been sent
+func (o *Output) Progress() uint64 {
+	return Flushed(o.Buffer)
+}
+
+// SaveState persists the state of the buffer without closing it
+func (o *Output) SaveState() error {
+	return SaveState(o.Buffer)
+}
+
+// RecoveryReport returns a summary of the entries restored into the buffer at startup
+func (o *Output) RecoveryReport() *helper.RecoveryReport {
+	return Recovery(o.Buffer)
+}
+
+// WaitFlushed blocks until the entries received before the call have been sent
+func (o *Output) WaitFlushed(ctx context.Context) error {
+	return WaitFlushed(ctx, o.Buffer)
+}
@@ -0,0 +1,31 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput(t *testing.T) {
+	outputOperator, err := helper.NewOutputConfig("test", "test").Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	b, err := NewConfig().Build(testutil.NewBuildContext(t), "test")
+	require.NoError(t, err)
+	output := NewOutput(outputOperator, b)
+
+	writeN(t, b, 10, 0)
+	require.Equal(t, int64(10), output.PendingWork())
+	require.Equal(t, uint64(0), output.Progress())
+	require.Contains(t, output.Status(), "buffer")
+
+	flushN(t, b, 10, 0)
+	require.Equal(t, int64(0), output.PendingWork())
+	require.Equal(t, uint64(10), output.Progress())
+	require.NoError(t, output.WaitFlushed(context.Background()))
+
+	require.NoError(t, output.SaveState())
+	require.Equal(t, Recovery(b), output.RecoveryReport())
+}
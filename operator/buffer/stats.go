@@ -0,0 +1,58 @@
+package buffer
+
+// Stats is the depth of a buffer, and the number of entries that went through
+// it since it was built. Entries restored from a previous run are counted as
+// added. The entries that are in the buffer are the entries added that were
+// neither flushed nor dropped.
+type Stats struct {
+	Type string `json:"type"`
+
+	// Entries is the number of entries in the buffer, including the entries
+	// that were read and are waiting to be flushed
+	Entries int64 `json:"entries"`
+
+	// MaxEntries is the capacity of a memory buffer, and MaxBytes is the
+	// capacity of a disk buffer
+	MaxEntries int64 `json:"max_entries,omitempty"`
+	MaxBytes   int64 `json:"max_bytes,omitempty"`
+
+	// Bytes is the size of the entries in a disk buffer, and FileBytes is the
+	// size of its data file, which also holds flushed entries until the file
+	// is compacted
+	Bytes     int64 `json:"bytes,omitempty"`
+	FileBytes int64 `json:"file_bytes,omitempty"`
+
+	Added   uint64 `json:"added"`
+	Flushed uint64 `json:"flushed"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// statsReporter is implemented by buffers that report their depth
+type statsReporter interface {
+	Stats() Stats
+}
+
+// CurrentStats returns the depth of a buffer, or nil if the buffer does not
+// report it
+func CurrentStats(b Buffer) *Stats {
+	reporter, ok := unwrap(b).(statsReporter)
+	if !ok {
+		return nil
+	}
+	stats := reporter.Stats()
+	return &stats
+}
+
+// WithStatus adds the depth of a buffer to the status of the output that owns
+// it, as buffer
+func WithStatus(status map[string]interface{}, b Buffer) map[string]interface{} {
+	stats := CurrentStats(b)
+	if stats == nil {
+		return status
+	}
+	if status == nil {
+		status = make(map[string]interface{}, 1)
+	}
+	status["buffer"] = stats
+	return status
+}
@@ -0,0 +1,100 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferStats(t *testing.T) {
+	// Entries 10 to 99 have the same size, so the buffers below hold 10 of them
+	builders := map[string]func(t *testing.T) Buffer{
+		"Memory": func(t *testing.T) Buffer {
+			cfg := NewMemoryBufferConfig()
+			cfg.MaxEntries = 10
+			cfg.WhenFull = WhenFullDropNewest
+			b, err := cfg.Build(testutil.NewBuildContext(t), "test")
+			require.NoError(t, err)
+			return b
+		},
+		"Disk": func(t *testing.T) Buffer {
+			cfg := NewDiskBufferConfig()
+			cfg.MaxBytes = 10 * recordSize(intEntry(10))
+			cfg.Path = testutil.NewTempDir(t)
+			cfg.Sync = false
+			cfg.WhenFull = WhenFullDropNewest
+			b, err := cfg.Build(testutil.NewBuildContext(t), "test")
+			require.NoError(t, err)
+			t.Cleanup(func() { b.Close() })
+			return b
+		},
+	}
+
+	for name, build := range builders {
+		build := build
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b := build(t)
+
+			stats := CurrentStats(b)
+			require.NotNil(t, stats)
+			require.Equal(t, int64(0), stats.Entries)
+			if stats.Type == "disk" {
+				require.Equal(t, 10*recordSize(intEntry(10)), stats.MaxBytes)
+			} else {
+				require.Equal(t, int64(10), stats.MaxEntries)
+			}
+
+			writeN(t, b, 5, 10)
+			stats = CurrentStats(b)
+			require.Equal(t, int64(5), stats.Entries)
+			require.Equal(t, uint64(5), stats.Added)
+			if stats.Type == "disk" {
+				require.Equal(t, 5*recordSize(intEntry(10)), stats.Bytes)
+				require.Equal(t, stats.Bytes, stats.FileBytes)
+			}
+
+			// Entries that are read stay in the buffer until they are flushed
+			flush := readN(t, b, 3, 10)
+			require.Equal(t, int64(5), CurrentStats(b).Entries)
+			require.NoError(t, flush())
+
+			stats = CurrentStats(b)
+			require.Equal(t, int64(2), stats.Entries)
+			require.Equal(t, uint64(3), stats.Flushed)
+			if stats.Type == "disk" {
+				// The flushed entries take space in the data file until it is compacted
+				require.Equal(t, 2*recordSize(intEntry(10)), stats.Bytes)
+				require.Equal(t, 5*recordSize(intEntry(10)), stats.FileBytes)
+			}
+
+			// The buffer has room for 8 more entries, so the others are dropped
+			writeN(t, b, 20, 15)
+			stats = CurrentStats(b)
+			require.Equal(t, int64(10), stats.Entries)
+			require.Equal(t, uint64(13), stats.Added)
+			require.Equal(t, uint64(12), stats.Dropped)
+
+			flushN(t, b, 10, 13)
+			stats = CurrentStats(b)
+			require.Equal(t, int64(0), stats.Entries)
+			require.Equal(t, uint64(13), stats.Flushed)
+			require.Equal(t, stats.Added-stats.Flushed, uint64(stats.Entries))
+		})
+	}
+}
+
+func TestWithStatus(t *testing.T) {
+	b := NewDiskBuffer(1 << 20)
+	require.NoError(t, b.Open(testutil.NewTempDir(t), false))
+	defer b.Close()
+
+	status := WithStatus(nil, b)
+	require.Equal(t, int64(1<<20), status["buffer"].(*Stats).MaxBytes)
+
+	status = WithStatus(map[string]interface{}{"maintenance": "parked"}, b)
+	require.Len(t, status, 2)
+
+	require.Nil(t, WithStatus(nil, nil))
+}
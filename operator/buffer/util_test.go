@@ -16,6 +16,11 @@ func intEntry(i int) *entry.Entry {
 	return e
 }
 
+// recordSize returns the size of an entry in the data file of a disk buffer
+func recordSize(e *entry.Entry) int64 {
+	return entrySize(e) - 1 + recordHeaderSize
+}
+
 func writeN(t testing.TB, buffer Buffer, n, start int) {
 	ctx := context.Background()
 	for i := start; i < n+start; i++ {
@@ -3,6 +3,7 @@ package operator
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/observiq/stanza/database"
 	"github.com/observiq/stanza/logger"
@@ -17,6 +18,28 @@ type BuildContext struct {
 	Namespace        string
 	DefaultOutputIDs []string
 	PluginDepth      int
+
+	// SampleBackpressure enables sampling of the time operators spend blocked
+	// while handing entries off to their outputs
+	SampleBackpressure bool
+
+	// CollectStats enables counting the entries handled by each operator
+	CollectStats bool
+
+	// Throttles are the named budgets that inputs can share
+	Throttles *Throttles
+
+	// WriteBehind batches the writes of persisters into periodic
+	// transactions. Persisters write synchronously if it is nil.
+	WriteBehind *database.WriteBehind
+
+	// DefaultLocation is the time zone of timestamps that do not have one.
+	// Timestamps are parsed in the local time zone if it is nil.
+	DefaultLocation *time.Location
+
+	// ReadPriority is the priority of the reads of inputs that read large
+	// amounts of logs. Reads are at normal priority if it is nil.
+	ReadPriority *PriorityConfig
 }
 
 // PrependNamespace adds the current namespace of the build context to the
@@ -60,6 +83,13 @@ func (bc BuildContext) Copy() BuildContext {
 		Namespace:        bc.Namespace,
 		DefaultOutputIDs: bc.DefaultOutputIDs,
 		PluginDepth:      bc.PluginDepth,
+
+		SampleBackpressure: bc.SampleBackpressure,
+		CollectStats:       bc.CollectStats,
+		Throttles:          bc.Throttles,
+		WriteBehind:        bc.WriteBehind,
+		DefaultLocation:    bc.DefaultLocation,
+		ReadPriority:       bc.ReadPriority,
 	}
 }
 
@@ -0,0 +1,224 @@
+package file
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+)
+
+// backfill tracks the progress of reading the files that matched the include
+// patterns when the operator started, from their offsets to the end. Once
+// every file is finished, the operator stops polling.
+type backfill struct {
+	// exit is set when the agent stops once the backfill is complete
+	exit bool
+	done chan struct{}
+
+	// entries is the number of entries emitted during the backfill
+	entries uint64
+
+	mux      sync.Mutex
+	started  time.Time
+	finished time.Time
+	files    map[string]*backfillFile
+
+	// waiting is set while the entries of the backfill are waited for
+	waiting bool
+}
+
+// backfillFile is the progress of a file that is backfilled
+type backfillFile struct {
+	size   int64
+	offset int64
+	done   bool
+}
+
+func newBackfill(exit bool) *backfill {
+	return &backfill{
+		exit: exit,
+		done: make(chan struct{}),
+	}
+}
+
+// countEntry counts an entry emitted during the backfill
+func (b *backfill) countEntry() {
+	if b != nil {
+		atomic.AddUint64(&b.entries, 1)
+	}
+}
+
+// complete returns true once every file has been backfilled
+func (b *backfill) complete() bool {
+	if b == nil {
+		return false
+	}
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// update records the progress of the files after a poll. The files are the
+// paths matched by the first poll. A file is done once it has been read to
+// the end on two polls in a row without changing, or once it is gone, such
+// as when it is deleted after it is read. A file that is not read, because
+// it is empty or has the fingerprint of another file, is done as well,
+// unless it is locked by another process. It returns true if every file is done.
+func (b *backfill) update(matches []string, readers []*Reader, locked *lockedFiles) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.files == nil {
+		b.started = time.Now()
+		b.files = make(map[string]*backfillFile, len(matches))
+		for _, path := range matches {
+			b.files[path] = &backfillFile{}
+		}
+	}
+
+	byPath := make(map[string]*Reader, len(readers))
+	for _, reader := range readers {
+		byPath[reader.Path] = reader
+	}
+
+	allDone := true
+	for path, file := range b.files {
+		if file.done {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			file.offset = file.size
+			file.done = true
+			continue
+		}
+		file.size = info.Size()
+
+		reader, ok := byPath[path]
+		switch {
+		case ok:
+			file.offset = reader.Offset
+			file.done = reader.finished
+		case locked.isLocked(path):
+		default:
+			file.offset = file.size
+			file.done = true
+		}
+		allDone = allDone && file.done
+	}
+	return allDone
+}
+
+// startWaiting returns true if the entries of the backfill are not already
+// being waited for, and marks them as waited for
+func (b *backfill) startWaiting() bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.waiting || !b.finished.IsZero() {
+		return false
+	}
+	b.waiting = true
+	return true
+}
+
+// stopWaiting marks the entries of the backfill as no longer waited for
+func (b *backfill) stopWaiting() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.waiting = false
+}
+
+// finish marks the backfill complete, and returns a summary of it
+func (b *backfill) finish() []interface{} {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.finished = time.Now()
+	close(b.done)
+
+	var bytes int64
+	for _, file := range b.files {
+		bytes += file.size
+	}
+	return []interface{}{
+		"files", len(b.files),
+		"entries", atomic.LoadUint64(&b.entries),
+		"bytes", bytes,
+		"duration", b.finished.Sub(b.started).Round(time.Millisecond).String(),
+	}
+}
+
+// status reports the progress of the backfill
+func (b *backfill) status() map[string]interface{} {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	completed := 0
+	var remaining int64
+	for _, file := range b.files {
+		if file.done {
+			completed++
+			continue
+		}
+		if file.size > file.offset {
+			remaining += file.size - file.offset
+		}
+	}
+
+	end := b.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	var duration time.Duration
+	if !b.started.IsZero() {
+		duration = end.Sub(b.started).Round(time.Second)
+	}
+
+	return map[string]interface{}{
+		"complete":        !b.finished.IsZero(),
+		"files_completed": completed,
+		"files_total":     len(b.files),
+		"bytes_remaining": remaining,
+		"entries":         atomic.LoadUint64(&b.entries),
+		"duration":        duration.String(),
+	}
+}
+
+// updateBackfill records the progress of the backfill after a poll. Once
+// every file is done, it waits for the outputs downstream to send the entries
+// read from them on its own goroutine, so that polls are not blocked, and
+// then completes the backfill.
+func (f *InputOperator) updateBackfill(ctx context.Context, matches []string, readers []*Reader) {
+	if !f.backfill.update(matches, readers, f.locked) || !f.backfill.startWaiting() {
+		return
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := helper.WaitFlushed(ctx, f.OutputOperators); err != nil {
+			// The backfill is completed after the next poll instead
+			f.backfill.stopWaiting()
+			f.Debugw("Stopped waiting for entries to be sent before completing backfill", zap.Error(err))
+			return
+		}
+		f.Infow("Backfill complete", f.backfill.finish()...)
+	}()
+}
+
+// Completed returns a channel that is closed once the backfill is complete,
+// if the agent should stop then. It returns nil otherwise.
+func (f *InputOperator) Completed() <-chan struct{} {
+	if f.backfill == nil || !f.backfill.exit {
+		return nil
+	}
+	return f.backfill.done
+}
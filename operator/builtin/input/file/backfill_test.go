@@ -0,0 +1,161 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// Backfill tests that the files that match when the operator starts are
+// read to the end, that the backfill completes once they stop changing, and
+// that its progress is reported in the status of the operator
+func TestBackfill(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Backfill = true
+		cfg.ExitAfterBackfill = true
+	}, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 100)
+	})
+
+	expected := make([]string, 0, 30)
+	for i := 0; i < 3; i++ {
+		temp := openTemp(t, tempDir)
+		for j := 0; j < 10; j++ {
+			message := fmt.Sprintf("file%d-log%d", i, j)
+			writeString(t, temp, message+"\n")
+			expected = append(expected, message)
+		}
+	}
+	// Empty files are not read, so they are done at once
+	openTemp(t, tempDir)
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, expected)
+	require.False(t, operator.backfill.complete())
+
+	status := operator.Status()["backfill"].(map[string]interface{})
+	require.Equal(t, false, status["complete"])
+	require.Equal(t, 1, status["files_completed"])
+	require.Equal(t, 4, status["files_total"])
+	require.Equal(t, int64(0), status["bytes_remaining"])
+	require.Equal(t, uint64(30), status["entries"])
+
+	// A file that is created after the first poll is not part of the backfill
+	late := openTemp(t, tempDir)
+	writeString(t, late, "late\n")
+
+	operator.poll(context.Background())
+	operator.wg.Wait()
+	require.True(t, operator.backfill.complete())
+	waitForMessage(t, logReceived, "late")
+
+	status = operator.Status()["backfill"].(map[string]interface{})
+	require.Equal(t, true, status["complete"])
+	require.Equal(t, 4, status["files_completed"])
+	require.Equal(t, 4, status["files_total"])
+
+	select {
+	case <-operator.Completed():
+	default:
+		require.FailNow(t, "Expected backfill to be completed")
+	}
+}
+
+// BackfillGrowing tests that a file that is still being written holds the
+// backfill open, and that its unread bytes are reported
+func TestBackfillGrowing(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Backfill = true
+	}, nil)
+	require.Nil(t, operator.Completed())
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "log1\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "log1")
+
+	writeString(t, temp, "log2\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "log2")
+	require.False(t, operator.backfill.complete())
+
+	operator.poll(context.Background())
+	operator.wg.Wait()
+	require.True(t, operator.backfill.complete())
+}
+
+// BackfillDeleteAfterRead tests that a backfill completes once every file
+// has been deleted after it was read
+func TestBackfillDeleteAfterRead(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Backfill = true
+		cfg.DeleteAfterRead = true
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "log1\n")
+	require.NoError(t, temp.Close())
+
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "log1")
+	require.False(t, operator.backfill.complete())
+
+	operator.poll(context.Background())
+	operator.wg.Wait()
+	_, err := os.Stat(temp.Name())
+	require.True(t, os.IsNotExist(err))
+	require.True(t, operator.backfill.complete())
+}
+
+// BackfillPriority tests that files are read on the threads of the pool of
+// the backfill priority while the operator runs
+func TestBackfillPriority(t *testing.T) {
+	t.Parallel()
+	op, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Backfill = true
+		cfg.BackfillPriority = &operator.PriorityConfig{IOPriority: operator.IOPriorityIdle, Nice: 5}
+	}, nil)
+	require.NotNil(t, op.readPool)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "log1\nlog2\n")
+
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	waitForMessage(t, logReceived, "log1")
+	waitForMessage(t, logReceived, "log2")
+}
+
+// BackfillMultiline tests that the last entry of a file is flushed once it
+// stops growing, rather than after the force flush period
+func TestBackfillMultiline(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Backfill = true
+		cfg.Multiline = &MultilineConfig{LineStartPattern: `^START`}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "START one\ncontinued\nSTART two\n")
+
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "START one\ncontinued\n")
+	expectNoMessages(t, logReceived)
+
+	for i := 0; i < 3 && !operator.backfill.complete(); i++ {
+		operator.poll(context.Background())
+		operator.wg.Wait()
+	}
+	waitForMessage(t, logReceived, "START two\n")
+	require.True(t, operator.backfill.complete())
+}
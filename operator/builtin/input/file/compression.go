@@ -0,0 +1,102 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// CompressionNone reads files as they are
+	CompressionNone = "none"
+	// CompressionGzip decompresses every file with gzip
+	CompressionGzip = "gzip"
+	// CompressionAuto decompresses files that start with the gzip magic bytes
+	CompressionAuto = "auto"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isCompressed returns true if a file should be read with gzip decompression
+func (f *InputOperator) isCompressed(file *os.File) (bool, error) {
+	switch f.compression {
+	case CompressionGzip:
+		return true, nil
+	case CompressionAuto:
+		magic := make([]byte, len(gzipMagic))
+		n, err := file.ReadAt(magic, 0)
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("reading magic bytes: %s", err)
+		}
+		return bytes.Equal(magic[:n], gzipMagic), nil
+	default:
+		return false, nil
+	}
+}
+
+// newFingerprint creates a fingerprint of an open file. The fingerprint of a
+// compressed file is taken from its decompressed contents, so that it matches
+// the fingerprint of the file it was compressed from.
+func (f *InputOperator) newFingerprint(file *os.File) (*Fingerprint, error) {
+	compressed, err := f.isCompressed(file)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		fp, err := NewFingerprint(file, f.fingerprintBytes)
+		if err != nil {
+			return nil, err
+		}
+		return f.trimFingerprint(fp), nil
+	}
+	return NewGzipFingerprint(file, f.fingerprintBytes)
+}
+
+// NewGzipFingerprint creates a fingerprint from the first size decompressed
+// bytes of an open gzip file. A file that is too short to have a complete header, such as
+// one that is still being compressed, has an empty fingerprint.
+func NewGzipFingerprint(file *os.File, size int64) (*Fingerprint, error) {
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("seek: %s", err)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &Fingerprint{FirstBytes: []byte{}}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading gzip header: %s", err)
+	}
+	defer gz.Close()
+
+	buf := make([]byte, size)
+	n, err := io.ReadFull(gz, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("reading fingerprint bytes: %s", err)
+	}
+	return &Fingerprint{
+		FirstBytes: buf[:n],
+	}, nil
+}
+
+// openDecompressed returns a reader of the decompressed contents of the file,
+// positioned at the reader's offset
+func (f *Reader) openDecompressed() (io.Reader, error) {
+	if _, err := f.file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("seek: %s", err)
+	}
+
+	gz, err := gzip.NewReader(f.file)
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip header: %s", err)
+	}
+
+	// Compressed files cannot be seeked, so the bytes that were already read
+	// are decompressed and discarded
+	if _, err := io.CopyN(ioutil.Discard, gz, f.Offset); err != nil {
+		return nil, fmt.Errorf("skipping to offset: %s", err)
+	}
+	return gz, nil
+}
@@ -0,0 +1,162 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, contents string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func writeGzipFile(t *testing.T, path, contents string) {
+	require.NoError(t, ioutil.WriteFile(path, gzipBytes(t, contents), 0666))
+}
+
+func TestReadGzipFile(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Compression = CompressionGzip
+	}, nil)
+
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.1.gz"), "testlog1\ntestlog2\n")
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"testlog1", "testlog2"})
+
+	// A compressed file is only read once
+	operator.poll(context.Background())
+	expectNoMessages(t, logReceived)
+}
+
+func TestReadGzipFileNotReadAfterRestart(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Compression = CompressionGzip
+	}, nil)
+
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.1.gz"), "testlog1\n")
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+	waitForMessage(t, logReceived, "testlog1")
+	require.NoError(t, operator.Stop())
+
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.2.gz"), "testlog2\n")
+
+	require.NoError(t, operator.Start())
+	waitForMessages(t, logReceived, []string{"testlog2"})
+}
+
+func TestReadGzipFileAutoDetect(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Compression = CompressionAuto
+	}, nil)
+
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.1.gz"), "compressed\n")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "app.log"), []byte("plain\n"), 0666))
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"compressed", "plain"})
+}
+
+func TestReadGzipFileStartAtEnd(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Compression = CompressionGzip
+		cfg.StartAt = "end"
+	}, nil)
+
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.1.gz"), "testlog1\n")
+	operator.poll(context.Background())
+
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.2.gz"), "testlog2\n")
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"testlog2"})
+}
+
+func TestReadGzipFileCompressedAfterRotation(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Compression = CompressionAuto
+	}, nil)
+
+	plainPath := filepath.Join(tempDir, "app.log.1")
+	require.NoError(t, ioutil.WriteFile(plainPath, []byte("testlog1\n"), 0666))
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog1")
+
+	// The file is written to once more, then compressed and removed
+	writeGzipFile(t, filepath.Join(tempDir, "app.log.1.gz"), "testlog1\ntestlog2\n")
+	require.NoError(t, os.Remove(plainPath))
+
+	// The compressed file continues where the plain file was left
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"testlog2"})
+}
+
+func TestReadGzipFileIncomplete(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Compression = CompressionGzip
+	}, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 1000)
+	})
+
+	var contents bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		contents.WriteString(fmt.Sprintf("testlog%d\n", i))
+	}
+	compressed := gzipBytes(t, contents.String())
+
+	// The file is read while it is still being compressed
+	path := filepath.Join(tempDir, "app.log.1.gz")
+	require.NoError(t, ioutil.WriteFile(path, compressed[:len(compressed)/2], 0666))
+	operator.poll(context.Background())
+
+	require.NoError(t, ioutil.WriteFile(path, compressed, 0666))
+	operator.poll(context.Background())
+
+	expected := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		expected = append(expected, fmt.Sprintf("testlog%d", i))
+	}
+	waitForMessages(t, logReceived, expected)
+}
+
+func TestNewGzipFingerprint(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	path := filepath.Join(tempDir, "app.log.gz")
+
+	writeGzipFile(t, path, "testlog1\n")
+	file := openFile(t, path)
+	fp, err := NewGzipFingerprint(file, defaultFingerprintSize)
+	require.NoError(t, err)
+	require.Equal(t, []byte("testlog1\n"), fp.FirstBytes)
+
+	// A file without a complete header is not ready to be read
+	require.NoError(t, ioutil.WriteFile(path, []byte{0x1f}, 0666))
+	fp, err = NewGzipFingerprint(file, defaultFingerprintSize)
+	require.NoError(t, err)
+	require.Empty(t, fp.FirstBytes)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("this is not a gzip file\n"), 0666))
+	_, err = NewGzipFingerprint(file, defaultFingerprintSize)
+	require.Error(t, err)
+}
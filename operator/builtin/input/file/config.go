@@ -3,8 +3,8 @@ package file
 import (
 	"bufio"
 	"fmt"
-	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
@@ -20,16 +20,33 @@ func init() {
 	operator.Register("file_input", func() operator.Builder { return NewInputConfig("") })
 }
 
+const (
+	defaultFingerprintSize     = 1000
+	minFingerprintSize         = 16
+	maxFingerprintSize         = 64 * 1024
+	defaultMaxConcurrentFiles  = 1024
+	defaultNULPaddingThreshold = 64
+	minNULPaddingThreshold     = 8
+)
+
 // NewInputConfig creates a new input config with default values
 func NewInputConfig(operatorID string) *InputConfig {
 	return &InputConfig{
-		InputConfig:     helper.NewInputConfig(operatorID, "file_input"),
-		PollInterval:    helper.Duration{Duration: 200 * time.Millisecond},
-		IncludeFileName: true,
-		IncludeFilePath: false,
-		StartAt:         "end",
-		MaxLogSize:      1024 * 1024,
-		Encoding:        "nop",
+		InputConfig:         helper.NewInputConfig(operatorID, "file_input"),
+		PollInterval:        helper.Duration{Duration: 200 * time.Millisecond},
+		IncludeFileName:     true,
+		IncludeFilePath:     false,
+		StartAt:             "end",
+		MaxLogSize:          1024 * 1024,
+		MaxLogSizeUnit:      SizeUnitRawBytes,
+		FingerprintSize:     defaultFingerprintSize,
+		Encoding:            "nop",
+		WatchMode:           WatchModePoll,
+		ScanInterval:        helper.Duration{Duration: 10 * time.Second},
+		Compression:         CompressionNone,
+		ReadMode:            ReadModeLines,
+		MaxConcurrentFiles:  defaultMaxConcurrentFiles,
+		NULPaddingThreshold: defaultNULPaddingThreshold,
 	}
 }
 
@@ -37,22 +54,49 @@ func NewInputConfig(operatorID string) *InputConfig {
 type InputConfig struct {
 	helper.InputConfig `yaml:",inline"`
 
-	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Include []string `json:"include,omitempty" yaml:"include,omitempty" required:"true"`
 	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
 
-	PollInterval    helper.Duration  `json:"poll_interval,omitempty"     yaml:"poll_interval,omitempty"`
-	Multiline       *MultilineConfig `json:"multiline,omitempty"         yaml:"multiline,omitempty"`
-	IncludeFileName bool             `json:"include_file_name,omitempty" yaml:"include_file_name,omitempty"`
-	IncludeFilePath bool             `json:"include_file_path,omitempty" yaml:"include_file_path,omitempty"`
-	StartAt         string           `json:"start_at,omitempty"          yaml:"start_at,omitempty"`
-	MaxLogSize      int              `json:"max_log_size,omitempty"      yaml:"max_log_size,omitempty"`
-	Encoding        string           `json:"encoding,omitempty"          yaml:"encoding,omitempty"`
+	PollInterval            helper.Duration  `json:"poll_interval,omitempty"     yaml:"poll_interval,omitempty"`
+	Multiline               *MultilineConfig `json:"multiline,omitempty"         yaml:"multiline,omitempty"`
+	IncludeFileName         bool             `json:"include_file_name,omitempty" yaml:"include_file_name,omitempty"`
+	IncludeFilePath         bool             `json:"include_file_path,omitempty" yaml:"include_file_path,omitempty"`
+	IncludeFilePathResolved bool             `json:"include_file_path_resolved,omitempty" yaml:"include_file_path_resolved,omitempty"`
+	IncludeFileMtime        bool             `json:"include_file_mtime,omitempty"         yaml:"include_file_mtime,omitempty"`
+	IncludeFileOwner        bool             `json:"include_file_owner,omitempty"         yaml:"include_file_owner,omitempty"`
+	IncludeFileOffset       bool             `json:"include_file_offset,omitempty"        yaml:"include_file_offset,omitempty"`
+	StartAt                 string           `json:"start_at,omitempty"          yaml:"start_at,omitempty"`
+	MaxLogSize              int              `json:"max_log_size,omitempty"      yaml:"max_log_size,omitempty"`
+	MaxLogSizeUnit          string           `json:"max_log_size_unit,omitempty" yaml:"max_log_size_unit,omitempty"`
+	FingerprintSize         int              `json:"fingerprint_size,omitempty"  yaml:"fingerprint_size,omitempty"`
+	Encoding                string           `json:"encoding,omitempty"          yaml:"encoding,omitempty"`
+	StrictIncludes          bool             `json:"strict_includes,omitempty"   yaml:"strict_includes,omitempty"`
+	WatchMode               string           `json:"watch_mode,omitempty"        yaml:"watch_mode,omitempty"`
+	ScanInterval            helper.Duration  `json:"scan_interval,omitempty"     yaml:"scan_interval,omitempty"`
+	Compression             string           `json:"compression,omitempty"       yaml:"compression,omitempty"`
+	DeleteAfterRead         bool             `json:"delete_after_read,omitempty" yaml:"delete_after_read,omitempty"`
+	MaxConcurrentFiles      int              `json:"max_concurrent_files,omitempty" yaml:"max_concurrent_files,omitempty"`
+	Header                  *HeaderConfig    `json:"header,omitempty"            yaml:"header,omitempty"`
+	ReadAheadSize           int              `json:"read_ahead_size,omitempty"   yaml:"read_ahead_size,omitempty"`
+	ReadMode                string           `json:"read_mode,omitempty"         yaml:"read_mode,omitempty"`
+	BackupSemantics         bool             `json:"backup_semantics,omitempty"  yaml:"backup_semantics,omitempty"`
+	SkipNULPadding          bool             `json:"skip_nul_padding,omitempty"  yaml:"skip_nul_padding,omitempty"`
+	NULPaddingThreshold     int              `json:"nul_padding_threshold,omitempty" yaml:"nul_padding_threshold,omitempty"`
+	DefaultEncoding         string           `json:"default_encoding,omitempty"  yaml:"default_encoding,omitempty"`
+	PreviousIDs             []string         `json:"previous_ids,omitempty"      yaml:"previous_ids,omitempty"`
+
+	SuppressConsecutiveDuplicates *DuplicatesConfig        `json:"suppress_consecutive_duplicates,omitempty" yaml:"suppress_consecutive_duplicates,omitempty"`
+	Profiles                      []ProfileConfig          `json:"profiles,omitempty"                        yaml:"profiles,omitempty"`
+	Backfill                      bool                     `json:"backfill,omitempty"                        yaml:"backfill,omitempty"`
+	ExitAfterBackfill             bool                     `json:"exit_after_backfill,omitempty"             yaml:"exit_after_backfill,omitempty"`
+	BackfillPriority              *operator.PriorityConfig `json:"backfill_priority,omitempty"               yaml:"backfill_priority,omitempty"`
 }
 
 // MultilineConfig is the configuration a multiline operation
 type MultilineConfig struct {
-	LineStartPattern string `json:"line_start_pattern" yaml:"line_start_pattern"`
-	LineEndPattern   string `json:"line_end_pattern"   yaml:"line_end_pattern"`
+	LineStartPattern string          `json:"line_start_pattern"           yaml:"line_start_pattern"`
+	LineEndPattern   string          `json:"line_end_pattern"             yaml:"line_end_pattern"`
+	ForceFlushPeriod helper.Duration `json:"force_flush_period,omitempty" yaml:"force_flush_period,omitempty"`
 }
 
 // Build will build a file input operator from the supplied configuration
@@ -68,26 +112,19 @@ func (c InputConfig) Build(context operator.BuildContext) ([]operator.Operator,
 
 	// Ensure includes can be parsed as globs
 	for _, include := range c.Include {
-		_, err := filepath.Match(include, "matchstring")
-		if err != nil {
+		if err := validateGlob(include); err != nil {
 			return nil, fmt.Errorf("parse include glob: %s", err)
 		}
 	}
 
 	// Ensure excludes can be parsed as globs
 	for _, exclude := range c.Exclude {
-		_, err := filepath.Match(exclude, "matchstring")
-		if err != nil {
+		if err := validateGlob(exclude); err != nil {
 			return nil, fmt.Errorf("parse exclude glob: %s", err)
 		}
 	}
 
-	encoding, err := lookupEncoding(c.Encoding)
-	if err != nil {
-		return nil, err
-	}
-
-	splitFunc, err := c.getSplitFunc(encoding)
+	encoding, bomEncodings, err := c.buildEncodings()
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +139,151 @@ func (c InputConfig) Build(context operator.BuildContext) ([]operator.Operator,
 		return nil, fmt.Errorf("invalid start_at location '%s'", c.StartAt)
 	}
 
+	if c.DeleteAfterRead && !startAtBeginning {
+		return nil, fmt.Errorf("delete_after_read requires start_at to be 'beginning'")
+	}
+
+	var fileBackfill *backfill
+	if c.Backfill {
+		if !startAtBeginning {
+			return nil, fmt.Errorf("backfill requires start_at to be 'beginning'")
+		}
+		fileBackfill = newBackfill(c.ExitAfterBackfill)
+	} else if c.ExitAfterBackfill {
+		return nil, fmt.Errorf("exit_after_backfill requires backfill")
+	} else if c.BackfillPriority != nil {
+		return nil, fmt.Errorf("backfill_priority requires backfill")
+	}
+
+	// Files are read with the priority of the agent, unless the backfill of
+	// the operator has its own
+	priority := context.ReadPriority
+	if c.BackfillPriority != nil {
+		priority = c.BackfillPriority
+	}
+	var readPool *operator.PriorityPool
+	if priority != nil {
+		readPool, err = operator.NewPriorityPool(*priority, runtime.NumCPU(), inputOperator.SugaredLogger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.WatchMode {
+	case WatchModePoll, WatchModeNotify, WatchModeAuto:
+	default:
+		return nil, fmt.Errorf("invalid watch_mode '%s'", c.WatchMode)
+	}
+
+	if c.WatchMode != WatchModePoll && c.ScanInterval.Raw() <= 0 {
+		return nil, fmt.Errorf("scan_interval must be positive with watch_mode '%s'", c.WatchMode)
+	}
+
+	if c.FingerprintSize < minFingerprintSize || c.FingerprintSize > maxFingerprintSize {
+		return nil, fmt.Errorf("invalid fingerprint_size '%d', must be between %d and %d", c.FingerprintSize, minFingerprintSize, maxFingerprintSize)
+	}
+
+	if c.MaxConcurrentFiles < 1 {
+		return nil, fmt.Errorf("invalid max_concurrent_files '%d', must be at least 1", c.MaxConcurrentFiles)
+	}
+
+	if c.ReadAheadSize < 0 {
+		return nil, fmt.Errorf("invalid read_ahead_size '%d', must not be negative", c.ReadAheadSize)
+	}
+
+	switch c.MaxLogSizeUnit {
+	case SizeUnitRawBytes, SizeUnitDecodedBytes, SizeUnitRunes:
+	default:
+		return nil, fmt.Errorf("invalid max_log_size_unit '%s'", c.MaxLogSizeUnit)
+	}
+
+	switch c.Compression {
+	case CompressionNone, CompressionGzip, CompressionAuto:
+	default:
+		return nil, fmt.Errorf("invalid compression '%s'", c.Compression)
+	}
+
+	switch c.ReadMode {
+	case ReadModeLines:
+	case ReadModeJSONArray:
+		if c.Multiline != nil {
+			return nil, fmt.Errorf("multiline cannot be used with read_mode '%s'", c.ReadMode)
+		}
+		if c.Header != nil {
+			return nil, fmt.Errorf("header cannot be used with read_mode '%s'", c.ReadMode)
+		}
+		if !isUTF8(encoding.encoding) || bomEncodings != nil {
+			return nil, fmt.Errorf("read_mode '%s' requires a utf-8 encoding", c.ReadMode)
+		}
+		if c.MaxLogSizeUnit != SizeUnitRawBytes {
+			return nil, fmt.Errorf("read_mode '%s' requires max_log_size_unit '%s'", c.ReadMode, SizeUnitRawBytes)
+		}
+	default:
+		return nil, fmt.Errorf("invalid read_mode '%s'", c.ReadMode)
+	}
+
+	var nulPaddingThreshold int
+	if c.SkipNULPadding {
+		if c.ReadMode != ReadModeLines {
+			return nil, fmt.Errorf("skip_nul_padding cannot be used with read_mode '%s'", c.ReadMode)
+		}
+		if c.NULPaddingThreshold < minNULPaddingThreshold {
+			return nil, fmt.Errorf("invalid nul_padding_threshold '%d', must be at least %d", c.NULPaddingThreshold, minNULPaddingThreshold)
+		}
+		nulPaddingThreshold = c.NULPaddingThreshold
+	}
+
+	var forceFlushPeriod time.Duration
+	if c.Multiline != nil {
+		if c.Multiline.ForceFlushPeriod.Raw() < 0 {
+			return nil, fmt.Errorf("invalid force_flush_period '%s'", c.Multiline.ForceFlushPeriod.Raw())
+		}
+		forceFlushPeriod = c.Multiline.ForceFlushPeriod.Raw()
+	}
+
+	var duplicates *duplicateSuppression
+	if c.SuppressConsecutiveDuplicates != nil {
+		if c.ReadMode != ReadModeLines {
+			return nil, fmt.Errorf("suppress_consecutive_duplicates cannot be used with read_mode '%s'", c.ReadMode)
+		}
+		duplicates, err = c.SuppressConsecutiveDuplicates.build()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var outputProfiles *profiles
+	if len(c.Profiles) > 0 {
+		switch {
+		case len(c.OutputIDs) > 0:
+			return nil, fmt.Errorf("output cannot be used with profiles, which set the outputs of each profile")
+		case c.ReadMode != ReadModeLines:
+			return nil, fmt.Errorf("profiles cannot be used with read_mode '%s'", c.ReadMode)
+		case c.SuppressConsecutiveDuplicates != nil:
+			return nil, fmt.Errorf("profiles cannot be used with suppress_consecutive_duplicates")
+		case c.Header != nil:
+			return nil, fmt.Errorf("profiles cannot be used with header")
+		case c.DeleteAfterRead:
+			return nil, fmt.Errorf("profiles cannot be used with delete_after_read")
+		case c.Backfill:
+			return nil, fmt.Errorf("profiles cannot be used with backfill")
+		}
+
+		outputProfiles, err = buildProfiles(c.Profiles, context, inputOperator.SugaredLogger)
+		if err != nil {
+			return nil, err
+		}
+		inputOperator.OutputIDs = outputProfiles.outputIDs()
+	}
+
+	var header *headerParser
+	if c.Header != nil {
+		header, err = c.Header.build(context, c.ID())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	fileNameField := entry.NewNilField()
 	if c.IncludeFileName {
 		fileNameField = entry.NewLabelField("file_name")
@@ -116,18 +298,42 @@ func (c InputConfig) Build(context operator.BuildContext) ([]operator.Operator,
 		InputOperator:    inputOperator,
 		Include:          c.Include,
 		Exclude:          c.Exclude,
-		SplitFunc:        splitFunc,
 		PollInterval:     c.PollInterval.Raw(),
-		persist:          helper.NewScopedDBPersister(context.Database, c.ID()),
+		persist:          helper.NewMigratingDBPersister(context.Database, c.ID(), c.PreviousIDs, inputOperator.SugaredLogger).WithWriteBehind(context.WriteBehind),
 		FilePathField:    filePathField,
 		FileNameField:    fileNameField,
-		fingerprintBytes: 1000,
+		fingerprintBytes: int64(c.FingerprintSize),
 		startAtBeginning: startAtBeginning,
 		encoding:         encoding,
+		bomEncodings:     bomEncodings,
 		firstCheck:       true,
 		cancel:           func() {},
 		knownFiles:       make([]*Reader, 0, 10),
 		MaxLogSize:       c.MaxLogSize,
+		strictIncludes:   c.StrictIncludes,
+		watchMode:        c.WatchMode,
+		scanInterval:     c.ScanInterval.Raw(),
+		compression:      c.Compression,
+		deleteAfterRead:  c.DeleteAfterRead,
+		maxConcurrent:    c.MaxConcurrentFiles,
+		header:           header,
+		readAheadSize:    c.ReadAheadSize,
+		multiline:        c.Multiline != nil,
+		forceFlushPeriod: forceFlushPeriod,
+		jsonArray:        c.ReadMode == ReadModeJSONArray,
+		duplicates:       duplicates,
+		profiles:         outputProfiles,
+		backfill:         fileBackfill,
+		readPool:         readPool,
+		backupSemantics:  c.BackupSemantics,
+		locked:           newLockedFiles(c.PollInterval.Raw()),
+
+		nulPaddingThreshold: nulPaddingThreshold,
+
+		includeFilePathResolved: c.IncludeFilePathResolved,
+		includeFileMtime:        c.IncludeFileMtime,
+		includeFileOwner:        c.IncludeFileOwner,
+		includeFileOffset:       c.IncludeFileOffset,
 	}
 
 	return []operator.Operator{op}, nil
@@ -157,6 +363,11 @@ func lookupEncoding(enc string) (encoding.Encoding, error) {
 	return encoding, nil
 }
 
+// isUTF8 returns true if an encoding reads files as utf-8
+func isUTF8(enc encoding.Encoding) bool {
+	return enc == unicode.UTF8 || enc == encoding.Nop
+}
+
 // getSplitFunc will return the split function associated the configured mode.
 func (c InputConfig) getSplitFunc(encoding encoding.Encoding) (bufio.SplitFunc, error) {
 	if c.Multiline == nil {
@@ -0,0 +1,118 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultDuplicateFlushTimeout is the default time a run of duplicate lines is held
+	defaultDuplicateFlushTimeout = time.Second
+
+	// repeatCountLabel holds the number of times a line was repeated in a row
+	repeatCountLabel = "repeat_count"
+)
+
+// DuplicatesConfig is the configuration of the suppression of consecutive duplicate lines
+type DuplicatesConfig struct {
+	MaxRun       int             `json:"max_run,omitempty"       yaml:"max_run,omitempty"`
+	FlushTimeout helper.Duration `json:"flush_timeout,omitempty" yaml:"flush_timeout,omitempty"`
+}
+
+// duplicateSuppression holds the settings of the suppression of consecutive duplicate lines
+type duplicateSuppression struct {
+	maxRun       int
+	flushTimeout time.Duration
+}
+
+func (c *DuplicatesConfig) build() (*duplicateSuppression, error) {
+	if c.MaxRun < 0 {
+		return nil, fmt.Errorf("invalid max_run '%d', must not be negative", c.MaxRun)
+	}
+
+	flushTimeout := c.FlushTimeout.Raw()
+	if flushTimeout < 0 {
+		return nil, fmt.Errorf("invalid flush_timeout '%s'", flushTimeout)
+	}
+	if flushTimeout == 0 {
+		flushTimeout = defaultDuplicateFlushTimeout
+	}
+
+	return &duplicateSuppression{
+		maxRun:       c.MaxRun,
+		flushTimeout: flushTimeout,
+	}, nil
+}
+
+// suppressDuplicate holds a line while it repeats, and emits the line that
+// was held before it once the run of that line ends. Lines are compared by
+// their raw bytes before they are decoded, so a repeated line costs no more
+// than the comparison.
+func (f *Reader) suppressDuplicate(ctx context.Context, line []byte) error {
+	if f.runCount > 0 && bytes.Equal(f.runLine, line) {
+		f.runCount++
+		f.runLength = f.entryStart + f.entryLength - f.runStart
+		if max := f.fileInput.duplicates.maxRun; max > 0 && f.runCount >= max {
+			return f.flushRun(ctx)
+		}
+		return nil
+	}
+
+	err := f.flushRun(ctx)
+	if len(line) == 0 {
+		return err
+	}
+	f.runLine = append(f.runLine[:0], line...)
+	f.runCount = 1
+	f.runStart = f.entryStart
+	f.runLength = f.entryLength
+	f.runSince = time.Now()
+	return err
+}
+
+// checkRun emits the held line once it has been held for the flush timeout,
+// or when the file input is stopping
+func (f *Reader) checkRun(ctx context.Context) {
+	if f.runCount == 0 {
+		return
+	}
+	// A backfilled file is not expected to grow, so its run ends at the end of the file
+	if !f.fileInput.flushing && f.fileInput.backfill == nil && time.Since(f.runSince) < f.fileInput.duplicates.flushTimeout {
+		return
+	}
+	if err := f.flushRun(ctx); err != nil {
+		f.Errorw("Failed to emit entry", zap.Error(err))
+	}
+}
+
+// flushRun emits the held line, labeled with the number of times it was
+// repeated if it was repeated
+func (f *Reader) flushRun(ctx context.Context) error {
+	if f.runCount == 0 {
+		return nil
+	}
+	count := f.runCount
+	f.runCount = 0
+
+	msg, err := f.decode(f.runLine)
+	if err != nil {
+		return fmt.Errorf("decode: %s", err)
+	}
+	e, err := f.newEntry(msg)
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		e.AddLabel(repeatCountLabel, strconv.Itoa(count))
+	}
+	f.addOffsetLabels(e, f.runStart, f.runLength)
+	f.fileInput.backfill.countEntry()
+	f.fileInput.Write(ctx, e)
+	return nil
+}
@@ -0,0 +1,174 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// EncodingAuto detects the encoding of each file from its byte order mark
+const EncodingAuto = "auto"
+
+// maxBOMSize is the length of the longest byte order mark that is detected
+const maxBOMSize = 3
+
+// byteOrderMarks are the byte order marks detected with encoding auto, with
+// the encodings of the files that start with them. The byte order mark is
+// skipped when a file is read, so the encodings do not expect one.
+var byteOrderMarks = []struct {
+	name     string
+	bom      []byte
+	encoding encoding.Encoding
+}{
+	{"utf-8", []byte{0xef, 0xbb, 0xbf}, unicode.UTF8},
+	{"utf-16le", []byte{0xff, 0xfe}, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)},
+	{"utf-16be", []byte{0xfe, 0xff}, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)},
+}
+
+// fileEncoding is the encoding of a file, with the split function and size
+// limit that read entries from it
+type fileEncoding struct {
+	name      string
+	encoding  encoding.Encoding
+	bom       []byte
+	splitFunc bufio.SplitFunc
+	sizeLimit *sizeLimit
+
+	// unit is the size of the encoded newline, which NUL padding is aligned to
+	unit int
+}
+
+// buildEncoding creates the file encoding of an encoding, whose files start
+// with bom
+func (c InputConfig) buildEncoding(name string, enc encoding.Encoding, bom []byte) (*fileEncoding, error) {
+	splitFunc, err := c.getSplitFunc(enc)
+	if err != nil {
+		return nil, err
+	}
+	newline, err := encodedNewline(enc)
+	if err != nil {
+		return nil, err
+	}
+	return &fileEncoding{
+		name:      name,
+		encoding:  enc,
+		bom:       bom,
+		splitFunc: splitFunc,
+		sizeLimit: newSizeLimit(c.MaxLogSize, c.MaxLogSizeUnit, enc),
+		unit:      len(newline),
+	}, nil
+}
+
+// buildEncodings returns the encoding of the files, and with encoding auto,
+// the encodings detected from byte order marks. The encoding of the files is
+// then the default_encoding of the files without a byte order mark.
+func (c InputConfig) buildEncodings() (*fileEncoding, []*fileEncoding, error) {
+	name := c.Encoding
+	detect := strings.EqualFold(c.Encoding, EncodingAuto)
+	switch {
+	case detect && strings.EqualFold(c.DefaultEncoding, EncodingAuto):
+		return nil, nil, fmt.Errorf("default_encoding cannot be '%s'", EncodingAuto)
+	case detect:
+		name = c.DefaultEncoding
+	case c.DefaultEncoding != "":
+		return nil, nil, fmt.Errorf("default_encoding requires encoding '%s'", EncodingAuto)
+	}
+
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defaultEncoding, err := c.buildEncoding(name, enc, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !detect {
+		return defaultEncoding, nil, nil
+	}
+
+	bomEncodings := make([]*fileEncoding, 0, len(byteOrderMarks))
+	for _, mark := range byteOrderMarks {
+		bomEncoding, err := c.buildEncoding(mark.name, mark.encoding, mark.bom)
+		if err != nil {
+			return nil, nil, err
+		}
+		bomEncodings = append(bomEncodings, bomEncoding)
+	}
+	return defaultEncoding, bomEncodings, nil
+}
+
+// encodingOf returns the encoding of a file that starts with head, and false
+// if head is too short to tell whether the file starts with a byte order mark
+func (f *InputOperator) encodingOf(head []byte) (*fileEncoding, bool) {
+	for _, enc := range f.bomEncodings {
+		if bytes.HasPrefix(head, enc.bom) {
+			return enc, true
+		}
+	}
+	for _, enc := range f.bomEncodings {
+		if bytes.HasPrefix(enc.bom, head) {
+			return f.encoding, false
+		}
+	}
+	return f.encoding, true
+}
+
+// detectEncoding sets the encoding of the file from the byte order mark at its
+// start, which is read from the fingerprint, or from the file if the
+// fingerprint is too short to hold one. The encoding of a file that is too
+// short to tell is detected again on the next read. Compressed files are
+// read with the default encoding.
+func (f *Reader) detectEncoding() error {
+	if f.encodingDetected || f.fileInput.bomEncodings == nil || f.compressed {
+		return nil
+	}
+
+	head := f.Fingerprint.FirstBytes
+	if len(head) < maxBOMSize {
+		head = make([]byte, maxBOMSize)
+		n, err := f.file.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("read byte order mark: %s", err)
+		}
+		head = head[:n]
+	}
+
+	enc, ok := f.fileInput.encodingOf(head)
+	if enc != f.encoding && enc.bom != nil {
+		f.Debugw("Detected encoding", "encoding", enc.name)
+	}
+	f.setEncoding(enc)
+	f.encodingDetected = ok
+	return nil
+}
+
+// setEncoding sets the encoding that the file is read with
+func (f *Reader) setEncoding(enc *fileEncoding) {
+	if f.encoding != enc {
+		f.encoding = enc
+		f.decoder = enc.encoding.NewDecoder()
+	}
+}
+
+// skipBOM moves the offset of a file that is read from the start past its
+// byte order mark, so that it is not part of the first entry. The header of
+// the file starts after the byte order mark as well.
+func (f *Reader) skipBOM() {
+	bom := int64(len(f.encoding.bom))
+	if bom == 0 {
+		return
+	}
+	if f.HeaderEnd == 0 && !f.HeaderRead {
+		f.HeaderEnd = bom
+	}
+	if f.Offset == 0 {
+		f.checkpoint = nextCheckpoint(f.checkpoint, f.encoding.bom)
+		f.fileInput.OperatorStats().AddBytes(uint64(bom))
+		f.Offset = bom
+	}
+}
@@ -0,0 +1,180 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var utf16LE = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+
+func encodeUTF16LE(t *testing.T, s string) string {
+	encoded, err := utf16LE.NewEncoder().String(s)
+	require.NoError(t, err)
+	return encoded
+}
+
+func TestEncodingAuto(t *testing.T) {
+	t.Parallel()
+	utf16BE, err := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().String("testlog1\ntestlog2\n")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		contents string
+	}{
+		{"UTF8BOM", "\xef\xbb\xbftestlog1\ntestlog2\n"},
+		{"UTF16LEBOM", "\xff\xfe" + encodeUTF16LE(t, "testlog1\ntestlog2\n")},
+		{"UTF16BEBOM", "\xfe\xff" + utf16BE},
+		{"Default", "testlog1\ntestlog2\n"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+				cfg.Encoding = EncodingAuto
+				cfg.StartAt = "beginning"
+			}, nil)
+
+			temp := openTemp(t, tempDir)
+			writeString(t, temp, tc.contents)
+
+			operator.poll(context.Background())
+			waitForMessages(t, logReceived, []string{"testlog1", "testlog2"})
+			require.Equal(t, int64(len(tc.contents)), lastReader(operator).Offset)
+		})
+	}
+}
+
+// DefaultEncoding tests that a file without a byte order mark is read with
+// the default encoding
+func TestEncodingAutoDefaultEncoding(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Encoding = EncodingAuto
+		cfg.DefaultEncoding = "windows-1252"
+		cfg.StartAt = "beginning"
+	}, nil)
+
+	utf16File := openTemp(t, tempDir)
+	writeString(t, utf16File, "\xff\xfe"+encodeUTF16LE(t, "100€\n"))
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "100€")
+
+	windowsFile := openTemp(t, tempDir)
+	writeString(t, windowsFile, "200\x80\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "200€")
+	expectNoMessages(t, logReceived)
+}
+
+// SplitReads tests that a utf-16le file whose characters are split across
+// the reads of the file is read in whole characters. The file has surrogate
+// pairs, characters that hold the bytes of a newline across their boundary,
+// and a line longer than the buffer of the scanner.
+func TestEncodingAutoSplitReads(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Encoding = EncodingAuto
+		cfg.StartAt = "beginning"
+	}, nil)
+
+	long := strings.Repeat("ab😀ੁ一", 2000)
+	lines := []string{"😀 first", "ੁ一 second", long}
+	contents := "\xff\xfe" + encodeUTF16LE(t, strings.Join(lines, "\n")+"\n")
+
+	// The file is written in pieces that end in the middle of a character
+	temp := openTemp(t, tempDir)
+	for _, end := range []int{1, 3, 7, 21, 12345, len(contents)} {
+		info, err := temp.Stat()
+		require.NoError(t, err)
+		writeString(t, temp, contents[info.Size():end])
+		operator.poll(context.Background())
+	}
+	waitForMessages(t, logReceived, lines)
+	expectNoMessages(t, logReceived)
+
+	// The offset is in the bytes of the file, so reading resumes after a restart
+	require.Equal(t, int64(len(contents)), lastReader(operator).Offset)
+}
+
+// SplitScannerReads tests that the scanner splits a utf-16le file into lines
+// when every read of the file returns a single byte
+func TestEncodingSplitScannerReads(t *testing.T) {
+	enc, err := NewInputConfig("").buildEncoding("utf-16le", utf16LE, nil)
+	require.NoError(t, err)
+
+	lines := []string{"😀ੁ一", "一😀"}
+	contents := encodeUTF16LE(t, strings.Join(lines, "\n")+"\n")
+	reader := iotest.OneByteReader(bytes.NewReader([]byte(contents)))
+	scanner := newLimitedPositionalScanner(reader, enc.sizeLimit, 0, enc.splitFunc)
+
+	var decoded []string
+	for scanner.Scan() {
+		line, err := utf16LE.NewDecoder().Bytes(scanner.Bytes())
+		require.NoError(t, err)
+		decoded = append(decoded, string(line))
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, lines, decoded)
+	require.Equal(t, int64(len(contents)), scanner.Pos())
+}
+
+// Truncated tests that the encoding of a file is detected again when it is
+// truncated and written with another encoding
+func TestEncodingAutoTruncated(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Encoding = EncodingAuto
+		cfg.StartAt = "beginning"
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "\xff\xfe"+encodeUTF16LE(t, "testlog1\n"))
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog1")
+
+	require.NoError(t, temp.Truncate(0))
+	_, err := temp.Seek(0, 0)
+	require.NoError(t, err)
+	writeString(t, temp, "log2\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "log2")
+	expectNoMessages(t, logReceived)
+}
+
+func TestEncodingOf(t *testing.T) {
+	operator, _, _ := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Encoding = EncodingAuto
+	}, nil)
+
+	cases := []struct {
+		name     string
+		head     string
+		encoding string
+		ok       bool
+	}{
+		{"Empty", "", "", false},
+		{"PartialUTF8BOM", "\xef\xbb", "", false},
+		{"UTF8BOM", "\xef\xbb\xbf", "utf-8", true},
+		{"UTF16LEBOM", "\xff\xfe", "utf-16le", true},
+		{"UTF16BEBOM", "\xfe\xffa", "utf-16be", true},
+		{"NoBOM", "abc", "", true},
+		{"ShortNoBOM", "a", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, ok := operator.encodingOf([]byte(tc.head))
+			require.Equal(t, tc.encoding, enc.name)
+			require.Equal(t, tc.ok, ok)
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// +build linux
+
+package file
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// adviseSequential advises the kernel that a file will be read sequentially,
+// so that it reads further ahead of each read
+func adviseSequential(file *os.File) error {
+	return unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+// adviseDontNeed advises the kernel that a part of a file will not be read
+// again, so that its pages are dropped from the page cache
+func adviseDontNeed(file *os.File, offset, length int64) error {
+	return unix.Fadvise(int(file.Fd()), offset, length, unix.FADV_DONTNEED)
+}
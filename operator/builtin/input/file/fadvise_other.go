@@ -0,0 +1,15 @@
+// +build !linux
+
+package file
+
+import "os"
+
+// adviseSequential does nothing on platforms without posix_fadvise
+func adviseSequential(file *os.File) error {
+	return nil
+}
+
+// adviseDontNeed does nothing on platforms without posix_fadvise
+func adviseDontNeed(file *os.File, offset, length int64) error {
+	return nil
+}
@@ -1,20 +1,19 @@
 package file
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/operator/helper"
 	"go.uber.org/zap"
-	"golang.org/x/text/encoding"
 )
 
 // InputOperator is an operator that monitors files for entries
@@ -26,22 +25,99 @@ type InputOperator struct {
 	FilePathField entry.Field
 	FileNameField entry.Field
 	PollInterval  time.Duration
-	SplitFunc     bufio.SplitFunc
 	MaxLogSize    int
 
 	persist helper.Persister
 
 	knownFiles       []*Reader
 	startAtBeginning bool
+	strictIncludes   bool
+	watchMode        string
+	scanInterval     time.Duration
+	compression      string
+	deleteAfterRead  bool
+	maxConcurrent    int
+	header           *headerParser
+
+	// deletion tracks the files deleted after they are read, which wait for
+	// the outputs on a goroutine of their own rather than blocking polls
+	deletion fileDeletion
+
+	// readAheadSize is the size of the reads of files with a large unread
+	// part, whose buffers are reused from readAheadPool
+	readAheadSize int
+	readAheadPool sync.Pool
+
+	// multiline is set when entries are split on a pattern, in which case the
+	// last entry of a file is held until the next one starts. It is flushed
+	// once it has not grown for the force flush period, or when stopping.
+	multiline        bool
+	forceFlushPeriod time.Duration
+	flushing         bool
+
+	// jsonArray is set when each file holds a JSON array, whose elements
+	// are read as entries
+	jsonArray bool
+
+	// duplicates is set when consecutive duplicate lines are suppressed
+	duplicates *duplicateSuppression
+
+	// profiles is set when entries are written to the outputs of named
+	// profiles, each of which keeps its own offsets of the files
+	profiles *profiles
+
+	// backfill is set when the files that match when the operator starts
+	// are read to the end once, after which polling stops
+	backfill *backfill
+
+	// readPool runs the reads of files at a lowered priority, when the
+	// operator has one
+	readPool *operator.PriorityPool
+
+	includeFilePathResolved bool
+	includeFileMtime        bool
+	includeFileOwner        bool
+	includeFileOffset       bool
 
 	fingerprintBytes int64
 
-	encoding encoding.Encoding
+	// aliasedFiles holds the pairs of files that had matching fingerprints in
+	// the last poll, so that each pair is only warned about once
+	aliasedFiles map[string]bool
+
+	// encoding is the encoding of the files. With encoding auto, it is the
+	// encoding of the files without a byte order mark, and bomEncodings are
+	// the encodings detected from byte order marks.
+	encoding     *fileEncoding
+	bomEncodings []*fileEncoding
 
 	wg         sync.WaitGroup
 	readerWg   sync.WaitGroup
 	firstCheck bool
 	cancel     context.CancelFunc
+
+	// startedAt is when the operator started. With start_at end, a file
+	// last modified before then is read from the end, even if it is not
+	// matched until a later poll.
+	startedAt time.Time
+
+	globErrors     uint64
+	filesRewritten uint64
+
+	// unreadBytes is the number of bytes of the files of the current poll
+	// that have not been read yet
+	unreadBytes int64
+
+	recovery *helper.RecoveryReport
+
+	// backupSemantics opens files with the Windows backup semantics flags,
+	// and locked holds the files that another process has locked
+	backupSemantics bool
+	locked          *lockedFiles
+
+	// nulPaddingThreshold is the length of the shortest run of NUL bytes that
+	// is skipped as padding, or zero if padding is read as usual
+	nulPaddingThreshold int
 }
 
 // Start will start the file monitoring process
@@ -49,12 +125,27 @@ func (f *InputOperator) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	f.cancel = cancel
 	f.firstCheck = true
+	f.startedAt = time.Now()
+
+	if f.header != nil {
+		if err := f.header.Start(); err != nil {
+			return fmt.Errorf("start header operators: %s", err)
+		}
+	}
 
 	// Load offsets from disk
 	if err := f.loadLastPollFiles(); err != nil {
 		return fmt.Errorf("read known files from database: %s", err)
 	}
 
+	if f.profiles != nil {
+		f.profiles.start(f.OperatorStats())
+	}
+
+	if f.readPool != nil {
+		f.readPool.Start()
+	}
+
 	// Start polling goroutine
 	f.startPoller(ctx)
 
@@ -65,85 +156,356 @@ func (f *InputOperator) Start() error {
 func (f *InputOperator) Stop() error {
 	f.cancel()
 	f.wg.Wait()
+	if f.profiles != nil {
+		f.profiles.stopQueuing()
+	}
+	if f.multiline || f.duplicates != nil {
+		f.flushPending()
+	}
+	if f.profiles != nil {
+		// The offsets of the profiles are saved once their queues are drained
+		f.profiles.drain()
+		f.syncLastPollFiles()
+	}
+	if f.header != nil {
+		f.header.Stop()
+	}
+	if f.readPool != nil {
+		f.readPool.Stop()
+	}
 	f.knownFiles = nil
 	f.cancel = nil
 	return nil
 }
 
 // startPoller kicks off a goroutine that will poll the filesystem periodically,
-// checking if there are new files or new logs in the watched files
+// checking if there are new files or new logs in the watched files. When files
+// are followed with notifications, files are read as they are written or
+// created, and the filesystem is polled at the slower scan interval instead,
+// to find the changes that were not notified.
 func (f *InputOperator) startPoller(ctx context.Context) {
+	var watcher *dirWatcher
+	if f.useNotify() {
+		var err error
+		watcher, err = newDirWatcher(f.Include)
+		if err != nil {
+			f.Warnw("Failed to watch directories. Falling back to polling", zap.Error(err))
+		}
+	}
+
+	interval := f.PollInterval
+	if watcher != nil {
+		interval = f.scanInterval
+		// The last entry of a file is only flushed when the file is read,
+		// so files are read at least as often as the force flush period
+		if f.multiline && f.forceFlushPeriod > 0 && f.forceFlushPeriod < interval {
+			interval = f.forceFlushPeriod
+		}
+	}
+
 	f.wg.Add(1)
 	go func() {
 		defer f.wg.Done()
-		globTicker := time.NewTicker(f.PollInterval)
+		globTicker := time.NewTicker(interval)
 		defer globTicker.Stop()
 
+		var events chan fsnotify.Event
+		var errs chan error
+		if watcher != nil {
+			defer watcher.Close()
+			events, errs = watcher.Events, watcher.Errors
+
+			// Scans are slow, so the files are polled once right away, and
+			// written files are then read as their events arrive
+			f.poll(ctx)
+		}
+
+		// The backfill completes once its entries are sent, which is waited
+		// for between polls
+		var backfillDone chan struct{}
+		if f.backfill != nil {
+			backfillDone = f.backfill.done
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-backfillDone:
+				return
 			case <-globTicker.C:
+				// A tick can be ready at the same time as the cancellation,
+				// such as after a poll that waited on the database. Polling
+				// then would age out the known files without reading them.
+				if ctx.Err() != nil {
+					return
+				}
+				f.poll(ctx)
+			case event := <-events:
+				f.handleEvents(ctx, watcher, event)
+			case err := <-errs:
+				if err == fsnotify.ErrEventOverflow {
+					// Events were lost, so the files are polled to catch up
+					f.Warnw("Too many file events to follow. Polling to catch up")
+					f.poll(ctx)
+					continue
+				}
+				f.Warnw("Directory watch returned an error", zap.Error(err))
 			}
-
-			f.poll(ctx)
 		}
 	}()
 }
 
 // poll checks all the watched paths for new entries
 func (f *InputOperator) poll(ctx context.Context) {
+	atomic.StoreInt64(&f.unreadBytes, 0)
 
 	// Get the list of paths on disk
-	matches := getMatches(f.Include, f.Exclude)
+	matches := f.getMatches(f.Include, f.Exclude)
 	if f.firstCheck && len(matches) == 0 {
 		f.Warnw("no files match the configured include patterns", "include", f.Include)
 	}
 
+	f.forgetDeleted()
+	readers := f.readPaths(ctx, matches, f.firstCheck)
+	f.firstCheck = false
+
+	f.saveCurrent(readers)
+	if f.deleteAfterRead {
+		f.deleteFinished(ctx, readers)
+	}
+	f.syncLastPollFiles()
+
+	if f.backfill != nil {
+		f.updateBackfill(ctx, matches, readers)
+	}
+}
+
+// fileDeletion is the state of the deletion of files that are finished being
+// read. At most one deletion runs at a time.
+type fileDeletion struct {
+	mux     sync.Mutex
+	running bool
+	deleted []string
+}
+
+// deleteFinished deletes the files that are finished being read, once the
+// entries read from them have been sent by the outputs downstream. The wait
+// runs on its own goroutine, so that polls continue while the outputs are
+// slow, and files that finish while it runs are deleted after a later poll.
+func (f *InputOperator) deleteFinished(ctx context.Context, readers []*Reader) {
+	finished := make([]string, 0)
+	for _, reader := range readers {
+		if reader.finished {
+			finished = append(finished, reader.Path)
+		}
+	}
+	if len(finished) == 0 {
+		return
+	}
+
+	f.deletion.mux.Lock()
+	defer f.deletion.mux.Unlock()
+	if f.deletion.running {
+		return
+	}
+	f.deletion.running = true
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		deleted := make([]string, 0, len(finished))
+		defer func() {
+			f.deletion.mux.Lock()
+			f.deletion.running = false
+			f.deletion.deleted = append(f.deletion.deleted, deleted...)
+			f.deletion.mux.Unlock()
+		}()
+
+		if err := helper.WaitFlushed(ctx, f.OutputOperators); err != nil {
+			// The files are finished on the next poll as well, so they are deleted then
+			f.Debugw("Stopped waiting for entries to be sent before deleting files", zap.Error(err))
+			return
+		}
+
+		for _, path := range finished {
+			if err := os.Remove(path); err != nil {
+				f.Errorw("Failed to delete file", "path", path, zap.Error(err))
+				continue
+			}
+			f.Debugw("Deleted file after reading", "path", path)
+			deleted = append(deleted, path)
+		}
+	}()
+}
+
+// forgetDeleted forgets the offsets of the files deleted since the last poll,
+// so that a new file with the same first bytes is read in full
+func (f *InputOperator) forgetDeleted() {
+	f.deletion.mux.Lock()
+	deleted := f.deletion.deleted
+	f.deletion.deleted = nil
+	f.deletion.mux.Unlock()
+
+	for _, path := range deleted {
+		for i := 0; i < len(f.knownFiles); {
+			if f.knownFiles[i].Path == path {
+				f.knownFiles = append(f.knownFiles[:i], f.knownFiles[i+1:]...)
+				continue
+			}
+			i++
+		}
+	}
+}
+
+// flushPending reads the watched files one last time, flushing the trailing
+// entry of each file rather than holding it for an entry that may never start,
+// and the line held while it repeats
+func (f *InputOperator) flushPending() {
+	f.flushing = true
+	defer func() { f.flushing = false }()
+
+	matches := f.getMatches(f.Include, f.Exclude)
+	readers := f.readPaths(context.Background(), matches, f.firstCheck)
+	f.saveCurrent(readers)
+	f.syncLastPollFiles()
+}
+
+// readPaths reads each of the paths to the end, returning a reader for each
+// file that was read. No more than the max concurrent files are open at once,
+// so the paths are read in batches of that size.
+func (f *InputOperator) readPaths(ctx context.Context, paths []string, firstCheck bool) []*Reader {
+	readers := make([]*Reader, 0, len(paths))
+	aliasedFiles := make(map[string]bool)
+	f.locked.retain(paths)
+	defer func() { f.aliasedFiles = aliasedFiles }()
+
+	for len(paths) > 0 {
+		select {
+		case <-ctx.Done():
+			return readers
+		default:
+		}
+
+		batch := paths
+		if len(batch) > f.maxConcurrent {
+			batch = batch[:f.maxConcurrent]
+		}
+		paths = paths[len(batch):]
+		readers = append(readers, f.readBatch(ctx, batch, readers, aliasedFiles, firstCheck)...)
+	}
+	return readers
+}
+
+// readBatch opens and reads each of the paths to the end. Files that match
+// the fingerprint of a file read earlier in the same poll are not read.
+func (f *InputOperator) readBatch(ctx context.Context, paths []string, read []*Reader, aliasedFiles map[string]bool, firstCheck bool) []*Reader {
 	// Open the files first to minimize the time between listing and opening
-	files := make([]*os.File, 0, len(matches))
-	for _, path := range matches {
-		file, err := os.Open(path)
+	files := make([]*os.File, 0, len(paths))
+	for _, path := range paths {
+		if f.locked.skip(path) {
+			continue
+		}
+		file, err := openLogFile(path, f.backupSemantics)
 		if err != nil {
+			if isLockedError(err) {
+				if f.locked.lock(path) {
+					f.Warnw("File is locked by another process, retrying with increasing intervals", "path", path)
+				}
+				continue
+			}
 			f.Errorw("Failed to open file", zap.Error(err))
 			continue
 		}
+		if f.locked.unlock(path) {
+			f.Infow("File is no longer locked by another process", "path", path)
+		}
 		files = append(files, file)
 	}
 
-	readers := f.makeReaders(files)
-	f.firstCheck = false
+	readers := f.makeReaders(files, read, aliasedFiles, firstCheck)
 
+	// The bytes of the files past their offsets are pending until they are read
+	sizes := make([]int64, len(readers))
+	for i, reader := range readers {
+		if info, err := reader.file.Stat(); err == nil && !reader.compressed {
+			sizes[i] = info.Size()
+		}
+	}
+	unread := unreadBytes(readers, sizes)
+	atomic.AddInt64(&f.unreadBytes, unread)
+
+	// Each file is read in its own goroutine, once the throttle of the
+	// operator has budget for another concurrent read
 	var wg sync.WaitGroup
 	for _, reader := range readers {
+		release, ok := f.Throttle.AcquireRead(ctx)
+		if !ok {
+			break
+		}
 		wg.Add(1)
 		go func(r *Reader) {
 			defer wg.Done()
-			r.ReadToEnd(ctx)
+			defer release()
+			if f.readPool != nil {
+				f.readPool.Run(func() { r.ReadToEnd(ctx) })
+			} else {
+				r.ReadToEnd(ctx)
+			}
+			if f.deleteAfterRead || f.backfill != nil {
+				r.checkFinished()
+			}
 		}(reader)
 	}
 
 	// Wait until all the reader goroutines are finished
 	wg.Wait()
+	atomic.AddInt64(&f.unreadBytes, unreadBytes(readers, sizes)-unread)
 
 	// Close all files
 	for _, file := range files {
 		file.Close()
 	}
 
-	f.saveCurrent(readers)
-	f.syncLastPollFiles()
+	return readers
+}
+
+// unreadBytes returns the number of bytes of the files of readers past their
+// offsets, given the sizes of the files
+func unreadBytes(readers []*Reader, sizes []int64) int64 {
+	var unread int64
+	for i, reader := range readers {
+		if reader.padded {
+			// Padding at the end of a file is not read
+			continue
+		}
+		if lag := sizes[i] - reader.Offset; lag > 0 {
+			unread += lag
+		}
+	}
+	return unread
 }
 
 // getMatches gets a list of paths given an array of glob patterns to include and exclude
-func getMatches(includes, excludes []string) []string {
+func (f *InputOperator) getMatches(includes, excludes []string) []string {
 	all := make([]string, 0, len(includes))
 	for _, include := range includes {
-		matches, _ := filepath.Glob(include) // compile error checked in build
+		matches, err := filepath.Glob(include)
+		if err != nil {
+			atomic.AddUint64(&f.globErrors, 1)
+			f.Warnw("Failed to match include pattern", "pattern", include, zap.Error(err))
+			continue
+		}
 	INCLUDE:
 		for _, match := range matches {
 			for _, exclude := range excludes {
-				if itMatches, _ := filepath.Match(exclude, match); itMatches {
+				itMatches, err := filepath.Match(exclude, match)
+				if err != nil {
+					atomic.AddUint64(&f.globErrors, 1)
+					f.Warnw("Failed to match exclude pattern", "pattern", exclude, zap.Error(err))
+					continue
+				}
+				if itMatches {
 					break INCLUDE
 				}
 			}
@@ -161,11 +523,18 @@ func getMatches(includes, excludes []string) []string {
 	return all
 }
 
-func (f *InputOperator) makeReaders(files []*os.File) []*Reader {
+// GlobErrors returns the number of pattern match errors encountered while polling
+func (f *InputOperator) GlobErrors() uint64 {
+	return atomic.LoadUint64(&f.globErrors)
+}
+
+// makeReaders creates a reader for each file, excluding empty files and files
+// that match the fingerprint of another file or of a file already read
+func (f *InputOperator) makeReaders(files []*os.File, read []*Reader, aliasedFiles map[string]bool, firstCheck bool) []*Reader {
 	// Get fingerprints for each file
 	fps := make([]*Fingerprint, 0, len(files))
 	for _, file := range files {
-		fp, err := NewFingerprint(file)
+		fp, err := f.newFingerprint(file)
 		if err != nil {
 			f.Errorw("Failed creating fingerprint", zap.Error(err))
 			continue
@@ -188,6 +557,15 @@ OUTER:
 
 		}
 
+		for _, reader := range read {
+			if fp.Matches(reader.Fingerprint) || reader.Fingerprint.Matches(fp) {
+				f.warnAliased(aliasedFiles, filesCopy[i].Name(), reader.Path)
+				fps = append(fps[:i], fps[i+1:]...)
+				filesCopy = append(filesCopy[:i], filesCopy[i+1:]...)
+				continue OUTER
+			}
+		}
+
 		for j := 0; j < len(fps); j++ {
 			if i == j {
 				// Skip checking itself
@@ -196,6 +574,7 @@ OUTER:
 
 			fp2 := fps[j]
 			if fp.Matches(fp2) || fp2.Matches(fp) {
+				f.warnAliased(aliasedFiles, filesCopy[i].Name(), filesCopy[j].Name())
 				// Exclude
 				fps = append(fps[:i], fps[i+1:]...)
 				filesCopy = append(filesCopy[:i], filesCopy[i+1:]...)
@@ -207,7 +586,7 @@ OUTER:
 
 	readers := make([]*Reader, 0, len(fps))
 	for i := 0; i < len(fps); i++ {
-		reader, err := f.newReader(filesCopy[i], fps[i], f.firstCheck)
+		reader, err := f.newReader(filesCopy[i], fps[i], firstCheck)
 		if err != nil {
 			f.Errorw("Failed to create reader", zap.Error(err))
 			continue
@@ -218,17 +597,38 @@ OUTER:
 	return readers
 }
 
+// warnAliased warns that two files have matching fingerprints, so only one of
+// them is read. This is expected for a moment while a file is rotated by
+// copying it, but files that share a long common prefix are never told apart.
+func (f *InputOperator) warnAliased(aliasedFiles map[string]bool, path, otherPath string) {
+	if otherPath < path {
+		path, otherPath = otherPath, path
+	}
+	key := path + "\x00" + otherPath
+	if !f.aliasedFiles[key] && !aliasedFiles[key] {
+		f.Warnw("Files have matching fingerprints, so only one of them will be read. Increase fingerprint_size if they are distinct files that start with the same content",
+			"path", path,
+			"other_path", otherPath,
+			"fingerprint_size", f.fingerprintBytes,
+		)
+	}
+	aliasedFiles[key] = true
+}
+
 func (f *InputOperator) saveCurrent(readers []*Reader) {
 	// Rotate current into old
 	for _, reader := range readers {
 		f.knownFiles = append(f.knownFiles, reader)
 	}
 
-	// Clear out old readers
+	// Clear out old readers. A file that is still matched gets a new reader on
+	// each poll, so old readers are only kept long enough to recognize files
+	// that are renamed or rotated out of the include patterns
 	for i := 0; i < len(f.knownFiles); {
 		reader := f.knownFiles[i]
 		if reader.generation >= 3 {
 			f.knownFiles = append(f.knownFiles[:i], f.knownFiles[i+1:]...)
+			continue
 		}
 		reader.generation++
 		i++
@@ -236,13 +636,22 @@ func (f *InputOperator) saveCurrent(readers []*Reader) {
 }
 
 func (f *InputOperator) newReader(file *os.File, fp *Fingerprint, firstCheck bool) (*Reader, error) {
-	// Check if the new path has the same fingerprint as an old path
+	compressed, err := f.isCompressed(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the new path has the same fingerprint as an old path. A
+	// compressed file matches the file it was compressed from, so it is read
+	// from the offset where that file was left.
 	if oldReader, ok := f.findFingerprintMatch(fp); ok {
 		newReader, err := oldReader.Copy(file)
 		if err != nil {
 			return nil, err
 		}
 		newReader.Path = file.Name()
+		newReader.compressed = compressed
+		newReader.Complete = newReader.Complete && compressed
 		return newReader, nil
 	}
 
@@ -251,13 +660,34 @@ func (f *InputOperator) newReader(file *os.File, fp *Fingerprint, firstCheck boo
 	if err != nil {
 		return nil, err
 	}
-	startAtBeginning := !firstCheck || f.startAtBeginning
+	newReader.compressed = compressed
+	startAtBeginning := f.startAtBeginning || (!firstCheck && !f.modifiedBeforeStart(file))
 	if err := newReader.InitializeOffset(startAtBeginning); err != nil {
 		return nil, fmt.Errorf("initialize offset: %s", err)
 	}
+	newReader.watermarks = f.profiles.newWatermarks(newReader.Offset)
 	return newReader, nil
 }
 
+// modifiedBeforeStart returns true if a file was last modified before the
+// operator started, in which case it existed before then even if it was not
+// matched, such as when its directory is mounted after the first poll. The
+// start is truncated to the second, since some file systems store modification
+// times in seconds, so that a file created just after the start is not taken
+// for an old one.
+func (f *InputOperator) modifiedBeforeStart(file *os.File) bool {
+	if f.startedAt.IsZero() {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		f.Debugw("Failed to stat new file. Reading it from the beginning", "path", file.Name(), zap.Error(err))
+		return false
+	}
+	return info.ModTime().Before(f.startedAt.Truncate(time.Second))
+}
+
 func (f *InputOperator) findFingerprintMatch(fp *Fingerprint) (*Reader, bool) {
 	// Iterate backwards to match newest first
 	for i := len(f.knownFiles) - 1; i >= 0; i-- {
@@ -269,65 +699,153 @@ func (f *InputOperator) findFingerprintMatch(fp *Fingerprint) (*Reader, bool) {
 	return nil, false
 }
 
-const knownFilesKey = "knownFiles"
-
 // syncLastPollFiles syncs the most recent set of files to the database
 func (f *InputOperator) syncLastPollFiles() {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	knownFiles := make([]*KnownFile, 0, len(f.knownFiles))
+	for _, fileReader := range f.knownFiles {
+		knownFile := fileReader.KnownFile
 
-	// Encode the number of known files
-	if err := enc.Encode(len(f.knownFiles)); err != nil {
-		f.Errorw("Failed to encode known files", zap.Error(err))
-		return
-	}
+		// A line held while it repeats has not been emitted, so the file is
+		// read again from the start of the held run after a restart
+		if fileReader.runCount > 0 && fileReader.runStart < knownFile.Offset {
+			knownFile.Offset = fileReader.runStart
+		}
+		if fileReader.watermarks == nil {
+			knownFiles = append(knownFiles, &knownFile)
+			continue
+		}
 
-	// Encode each known file
-	for _, fileReader := range f.knownFiles {
-		if err := enc.Encode(fileReader); err != nil {
-			f.Errorw("Failed to encode known files", zap.Error(err))
+		// A file is read again from the lowest offset of the profiles, and
+		// each profile skips the entries it has already written
+		offsets, min := fileReader.watermarks.snapshot()
+		knownFile.ProfileOffsets = offsets
+		if min >= 0 && min < knownFile.Offset {
+			knownFile.Offset = min
 		}
+		knownFiles = append(knownFiles, &knownFile)
+	}
+
+	encoded, err := EncodeKnownFiles(knownFiles)
+	if err != nil {
+		f.Errorw("Failed to encode known files", zap.Error(err))
+		return
 	}
 
-	f.persist.Set(knownFilesKey, buf.Bytes())
+	f.persist.Set(KnownFilesKey, encoded)
 	if err := f.persist.Sync(); err != nil {
 		f.Errorw("Failed to sync to database", zap.Error(err))
 	}
 }
 
-// syncLastPollFiles loads the most recent set of files to the database
+// loadLastPollFiles loads the most recent set of files from the database, and
+// summarizes them in the recovery report
 func (f *InputOperator) loadLastPollFiles() error {
 	err := f.persist.Load()
 	if err != nil {
 		return err
 	}
 
-	encoded := f.persist.Get(knownFilesKey)
+	f.recovery = &helper.RecoveryReport{}
+	encoded := f.persist.Get(KnownFilesKey)
 	if encoded == nil {
 		f.knownFiles = make([]*Reader, 0, 10)
 		return nil
 	}
 
-	dec := json.NewDecoder(bytes.NewReader(encoded))
-
-	// Decode the number of entries
-	var knownFileCount int
-	if err := dec.Decode(&knownFileCount); err != nil {
-		return fmt.Errorf("decoding file count: %w", err)
+	knownFiles, err := f.decodeKnownFiles(encoded)
+	if err != nil {
+		return err
 	}
+	f.knownFiles = knownFiles
+
+	// Known files hold several generations of readers, so only the newest
+	// reader of each path is counted
+	seen := make(map[string]struct{}, len(f.knownFiles))
+	for i := len(f.knownFiles) - 1; i >= 0; i-- {
+		reader := f.knownFiles[i]
+		if _, ok := seen[reader.Path]; ok {
+			continue
+		}
+		seen[reader.Path] = struct{}{}
+		f.recovery.KnownFiles++
 
-	// Decode each of the known files
-	f.knownFiles = make([]*Reader, 0, knownFileCount)
-	for i := 0; i < knownFileCount; i++ {
-		newReader, err := NewReader("", f, nil, nil)
+		info, err := os.Stat(reader.Path)
 		if err != nil {
-			return err
+			continue
 		}
-		if err = dec.Decode(newReader); err != nil {
-			return err
+		if lag := info.Size() - reader.Offset; lag > 0 {
+			f.recovery.UnreadBytes += lag
 		}
-		f.knownFiles = append(f.knownFiles, newReader)
 	}
 
+	f.Debugw("Loaded known files", "known_files", f.recovery.KnownFiles, "unread_bytes", f.recovery.UnreadBytes)
 	return nil
 }
+
+// decodeKnownFiles decodes a set of known files saved by syncLastPollFiles
+func (f *InputOperator) decodeKnownFiles(encoded []byte) ([]*Reader, error) {
+	files, err := DecodeKnownFiles(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	knownFiles := make([]*Reader, 0, len(files))
+	for _, file := range files {
+		newReader, err := NewReader(file.Path, f, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		newReader.KnownFile = *file
+		newReader.watermarks = f.profiles.loadWatermarks(file.ProfileOffsets, file.Offset)
+		newReader.ProfileOffsets = nil
+		knownFiles = append(knownFiles, newReader)
+	}
+
+	return knownFiles, nil
+}
+
+// SetOutputs sets the outputs of the operator, and of each of its profiles
+func (f *InputOperator) SetOutputs(operators []operator.Operator) error {
+	if err := f.InputOperator.SetOutputs(operators); err != nil {
+		return err
+	}
+	if f.profiles != nil {
+		return f.profiles.setOutputs(f.OutputOperators)
+	}
+	return nil
+}
+
+// Counters returns the number of files that were read again from the
+// beginning because they were rewritten while being read
+func (f *InputOperator) Counters() map[string]uint64 {
+	return map[string]uint64{
+		"files_rewritten": atomic.LoadUint64(&f.filesRewritten),
+	}
+}
+
+// Status reports the files that are skipped because another process has
+// locked them, and the progress of a backfill
+func (f *InputOperator) Status() map[string]interface{} {
+	status := make(map[string]interface{})
+	if locked := f.locked.status(); locked != nil {
+		status["locked_files"] = locked
+	}
+	if f.backfill != nil {
+		status["backfill"] = f.backfill.status()
+	}
+	if len(status) == 0 {
+		return nil
+	}
+	return status
+}
+
+// PendingWork returns the number of bytes of the files being read that have
+// not been read yet
+func (f *InputOperator) PendingWork() int64 {
+	return atomic.LoadInt64(&f.unreadBytes)
+}
+
+// RecoveryReport returns a summary of the known files restored at startup
+func (f *InputOperator) RecoveryReport() *helper.RecoveryReport {
+	return f.recovery
+}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -21,6 +22,9 @@ import (
 	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/text/encoding/unicode"
 )
 
 func newDefaultConfig(tempDir string) *InputConfig {
@@ -140,7 +144,15 @@ func TestBuild(t *testing.T) {
 		{
 			"BadExcludeGlob",
 			func(f *InputConfig) {
-				f.Include = []string{"["}
+				f.Exclude = []string{"["}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"BadExcludeGlobAfterMismatch",
+			func(f *InputConfig) {
+				f.Exclude = []string{"/var/log/testpath.[ex"}
 			},
 			require.Error,
 			nil,
@@ -176,6 +188,241 @@ func TestBuild(t *testing.T) {
 			require.NoError,
 			func(t *testing.T, f *InputOperator) {},
 		},
+		{
+			"MultilineForceFlushPeriod",
+			func(f *InputConfig) {
+				f.Multiline = &MultilineConfig{
+					LineStartPattern: "START.*",
+					ForceFlushPeriod: helper.Duration{Duration: time.Second},
+				}
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.True(t, f.multiline)
+				require.Equal(t, time.Second, f.forceFlushPeriod)
+			},
+		},
+		{
+			"MultilineNegativeForceFlushPeriod",
+			func(f *InputConfig) {
+				f.Multiline = &MultilineConfig{
+					LineStartPattern: "START.*",
+					ForceFlushPeriod: helper.Duration{Duration: -time.Second},
+				}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"SuppressConsecutiveDuplicates",
+			func(f *InputConfig) {
+				f.SuppressConsecutiveDuplicates = &DuplicatesConfig{MaxRun: 100}
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, &duplicateSuppression{maxRun: 100, flushTimeout: defaultDuplicateFlushTimeout}, f.duplicates)
+			},
+		},
+		{
+			"SuppressConsecutiveDuplicatesNegativeMaxRun",
+			func(f *InputConfig) {
+				f.SuppressConsecutiveDuplicates = &DuplicatesConfig{MaxRun: -1}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"SuppressConsecutiveDuplicatesJSONArray",
+			func(f *InputConfig) {
+				f.SuppressConsecutiveDuplicates = &DuplicatesConfig{}
+				f.ReadMode = ReadModeJSONArray
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"MaxLogSizeUnitRunes",
+			func(f *InputConfig) {
+				f.MaxLogSizeUnit = SizeUnitRunes
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, SizeUnitRunes, f.encoding.sizeLimit.unit)
+			},
+		},
+		{
+			"EncodingAuto",
+			func(f *InputConfig) {
+				f.Encoding = EncodingAuto
+				f.DefaultEncoding = "windows-1252"
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, "windows-1252", f.encoding.name)
+				require.Len(t, f.bomEncodings, len(byteOrderMarks))
+			},
+		},
+		{
+			"DefaultEncodingWithoutAuto",
+			func(f *InputConfig) {
+				f.DefaultEncoding = "utf-8"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"DefaultEncodingAuto",
+			func(f *InputConfig) {
+				f.Encoding = EncodingAuto
+				f.DefaultEncoding = EncodingAuto
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"EncodingAutoJSONArray",
+			func(f *InputConfig) {
+				f.Encoding = EncodingAuto
+				f.ReadMode = ReadModeJSONArray
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"InvalidMaxLogSizeUnit",
+			func(f *InputConfig) {
+				f.MaxLogSizeUnit = "words"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"MaxLogSizeUnitJSONArray",
+			func(f *InputConfig) {
+				f.MaxLogSizeUnit = SizeUnitDecodedBytes
+				f.ReadMode = ReadModeJSONArray
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"DeleteAfterRead",
+			func(f *InputConfig) {
+				f.DeleteAfterRead = true
+				f.StartAt = "beginning"
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.True(t, f.deleteAfterRead)
+			},
+		},
+		{
+			"DeleteAfterReadStartAtEnd",
+			func(f *InputConfig) {
+				f.DeleteAfterRead = true
+				f.StartAt = "end"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"Backfill",
+			func(f *InputConfig) {
+				f.Backfill = true
+				f.ExitAfterBackfill = true
+				f.StartAt = "beginning"
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.NotNil(t, f.backfill)
+				require.NotNil(t, f.Completed())
+			},
+		},
+		{
+			"BackfillStartAtEnd",
+			func(f *InputConfig) {
+				f.Backfill = true
+				f.StartAt = "end"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"ExitAfterBackfillWithoutBackfill",
+			func(f *InputConfig) {
+				f.ExitAfterBackfill = true
+				f.StartAt = "beginning"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"BackfillPriority",
+			func(f *InputConfig) {
+				f.Backfill = true
+				f.BackfillPriority = &operator.PriorityConfig{IOPriority: operator.IOPriorityIdle, Nice: 10}
+				f.StartAt = "beginning"
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.NotNil(t, f.readPool)
+			},
+		},
+		{
+			"BackfillPriorityInvalid",
+			func(f *InputConfig) {
+				f.Backfill = true
+				f.BackfillPriority = &operator.PriorityConfig{IOPriority: "realtime"}
+				f.StartAt = "beginning"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"BackfillPriorityWithoutBackfill",
+			func(f *InputConfig) {
+				f.BackfillPriority = &operator.PriorityConfig{IOPriority: operator.IOPriorityIdle}
+				f.StartAt = "beginning"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"MaxConcurrentFiles",
+			func(f *InputConfig) {
+				f.MaxConcurrentFiles = 4
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, 4, f.maxConcurrent)
+			},
+		},
+		{
+			"MaxConcurrentFilesZero",
+			func(f *InputConfig) {
+				f.MaxConcurrentFiles = 0
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"ReadAheadSize",
+			func(f *InputConfig) {
+				f.ReadAheadSize = 4 * 1024 * 1024
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, 4*1024*1024, f.readAheadSize)
+			},
+		},
+		{
+			"ReadAheadSizeNegative",
+			func(f *InputConfig) {
+				f.ReadAheadSize = -1
+			},
+			require.Error,
+			nil,
+		},
 		{
 			"InvalidEncoding",
 			func(f *InputConfig) {
@@ -214,11 +461,154 @@ func TestBuild(t *testing.T) {
 			nil,
 		},
 		{
-			"InvalidLineEndRegex",
+			"InvalidLineEndRegex",
+			func(f *InputConfig) {
+				f.Multiline = &MultilineConfig{
+					LineEndPattern: "(",
+				}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"WatchModeNotify",
+			func(f *InputConfig) {
+				f.WatchMode = WatchModeNotify
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, WatchModeNotify, f.watchMode)
+			},
+		},
+		{
+			"WatchModeAuto",
+			func(f *InputConfig) {
+				f.WatchMode = WatchModeAuto
+				f.ScanInterval = helper.Duration{Duration: time.Minute}
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, WatchModeAuto, f.watchMode)
+				require.Equal(t, time.Minute, f.scanInterval)
+			},
+		},
+		{
+			"InvalidWatchMode",
+			func(f *InputConfig) {
+				f.WatchMode = "inotify"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"NotifyWithoutScanInterval",
+			func(f *InputConfig) {
+				f.WatchMode = WatchModeNotify
+				f.ScanInterval = helper.Duration{}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"CompressionGzip",
+			func(f *InputConfig) {
+				f.Compression = CompressionGzip
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, CompressionGzip, f.compression)
+			},
+		},
+		{
+			"IncludeFileMetadata",
+			func(f *InputConfig) {
+				f.IncludeFilePathResolved = true
+				f.IncludeFileMtime = true
+				f.IncludeFileOwner = true
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.True(t, f.includeFilePathResolved)
+				require.True(t, f.includeFileMtime)
+				require.True(t, f.includeFileOwner)
+			},
+		},
+		{
+			"FingerprintSize",
+			func(f *InputConfig) {
+				f.FingerprintSize = 4096
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.Equal(t, int64(4096), f.fingerprintBytes)
+			},
+		},
+		{
+			"FingerprintSizeTooSmall",
+			func(f *InputConfig) {
+				f.FingerprintSize = 8
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"FingerprintSizeTooLarge",
+			func(f *InputConfig) {
+				f.FingerprintSize = 1024 * 1024
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"InvalidCompression",
+			func(f *InputConfig) {
+				f.Compression = "zip"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"JSONArray",
+			func(f *InputConfig) {
+				f.ReadMode = ReadModeJSONArray
+				f.Encoding = "utf-8"
+			},
+			require.NoError,
+			func(t *testing.T, f *InputOperator) {
+				require.True(t, f.jsonArray)
+			},
+		},
+		{
+			"InvalidReadMode",
+			func(f *InputConfig) {
+				f.ReadMode = "xml"
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"JSONArrayWithMultiline",
+			func(f *InputConfig) {
+				f.ReadMode = ReadModeJSONArray
+				f.Multiline = &MultilineConfig{LineStartPattern: "{"}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"JSONArrayWithHeader",
+			func(f *InputConfig) {
+				f.ReadMode = ReadModeJSONArray
+				f.Header = &HeaderConfig{Pattern: "^#"}
+			},
+			require.Error,
+			nil,
+		},
+		{
+			"JSONArrayWithUTF16",
 			func(f *InputConfig) {
-				f.Multiline = &MultilineConfig{
-					LineEndPattern: "(",
-				}
+				f.ReadMode = ReadModeJSONArray
+				f.Encoding = "utf-16le"
 			},
 			require.Error,
 			nil,
@@ -282,6 +672,120 @@ func TestAddFileFields(t *testing.T) {
 	require.Equal(t, temp.Name(), e.Labels["file_path"])
 }
 
+// AddFileMetadata tests that the `file_path_resolved`, `file_mtime`, and
+// owner labels are included when they are configured
+func TestAddFileMetadata(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.IncludeFilePathResolved = true
+		cfg.IncludeFileMtime = true
+		cfg.IncludeFileOwner = true
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog\n")
+	info, err := temp.Stat()
+	require.NoError(t, err)
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	e := waitForOne(t, logReceived)
+	resolved, err := filepath.EvalSymlinks(temp.Name())
+	require.NoError(t, err)
+	require.Equal(t, resolved, e.Labels["file_path_resolved"])
+	require.Equal(t, info.ModTime().UTC().Format(time.RFC3339Nano), e.Labels["file_mtime"])
+
+	uid, gid, ok := fileOwner(info)
+	if ok {
+		require.Equal(t, uid, e.Labels["file_uid"])
+		require.Equal(t, gid, e.Labels["file_gid"])
+	} else {
+		require.NotContains(t, e.Labels, "file_uid")
+		require.NotContains(t, e.Labels, "file_gid")
+	}
+}
+
+// SharedFileLabels tests that the entries of a file share its labels, and
+// that changing the labels of one entry does not change the others
+func TestSharedFileLabels(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.IncludeFilePath = true
+		cfg.Labels = map[string]helper.ExprStringConfig{
+			"env":  "prod",
+			"line": `EXPR($record)`,
+		}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\ntestlog2\n")
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	first := waitForOne(t, logReceived)
+	second := waitForOne(t, logReceived)
+	expected := map[string]string{
+		"env":       "prod",
+		"line":      "testlog1",
+		"file_name": filepath.Base(temp.Name()),
+		"file_path": temp.Name(),
+	}
+	require.Equal(t, expected, first.Labels)
+	expected["line"] = "testlog2"
+	require.Equal(t, expected, second.Labels)
+
+	first.AddLabel("env", "dev")
+	require.Equal(t, "prod", second.Labels["env"])
+}
+
+// ResolvedPathFollowsSymlink tests that the `file_path_resolved` label follows
+// a symlink to its new target, and that a file is not read again when the
+// symlink is changed back to it
+func TestResolvedPathFollowsSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Creating symlinks requires elevated privileges on Windows")
+	}
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.IncludeFilePathResolved = true
+	}, nil)
+
+	targetDir, err := filepath.EvalSymlinks(testutil.NewTempDir(t))
+	require.NoError(t, err)
+	first := openFile(t, filepath.Join(targetDir, "first.log"))
+	writeString(t, first, "first1\n")
+	second := openFile(t, filepath.Join(targetDir, "second.log"))
+	writeString(t, second, "second1\n")
+
+	link := filepath.Join(tempDir, "current.log")
+	retarget := func(target string) {
+		_ = os.Remove(link)
+		require.NoError(t, os.Symlink(target, link))
+	}
+
+	retarget(first.Name())
+	operator.poll(context.Background())
+	e := waitForOne(t, logReceived)
+	require.Equal(t, "first1", e.Record)
+	require.Equal(t, first.Name(), e.Labels["file_path_resolved"])
+
+	retarget(second.Name())
+	operator.poll(context.Background())
+	e = waitForOne(t, logReceived)
+	require.Equal(t, "second1", e.Record)
+	require.Equal(t, second.Name(), e.Labels["file_path_resolved"])
+
+	writeString(t, first, "first2\n")
+	retarget(first.Name())
+	operator.poll(context.Background())
+	e = waitForOne(t, logReceived)
+	require.Equal(t, "first2", e.Record)
+	require.Equal(t, first.Name(), e.Labels["file_path_resolved"])
+	expectNoMessages(t, logReceived)
+}
+
 // ReadExistingLogs tests that, when starting from beginning, we
 // read all the lines that are already there
 func TestReadExistingLogs(t *testing.T) {
@@ -380,6 +884,42 @@ func TestStartAtEndNewFile(t *testing.T) {
 	waitForMessage(t, logReceived, "testlog2")
 }
 
+// StartAtEndLateDirectory tests that when `start_at` is configured to `end`,
+// files that existed before the operator started are read from the end even
+// if their directory appears after the first poll, while files created after
+// the operator started are read from the beginning
+func TestStartAtEndLateDirectory(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.StartAt = "end"
+		cfg.Include = []string{filepath.Join(filepath.Dir(cfg.Include[0]), "late", "*")}
+	}, nil)
+	operator.startedAt = time.Now()
+
+	// The directory does not exist on the first poll
+	operator.poll(context.Background())
+	expectNoMessages(t, logReceived)
+
+	lateDir := filepath.Join(tempDir, "late")
+	require.NoError(t, os.Mkdir(lateDir, 0755))
+	old := openFile(t, filepath.Join(lateDir, "old.log"))
+	writeString(t, old, "history1\nhistory2\n")
+	modified := operator.startedAt.Add(-time.Hour)
+	require.NoError(t, os.Chtimes(old.Name(), modified, modified))
+
+	operator.poll(context.Background())
+	expectNoMessages(t, logReceived)
+
+	writeString(t, old, "testlog1\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog1")
+
+	created := openFile(t, filepath.Join(lateDir, "new.log"))
+	writeString(t, created, "testlog2\ntestlog3\n")
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"testlog2", "testlog3"})
+}
+
 // NoNewline tests that an entry will still be sent eventually
 // even if the file doesn't end in a newline
 func TestNoNewline(t *testing.T) {
@@ -443,6 +983,202 @@ func TestDecodeBufferIsResized(t *testing.T) {
 	waitForMessage(t, logReceived, expected)
 }
 
+// MultilineStackTrace tests that a stack trace is read as one entry, and
+// that the last entry is flushed once it has not grown for the force flush period
+func TestMultilineStackTrace(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Multiline = &MultilineConfig{
+			LineStartPattern: `^\d{4}-\d{2}-\d{2} `,
+			ForceFlushPeriod: helper.Duration{Duration: 200 * time.Millisecond},
+		}
+	}, nil)
+
+	var trace strings.Builder
+	trace.WriteString("2020-10-01 12:00:01 ERROR java.lang.IllegalStateException: failed at 2020-10-01 12:00:00\n")
+	for i := 0; i < 19; i++ {
+		trace.WriteString(fmt.Sprintf("\tat com.example.Service.method%d(Service.java:%d)\n", i, i+10))
+	}
+	last := "2020-10-01 12:00:02 INFO recovered\n"
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "2020-10-01 12:00:00 INFO starting\n")
+	writeString(t, temp, trace.String())
+	writeString(t, temp, last)
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	waitForMessage(t, logReceived, "2020-10-01 12:00:00 INFO starting\n")
+	waitForMessage(t, logReceived, trace.String())
+	waitForMessage(t, logReceived, last)
+	expectNoMessages(t, logReceived)
+}
+
+// expectEntry waits for an entry with a record and repeat count, where a
+// count of 0 means that the entry has no repeat_count label
+func expectEntry(t *testing.T, c chan *entry.Entry, record string, repeatCount string) {
+	select {
+	case e := <-c:
+		require.Equal(t, record, e.Record)
+		count, ok := e.Labels[repeatCountLabel]
+		if repeatCount == "" {
+			require.False(t, ok, "Unexpected repeat_count %s", count)
+			return
+		}
+		require.Equal(t, repeatCount, count)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for message", record)
+	}
+}
+
+// SuppressConsecutiveDuplicates tests that a run of duplicate lines is
+// emitted once with its repeat count, and that the offset covers the run
+func TestSuppressConsecutiveDuplicates(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.SuppressConsecutiveDuplicates = &DuplicatesConfig{
+			FlushTimeout: helper.Duration{Duration: time.Hour},
+		}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "a\na\na\nb\nc\nc\n")
+
+	require.NoError(t, operator.Start())
+	expectEntry(t, logReceived, "a", "3")
+	expectEntry(t, logReceived, "b", "")
+	expectNoMessages(t, logReceived)
+
+	// The held run is emitted when stopping
+	require.NoError(t, operator.Stop())
+	expectEntry(t, logReceived, "c", "2")
+
+	require.NoError(t, operator.Start())
+	expectNoMessages(t, logReceived)
+	require.NoError(t, operator.Stop())
+	expectNoMessages(t, logReceived)
+}
+
+// SuppressConsecutiveDuplicatesAfterCrash tests that the saved offset does not
+// cover a held run, so that the run is read again if the agent does not stop
+func TestSuppressConsecutiveDuplicatesAfterCrash(t *testing.T) {
+	t.Parallel()
+	tempDir := testutil.NewTempDir(t)
+	buildContext := testutil.NewBuildContext(t)
+	build := func() (*InputOperator, chan *entry.Entry) {
+		cfg := newDefaultConfig(tempDir)
+		cfg.SuppressConsecutiveDuplicates = &DuplicatesConfig{
+			FlushTimeout: helper.Duration{Duration: time.Hour},
+		}
+		ops, err := cfg.Build(buildContext)
+		require.NoError(t, err)
+		fakeOutput := testutil.NewFakeOutput(t)
+		require.NoError(t, ops[0].SetOutputs([]operator.Operator{fakeOutput}))
+		return ops[0].(*InputOperator), fakeOutput.Received
+	}
+
+	crashed, logReceived := build()
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "a\nb\nb\n")
+	crashed.poll(context.Background())
+	crashed.wg.Wait()
+	expectEntry(t, logReceived, "a", "")
+	expectNoMessages(t, logReceived)
+
+	knownFiles, err := DecodeKnownFiles(crashed.persist.Get(KnownFilesKey))
+	require.NoError(t, err)
+	require.Len(t, knownFiles, 1)
+	require.Equal(t, int64(2), knownFiles[0].Offset)
+
+	// The operator that replaces the crashed one emits the held run
+	restarted, logReceived := build()
+	require.NoError(t, restarted.Start())
+	writeString(t, temp, "c\n")
+	expectEntry(t, logReceived, "b", "2")
+	expectNoMessages(t, logReceived)
+
+	// The line that ended the run starts a run of its own, which is held
+	// until the operator stops
+	require.NoError(t, restarted.Stop())
+	expectEntry(t, logReceived, "c", "")
+	expectNoMessages(t, logReceived)
+}
+
+// SuppressConsecutiveDuplicatesMaxRun tests that a run is emitted once it
+// reaches the max run, or once it has been held for the flush timeout
+func TestSuppressConsecutiveDuplicatesMaxRun(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.SuppressConsecutiveDuplicates = &DuplicatesConfig{
+			MaxRun:       2,
+			FlushTimeout: helper.Duration{Duration: 100 * time.Millisecond},
+		}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "x\nx\nx\nx\nx\n")
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+	expectEntry(t, logReceived, "x", "2")
+	expectEntry(t, logReceived, "x", "2")
+	expectEntry(t, logReceived, "x", "")
+	expectNoMessages(t, logReceived)
+
+	writeString(t, temp, "y\ny\nz\n")
+	expectEntry(t, logReceived, "y", "2")
+	expectEntry(t, logReceived, "z", "")
+	expectNoMessages(t, logReceived)
+}
+
+// MultilineFlushOnStop tests that the last entry of a file is flushed when
+// the operator is stopped, and is not read again after a restart
+func TestMultilineFlushOnStop(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Multiline = &MultilineConfig{
+			LineStartPattern: `^START`,
+		}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "START log1\nSTART log2\ncontinued\n")
+
+	require.NoError(t, operator.Start())
+	waitForMessage(t, logReceived, "START log1\n")
+	expectNoMessages(t, logReceived)
+
+	require.NoError(t, operator.Stop())
+	waitForMessage(t, logReceived, "START log2\ncontinued\n")
+
+	writeString(t, temp, "START log3\n")
+	require.NoError(t, operator.Start())
+	expectNoMessages(t, logReceived)
+	require.NoError(t, operator.Stop())
+	waitForMessage(t, logReceived, "START log3\n")
+}
+
+// MultilineMaxLogSize tests that an entry that never ends is split at the
+// max log size rather than buffered without limit
+func TestMultilineMaxLogSize(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.MaxLogSize = 20
+		cfg.Multiline = &MultilineConfig{
+			LineEndPattern: `END`,
+		}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, strings.Repeat("a", 50)+"END")
+
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, strings.Repeat("a", 20))
+	waitForMessage(t, logReceived, strings.Repeat("a", 20))
+	waitForMessage(t, logReceived, strings.Repeat("a", 10)+"END")
+}
+
 func TestMultiFileSimple(t *testing.T) {
 	t.Parallel()
 	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
@@ -456,7 +1192,244 @@ func TestMultiFileSimple(t *testing.T) {
 	require.NoError(t, operator.Start())
 	defer operator.Stop()
 
-	waitForMessages(t, logReceived, []string{"testlog1", "testlog2"})
+	waitForMessages(t, logReceived, []string{"testlog1", "testlog2"})
+}
+
+// MultiFileThrottled tests that every file is read when the throttle of
+// the operator allows a single concurrent read
+func TestMultiFileThrottled(t *testing.T) {
+	t.Parallel()
+	fakeOutput := testutil.NewFakeOutput(t)
+	tempDir := testutil.NewTempDir(t)
+
+	throttles, err := operator.NewThrottles(map[string]operator.ThrottleConfig{
+		"replay": {MaxConcurrentReads: 1},
+	})
+	require.NoError(t, err)
+	buildContext := testutil.NewBuildContext(t)
+	buildContext.Throttles = throttles
+
+	cfg := newDefaultConfig(tempDir)
+	cfg.Throttle = "replay"
+	ops, err := cfg.Build(buildContext)
+	require.NoError(t, err)
+	op := ops[0].(*InputOperator)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fakeOutput}))
+
+	expected := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		temp := openTemp(t, tempDir)
+		message := fmt.Sprintf("testlog%d", i)
+		writeString(t, temp, message+"\n")
+		expected = append(expected, message)
+	}
+
+	op.poll(context.Background())
+	waitForMessages(t, fakeOutput.Received, expected)
+	require.Equal(t, uint64(5), throttles.Counters()["replay"]["reads"])
+}
+
+// MaxConcurrentFiles tests that when more files match than the max concurrent
+// files, they are read in batches, with no more files open at once than the max
+func TestMaxConcurrentFiles(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("Open files cannot be listed on this platform")
+	}
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.MaxConcurrentFiles = 4
+	}, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 1000)
+	})
+
+	expected := make([]string, 0, 500)
+	for i := 0; i < 100; i++ {
+		var contents strings.Builder
+		for j := 0; j < 5; j++ {
+			message := fmt.Sprintf("file%d-log%d", i, j)
+			contents.WriteString(message + "\n")
+			expected = append(expected, message)
+		}
+		path := filepath.Join(tempDir, fmt.Sprintf("%03d.log", i))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents.String()), 0666))
+	}
+
+	// Count the files in the temp dir that are open while polling
+	openFiles := func() int {
+		fds, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			return 0
+		}
+		count := 0
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+			if err == nil && strings.HasPrefix(target, tempDir) {
+				count++
+			}
+		}
+		return count
+	}
+
+	done := make(chan struct{})
+	maxOpen := make(chan int)
+	go func() {
+		max := 0
+		for {
+			if open := openFiles(); open > max {
+				max = open
+			}
+			select {
+			case <-done:
+				maxOpen <- max
+				return
+			default:
+			}
+		}
+	}()
+
+	operator.poll(context.Background())
+	close(done)
+	require.LessOrEqual(t, <-maxOpen, 4)
+	waitForMessages(t, logReceived, expected)
+}
+
+// ReadAhead tests that a file with a large unread part is read in full and in
+// order when it is read ahead
+func TestReadAhead(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.ReadAheadSize = 64 * 1024
+	}, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 30000)
+	})
+
+	line := func(i int) string {
+		return fmt.Sprintf("%s %05d", strings.Repeat("x", 90), i)
+	}
+
+	temp := openTemp(t, tempDir)
+	var contents strings.Builder
+	for i := 0; i < 20000; i++ {
+		contents.WriteString(line(i) + "\n")
+	}
+	writeString(t, temp, contents.String())
+
+	operator.poll(context.Background())
+	defer operator.Stop()
+
+	for i := 0; i < 20000; i++ {
+		require.Equal(t, line(i), waitForOne(t, logReceived).Record)
+	}
+
+	// Lines written after the backlog are read as usual
+	writeString(t, temp, "testlog1\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog1")
+	expectNoMessages(t, logReceived)
+}
+
+// DeleteAfterRead tests that files are deleted once they have been read to
+// the end and stop changing, and that a file still being written is kept
+func TestDeleteAfterRead(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.DeleteAfterRead = true
+	}, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 1000)
+	})
+
+	expected := make([]string, 0, 500)
+	paths := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		temp := openTemp(t, tempDir)
+		for j := 0; j < 10; j++ {
+			message := fmt.Sprintf("file%d-log%d", i, j)
+			writeString(t, temp, message+"\n")
+			expected = append(expected, message)
+		}
+		require.NoError(t, temp.Close())
+		paths = append(paths, temp.Name())
+	}
+
+	operator.poll(context.Background())
+	for _, path := range paths {
+		require.FileExists(t, path)
+	}
+
+	// The files are deleted once the outputs have sent their entries, and
+	// their offsets are forgotten by the next poll
+	operator.poll(context.Background())
+	operator.wg.Wait()
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		require.True(t, os.IsNotExist(err), "file %s was not deleted", path)
+	}
+	operator.forgetDeleted()
+	require.Empty(t, operator.knownFiles)
+	waitForMessages(t, logReceived, expected)
+
+	// A file that is written to between polls is kept
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "active1\n")
+	operator.poll(context.Background())
+	writeString(t, temp, "active2\n")
+	operator.poll(context.Background())
+	require.FileExists(t, temp.Name())
+	waitForMessages(t, logReceived, []string{"active1", "active2"})
+}
+
+// flushBlocker is an output that does not send the entries it receives until
+// it is released
+type flushBlocker struct {
+	*testutil.FakeOutput
+	release chan struct{}
+}
+
+func (b *flushBlocker) WaitFlushed(ctx context.Context) error {
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeleteAfterReadSlowOutput tests that polls continue while the deletion of
+// finished files waits for a slow output
+func TestDeleteAfterReadSlowOutput(t *testing.T) {
+	t.Parallel()
+	var fake *testutil.FakeOutput
+	op, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.DeleteAfterRead = true
+	}, func(out *testutil.FakeOutput) {
+		fake = out
+	})
+	blocker := &flushBlocker{FakeOutput: fake, release: make(chan struct{})}
+	require.NoError(t, op.SetOutputs([]operator.Operator{blocker}))
+
+	finished := openTemp(t, tempDir)
+	writeString(t, finished, "finished\n")
+	require.NoError(t, finished.Close())
+	op.poll(context.Background())
+	waitForMessage(t, logReceived, "finished")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		op.poll(context.Background())
+		op.poll(context.Background())
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for polls blocked by the output")
+	}
+	require.FileExists(t, finished.Name())
+
+	close(blocker.release)
+	op.wg.Wait()
+	_, err := os.Stat(finished.Name())
+	require.True(t, os.IsNotExist(err))
 }
 
 func TestMultiFileParallel_PreloadedFiles(t *testing.T) {
@@ -857,6 +1830,32 @@ func TestRotation(t *testing.T) {
 	}
 }
 
+func TestKnownFilesBoundedAfterRotation(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
+	archiveDir := testutil.NewTempDir(t)
+
+	for i := 0; i < 300; i++ {
+		temp := openTemp(t, tempDir)
+		writeString(t, temp, fmt.Sprintf("testlog%d\n", i))
+		require.NoError(t, temp.Close())
+
+		operator.poll(context.Background())
+		waitForMessage(t, logReceived, fmt.Sprintf("testlog%d", i))
+
+		// Rotate the file out of the include pattern
+		err := os.Rename(temp.Name(), filepath.Join(archiveDir, filepath.Base(temp.Name())))
+		require.NoError(t, err)
+	}
+
+	// Each file is remembered for a few polls after it is rotated out
+	require.LessOrEqual(t, len(operator.knownFiles), 4)
+
+	knownFiles, err := operator.decodeKnownFiles(operator.persist.Get(KnownFilesKey))
+	require.NoError(t, err)
+	require.Equal(t, len(operator.knownFiles), len(knownFiles))
+}
+
 func TestMoveFile(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Moving files while open is unsupported on Windows")
@@ -906,6 +1905,164 @@ func TestTruncateThenWrite(t *testing.T) {
 	expectNoMessages(t, logReceived)
 }
 
+// TruncateWithSamePrefix tests that a file that is truncated and rewritten
+// with the same first lines, so that its fingerprint still matches, is read
+// again from the beginning rather than from its old offset
+func TestTruncateWithSamePrefix(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 200)
+	})
+
+	line := func(i int) string {
+		return fmt.Sprintf("%s %03d", strings.Repeat("x", 50), i)
+	}
+
+	temp := openTemp(t, tempDir)
+	for i := 0; i < 100; i++ {
+		writeString(t, temp, line(i)+"\n")
+	}
+	operator.poll(context.Background())
+	defer operator.Stop()
+
+	require.NoError(t, temp.Truncate(0))
+	_, err := temp.Seek(0, 0)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		writeString(t, temp, line(i)+"\n")
+	}
+	operator.poll(context.Background())
+
+	expected := make([]string, 0, 150)
+	for i := 0; i < 100; i++ {
+		expected = append(expected, line(i))
+	}
+	for i := 0; i < 50; i++ {
+		expected = append(expected, line(i))
+	}
+	waitForMessages(t, logReceived, expected)
+	expectNoMessages(t, logReceived)
+}
+
+// RewriteWhileReading tests that a file that is rewritten in place while it
+// is read is read again from the beginning, with its entries labeled, and
+// that the entries of the old contents are not mixed with the new ones
+func TestRewriteWhileReading(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry)
+	})
+
+	line := func(c string, i int) string {
+		return fmt.Sprintf("%s %03d %s", strings.Repeat(c, 10), i, strings.Repeat(c, 10))
+	}
+	contents := func(c string) []byte {
+		var b strings.Builder
+		for i := 0; i < 100; i++ {
+			b.WriteString(line(c, i) + "\n")
+		}
+		return []byte(b.String())
+	}
+
+	temp := openTemp(t, tempDir)
+	_, err := temp.Write(contents("a"))
+	require.NoError(t, err)
+
+	// The whole file is buffered by the first read, so the rest of the old
+	// contents may still be sent, since it was read before the rewrite
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		operator.poll(context.Background())
+	}()
+	waitForMessage(t, logReceived, line("a", 0))
+	_, err = temp.WriteAt(contents("b"), 0)
+	require.NoError(t, err)
+
+	received := 1
+	for done != nil {
+		select {
+		case e := <-logReceived:
+			require.Equal(t, line("a", received), e.Record)
+			received++
+		case <-done:
+			done = nil
+		case <-time.After(time.Second):
+			require.FailNow(t, "Timed out waiting for the read to finish")
+		}
+	}
+
+	// The rewrite is found once the read reaches the end, and the file is
+	// read again by the next poll
+	go operator.poll(context.Background())
+	for i := 0; i < 100; i++ {
+		e := waitForOne(t, logReceived)
+		require.Equal(t, line("b", i), e.Record)
+		require.Equal(t, "true", e.Labels["file_rewritten"])
+	}
+	expectNoMessages(t, logReceived)
+	require.Equal(t, uint64(1), operator.Counters()["files_rewritten"])
+}
+
+// RewriteWhileReadingConcurrently tests that no entry mixes the old and new
+// contents of a file that is rewritten in place while it is being read, and
+// that the new contents are read in full
+func TestRewriteWhileReadingConcurrently(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry, 100000)
+	})
+
+	line := func(c string, i int) string {
+		return fmt.Sprintf("%s %03d %s", strings.Repeat(c, 10), i, strings.Repeat(c, 10))
+	}
+
+	temp := openTemp(t, tempDir)
+	for i := 0; i < 1000; i++ {
+		writeString(t, temp, line("a", i)+"\n")
+	}
+
+	// The file is rewritten from the beginning, ten lines at a time
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < 1000; i += 10 {
+			var chunk strings.Builder
+			for j := i; j < i+10; j++ {
+				chunk.WriteString(line("b", j) + "\n")
+			}
+			offset := int64(i * (len(line("b", i)) + 1))
+			_, err := temp.WriteAt([]byte(chunk.String()), offset)
+			require.NoError(t, err)
+		}
+	}()
+
+	for polling := true; polling; {
+		select {
+		case <-written:
+			polling = false
+		default:
+		}
+		operator.poll(context.Background())
+	}
+	for i := 0; i < 3; i++ {
+		operator.poll(context.Background())
+	}
+
+	read := make(map[string]bool)
+	for len(logReceived) > 0 {
+		e := <-logReceived
+		message := e.Record.(string)
+		fields := strings.Fields(message)
+		require.Len(t, fields, 3, message)
+		require.Equal(t, fields[0], fields[2], "entry mixes old and new contents: %s", message)
+		read[message] = true
+	}
+	for i := 0; i < 1000; i++ {
+		require.True(t, read[line("b", i)], "missing %s", line("b", i))
+	}
+}
+
 // CopyTruncateWriteBoth tests that when a file is copied
 // with unread logs on the end, then the original is truncated,
 // we get the unread logs on the copy as well as any new logs
@@ -1013,6 +2170,46 @@ func TestOffsetsAfterRestart_BigFilesWrittenWhileOff(t *testing.T) {
 	waitForMessage(t, logReceived, log2)
 }
 
+func TestRecoveryReportAfterRestart(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\n")
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+	waitForMessage(t, logReceived, "testlog1")
+
+	// Nothing was persisted before the first start
+	require.Equal(t, &helper.RecoveryReport{}, operator.RecoveryReport())
+
+	// Stop the operator and write a new message
+	require.NoError(t, operator.Stop())
+	writeString(t, temp, "testlog2\n")
+
+	require.NoError(t, operator.Start())
+	report := operator.RecoveryReport()
+	require.Equal(t, 1, report.KnownFiles)
+	require.Equal(t, int64(len("testlog2\n")), report.UnreadBytes)
+	require.Empty(t, report.Discarded)
+	waitForMessage(t, logReceived, "testlog2")
+}
+
+func TestRecoveryReportCorruptKnownFiles(t *testing.T) {
+	t.Parallel()
+	operator, _, _ := newTestFileOperator(t, nil, nil)
+
+	operator.persist.Set(KnownFilesKey, []byte("not json"))
+	require.NoError(t, operator.persist.Sync())
+
+	// Corrupt known files fail the start rather than reading every file again
+	err := operator.Start()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "decoding file count")
+	require.Nil(t, operator.RecoveryReport().Discarded)
+}
+
 func TestFileMovedWhileOff_BigFiles(t *testing.T) {
 	t.Parallel()
 	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
@@ -1071,13 +2268,71 @@ func TestManyLogsDelivered(t *testing.T) {
 	expectNoMessages(t, logReceived)
 }
 
+// FingerprintSize tests that files with a common prefix that is longer
+// than the fingerprint are aliased with a warning, and that both are read
+// when fingerprint_size is increased
+func TestFingerprintSize(t *testing.T) {
+	t.Parallel()
+	banner := strings.Repeat("a", 1500) + "\n"
+
+	cases := []struct {
+		name            string
+		fingerprintSize int
+		expected        []string
+		expectedWarning bool
+	}{
+		{"Default", defaultFingerprintSize, nil, true},
+		{"Increased", 2000, []string{strings.TrimSpace(banner), strings.TrimSpace(banner), "testlog1", "testlog2"}, false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+				cfg.FingerprintSize = tc.fingerprintSize
+			}, nil)
+			core, logs := observer.New(zap.WarnLevel)
+			operator.SugaredLogger = zap.New(core).Sugar()
+
+			temp1 := openTemp(t, tempDir)
+			writeString(t, temp1, banner+"testlog1\n")
+			temp2 := openTemp(t, tempDir)
+			writeString(t, temp2, banner+"testlog2\n")
+
+			operator.poll(context.Background())
+			operator.poll(context.Background())
+
+			received := make([]string, 0)
+		LOOP:
+			for {
+				select {
+				case e := <-logReceived:
+					received = append(received, e.Record.(string))
+				case <-time.After(200 * time.Millisecond):
+					break LOOP
+				}
+			}
+
+			if tc.expectedWarning {
+				// Only one file is read, and the aliasing is warned about once
+				require.Len(t, received, 2)
+				require.Equal(t, 1, logs.FilterMessageSnippet("matching fingerprints").Len())
+				return
+			}
+			require.ElementsMatch(t, tc.expected, received)
+			require.Equal(t, 0, logs.FilterMessageSnippet("matching fingerprints").Len())
+		})
+	}
+}
+
 func TestFileReader_FingerprintUpdated(t *testing.T) {
 	t.Parallel()
 	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
 
 	temp := openTemp(t, tempDir)
 	tempCopy := openFile(t, temp.Name())
-	fp, err := NewFingerprint(temp)
+	fp, err := NewFingerprint(temp, defaultFingerprintSize)
 	require.NoError(t, err)
 	reader, err := NewReader(temp.Name(), operator, tempCopy, fp)
 	require.NoError(t, err)
@@ -1195,6 +2450,24 @@ func TestEncodings(t *testing.T) {
 			"big5",
 			[][]byte{{230, 138, 152}},
 		},
+		{
+			"EuroSignWindows1252",
+			[]byte{128, 10}, // €\n
+			"windows-1252",
+			[][]byte{{226, 130, 172}},
+		},
+		{
+			"KatakanaShiftJIS",
+			[]byte{131, 101, 10}, // テ\n
+			"shift_jis",
+			[][]byte{{227, 131, 134}},
+		},
+		{
+			"ChineseCharacterGBK",
+			[]byte{214, 208, 10}, // 中\n
+			"gbk",
+			[][]byte{{228, 184, 173}},
+		},
 	}
 
 	for _, tc := range cases {
@@ -1224,6 +2497,26 @@ func TestEncodings(t *testing.T) {
 	}
 }
 
+// MaxLogSizeUnit tests that a utf-16 file is limited in decoded characters,
+// and that an entry at the limit is not split
+func TestMaxLogSizeUnit(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Encoding = "utf-16le"
+		cfg.MaxLogSize = 4
+		cfg.MaxLogSizeUnit = SizeUnitRunes
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	contents, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().String("abcd\nab😀d😀\n")
+	require.NoError(t, err)
+	writeString(t, temp, contents)
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"abcd", "ab😀d", "😀"})
+	expectNoMessages(t, logReceived)
+}
+
 type fileInputBenchmark struct {
 	name   string
 	config *InputConfig
@@ -1243,6 +2536,30 @@ func BenchmarkFileInput(b *testing.B) {
 				return cfg
 			}(),
 		},
+		{
+			"ReadAhead",
+			func() *InputConfig {
+				cfg := NewInputConfig("test_id")
+				cfg.ReadAheadSize = 4 * 1024 * 1024
+				return cfg
+			}(),
+		},
+		{
+			"Metadata",
+			func() *InputConfig {
+				cfg := NewInputConfig("test_id")
+				cfg.IncludeFilePath = true
+				cfg.IncludeFilePathResolved = true
+				cfg.IncludeFileMtime = true
+				cfg.IncludeFileOwner = true
+				cfg.Labels = map[string]helper.ExprStringConfig{
+					"host": "server1",
+					"env":  "prod",
+					"app":  "checkout",
+				}
+				return cfg
+			}(),
+		},
 	}
 
 	for _, tc := range cases {
@@ -1274,10 +2591,223 @@ func BenchmarkFileInput(b *testing.B) {
 				file.WriteString("testlog\n")
 			}
 
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				<-fakeOutput.Received
+			}
+		})
+	}
+}
+
+// BenchmarkFileInputBacklog measures reading a file that was written before
+// it is polled, in a single poll, where each read of the file holds many
+// entries
+func BenchmarkFileInputBacklog(b *testing.B) {
+	cases := []fileInputBenchmark{
+		{
+			"Default",
+			NewInputConfig("test_id"),
+		},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			tempDir := testutil.NewTempDir(b)
+			path := filepath.Join(tempDir, "in.log")
+
+			cfg := tc.config
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Include = []string{path}
+			cfg.StartAt = "beginning"
+
+			ops, err := cfg.Build(testutil.NewBuildContext(b))
+			require.NoError(b, err)
+			op := ops[0].(*InputOperator)
+
+			fakeOutput := testutil.NewFakeOutput(b)
+			require.NoError(b, op.SetOutputs([]operator.Operator{fakeOutput}))
+
+			file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+			require.NoError(b, err)
+			defer file.Close()
+			line := []byte("testlog testlog testlog testlog testlog testlog\n")
+			for i := 0; i < b.N; i++ {
+				_, err := file.Write(line)
+				require.NoError(b, err)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(line)))
 			b.ResetTimer()
+			go op.poll(context.Background())
 			for i := 0; i < b.N; i++ {
 				<-fakeOutput.Received
 			}
 		})
 	}
 }
+
+// BenchmarkFileInputReadAhead measures reading a large file in one poll with
+// read-ahead off and with read-ahead buffers of several sizes
+func BenchmarkFileInputReadAhead(b *testing.B) {
+	tempDir := testutil.NewTempDir(b)
+	path := filepath.Join(tempDir, "in.log")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	require.NoError(b, err)
+	defer file.Close()
+
+	line := []byte(strings.Repeat("testlog ", 15) + "\n")
+	lines := 16 * readAheadMinUnread / len(line)
+	for i := 0; i < lines; i++ {
+		_, err := file.Write(line)
+		require.NoError(b, err)
+	}
+
+	for _, size := range []int{0, 4 * 1024 * 1024, 16 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("%dMB", size/1024/1024), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(lines * len(line)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				cfg := NewInputConfig("test_id")
+				cfg.OutputIDs = []string{"fake"}
+				cfg.Include = []string{path}
+				cfg.StartAt = "beginning"
+				cfg.ReadAheadSize = size
+				ops, err := cfg.Build(testutil.NewBuildContext(b))
+				require.NoError(b, err)
+				op := ops[0].(*InputOperator)
+				fakeOutput := testutil.NewFakeOutput(b)
+				require.NoError(b, op.SetOutputs([]operator.Operator{fakeOutput}))
+
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					for j := 0; j < lines; j++ {
+						<-fakeOutput.Received
+					}
+				}()
+				b.StartTimer()
+
+				op.poll(context.Background())
+				<-done
+			}
+		})
+	}
+}
+
+func TestPendingWork(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, func(out *testutil.FakeOutput) {
+		out.Received = make(chan *entry.Entry)
+	})
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\ntestlog2\n")
+	require.Equal(t, int64(0), operator.PendingWork())
+
+	// The poll blocks on the output, so the bytes of the file stay pending
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		operator.poll(context.Background())
+	}()
+	waitForMessage(t, logReceived, "testlog1")
+	require.Equal(t, int64(18), operator.PendingWork())
+
+	waitForMessage(t, logReceived, "testlog2")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for the poll to finish")
+	}
+	require.Equal(t, int64(0), operator.PendingWork())
+}
+
+// IncludeFileOffset tests that the `file_offset` and `file_length` labels of
+// each entry are the position and size of its raw bytes in the file
+func TestIncludeFileOffset(t *testing.T) {
+	t.Parallel()
+	utf16 := func(s string) []byte {
+		b := make([]byte, 0, len(s)*2)
+		for _, c := range []byte(s) {
+			b = append(b, c, 0)
+		}
+		return b
+	}
+
+	cases := []struct {
+		name     string
+		cfgMod   func(*InputConfig)
+		contents []byte
+		expected [][]byte
+	}{
+		{
+			"Lines",
+			nil,
+			[]byte("first\nsecond line\n\nthird\n"),
+			[][]byte{[]byte("first"), []byte("second line"), []byte("third")},
+		},
+		{
+			"CRLF",
+			nil,
+			[]byte("first\r\nsecond\r\n"),
+			[][]byte{[]byte("first"), []byte("second")},
+		},
+		{
+			"Encoded",
+			func(cfg *InputConfig) { cfg.Encoding = "utf-16le" },
+			utf16("first\nsecond\n"),
+			[][]byte{utf16("first"), utf16("second")},
+		},
+		{
+			"Multiline",
+			func(cfg *InputConfig) {
+				cfg.Multiline = &MultilineConfig{
+					LineStartPattern: "START",
+					ForceFlushPeriod: helper.Duration{Duration: 100 * time.Millisecond},
+				}
+			},
+			[]byte("START first\ncontinued\nSTART second\n"),
+			[][]byte{[]byte("START first\ncontinued\n"), []byte("START second\n")},
+		},
+		{
+			"Duplicates",
+			func(cfg *InputConfig) {
+				cfg.SuppressConsecutiveDuplicates = &DuplicatesConfig{FlushTimeout: helper.Duration{Duration: 100 * time.Millisecond}}
+			},
+			[]byte("first\nrepeated\nrepeated\nrepeated\nlast\n"),
+			[][]byte{[]byte("first"), []byte("repeated\nrepeated\nrepeated"), []byte("last")},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+				cfg.IncludeFileOffset = true
+				if tc.cfgMod != nil {
+					tc.cfgMod(cfg)
+				}
+			}, nil)
+
+			temp := openTemp(t, tempDir)
+			_, err := temp.Write(tc.contents)
+			require.NoError(t, err)
+
+			require.NoError(t, operator.Start())
+			defer operator.Stop()
+
+			for _, expected := range tc.expected {
+				e := waitForOne(t, logReceived)
+				offset, err := strconv.Atoi(e.Labels["file_offset"])
+				require.NoError(t, err)
+				length, err := strconv.Atoi(e.Labels["file_length"])
+				require.NoError(t, err)
+				require.Equal(t, string(expected), string(tc.contents[offset:offset+length]))
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package file
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+)
+
+// GlobError describes a syntax error in a glob pattern.
+type GlobError struct {
+	Pattern  string
+	Position int
+	Reason   string
+}
+
+// Error returns the error message.
+func (e *GlobError) Error() string {
+	return fmt.Sprintf("invalid glob '%s': %s at position %d", e.Pattern, e.Reason, e.Position)
+}
+
+// validateGlob checks the full syntax of a glob pattern as understood by
+// filepath.Match. Unlike calling filepath.Match with a sample string, every
+// part of the pattern is checked, even those after the first mismatch.
+func validateGlob(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if runtime.GOOS == "windows" {
+				continue
+			}
+			if i+1 >= len(pattern) {
+				return &GlobError{pattern, i, "trailing escape character"}
+			}
+			i++
+		case '[':
+			end, err := validateClass(pattern, i)
+			if err != nil {
+				return err
+			}
+			i = end
+		}
+	}
+	return nil
+}
+
+// validateClass checks the character class that starts at the given index and
+// returns the index of its closing bracket.
+func validateClass(pattern string, start int) (int, error) {
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+
+	for ranges := 0; ; ranges++ {
+		if i >= len(pattern) {
+			return 0, &GlobError{pattern, start, "unclosed character class"}
+		}
+
+		if pattern[i] == ']' && ranges > 0 {
+			return i, nil
+		}
+
+		next, err := validateClassChar(pattern, start, i)
+		if err != nil {
+			return 0, err
+		}
+		i = next
+
+		if i < len(pattern) && pattern[i] == '-' {
+			next, err = validateClassChar(pattern, start, i+1)
+			if err != nil {
+				return 0, err
+			}
+			i = next
+		}
+	}
+}
+
+// validateClassChar checks a single, possibly escaped, character within a
+// character class and returns the index following it.
+func validateClassChar(pattern string, start, i int) (int, error) {
+	if i >= len(pattern) {
+		return 0, &GlobError{pattern, start, "unclosed character class"}
+	}
+
+	switch pattern[i] {
+	case '-', ']':
+		return 0, &GlobError{pattern, i, fmt.Sprintf("unexpected '%c' in character class", pattern[i])}
+	case '\\':
+		if runtime.GOOS != "windows" {
+			i++
+			if i >= len(pattern) {
+				return 0, &GlobError{pattern, start, "unclosed character class"}
+			}
+		}
+	}
+	return i + 1, nil
+}
+
+// globTokenKind is the kind of a single element of a glob pattern.
+type globTokenKind int
+
+const (
+	globLiteral globTokenKind = iota
+	globAny
+	globStar
+	globClass
+)
+
+// globToken is a single element of a glob pattern. Every kind except
+// globStar matches exactly one character.
+type globToken struct {
+	kind    globTokenKind
+	char    rune
+	ranges  [][2]rune
+	negated bool
+}
+
+// parseGlob splits a valid glob pattern into its elements.
+func parseGlob(pattern string) []globToken {
+	runes := []rune(pattern)
+	tokens := make([]globToken, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			// Consecutive stars are equivalent to a single star
+			if len(tokens) == 0 || tokens[len(tokens)-1].kind != globStar {
+				tokens = append(tokens, globToken{kind: globStar})
+			}
+		case '?':
+			tokens = append(tokens, globToken{kind: globAny})
+		case '[':
+			token := globToken{kind: globClass}
+			i++
+			if i < len(runes) && runes[i] == '^' {
+				token.negated = true
+				i++
+			}
+			for ; i < len(runes) && (runes[i] != ']' || len(token.ranges) == 0); i++ {
+				lo := classRune(runes, &i)
+				hi := lo
+				if i+1 < len(runes) && runes[i+1] == '-' {
+					i += 2
+					hi = classRune(runes, &i)
+				}
+				token.ranges = append(token.ranges, [2]rune{lo, hi})
+			}
+			tokens = append(tokens, token)
+		case '\\':
+			if runtime.GOOS != "windows" && i+1 < len(runes) {
+				i++
+			}
+			tokens = append(tokens, globToken{kind: globLiteral, char: runes[i]})
+		default:
+			tokens = append(tokens, globToken{kind: globLiteral, char: runes[i]})
+		}
+	}
+	return tokens
+}
+
+// classRune returns the possibly escaped character of a character class at
+// the given index, advancing the index past any escape character.
+func classRune(runes []rune, i *int) rune {
+	if runes[*i] == '\\' && runtime.GOOS != "windows" && *i+1 < len(runes) {
+		*i++
+	}
+	return runes[*i]
+}
+
+// matches returns true if a single character token matches the character.
+func (t globToken) matches(c rune) bool {
+	switch t.kind {
+	case globLiteral:
+		return t.char == c
+	case globAny:
+		return c != filepath.Separator
+	case globClass:
+		for _, r := range t.ranges {
+			if c >= r[0] && c <= r[1] {
+				return !t.negated
+			}
+		}
+		return t.negated
+	default:
+		return false
+	}
+}
+
+// candidates returns characters at the boundaries of the set matched by a
+// single character token. If two tokens match a common character, one of
+// their combined candidates is such a character.
+func (t globToken) candidates() []rune {
+	switch t.kind {
+	case globLiteral:
+		return []rune{t.char}
+	case globClass:
+		runes := make([]rune, 0, len(t.ranges)*4)
+		for _, r := range t.ranges {
+			runes = append(runes, r[0]-1, r[0], r[1], r[1]+1)
+		}
+		return runes
+	default:
+		return []rune{0, filepath.Separator - 1, filepath.Separator + 1}
+	}
+}
+
+// overlaps returns true if two single character tokens match a common character.
+func (t globToken) overlaps(other globToken) bool {
+	for _, c := range append(t.candidates(), other.candidates()...) {
+		if c >= 0 && t.matches(c) && other.matches(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// globsIntersect returns true if there is a path matched by both glob
+// patterns. The patterns must be valid.
+func globsIntersect(a, b string) bool {
+	return tokensIntersect(parseGlob(a), parseGlob(b), 0, 0, make(map[[2]int]bool))
+}
+
+// tokensIntersect walks the product of the two patterns from the given
+// positions, returning true if both patterns can be completed by the same path.
+func tokensIntersect(a, b []globToken, i, j int, visited map[[2]int]bool) bool {
+	if visited[[2]int{i, j}] {
+		return false
+	}
+	visited[[2]int{i, j}] = true
+
+	switch {
+	case i == len(a) && j == len(b):
+		return true
+	case i < len(a) && a[i].kind == globStar:
+		// The star either matches nothing, or matches the next character of b.
+		// If b is also at a star, either star can be the one to end first.
+		if tokensIntersect(a, b, i+1, j, visited) {
+			return true
+		}
+		return j < len(b) && (b[j].kind == globStar || b[j].overlaps(globToken{kind: globAny})) &&
+			tokensIntersect(a, b, i, j+1, visited)
+	case j < len(b) && b[j].kind == globStar:
+		if tokensIntersect(a, b, i, j+1, visited) {
+			return true
+		}
+		return i < len(a) && a[i].overlaps(globToken{kind: globAny}) &&
+			tokensIntersect(a, b, i+1, j, visited)
+	case i == len(a) || j == len(b):
+		return false
+	default:
+		return a[i].overlaps(b[j]) && tokensIntersect(a, b, i+1, j+1, visited)
+	}
+}
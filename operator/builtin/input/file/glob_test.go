@@ -0,0 +1,112 @@
+package file
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateGlob(t *testing.T) {
+	cases := []struct {
+		name     string
+		pattern  string
+		position int
+		reason   string
+	}{
+		{"Literal", "/var/log/app.log", -1, ""},
+		{"Star", "/var/log/*.log", -1, ""},
+		{"Question", "/var/log/app?.log", -1, ""},
+		{"Class", "/var/log/app[0-9].log", -1, ""},
+		{"NegatedClass", "/var/log/app[^0-9].log", -1, ""},
+		{"MultiRangeClass", "/var/log/app[a-zA-Z_].log", -1, ""},
+		{"ClosingBracketOutsideClass", "/var/log/app].log", -1, ""},
+		{"UnclosedClass", "/var/log/app[0-9.log", 12, "unclosed character class"},
+		{"UnclosedClassAtEnd", "/var/log/app[", 12, "unclosed character class"},
+		{"UnclosedNegatedClass", "/var/log/[^a", 9, "unclosed character class"},
+		{"EmptyClass", "/var/log/[]", 10, "unexpected ']' in character class"},
+		{"LeadingDash", "/var/log/[-a]", 10, "unexpected '-' in character class"},
+		{"DanglingRange", "/var/log/[a-]", 12, "unexpected ']' in character class"},
+		{"UnclosedRange", "/var/log/[a-", 9, "unclosed character class"},
+	}
+
+	if runtime.GOOS != "windows" {
+		cases = append(cases, []struct {
+			name     string
+			pattern  string
+			position int
+			reason   string
+		}{
+			{"EscapedBracket", `/var/log/app\[1\].log`, -1, ""},
+			{"EscapedClassChar", `/var/log/app[\-].log`, -1, ""},
+			{"TrailingEscape", `/var/log/app\`, 12, "trailing escape character"},
+			{"TrailingEscapeInClass", `/var/log/[\`, 9, "unclosed character class"},
+		}...)
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateGlob(tc.pattern)
+			if tc.position < 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			globErr, ok := err.(*GlobError)
+			require.True(t, ok)
+			require.Equal(t, tc.pattern, globErr.Pattern)
+			require.Equal(t, tc.position, globErr.Position)
+			require.Equal(t, tc.reason, globErr.Reason)
+		})
+	}
+}
+
+func TestGetMatchesBadPattern(t *testing.T) {
+	operator, _, tempDir := newTestFileOperator(t, nil, nil)
+	temp := openTemp(t, tempDir)
+
+	matches := operator.getMatches([]string{tempDir + "/*"}, []string{"["})
+	require.Equal(t, []string{temp.Name()}, matches)
+	require.Equal(t, uint64(1), operator.GlobErrors())
+
+	matches = operator.getMatches([]string{tempDir + "/["}, nil)
+	require.Empty(t, matches)
+	require.Equal(t, uint64(2), operator.GlobErrors())
+}
+
+func TestGlobsIntersect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test patterns use unix path separators")
+	}
+
+	cases := []struct {
+		name     string
+		a        string
+		b        string
+		expected bool
+	}{
+		{"Equal", "/var/log/app.log", "/var/log/app.log", true},
+		{"DifferentLiterals", "/var/log/app.log", "/var/log/web.log", false},
+		{"StarAndPrefix", "/var/log/*.log", "/var/log/app*", true},
+		{"DifferentExtensions", "/var/log/*.log", "/var/log/*.txt", false},
+		{"StarDoesNotCrossSeparator", "/var/log/*", "/var/log/app/app.log", false},
+		{"StarPerDirectory", "/var/log/*/*.log", "/var/log/app/app.log", true},
+		{"StarsOnBothSides", "*a", "b*", true},
+		{"StarsWithDifferentSuffixes", "/var/*x*y", "/var/*y*x", false},
+		{"DisjointClasses", "/var/log/[abc]*", "/var/log/d*", false},
+		{"NegatedClass", "/var/log/[^abc]*", "/var/log/d*", true},
+		{"NegatedClassAndRange", "/var/log/[^a-z]*", "/var/log/[a-c]*", false},
+		{"QuestionLength", "/var/log/?", "/var/log/ab", false},
+		{"QuestionAndStar", "/var/log/??", "/var/log/a*", true},
+		{"EscapedStar", `/var/log/\*`, "/var/log/a", false},
+		{"EscapedStarMatchesStar", `/var/log/\*`, "/var/log/*", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, globsIntersect(tc.a, tc.b))
+			require.Equal(t, tc.expected, globsIntersect(tc.b, tc.a))
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/builtin/output/drop"
+	"go.uber.org/zap"
+)
+
+// HeaderConfig is the configuration of the header lines at the start of a file
+type HeaderConfig struct {
+	Pattern   string            `json:"pattern"             yaml:"pattern"`
+	Operators []operator.Config `json:"operators,omitempty" yaml:"operators,omitempty"`
+}
+
+// headerParser parses the header lines at the start of a file into labels
+type headerParser struct {
+	pattern   *regexp.Regexp
+	operators []operator.Operator
+}
+
+// build builds the operators that parse header lines. Each operator outputs
+// to the next, and the last to an operator that drops the parsed entry.
+func (c *HeaderConfig) build(context operator.BuildContext, operatorID string) (*headerParser, error) {
+	if c.Pattern == "" {
+		return nil, fmt.Errorf("missing required field 'header.pattern'")
+	}
+	pattern, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile header pattern: %s", err)
+	}
+
+	bc := context.WithSubNamespace(operatorID + "_header")
+	sinkID := bc.PrependNamespace("drop_output")
+	operators := make([]operator.Operator, 0, len(c.Operators)+1)
+	for i, config := range c.Operators {
+		outputIDs := []string{sinkID}
+		if i+1 < len(c.Operators) {
+			outputIDs = []string{bc.PrependNamespace(c.Operators[i+1].ID())}
+		}
+		ops, err := config.Build(bc.WithDefaultOutputIDs(outputIDs))
+		if err != nil {
+			return nil, fmt.Errorf("build header operator '%s': %s", config.ID(), err)
+		}
+		operators = append(operators, ops...)
+	}
+
+	sink, err := drop.NewDropOutputConfig("drop_output").Build(bc)
+	if err != nil {
+		return nil, err
+	}
+	operators = append(operators, sink...)
+
+	for _, op := range operators {
+		if !op.CanOutput() {
+			continue
+		}
+		if err := op.SetOutputs(operators); err != nil {
+			return nil, fmt.Errorf("header operator '%s': %s", op.ID(), err)
+		}
+	}
+
+	return &headerParser{
+		pattern:   pattern,
+		operators: operators,
+	}, nil
+}
+
+// Start starts the header operators
+func (h *headerParser) Start() error {
+	for _, op := range h.operators {
+		if err := op.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops the header operators
+func (h *headerParser) Stop() {
+	for _, op := range h.operators {
+		_ = op.Stop()
+	}
+}
+
+// parse parses a header line into labels. The record of the parsed line
+// becomes labels: each field of a map, or the whole record as the label
+// `header` when no operator parsed it into a map.
+func (h *headerParser) parse(ctx context.Context, line string) (map[string]string, error) {
+	e := entry.New()
+	e.Record = line
+	if err := h.operators[0].Process(ctx, e); err != nil {
+		return nil, err
+	}
+
+	record, ok := e.Record.(map[string]interface{})
+	if !ok {
+		return map[string]string{"header": labelValue(e.Record)}, nil
+	}
+	labels := make(map[string]string, len(record))
+	for key, value := range record {
+		labels[key] = labelValue(value)
+	}
+	return labels, nil
+}
+
+// labelValue converts a parsed value to a label value, encoding values that
+// are not strings as JSON
+func labelValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
+
+// readHeader parses the header lines of a file that is read from an offset
+// past them, such as when the file input starts at the end of a file
+func (f *Reader) readHeader(ctx context.Context) {
+	section := io.NewSectionReader(f.file, f.HeaderEnd, f.Offset-f.HeaderEnd)
+	scanner := newLimitedPositionalScanner(section, f.encoding.sizeLimit, f.HeaderEnd, f.encoding.splitFunc)
+	for !f.HeaderRead && scanner.Scan() {
+		f.checkHeader(ctx, scanner.Bytes(), f.HeaderEnd, scanner.Pos())
+	}
+	if err := getScannerError(scanner); err != nil {
+		f.Errorw("Failed to read header", zap.Error(err))
+	}
+	if !f.HeaderRead {
+		f.HeaderEnd = f.Offset
+	}
+}
+
+// checkHeader returns true if a token that starts at start is a header line,
+// in which case it is parsed into the header labels of the file. The header
+// ends at the first line that does not match the header pattern.
+func (f *Reader) checkHeader(ctx context.Context, token []byte, start, end int64) bool {
+	header := f.fileInput.header
+	if header == nil || f.HeaderRead {
+		return false
+	}
+
+	line, err := f.decode(token)
+	if err != nil || start != f.HeaderEnd || !header.pattern.MatchString(line) {
+		f.HeaderRead = true
+		return false
+	}
+
+	f.HeaderEnd = end
+	labels, err := header.parse(ctx, line)
+	if err != nil {
+		f.Warnw("Failed to parse header line", zap.Error(err))
+		return true
+	}
+	if f.HeaderLabels == nil {
+		f.HeaderLabels = make(map[string]string, len(labels))
+	}
+	for key, value := range labels {
+		f.HeaderLabels[key] = value
+	}
+	f.labels = nil
+	return true
+}
+
+// resetHeader forgets the header of a file that is read again from the beginning
+func (f *Reader) resetHeader() {
+	f.HeaderLabels = nil
+	f.labels = nil
+	f.HeaderEnd = 0
+	f.HeaderRead = false
+}
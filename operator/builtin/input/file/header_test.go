@@ -0,0 +1,162 @@
+package file
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/builtin/parser/regex"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newCSVHeaderConfig() *HeaderConfig {
+	parser := regex.NewRegexParserConfig("columns")
+	parser.Regex = "^(?P<header_columns>.*)$"
+	return &HeaderConfig{
+		Pattern:   "^timestamp,",
+		Operators: []operator.Config{{Builder: parser}},
+	}
+}
+
+func TestBuildHeader(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		header   *HeaderConfig
+		expected string
+	}{
+		{
+			"MissingPattern",
+			&HeaderConfig{},
+			"missing required field 'header.pattern'",
+		},
+		{
+			"InvalidPattern",
+			&HeaderConfig{Pattern: "("},
+			"compile header pattern",
+		},
+		{
+			"InvalidOperator",
+			&HeaderConfig{
+				Pattern:   "^#",
+				Operators: []operator.Config{{Builder: regex.NewRegexParserConfig("columns")}},
+			},
+			"build header operator 'columns'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newDefaultConfig(testutil.NewTempDir(t))
+			cfg.Header = tc.header
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
+
+// HeaderLabels tests that the labels parsed from the header line of a file
+// are added to each of its entries, and that the header line is not emitted
+func TestHeaderLabels(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Header = newCSVHeaderConfig()
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "timestamp,level,message\n2020-01-01,info,started\n")
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	e := waitForOne(t, logReceived)
+	require.Equal(t, "2020-01-01,info,started", e.Record)
+	require.Equal(t, "timestamp,level,message", e.Labels["header_columns"])
+
+	// The header is kept after a restart
+	require.NoError(t, operator.Stop())
+	require.NoError(t, operator.Start())
+
+	writeString(t, temp, "2020-01-01,warn,stopping\n")
+	e = waitForOne(t, logReceived)
+	require.Equal(t, "2020-01-01,warn,stopping", e.Record)
+	require.Equal(t, "timestamp,level,message", e.Labels["header_columns"])
+	expectNoMessages(t, logReceived)
+}
+
+// HeaderStartAtEnd tests that the header of a file that is read from its end
+// is read from the beginning of the file
+func TestHeaderStartAtEnd(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Header = newCSVHeaderConfig()
+		cfg.StartAt = "end"
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "timestamp,level,message\n2020-01-01,info,started\n")
+
+	operator.poll(context.Background())
+	defer operator.Stop()
+	expectNoMessages(t, logReceived)
+
+	writeString(t, temp, "2020-01-01,warn,stopping\n")
+	operator.poll(context.Background())
+	e := waitForOne(t, logReceived)
+	require.Equal(t, "2020-01-01,warn,stopping", e.Record)
+	require.Equal(t, "timestamp,level,message", e.Labels["header_columns"])
+}
+
+// HeaderRotation tests that a file that replaces a rotated file is labeled
+// with its own header
+func TestHeaderRotation(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Header = newCSVHeaderConfig()
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "timestamp,level,message\n2020-01-01,info,started\n")
+	operator.poll(context.Background())
+	defer operator.Stop()
+
+	e := waitForOne(t, logReceived)
+	require.Equal(t, "timestamp,level,message", e.Labels["header_columns"])
+
+	require.NoError(t, temp.Close())
+	require.NoError(t, os.Rename(temp.Name(), temp.Name()+".1"))
+	temp = openFile(t, temp.Name())
+	writeString(t, temp, "timestamp,host,level,message\n2020-01-02,web1,info,started\n")
+	operator.poll(context.Background())
+
+	e = waitForOne(t, logReceived)
+	require.Equal(t, "2020-01-02,web1,info,started", e.Record)
+	require.Equal(t, "timestamp,host,level,message", e.Labels["header_columns"])
+	expectNoMessages(t, logReceived)
+}
+
+// HeaderWithoutOperators tests that header lines are added as the label
+// `header` when there are no operators to parse them, and that a header of
+// several lines ends at the first line that does not match the pattern
+func TestHeaderWithoutOperators(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.Header = &HeaderConfig{Pattern: "^#"}
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "#version: 1\n#fields: a b\nentry1\n#not a header\n")
+	operator.poll(context.Background())
+	defer operator.Stop()
+
+	e := waitForOne(t, logReceived)
+	require.Equal(t, "entry1", e.Record)
+	require.Equal(t, "#fields: a b", e.Labels["header"])
+	e = waitForOne(t, logReceived)
+	require.Equal(t, "#not a header", e.Record)
+	expectNoMessages(t, logReceived)
+}
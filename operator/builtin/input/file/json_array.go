@@ -0,0 +1,203 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/observiq/stanza/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// ReadModeLines reads each line, or each multiline entry, as an entry
+	ReadModeLines = "lines"
+	// ReadModeJSONArray reads a file that holds a single JSON array, and
+	// reads each element of the array as an entry
+	ReadModeJSONArray = "json_array"
+)
+
+// NewJSONArraySplitFunc splits a JSON array into its elements, without
+// reading the whole array into memory. If start is true, the data starts at
+// the beginning of the file, where the array is opened. Otherwise, the data
+// starts after an element of the array that was already read.
+//
+// The separators before an element are consumed with the element, so that
+// the position after each token is the end of an element. An element that is
+// larger than maxSize is returned truncated, so that it fails to parse, and
+// the rest of it is skipped.
+func NewJSONArraySplitFunc(start bool, maxSize int) bufio.SplitFunc {
+	opened := !start
+	closed := false
+	var skipping *jsonValueScanner
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		// Anything after the end of the array is ignored
+		if closed {
+			return len(data), data[len(data):], nil
+		}
+
+		// The rest of an element that was too large is consumed without a token
+		if skipping != nil {
+			n, done := skipping.scan(data)
+			if done {
+				skipping = nil
+				return n, data[n:n], nil
+			}
+			return len(data), data[len(data):], nil
+		}
+
+		i := skipJSONSpace(data, 0)
+		if !opened {
+			if i == len(data) {
+				return 0, nil, nil
+			}
+			if data[i] != '[' {
+				return 0, nil, errors.NewError(
+					"file does not hold a JSON array",
+					"ensure that files read with read_mode json_array start with '['",
+				)
+			}
+			i = skipJSONSpace(data, i+1)
+		}
+		for i < len(data) && data[i] == ',' {
+			i = skipJSONSpace(data, i+1)
+		}
+		if i == len(data) {
+			return 0, nil, nil
+		}
+
+		if data[i] == ']' {
+			opened, closed = true, true
+			return len(data), data[len(data):], nil
+		}
+
+		scanner := &jsonValueScanner{}
+		n, done := scanner.scan(data[i:])
+		if n == 0 {
+			// A stray closing bracket is a malformed element of its own
+			n, done = 1, true
+		}
+		if !done {
+			if maxSize > 0 && len(data) >= maxSize {
+				opened = true
+				skipping = scanner
+				return len(data), data[i:], nil
+			}
+			return 0, nil, nil
+		}
+
+		opened = true
+		return i + n, data[i : i+n], nil
+	}
+}
+
+// jsonValueScanner finds the end of a JSON value. The scan of a value that
+// continues past the end of the data can be resumed with the next data.
+type jsonValueScanner struct {
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// scan returns the length of the value in data, and true if the value ends
+// in data. The end of a number or literal is found at the first separator
+// after it, so it is not found at the end of the data.
+func (s *jsonValueScanner) scan(data []byte) (int, bool) {
+	for i, c := range data {
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.inString = false
+				if s.depth == 0 {
+					return i + 1, true
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			s.inString = true
+		case '{', '[':
+			s.depth++
+		case '}', ']':
+			if s.depth == 0 {
+				return i, true
+			}
+			s.depth--
+			if s.depth == 0 {
+				return i + 1, true
+			}
+		case ',', ' ', '\t', '\r', '\n':
+			if s.depth == 0 {
+				return i, true
+			}
+		}
+	}
+	return len(data), false
+}
+
+// skipJSONSpace returns the index of the first byte at or after i that is
+// not JSON whitespace
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// emitArrayElement parses an element of a JSON array and emits it as an
+// entry. A malformed element is counted as errored and skipped, and the rest
+// of the array is still read.
+func (f *Reader) emitArrayElement(ctx context.Context, element []byte) {
+	if len(element) == 0 {
+		return
+	}
+
+	index := f.ArrayIndex
+	f.ArrayIndex++
+
+	record, err := f.parseArrayElement(element)
+	if err != nil {
+		f.fileInput.OperatorStats().AddErrored(1)
+		f.Warnw("Skipping malformed JSON array element", "index", index, "offset", f.Offset, zap.Error(err))
+		return
+	}
+
+	if err := f.emitRecord(ctx, record); err != nil {
+		f.Error("Failed to emit entry", zap.Error(err))
+	}
+}
+
+// parseArrayElement decodes and parses an element of a JSON array
+func (f *Reader) parseArrayElement(element []byte) (interface{}, error) {
+	if max := f.fileInput.MaxLogSize; max > 0 && len(element) >= max {
+		return nil, fmt.Errorf("element is larger than max_log_size of %d bytes", max)
+	}
+
+	msg, err := f.decode(element)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %s", err)
+	}
+
+	var record interface{}
+	if err := json.Unmarshal([]byte(msg), &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
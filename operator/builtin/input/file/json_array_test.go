@@ -0,0 +1,246 @@
+package file
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestJSONArraySplitFunc(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		input    string
+		start    bool
+		maxSize  int
+		expected []string
+		errorMsg string
+	}{
+		{
+			"Objects",
+			`[{"a":1},{"b":[2,3]}]`,
+			true,
+			0,
+			[]string{`{"a":1}`, `{"b":[2,3]}`},
+			"",
+		},
+		{
+			"Scalars",
+			`[ 1, "two", true, null, -3.5e2 ]`,
+			true,
+			0,
+			[]string{`1`, `"two"`, `true`, `null`, `-3.5e2`},
+			"",
+		},
+		{
+			"Whitespace",
+			"[\n  {\"a\": \"x\"},\n  {\"b\": \"y\"}\n]\n",
+			true,
+			0,
+			[]string{`{"a": "x"}`, `{"b": "y"}`},
+			"",
+		},
+		{
+			"StringsWithBrackets",
+			`[{"a":"}]\"{["},"[,]"]`,
+			true,
+			0,
+			[]string{`{"a":"}]\"{["}`, `"[,]"`},
+			"",
+		},
+		{
+			"NestedArrays",
+			`[[1,[2]],[]]`,
+			true,
+			0,
+			[]string{`[1,[2]]`, `[]`},
+			"",
+		},
+		{
+			"Empty",
+			`[]`,
+			true,
+			0,
+			[]string{},
+			"",
+		},
+		{
+			"Resumed",
+			`,{"b":2}]`,
+			false,
+			0,
+			[]string{`{"b":2}`},
+			"",
+		},
+		{
+			"Unterminated",
+			`[{"a":1},{"b":`,
+			true,
+			0,
+			[]string{`{"a":1}`},
+			"",
+		},
+		{
+			"UnterminatedScalar",
+			`[1,2`,
+			true,
+			0,
+			[]string{`1`},
+			"",
+		},
+		{
+			"IgnoresTrailingData",
+			`[1] [2]`,
+			true,
+			0,
+			[]string{`1`},
+			"",
+		},
+		{
+			"MalformedElements",
+			`[{"a":},}, 2]`,
+			true,
+			0,
+			[]string{`{"a":}`, `}`, `2`},
+			"",
+		},
+		{
+			"TooLarge",
+			`[{"a":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},{"b":1}]`,
+			true,
+			16,
+			[]string{`{"a":"aaaaaaaaa`, `{"b":1}`},
+			"",
+		},
+		{
+			"NotArray",
+			`{"a":1}`,
+			true,
+			0,
+			[]string{},
+			"file does not hold a JSON array",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Reading one byte at a time splits elements across reads
+			for _, reader := range []io.Reader{strings.NewReader(tc.input), iotest.OneByteReader(strings.NewReader(tc.input))} {
+				scanner := NewPositionalScanner(reader, tc.maxSize, 0, NewJSONArraySplitFunc(tc.start, tc.maxSize))
+				tokens := []string{}
+				for scanner.Scan() {
+					if len(scanner.Bytes()) > 0 {
+						tokens = append(tokens, scanner.Text())
+					}
+				}
+
+				if tc.errorMsg != "" {
+					require.Error(t, scanner.Err())
+					require.Contains(t, scanner.Err().Error(), tc.errorMsg)
+					continue
+				}
+				require.NoError(t, scanner.Err())
+				require.Equal(t, tc.expected, tokens)
+			}
+		})
+	}
+}
+
+func TestJSONArraySplitFuncPositions(t *testing.T) {
+	t.Parallel()
+
+	// The position after each element is its end, so a read resumed from it
+	// starts at the separator before the next element
+	input := "[\n {\"a\":1},\n {\"b\":2}\n]\n"
+	scanner := NewPositionalScanner(strings.NewReader(input), 0, 0, NewJSONArraySplitFunc(true, 0))
+	positions := []int64{}
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			positions = append(positions, scanner.Pos())
+		}
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []int64{10, 20}, positions)
+	require.Equal(t, int64(len(input)), scanner.Pos())
+	require.Equal(t, ",\n {\"b\":2}\n]\n", input[10:])
+}
+
+func TestJSONArray(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.ReadMode = ReadModeJSONArray
+	}, nil)
+	core, logs := observer.New(zap.WarnLevel)
+	operator.SugaredLogger = zap.New(core).Sugar()
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, `[{"user":"a","action":"login"},{"user":"b",},{"user":"c","action":"logout"}`)
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	// The malformed element is skipped, and the rest of the array is read
+	e := waitForOne(t, logReceived)
+	require.Equal(t, map[string]interface{}{"user": "a", "action": "login"}, e.Record)
+	require.Equal(t, filepath.Base(temp.Name()), e.Labels["file_name"])
+	e = waitForOne(t, logReceived)
+	require.Equal(t, map[string]interface{}{"user": "c", "action": "logout"}, e.Record)
+	require.Equal(t, 1, logs.FilterMessage("Skipping malformed JSON array element").Len())
+
+	// Elements appended to the array are read as they are written
+	writeString(t, temp, `, "done"]`)
+	e = waitForOne(t, logReceived)
+	require.Equal(t, "done", e.Record)
+	expectNoMessages(t, logReceived)
+}
+
+func TestJSONArrayAfterRestart(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.ReadMode = ReadModeJSONArray
+	}, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, `[{"n":0},{"n":1}`)
+
+	require.NoError(t, operator.Start())
+	waitForRecords(t, logReceived, []interface{}{
+		map[string]interface{}{"n": float64(0)},
+		map[string]interface{}{"n": float64(1)},
+	})
+	require.NoError(t, operator.Stop())
+
+	// The restarted operator resumes in the middle of the array, from the
+	// offset and index of the next element
+	writeString(t, temp, `,{"n":2}]`)
+	require.NoError(t, operator.Start())
+	waitForRecords(t, logReceived, []interface{}{
+		map[string]interface{}{"n": float64(2)},
+	})
+	expectNoMessages(t, logReceived)
+
+	require.NoError(t, operator.Stop())
+
+	knownFiles, err := DecodeKnownFiles(operator.persist.Get(KnownFilesKey))
+	require.NoError(t, err)
+	require.NotEmpty(t, knownFiles)
+	require.Equal(t, int64(3), knownFiles[len(knownFiles)-1].ArrayIndex)
+}
+
+// waitForRecords waits for entries with the expected records, in order
+func waitForRecords(t *testing.T, c chan *entry.Entry, expected []interface{}) {
+	for _, record := range expected {
+		require.Equal(t, record, waitForOne(t, c).Record)
+	}
+}
@@ -0,0 +1,123 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// KnownFilesKey is the key under which a file input saves its known files
+const KnownFilesKey = "knownFiles"
+
+// KnownFile is the state of a file that is saved between polls and restarts
+type KnownFile struct {
+	Fingerprint *Fingerprint
+	Offset      int64
+	Path        string
+
+	// Complete is set once a compressed file has been read to the end.
+	// Compressed files are not expected to change, so they are not read again.
+	Complete bool
+
+	// HeaderLabels are the labels parsed from the header lines of the file,
+	// which end at HeaderEnd. HeaderRead is set once the first line after the
+	// header has been read.
+	HeaderLabels map[string]string `json:",omitempty"`
+	HeaderEnd    int64             `json:",omitempty"`
+	HeaderRead   bool              `json:",omitempty"`
+
+	// ArrayIndex is the index of the next element of a file read with
+	// read_mode json_array, whose offset is the end of the previous element
+	ArrayIndex int64 `json:",omitempty"`
+
+	// ProfileOffsets are the offsets up to which each output profile has
+	// written the entries of the file. Offset is the lowest of them.
+	ProfileOffsets map[string]int64 `json:",omitempty"`
+}
+
+// knownFilesVersion is the version of the saved known files. Version 1 saved
+// the number of files without a header, and version 2 added the offsets of
+// output profiles.
+const knownFilesVersion = 2
+
+// knownFilesHeader precedes the known files saved since version 2
+type knownFilesHeader struct {
+	Version int
+	Count   int
+}
+
+// EncodeKnownFiles encodes the known files of a file input to be saved. The
+// saved value holds the number of files, followed by each file as JSON. Files
+// with the offsets of output profiles are saved with a header that holds the
+// version and the number of files, so that an earlier version of the agent
+// does not resume from offsets it would misread.
+func EncodeKnownFiles(knownFiles []*KnownFile) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	versioned := false
+	for _, knownFile := range knownFiles {
+		if knownFile.ProfileOffsets != nil {
+			versioned = true
+			break
+		}
+	}
+
+	// Encode the number of known files
+	var count interface{} = len(knownFiles)
+	if versioned {
+		count = knownFilesHeader{Version: knownFilesVersion, Count: len(knownFiles)}
+	}
+	if err := enc.Encode(count); err != nil {
+		return nil, err
+	}
+
+	// Encode each known file
+	for _, knownFile := range knownFiles {
+		if err := enc.Encode(knownFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeKnownFiles decodes the known files saved by EncodeKnownFiles
+func DecodeKnownFiles(encoded []byte) ([]*KnownFile, error) {
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+
+	// Decode the number of entries, or the header that holds it
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return nil, fmt.Errorf("decoding file count: %w", err)
+	}
+	var knownFileCount int
+	if bytes.HasPrefix(first, []byte("{")) {
+		var header knownFilesHeader
+		if err := json.Unmarshal(first, &header); err != nil {
+			return nil, fmt.Errorf("decoding header: %w", err)
+		}
+		if header.Version < 2 || header.Version > knownFilesVersion {
+			return nil, fmt.Errorf("decoding header: unsupported version %d", header.Version)
+		}
+		knownFileCount = header.Count
+	} else if err := json.Unmarshal(first, &knownFileCount); err != nil {
+		return nil, fmt.Errorf("decoding file count: %w", err)
+	}
+	if knownFileCount < 0 {
+		return nil, fmt.Errorf("decoding file count: invalid count %d", knownFileCount)
+	}
+
+	// Decode each of the known files. The count is not trusted for the
+	// capacity, since a corrupt value could hold any count.
+	knownFiles := make([]*KnownFile, 0, 10)
+	for i := 0; i < knownFileCount; i++ {
+		knownFile := &KnownFile{}
+		if err := dec.Decode(knownFile); err != nil {
+			return nil, fmt.Errorf("decoding file %d: %w", i, err)
+		}
+		knownFiles = append(knownFiles, knownFile)
+	}
+
+	return knownFiles, nil
+}
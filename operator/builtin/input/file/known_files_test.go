@@ -0,0 +1,153 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeKnownFiles(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		encoded  string
+		expected []*KnownFile
+		errorMsg string
+	}{
+		{
+			"Empty",
+			"0\n",
+			[]*KnownFile{},
+			"",
+		},
+		{
+			"Files",
+			`2
+{"Fingerprint":{"FirstBytes":"Zmlyc3Q="},"Offset":6,"Path":"/var/log/first.log","Complete":false}
+{"Fingerprint":{"FirstBytes":"c2Vjb25k"},"Offset":7,"Path":"/var/log/second.log","Complete":false,"HeaderLabels":{"header":"#v1"},"HeaderEnd":4,"HeaderRead":true}
+`,
+			[]*KnownFile{
+				{
+					Fingerprint: &Fingerprint{FirstBytes: []byte("first")},
+					Offset:      6,
+					Path:        "/var/log/first.log",
+				},
+				{
+					Fingerprint:  &Fingerprint{FirstBytes: []byte("second")},
+					Offset:       7,
+					Path:         "/var/log/second.log",
+					HeaderLabels: map[string]string{"header": "#v1"},
+					HeaderEnd:    4,
+					HeaderRead:   true,
+				},
+			},
+			"",
+		},
+		{
+			"Version2",
+			`{"Version":2,"Count":1}
+{"Fingerprint":{"FirstBytes":"Zmlyc3Q="},"Offset":6,"Path":"/var/log/first.log","Complete":false,"ProfileOffsets":{"parsed":6,"raw":9}}
+`,
+			[]*KnownFile{
+				{
+					Fingerprint:    &Fingerprint{FirstBytes: []byte("first")},
+					Offset:         6,
+					Path:           "/var/log/first.log",
+					ProfileOffsets: map[string]int64{"parsed": 6, "raw": 9},
+				},
+			},
+			"",
+		},
+		{
+			"UnsupportedVersion",
+			`{"Version":3,"Count":0}`,
+			nil,
+			"unsupported version 3",
+		},
+		{
+			"NotJSON",
+			"not json",
+			nil,
+			"decoding file count",
+		},
+		{
+			"NegativeCount",
+			"-1\n",
+			nil,
+			"invalid count -1",
+		},
+		{
+			"MissingFile",
+			"2\n{\"Offset\":6,\"Path\":\"/var/log/first.log\"}\n",
+			nil,
+			"decoding file 1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			knownFiles, err := DecodeKnownFiles([]byte(tc.encoded))
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, knownFiles)
+		})
+	}
+}
+
+func TestEncodeKnownFiles(t *testing.T) {
+	t.Parallel()
+
+	knownFiles := []*KnownFile{
+		{
+			Fingerprint: &Fingerprint{FirstBytes: []byte("first")},
+			Offset:      6,
+			Path:        "/var/log/first.log",
+		},
+		{
+			Fingerprint:  &Fingerprint{FirstBytes: []byte("second")},
+			Offset:       7,
+			Path:         "/var/log/second.log",
+			HeaderLabels: map[string]string{"header": "#v1"},
+			HeaderEnd:    4,
+			HeaderRead:   true,
+		},
+	}
+
+	encoded, err := EncodeKnownFiles(knownFiles)
+	require.NoError(t, err)
+	decoded, err := DecodeKnownFiles(encoded)
+	require.NoError(t, err)
+	require.Equal(t, knownFiles, decoded)
+}
+
+func TestEncodeKnownFilesVersion(t *testing.T) {
+	t.Parallel()
+
+	knownFiles := []*KnownFile{
+		{
+			Fingerprint: &Fingerprint{FirstBytes: []byte("first")},
+			Offset:      6,
+			Path:        "/var/log/first.log",
+		},
+	}
+
+	// Files without profile offsets are saved in the format of version 1
+	encoded, err := EncodeKnownFiles(knownFiles)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(encoded), "1\n"))
+
+	knownFiles[0].ProfileOffsets = map[string]int64{"raw": 9, "parsed": 6}
+	encoded, err = EncodeKnownFiles(knownFiles)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(encoded), `{"Version":2,"Count":1}`))
+
+	decoded, err := DecodeKnownFiles(encoded)
+	require.NoError(t, err)
+	require.Equal(t, knownFiles, decoded)
+}
@@ -12,12 +12,13 @@ import (
 // tokens that start with a match to the regex pattern provided
 func NewLineStartSplitFunc(re *regexp.Regexp) bufio.SplitFunc {
 	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		firstLoc := re.FindIndex(data)
-		if firstLoc == nil {
+		// Both matches are found in the whole buffer so that anchors such as ^
+		// only match at the start of a line, and not where the search resumes
+		locs := re.FindAllIndex(data, 2)
+		if len(locs) == 0 {
 			return 0, nil, nil // read more data and try again.
 		}
-		firstMatchStart := firstLoc[0]
-		firstMatchEnd := firstLoc[1]
+		firstMatchStart := locs[0][0]
 
 		if firstMatchStart != 0 {
 			// the beginning of the file does not match the start pattern, so return a token up to the first match so we don't lose data
@@ -26,17 +27,10 @@ func NewLineStartSplitFunc(re *regexp.Regexp) bufio.SplitFunc {
 			return
 		}
 
-		if firstMatchEnd == len(data) {
-			// the first match goes to the end of the buffer, so don't look for a second match
-			return 0, nil, nil
-		}
-
-		secondLocOffset := firstMatchEnd + 1
-		secondLoc := re.FindIndex(data[secondLocOffset:])
-		if secondLoc == nil {
+		if len(locs) < 2 {
 			return 0, nil, nil // read more data and try again
 		}
-		secondMatchStart := secondLoc[0] + secondLocOffset
+		secondMatchStart := locs[1][0]
 
 		advance = secondMatchStart                     // start scanning at the beginning of the second match
 		token = data[firstMatchStart:secondMatchStart] // the token begins at the first match, and ends at the beginning of the second match
@@ -85,7 +79,7 @@ func NewNewlineSplitFunc(encoding encoding.Encoding) (bufio.SplitFunc, error) {
 			return 0, nil, nil
 		}
 
-		if i := bytes.Index(data, newline); i >= 0 {
+		if i := indexNewline(data, newline); i >= 0 {
 			// We have a full newline-terminated line.
 			return i + len(newline), bytes.TrimSuffix(data[:i], carriageReturn), nil
 		}
@@ -95,6 +89,23 @@ func NewNewlineSplitFunc(encoding encoding.Encoding) (bufio.SplitFunc, error) {
 	}, nil
 }
 
+// indexNewline returns the index of the first newline in data, or -1 if there
+// is none. The newline of an encoding such as utf-16 is only matched at the
+// start of a character, since the bytes of two adjacent characters can hold it.
+func indexNewline(data, newline []byte) int {
+	for from := 0; ; {
+		i := bytes.Index(data[from:], newline)
+		if i < 0 {
+			return -1
+		}
+		i += from
+		if i%len(newline) == 0 {
+			return i
+		}
+		from = i + 1
+	}
+}
+
 func encodedNewline(encoding encoding.Encoding) ([]byte, error) {
 	out := make([]byte, 10)
 	nDst, _, err := encoding.NewEncoder().Transform(out, []byte{'\n'}, true)
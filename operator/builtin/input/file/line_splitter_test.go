@@ -108,6 +108,15 @@ func TestLineStartSplitFunc(t *testing.T) {
 				`LOGSTART 123 ` + string(generatedByteSliceOfLength(10000)),
 			},
 		},
+		{
+			Name:    "AnchoredPatternMidLine",
+			Pattern: `^LOGSTART \d+ `,
+			Raw:     []byte("LOGSTART 123 log1 LOGSTART 234 mid\ncontinued\nLOGSTART 345 log2\nLOGSTART 456 "),
+			ExpectedTokenized: []string{
+				"LOGSTART 123 log1 LOGSTART 234 mid\ncontinued\n",
+				"LOGSTART 345 log2\n",
+			},
+		},
 		{
 			Name:    "ErrTooLong",
 			Pattern: `LOGSTART \d+ `,
@@ -339,6 +348,12 @@ func TestNewlineSplitFunc_Encodings(t *testing.T) {
 				{0, 108, 0, 111, 0, 103, 0, 50}, // log2
 			},
 		},
+		{
+			"MisalignedNewlineUTF16",
+			unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+			[]byte{65, 10, 0, 78, 10, 0}, // \u0a41\u4e00\n
+			[][]byte{{65, 10, 0, 78}},
+		},
 		{
 			"MultiCarriageReturnUTF16",
 			unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
@@ -0,0 +1,128 @@
+package file
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxLockedBackoff is the longest time between attempts to open a locked file
+const maxLockedBackoff = 5 * time.Minute
+
+// lockedReason is reported in the status of the operator for each locked file
+const lockedReason = "locked by another process"
+
+// lockedFiles tracks the files that could not be opened because another
+// process holds an exclusive lock on them. Each locked file is skipped until
+// its next attempt, and the interval between attempts doubles up to
+// maxLockedBackoff, so that a file that stays locked is not retried on
+// every poll.
+type lockedFiles struct {
+	minBackoff time.Duration
+	now        func() time.Time
+
+	mux   sync.Mutex
+	files map[string]*lockedFile
+}
+
+type lockedFile struct {
+	since   time.Time
+	retryAt time.Time
+	backoff time.Duration
+}
+
+func newLockedFiles(minBackoff time.Duration) *lockedFiles {
+	return &lockedFiles{
+		minBackoff: minBackoff,
+		now:        time.Now,
+		files:      make(map[string]*lockedFile),
+	}
+}
+
+// skip returns true if a path is locked and is not due for another attempt
+func (l *lockedFiles) skip(path string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	file, ok := l.files[path]
+	return ok && l.now().Before(file.retryAt)
+}
+
+// isLocked returns true if a path could not be opened on its last attempt
+func (l *lockedFiles) isLocked(path string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	_, ok := l.files[path]
+	return ok
+}
+
+// lock records a failed attempt to open a locked path. It returns true if the
+// path was not already locked.
+func (l *lockedFiles) lock(path string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := l.now()
+	file, ok := l.files[path]
+	if !ok {
+		file = &lockedFile{since: now, backoff: l.minBackoff}
+		l.files[path] = file
+	} else {
+		file.backoff *= 2
+		if file.backoff > maxLockedBackoff {
+			file.backoff = maxLockedBackoff
+		}
+	}
+	file.retryAt = now.Add(file.backoff)
+	return !ok
+}
+
+// unlock forgets a path that was opened. It returns true if the path was locked.
+func (l *lockedFiles) unlock(path string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	_, ok := l.files[path]
+	delete(l.files, path)
+	return ok
+}
+
+// retain forgets the locked paths that no longer match the includes
+func (l *lockedFiles) retain(paths []string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if len(l.files) == 0 {
+		return
+	}
+
+	matched := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		matched[path] = true
+	}
+	for path := range l.files {
+		if !matched[path] {
+			delete(l.files, path)
+		}
+	}
+}
+
+// status describes each locked path, or returns nil if no path is locked
+func (l *lockedFiles) status() []map[string]interface{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if len(l.files) == 0 {
+		return nil
+	}
+
+	status := make([]map[string]interface{}, 0, len(l.files))
+	for path, file := range l.files {
+		status = append(status, map[string]interface{}{
+			"path":     path,
+			"reason":   lockedReason,
+			"since":    file.since,
+			"retry_at": file.retryAt,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i]["path"].(string) < status[j]["path"].(string)
+	})
+	return status
+}
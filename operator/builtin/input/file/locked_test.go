@@ -0,0 +1,63 @@
+package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockedFilesBackoff(t *testing.T) {
+	now := time.Unix(0, 0)
+	locked := newLockedFiles(time.Second)
+	locked.now = func() time.Time { return now }
+
+	require.False(t, locked.skip("a.log"))
+	require.True(t, locked.lock("a.log"))
+	require.True(t, locked.skip("a.log"))
+
+	// The interval between attempts doubles while the file stays locked
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for _, backoff := range expected {
+		now = now.Add(locked.files["a.log"].backoff)
+		require.False(t, locked.skip("a.log"))
+		require.False(t, locked.lock("a.log"))
+		require.Equal(t, backoff, locked.files["a.log"].backoff)
+	}
+
+	// The interval is capped
+	for i := 0; i < 20; i++ {
+		locked.lock("a.log")
+	}
+	require.Equal(t, maxLockedBackoff, locked.files["a.log"].backoff)
+
+	require.True(t, locked.unlock("a.log"))
+	require.False(t, locked.unlock("a.log"))
+	require.False(t, locked.skip("a.log"))
+}
+
+func TestLockedFilesStatus(t *testing.T) {
+	now := time.Unix(0, 0)
+	locked := newLockedFiles(time.Second)
+	locked.now = func() time.Time { return now }
+	require.Nil(t, locked.status())
+
+	locked.lock("b.log")
+	locked.lock("a.log")
+	require.Equal(t, []map[string]interface{}{
+		{"path": "a.log", "reason": lockedReason, "since": now, "retry_at": now.Add(time.Second)},
+		{"path": "b.log", "reason": lockedReason, "since": now, "retry_at": now.Add(time.Second)},
+	}, locked.status())
+
+	// Files that no longer match are forgotten
+	locked.retain([]string{"b.log"})
+	require.Len(t, locked.status(), 1)
+	locked.retain(nil)
+	require.Nil(t, locked.status())
+}
+
+func TestIsLockedErrorNotFound(t *testing.T) {
+	_, err := openLogFile("does-not-exist.log", false)
+	require.Error(t, err)
+	require.False(t, isLockedError(err))
+}
@@ -0,0 +1,82 @@
+package file
+
+import (
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+)
+
+// fileMetadata is the metadata of a file that is added to its entries as labels
+type fileMetadata struct {
+	resolvedPath string
+	mtime        string
+	uid          string
+	gid          string
+}
+
+// readMetadata reads the metadata of the file that is added to its entries,
+// if any is configured. The metadata is read each time the file is read, so
+// a symlink that is changed to a new target is resolved to the new target.
+func (f *Reader) readMetadata() {
+	fileInput := f.fileInput
+	f.metadata = fileMetadata{}
+	f.labels = nil
+
+	if fileInput.includeFilePathResolved {
+		resolved, err := filepath.EvalSymlinks(f.Path)
+		if err == nil {
+			resolved, err = filepath.Abs(resolved)
+		}
+		if err != nil {
+			f.Debugw("Failed to resolve file path", "error", err)
+		} else {
+			f.metadata.resolvedPath = resolved
+		}
+	}
+
+	if !fileInput.includeFileMtime && !fileInput.includeFileOwner {
+		return
+	}
+
+	info, err := f.file.Stat()
+	if err != nil {
+		f.Debugw("Failed to stat file", "error", err)
+		return
+	}
+	if fileInput.includeFileMtime {
+		f.metadata.mtime = info.ModTime().UTC().Format(time.RFC3339Nano)
+	}
+	if fileInput.includeFileOwner {
+		f.metadata.uid, f.metadata.gid, _ = fileOwner(info)
+	}
+}
+
+// addMetadataLabels adds the metadata of the file to an entry as labels
+func (f *Reader) addMetadataLabels(e *entry.Entry) {
+	labels := []struct {
+		key   string
+		value string
+	}{
+		{"file_path_resolved", f.metadata.resolvedPath},
+		{"file_mtime", f.metadata.mtime},
+		{"file_uid", f.metadata.uid},
+		{"file_gid", f.metadata.gid},
+	}
+	for _, label := range labels {
+		if label.value != "" {
+			e.AddLabel(label.key, label.value)
+		}
+	}
+}
+
+// addOffsetLabels adds the position and size of the raw bytes of an entry in
+// the file as labels, if include_file_offset is set
+func (f *Reader) addOffsetLabels(e *entry.Entry, offset, length int64) {
+	if !f.fileInput.includeFileOffset {
+		return
+	}
+	e.AddLabel("file_offset", strconv.FormatInt(offset, 10))
+	e.AddLabel("file_length", strconv.FormatInt(length, 10))
+}
@@ -0,0 +1,31 @@
+// +build linux
+
+package file
+
+import "golang.org/x/sys/unix"
+
+// networkFilesystems are the names of network filesystems by their magic
+// number, as reported by statfs
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x564c:     "ncp",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+	0x00c36400: "ceph",
+	0x0bd00bd0: "lustre",
+	0x5346414f: "afs",
+}
+
+// networkFilesystem returns the name of the filesystem of a path if it is a
+// network filesystem
+func networkFilesystem(path string) (string, bool) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+	name, ok := networkFilesystems[uint32(stat.Type)]
+	return name, ok
+}
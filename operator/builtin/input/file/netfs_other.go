@@ -0,0 +1,9 @@
+// +build !linux
+
+package file
+
+// networkFilesystem returns the name of the filesystem of a path if it is a
+// network filesystem. Filesystems are only identified on Linux.
+func networkFilesystem(path string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,267 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// nulPaddingProbeSize is the number of bytes read at each step of a
+	// search for the end of NUL padding
+	nulPaddingProbeSize = 64 * 1024
+
+	// nulPaddingScanLimit is the length of padding that is read to find its
+	// end. The end of longer padding is found with a binary search.
+	nulPaddingScanLimit = 1024 * 1024
+)
+
+// errNULPadding stops the scanner of a file at a run of NUL padding
+var errNULPadding = fmt.Errorf("reached nul padding")
+
+// nulPaddingSplitFunc wraps a split function, so that the scanner stops at a
+// run of NUL padding rather than splitting it into tokens. The bytes before
+// the padding are split as if the file ended at the padding, and the partial
+// token left before it is held in paddingPrefix.
+func (f *Reader) nulPaddingSplitFunc(split bufio.SplitFunc) bufio.SplitFunc {
+	threshold := f.fileInput.nulPaddingThreshold
+	unit := f.encoding.unit
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		advance, token, err = split(data, atEOF)
+		if err != nil {
+			return advance, token, err
+		}
+
+		// Only the bytes of a token are searched, so that each line is not
+		// searched again with the rest of the buffer
+		searched := data
+		if advance > 0 || token != nil {
+			searched = data[:advance]
+		}
+		i := nulRunIndex(searched, threshold)
+		if i < 0 {
+			return advance, token, err
+		}
+
+		// The padding starts at the next character, since the last byte of
+		// a character before it may be NUL
+		if r := i % unit; r != 0 {
+			i += unit - r
+		}
+		advance, token, err = split(data[:i], true)
+		if err != nil || advance > 0 || token != nil {
+			return advance, token, err
+		}
+		f.paddingPrefix = append(f.paddingPrefix[:0], data[:i]...)
+		return 0, nil, errNULPadding
+	}
+}
+
+// skipNULPadding moves the offset past the run of NUL padding that the
+// scanner stopped at, and returns true if it did. The partial token before
+// the padding is emitted first, since the file continues after the padding.
+// Padding that runs to the end of the file is not skipped, since the writer
+// of a pre-allocated file writes the next entries over it.
+func (f *Reader) skipNULPadding(ctx context.Context) bool {
+	prefix := f.paddingPrefix
+	start := f.Offset + int64(len(prefix))
+	end, err := f.nulPaddingEnd(start)
+	if err != nil {
+		f.Errorw("Failed to find the end of NUL padding", zap.Error(err))
+		return false
+	}
+
+	info, err := f.file.Stat()
+	if err != nil {
+		f.Errorw("Failed to find the end of NUL padding", zap.Error(err))
+		return false
+	}
+	if end >= info.Size() {
+		f.padded = true
+		return false
+	}
+
+	checkpoint := nextCheckpoint(f.checkpoint, prefix)
+	if len(prefix) > 0 {
+		if !f.verifyCheckpoint(checkpoint, start) {
+			return false
+		}
+		f.emitToken(ctx, prefix, f.Offset, start)
+	}
+
+	// The checkpoint ends with the padding, the same as if it was read
+	padding := end - start
+	if padding > checkpointSize {
+		padding = checkpointSize
+	}
+	f.checkpoint = nextCheckpoint(checkpoint, make([]byte, padding))
+
+	f.Debugw("Skipped NUL padding", "offset", start, "length", end-start)
+	f.fileInput.OperatorStats().AddBytes(uint64(end - f.Offset))
+	f.Offset = end
+	return true
+}
+
+// nulPaddingEnd returns the offset of the first character after the NUL
+// padding at start, or the size of the file if the padding runs to its end
+func (f *Reader) nulPaddingEnd(start int64) (int64, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat: %s", err)
+	}
+	size := info.Size()
+
+	limit := start + nulPaddingScanLimit
+	if limit >= size {
+		return f.findNonNUL(start, size)
+	}
+	if end, err := f.findNonNUL(start, limit); err != nil || end < limit {
+		return end, err
+	}
+
+	// Files that are pre-allocated are commonly padded up to their end, so
+	// longer padding is only read if the file has contents after it
+	tail, err := f.nulTailStart(limit, size)
+	if err != nil {
+		return 0, err
+	}
+	if tail <= limit {
+		return size, nil
+	}
+	return f.findNonNUL(limit, tail)
+}
+
+// findNonNUL returns the offset of the character that holds the first byte
+// that is not NUL between from and to, or to if there is none
+func (f *Reader) findNonNUL(from, to int64) (int64, error) {
+	buf := make([]byte, nulPaddingProbeSize)
+	for pos := from; pos < to; {
+		n := int64(len(buf))
+		if to-pos < n {
+			n = to - pos
+		}
+		read, err := f.file.ReadAt(buf[:n], pos)
+		for i, b := range buf[:read] {
+			if b != 0 {
+				offset := pos + int64(i)
+				return offset - offset%int64(f.encoding.unit), nil
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("read padding: %s", err)
+		}
+		pos += int64(read)
+	}
+	return to, nil
+}
+
+// nulTailStart returns the offset of the first character of the NUL padding
+// at the end of a file, searching between lo and hi, the size of the file.
+// The search assumes that the file has no contents after the start of its
+// padding, so any probe that holds only NUL bytes is part of the padding.
+func (f *Reader) nulTailStart(lo, hi int64) (int64, error) {
+	buf := make([]byte, nulPaddingProbeSize)
+	probe := func(pos, end int64) (int64, error) {
+		if end-pos > int64(len(buf)) {
+			end = pos + int64(len(buf))
+		}
+		read, err := f.file.ReadAt(buf[:end-pos], pos)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("read padding: %s", err)
+		}
+		for i := read - 1; i >= 0; i-- {
+			if buf[i] != 0 {
+				return pos + int64(i) + 1, nil
+			}
+		}
+		return -1, nil
+	}
+
+	// The end of the file is probed first, so that the search only runs
+	// over padding that reaches the end of the file
+	last := hi - int64(len(buf))
+	if last < lo {
+		last = lo
+	}
+	after, err := probe(last, hi)
+	if err != nil || after >= 0 {
+		return f.alignNULPadding(after), err
+	}
+
+	hi = last
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		after, err := probe(mid, hi)
+		if err != nil {
+			return 0, err
+		}
+		if after >= 0 {
+			lo = after
+		} else {
+			hi = mid
+		}
+	}
+	return f.alignNULPadding(hi), nil
+}
+
+// alignNULPadding rounds an offset up to the start of a character
+func (f *Reader) alignNULPadding(offset int64) int64 {
+	unit := int64(f.encoding.unit)
+	if r := offset % unit; r != 0 {
+		offset += unit - r
+	}
+	return offset
+}
+
+// nulRunIndex returns the index of the first run of at least threshold NUL
+// bytes in data, or -1 if there is none
+func nulRunIndex(data []byte, threshold int) int {
+	start := -1
+	for i, b := range data {
+		if b != 0 {
+			start = -1
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if i-start+1 >= threshold {
+			return start
+		}
+	}
+	return -1
+}
+
+// isNUL returns true if a token is made of NUL bytes
+func isNUL(token []byte) bool {
+	if len(token) == 0 {
+		return false
+	}
+	for _, b := range token {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// trimNULPadding removes the NUL bytes at the end of the first bytes of a file
+func trimNULPadding(firstBytes []byte) []byte {
+	return bytes.TrimRight(firstBytes, "\x00")
+}
+
+// trimFingerprint removes the NUL padding at the end of a fingerprint, if
+// padding is skipped. The writer of a pre-allocated file writes over its
+// padding, which would otherwise change the fingerprint of the file.
+func (f *InputOperator) trimFingerprint(fp *Fingerprint) *Fingerprint {
+	if f.nulPaddingThreshold > 0 {
+		fp.FirstBytes = trimNULPadding(fp.FirstBytes)
+	}
+	return fp
+}
@@ -0,0 +1,175 @@
+package file
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func newNULPaddingOperator(t *testing.T, cfgMod func(*InputConfig)) (*InputOperator, chan *entry.Entry, string) {
+	return newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.SkipNULPadding = true
+		if cfgMod != nil {
+			cfgMod(cfg)
+		}
+	}, nil)
+}
+
+// lastReader returns the reader of the file read last by the operator
+func lastReader(operator *InputOperator) *Reader {
+	return operator.knownFiles[len(operator.knownFiles)-1]
+}
+
+// PreallocatedFile tests that a sparse file that is pre-allocated with NUL
+// bytes is read up to its padding, and that the entries written over the
+// padding are read, without the fingerprint or offset counting the padding
+func TestNULPaddingPreallocatedFile(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newNULPaddingOperator(t, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\ntestlog2\n")
+	require.NoError(t, temp.Truncate(64<<20))
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"testlog1", "testlog2"})
+	reader := lastReader(operator)
+	require.Equal(t, int64(18), reader.Offset)
+	require.True(t, reader.padded)
+	require.Equal(t, []byte("testlog1\ntestlog2\n"), reader.Fingerprint.FirstBytes)
+	require.Equal(t, int64(0), operator.PendingWork())
+
+	_, err := temp.WriteAt([]byte("testlog3\n"), 18)
+	require.NoError(t, err)
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog3")
+	expectNoMessages(t, logReceived)
+	reader = lastReader(operator)
+	require.Equal(t, int64(27), reader.Offset)
+	require.False(t, reader.rewritten)
+	require.Equal(t, []byte("testlog1\ntestlog2\ntestlog3\n"), reader.Fingerprint.FirstBytes)
+}
+
+// ContentsAfterPadding tests that padding followed by contents is skipped,
+// and that the partial line before the padding is emitted
+func TestNULPaddingContentsAfterPadding(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newNULPaddingOperator(t, nil)
+
+	// The padding is longer than the part that is read to find its end
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\npartial")
+	end := int64(2*nulPaddingScanLimit + 100)
+	_, err := temp.WriteAt([]byte("testlog2\n"), end)
+	require.NoError(t, err)
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"testlog1", "partial", "testlog2"})
+	reader := lastReader(operator)
+	require.Equal(t, end+9, reader.Offset)
+	require.False(t, reader.padded)
+}
+
+// ShortRuns tests that NUL bytes shorter than the threshold are read, but
+// that lines made only of NUL bytes are not emitted
+func TestNULPaddingShortRuns(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newNULPaddingOperator(t, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "test\x00log1\n\x00\x00\x00\ntestlog2\n")
+
+	operator.poll(context.Background())
+	waitForMessages(t, logReceived, []string{"test\x00log1", "testlog2"})
+}
+
+// StartAtEnd tests that a padded file is read from the start of its padding
+// when reading starts at the end of files
+func TestNULPaddingStartAtEnd(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newNULPaddingOperator(t, func(cfg *InputConfig) {
+		cfg.StartAt = "end"
+	})
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\n")
+	require.NoError(t, temp.Truncate(8<<20))
+
+	operator.poll(context.Background())
+	expectNoMessages(t, logReceived)
+
+	_, err := temp.WriteAt([]byte("testlog2\n"), 9)
+	require.NoError(t, err)
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog2")
+	expectNoMessages(t, logReceived)
+}
+
+// UTF16 tests that padding is skipped in whole characters of utf-16, whose
+// characters end with a NUL byte
+func TestNULPaddingUTF16(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newNULPaddingOperator(t, func(cfg *InputConfig) {
+		cfg.Encoding = "utf-16le"
+	})
+
+	encoder := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder()
+	contents, err := encoder.String("testlog1\n")
+	require.NoError(t, err)
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, contents)
+	require.NoError(t, temp.Truncate(1<<20))
+
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog1")
+	require.Equal(t, int64(len(contents)), lastReader(operator).Offset)
+
+	more, err := encoder.String("testlog2\n")
+	require.NoError(t, err)
+	_, err = temp.WriteAt([]byte(more), int64(len(contents)))
+	require.NoError(t, err)
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog2")
+	expectNoMessages(t, logReceived)
+}
+
+func TestNULTailStart(t *testing.T) {
+	operator, _, tempDir := newNULPaddingOperator(t, nil)
+
+	cases := []struct {
+		name     string
+		contents int
+		size     int64
+	}{
+		{"Empty", 0, 0},
+		{"Unpadded", 100, 100},
+		{"Padded", 100, 1 << 20},
+		{"OnlyPadding", 0, 1 << 20},
+		{"LongContents", 3*nulPaddingProbeSize + 7, 16 << 20},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			temp := openTemp(t, tempDir)
+			writeString(t, temp, strings.Repeat("a", tc.contents))
+			require.NoError(t, temp.Truncate(tc.size))
+
+			reader, err := NewReader(temp.Name(), operator, temp, &Fingerprint{})
+			require.NoError(t, err)
+			tail, err := reader.nulTailStart(0, tc.size)
+			require.NoError(t, err)
+			require.Equal(t, int64(tc.contents), tail)
+		})
+	}
+}
+
+func TestNULRunIndex(t *testing.T) {
+	require.Equal(t, -1, nulRunIndex([]byte("abc"), 2))
+	require.Equal(t, -1, nulRunIndex([]byte("a\x00b\x00"), 2))
+	require.Equal(t, 1, nulRunIndex([]byte("a\x00\x00b"), 2))
+	require.Equal(t, 3, nulRunIndex([]byte("a\x00b\x00\x00\x00"), 3))
+}
@@ -0,0 +1,16 @@
+// +build !windows
+
+package file
+
+import "os"
+
+// openLogFile opens a file for reading. Backup semantics only apply on Windows.
+func openLogFile(path string, backupSemantics bool) (*os.File, error) {
+	return os.Open(path)
+}
+
+// isLockedError returns false, since files are not locked exclusively
+// against readers outside of Windows
+func isLockedError(err error) bool {
+	return false
+}
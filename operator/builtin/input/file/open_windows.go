@@ -0,0 +1,55 @@
+// +build windows
+
+package file
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	// errorSharingViolation is returned when another process opened a file
+	// without sharing it for reading
+	errorSharingViolation syscall.Errno = 32
+	// errorLockViolation is returned when another process locked a region of a file
+	errorLockViolation syscall.Errno = 33
+)
+
+// openLogFile opens a file for reading. With backup semantics, the file is opened
+// with FILE_FLAG_BACKUP_SEMANTICS and shared for reading, writing and deletion,
+// which lets a process with the backup privilege read files that would be
+// denied to it otherwise.
+func openLogFile(path string, backupSemantics bool) (*os.File, error) {
+	if !backupSemantics {
+		return os.Open(path)
+	}
+
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	handle, err := syscall.CreateFile(
+		pathp,
+		syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_ATTRIBUTE_NORMAL|syscall.FILE_FLAG_BACKUP_SEMANTICS,
+		0,
+	)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
+
+// isLockedError returns true if a file could not be opened because another
+// process holds an exclusive lock on it
+func isLockedError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == errorSharingViolation || errno == errorLockViolation
+}
@@ -0,0 +1,106 @@
+// +build windows
+
+package file
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// lockHelperEnv names the file that the helper process locks
+const lockHelperEnv = "STANZA_TEST_LOCK_FILE"
+
+// TestLockHelperProcess is not a real test. It is run in a separate process
+// by startLockHelper to hold an exclusive lock on a file until its stdin closes.
+func TestLockHelperProcess(t *testing.T) {
+	path := os.Getenv(lockHelperEnv)
+	if path == "" {
+		t.Skip("only run as a helper process")
+	}
+
+	pathp, err := syscall.UTF16PtrFromString(path)
+	require.NoError(t, err)
+	handle, err := syscall.CreateFile(pathp, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	require.NoError(t, err)
+	defer syscall.CloseHandle(handle)
+
+	os.Stdout.WriteString("locked\n")
+	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+// startLockHelper starts a process that holds an exclusive lock on a file.
+// The lock is released by calling the returned function.
+func startLockHelper(t *testing.T, path string) func() {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), lockHelperEnv+"="+path)
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "locked\n", line)
+
+	released := false
+	release := func() {
+		if released {
+			return
+		}
+		released = true
+		stdin.Close()
+		_ = cmd.Wait()
+	}
+	t.Cleanup(release)
+	return release
+}
+
+func TestIsLockedError(t *testing.T) {
+	path := filepath.Join(testutil.NewTempDir(t), "locked.log")
+	startLockHelper(t, path)
+
+	for _, backupSemantics := range []bool{false, true} {
+		_, err := openLogFile(path, backupSemantics)
+		require.Error(t, err)
+		require.True(t, isLockedError(err))
+	}
+}
+
+func TestLockedFileIsReadOnceUnlocked(t *testing.T) {
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
+	path := filepath.Join(tempDir, "locked.log")
+	release := startLockHelper(t, path)
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	// The locked file is reported in the status of the operator
+	require.Eventually(t, func() bool {
+		return operator.Status() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	locked := operator.Status()["locked_files"].([]map[string]interface{})
+	require.Equal(t, path, locked[0]["path"])
+	require.Equal(t, lockedReason, locked[0]["reason"])
+
+	release()
+	require.NoError(t, ioutil.WriteFile(path, []byte("testlog\n"), 0666))
+
+	// The file is read on the next attempt after its backoff
+	select {
+	case e := <-logReceived:
+		require.Equal(t, "testlog", e.Record.(string))
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "Timed out waiting for the unlocked file to be read")
+	}
+	require.Nil(t, operator.Status())
+}
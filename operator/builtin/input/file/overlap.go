@@ -0,0 +1,80 @@
+package file
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/observiq/stanza/operator"
+)
+
+// Overlap returns a description of the files that may be read by both this
+// operator and another file input. It returns false if there is no overlap.
+func (f *InputOperator) Overlap(other operator.Operator) (string, bool) {
+	o, ok := other.(*InputOperator)
+	if !ok || o == f {
+		return "", false
+	}
+
+	for _, a := range f.Include {
+		for _, b := range o.Include {
+			if !globsIntersect(a, b) {
+				continue
+			}
+
+			example, found := overlapExample(a, b, f.Exclude, o.Exclude)
+			if found {
+				return fmt.Sprintf("include '%s' of %s and include '%s' of %s both match %s", a, f.ID(), b, o.ID(), example), true
+			}
+
+			// Without an example on disk, an exclude that may cover the
+			// overlap is given the benefit of the doubt
+			if excludesMayCover(f.Exclude, a, b) || excludesMayCover(o.Exclude, a, b) {
+				continue
+			}
+			return fmt.Sprintf("include '%s' of %s and include '%s' of %s can match the same files", a, f.ID(), b, o.ID()), true
+		}
+	}
+	return "", false
+}
+
+// StrictOverlap returns true if an overlap with another operator should be
+// treated as an error rather than a warning
+func (f *InputOperator) StrictOverlap() bool {
+	return f.strictIncludes
+}
+
+// overlapExample returns a path on disk that is matched by both include
+// patterns and by none of the exclude patterns.
+func overlapExample(a, b string, excludes ...[]string) (string, bool) {
+	matches, err := filepath.Glob(a)
+	if err != nil {
+		return "", false
+	}
+
+MATCHES:
+	for _, path := range matches {
+		if ok, err := filepath.Match(b, path); err != nil || !ok {
+			continue
+		}
+		for _, exclude := range excludes {
+			for _, pattern := range exclude {
+				if ok, _ := filepath.Match(pattern, path); ok {
+					continue MATCHES
+				}
+			}
+		}
+		return path, true
+	}
+	return "", false
+}
+
+// excludesMayCover returns true if any of the exclude patterns can match a
+// path that is matched by both include patterns.
+func excludesMayCover(excludes []string, a, b string) bool {
+	for _, exclude := range excludes {
+		if globsIntersect(exclude, a) && globsIntersect(exclude, b) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package file
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test patterns use unix path separators")
+	}
+
+	cases := []struct {
+		name         string
+		files        []string
+		include1     string
+		exclude1     []string
+		include2     string
+		exclude2     []string
+		expected     bool
+		expectedPath string
+	}{
+		{
+			name:         "ExampleOnDisk",
+			files:        []string{"app.log"},
+			include1:     "*.log",
+			include2:     "app*",
+			expected:     true,
+			expectedPath: "app.log",
+		},
+		{
+			name:     "NoExampleOnDisk",
+			include1: "*.log",
+			include2: "app*",
+			expected: true,
+		},
+		{
+			name:     "Disjoint",
+			files:    []string{"app.log", "app.txt"},
+			include1: "*.log",
+			include2: "*.txt",
+			expected: false,
+		},
+		{
+			name:     "ExcludeMayCover",
+			include1: "*.log",
+			include2: "app*",
+			exclude2: []string{"*.log"},
+			expected: false,
+		},
+		{
+			name:     "ExampleExcluded",
+			files:    []string{"app.log"},
+			include1: "*.log",
+			exclude1: []string{"app.*"},
+			include2: "app*",
+			expected: false,
+		},
+		{
+			name:         "ExampleNotExcluded",
+			files:        []string{"app.log", "app-2.log"},
+			include1:     "*.log",
+			exclude1:     []string{"app.*"},
+			include2:     "app*",
+			expected:     true,
+			expectedPath: "app-2.log",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			operator1, _, tempDir := newTestFileOperator(t, nil, nil)
+			operator2, _, _ := newTestFileOperator(t, nil, nil)
+
+			withDir := func(patterns ...string) []string {
+				result := make([]string, 0, len(patterns))
+				for _, pattern := range patterns {
+					result = append(result, filepath.Join(tempDir, pattern))
+				}
+				return result
+			}
+			operator1.Include = withDir(tc.include1)
+			operator1.Exclude = withDir(tc.exclude1...)
+			operator2.Include = withDir(tc.include2)
+			operator2.Exclude = withDir(tc.exclude2...)
+
+			for _, name := range tc.files {
+				file := openFile(t, filepath.Join(tempDir, name))
+				require.NoError(t, file.Close())
+			}
+
+			description, overlaps := operator1.Overlap(operator2)
+			require.Equal(t, tc.expected, overlaps)
+			if tc.expectedPath != "" {
+				require.Contains(t, description, filepath.Join(tempDir, tc.expectedPath))
+			}
+		})
+	}
+}
+
+func TestOverlapSelf(t *testing.T) {
+	operator, _, _ := newTestFileOperator(t, nil, nil)
+	_, overlaps := operator.Overlap(operator)
+	require.False(t, overlaps)
+}
+
+func TestStrictOverlap(t *testing.T) {
+	operator, _, _ := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.StrictIncludes = true
+	}, nil)
+	require.True(t, operator.StrictOverlap())
+}
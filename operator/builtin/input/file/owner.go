@@ -0,0 +1,18 @@
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner returns the user and group IDs of the owner of a file
+func fileOwner(info os.FileInfo) (uid, gid string, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", false
+	}
+	return strconv.FormatUint(uint64(stat.Uid), 10), strconv.FormatUint(uint64(stat.Gid), 10), true
+}
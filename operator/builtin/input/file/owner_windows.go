@@ -0,0 +1,11 @@
+// +build windows
+
+package file
+
+import "os"
+
+// fileOwner is not supported on Windows, where files are not owned by
+// numeric user and group IDs
+func fileOwner(info os.FileInfo) (uid, gid string, ok bool) {
+	return "", "", false
+}
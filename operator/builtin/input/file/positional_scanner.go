@@ -7,7 +7,9 @@ import (
 
 // PositionalScanner is a scanner that maintains position
 type PositionalScanner struct {
-	pos int64
+	pos        int64
+	tokenStart int64
+	consumed   []byte
 	*bufio.Scanner
 }
 
@@ -18,12 +20,66 @@ func NewPositionalScanner(r io.Reader, maxLogSize int, startOffset int64, splitF
 		Scanner: bufio.NewScanner(r),
 	}
 
-	buf := make([]byte, 0, 16384)
+	bufferSize := 16384
+	if maxLogSize > 0 && maxLogSize < bufferSize {
+		bufferSize = maxLogSize
+	}
+	buf := make([]byte, 0, bufferSize)
 	ps.Scanner.Buffer(buf, maxLogSize)
 
 	scanFunc := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
 		advance, token, err = splitFunc(data, atEOF)
+		if err == nil && advance == 0 && token == nil && maxLogSize > 0 && len(data) >= maxLogSize {
+			// A pattern that never matches would otherwise buffer until the
+			// scanner fails, so the buffered data is split at the max log size
+			advance, token = maxLogSize, data[:maxLogSize]
+		}
+		ps.tokenStart = ps.pos + tokenIndex(data, token)
+		ps.pos += int64(advance)
+		ps.consumed = data[:advance]
+		return
+	}
+	ps.Scanner.Split(scanFunc)
+	return ps
+}
+
+// newLimitedPositionalScanner creates a positional scanner whose tokens are
+// split between characters once they reach a size limit. The tokens of the
+// split function must start at the beginning of its data.
+func newLimitedPositionalScanner(r io.Reader, limit *sizeLimit, startOffset int64, splitFunc bufio.SplitFunc) *PositionalScanner {
+	ps := &PositionalScanner{
+		pos:     startOffset,
+		Scanner: bufio.NewScanner(r),
+	}
+
+	// The buffer holds a character more than the largest entry, so that an
+	// entry at the limit is followed by its delimiter rather than split
+	maxBufferSize := limit.bufferSize()
+	if maxBufferSize > 0 {
+		maxBufferSize += maxEncodedCharSize
+	}
+	bufferSize := 16384
+	if maxBufferSize > 0 && maxBufferSize < bufferSize {
+		bufferSize = maxBufferSize
+	}
+	buf := make([]byte, 0, bufferSize)
+	ps.Scanner.Buffer(buf, maxBufferSize)
+
+	scanFunc := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		advance, token, err = splitFunc(data, atEOF)
+		if err == nil && advance == 0 && token == nil && maxBufferSize > 0 && len(data) >= maxBufferSize {
+			// A pattern that never matches would otherwise buffer until the
+			// scanner fails, so the buffered data is split at the max log size
+			token = data
+		}
+		if err == nil && token != nil && limit.exceeded(token) {
+			// The rest of a token that is too large is read as the next token
+			n := limit.cut(token)
+			advance, token = n, token[:n]
+		}
+		ps.tokenStart = ps.pos + tokenIndex(data, token)
 		ps.pos += int64(advance)
+		ps.consumed = data[:advance]
 		return
 	}
 	ps.Scanner.Split(scanFunc)
@@ -34,3 +90,30 @@ func NewPositionalScanner(r io.Reader, maxLogSize int, startOffset int64, splitF
 func (ps *PositionalScanner) Pos() int64 {
 	return ps.pos
 }
+
+// Consumed returns the bytes of the file consumed by the last token, including
+// any delimiter. It is only valid until the next call to Scan.
+func (ps *PositionalScanner) Consumed() []byte {
+	return ps.consumed
+}
+
+// TokenStart returns the position in the file of the first byte of the last
+// token. A token that starts after skipped bytes, such as a multiline entry
+// that starts at the first match of its pattern, starts after the previous
+// position of the scanner.
+func (ps *PositionalScanner) TokenStart() int64 {
+	return ps.tokenStart
+}
+
+// tokenIndex returns the index in data of the first byte of a token that is
+// a slice of data, or zero if the token is empty or was copied
+func tokenIndex(data, token []byte) int64 {
+	if len(token) == 0 {
+		return 0
+	}
+	i := cap(data) - cap(token)
+	if i < 0 || i >= len(data) || &data[i] != &token[0] {
+		return 0
+	}
+	return int64(i)
+}
@@ -0,0 +1,318 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultProfileQueueSize is the number of entries queued for a profile
+	// when no size is set
+	defaultProfileQueueSize = 1000
+
+	// profileDrainTimeout is the maximum time to wait for the entries queued
+	// for the profiles when the operator stops
+	profileDrainTimeout = 5 * time.Second
+)
+
+// ProfileConfig is the configuration of an output profile of a file input.
+// Each profile has outputs of its own, which receive a copy of every entry.
+type ProfileConfig struct {
+	ID        string           `json:"id"                   yaml:"id"`
+	OutputIDs helper.OutputIDs `json:"output"               yaml:"output"`
+	QueueSize int              `json:"queue_size,omitempty" yaml:"queue_size,omitempty"`
+}
+
+// buildProfiles creates the profiles of a file input from their configs
+func buildProfiles(configs []ProfileConfig, bc operator.BuildContext, logger *zap.SugaredLogger) (*profiles, error) {
+	p := &profiles{
+		drainTimeout:  profileDrainTimeout,
+		SugaredLogger: logger,
+	}
+
+	seen := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		if config.ID == "" {
+			return nil, fmt.Errorf("profiles must have an id")
+		}
+		if seen[config.ID] {
+			return nil, fmt.Errorf("duplicate profile id '%s'", config.ID)
+		}
+		seen[config.ID] = true
+
+		if len(config.OutputIDs) == 0 {
+			return nil, fmt.Errorf("profile '%s' has no output", config.ID)
+		}
+
+		queueSize := config.QueueSize
+		if queueSize == 0 {
+			queueSize = defaultProfileQueueSize
+		}
+		if queueSize < 0 {
+			return nil, fmt.Errorf("invalid queue_size '%d' of profile '%s', must not be negative", queueSize, config.ID)
+		}
+
+		p.profiles = append(p.profiles, &profile{
+			id:        config.ID,
+			outputIDs: config.OutputIDs.WithNamespace(bc),
+			queueSize: queueSize,
+		})
+	}
+	return p, nil
+}
+
+// profiles deliver the entries read from files to the outputs of each
+// profile through a queue of its own. Each profile records the offset of
+// each file up to which its entries were written to its outputs, so that an
+// output that falls behind does not hold back the offsets of other profiles.
+type profiles struct {
+	profiles     []*profile
+	drainTimeout time.Duration
+	*zap.SugaredLogger
+
+	// done is closed when the operator stops, so that entries are no longer
+	// queued for a profile whose queue is full
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// profile is an output profile of a file input
+type profile struct {
+	id        string
+	outputIDs helper.OutputIDs
+	outputs   []operator.Operator
+	queueSize int
+	entries   chan profileEntry
+}
+
+// profileEntry is an entry queued for a profile, which ends at an offset of a file
+type profileEntry struct {
+	entry      *entry.Entry
+	watermarks *watermarks
+	generation int
+	end        int64
+}
+
+// outputIDs returns the outputs of all the profiles
+func (p *profiles) outputIDs() helper.OutputIDs {
+	ids := make(helper.OutputIDs, 0, len(p.profiles))
+	seen := make(map[string]bool)
+	for _, profile := range p.profiles {
+		for _, id := range profile.outputIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// setOutputs finds the outputs of each profile among the outputs of the operator
+func (p *profiles) setOutputs(operators []operator.Operator) error {
+	for _, profile := range p.profiles {
+		outputs := make([]operator.Operator, 0, len(profile.outputIDs))
+		for _, id := range profile.outputIDs {
+			var found operator.Operator
+			for _, op := range operators {
+				if op.ID() == id {
+					found = op
+					break
+				}
+			}
+			if found == nil {
+				return fmt.Errorf("output '%s' of profile '%s' does not exist", id, profile.id)
+			}
+			outputs = append(outputs, found)
+		}
+		profile.outputs = outputs
+	}
+	return nil
+}
+
+// start starts writing the entries queued for each profile
+func (p *profiles) start(stats *helper.OperatorStats) {
+	p.done = make(chan struct{})
+	for _, pr := range p.profiles {
+		pr.entries = make(chan profileEntry, pr.queueSize)
+
+		p.wg.Add(1)
+		go func(pr *profile) {
+			defer p.wg.Done()
+			for queued := range pr.entries {
+				for i, output := range pr.outputs {
+					toWrite := queued.entry
+					if i != len(pr.outputs)-1 {
+						toWrite = queued.entry.Copy()
+					}
+					helper.RecordReceived(output)
+					// The entries queued when the operator stops are still
+					// written, so they are not written with the context of the read
+					_ = output.Process(context.Background(), toWrite)
+				}
+				stats.AddOut(1)
+				queued.watermarks.advance(pr.id, queued.generation, queued.end)
+			}
+		}(pr)
+	}
+}
+
+// write queues a copy of an entry, which ends at an offset of a file, for
+// each profile that has not written the entry already. It blocks while the
+// queue of a profile is full, until the operator stops.
+func (p *profiles) write(ctx context.Context, e *entry.Entry, w *watermarks, end int64) {
+	generation := w.current()
+	pending := make([]*profile, 0, len(p.profiles))
+	for _, profile := range p.profiles {
+		if w.offset(profile.id) < end {
+			pending = append(pending, profile)
+		}
+	}
+
+	for i, profile := range pending {
+		toWrite := e
+		if i != len(pending)-1 {
+			toWrite = e.Copy()
+		}
+
+		// An entry that is not queued is read again after a restart, since
+		// the offset of the profile does not advance past it
+		queued := profileEntry{entry: toWrite, watermarks: w, generation: generation, end: end}
+		select {
+		case profile.entries <- queued:
+			continue
+		default:
+		}
+		select {
+		case profile.entries <- queued:
+		case <-ctx.Done():
+		case <-p.done:
+		}
+	}
+}
+
+// stopQueuing stops waiting for space in the queue of a profile, so that
+// entries read while stopping do not wait for a profile that fell behind
+func (p *profiles) stopQueuing() {
+	close(p.done)
+}
+
+// drain stops the queues, and waits up to the drain timeout for the queued
+// entries to be written
+func (p *profiles) drain() {
+	for _, profile := range p.profiles {
+		close(profile.entries)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(p.drainTimeout):
+		pending := make(map[string]int, len(p.profiles))
+		for _, profile := range p.profiles {
+			pending[profile.id] = len(profile.entries)
+		}
+		p.Warnw("Stopped before the entries queued for profiles were written. They are read again on the next start", "pending", pending)
+	}
+}
+
+// newWatermarks creates the watermarks of a file whose entries have been
+// written by every profile up to an offset
+func (p *profiles) newWatermarks(offset int64) *watermarks {
+	if p == nil {
+		return nil
+	}
+	w := &watermarks{offsets: make(map[string]int64, len(p.profiles))}
+	w.reset(p, offset)
+	return w
+}
+
+// loadWatermarks creates the watermarks of a file from the offsets saved for
+// each profile. A profile without a saved offset starts at the offset of the file.
+func (p *profiles) loadWatermarks(saved map[string]int64, offset int64) *watermarks {
+	w := p.newWatermarks(offset)
+	if w == nil {
+		return nil
+	}
+	for _, profile := range p.profiles {
+		if savedOffset, ok := saved[profile.id]; ok {
+			w.offsets[profile.id] = savedOffset
+		}
+	}
+	return w
+}
+
+// watermarks hold the offset of a file up to which each profile has written
+// its entries. They are shared by the readers of a file across polls. The
+// generation changes when the file is read again from the beginning, so that
+// entries queued before then do not advance the offsets.
+type watermarks struct {
+	mux        sync.Mutex
+	offsets    map[string]int64
+	generation int
+}
+
+// current returns the generation of the watermarks
+func (w *watermarks) current() int {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.generation
+}
+
+// offset returns the offset of the file up to which a profile has written entries
+func (w *watermarks) offset(profileID string) int64 {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.offsets[profileID]
+}
+
+// advance records that a profile has written the entries up to an offset
+func (w *watermarks) advance(profileID string, generation int, offset int64) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if generation == w.generation && offset > w.offsets[profileID] {
+		w.offsets[profileID] = offset
+	}
+}
+
+// reset sets the offset of every profile, such as when a file is read again
+// from the beginning
+func (w *watermarks) reset(p *profiles, offset int64) {
+	if w == nil {
+		return
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.generation++
+	for _, profile := range p.profiles {
+		w.offsets[profile.id] = offset
+	}
+}
+
+// snapshot returns the offset of each profile, and the lowest of them, from
+// which the file is read again after a restart
+func (w *watermarks) snapshot() (map[string]int64, int64) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	offsets := make(map[string]int64, len(w.offsets))
+	min := int64(-1)
+	for id, offset := range w.offsets {
+		offsets[id] = offset
+		if min < 0 || offset < min {
+			min = offset
+		}
+	}
+	return offsets, min
+}
@@ -0,0 +1,163 @@
+package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// profileOutput is a fake output with an ID of its own
+type profileOutput struct {
+	*testutil.FakeOutput
+	id string
+}
+
+func (o *profileOutput) ID() string { return o.id }
+
+// newProfileOutput creates a fake output whose Process blocks once size
+// entries are waiting to be received
+func newProfileOutput(t *testing.T, id string, size int) *profileOutput {
+	return &profileOutput{
+		FakeOutput: &testutil.FakeOutput{
+			Received:      make(chan *entry.Entry, size),
+			SugaredLogger: zaptest.NewLogger(t).Sugar(),
+		},
+		id: id,
+	}
+}
+
+func newProfilesConfig(tempDir string) *InputConfig {
+	cfg := newDefaultConfig(tempDir)
+	cfg.OutputIDs = nil
+	cfg.Profiles = []ProfileConfig{
+		{ID: "raw", OutputIDs: []string{"raw"}},
+		{ID: "parsed", OutputIDs: []string{"parsed"}, QueueSize: 1},
+	}
+	return cfg
+}
+
+func TestBuildProfiles(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		modify   func(*InputConfig)
+		errorMsg string
+	}{
+		{"Valid", func(cfg *InputConfig) {}, ""},
+		{"Output", func(cfg *InputConfig) { cfg.OutputIDs = []string{"raw"} }, "output cannot be used with profiles"},
+		{"MissingID", func(cfg *InputConfig) { cfg.Profiles[0].ID = "" }, "must have an id"},
+		{"DuplicateID", func(cfg *InputConfig) { cfg.Profiles[1].ID = "raw" }, "duplicate profile id 'raw'"},
+		{"MissingOutput", func(cfg *InputConfig) { cfg.Profiles[1].OutputIDs = nil }, "profile 'parsed' has no output"},
+		{"NegativeQueueSize", func(cfg *InputConfig) { cfg.Profiles[1].QueueSize = -1 }, "invalid queue_size"},
+		{"JSONArray", func(cfg *InputConfig) { cfg.ReadMode = ReadModeJSONArray }, "read_mode 'json_array'"},
+		{"DeleteAfterRead", func(cfg *InputConfig) { cfg.DeleteAfterRead = true }, "delete_after_read"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := newProfilesConfig(t.TempDir())
+			tc.modify(cfg)
+
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			op := ops[0].(*InputOperator)
+			require.Equal(t, []string{"$.raw", "$.parsed"}, []string(op.OutputIDs))
+			err = op.SetOutputs([]operator.Operator{newProfileOutput(t, "$.parsed", 1)})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "'$.raw' does not exist")
+		})
+	}
+}
+
+// Profiles tests that each profile receives every entry of a file that is
+// read once, and that no entry is written again after a restart
+func TestProfiles(t *testing.T) {
+	t.Parallel()
+	tempDir := testutil.NewTempDir(t)
+	bc := testutil.NewBuildContext(t)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "a\nb\n")
+
+	start := func() (*InputOperator, *profileOutput, *profileOutput) {
+		ops, err := newProfilesConfig(tempDir).Build(bc)
+		require.NoError(t, err)
+		op := ops[0].(*InputOperator)
+		raw, parsed := newProfileOutput(t, "$.raw", 10), newProfileOutput(t, "$.parsed", 10)
+		require.NoError(t, op.SetOutputs([]operator.Operator{raw, parsed}))
+		require.NoError(t, op.Start())
+		return op, raw, parsed
+	}
+
+	op, raw, parsed := start()
+	waitForMessages(t, raw.Received, []string{"a", "b"})
+	waitForMessages(t, parsed.Received, []string{"a", "b"})
+	require.NoError(t, op.Stop())
+
+	writeString(t, temp, "c\n")
+	op, raw, parsed = start()
+	defer op.Stop()
+	waitForMessage(t, raw.Received, "c")
+	waitForMessage(t, parsed.Received, "c")
+	expectNoMessages(t, raw.Received)
+	expectNoMessages(t, parsed.Received)
+}
+
+// ProfilesStalled tests that a profile whose output stops keeps its own
+// offset, so that after a restart it receives the entries it did not write,
+// while the other profile does not receive them again
+func TestProfilesStalled(t *testing.T) {
+	t.Parallel()
+	tempDir := testutil.NewTempDir(t)
+	bc := testutil.NewBuildContext(t)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "a\nb\nc\n")
+
+	ops, err := newProfilesConfig(tempDir).Build(bc)
+	require.NoError(t, err)
+	op := ops[0].(*InputOperator)
+	op.profiles.drainTimeout = 100 * time.Millisecond
+
+	// The stalled output takes entries only when they are received
+	raw, stalled := newProfileOutput(t, "$.raw", 10), newProfileOutput(t, "$.parsed", 0)
+	require.NoError(t, op.SetOutputs([]operator.Operator{raw, stalled}))
+	require.NoError(t, op.Start())
+
+	waitForMessage(t, stalled.Received, "a")
+	waitForMessages(t, raw.Received, []string{"a", "b", "c"})
+	require.NoError(t, op.Stop())
+	defer func() {
+		go func() {
+			for range stalled.Received {
+			}
+		}()
+	}()
+
+	ops, err = newProfilesConfig(tempDir).Build(bc)
+	require.NoError(t, err)
+	op = ops[0].(*InputOperator)
+	raw, parsed := newProfileOutput(t, "$.raw", 10), newProfileOutput(t, "$.parsed", 10)
+	require.NoError(t, op.SetOutputs([]operator.Operator{raw, parsed}))
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	waitForMessage(t, parsed.Received, "b")
+	waitForMessage(t, parsed.Received, "c")
+	expectNoMessages(t, raw.Received)
+	expectNoMessages(t, parsed.Received)
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"bufio"
+	"io"
+)
+
+// readAheadMinUnread is the number of unread bytes a file must have for it to
+// be read ahead. Files that only grew by a few lines since the last poll are
+// read as usual, so their pages stay in the page cache.
+const readAheadMinUnread = 1 << 20
+
+// readAhead reads a file that has a large unread part, such as a cold file
+// that is backfilled, in large sequential reads. The pages of the file that
+// were read are dropped from the page cache as the reader moves past them.
+type readAhead struct {
+	reader *Reader
+	buffer *bufio.Reader
+
+	// dropped is the end of the part of the file dropped from the page cache
+	dropped int64
+}
+
+// startReadAhead returns a read ahead of the file from its offset, or nil if
+// the file should be read as usual
+func (f *Reader) startReadAhead() *readAhead {
+	size := f.fileInput.readAheadSize
+	if size == 0 || f.compressed || f.padded {
+		return nil
+	}
+	info, err := f.file.Stat()
+	if err != nil || info.Size()-f.Offset < readAheadMinUnread {
+		return nil
+	}
+
+	if err := adviseSequential(f.file); err != nil {
+		f.Debugw("Failed to advise sequential reads", "error", err)
+	}
+
+	buffer, ok := f.fileInput.readAheadPool.Get().(*bufio.Reader)
+	if !ok {
+		buffer = bufio.NewReaderSize(nil, size)
+	}
+	buffer.Reset(f.file)
+
+	// The fingerprint is compared with the file before each entry is sent,
+	// so the pages that hold it are kept
+	dropped := f.fileInput.fingerprintBytes
+	if f.Offset > dropped {
+		dropped = f.Offset
+	}
+	return &readAhead{
+		reader:  f,
+		buffer:  buffer,
+		dropped: dropped,
+	}
+}
+
+// source returns the reader of the file's contents
+func (r *readAhead) source() io.Reader {
+	return r.buffer
+}
+
+// advance drops the part of the file before offset from the page cache once
+// a full read ahead has been passed. The checkpoint before the offset is
+// compared with the file before the next entry is sent, so it is kept.
+func (r *readAhead) advance(offset int64, final bool) {
+	end := offset - checkpointSize
+	if end <= r.dropped || (!final && end-r.dropped < int64(r.reader.fileInput.readAheadSize)) {
+		return
+	}
+	if err := adviseDontNeed(r.reader.file, r.dropped, end-r.dropped); err != nil {
+		r.reader.Debugw("Failed to drop read pages from the page cache", "error", err)
+	}
+	r.dropped = end
+}
+
+// close drops the rest of the read part of the file from the page cache, and
+// returns the buffer to the pool of the file input
+func (r *readAhead) close(offset int64) {
+	r.advance(offset, true)
+	r.buffer.Reset(nil)
+	r.reader.fileInput.readAheadPool.Put(r.buffer)
+}
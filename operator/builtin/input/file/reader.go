@@ -8,7 +8,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/errors"
 	"go.uber.org/zap"
 	"golang.org/x/text/encoding"
@@ -17,16 +19,71 @@ import (
 
 // Reader manages a single file
 type Reader struct {
-	Fingerprint *Fingerprint
-	Offset      int64
-	Path        string
+	KnownFile
 
-	generation    int
-	fileInput     *InputOperator
-	file          *os.File
+	compressed bool
+	metadata   fileMetadata
+	generation int
+	fileInput  *InputOperator
+	file       *os.File
 
-	decoder      *encoding.Decoder
-	decodeBuffer []byte
+	// pendingEnd is the end of the partial entry left at the end of the file,
+	// which has not grown since pendingSince
+	pendingEnd   int64
+	pendingSince time.Time
+
+	// finished is set when the file was read to the same end on two polls in
+	// a row, and has not been modified since the end was first reached
+	finished   bool
+	endSize    int64
+	endModTime time.Time
+
+	// checkpoint holds the last bytes read before the offset, which are
+	// compared with the file to detect that it was rewritten in place.
+	// rewritten is set when the file is read again from the beginning after
+	// a rewrite, until it is read to the end.
+	checkpoint []byte
+	rewritten  bool
+
+	// holdsBuf is reused to read the bytes compared with the checkpoint
+	holdsBuf []byte
+
+	// labels are the labels of the file, which every entry read from it
+	// shares. They are built for the first entry, and reset when the
+	// metadata, header labels, or rewritten state of the file change.
+	labels *entry.LabelSet
+
+	// runLine is the line held while it repeats, which has been read
+	// runCount times in a row since runSince. runStart and runLength are the
+	// position and size of the raw bytes of the run in the file.
+	runLine   []byte
+	runCount  int
+	runSince  time.Time
+	runStart  int64
+	runLength int64
+
+	// watermarks hold the offsets up to which each output profile has written
+	// the entries of the file, and entryEnd is the end of the entry being
+	// emitted. entryStart and entryLength are the position and size of the
+	// raw bytes of the entry in the file, before they are decoded.
+	watermarks  *watermarks
+	entryEnd    int64
+	entryStart  int64
+	entryLength int64
+
+	// paddingPrefix holds the partial token before the run of NUL padding
+	// that the scanner stopped at. padded is set when the reader stopped at
+	// NUL padding that runs to the end of the file, which the writer of a
+	// pre-allocated file writes over later.
+	paddingPrefix []byte
+	padded        bool
+
+	// encoding is the encoding the file is read with, and encodingDetected
+	// is set once it has been detected from the start of the file
+	encoding         *fileEncoding
+	encodingDetected bool
+	decoder          *encoding.Decoder
+	decodeBuffer     []byte
 
 	*zap.SugaredLogger `json:"-"`
 }
@@ -34,12 +91,15 @@ type Reader struct {
 // NewReader creates a new file reader
 func NewReader(path string, f *InputOperator, file *os.File, fp *Fingerprint) (*Reader, error) {
 	r := &Reader{
-		Fingerprint:   fp,
+		KnownFile: KnownFile{
+			Fingerprint: fp,
+			Path:        path,
+		},
 		file:          file,
-		Path:          path,
 		fileInput:     f,
 		SugaredLogger: f.SugaredLogger.With("path", path),
-		decoder:       f.encoding.NewDecoder(),
+		encoding:      f.encoding,
+		decoder:       f.encoding.encoding.NewDecoder(),
 		decodeBuffer:  make([]byte, 1<<12),
 	}
 	return r, nil
@@ -52,17 +112,63 @@ func (f *Reader) Copy(file *os.File) (*Reader, error) {
 		return nil, err
 	}
 	reader.Offset = f.Offset
+	reader.Complete = f.Complete
+	reader.pendingEnd = f.pendingEnd
+	reader.pendingSince = f.pendingSince
+	reader.endSize = f.endSize
+	reader.endModTime = f.endModTime
+	reader.checkpoint = append([]byte(nil), f.checkpoint...)
+	reader.rewritten = f.rewritten
+	reader.HeaderEnd = f.HeaderEnd
+	reader.HeaderRead = f.HeaderRead
+	reader.ArrayIndex = f.ArrayIndex
+	reader.runLine = append([]byte(nil), f.runLine...)
+	reader.runCount = f.runCount
+	reader.runSince = f.runSince
+	reader.runStart = f.runStart
+	reader.runLength = f.runLength
+	reader.watermarks = f.watermarks
+	reader.padded = f.padded
+	reader.setEncoding(f.encoding)
+	reader.encodingDetected = f.encodingDetected
+	if f.HeaderLabels != nil {
+		reader.HeaderLabels = make(map[string]string, len(f.HeaderLabels))
+		for key, value := range f.HeaderLabels {
+			reader.HeaderLabels[key] = value
+		}
+	}
 	return reader, nil
 }
 
-// InitializeOffset sets the starting offset
+// InitializeOffset sets the starting offset. A compressed file that is not
+// read from the beginning is considered to be read already.
 func (f *Reader) InitializeOffset(startAtBeginning bool) error {
+	if !startAtBeginning && f.compressed {
+		f.Complete = true
+		return nil
+	}
+
 	if !startAtBeginning {
 		info, err := f.file.Stat()
 		if err != nil {
 			return fmt.Errorf("stat: %s", err)
 		}
 		f.Offset = info.Size()
+
+		// A file that is padded at the end is read from the start of its
+		// padding, which is where the next entries are written
+		if f.fileInput.nulPaddingThreshold > 0 && !f.compressed {
+			if err := f.detectEncoding(); err != nil {
+				return err
+			}
+			tail, err := f.nulTailStart(0, info.Size())
+			if err != nil {
+				return err
+			}
+			if info.Size()-tail >= int64(f.fileInput.nulPaddingThreshold) {
+				f.Offset = tail
+			}
+		}
 	}
 
 	return nil
@@ -70,35 +176,289 @@ func (f *Reader) InitializeOffset(startAtBeginning bool) error {
 
 // ReadToEnd will read until the end of the file
 func (f *Reader) ReadToEnd(ctx context.Context) {
-	if _, err := f.file.Seek(f.Offset, 0); err != nil {
-		f.Errorw("Failed to seek", zap.Error(err))
-		return
+	// The file is read again after each run of NUL padding that is skipped
+	for f.readToEnd(ctx) {
+	}
+}
+
+// readToEnd reads until the end of the file, or until a run of NUL padding.
+// It returns true if the padding was skipped, and the rest of the file
+// should be read.
+func (f *Reader) readToEnd(ctx context.Context) bool {
+	f.readMetadata()
+
+	var src io.Reader = f.file
+	if f.compressed {
+		if f.Complete {
+			return false
+		}
+
+		decompressed, err := f.openDecompressed()
+		if err != nil {
+			f.Errorw("Failed to decompress", zap.Error(err))
+			return false
+		}
+		src = decompressed
+	} else {
+		if err := f.checkTruncated(); err != nil {
+			f.Errorw("Failed to check for truncation", zap.Error(err))
+			return false
+		}
+		if !f.verifyCheckpoint(f.checkpoint, f.Offset) {
+			return false
+		}
+
+		// A file that is read from the start is detected again, since it may
+		// have been truncated and written with another encoding
+		if f.Offset == 0 {
+			f.encodingDetected = false
+		}
+		if err := f.detectEncoding(); err != nil {
+			f.Errorw("Failed to detect encoding", zap.Error(err))
+			return false
+		}
+		f.skipBOM()
+		if f.fileInput.header != nil && !f.HeaderRead && f.Offset > f.HeaderEnd {
+			f.readHeader(ctx)
+		}
+		if _, err := f.file.Seek(f.Offset, 0); err != nil {
+			f.Errorw("Failed to seek", zap.Error(err))
+			return false
+		}
 	}
 
-	fr := NewFingerprintUpdatingReader(f.file, f.Offset, f.Fingerprint)
-	scanner := NewPositionalScanner(fr, f.fileInput.MaxLogSize, f.Offset, f.fileInput.SplitFunc)
+	readAhead := f.startReadAhead()
+	if readAhead != nil {
+		src = readAhead.source()
+		defer func() { readAhead.close(f.Offset) }()
+	}
+
+	fr := NewFingerprintUpdatingReader(src, f.Offset, f.Fingerprint, f.fileInput.fingerprintBytes)
+	skipPadding := f.fileInput.nulPaddingThreshold > 0 && !f.compressed
+	fr.trimNULs = skipPadding
+	splitFunc := f.splitFunc()
+	if skipPadding {
+		splitFunc = f.nulPaddingSplitFunc(splitFunc)
+	}
+	var scanner *PositionalScanner
+	if f.fileInput.jsonArray {
+		// The elements of a JSON array are limited by its split function
+		scanner = NewPositionalScanner(fr, f.fileInput.MaxLogSize, f.Offset, splitFunc)
+	} else {
+		scanner = newLimitedPositionalScanner(fr, f.encoding.sizeLimit, f.Offset, splitFunc)
+	}
+	f.padded = false
+
+	// next is the checkpoint after the current token. Its buffer is swapped
+	// with the buffer of the checkpoint, so that neither is allocated again.
+	next := make([]byte, 0, checkpointSize)
+	checkedReads := fr.reads
+	unchecked := false
 
 	// Iterate over the tokenized file, emitting entries as we go
+	var skipped bool
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return false
 		default:
 		}
 
 		ok := scanner.Scan()
 		if !ok {
-			if err := getScannerError(scanner); err != nil {
+			if f.compressed && scanner.Err() == io.ErrUnexpectedEOF {
+				// The file is still being compressed, so the rest is read on the next poll
+				f.Debugw("Reached the end of an incomplete compressed file")
+			} else if scanner.Err() == errNULPadding {
+				skipped = f.skipNULPadding(ctx)
+			} else if err := getScannerError(scanner); err != nil {
 				f.Errorw("Failed during scan", zap.Error(err))
+			} else if f.compressed {
+				// The end of the compressed stream was reached and its checksum verified
+				f.Complete = true
+			} else if unchecked && !f.verifyCheckpoint(f.checkpoint, f.Offset) {
+				// The entries since the last check were read before the rewrite
+				return false
+			} else {
+				f.rewritten = false
+				f.labels = nil
 			}
 			break
 		}
 
-		if err := f.emit(ctx, scanner.Bytes()); err != nil {
-			f.Error("Failed to emit entry", zap.Error(err))
+		// An entry is checked against the file before it is emitted, so that
+		// an entry that mixes the old and new contents of a file that is
+		// rewritten in place is discarded rather than emitted. The bytes of a
+		// single read cannot mix them, so the file is only checked again once
+		// an entry holds bytes of a later read, and at the end of the file.
+		if !f.compressed {
+			next = appendCheckpoint(next[:0], f.checkpoint, scanner.Consumed())
+			unchecked = fr.reads == checkedReads
+			if !unchecked {
+				checkedReads = fr.reads
+				if !f.verifyCheckpoint(next, scanner.Pos()) {
+					return false
+				}
+			}
 		}
+
+		f.emitToken(ctx, scanner.Bytes(), scanner.TokenStart(), scanner.Pos())
+		f.fileInput.OperatorStats().AddBytes(uint64(scanner.Pos() - f.Offset))
 		f.Offset = scanner.Pos()
+		if !f.compressed {
+			f.checkpoint, next = next, f.checkpoint
+		}
+		if readAhead != nil {
+			readAhead.advance(f.Offset, false)
+		}
+	}
+
+	if f.fileInput.duplicates != nil {
+		f.checkRun(ctx)
+	}
+	return skipped
+}
+
+// emitToken emits a token of the file, which starts at start and is read up
+// to end, unless it is a header line
+func (f *Reader) emitToken(ctx context.Context, token []byte, start, end int64) {
+	f.entryEnd = end
+	f.entryStart = start
+	f.entryLength = int64(len(token))
+	if f.fileInput.nulPaddingThreshold > 0 && isNUL(token) {
+		// Lines of NUL bytes are padding that is shorter than the threshold
+	} else if f.checkHeader(ctx, token, f.Offset, end) {
+		// Header lines are parsed into labels rather than emitted
+	} else if f.fileInput.jsonArray {
+		f.emitArrayElement(ctx, token)
+	} else if f.fileInput.duplicates != nil {
+		if err := f.suppressDuplicate(ctx, token); err != nil {
+			f.Error("Failed to emit entry", zap.Error(err))
+		}
+	} else if err := f.emit(ctx, token); err != nil {
+		f.Error("Failed to emit entry", zap.Error(err))
+	}
+}
+
+// verifyCheckpoint returns true if the file still holds the bytes that were
+// read from it up to end. Otherwise, the read is abandoned and the file is
+// read again from the beginning on the next poll.
+func (f *Reader) verifyCheckpoint(checkpoint []byte, end int64) bool {
+	rewritten, err := f.checkRewritten(checkpoint, end)
+	if err != nil {
+		f.Errorw("Failed to check for rewrite", zap.Error(err))
+		return false
+	}
+	if !rewritten {
+		return true
+	}
+	if err := f.restartRewritten(end); err != nil {
+		f.Errorw("Failed to restart rewritten file", zap.Error(err))
+	}
+	return false
+}
+
+// splitFunc returns the split function of the file input. With multiline
+// patterns, it also returns the partial entry at the end of the file once it
+// should be flushed. A JSON array is split from the reader's offset.
+func (f *Reader) splitFunc() bufio.SplitFunc {
+	if f.fileInput.jsonArray {
+		return NewJSONArraySplitFunc(f.Offset == 0, f.fileInput.MaxLogSize)
+	}
+
+	split := f.encoding.splitFunc
+	if !f.fileInput.multiline {
+		return split
+	}
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		advance, token, err = split(data, atEOF)
+		if err != nil || advance > 0 || token != nil || !atEOF || len(data) == 0 {
+			return advance, token, err
+		}
+		if f.shouldFlush(int64(len(data))) {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// shouldFlush returns true if the partial entry at the end of the file should
+// be flushed, because the file input is stopping or the entry has not grown
+// for the force flush period, or since the last poll of a backfill
+func (f *Reader) shouldFlush(pending int64) bool {
+	if f.fileInput.flushing {
+		return true
+	}
+
+	now := time.Now()
+	if end := f.Offset + pending; end != f.pendingEnd {
+		f.pendingEnd = end
+		f.pendingSince = now
+		return false
+	}
+	if f.fileInput.backfill != nil {
+		// Backfilled files are not expected to grow, so the last entry is
+		// flushed once it is the same on two polls in a row
+		return true
+	}
+	period := f.fileInput.forceFlushPeriod
+	return period > 0 && now.Sub(f.pendingSince) >= period
+}
+
+// checkFinished records whether the file has been read to the end, and
+// whether it was already at the same end on the previous poll
+func (f *Reader) checkFinished() {
+	info, err := f.file.Stat()
+	if err != nil {
+		f.Errorw("Failed to check if file is finished", zap.Error(err))
+		f.finished = false
+		return
+	}
+
+	atEnd := f.Offset >= info.Size() || f.padded
+	if f.compressed {
+		atEnd = f.Complete
+	}
+	if !atEnd {
+		f.finished = false
+		f.endModTime = time.Time{}
+		return
+	}
+
+	f.finished = !f.endModTime.IsZero() && f.endSize == info.Size() && f.endModTime.Equal(info.ModTime())
+	f.endSize = info.Size()
+	f.endModTime = info.ModTime()
+}
+
+// checkTruncated resets the offset and fingerprint of a file that is smaller
+// than the offset, so that a file that was truncated in place is read again
+// from the beginning. A truncated file that was rewritten with the same first
+// bytes still matches its old fingerprint, so it is only detected here.
+func (f *Reader) checkTruncated() error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %s", err)
+	}
+	if info.Size() >= f.Offset {
+		return nil
 	}
+
+	f.Infow("File was truncated. Reading from the beginning", "offset", f.Offset, "size", info.Size())
+	if _, err := f.file.Seek(0, 0); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	fp, err := NewFingerprint(f.file, f.fileInput.fingerprintBytes)
+	if err != nil {
+		return err
+	}
+	f.Fingerprint = f.fileInput.trimFingerprint(fp)
+	f.Offset = 0
+	f.ArrayIndex = 0
+	f.checkpoint = nil
+	f.resetHeader()
+	f.watermarks.reset(f.fileInput.profiles, 0)
+	return nil
 }
 
 // Emit creates an entry with the decoded message and sends it to the next
@@ -114,21 +474,100 @@ func (f *Reader) emit(ctx context.Context, msgBuf []byte) error {
 		return fmt.Errorf("decode: %s", err)
 	}
 
-	e, err := f.fileInput.NewEntry(msg)
-	if err != nil {
-		return fmt.Errorf("create entry: %s", err)
-	}
+	return f.emitRecord(ctx, msg)
+}
 
-	if err := e.Set(f.fileInput.FilePathField, f.Path); err != nil {
+// emitRecord creates an entry with a record and the labels of the file, and
+// sends it to the next operator in the pipeline
+func (f *Reader) emitRecord(ctx context.Context, record interface{}) error {
+	e, err := f.newEntry(record)
+	if err != nil {
 		return err
 	}
-	if err := e.Set(f.fileInput.FileNameField, filepath.Base(f.Path)); err != nil {
-		return err
+	f.addOffsetLabels(e, f.entryStart, f.entryLength)
+	f.fileInput.backfill.countEntry()
+	if f.fileInput.profiles != nil {
+		f.fileInput.profiles.write(ctx, e, f.watermarks, f.entryEnd)
+		return nil
 	}
 	f.fileInput.Write(ctx, e)
 	return nil
 }
 
+// newEntry creates an entry with a record and the labels of the file
+func (f *Reader) newEntry(record interface{}) (*entry.Entry, error) {
+	e, err := f.fileInput.NewEntry(record)
+	if err != nil {
+		return nil, fmt.Errorf("create entry: %s", err)
+	}
+
+	for _, field := range f.pathFields() {
+		if isLabelField(field.field) {
+			continue
+		}
+		if err := e.Set(field.field, field.value); err != nil {
+			return nil, err
+		}
+	}
+
+	labels, err := f.labelSet()
+	if err != nil {
+		return nil, err
+	}
+	e.AddLabelSet(labels)
+	return e, nil
+}
+
+// labelSet returns the labels of the file, which are the labels of the input
+// without expressions, the path and name of the file if they are written to
+// labels, and the metadata and header labels of the file
+func (f *Reader) labelSet() (*entry.LabelSet, error) {
+	if f.labels != nil {
+		return f.labels, nil
+	}
+
+	labeled := &entry.Entry{}
+	for _, field := range f.pathFields() {
+		if !isLabelField(field.field) {
+			continue
+		}
+		if err := labeled.Set(field.field, field.value); err != nil {
+			return nil, err
+		}
+	}
+	f.addMetadataLabels(labeled)
+	for key, value := range f.HeaderLabels {
+		labeled.AddLabel(key, value)
+	}
+	if f.rewritten {
+		labeled.AddLabel("file_rewritten", "true")
+	}
+
+	f.labels = f.fileInput.LabelSet().With(labeled.Labels)
+	return f.labels, nil
+}
+
+// pathField is a field that the path or name of a file is written to
+type pathField struct {
+	field entry.Field
+	value string
+}
+
+// pathFields returns the fields that the path and name of the file are
+// written to
+func (f *Reader) pathFields() [2]pathField {
+	return [2]pathField{
+		{f.fileInput.FilePathField, f.Path},
+		{f.fileInput.FileNameField, filepath.Base(f.Path)},
+	}
+}
+
+// isLabelField returns true if a field is a label
+func isLabelField(field entry.Field) bool {
+	_, ok := field.FieldInterface.(entry.LabelField)
+	return ok
+}
+
 // decode converts the bytes in msgBuf to utf-8 from the configured encoding
 func (f *Reader) decode(msgBuf []byte) (string, error) {
 	for {
@@ -155,31 +594,46 @@ func getScannerError(scanner *PositionalScanner) error {
 }
 
 // NewFingerprintUpdatingReader creates a new FingerprintUpdatingReader starting starting at the given offset
-func NewFingerprintUpdatingReader(r io.Reader, offset int64, f *Fingerprint) *FingerprintUpdatingReader {
+func NewFingerprintUpdatingReader(r io.Reader, offset int64, f *Fingerprint, size int64) *FingerprintUpdatingReader {
 	return &FingerprintUpdatingReader{
 		fingerprint: f,
 		reader:      r,
 		offset:      offset,
+		size:        size,
 	}
 }
 
 // FingerprintUpdatingReader wraps another reader, and updates the fingerprint
-// with each read in the first 1000 bytes
+// with each read in the first size bytes
 type FingerprintUpdatingReader struct {
 	fingerprint *Fingerprint
 	reader      io.Reader
 	offset      int64
+	size        int64
+
+	// trimNULs removes the NUL bytes at the end of the fingerprint, which
+	// may be padding that is written over later
+	trimNULs bool
+
+	// reads is the number of reads from the wrapped reader
+	reads int
 }
 
 // Read reads from the wrapped reader, saving the read bytes to the fingerprint
 func (f *FingerprintUpdatingReader) Read(dst []byte) (int, error) {
-	if len(f.fingerprint.FirstBytes) == 1000 {
+	f.reads++
+	// A fingerprint that was saved with a smaller fingerprint_size is not
+	// extended once the reader is past its end
+	if int64(len(f.fingerprint.FirstBytes)) >= f.size || f.offset > int64(len(f.fingerprint.FirstBytes)) {
 		return f.reader.Read(dst)
 	}
 	n, err := f.reader.Read(dst)
-	appendCount := min0(n, 1000-int(f.offset))
+	appendCount := min0(n, int(f.size-f.offset))
 	f.fingerprint.FirstBytes = append(f.fingerprint.FirstBytes[:f.offset], dst[:appendCount]...)
 	f.offset += int64(n)
+	if f.trimNULs {
+		f.fingerprint.FirstBytes = trimNULPadding(f.fingerprint.FirstBytes)
+	}
 	return n, err
 }
 
@@ -190,16 +644,16 @@ type Fingerprint struct {
 
 // Copy creates a new copy of hte fingerprint
 func (f Fingerprint) Copy() *Fingerprint {
-	buf := make([]byte, 1000)
+	buf := make([]byte, len(f.FirstBytes))
 	n := copy(buf, f.FirstBytes)
 	return &Fingerprint{
 		FirstBytes: buf[:n],
 	}
 }
 
-// NewFingerprint creates a new fingerprint from an open file
-func NewFingerprint(file *os.File) (*Fingerprint, error) {
-	buf := make([]byte, 1000)
+// NewFingerprint creates a new fingerprint from the first size bytes of an open file
+func NewFingerprint(file *os.File, size int64) (*Fingerprint, error) {
+	buf := make([]byte, size)
 	n, err := file.Read(buf)
 	if err != nil && err != io.EOF {
 		return nil, fmt.Errorf("reading fingerprint bytes: %s", err)
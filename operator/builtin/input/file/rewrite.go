@@ -0,0 +1,95 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// checkpointSize is the number of bytes before the offset of a reader that
+// are compared with the file to detect that it was rewritten
+const checkpointSize = 64
+
+// nextCheckpoint returns the last bytes read from a file once the bytes
+// consumed by a token are read after the previous checkpoint
+func nextCheckpoint(checkpoint, consumed []byte) []byte {
+	return appendCheckpoint(nil, checkpoint, consumed)
+}
+
+// appendCheckpoint appends the next checkpoint to dst, so that its buffer
+// can be reused. dst must not share its buffer with the checkpoint.
+func appendCheckpoint(dst, checkpoint, consumed []byte) []byte {
+	if len(consumed) >= checkpointSize {
+		return append(dst, consumed[len(consumed)-checkpointSize:]...)
+	}
+	if keep := checkpointSize - len(consumed); len(checkpoint) > keep {
+		checkpoint = checkpoint[len(checkpoint)-keep:]
+	}
+	return append(append(dst, checkpoint...), consumed...)
+}
+
+// checkRewritten returns true if the file no longer holds the bytes that were
+// read from it, which means that it was modified other than by appending. The
+// first bytes of the file are compared with its fingerprint, and the bytes
+// just before end are compared with the checkpoint of the last bytes read.
+func (f *Reader) checkRewritten(checkpoint []byte, end int64) (bool, error) {
+	ok, err := f.fileHolds(f.Fingerprint.FirstBytes, 0)
+	if err != nil || !ok {
+		return !ok, err
+	}
+	ok, err = f.fileHolds(checkpoint, end-int64(len(checkpoint)))
+	return !ok, err
+}
+
+// fileHolds returns true if the file holds the expected bytes at an offset
+func (f *Reader) fileHolds(expected []byte, offset int64) (bool, error) {
+	if len(expected) == 0 {
+		return true, nil
+	}
+
+	if cap(f.holdsBuf) < len(expected) {
+		f.holdsBuf = make([]byte, len(expected))
+	}
+	buf := f.holdsBuf[:len(expected)]
+	n, err := f.file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("read checkpoint: %s", err)
+	}
+	return bytes.Equal(buf[:n], expected), nil
+}
+
+// restartRewritten marks a file that was rewritten to be read again from the
+// beginning on the next poll, once the rewrite has had time to finish. The
+// entries read again are labeled, so that they can be told apart downstream.
+// A file that was truncated while it was read is read again without a label,
+// the same as a file that was truncated between polls.
+func (f *Reader) restartRewritten(end int64) error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %s", err)
+	}
+	if info.Size() < end {
+		f.Infow("File was truncated while being read. Reading from the beginning", "offset", f.Offset, "size", info.Size())
+	} else {
+		f.Warnw("File was rewritten while being read. Reading from the beginning", "offset", f.Offset)
+		atomic.AddUint64(&f.fileInput.filesRewritten, 1)
+		f.rewritten = true
+		f.labels = nil
+	}
+
+	if _, err := f.file.Seek(0, 0); err != nil {
+		return fmt.Errorf("seek: %s", err)
+	}
+	fp, err := NewFingerprint(f.file, f.fileInput.fingerprintBytes)
+	if err != nil {
+		return err
+	}
+	f.Fingerprint = f.fileInput.trimFingerprint(fp)
+	f.Offset = 0
+	f.ArrayIndex = 0
+	f.checkpoint = nil
+	f.resetHeader()
+	f.watermarks.reset(f.fileInput.profiles, 0)
+	return nil
+}
@@ -0,0 +1,149 @@
+package file
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+)
+
+const (
+	// SizeUnitRawBytes measures max_log_size in the bytes of the file
+	SizeUnitRawBytes = "raw_bytes"
+	// SizeUnitDecodedBytes measures max_log_size in the bytes of an entry once decoded to utf-8
+	SizeUnitDecodedBytes = "decoded_bytes"
+	// SizeUnitRunes measures max_log_size in the characters of an entry
+	SizeUnitRunes = "runes"
+)
+
+// maxEncodedCharSize is the most bytes that any supported encoding uses for
+// a character, such as the 4 bytes of a utf-32 character or a surrogate pair
+const maxEncodedCharSize = 4
+
+// sizeLimit limits the size of entries read from a file. Entries are only
+// ever split between characters, so that a multibyte utf-8 character or a
+// utf-16 surrogate pair is never split across entries.
+type sizeLimit struct {
+	max      int
+	unit     string
+	encoding encoding.Encoding
+	utf8     bool
+}
+
+// newSizeLimit creates a limit of max units of an encoding. A max that is
+// not positive means that entries are not limited.
+func newSizeLimit(max int, unit string, enc encoding.Encoding) *sizeLimit {
+	return &sizeLimit{
+		max:      max,
+		unit:     unit,
+		encoding: enc,
+		utf8:     isUTF8(enc),
+	}
+}
+
+// bufferSize returns the most bytes of a file that hold max units
+func (l *sizeLimit) bufferSize() int {
+	if l.max <= 0 || l.unit == SizeUnitRawBytes {
+		return l.max
+	}
+	return l.max * maxEncodedCharSize
+}
+
+// exceeded returns true if a token is larger than the limit
+func (l *sizeLimit) exceeded(token []byte) bool {
+	if l.max <= 0 {
+		return false
+	}
+	if l.unit == SizeUnitRawBytes {
+		return len(token) > l.max
+	}
+
+	// A character is never smaller than its decoded utf-8 bytes divided by
+	// three, so small tokens are not decoded
+	bound := len(token)
+	if l.unit == SizeUnitDecodedBytes && !l.utf8 {
+		bound *= 3
+	}
+	if bound <= l.max {
+		return false
+	}
+	return l.cut(token) < len(token)
+}
+
+// cut returns the length of the longest prefix of data that is within the
+// limit and ends between two characters. If the first character alone is
+// larger than the limit, it is returned whole so that reading progresses.
+func (l *sizeLimit) cut(data []byte) int {
+	var n int
+	if l.utf8 {
+		n = l.cutUTF8(data)
+	} else {
+		n = l.cutDecoded(data)
+	}
+
+	if n == 0 && len(data) > 0 {
+		n = len(data)
+		if l.max > 0 && l.max < n {
+			n = l.max
+		}
+	}
+	return n
+}
+
+// cutUTF8 cuts utf-8 data, whose decoded bytes are its raw bytes
+func (l *sizeLimit) cutUTF8(data []byte) int {
+	if l.unit == SizeUnitRunes {
+		i := 0
+		for runes := 0; runes < l.max && i < len(data) && utf8.FullRune(data[i:]); runes++ {
+			_, size := utf8.DecodeRune(data[i:])
+			i += size
+		}
+		return i
+	}
+
+	if len(data) <= l.max {
+		return len(data)
+	}
+	for i := l.max; i > l.max-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(data[i]) {
+			return i
+		}
+	}
+	// The data is not utf-8, so it is cut at the limit
+	return l.max
+}
+
+// cutDecoded cuts data by decoding it into a buffer the size of the limit,
+// since a decoder only writes whole characters
+func (l *sizeLimit) cutDecoded(data []byte) int {
+	decoder := l.encoding.NewDecoder()
+
+	switch l.unit {
+	case SizeUnitDecodedBytes:
+		_, nSrc, _ := decoder.Transform(make([]byte, l.max), data, false)
+		return nSrc
+	case SizeUnitRunes:
+		dst := make([]byte, l.max*utf8.UTFMax)
+		nDst, nSrc, _ := decoder.Transform(dst, data, false)
+
+		end, runes := 0, 0
+		for end < nDst && runes < l.max {
+			_, size := utf8.DecodeRune(dst[end:nDst])
+			end += size
+			runes++
+		}
+		if end == nDst {
+			return nSrc
+		}
+
+		decoder.Reset()
+		_, nSrc, _ = decoder.Transform(dst[:end], data, false)
+		return nSrc
+	default:
+		src := data
+		if len(src) > l.max {
+			src = src[:l.max]
+		}
+		_, nSrc, _ := decoder.Transform(make([]byte, len(src)*3), src, false)
+		return nSrc
+	}
+}
@@ -0,0 +1,68 @@
+package file
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestSizeLimitScanner(t *testing.T) {
+	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+
+	cases := []struct {
+		name     string
+		encoding encoding.Encoding
+		unit     string
+		max      int
+		input    string
+		expected []string
+	}{
+		{"ASCIIAtLimit", encoding.Nop, SizeUnitRawBytes, 4, "abcd\nabcde\n", []string{"abcd", "abcd", "e"}},
+		{"EmojiRawBytes", encoding.Nop, SizeUnitRawBytes, 6, "😀😀😀\n", []string{"😀", "😀", "😀"}},
+		{"EmojiRawBytesAtLimit", encoding.Nop, SizeUnitRawBytes, 8, "😀😀\n😀😀😀\n", []string{"😀😀", "😀😀", "😀"}},
+		{"EmojiRawBytesOffset", encoding.Nop, SizeUnitRawBytes, 9, "a😀😀😀\n", []string{"a😀😀", "😀"}},
+		{"EmojiDecodedBytes", encoding.Nop, SizeUnitDecodedBytes, 10, "😀😀😀\n", []string{"😀😀", "😀"}},
+		{"EmojiRunesAtLimit", encoding.Nop, SizeUnitRunes, 2, "😀😀\n😀😀😀\n", []string{"😀😀", "😀😀", "😀"}},
+		{"MixedRunes", encoding.Nop, SizeUnitRunes, 3, "ab😀cd\n", []string{"ab😀", "cd"}},
+		{"UTF8Runes", unicode.UTF8, SizeUnitRunes, 3, "折折折折\n", []string{"折折折", "折"}},
+		{"UTF16RawBytesSurrogatePair", utf16le, SizeUnitRawBytes, 6, "ab😀\n", []string{"ab", "😀"}},
+		{"UTF16RawBytesAtLimit", utf16le, SizeUnitRawBytes, 8, "abcd\nabcde\n", []string{"abcd", "abcd", "e"}},
+		{"UTF16DecodedBytesAtLimit", utf16le, SizeUnitDecodedBytes, 4, "abcd\nabcde\n", []string{"abcd", "abcd", "e"}},
+		{"UTF16DecodedBytesSurrogatePair", utf16le, SizeUnitDecodedBytes, 5, "😀😀\n", []string{"😀", "😀"}},
+		{"UTF16RunesAtLimit", utf16le, SizeUnitRunes, 2, "😀😀\n😀😀😀\n", []string{"😀😀", "😀😀", "😀"}},
+		{"UTF16RunesMixed", utf16le, SizeUnitRunes, 3, "a😀折b😀\n", []string{"a😀折", "b😀"}},
+		{"CharacterLargerThanLimit", encoding.Nop, SizeUnitDecodedBytes, 2, "a😀\n", []string{"a", "\xf0\x9f", "\x98\x80"}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			input, err := tc.encoding.NewEncoder().String(tc.input)
+			require.NoError(t, err)
+			splitFunc, err := NewNewlineSplitFunc(tc.encoding)
+			require.NoError(t, err)
+			limit := newSizeLimit(tc.max, tc.unit, tc.encoding)
+
+			// Reading one byte at a time finds the limit before the delimiter
+			for _, reader := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input))} {
+				scanner := newLimitedPositionalScanner(reader, limit, 0, splitFunc)
+				tokens := []string{}
+				for scanner.Scan() {
+					token, err := tc.encoding.NewDecoder().Bytes(scanner.Bytes())
+					require.NoError(t, err)
+					tokens = append(tokens, string(token))
+				}
+				require.NoError(t, scanner.Err())
+				require.Equal(t, tc.expected, tokens)
+				require.Equal(t, int64(len(input)), scanner.Pos())
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// Supported watch modes
+const (
+	WatchModePoll   = "poll"
+	WatchModeNotify = "notify"
+	WatchModeAuto   = "auto"
+)
+
+// maxCoalescedEvents is the most events that are drained from the watcher
+// before the files they are about are read, so that a steady stream of
+// events cannot hold off reading
+const maxCoalescedEvents = 4096
+
+// dirWatcher watches the directories that may contain files matching the
+// include patterns. Directories along the static prefix of each pattern are
+// watched at startup, and directories created below them are watched as they
+// appear, so that a tree created with several levels at once is followed.
+type dirWatcher struct {
+	*fsnotify.Watcher
+	include [][]string
+	watched map[string]struct{}
+}
+
+// newDirWatcher creates a watcher of the directories along the static prefix
+// of each include pattern, and of the existing directories below it that
+// match the pattern. If the static prefix does not exist yet, its nearest
+// existing parent is watched instead.
+func newDirWatcher(include []string) (*dirWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &dirWatcher{
+		Watcher: watcher,
+		include: splitIncludes(include),
+		watched: make(map[string]struct{}),
+	}
+
+	// The directories below the static prefix that already exist are watched
+	// as well, so that writes to the files in them are noticed
+	for _, pattern := range include {
+		dir := existingDir(staticDir(pattern))
+		ok, err := w.watchTree(dir)
+		if err == nil && !ok {
+			err = w.watch(dir)
+		}
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// existingDir returns a directory if it exists, or else its nearest parent
+// that exists
+func existingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// useNotify returns true if files are followed with notifications in the
+// watch mode of the operator. In auto mode, notifications are not used if
+// any include pattern is on a network filesystem, since changes made by
+// other hosts are not notified.
+func (f *InputOperator) useNotify() bool {
+	switch f.watchMode {
+	case WatchModeNotify:
+		return true
+	case WatchModeAuto:
+		for _, pattern := range f.Include {
+			if fs, ok := networkFilesystem(existingDir(staticDir(pattern))); ok {
+				f.Infow("Include pattern is on a network filesystem, where notifications are unreliable. Polling instead",
+					"pattern", pattern,
+					"filesystem", fs,
+				)
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// watch adds a watch on a directory if it is not already watched
+func (w *dirWatcher) watch(dir string) error {
+	if _, ok := w.watched[dir]; ok {
+		return nil
+	}
+	if err := w.Add(dir); err != nil {
+		return err
+	}
+	w.watched[dir] = struct{}{}
+	return nil
+}
+
+// forget removes a deleted directory from the watched set. The watch itself
+// is removed by the operating system.
+func (w *dirWatcher) forget(dir string) {
+	delete(w.watched, dir)
+}
+
+// watchTree watches a newly created directory if it may contain matching
+// files, along with any of its subdirectories that were created before the
+// watch was added. It returns false if the directory cannot contain matches.
+func (w *dirWatcher) watchTree(dir string) (bool, error) {
+	if !w.mayContainMatches(dir) {
+		return false, nil
+	}
+	if err := w.watch(dir); err != nil {
+		return true, err
+	}
+
+	children, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return true, err
+	}
+	for _, child := range children {
+		if !child.IsDir() {
+			continue
+		}
+		if _, err := w.watchTree(filepath.Join(dir, child.Name())); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// mayContainMatches returns true if a directory matches the leading elements
+// of at least one include pattern
+func (w *dirWatcher) mayContainMatches(dir string) bool {
+	elems := splitPath(dir)
+	for _, pattern := range w.include {
+		if len(elems) < len(pattern) && matchElems(pattern, elems) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopedMatches returns the paths under a newly created path that match the
+// include patterns and do not match the exclude patterns. Only the new path
+// is searched, rather than every include pattern in full.
+func (f *InputOperator) scopedMatches(path string, isDir bool) []string {
+	elems := splitPath(path)
+	matches := make([]string, 0, 1)
+	for i, pattern := range splitIncludes(f.Include) {
+		if len(elems) > len(pattern) || !matchElems(pattern, elems) {
+			continue
+		}
+
+		if len(elems) == len(pattern) {
+			if !isDir {
+				matches = append(matches, path)
+			}
+			continue
+		}
+
+		scoped := filepath.Join(append([]string{path}, pattern[len(elems):]...)...)
+		globbed, err := filepath.Glob(scoped)
+		if err != nil {
+			f.Warnw("Failed to match include pattern", "pattern", f.Include[i], zap.Error(err))
+			continue
+		}
+		matches = append(matches, globbed...)
+	}
+
+	filtered := matches[:0]
+	seen := make(map[string]struct{}, len(matches))
+MATCHES:
+	for _, match := range matches {
+		if _, ok := seen[match]; ok {
+			continue
+		}
+		seen[match] = struct{}{}
+		for _, exclude := range f.Exclude {
+			if excluded, _ := filepath.Match(exclude, match); excluded {
+				continue MATCHES
+			}
+		}
+		filtered = append(filtered, match)
+	}
+	return filtered
+}
+
+// handleEvents reads the files that an event, and the events queued behind
+// it, are about. Events that arrive while files are read queue up in the
+// watcher, so they are drained first, and each file is read once however
+// many times it was written.
+func (f *InputOperator) handleEvents(ctx context.Context, w *dirWatcher, event fsnotify.Event) {
+	changed := make(map[string]struct{})
+	f.collectEvent(w, event, changed)
+DRAIN:
+	for i := 1; i < maxCoalescedEvents; i++ {
+		select {
+		case event := <-w.Events:
+			f.collectEvent(w, event, changed)
+		default:
+			break DRAIN
+		}
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	f.readChanged(ctx, paths)
+}
+
+// collectEvent adds the matching files that an event is about to the changed
+// paths. A file that is written is read, and a directory that is created is
+// watched, and its matching files are read.
+func (f *InputOperator) collectEvent(w *dirWatcher, event fsnotify.Event, changed map[string]struct{}) {
+	path := filepath.Clean(event.Name)
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.forget(path)
+		return
+	}
+	if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+		return
+	}
+
+	isDir := false
+	if event.Op&fsnotify.Create != 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		isDir = info.IsDir()
+	}
+	if isDir {
+		ok, err := w.watchTree(path)
+		if err != nil {
+			f.Warnw("Failed to watch new directory", "path", path, zap.Error(err))
+		}
+		if !ok {
+			return
+		}
+	}
+
+	for _, match := range f.scopedMatches(path, isDir) {
+		changed[match] = struct{}{}
+	}
+}
+
+// readChanged reads files that changed between polls, no more than the max
+// concurrent files at once. The reader of each file replaces the known reader
+// of the same file, rather than being added next to it, so that reading a
+// file on each of its writes does not grow the known files. Known files are
+// still aged by polls.
+func (f *InputOperator) readChanged(ctx context.Context, paths []string) {
+	if f.aliasedFiles == nil {
+		f.aliasedFiles = make(map[string]bool)
+	}
+
+	for len(paths) > 0 && ctx.Err() == nil {
+		batch := paths
+		if len(batch) > f.maxConcurrent {
+			batch = batch[:f.maxConcurrent]
+		}
+		paths = paths[len(batch):]
+
+		for _, reader := range f.readBatch(ctx, batch, nil, f.aliasedFiles, false) {
+			for i := 0; i < len(f.knownFiles); {
+				known := f.knownFiles[i]
+				if known.Path == reader.Path && reader.Fingerprint.Matches(known.Fingerprint) {
+					f.knownFiles = append(f.knownFiles[:i], f.knownFiles[i+1:]...)
+					continue
+				}
+				i++
+			}
+			f.knownFiles = append(f.knownFiles, reader)
+		}
+	}
+	f.syncLastPollFiles()
+}
+
+// splitIncludes splits each include pattern into its path elements
+func splitIncludes(include []string) [][]string {
+	patterns := make([][]string, 0, len(include))
+	for _, pattern := range include {
+		patterns = append(patterns, splitPath(pattern))
+	}
+	return patterns
+}
+
+// splitPath splits a cleaned path into its elements. The first element of an
+// absolute path is empty.
+func splitPath(path string) []string {
+	return strings.Split(filepath.Clean(path), string(filepath.Separator))
+}
+
+// matchElems returns true if the path elements match the leading elements of
+// the pattern
+func matchElems(pattern, elems []string) bool {
+	for i, elem := range elems {
+		if ok, err := filepath.Match(pattern[i], elem); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// staticDir returns the deepest directory of a pattern that does not contain
+// any wildcards
+func staticDir(pattern string) string {
+	elems := splitPath(pattern)
+	static := 0
+	for static < len(elems)-1 && !hasMeta(elems[static]) {
+		static++
+	}
+
+	dir := strings.Join(elems[:static], string(filepath.Separator))
+	switch {
+	case dir != "":
+		return dir
+	case filepath.IsAbs(pattern) || static > 0:
+		return string(filepath.Separator)
+	default:
+		return "."
+	}
+}
+
+// hasMeta returns true if a path element contains glob wildcards
+func hasMeta(elem string) bool {
+	magic := `*?[\`
+	if runtime.GOOS == "windows" {
+		magic = `*?[`
+	}
+	return strings.ContainsAny(elem, magic)
+}
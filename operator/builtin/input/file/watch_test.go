@@ -0,0 +1,241 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows paths are not covered by these cases")
+	}
+
+	cases := []struct {
+		pattern  string
+		expected string
+	}{
+		{"/var/log/*.log", "/var/log"},
+		{"/var/log/pods/*/*/*.log", "/var/log/pods"},
+		{"/var/log/app.log", "/var/log"},
+		{"/*.log", "/"},
+		{"/var/log/[ab]/*.log", "/var/log"},
+		{"logs/*.log", "logs"},
+		{"./logs/*/*.log", "logs"},
+		{"*.log", "."},
+		{"*/app.log", "."},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			require.Equal(t, tc.expected, staticDir(tc.pattern))
+		})
+	}
+}
+
+func TestScopedMatches(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	for _, path := range []string{
+		"a/1/app.log",
+		"a/1/app.txt",
+		"a/2/app.log",
+		"a/2/skip.log",
+		"b/1/app.log",
+	} {
+		path = filepath.Join(tempDir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte("testlog\n"), 0666))
+	}
+
+	operator := &InputOperator{
+		Include: []string{filepath.Join(tempDir, "*", "*", "*.log")},
+		Exclude: []string{filepath.Join(tempDir, "*", "*", "skip.log")},
+	}
+
+	cases := []struct {
+		name     string
+		path     string
+		isDir    bool
+		expected []string
+	}{
+		{"Parent", "a", true, []string{"a/1/app.log", "a/2/app.log"}},
+		{"Directory", "a/1", true, []string{"a/1/app.log"}},
+		{"File", "b/1/app.log", false, []string{"b/1/app.log"}},
+		{"Excluded", "a/2/skip.log", false, []string{}},
+		{"Unmatched", "a/1/app.txt", false, []string{}},
+		{"TooDeep", "a/1/app.log/x", true, []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := make([]string, 0, len(tc.expected))
+			for _, path := range tc.expected {
+				expected = append(expected, filepath.Join(tempDir, filepath.FromSlash(path)))
+			}
+			matches := operator.scopedMatches(filepath.Join(tempDir, filepath.FromSlash(tc.path)), tc.isDir)
+			require.ElementsMatch(t, expected, matches)
+		})
+	}
+}
+
+func TestWatchNewDirectories(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.PollInterval = helper.Duration{Duration: time.Hour}
+		cfg.WatchMode = WatchModeNotify
+	}, nil)
+	operator.Include = []string{filepath.Join(tempDir, "pods", "*", "*", "*.log")}
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	// Create several levels at once, followed immediately by the file
+	nested := filepath.Join(tempDir, "pods", "pod1", "container1")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(nested, "0.log"), []byte("testlog1\n"), 0666))
+
+	waitForMessage(t, logReceived, "testlog1")
+
+	// Directories that appear later are followed as well
+	nested = filepath.Join(tempDir, "pods", "pod1", "container2")
+	require.NoError(t, os.Mkdir(nested, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(nested, "0.log"), []byte("testlog2\n"), 0666))
+
+	waitForMessage(t, logReceived, "testlog2")
+}
+
+func TestWatchExistingDirectories(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.PollInterval = helper.Duration{Duration: time.Hour}
+		cfg.ScanInterval = helper.Duration{Duration: time.Hour}
+		cfg.WatchMode = WatchModeNotify
+	}, nil)
+	operator.Include = []string{filepath.Join(tempDir, "pods", "*", "*", "*.log")}
+
+	// Directories that match a wildcard at startup are watched right away,
+	// rather than after the next scan
+	pod := filepath.Join(tempDir, "pods", "pod1")
+	require.NoError(t, os.MkdirAll(filepath.Join(pod, "container1"), 0755))
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(pod, "container1", "0.log"), []byte("testlog1\n"), 0666))
+	waitForMessage(t, logReceived, "testlog1")
+
+	require.NoError(t, os.Mkdir(filepath.Join(pod, "container2"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(pod, "container2", "0.log"), []byte("testlog2\n"), 0666))
+	waitForMessage(t, logReceived, "testlog2")
+}
+
+func TestWatchUnmatchedDirectories(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.PollInterval = helper.Duration{Duration: time.Hour}
+		cfg.WatchMode = WatchModeNotify
+	}, nil)
+	operator.Include = []string{filepath.Join(tempDir, "pods", "*", "*.log")}
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+
+	nested := filepath.Join(tempDir, "other", "pod1")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(nested, "0.log"), []byte("testlog\n"), 0666))
+
+	expectNoMessages(t, logReceived)
+}
+
+func TestWatchWrites(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, func(cfg *InputConfig) {
+		cfg.PollInterval = helper.Duration{Duration: time.Hour}
+		cfg.ScanInterval = helper.Duration{Duration: time.Hour}
+		cfg.WatchMode = WatchModeNotify
+	}, nil)
+	operator.Include = []string{filepath.Join(tempDir, "*", "*.log")}
+
+	// Files in directories that exist at startup are followed, and are read
+	// when they are written rather than when the filesystem is polled
+	dir := filepath.Join(tempDir, "app")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	temp := openFile(t, filepath.Join(dir, "0.log"))
+	writeString(t, temp, "testlog1\n")
+
+	require.NoError(t, operator.Start())
+	defer operator.Stop()
+	waitForMessage(t, logReceived, "testlog1")
+
+	writeString(t, temp, "testlog2\n")
+	waitForMessage(t, logReceived, "testlog2")
+
+	// Each read replaces the known reader of the file
+	for i := 0; i < 100; i++ {
+		writeString(t, temp, fmt.Sprintf("burst%d\n", i))
+	}
+	for i := 0; i < 100; i++ {
+		waitForMessage(t, logReceived, fmt.Sprintf("burst%d", i))
+	}
+	expectNoMessages(t, logReceived)
+}
+
+func TestReadChanged(t *testing.T) {
+	t.Parallel()
+	operator, logReceived, tempDir := newTestFileOperator(t, nil, nil)
+
+	temp := openTemp(t, tempDir)
+	writeString(t, temp, "testlog1\n")
+	operator.poll(context.Background())
+	waitForMessage(t, logReceived, "testlog1")
+	known := len(operator.knownFiles)
+
+	// Reading a file that changed replaces its known reader, however often
+	// it is read between polls
+	for i := 0; i < 10; i++ {
+		writeString(t, temp, fmt.Sprintf("testlog%d\n", i+2))
+		operator.readChanged(context.Background(), []string{temp.Name()})
+		waitForMessage(t, logReceived, fmt.Sprintf("testlog%d", i+2))
+	}
+	require.Len(t, operator.knownFiles, known)
+}
+
+func TestCollectEvents(t *testing.T) {
+	t.Parallel()
+	operator, _, tempDir := newTestFileOperator(t, nil, nil)
+	operator.Include = []string{filepath.Join(tempDir, "*.log")}
+	operator.Exclude = []string{filepath.Join(tempDir, "skip.log")}
+
+	watcher, err := newDirWatcher(operator.Include)
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	// Many writes to the same files are coalesced into a read of each
+	changed := make(map[string]struct{})
+	for i := 0; i < 10; i++ {
+		for _, name := range []string{"a.log", "b.log", "skip.log", "c.txt"} {
+			event := fsnotify.Event{Name: filepath.Join(tempDir, name), Op: fsnotify.Write}
+			operator.collectEvent(watcher, event, changed)
+		}
+	}
+	require.Equal(t, map[string]struct{}{
+		filepath.Join(tempDir, "a.log"): {},
+		filepath.Join(tempDir, "b.log"): {},
+	}, changed)
+
+	// Removed files are not read
+	changed = make(map[string]struct{})
+	operator.collectEvent(watcher, fsnotify.Event{Name: filepath.Join(tempDir, "a.log"), Op: fsnotify.Remove}, changed)
+	operator.collectEvent(watcher, fsnotify.Event{Name: filepath.Join(tempDir, "a.log"), Op: fsnotify.Chmod}, changed)
+	require.Empty(t, changed)
+}
@@ -35,9 +35,10 @@ func NewJournaldInputConfig(operatorID string) *JournaldInputConfig {
 type JournaldInputConfig struct {
 	helper.InputConfig `yaml:",inline"`
 
-	Directory *string  `json:"directory,omitempty" yaml:"directory,omitempty"`
-	Files     []string `json:"files,omitempty"     yaml:"files,omitempty"`
-	StartAt   string   `json:"start_at,omitempty"  yaml:"start_at,omitempty"`
+	Directory   *string  `json:"directory,omitempty"    yaml:"directory,omitempty"`
+	Files       []string `json:"files,omitempty"        yaml:"files,omitempty"`
+	StartAt     string   `json:"start_at,omitempty"     yaml:"start_at,omitempty"`
+	PreviousIDs []string `json:"previous_ids,omitempty" yaml:"previous_ids,omitempty"`
 }
 
 // Build will build a journald input operator from the supplied configuration
@@ -77,7 +78,7 @@ func (c JournaldInputConfig) Build(buildContext operator.BuildContext) ([]operat
 
 	journaldInput := &JournaldInput{
 		InputOperator: inputOperator,
-		persist:       helper.NewScopedDBPersister(buildContext.Database, c.ID()),
+		persist:       helper.NewMigratingDBPersister(buildContext.Database, c.ID(), c.PreviousIDs, inputOperator.SugaredLogger).WithWriteBehind(buildContext.WriteBehind),
 		newCmd: func(ctx context.Context, cursor []byte) cmd {
 			if cursor != nil {
 				args = append(args, "--after-cursor", string(cursor))
@@ -18,14 +18,21 @@ func init() {
 func NewInputConfig(operatorID string) *InputConfig {
 	return &InputConfig{
 		InputConfig: helper.NewInputConfig(operatorID, "stanza_input"),
-		BufferSize:  100,
+		QueueSize:   100,
 	}
 }
 
 // InputConfig is the configuration of a stanza input operator.
 type InputConfig struct {
 	helper.InputConfig `yaml:",inline"`
-	BufferSize         int `json:"buffer_size" yaml:"buffer_size"`
+	QueueSize          int `json:"queue_size" yaml:"queue_size"`
+}
+
+// DeprecatedFields returns the renamed fields of a stanza input config.
+func (c *InputConfig) DeprecatedFields() []operator.DeprecatedField {
+	return []operator.DeprecatedField{
+		{Name: "buffer_size", Replacement: "queue_size"},
+	}
 }
 
 // Build will build a stanza input operator.
@@ -35,7 +42,7 @@ func (c *InputConfig) Build(context operator.BuildContext) ([]operator.Operator,
 		return nil, err
 	}
 
-	receiver := make(logger.Receiver, c.BufferSize)
+	receiver := make(logger.Receiver, c.QueueSize)
 	context.Logger.AddReceiver(receiver)
 
 	input := &Input{
@@ -7,6 +7,7 @@ import (
 	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestStanzaOperator(t *testing.T) {
@@ -47,3 +48,17 @@ func TestStanzaOperatorBUildFailure(t *testing.T) {
 	_, err := cfg.Build(bc)
 	require.Error(t, err)
 }
+
+func TestStanzaOperatorDeprecatedBufferSize(t *testing.T) {
+	var cfg operator.Config
+	deprecations, err := operator.CollectDeprecations(func() error {
+		return yaml.UnmarshalStrict([]byte("type: stanza_input\nid: internal\nbuffer_size: 10\n"), &cfg)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 10, cfg.Builder.(*InputConfig).QueueSize)
+
+	expected := []operator.Deprecation{
+		{OperatorID: "internal", Field: "buffer_size", Replacement: "queue_size"},
+	}
+	require.Equal(t, expected, deprecations)
+}
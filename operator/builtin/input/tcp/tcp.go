@@ -2,10 +2,13 @@ package tcp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/operator/helper"
@@ -16,10 +19,25 @@ func init() {
 	operator.Register("tcp_input", func() operator.Builder { return NewTCPInputConfig("") })
 }
 
+const (
+	// defaultMaxLogSize is the default maximum size of an entry
+	defaultMaxLogSize = 1024 * 1024
+
+	// remoteAddressLabel is the label that holds the address of the client
+	remoteAddressLabel = "remote_address"
+
+	// minAcceptDelay and maxAcceptDelay bound the wait before accepting again
+	// after a temporary error, such as running out of file descriptors
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
 // NewTCPInputConfig creates a new TCP input config with default values
 func NewTCPInputConfig(operatorID string) *TCPInputConfig {
 	return &TCPInputConfig{
-		InputConfig: helper.NewInputConfig(operatorID, "tcp_input"),
+		InputConfig:          helper.NewInputConfig(operatorID, "tcp_input"),
+		MaxLogSize:           defaultMaxLogSize,
+		IncludeRemoteAddress: true,
 	}
 }
 
@@ -27,7 +45,11 @@ func NewTCPInputConfig(operatorID string) *TCPInputConfig {
 type TCPInputConfig struct {
 	helper.InputConfig `yaml:",inline"`
 
-	ListenAddress string `json:"listen_address,omitempty" yaml:"listen_address,omitempty"`
+	ListenAddress        string            `json:"listen_address,omitempty"         yaml:"listen_address,omitempty" required:"true"`
+	MaxLogSize           int               `json:"max_log_size,omitempty"           yaml:"max_log_size,omitempty"`
+	MaxConnections       int               `json:"max_connections,omitempty"        yaml:"max_connections,omitempty"`
+	IncludeRemoteAddress bool              `json:"include_remote_address,omitempty" yaml:"include_remote_address,omitempty"`
+	TLS                  *helper.TLSConfig `json:"tls,omitempty"                    yaml:"tls,omitempty"`
 }
 
 // Build will build a tcp input operator.
@@ -46,31 +68,91 @@ func (c TCPInputConfig) Build(context operator.BuildContext) ([]operator.Operato
 		return nil, fmt.Errorf("failed to resolve listen_address: %s", err)
 	}
 
+	if c.MaxLogSize <= 0 {
+		return nil, fmt.Errorf("invalid max_log_size '%d', must be greater than 0", c.MaxLogSize)
+	}
+
+	if c.MaxConnections < 0 {
+		return nil, fmt.Errorf("invalid max_connections '%d', must not be negative", c.MaxConnections)
+	}
+
+	var tlsConfig *tls.Config
+	if c.TLS != nil {
+		tlsConfig, err = c.serverTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	tcpInput := &TCPInput{
-		InputOperator: inputOperator,
-		address:       address,
+		InputOperator:        inputOperator,
+		address:              address,
+		maxLogSize:           c.MaxLogSize,
+		includeRemoteAddress: c.IncludeRemoteAddress,
+		tlsConfig:            tlsConfig,
+	}
+	if c.MaxConnections > 0 {
+		tcpInput.connections = make(chan struct{}, c.MaxConnections)
 	}
 	return []operator.Operator{tcpInput}, nil
 }
 
+// serverTLSConfig loads the TLS configuration of the listener. A listener
+// does not verify servers, so ca_file verifies clients, as it did before
+// client_ca was added, unless client_ca is set.
+func (c TCPInputConfig) serverTLSConfig() (*tls.Config, error) {
+	if c.TLS.CertFile == "" {
+		return nil, fmt.Errorf("tls requires both cert_file and key_file")
+	}
+
+	tlsConfig := *c.TLS
+	if tlsConfig.ClientCA == "" {
+		tlsConfig.ClientCA = tlsConfig.CAFile
+	}
+	tlsConfig.CAFile = ""
+	return tlsConfig.LoadTLSConfig()
+}
+
 // TCPInput is an operator that listens for log entries over tcp.
 type TCPInput struct {
 	helper.InputOperator
-	address *net.TCPAddr
+	address              *net.TCPAddr
+	maxLogSize           int
+	includeRemoteAddress bool
+	tlsConfig            *tls.Config
 
-	listener *net.TCPListener
+	// connections holds a slot for each open connection when the number of
+	// connections is limited
+	connections chan struct{}
+
+	listener net.Listener
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
 }
 
-// Start will start listening for log entries over tcp.
-func (t *TCPInput) Start() error {
+// Bind will open the listener of the operator before it starts.
+func (t *TCPInput) Bind() error {
 	listener, err := net.ListenTCP("tcp", t.address)
 	if err != nil {
 		return fmt.Errorf("failed to listen on interface: %w", err)
 	}
 
 	t.listener = listener
+	return nil
+}
+
+// Start will start listening for log entries over tcp.
+func (t *TCPInput) Start() error {
+	if t.listener == nil {
+		if err := t.Bind(); err != nil {
+			return err
+		}
+	}
+
+	if t.tlsConfig != nil {
+		t.listener = tls.NewListener(t.listener, t.tlsConfig)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	t.cancel = cancel
 	t.goListen(ctx)
@@ -84,15 +166,41 @@ func (t *TCPInput) goListen(ctx context.Context) {
 	go func() {
 		defer t.wg.Done()
 
+		var delay time.Duration
 		for {
-			conn, err := t.listener.AcceptTCP()
+			conn, err := t.listener.Accept()
 			if err != nil {
 				select {
 				case <-ctx.Done():
 					return
 				default:
-					t.Debugw("Listener accept error", zap.Error(err))
 				}
+
+				// Back off on temporary errors, and stop listening on the others,
+				// which do not go away by accepting again
+				if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
+					t.Errorw("Stopped listening because of an accept error", zap.Error(err))
+					return
+				}
+				if delay == 0 {
+					delay = minAcceptDelay
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				t.Warnw("Listener accept error, retrying", zap.Error(err), "delay", delay)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				continue
+			}
+			delay = 0
+
+			if !t.acquireConnection() {
+				t.Warnw("Closing connection because the maximum number of connections is open", "remote_address", conn.RemoteAddr().String())
+				conn.Close()
+				continue
 			}
 
 			t.Debugf("Received connection: %s", conn.RemoteAddr().String())
@@ -103,12 +211,34 @@ func (t *TCPInput) goListen(ctx context.Context) {
 	}()
 }
 
+// acquireConnection takes a slot for a connection, returning false if the
+// maximum number of connections is open
+func (t *TCPInput) acquireConnection() bool {
+	if t.connections == nil {
+		return true
+	}
+	select {
+	case t.connections <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseConnection frees the slot of a closed connection
+func (t *TCPInput) releaseConnection() {
+	if t.connections != nil {
+		<-t.connections
+	}
+}
+
 // goHandleClose will wait for the context to finish before closing a connection.
 func (t *TCPInput) goHandleClose(ctx context.Context, conn net.Conn) {
 	t.wg.Add(1)
 
 	go func() {
 		defer t.wg.Done()
+		defer t.releaseConnection()
 		<-ctx.Done()
 		t.Debugf("Closing connection: %s", conn.RemoteAddr().String())
 		if err := conn.Close(); err != nil {
@@ -125,13 +255,19 @@ func (t *TCPInput) goHandleMessages(ctx context.Context, conn net.Conn, cancel c
 		defer t.wg.Done()
 		defer cancel()
 
+		remoteAddress := conn.RemoteAddr().String()
 		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 0, 4096), t.maxLogSize+1)
+		scanner.Split(newlineSplitFunc(t.maxLogSize))
 		for scanner.Scan() {
 			entry, err := t.NewEntry(scanner.Text())
 			if err != nil {
 				t.Errorw("Failed to create entry", zap.Error(err))
 				continue
 			}
+			if t.includeRemoteAddress {
+				entry.AddLabel(remoteAddressLabel, remoteAddress)
+			}
 			t.Write(ctx, entry)
 		}
 		if err := scanner.Err(); err != nil {
@@ -140,14 +276,41 @@ func (t *TCPInput) goHandleMessages(ctx context.Context, conn net.Conn, cancel c
 	}()
 }
 
+// newlineSplitFunc splits newline delimited entries, with any trailing
+// carriage return removed. Lines longer than maxLogSize are split into
+// entries of maxLogSize.
+func newlineSplitFunc(maxLogSize int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, '\n'); i >= 0 && i <= maxLogSize {
+			return i + 1, bytes.TrimSuffix(data[:i], []byte{'\r'}), nil
+		}
+		if len(data) >= maxLogSize {
+			return maxLogSize, data[:maxLogSize], nil
+		}
+		if atEOF {
+			return len(data), bytes.TrimSuffix(data, []byte{'\r'}), nil
+		}
+		return 0, nil, nil
+	}
+}
+
 // Stop will stop listening for log entries over TCP.
 func (t *TCPInput) Stop() error {
-	t.cancel()
+	if t.cancel != nil {
+		t.cancel()
+	}
 
+	if t.listener == nil {
+		return nil
+	}
 	if err := t.listener.Close(); err != nil {
 		return err
 	}
 
 	t.wg.Wait()
+	t.listener = nil
 	return nil
 }
@@ -1,12 +1,25 @@
 package tcp
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
 	"net"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -64,6 +77,233 @@ func TestTcpInput(t *testing.T) {
 	t.Run("CarriageReturn", tcpInputTest([]byte("message\r\n"), []string{"message"}))
 }
 
+// startTCPInput builds and starts a tcp input that sends its entries to the returned channel
+func startTCPInput(t *testing.T, cfgMod func(*TCPInputConfig)) (*TCPInput, chan *entry.Entry) {
+	cfg := NewTCPInputConfig("test_id")
+	cfg.ListenAddress = "127.0.0.1:0"
+	if cfgMod != nil {
+		cfgMod(cfg)
+	}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	tcpInput := ops[0].(*TCPInput)
+
+	fakeOutput := testutil.NewFakeOutput(t)
+	tcpInput.InputOperator.OutputOperators = []operator.Operator{fakeOutput}
+
+	require.NoError(t, tcpInput.Start())
+	t.Cleanup(func() { _ = tcpInput.Stop() })
+	return tcpInput, fakeOutput.Received
+}
+
+func expectEntry(t *testing.T, entryChan chan *entry.Entry) *entry.Entry {
+	select {
+	case e := <-entryChan:
+		return e
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for message to be written")
+		return nil
+	}
+}
+
+func TestTcpInputRemoteAddress(t *testing.T) {
+	tcpInput, entryChan := startTCPInput(t, nil)
+
+	conn, err := net.Dial("tcp", tcpInput.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("message\n"))
+	require.NoError(t, err)
+
+	e := expectEntry(t, entryChan)
+	require.Equal(t, "message", e.Record)
+	require.Equal(t, conn.LocalAddr().String(), e.Labels[remoteAddressLabel])
+}
+
+func TestTcpInputMaxLogSize(t *testing.T) {
+	tcpInput, entryChan := startTCPInput(t, func(cfg *TCPInputConfig) {
+		cfg.MaxLogSize = 10
+		cfg.IncludeRemoteAddress = false
+	})
+
+	conn, err := net.Dial("tcp", tcpInput.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Lines longer than max_log_size are split, without closing the connection
+	_, err = conn.Write([]byte(strings.Repeat("a", 25) + "\nshort\n"))
+	require.NoError(t, err)
+
+	for _, expected := range []string{strings.Repeat("a", 10), strings.Repeat("a", 10), "aaaaa", "short"} {
+		e := expectEntry(t, entryChan)
+		require.Equal(t, expected, e.Record)
+		require.Nil(t, e.Labels)
+	}
+}
+
+func TestTcpInputMaxConnections(t *testing.T) {
+	tcpInput, entryChan := startTCPInput(t, func(cfg *TCPInputConfig) {
+		cfg.MaxConnections = 1
+	})
+
+	first, err := net.Dial("tcp", tcpInput.listener.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = first.Write([]byte("first\n"))
+	require.NoError(t, err)
+	require.Equal(t, "first", expectEntry(t, entryChan).Record)
+
+	// The second connection is closed while the first is open
+	second, err := net.Dial("tcp", tcpInput.listener.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = second.Read(make([]byte, 1))
+	require.Error(t, err)
+	netErr, ok := err.(net.Error)
+	require.False(t, ok && netErr.Timeout(), "Expected the connection to be closed")
+
+	// Once the first connection closes, another can be opened
+	first.Close()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", tcpInput.listener.Addr().String())
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("third\n")); err != nil {
+			return false
+		}
+		select {
+		case e := <-entryChan:
+			return e.Record == "third"
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// writeCertificate writes a self signed certificate and its key to a directory
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestTcpInputTLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, testutil.NewTempDir(t))
+	tcpInput, entryChan := startTCPInput(t, func(cfg *TCPInputConfig) {
+		cfg.TLS = &helper.TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile}
+	})
+
+	pemBytes, err := ioutil.ReadFile(certFile)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(pemBytes))
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	conn, err := tls.Dial("tcp", tcpInput.listener.Addr().String(), &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("secure\n"))
+	require.NoError(t, err)
+	require.Equal(t, "secure", expectEntry(t, entryChan).Record)
+}
+
+// TLSRequiresClientCert tests that a listener with a ca_file, but no
+// client_ca, still rejects clients without a certificate signed by it
+func TestTcpInputTLSRequiresClientCert(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, testutil.NewTempDir(t))
+	tcpInput, _ := startTCPInput(t, func(cfg *TCPInputConfig) {
+		cfg.TLS = &helper.TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile}
+	})
+
+	pemBytes, err := ioutil.ReadFile(certFile)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(pemBytes))
+
+	conn, err := tls.Dial("tcp", tcpInput.listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		// With TLS 1.3, the client learns that it was rejected on its first read
+		defer conn.Close()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+	}
+	require.Error(t, err)
+	netErr, ok := err.(net.Error)
+	require.False(t, ok && netErr.Timeout(), "Expected the handshake to fail")
+}
+
+func TestTcpInputConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, testutil.NewTempDir(t))
+
+	cases := []struct {
+		name      string
+		modify    func(*TCPInputConfig)
+		expectErr bool
+	}{
+		{"Default", func(cfg *TCPInputConfig) {}, false},
+		{"MissingAddress", func(cfg *TCPInputConfig) { cfg.ListenAddress = "" }, true},
+		{"ZeroMaxLogSize", func(cfg *TCPInputConfig) { cfg.MaxLogSize = 0 }, true},
+		{"NegativeMaxConnections", func(cfg *TCPInputConfig) { cfg.MaxConnections = -1 }, true},
+		{"TLS", func(cfg *TCPInputConfig) { cfg.TLS = &helper.TLSConfig{CertFile: certFile, KeyFile: keyFile} }, false},
+		{"TLSMissingKey", func(cfg *TCPInputConfig) { cfg.TLS = &helper.TLSConfig{CertFile: certFile} }, true},
+		{"TLSInvalidCA", func(cfg *TCPInputConfig) {
+			cfg.TLS = &helper.TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: keyFile}
+		}, true},
+		{"TLSMissingCert", func(cfg *TCPInputConfig) { cfg.TLS = &helper.TLSConfig{ClientCA: certFile} }, true},
+		{"TLSClientCA", func(cfg *TCPInputConfig) {
+			cfg.TLS = &helper.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCA: certFile}
+		}, false},
+		{"TLSInvalidClientCA", func(cfg *TCPInputConfig) {
+			cfg.TLS = &helper.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCA: keyFile}
+		}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewTCPInputConfig("test_id")
+			cfg.ListenAddress = "127.0.0.1:0"
+			tc.modify(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
 func BenchmarkTcpInput(b *testing.B) {
 	cfg := NewTCPInputConfig("test_id")
 	cfg.ListenAddress = ":0"
@@ -103,3 +343,86 @@ func BenchmarkTcpInput(b *testing.B) {
 
 	defer close(done)
 }
+
+func TestTcpInputBindBeforeStart(t *testing.T) {
+	cfg := NewTCPInputConfig("test_id")
+	cfg.ListenAddress = "127.0.0.1:0"
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	tcpInput := ops[0].(*TCPInput)
+
+	fakeOutput := testutil.NewFakeOutput(t)
+	tcpInput.InputOperator.OutputOperators = []operator.Operator{fakeOutput}
+
+	require.NoError(t, tcpInput.Bind())
+	address := tcpInput.listener.Addr().String()
+
+	// The listener that was bound is the one that is started
+	require.NoError(t, tcpInput.Start())
+	defer tcpInput.Stop()
+	require.Equal(t, address, tcpInput.listener.Addr().String())
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("message\n"))
+	require.NoError(t, err)
+	require.Equal(t, "message", expectEntry(t, fakeOutput.Received).Record)
+}
+
+// acceptError is a net.Error returned by failingListener
+type acceptError struct {
+	temporary bool
+}
+
+func (e acceptError) Error() string   { return "accept failed" }
+func (e acceptError) Timeout() bool   { return false }
+func (e acceptError) Temporary() bool { return e.temporary }
+
+// failingListener is a listener whose accepts fail with temporary errors,
+// and then with a permanent one
+type failingListener struct {
+	net.Listener
+	temporary int
+	accepts   int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts++
+	if l.accepts <= l.temporary {
+		return nil, acceptError{temporary: true}
+	}
+	return nil, errors.New("listener closed")
+}
+
+func (l *failingListener) Close() error { return nil }
+
+func TestTcpInputAcceptErrors(t *testing.T) {
+	cfg := NewTCPInputConfig("test_id")
+	cfg.ListenAddress = "127.0.0.1:0"
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	tcpInput := ops[0].(*TCPInput)
+
+	// Temporary errors are retried, and a permanent error stops the listener
+	// instead of spinning on it
+	listener := &failingListener{temporary: 3}
+	tcpInput.listener = listener
+	require.NoError(t, tcpInput.Start())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tcpInput.wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for the listener to stop")
+	}
+	require.Equal(t, 4, listener.accepts)
+	require.NoError(t, tcpInput.Stop())
+}
@@ -15,10 +15,23 @@ func init() {
 	operator.Register("udp_input", func() operator.Builder { return NewUDPInputConfig("") })
 }
 
+const (
+	// defaultMaxLogSize is the default size of the buffer that datagrams are read into
+	defaultMaxLogSize = 8192
+
+	// maxDatagramSize is the largest payload of a udp datagram
+	maxDatagramSize = 65507
+
+	// remoteAddressLabel is the label that holds the address of the sender
+	remoteAddressLabel = "remote_address"
+)
+
 // NewUDPInputConfig creates a new UDP input config with default values
 func NewUDPInputConfig(operatorID string) *UDPInputConfig {
 	return &UDPInputConfig{
-		InputConfig: helper.NewInputConfig(operatorID, "udp_input"),
+		InputConfig:          helper.NewInputConfig(operatorID, "udp_input"),
+		MaxLogSize:           defaultMaxLogSize,
+		IncludeRemoteAddress: true,
 	}
 }
 
@@ -26,7 +39,10 @@ func NewUDPInputConfig(operatorID string) *UDPInputConfig {
 type UDPInputConfig struct {
 	helper.InputConfig `yaml:",inline"`
 
-	ListenAddress string `json:"listen_address,omitempty" yaml:"listen_address,omitempty"`
+	ListenAddress        string `json:"listen_address,omitempty"         yaml:"listen_address,omitempty" required:"true"`
+	MaxLogSize           int    `json:"max_log_size,omitempty"           yaml:"max_log_size,omitempty"`
+	ReadBufferSize       int    `json:"read_buffer_size,omitempty"       yaml:"read_buffer_size,omitempty"`
+	IncludeRemoteAddress bool   `json:"include_remote_address,omitempty" yaml:"include_remote_address,omitempty"`
 }
 
 // Build will build a udp input operator.
@@ -45,10 +61,20 @@ func (c UDPInputConfig) Build(context operator.BuildContext) ([]operator.Operato
 		return nil, fmt.Errorf("failed to resolve listen_address: %s", err)
 	}
 
+	if c.MaxLogSize <= 0 || c.MaxLogSize > maxDatagramSize {
+		return nil, fmt.Errorf("invalid max_log_size '%d', must be between 1 and %d", c.MaxLogSize, maxDatagramSize)
+	}
+
+	if c.ReadBufferSize < 0 {
+		return nil, fmt.Errorf("invalid read_buffer_size '%d', must not be negative", c.ReadBufferSize)
+	}
+
 	udpInput := &UDPInput{
-		InputOperator: inputOperator,
-		address:       address,
-		buffer:        make([]byte, 8192),
+		InputOperator:        inputOperator,
+		address:              address,
+		buffer:               make([]byte, c.MaxLogSize),
+		readBufferSize:       c.ReadBufferSize,
+		includeRemoteAddress: c.IncludeRemoteAddress,
 	}
 	return []operator.Operator{udpInput}, nil
 }
@@ -57,23 +83,41 @@ func (c UDPInputConfig) Build(context operator.BuildContext) ([]operator.Operato
 type UDPInput struct {
 	buffer []byte
 	helper.InputOperator
-	address *net.UDPAddr
+	address              *net.UDPAddr
+	readBufferSize       int
+	includeRemoteAddress bool
 
 	connection net.PacketConn
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
 }
 
-// Start will start listening for messages on a socket.
-func (u *UDPInput) Start() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	u.cancel = cancel
-
+// Bind will open the socket of the operator before it starts.
+func (u *UDPInput) Bind() error {
 	conn, err := net.ListenUDP("udp", u.address)
 	if err != nil {
 		return fmt.Errorf("failed to open connection: %s", err)
 	}
+	if u.readBufferSize > 0 {
+		if err := conn.SetReadBuffer(u.readBufferSize); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to set read_buffer_size: %s", err)
+		}
+	}
 	u.connection = conn
+	return nil
+}
+
+// Start will start listening for messages on a socket.
+func (u *UDPInput) Start() error {
+	if u.connection == nil {
+		if err := u.Bind(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
 
 	u.goHandleMessages(ctx)
 	return nil
@@ -87,7 +131,7 @@ func (u *UDPInput) goHandleMessages(ctx context.Context) {
 		defer u.wg.Done()
 
 		for {
-			message, err := u.readMessage()
+			message, remoteAddr, err := u.readMessage()
 			if err != nil {
 				select {
 				case <-ctx.Done():
@@ -104,29 +148,39 @@ func (u *UDPInput) goHandleMessages(ctx context.Context) {
 				continue
 			}
 
+			if u.includeRemoteAddress && remoteAddr != nil {
+				entry.AddLabel(remoteAddressLabel, remoteAddr.String())
+			}
+
 			u.Write(ctx, entry)
 		}
 	}()
 }
 
-// readMessage will read log messages from the connection.
-func (u *UDPInput) readMessage() (string, error) {
-	n, _, err := u.connection.ReadFrom(u.buffer)
+// readMessage will read log messages from the connection, along with the
+// address they were sent from. Datagrams larger than the buffer are truncated.
+func (u *UDPInput) readMessage() (string, net.Addr, error) {
+	n, addr, err := u.connection.ReadFrom(u.buffer)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// Remove trailing characters and NULs
 	for ; (n > 0) && (u.buffer[n-1] < 32); n-- {
 	}
 
-	return string(u.buffer[:n]), nil
+	return string(u.buffer[:n]), addr, nil
 }
 
 // Stop will stop listening for udp messages.
 func (u *UDPInput) Stop() error {
-	u.cancel()
-	u.connection.Close()
+	if u.cancel != nil {
+		u.cancel()
+	}
+	if u.connection != nil {
+		u.connection.Close()
+	}
 	u.wg.Wait()
+	u.connection = nil
 	return nil
 }
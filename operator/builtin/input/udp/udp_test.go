@@ -61,6 +61,65 @@ func udpInputTest(input []byte, expected []string) func(t *testing.T) {
 	}
 }
 
+func TestUDPInputRemoteAddressAndTruncation(t *testing.T) {
+	cfg := NewUDPInputConfig("test_input")
+	cfg.ListenAddress = "127.0.0.1:0"
+	cfg.MaxLogSize = 5
+	cfg.ReadBufferSize = 65536
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	udpInput := ops[0].(*UDPInput)
+	fakeOutput := testutil.NewFakeOutput(t)
+	udpInput.InputOperator.OutputOperators = []operator.Operator{fakeOutput}
+
+	require.NoError(t, udpInput.Start())
+	defer udpInput.Stop()
+
+	conn, err := net.Dial("udp", udpInput.connection.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("message1"))
+	require.NoError(t, err)
+
+	select {
+	case e := <-fakeOutput.Received:
+		// Datagrams larger than max_log_size are truncated
+		require.Equal(t, "messa", e.Record)
+		require.Equal(t, conn.LocalAddr().String(), e.Labels[remoteAddressLabel])
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for message to be written")
+	}
+}
+
+func TestUDPInputConfig(t *testing.T) {
+	cases := []struct {
+		name      string
+		modify    func(*UDPInputConfig)
+		expectErr bool
+	}{
+		{"Default", func(cfg *UDPInputConfig) {}, false},
+		{"ZeroMaxLogSize", func(cfg *UDPInputConfig) { cfg.MaxLogSize = 0 }, true},
+		{"MaxLogSizeTooLarge", func(cfg *UDPInputConfig) { cfg.MaxLogSize = maxDatagramSize + 1 }, true},
+		{"NegativeReadBufferSize", func(cfg *UDPInputConfig) { cfg.ReadBufferSize = -1 }, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewUDPInputConfig("test_input")
+			cfg.ListenAddress = "127.0.0.1:0"
+			tc.modify(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
 func TestUDPInput(t *testing.T) {
 	t.Run("Simple", udpInputTest([]byte("message1"), []string{"message1"}))
 	t.Run("TrailingNewlines", udpInputTest([]byte("message1\n"), []string{"message1"}))
@@ -107,3 +166,37 @@ func BenchmarkUdpInput(b *testing.B) {
 
 	defer close(done)
 }
+
+func TestUDPInputBindBeforeStart(t *testing.T) {
+	cfg := NewUDPInputConfig("test_id")
+	cfg.ListenAddress = "127.0.0.1:0"
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	udpInput := ops[0].(*UDPInput)
+
+	fakeOutput := testutil.NewFakeOutput(t)
+	udpInput.InputOperator.OutputOperators = []operator.Operator{fakeOutput}
+
+	require.NoError(t, udpInput.Bind())
+	address := udpInput.connection.LocalAddr().String()
+
+	// The socket that was bound is the one that is started
+	require.NoError(t, udpInput.Start())
+	defer udpInput.Stop()
+	require.Equal(t, address, udpInput.connection.LocalAddr().String())
+
+	conn, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("message1"))
+	require.NoError(t, err)
+
+	select {
+	case e := <-fakeOutput.Received:
+		require.Equal(t, "message1", e.Record)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for message to be written")
+	}
+}
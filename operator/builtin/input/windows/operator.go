@@ -19,10 +19,11 @@ func init() {
 // EventLogConfig is the configuration of a windows event log operator.
 type EventLogConfig struct {
 	helper.InputConfig `yaml:",inline"`
-	Channel            string          `json:"channel" yaml:"channel"`
+	Channel            string          `json:"channel" yaml:"channel" required:"true"`
 	MaxReads           int             `json:"max_reads,omitempty" yaml:"max_reads,omitempty"`
 	StartAt            string          `json:"start_at,omitempty" yaml:"start_at,omitempty"`
 	PollInterval       helper.Duration `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty"`
+	PreviousIDs        []string        `json:"previous_ids,omitempty" yaml:"previous_ids,omitempty"`
 }
 
 // Build will build a windows event log operator.
@@ -44,7 +45,7 @@ func (c *EventLogConfig) Build(context operator.BuildContext) ([]operator.Operat
 		return nil, fmt.Errorf("the `start_at` field must be set to `beginning` or `end`")
 	}
 
-	offsets := helper.NewScopedDBPersister(context.Database, c.ID())
+	offsets := helper.NewMigratingDBPersister(context.Database, c.ID(), c.PreviousIDs, inputOperator.SugaredLogger).WithWriteBehind(context.WriteBehind)
 
 	eventLogInput := &EventLogInput{
 		InputOperator: inputOperator,
@@ -128,6 +129,14 @@ func (e *EventLogInput) Stop() error {
 	return nil
 }
 
+// SaveState will stop reading events, and save the bookmark of the last event sent.
+// The subscription stays open until the operator is stopped.
+func (e *EventLogInput) SaveState() error {
+	e.cancel()
+	e.wg.Wait()
+	return e.offsets.Sync()
+}
+
 // readOnInterval will read events with respect to the polling interval.
 func (e *EventLogInput) readOnInterval(ctx context.Context) {
 	defer e.wg.Done()
@@ -167,14 +176,32 @@ func (e *EventLogInput) read(ctx context.Context) int {
 		return 0
 	}
 
-	for i, event := range events {
+	// The bookmark is moved to the last event sent before reading stopped. An
+	// event sent while reading stopped may not have reached the output, so it
+	// is read again after a restart.
+	sent := 0
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
 		e.processEvent(ctx, event)
-		if len(events) == i+1 {
-			e.updateBookmarkOffset(event)
+		if ctx.Err() != nil {
+			break
 		}
+		sent++
+	}
+
+	if sent > 0 {
+		e.updateBookmarkOffset(events[sent-1])
+	}
+
+	for _, event := range events {
 		event.Close()
 	}
 
+	if ctx.Err() != nil {
+		return 0
+	}
 	return len(events)
 }
 
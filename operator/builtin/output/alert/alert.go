@@ -0,0 +1,356 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+)
+
+func init() {
+	operator.Register("alert_output", func() operator.Builder { return NewAlertOutputConfig("") })
+}
+
+// NewAlertOutputConfig creates a new alert output config with default values
+func NewAlertOutputConfig(operatorID string) *AlertOutputConfig {
+	return &AlertOutputConfig{
+		OutputConfig:  helper.NewOutputConfig(operatorID, "alert_output"),
+		Cooldown:      helper.NewDuration(time.Minute),
+		Timeout:       helper.NewDuration(10 * time.Second),
+		MaxConcurrent: 4,
+		QueueSize:     100,
+	}
+}
+
+// AlertOutputConfig is the configuration of an alert output operator
+type AlertOutputConfig struct {
+	helper.OutputConfig `yaml:",inline"`
+
+	Expression    string                  `json:"expr"                     yaml:"expr"                     required:"true"`
+	Key           helper.ExprStringConfig `json:"key,omitempty"            yaml:"key,omitempty"`
+	Cooldown      helper.Duration         `json:"cooldown,omitempty"       yaml:"cooldown,omitempty"`
+	Command       []string                `json:"command,omitempty"        yaml:"command,omitempty,flow"`
+	URL           string                  `json:"url,omitempty"            yaml:"url,omitempty"`
+	Timeout       helper.Duration         `json:"timeout,omitempty"        yaml:"timeout,omitempty"`
+	MaxConcurrent int                     `json:"max_concurrent,omitempty" yaml:"max_concurrent,omitempty"`
+	QueueSize     int                     `json:"queue_size,omitempty"     yaml:"queue_size,omitempty"`
+	TLS           *helper.TLSConfig       `json:"tls,omitempty"            yaml:"tls,omitempty"`
+}
+
+// Build will build an alert output operator
+func (c AlertOutputConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	outputOperator, err := c.OutputConfig.BuildWithoutFlusher(context)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Expression == "" {
+		return nil, fmt.Errorf("missing required parameter 'expr'")
+	}
+
+	compiled, err := expr.Compile(c.Expression, expr.AsBool(), expr.AllowUndefinedVariables())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile expression '%s': %w", c.Expression, err)
+	}
+
+	key, err := c.Key.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build key: %w", err)
+	}
+
+	switch {
+	case len(c.Command) == 0 && c.URL == "":
+		return nil, fmt.Errorf("one of 'command' or 'url' is required")
+	case len(c.Command) != 0 && c.URL != "":
+		return nil, fmt.Errorf("only one of 'command' or 'url' can be defined")
+	}
+
+	if c.MaxConcurrent < 1 {
+		return nil, fmt.Errorf("max_concurrent must be greater than zero")
+	}
+
+	if c.QueueSize < 1 {
+		return nil, fmt.Errorf("queue_size must be greater than zero")
+	}
+
+	client := &http.Client{}
+	if c.TLS != nil {
+		if c.URL == "" {
+			return nil, fmt.Errorf("tls can only be used with 'url'")
+		}
+		tlsConfig, err := c.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+
+	alertOutput := &AlertOutput{
+		OutputOperator: outputOperator,
+		expression:     compiled,
+		key:            key,
+		cooldown:       c.Cooldown.Raw(),
+		command:        c.Command,
+		url:            c.URL,
+		client:         client,
+		timeout:        c.Timeout.Raw(),
+		maxConcurrent:  c.MaxConcurrent,
+		queue:          make(chan alert, c.QueueSize),
+		pending:        make(map[string]bool),
+		lastFired:      make(map[string]time.Time),
+	}
+
+	return []operator.Operator{alertOutput}, nil
+}
+
+// AlertOutput is an operator that runs an action for each matching entry.
+// Actions run in the background so that a slow or failing action never blocks
+// the pipeline. Matches that arrive while the queue is full are dropped.
+type AlertOutput struct {
+	// stats is accessed atomically, so it must remain 64-bit aligned
+	stats AlertStats
+
+	helper.OutputOperator
+
+	expression    *vm.Program
+	key           *helper.ExprString
+	cooldown      time.Duration
+	command       []string
+	url           string
+	client        *http.Client
+	timeout       time.Duration
+	maxConcurrent int
+
+	queue chan alert
+
+	// pending holds the keys of the alerts that are queued or running, and
+	// lastFired the time each key last finished an action, until its
+	// cooldown ends
+	pending    map[string]bool
+	lastFired  map[string]time.Time
+	nextExpiry time.Time
+	mux        sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// alert is an entry queued to run an alert action, with its key
+type alert struct {
+	key   string
+	entry *entry.Entry
+}
+
+// AlertStats are the counters of an alert output
+type AlertStats struct {
+	Fired      uint64
+	Suppressed uint64
+	Dropped    uint64
+	Failed     uint64
+}
+
+// Start will start the workers that run alert actions
+func (a *AlertOutput) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+
+	for i := 0; i < a.maxConcurrent; i++ {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.work(ctx)
+		}()
+	}
+	return nil
+}
+
+// Stop will stop the workers, abandoning any queued alerts
+func (a *AlertOutput) Stop() error {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.wg.Wait()
+	return nil
+}
+
+// Process will queue an alert if the entry matches. It never blocks.
+func (a *AlertOutput) Process(ctx context.Context, e *entry.Entry) error {
+	env := helper.GetExprEnv(e)
+	defer helper.PutExprEnv(env)
+
+	matches, err := vm.Run(a.expression, env)
+	if err != nil {
+		a.Warnw("Running expression returned an error", zap.Error(err))
+		return nil
+	}
+
+	// we compile the expression with "AsBool", so this should be safe
+	if !matches.(bool) {
+		return nil
+	}
+
+	key, err := a.key.Render(env)
+	if err != nil {
+		a.Warnw("Failed to render alert key", zap.Error(err))
+		return nil
+	}
+
+	if !a.reserve(key, time.Now()) {
+		atomic.AddUint64(&a.stats.Suppressed, 1)
+		return nil
+	}
+
+	select {
+	case a.queue <- alert{key: key, entry: e.Copy()}:
+	default:
+		a.release(key, false, time.Now())
+		atomic.AddUint64(&a.stats.Dropped, 1)
+		a.Warnw("Alert queue is full. Dropping alert", "key", key)
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the counters of the alert output
+func (a *AlertOutput) Stats() AlertStats {
+	return AlertStats{
+		Fired:      atomic.LoadUint64(&a.stats.Fired),
+		Suppressed: atomic.LoadUint64(&a.stats.Suppressed),
+		Dropped:    atomic.LoadUint64(&a.stats.Dropped),
+		Failed:     atomic.LoadUint64(&a.stats.Failed),
+	}
+}
+
+// reserve returns true if an alert for the key can be raised, because the key
+// has no alert queued or running and is not in its cooldown period. The key
+// is then reserved until its alert is released. Without a cooldown, every
+// alert is raised.
+func (a *AlertOutput) reserve(key string, now time.Time) bool {
+	if a.cooldown <= 0 {
+		return true
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.expire(now)
+	if a.pending[key] {
+		return false
+	}
+	if last, ok := a.lastFired[key]; ok && now.Sub(last) < a.cooldown {
+		return false
+	}
+	a.pending[key] = true
+	return true
+}
+
+// release ends the reservation of a key. The cooldown of the key only starts
+// if its action ran, so that an alert that was dropped or failed does not
+// suppress the next one.
+func (a *AlertOutput) release(key string, fired bool, now time.Time) {
+	if a.cooldown <= 0 {
+		return
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	delete(a.pending, key)
+	if fired {
+		a.lastFired[key] = now
+	}
+}
+
+// expire removes the keys whose cooldown has ended, at most once per
+// cooldown period, so that keys taken from entries do not accumulate
+func (a *AlertOutput) expire(now time.Time) {
+	if now.Before(a.nextExpiry) {
+		return
+	}
+	for key, last := range a.lastFired {
+		if now.Sub(last) >= a.cooldown {
+			delete(a.lastFired, key)
+		}
+	}
+	a.nextExpiry = now.Add(a.cooldown)
+}
+
+// work runs alert actions from the queue until the context is cancelled
+func (a *AlertOutput) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case queued := <-a.queue:
+			atomic.AddUint64(&a.stats.Fired, 1)
+			err := a.run(ctx, queued.entry)
+			a.release(queued.key, err == nil, time.Now())
+			if err != nil {
+				atomic.AddUint64(&a.stats.Failed, 1)
+				a.Errorw("Failed to run alert action", zap.Error(err))
+			}
+		}
+	}
+}
+
+// run runs the configured action for an entry
+func (a *AlertOutput) run(ctx context.Context, e *entry.Entry) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	if len(a.command) > 0 {
+		return a.exec(ctx, payload)
+	}
+	return a.post(ctx, payload)
+}
+
+// exec runs the configured command with the entry as JSON on stdin
+func (a *AlertOutput) exec(ctx context.Context, payload []byte) error {
+	cmd := exec.CommandContext(ctx, a.command[0], a.command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("command '%s' failed: %s: %s", a.command[0], err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// post sends the entry as JSON to the configured url
+func (a *AlertOutput) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", a.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("request returned status %s: %s", res.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAlertOutput(t *testing.T, cfgMod func(*AlertOutputConfig)) *AlertOutput {
+	cfg := NewAlertOutputConfig("test")
+	cfg.Expression = `$record.level == "FATAL"`
+	cfg.URL = "http://localhost"
+	if cfgMod != nil {
+		cfgMod(cfg)
+	}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	return ops[0].(*AlertOutput)
+}
+
+func newFatalEntry(service string) *entry.Entry {
+	e := entry.New()
+	e.Record = map[string]interface{}{
+		"level":   "FATAL",
+		"service": service,
+	}
+	return e
+}
+
+func TestAlertOutputBuild(t *testing.T) {
+	cases := []struct {
+		name        string
+		modify      func(*AlertOutputConfig)
+		expectedErr string
+	}{
+		{"Default", func(c *AlertOutputConfig) {}, ""},
+		{"Command", func(c *AlertOutputConfig) { c.URL = ""; c.Command = []string{"true"} }, ""},
+		{"MissingExpr", func(c *AlertOutputConfig) { c.Expression = "" }, "missing required parameter 'expr'"},
+		{"InvalidExpr", func(c *AlertOutputConfig) { c.Expression = "$record ==" }, "failed to compile expression"},
+		{"MissingAction", func(c *AlertOutputConfig) { c.URL = "" }, "one of 'command' or 'url' is required"},
+		{"BothActions", func(c *AlertOutputConfig) { c.Command = []string{"true"} }, "only one of 'command' or 'url'"},
+		{"ZeroConcurrent", func(c *AlertOutputConfig) { c.MaxConcurrent = 0 }, "max_concurrent must be greater than zero"},
+		{"ZeroQueue", func(c *AlertOutputConfig) { c.QueueSize = 0 }, "queue_size must be greater than zero"},
+		{"TLS", func(c *AlertOutputConfig) { c.TLS = &helper.TLSConfig{InsecureSkipVerify: true} }, ""},
+		{"TLSWithCommand", func(c *AlertOutputConfig) {
+			c.URL = ""
+			c.Command = []string{"true"}
+			c.TLS = &helper.TLSConfig{}
+		}, "tls can only be used with 'url'"},
+		{"TLSMissingCA", func(c *AlertOutputConfig) { c.TLS = &helper.TLSConfig{CAFile: "missing.pem"} }, "read ca_file: open missing.pem"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewAlertOutputConfig("test")
+			cfg.Expression = "true"
+			cfg.URL = "http://localhost"
+			tc.modify(cfg)
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expectedErr)
+		})
+	}
+}
+
+func TestAlertOutputWebhook(t *testing.T) {
+	received := make(chan map[string]interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	}))
+	defer server.Close()
+
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) { c.URL = server.URL })
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	info := entry.New()
+	info.Record = map[string]interface{}{"level": "INFO"}
+	require.NoError(t, op.Process(context.Background(), info))
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+
+	select {
+	case body := <-received:
+		require.Equal(t, "FATAL", body["record"].(map[string]interface{})["level"])
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for webhook")
+	}
+
+	select {
+	case <-received:
+		require.FailNow(t, "non-matching entry triggered an alert")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAlertOutputWebhookTLS(t *testing.T) {
+	received := make(chan struct{}, 10)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(testutil.NewTempDir(t), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, certPEM, 0600))
+
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.URL = server.URL
+		c.TLS = &helper.TLSConfig{CAFile: caFile}
+	})
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for webhook")
+	}
+}
+
+func TestAlertOutputCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on a posix shell")
+	}
+
+	output := filepath.Join(testutil.NewTempDir(t), "alert.json")
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.URL = ""
+		c.Command = []string{"sh", "-c", "cat > " + output}
+	})
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+
+	require.Eventually(t, func() bool {
+		contents, err := ioutil.ReadFile(output)
+		return err == nil && len(contents) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	contents, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	require.Contains(t, string(contents), `"service":"api"`)
+}
+
+func TestAlertOutputCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on a posix shell")
+	}
+
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.URL = ""
+		c.Command = []string{"sleep", "10"}
+		c.Timeout = helper.NewDuration(10 * time.Millisecond)
+	})
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+	require.Eventually(t, func() bool {
+		return op.Stats().Failed == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestAlertOutputCooldown(t *testing.T) {
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.Key = "EXPR($record.service)"
+		c.Cooldown = helper.NewDuration(time.Hour)
+	})
+
+	// Not started, so queued alerts remain in the queue
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("db")))
+
+	require.Len(t, op.queue, 2)
+	require.Equal(t, uint64(1), op.Stats().Suppressed)
+
+	// The cooldown starts once the queued alert has fired
+	now := time.Now()
+	require.False(t, op.reserve("api", now))
+	op.release("api", true, now)
+	require.False(t, op.reserve("api", now.Add(time.Minute)))
+	require.True(t, op.reserve("api", now.Add(2*time.Hour)))
+}
+
+func TestAlertOutputCooldownNotFired(t *testing.T) {
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.Cooldown = helper.NewDuration(time.Hour)
+		c.QueueSize = 1
+	})
+
+	// An alert that is dropped because the queue is full does not start a cooldown
+	op.queue <- alert{entry: newFatalEntry("db")}
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+	require.Equal(t, uint64(1), op.Stats().Dropped)
+	require.Empty(t, op.lastFired)
+	<-op.queue
+	require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+	require.Len(t, op.queue, 1)
+
+	// An alert whose action failed does not start a cooldown either
+	now := time.Now()
+	op.release("", false, now)
+	require.True(t, op.reserve("", now))
+}
+
+func TestAlertOutputCooldownExpiry(t *testing.T) {
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.Cooldown = helper.NewDuration(time.Minute)
+	})
+
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		require.True(t, op.reserve(key, now))
+		op.release(key, true, now)
+	}
+	require.Len(t, op.lastFired, 3)
+
+	// The keys are removed once their cooldown ends
+	require.True(t, op.reserve("d", now.Add(2*time.Minute)))
+	require.Empty(t, op.lastFired)
+}
+
+func TestAlertOutputNonBlocking(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	op := newTestAlertOutput(t, func(c *AlertOutputConfig) {
+		c.URL = server.URL
+		c.Cooldown = helper.NewDuration(0)
+		c.MaxConcurrent = 1
+		c.QueueSize = 1
+		c.Timeout = helper.NewDuration(time.Minute)
+	})
+	require.NoError(t, op.Start())
+	defer op.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, op.Process(context.Background(), newFatalEntry("api")))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "processing blocked on a slow alert action")
+	}
+
+	require.True(t, op.Stats().Dropped > 0)
+}
@@ -0,0 +1,290 @@
+package azureloganalytics
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/flusher"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+func init() {
+	operator.Register("azure_log_analytics_output", func() operator.Builder { return NewAzureLogAnalyticsOutputConfig("") })
+}
+
+const (
+	// apiVersion is the version of the HTTP Data Collector API
+	apiVersion = "2016-04-01"
+	// resource is the resource signed in the authorization header
+	resource = "/api/logs"
+)
+
+// logTypePattern matches the custom log types accepted by Log Analytics
+var logTypePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,100}$`)
+
+// NewAzureLogAnalyticsOutputConfig creates a new Azure Log Analytics output config with default values
+func NewAzureLogAnalyticsOutputConfig(operatorID string) *AzureLogAnalyticsOutputConfig {
+	return &AzureLogAnalyticsOutputConfig{
+		OutputConfig:       helper.NewOutputConfig(operatorID, "azure_log_analytics_output"),
+		BufferConfig:       buffer.NewConfig(),
+		FlusherConfig:      flusher.NewConfig(),
+		TimeGeneratedField: "timestamp",
+		Timeout:            helper.NewDuration(30 * time.Second),
+	}
+}
+
+// AzureLogAnalyticsOutputConfig is the configuration of an AzureLogAnalyticsOutput operator
+type AzureLogAnalyticsOutputConfig struct {
+	helper.OutputConfig `yaml:",inline"`
+	BufferConfig        buffer.Config  `json:"buffer" yaml:"buffer"`
+	FlusherConfig       flusher.Config `json:"flusher" yaml:"flusher"`
+
+	WorkspaceID        string          `json:"workspace_id,omitempty"         yaml:"workspace_id,omitempty"         required:"true"`
+	SharedKey          string          `json:"shared_key,omitempty"           yaml:"shared_key,omitempty"           required:"true"`
+	LogType            string          `json:"log_type,omitempty"             yaml:"log_type,omitempty"`
+	LogTypeField       *entry.Field    `json:"log_type_field,omitempty"       yaml:"log_type_field,omitempty"`
+	TimeGeneratedField string          `json:"time_generated_field,omitempty" yaml:"time_generated_field,omitempty"`
+	BaseURI            string          `json:"base_uri,omitempty"             yaml:"base_uri,omitempty"`
+	Timeout            helper.Duration `json:"timeout,omitempty"              yaml:"timeout,omitempty"`
+}
+
+// Build will build a new AzureLogAnalyticsOutput
+func (c AzureLogAnalyticsOutputConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	outputOperator, err := c.OutputConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.WorkspaceID == "" {
+		return nil, fmt.Errorf("missing required parameter 'workspace_id'")
+	}
+
+	if c.SharedKey == "" {
+		return nil, fmt.Errorf("missing required parameter 'shared_key'")
+	}
+	key, err := base64.StdEncoding.DecodeString(c.SharedKey)
+	if err != nil {
+		return nil, errors.NewError(
+			"'shared_key' is not valid base64",
+			"use the primary or secondary key of the workspace, as shown in the Azure portal",
+		)
+	}
+
+	if c.LogType == "" && c.LogTypeField == nil {
+		return nil, fmt.Errorf("one of 'log_type' or 'log_type_field' is required")
+	}
+	if c.LogType != "" && !logTypePattern.MatchString(c.LogType) {
+		return nil, fmt.Errorf("invalid log_type '%s', must be at most 100 letters, numbers, and underscores", c.LogType)
+	}
+
+	baseURI := c.BaseURI
+	if baseURI == "" {
+		baseURI = fmt.Sprintf("https://%s.ods.opinsights.azure.com", c.WorkspaceID)
+	}
+	u, err := url.Parse(baseURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "'base_uri' is not a valid URL")
+	}
+	u.Path = resource
+	u.RawQuery = url.Values{"api-version": []string{apiVersion}}.Encode()
+
+	outputBuffer, err := c.BufferConfig.Build(context, c.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	alo := &AzureLogAnalyticsOutput{
+		Output:             buffer.NewOutput(outputOperator, outputBuffer),
+		client:             &http.Client{},
+		url:                u,
+		workspaceID:        c.WorkspaceID,
+		sharedKey:          key,
+		logType:            c.LogType,
+		logTypeField:       c.LogTypeField,
+		timeGeneratedField: c.TimeGeneratedField,
+		timeout:            c.Timeout.Raw(),
+		maxRequestBytes:    maxRequestBytes,
+	}
+
+	alo.flusher, err = c.FlusherConfig.Build(outputBuffer, alo.ProcessMulti, alo.SugaredLogger)
+	if err != nil {
+		_ = outputBuffer.Close()
+		return nil, err
+	}
+	alo.flusher.SetDeliveryWindow(alo.DeliveryWindow)
+	alo.flusher.SetMaintenance(alo.Maintenance)
+	alo.flusher.SetRetrier(alo.Retrier)
+	alo.flusher.SetStats(outputOperator.OperatorStats())
+
+	return []operator.Operator{alo}, nil
+}
+
+// AzureLogAnalyticsOutput is an operator that sends entries to an Azure Log
+// Analytics workspace with the HTTP Data Collector API
+type AzureLogAnalyticsOutput struct {
+	buffer.Output
+	flusher *flusher.Flusher
+
+	client             *http.Client
+	url                *url.URL
+	workspaceID        string
+	sharedKey          []byte
+	logType            string
+	logTypeField       *entry.Field
+	timeGeneratedField string
+	timeout            time.Duration
+	maxRequestBytes    int
+}
+
+// ConnectivityCheck sends a HEAD request to the Data Collector API, which
+// checks that its endpoint resolves and completes a TLS handshake without
+// sending any entries. The API only checks the shared key of requests that
+// send entries, so the key is not checked.
+func (alo *AzureLogAnalyticsOutput) ConnectivityCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, alo.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, alo.url.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := alo.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "execute request")
+	}
+	return res.Body.Close()
+}
+
+// Start begins flushing entries
+func (alo *AzureLogAnalyticsOutput) Start() error {
+	alo.flusher.Start()
+	return nil
+}
+
+// Stop tells the AzureLogAnalyticsOutput to stop gracefully
+func (alo *AzureLogAnalyticsOutput) Stop() error {
+	alo.flusher.Stop()
+	return alo.Buffer.Close()
+}
+
+// Process adds an entry to the output's buffer
+func (alo *AzureLogAnalyticsOutput) Process(ctx context.Context, e *entry.Entry) error {
+	if alo.DeliveryWindow.Bypass(e) {
+		return alo.flusher.FlushNow(ctx, []*entry.Entry{e})
+	}
+	return alo.Buffer.Add(ctx, e)
+}
+
+// ProcessMulti will send a chunk of entries to Log Analytics. The entries are
+// grouped by log type, and each group is split into requests that are within
+// the size limit of the API.
+func (alo *AzureLogAnalyticsOutput) ProcessMulti(ctx context.Context, entries []*entry.Entry) error {
+	for _, batch := range alo.newBatches(entries) {
+		if err := alo.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a batch of records to Log Analytics
+func (alo *AzureLogAnalyticsOutput) send(ctx context.Context, b *batch) error {
+	ctx, cancel := context.WithTimeout(ctx, alo.timeout)
+	defer cancel()
+
+	req, err := alo.newRequest(ctx, b, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+
+	res, err := alo.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "execute request")
+	}
+	return alo.handleResponse(res)
+}
+
+// newRequest creates a signed request that sends a batch of records
+func (alo *AzureLogAnalyticsOutput) newRequest(ctx context.Context, b *batch, now time.Time) (*http.Request, error) {
+	body := b.Bytes()
+	date := now.UTC().Format(http.TimeFormat)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", alo.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Log-Type", b.logType)
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("Authorization", alo.authorization(len(body), date))
+	if alo.timeGeneratedField != "" {
+		req.Header.Set("time-generated-field", alo.timeGeneratedField)
+	}
+	return req, nil
+}
+
+// authorization returns the shared key authorization header of a request
+func (alo *AzureLogAnalyticsOutput) authorization(contentLength int, date string) string {
+	stringToSign := "POST\n" + strconv.Itoa(contentLength) + "\napplication/json\nx-ms-date:" + date + "\n" + resource
+	mac := hmac.New(sha256.New, alo.sharedKey)
+	_, _ = mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("SharedKey %s:%s", alo.workspaceID, signature)
+}
+
+// handleResponse returns an error if a request should be retried. Requests that
+// are rejected as invalid are logged and dropped, since retrying cannot succeed.
+func (alo *AzureLogAnalyticsOutput) handleResponse(res *http.Response) error {
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+	switch {
+	case res.StatusCode == http.StatusForbidden:
+		details := []string{"status", res.Status, "body", string(body)}
+		if skew, ok := clockSkew(res, time.Now()); ok {
+			details = append(details, "clock_skew", skew.String())
+		}
+		return errors.NewError(
+			"Log Analytics rejected the request signature, which usually means the system clock is off by more than 15 minutes",
+			"ensure that the system clock is accurate, and that 'shared_key' is the primary or secondary key of the workspace",
+			details...,
+		)
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return errors.NewError(
+			"Log Analytics is unavailable",
+			"the request will be retried",
+			"status", res.Status,
+			"body", string(body),
+		)
+	default:
+		alo.Errorw("Request returned a non-zero status code. Dropping entries", "status", res.Status, "body", string(body))
+		return nil
+	}
+}
+
+// clockSkew returns the difference between the local clock and the time of a
+// response, rounded to the second
+func clockSkew(res *http.Response, now time.Time) (time.Duration, bool) {
+	date, err := http.ParseTime(res.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return now.Sub(date).Round(time.Second), true
+}
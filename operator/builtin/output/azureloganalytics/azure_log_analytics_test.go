@@ -0,0 +1,246 @@
+package azureloganalytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("test-shared-key"))
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+func newTestServer(t *testing.T, status int) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "/api/logs", r.URL.Path)
+		require.Equal(t, "2016-04-01", r.URL.Query().Get("api-version"))
+		requests <- request{r.Header, body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func newTestOutput(t *testing.T, baseURI string, cfgMod func(*AzureLogAnalyticsOutputConfig)) *AzureLogAnalyticsOutput {
+	cfg := NewAzureLogAnalyticsOutputConfig("test")
+	cfg.WorkspaceID = "workspace"
+	cfg.SharedKey = testKey
+	cfg.LogType = "stanza"
+	cfg.BaseURI = baseURI
+	if cfgMod != nil {
+		cfgMod(cfg)
+	}
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	return ops[0].(*AzureLogAnalyticsOutput)
+}
+
+func TestAzureLogAnalyticsConfigBuild(t *testing.T) {
+	cases := []struct {
+		name          string
+		cfgMod        func(*AzureLogAnalyticsOutputConfig)
+		expectedError string
+	}{
+		{
+			"MissingWorkspaceID",
+			func(cfg *AzureLogAnalyticsOutputConfig) { cfg.WorkspaceID = "" },
+			"missing required parameter 'workspace_id'",
+		},
+		{
+			"MissingSharedKey",
+			func(cfg *AzureLogAnalyticsOutputConfig) { cfg.SharedKey = "" },
+			"missing required parameter 'shared_key'",
+		},
+		{
+			"InvalidSharedKey",
+			func(cfg *AzureLogAnalyticsOutputConfig) { cfg.SharedKey = "not base64!" },
+			"'shared_key' is not valid base64",
+		},
+		{
+			"MissingLogType",
+			func(cfg *AzureLogAnalyticsOutputConfig) { cfg.LogType = "" },
+			"one of 'log_type' or 'log_type_field' is required",
+		},
+		{
+			"InvalidLogType",
+			func(cfg *AzureLogAnalyticsOutputConfig) { cfg.LogType = "my-logs" },
+			"invalid log_type 'my-logs'",
+		},
+		{
+			"InvalidURL",
+			func(cfg *AzureLogAnalyticsOutputConfig) { cfg.BaseURI = `%^&*($@)` },
+			"is not a valid URL",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewAzureLogAnalyticsOutputConfig("test")
+			cfg.WorkspaceID = "workspace"
+			cfg.SharedKey = testKey
+			cfg.LogType = "stanza"
+			tc.cfgMod(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+
+	t.Run("DefaultURL", func(t *testing.T) {
+		output := newTestOutput(t, "", nil)
+		require.Equal(t, "https://workspace.ods.opinsights.azure.com/api/logs?api-version=2016-04-01", output.url.String())
+	})
+}
+
+func TestAzureLogAnalyticsOutput(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK)
+	output := newTestOutput(t, srv.URL, nil)
+
+	e := entry.New()
+	e.Timestamp = time.Date(2016, 10, 10, 8, 58, 52, 0, time.UTC)
+	e.Record = map[string]interface{}{"message": "test"}
+	e.AddLabel("host", "web-1")
+	require.NoError(t, output.ProcessMulti(context.Background(), []*entry.Entry{e}))
+
+	req := <-requests
+	require.Equal(t, "application/json", req.header.Get("Content-Type"))
+	require.Equal(t, "stanza", req.header.Get("Log-Type"))
+	require.Equal(t, "timestamp", req.header.Get("time-generated-field"))
+	require.JSONEq(t, `[{"timestamp":"2016-10-10T08:58:52Z","severity":"default","record":{"message":"test"},"labels":{"host":"web-1"},"resource":null}]`, string(req.body))
+
+	// The signature covers the length of the body and the date of the request
+	date := req.header.Get("x-ms-date")
+	_, err := http.ParseTime(date)
+	require.NoError(t, err)
+	mac := hmac.New(sha256.New, []byte("test-shared-key"))
+	mac.Write([]byte("POST\n" + strconv.Itoa(len(req.body)) + "\napplication/json\nx-ms-date:" + date + "\n/api/logs"))
+	expected := "SharedKey workspace:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	require.Equal(t, expected, req.header.Get("Authorization"))
+}
+
+func TestAzureLogAnalyticsLogTypeField(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK)
+	output := newTestOutput(t, srv.URL, func(cfg *AzureLogAnalyticsOutputConfig) {
+		field := entry.NewLabelField("log_type")
+		cfg.LogTypeField = &field
+	})
+
+	nginx := entry.New()
+	nginx.AddLabel("log_type", "nginx")
+	invalid := entry.New()
+	invalid.AddLabel("log_type", "not-valid")
+	require.NoError(t, output.ProcessMulti(context.Background(), []*entry.Entry{nginx, entry.New(), invalid}))
+
+	// Entries without a valid log type fall back to the configured log type
+	logTypes := map[string]int{}
+	for i := 0; i < 2; i++ {
+		req := <-requests
+		var records []map[string]interface{}
+		require.NoError(t, json.Unmarshal(req.body, &records))
+		logTypes[req.header.Get("Log-Type")] = len(records)
+	}
+	require.Equal(t, map[string]int{"nginx": 1, "stanza": 2}, logTypes)
+}
+
+func TestAzureLogAnalyticsBatchSize(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK)
+	output := newTestOutput(t, srv.URL, nil)
+
+	entries := make([]*entry.Entry, 0, 10)
+	for i := 0; i < 10; i++ {
+		e := entry.New()
+		e.Record = "test"
+		entries = append(entries, e)
+	}
+	record, err := json.Marshal(output.newRecord(entries[0]))
+	require.NoError(t, err)
+
+	// Each request holds at most 3 records
+	output.maxRequestBytes = 2 + 3*len(record) + 2
+	require.NoError(t, output.ProcessMulti(context.Background(), entries))
+
+	counts := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		req := <-requests
+		require.LessOrEqual(t, len(req.body), output.maxRequestBytes)
+		var records []map[string]interface{}
+		require.NoError(t, json.Unmarshal(req.body, &records))
+		counts = append(counts, len(records))
+	}
+	require.Equal(t, []int{3, 3, 3, 1}, counts)
+}
+
+func TestAzureLogAnalyticsResponses(t *testing.T) {
+	cases := []struct {
+		name          string
+		status        int
+		expectedError string
+	}{
+		{"OK", http.StatusOK, ""},
+		{"Forbidden", http.StatusForbidden, "system clock is off by more than 15 minutes"},
+		{"TooManyRequests", http.StatusTooManyRequests, "Log Analytics is unavailable"},
+		{"ServerError", http.StatusInternalServerError, "Log Analytics is unavailable"},
+		{"BadRequest", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, tc.status)
+			output := newTestOutput(t, srv.URL, nil)
+
+			err := output.ProcessMulti(context.Background(), []*entry.Entry{entry.New()})
+			if tc.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 20, 0, 0, time.UTC)
+	res := &http.Response{Header: http.Header{}}
+	_, ok := clockSkew(res, now)
+	require.False(t, ok)
+
+	res.Header.Set("Date", time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+	skew, ok := clockSkew(res, now)
+	require.True(t, ok)
+	require.Equal(t, 20*time.Minute, skew)
+}
+
+func TestAzureLogAnalyticsConnectivityCheck(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusForbidden)
+	output := newTestOutput(t, srv.URL, nil)
+	require.NoError(t, output.ConnectivityCheck(context.Background()))
+
+	select {
+	case req := <-requests:
+		require.Empty(t, req.body)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for request")
+	}
+
+	srv.Close()
+	require.Error(t, output.ConnectivityCheck(context.Background()))
+}
@@ -0,0 +1,108 @@
+package azureloganalytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+)
+
+// maxRequestBytes is the size limit of a request to the HTTP Data Collector API
+const maxRequestBytes = 30 * 1024 * 1024
+
+// batch is a JSON array of records of a single log type, sent in one request
+type batch struct {
+	logType string
+	buf     bytes.Buffer
+	count   int
+}
+
+func newBatch(logType string) *batch {
+	b := &batch{logType: logType}
+	b.buf.WriteByte('[')
+	return b
+}
+
+// size returns the size of the batch once it is closed
+func (b *batch) size() int {
+	return b.buf.Len() + 1
+}
+
+// add adds an encoded record to the batch
+func (b *batch) add(record []byte) {
+	if b.count > 0 {
+		b.buf.WriteByte(',')
+	}
+	b.buf.Write(record)
+	b.count++
+}
+
+// Bytes returns the closed JSON array of the batch
+func (b *batch) Bytes() []byte {
+	body := make([]byte, 0, b.size())
+	body = append(body, b.buf.Bytes()...)
+	return append(body, ']')
+}
+
+// newBatches groups entries into batches by log type, starting a new batch
+// whenever adding an entry would exceed the request size limit. Entries that
+// cannot be sent are logged and dropped.
+func (alo *AzureLogAnalyticsOutput) newBatches(entries []*entry.Entry) []*batch {
+	batches := make([]*batch, 0, 1)
+	current := make(map[string]*batch)
+	for _, e := range entries {
+		logType, ok := alo.entryLogType(e)
+		if !ok {
+			alo.Errorw("Entry does not have a valid log type. Dropping entry", "entry", e)
+			continue
+		}
+
+		record, err := json.Marshal(alo.newRecord(e))
+		if err != nil {
+			alo.Errorw("Failed to encode entry. Dropping entry", "error", err, "entry", e)
+			continue
+		}
+		if len(record)+2 > alo.maxRequestBytes {
+			alo.Errorw("Entry is larger than the request size limit. Dropping entry", "size", len(record), "limit", alo.maxRequestBytes)
+			continue
+		}
+
+		b, ok := current[logType]
+		if !ok || b.size()+len(record)+1 > alo.maxRequestBytes {
+			b = newBatch(logType)
+			current[logType] = b
+			batches = append(batches, b)
+		}
+		b.add(record)
+	}
+	return batches
+}
+
+// entryLogType returns the log type of an entry, read from the log type
+// field if it is configured, and otherwise from the log type of the config
+func (alo *AzureLogAnalyticsOutput) entryLogType(e *entry.Entry) (string, bool) {
+	if alo.logTypeField != nil {
+		var logType string
+		if err := e.Read(*alo.logTypeField, &logType); err == nil && logTypePattern.MatchString(logType) {
+			return logType, true
+		}
+	}
+	return alo.logType, alo.logType != ""
+}
+
+// newRecord creates the record sent to Log Analytics for an entry
+func (alo *AzureLogAnalyticsOutput) newRecord(e *entry.Entry) map[string]interface{} {
+	timeField := alo.timeGeneratedField
+	if timeField == "" {
+		timeField = "timestamp"
+	}
+
+	return map[string]interface{}{
+		timeField:  e.Timestamp.UTC().Format(time.RFC3339Nano),
+		"severity": e.Severity.String(),
+		"record":   e.Record,
+		"labels":   e.Labels,
+		"resource": e.Resource,
+	}
+}
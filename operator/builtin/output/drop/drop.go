@@ -26,7 +26,7 @@ type DropOutputConfig struct {
 
 // Build will build a drop output operator.
 func (c DropOutputConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
-	outputOperator, err := c.OutputConfig.Build(context)
+	outputOperator, err := c.OutputConfig.BuildWithoutFlusher(context)
 	if err != nil {
 		return nil, err
 	}
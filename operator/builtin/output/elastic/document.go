@@ -0,0 +1,254 @@
+package elastic
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	strftime "github.com/observiq/ctimefmt"
+	"github.com/observiq/stanza/entry"
+)
+
+const (
+	// DocumentEntry sends entries as they are serialized, with the record
+	// and labels in fields of their own
+	DocumentEntry = "entry"
+
+	// DocumentFlat sends the timestamp of entries as @timestamp, with the
+	// fields of the record and the labels at the top level of the document
+	DocumentFlat = "flat"
+)
+
+// indexTemplate is an index name with strftime directives that are replaced
+// by the timestamp of an entry, such as logs-%Y.%m.%d
+type indexTemplate struct {
+	// parts are either literal text, or the go layout of a directive
+	parts []indexPart
+}
+
+type indexPart struct {
+	text   string
+	layout string
+}
+
+var directiveRegexp = regexp.MustCompile(`%.`)
+
+// newIndexTemplate parses an index name template
+func newIndexTemplate(template string) (*indexTemplate, error) {
+	t := &indexTemplate{}
+	last := 0
+	for _, loc := range directiveRegexp.FindAllStringIndex(template, -1) {
+		if loc[0] > last {
+			t.parts = append(t.parts, indexPart{text: template[last:loc[0]]})
+		}
+		directive := template[loc[0]:loc[1]]
+		if directive == "%%" {
+			t.parts = append(t.parts, indexPart{text: "%"})
+		} else {
+			layout, err := strftime.ToNative(directive)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index '%s': %s", template, err)
+			}
+			t.parts = append(t.parts, indexPart{layout: layout})
+		}
+		last = loc[1]
+	}
+	if last < len(template) {
+		t.parts = append(t.parts, indexPart{text: template[last:]})
+	}
+	return t, nil
+}
+
+// render returns the index name for a timestamp, in UTC
+func (t *indexTemplate) render(timestamp time.Time) string {
+	timestamp = timestamp.UTC()
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.layout != "" {
+			b.WriteString(timestamp.Format(part.layout))
+		} else {
+			b.WriteString(part.text)
+		}
+	}
+	return b.String()
+}
+
+// The policies for labels that collide with fields of a flat document
+const (
+	// LabelCollisionRecordWins keeps the field of the document
+	LabelCollisionRecordWins = "record_wins"
+
+	// LabelCollisionLabelWins replaces the field of the document with the label
+	LabelCollisionLabelWins = "label_wins"
+
+	// LabelCollisionPrefixLabels sends the label with a prefix, next to the
+	// field of the document
+	LabelCollisionPrefixLabels = "prefix_labels"
+
+	// LabelCollisionError fails to map the entry
+	LabelCollisionError = "error"
+)
+
+// collisionPrefix is the prefix of colliding labels with prefix_labels
+const collisionPrefix = "label_"
+
+// flatDocument maps an entry to a document with the timestamp as @timestamp,
+// and the labels and fields of the record at the top level. A record that is
+// not a map is sent as message.
+//
+// Elasticsearch expands the dots of field names into objects, so a label
+// collides with a field of the document when their paths overlap, such as a
+// label http.status and a record with a status in an http object. Colliding
+// labels are handled by the policy, and their keys are returned, sorted.
+func flatDocument(e *entry.Entry, policy string) (map[string]interface{}, []string, error) {
+	doc := make(map[string]interface{}, len(e.Labels)+4)
+	switch record := e.Record.(type) {
+	case map[string]interface{}:
+		for k, v := range record {
+			doc[k] = v
+		}
+	case map[string]string:
+		for k, v := range record {
+			doc[k] = v
+		}
+	case []byte:
+		doc["message"] = string(record)
+	case nil:
+	default:
+		doc["message"] = record
+	}
+
+	if len(e.Resource) > 0 {
+		doc["resource"] = e.Resource
+	}
+	if len(e.TraceID) > 0 {
+		doc["trace_id"] = hex.EncodeToString(e.TraceID)
+	}
+	if len(e.SpanID) > 0 {
+		doc["span_id"] = hex.EncodeToString(e.SpanID)
+	}
+
+	doc["@timestamp"] = e.Timestamp.UTC().Format(time.RFC3339Nano)
+	doc["severity"] = e.Severity.String()
+
+	if len(e.Labels) == 0 {
+		return doc, nil, nil
+	}
+
+	// Labels are added in order, so that a label that collides with another
+	// label, such as a and a.b, collides the same way for each entry
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var collisions []string
+	for _, k := range keys {
+		path := strings.Split(k, ".")
+		if !pathCollides(doc, path) {
+			doc[k] = e.Labels[k]
+			continue
+		}
+
+		collisions = append(collisions, k)
+		switch policy {
+		case LabelCollisionLabelWins:
+			doc = withoutPath(doc, path)
+			doc[k] = e.Labels[k]
+		case LabelCollisionPrefixLabels:
+			prefixed := collisionPrefix + k
+			if !pathCollides(doc, strings.Split(prefixed, ".")) {
+				doc[prefixed] = e.Labels[k]
+			}
+		case LabelCollisionError:
+			// The rest of the labels are checked to list every collision
+		default:
+			// The field of the document is kept
+		}
+	}
+
+	if policy == LabelCollisionError && len(collisions) > 0 {
+		return nil, collisions, fmt.Errorf("labels collide with fields of the document: %s", strings.Join(collisions, ", "))
+	}
+	return doc, collisions, nil
+}
+
+// pathCollides returns true if a dotted path overlaps the fields of a
+// document. The keys of the document may contain dots themselves.
+func pathCollides(doc map[string]interface{}, path []string) bool {
+	for k, v := range doc {
+		keyPath := strings.Split(k, ".")
+		if !prefixEqual(keyPath, path) {
+			continue
+		}
+		if len(keyPath) >= len(path) {
+			return true
+		}
+
+		// The key is a parent of the path, which only collides with the
+		// fields inside it, unless it is not an object
+		child, ok := asObject(v)
+		if !ok || pathCollides(child, path[len(keyPath):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPath returns a copy of a document without the fields that overlap a
+// dotted path. Only the objects along the path are copied, so the record of
+// the entry is not changed.
+func withoutPath(doc map[string]interface{}, path []string) map[string]interface{} {
+	result := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		result[k] = v
+	}
+
+	for k, v := range doc {
+		keyPath := strings.Split(k, ".")
+		if !prefixEqual(keyPath, path) {
+			continue
+		}
+		child, ok := asObject(v)
+		if len(keyPath) >= len(path) || !ok {
+			delete(result, k)
+			continue
+		}
+		result[k] = withoutPath(child, path[len(keyPath):])
+	}
+	return result
+}
+
+// prefixEqual returns true if the shorter of two paths is a prefix of the other
+func prefixEqual(a, b []string) bool {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// asObject returns a field of a document as an object, if it is one
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[string]string:
+		object := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			object[k] = s
+		}
+		return object, true
+	default:
+		return nil, false
+	}
+}
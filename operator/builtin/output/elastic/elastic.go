@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
 	elasticsearch "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -20,13 +24,31 @@ import (
 
 func init() {
 	operator.Register("elastic_output", func() operator.Builder { return NewElasticOutputConfig("") })
+	operator.Register("elasticsearch_output", func() operator.Builder { return NewElasticsearchOutputConfig("") })
 }
 
 // NewElasticOutputConfig creates a new elastic output config with default values
 func NewElasticOutputConfig(operatorID string) *ElasticOutputConfig {
 	return &ElasticOutputConfig{
-		OutputConfig: helper.NewOutputConfig(operatorID, "elastic_output"),
-		BufferConfig: buffer.NewConfig(),
+		OutputConfig:   helper.NewOutputConfig(operatorID, "elastic_output"),
+		BufferConfig:   buffer.NewConfig(),
+		FlusherConfig:  flusher.NewConfig(),
+		Document:       DocumentEntry,
+		LabelCollision: LabelCollisionRecordWins,
+	}
+}
+
+// NewElasticsearchOutputConfig creates a new elasticsearch output config with
+// default values. It builds the same operator as elastic_output, but sends
+// flat documents to a daily index by default.
+func NewElasticsearchOutputConfig(operatorID string) *ElasticOutputConfig {
+	return &ElasticOutputConfig{
+		OutputConfig:   helper.NewOutputConfig(operatorID, "elasticsearch_output"),
+		BufferConfig:   buffer.NewConfig(),
+		FlusherConfig:  flusher.NewConfig(),
+		Index:          "logs-%Y.%m.%d",
+		Document:       DocumentFlat,
+		LabelCollision: LabelCollisionRecordWins,
 	}
 }
 
@@ -36,13 +58,20 @@ type ElasticOutputConfig struct {
 	BufferConfig        buffer.Config  `json:"buffer" yaml:"buffer"`
 	FlusherConfig       flusher.Config `json:"flusher" yaml:"flusher"`
 
-	Addresses  []string     `json:"addresses"             yaml:"addresses,flow"`
-	Username   string       `json:"username"              yaml:"username"`
-	Password   string       `json:"password"              yaml:"password"`
-	CloudID    string       `json:"cloud_id"              yaml:"cloud_id"`
-	APIKey     string       `json:"api_key"               yaml:"api_key"`
-	IndexField *entry.Field `json:"index_field,omitempty" yaml:"index_field,omitempty"`
-	IDField    *entry.Field `json:"id_field,omitempty"    yaml:"id_field,omitempty"`
+	Addresses  []string          `json:"addresses"             yaml:"addresses,flow"`
+	Username   string            `json:"username"              yaml:"username"`
+	Password   string            `json:"password"              yaml:"password"`
+	CloudID    string            `json:"cloud_id"              yaml:"cloud_id"`
+	APIKey     string            `json:"api_key"               yaml:"api_key"`
+	Index      string            `json:"index,omitempty"       yaml:"index,omitempty"`
+	IndexField *entry.Field      `json:"index_field,omitempty" yaml:"index_field,omitempty"`
+	IDField    *entry.Field      `json:"id_field,omitempty"    yaml:"id_field,omitempty"`
+	Document   string            `json:"document,omitempty"    yaml:"document,omitempty"`
+	TLS        *helper.TLSConfig `json:"tls,omitempty"         yaml:"tls,omitempty"`
+
+	// LabelCollision is the policy for labels that collide with fields of a
+	// flat document
+	LabelCollision string `json:"label_collision,omitempty" yaml:"label_collision,omitempty"`
 }
 
 // Build will build an elasticsearch output operator.
@@ -52,6 +81,33 @@ func (c ElasticOutputConfig) Build(context operator.BuildContext) ([]operator.Op
 		return nil, err
 	}
 
+	if c.Index != "" && c.IndexField != nil {
+		return nil, fmt.Errorf("index and index_field cannot both be set")
+	}
+
+	var index *indexTemplate
+	if c.Index != "" {
+		if index, err = newIndexTemplate(c.Index); err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.Document {
+	case "", DocumentEntry, DocumentFlat:
+	default:
+		return nil, fmt.Errorf("invalid document '%s': must be '%s' or '%s'", c.Document, DocumentEntry, DocumentFlat)
+	}
+
+	labelCollision := c.LabelCollision
+	switch labelCollision {
+	case "":
+		labelCollision = LabelCollisionRecordWins
+	case LabelCollisionRecordWins, LabelCollisionLabelWins, LabelCollisionPrefixLabels, LabelCollisionError:
+	default:
+		return nil, fmt.Errorf("invalid label_collision '%s': must be '%s', '%s', '%s' or '%s'", c.LabelCollision,
+			LabelCollisionRecordWins, LabelCollisionLabelWins, LabelCollisionPrefixLabels, LabelCollisionError)
+	}
+
 	cfg := elasticsearch.Config{
 		Addresses: c.Addresses,
 		Username:  c.Username,
@@ -60,6 +116,16 @@ func (c ElasticOutputConfig) Build(context operator.BuildContext) ([]operator.Op
 		APIKey:    c.APIKey,
 	}
 
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		cfg.Transport = transport
+	}
+
 	client, err := elasticsearch.NewClient(cfg)
 	if err != nil {
 		return nil, errors.NewError(
@@ -69,33 +135,73 @@ func (c ElasticOutputConfig) Build(context operator.BuildContext) ([]operator.Op
 		)
 	}
 
-	buffer, err := c.BufferConfig.Build(context, c.ID())
+	outputBuffer, err := c.BufferConfig.Build(context, c.ID())
 	if err != nil {
 		return nil, err
 	}
 
 	elasticOutput := &ElasticOutput{
-		OutputOperator: outputOperator,
-		buffer:         buffer,
+		Output:         buffer.NewOutput(outputOperator, outputBuffer),
 		client:         client,
+		index:          index,
 		indexField:     c.IndexField,
 		idField:        c.IDField,
+		flat:           c.Document == DocumentFlat,
+		labelCollision: labelCollision,
+		collided:       make(map[string]struct{}),
 	}
 
-	elasticOutput.flusher = c.FlusherConfig.Build(buffer, elasticOutput.ProcessMulti, elasticOutput.SugaredLogger)
+	elasticOutput.flusher, err = c.FlusherConfig.Build(outputBuffer, elasticOutput.ProcessMulti, elasticOutput.SugaredLogger)
+	if err != nil {
+		_ = outputBuffer.Close()
+		return nil, err
+	}
+	elasticOutput.flusher.SetDeliveryWindow(elasticOutput.DeliveryWindow)
+	elasticOutput.flusher.SetMaintenance(elasticOutput.Maintenance)
+	elasticOutput.flusher.SetRetrier(elasticOutput.Retrier)
+	elasticOutput.flusher.SetStats(outputOperator.OperatorStats())
 
 	return []operator.Operator{elasticOutput}, nil
 }
 
 // ElasticOutput is an operator that sends entries to elasticsearch.
 type ElasticOutput struct {
-	helper.OutputOperator
-	buffer  buffer.Buffer
+	buffer.Output
 	flusher *flusher.Flusher
 
 	client     *elasticsearch.Client
+	index      *indexTemplate
 	indexField *entry.Field
 	idField    *entry.Field
+	flat       bool
+
+	labelCollision string
+	collidedMux    sync.Mutex
+	collided       map[string]struct{}
+}
+
+// ConnectivityCheck pings the cluster with the configured credentials,
+// without sending any entries
+func (e *ElasticOutput) ConnectivityCheck(ctx context.Context) error {
+	res, err := esapi.PingRequest{}.Do(ctx, e.client)
+	if err != nil {
+		return errors.NewError(
+			"Client failed to ping elasticsearch.",
+			"Review the underlying error message to troubleshoot the issue",
+			"underlying_error", err.Error(),
+		)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.NewError(
+			"Ping to elasticsearch returned a failure code.",
+			"Review status and status code for further details.",
+			"status_code", strconv.Itoa(res.StatusCode),
+			"status", res.Status(),
+		)
+	}
+	return nil
 }
 
 // Start signals to the ElasticOutput to begin flushing
@@ -107,15 +213,39 @@ func (e *ElasticOutput) Start() error {
 // Stop tells the ElasticOutput to stop gracefully
 func (e *ElasticOutput) Stop() error {
 	e.flusher.Stop()
-	return e.buffer.Close()
+	return e.Buffer.Close()
 }
 
 // Process adds an entry to the outputs buffer
-func (e *ElasticOutput) Process(ctx context.Context, entry *entry.Entry) error {
-	return e.buffer.Add(ctx, entry)
+func (e *ElasticOutput) Process(ctx context.Context, ent *entry.Entry) error {
+	if e.DeliveryWindow.Bypass(ent) {
+		return e.flusher.FlushNow(ctx, []*entry.Entry{ent})
+	}
+	return e.Buffer.Add(ctx, ent)
 }
 
-// ProcessMulti will send entries to elasticsearch.
+// requeueTimeout is how long a failed item waits for room in the buffer
+// before it is dropped
+var requeueTimeout = 5 * time.Second
+
+// bulkResponse is the part of a response of the bulk API that reports the
+// result of each item
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error,omitempty"`
+	} `json:"items"`
+}
+
+// ProcessMulti will send entries to elasticsearch. Items of the bulk request
+// that fail with a status that can be retried are added to the buffer again,
+// and items that fail otherwise are dropped. If every item fails with a status
+// that can be retried, an error is returned so that the chunk is retried with
+// a backoff.
 func (e *ElasticOutput) ProcessMulti(ctx context.Context, entries []*entry.Entry) error {
 	type indexDirective struct {
 		Index struct {
@@ -129,6 +259,7 @@ func (e *ElasticOutput) ProcessMulti(ctx context.Context, entries []*entry.Entry
 	// https://www.elastic.co/guide/en/elasticsearch/reference/master/docs-bulk.html
 	var buffer bytes.Buffer
 	var err error
+	sent := make([]*entry.Entry, 0, len(entries))
 	for _, entry := range entries {
 		directive := indexDirective{}
 		directive.Index.Index, err = e.FindIndex(entry)
@@ -149,7 +280,19 @@ func (e *ElasticOutput) ProcessMulti(ctx context.Context, entries []*entry.Entry
 			continue
 		}
 
-		entryJSON, err := json.Marshal(entry)
+		var entryJSON []byte
+		if e.flat {
+			doc, collisions, docErr := flatDocument(entry, e.labelCollision)
+			e.reportCollisions(collisions)
+			if docErr != nil {
+				e.Warnw("Failed to map entry to a document. Dropping entry", zap.Error(docErr))
+				e.OperatorStats().AddDropped(1)
+				continue
+			}
+			entryJSON, err = json.Marshal(doc)
+		} else {
+			entryJSON, err = json.Marshal(entry)
+		}
 		if err != nil {
 			e.Warnw("Failed to marshal entry JSON", zap.Any("error", err))
 			continue
@@ -159,6 +302,11 @@ func (e *ElasticOutput) ProcessMulti(ctx context.Context, entries []*entry.Entry
 		buffer.Write([]byte("\n"))
 		buffer.Write(entryJSON)
 		buffer.Write([]byte("\n"))
+		sent = append(sent, entry)
+	}
+
+	if len(sent) == 0 {
+		return nil
 	}
 
 	request := esapi.BulkRequest{
@@ -185,12 +333,105 @@ func (e *ElasticOutput) ProcessMulti(ctx context.Context, entries []*entry.Entry
 		)
 	}
 
+	var response bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		e.Warnw("Failed to decode bulk response. Assuming every item succeeded", zap.Error(err))
+		return nil
+	}
+	if !response.Errors {
+		return nil
+	}
+
+	return e.handleItemFailures(ctx, sent, response)
+}
+
+// handleItemFailures requeues the items of a bulk request that failed with a
+// status that can be retried, and drops the rest of the failed items
+func (e *ElasticOutput) handleItemFailures(ctx context.Context, sent []*entry.Entry, response bulkResponse) error {
+	if len(response.Items) != len(sent) {
+		return fmt.Errorf("bulk response has %d items for %d entries", len(response.Items), len(sent))
+	}
+
+	var retry []*entry.Entry
+	dropped := 0
+	for i, item := range response.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+
+			reason := ""
+			if result.Error != nil {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			if retryableStatus(result.Status) {
+				e.Debugw("Bulk item failed. Retrying", "status", result.Status, "error", reason)
+				retry = append(retry, sent[i])
+				continue
+			}
+			e.Warnw("Bulk item failed. Dropping entry", "status", result.Status, "error", reason)
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		e.OperatorStats().AddDropped(uint64(dropped))
+	}
+	if len(retry) == 0 {
+		return nil
+	}
+	if len(retry) == len(sent) {
+		return fmt.Errorf("every item of the bulk request failed with a status that can be retried")
+	}
+
+	// The other items of the chunk were indexed, so the chunk is not retried.
+	// Items that can't be requeued are dropped instead.
+	requeueCtx, cancel := context.WithTimeout(ctx, requeueTimeout)
+	defer cancel()
+	for i, ent := range retry {
+		if err := e.Buffer.Add(requeueCtx, ent); err != nil {
+			e.Errorw("Failed to requeue bulk items. Dropping them", "entries", len(retry)-i, zap.Error(err))
+			e.OperatorStats().AddDropped(uint64(len(retry) - i))
+			return nil
+		}
+	}
 	return nil
 }
 
+// reportCollisions logs a warning for each label the first time it collides
+// with a field of a document, so that a collision on every entry does not
+// flood the log
+func (e *ElasticOutput) reportCollisions(collisions []string) {
+	if len(collisions) == 0 {
+		return
+	}
+
+	e.collidedMux.Lock()
+	var first []string
+	for _, k := range collisions {
+		if _, ok := e.collided[k]; !ok {
+			e.collided[k] = struct{}{}
+			first = append(first, k)
+		}
+	}
+	e.collidedMux.Unlock()
+
+	if len(first) > 0 {
+		e.Warnw("Labels collide with fields of the document", "labels", first, "label_collision", e.labelCollision)
+	}
+}
+
+// retryableStatus returns whether a bulk item that failed with a status can be retried
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
 // FindIndex will find an index that will represent an entry in elasticsearch.
 func (e *ElasticOutput) FindIndex(entry *entry.Entry) (string, error) {
 	if e.indexField == nil {
+		if e.index != nil {
+			return e.index.render(entry.Timestamp), nil
+		}
 		return "default", nil
 	}
 
@@ -1,9 +1,21 @@
 package elastic
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/buffer"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -80,3 +92,465 @@ func TestFindID(t *testing.T) {
 		require.NotEmpty(t, idx)
 	})
 }
+
+func TestIndexTemplate(t *testing.T) {
+	timestamp := time.Date(2020, 10, 7, 23, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	cases := []struct {
+		template string
+		expected string
+	}{
+		{"logs", "logs"},
+		{"logs-%Y.%m.%d", "logs-2020.10.08"},
+		{"app2-%Y-%m-%d-%H", "app2-2020-10-08-04"},
+		{"%Y", "2020"},
+		{"100%%-%y", "100%-20"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.template, func(t *testing.T) {
+			template, err := newIndexTemplate(tc.template)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, template.render(timestamp))
+		})
+	}
+
+	_, err := newIndexTemplate("logs-%Q")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid index 'logs-%Q'")
+}
+
+func TestFlatDocument(t *testing.T) {
+	e := entry.New()
+	e.Timestamp = time.Date(2020, 10, 7, 12, 0, 0, 0, time.UTC)
+	e.Severity = entry.Error
+	e.Labels = map[string]string{"env": "prod", "host": "label"}
+	e.Resource = map[string]string{"cluster": "c1"}
+	e.Record = map[string]interface{}{"message": "failed", "host": "record"}
+
+	require.Equal(t, map[string]interface{}{
+		"@timestamp": "2020-10-07T12:00:00Z",
+		"severity":   "error",
+		"env":        "prod",
+		"host":       "record",
+		"message":    "failed",
+		"resource":   map[string]string{"cluster": "c1"},
+	}, requireFlatDocument(t, e, LabelCollisionRecordWins))
+
+	e.Record = "failed"
+	e.Labels = nil
+	e.Resource = nil
+	e.TraceID = []byte{0x4b, 0xf9}
+	require.Equal(t, map[string]interface{}{
+		"@timestamp": "2020-10-07T12:00:00Z",
+		"severity":   "error",
+		"message":    "failed",
+		"trace_id":   "4bf9",
+	}, requireFlatDocument(t, e, LabelCollisionRecordWins))
+}
+
+// requireFlatDocument maps an entry to a flat document without error
+func requireFlatDocument(t *testing.T, e *entry.Entry, policy string) map[string]interface{} {
+	doc, _, err := flatDocument(e, policy)
+	require.NoError(t, err)
+	return doc
+}
+
+func TestFlatDocumentLabelCollision(t *testing.T) {
+	newEntry := func() *entry.Entry {
+		e := entry.New()
+		e.Timestamp = time.Date(2020, 10, 7, 12, 0, 0, 0, time.UTC)
+		e.Labels = map[string]string{"env": "prod", "host": "label", "http.status": "500"}
+		e.Record = map[string]interface{}{
+			"host": "record",
+			"http": map[string]interface{}{"method": "GET", "status": 200},
+		}
+		return e
+	}
+
+	cases := []struct {
+		policy   string
+		expected map[string]interface{}
+	}{
+		{
+			LabelCollisionRecordWins,
+			map[string]interface{}{
+				"host": "record",
+				"http": map[string]interface{}{"method": "GET", "status": 200},
+			},
+		},
+		{
+			LabelCollisionLabelWins,
+			map[string]interface{}{
+				"host":        "label",
+				"http":        map[string]interface{}{"method": "GET"},
+				"http.status": "500",
+			},
+		},
+		{
+			LabelCollisionPrefixLabels,
+			map[string]interface{}{
+				"host":              "record",
+				"http":              map[string]interface{}{"method": "GET", "status": 200},
+				"label_host":        "label",
+				"label_http.status": "500",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			e := newEntry()
+			doc, collisions, err := flatDocument(e, tc.policy)
+			require.NoError(t, err)
+			require.Equal(t, []string{"host", "http.status"}, collisions)
+
+			tc.expected["@timestamp"] = "2020-10-07T12:00:00Z"
+			tc.expected["severity"] = "default"
+			tc.expected["env"] = "prod"
+			require.Equal(t, tc.expected, doc)
+
+			// The record of the entry is not changed
+			require.Equal(t, newEntry().Record, e.Record)
+		})
+	}
+
+	t.Run(LabelCollisionError, func(t *testing.T) {
+		doc, collisions, err := flatDocument(newEntry(), LabelCollisionError)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "host, http.status")
+		require.Equal(t, []string{"host", "http.status"}, collisions)
+		require.Nil(t, doc)
+	})
+}
+
+func TestFlatDocumentNestedCollision(t *testing.T) {
+	cases := []struct {
+		name     string
+		label    string
+		record   map[string]interface{}
+		collides bool
+	}{
+		{"Sibling", "http.method", map[string]interface{}{"http": map[string]interface{}{"status": 200}}, false},
+		{"Nested", "http.status", map[string]interface{}{"http": map[string]interface{}{"status": 200}}, true},
+		{"NestedString", "http.status", map[string]interface{}{"http": map[string]string{"status": "200"}}, true},
+		{"DottedKey", "http.status", map[string]interface{}{"http.status": 200}, true},
+		{"ParentOfField", "http", map[string]interface{}{"http.status": 200}, true},
+		{"ChildOfScalar", "http.status", map[string]interface{}{"http": "GET /"}, true},
+		{"DeepDottedKey", "a.b.c", map[string]interface{}{"a": map[string]interface{}{"b.c": 1}}, true},
+		{"CommonPrefix", "http.status", map[string]interface{}{"https": 1}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := entry.New()
+			e.Labels = map[string]string{tc.label: "label"}
+			e.Record = tc.record
+			_, collisions, err := flatDocument(e, LabelCollisionError)
+			if tc.collides {
+				require.Error(t, err)
+				require.Equal(t, []string{tc.label}, collisions)
+				return
+			}
+			require.NoError(t, err)
+			require.Empty(t, collisions)
+		})
+	}
+}
+
+func TestFlatDocumentResourceCollision(t *testing.T) {
+	// The record, the resource and a label of the entry all map to resource
+	newEntry := func() *entry.Entry {
+		e := entry.New()
+		e.Timestamp = time.Date(2020, 10, 7, 12, 0, 0, 0, time.UTC)
+		e.Labels = map[string]string{"resource": "label", "resource.cluster": "label"}
+		e.Resource = map[string]string{"cluster": "c1"}
+		e.Record = map[string]interface{}{"resource": "record"}
+		return e
+	}
+
+	cases := []struct {
+		policy   string
+		expected map[string]interface{}
+	}{
+		{
+			LabelCollisionRecordWins,
+			map[string]interface{}{"resource": map[string]string{"cluster": "c1"}},
+		},
+		{
+			// The first label replaces the resource, and the second collides
+			// with the first
+			LabelCollisionLabelWins,
+			map[string]interface{}{"resource.cluster": "label"},
+		},
+		{
+			// The second prefixed label collides with the first, and is
+			// not sent
+			LabelCollisionPrefixLabels,
+			map[string]interface{}{
+				"resource":       map[string]string{"cluster": "c1"},
+				"label_resource": "label",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			doc, collisions, err := flatDocument(newEntry(), tc.policy)
+			require.NoError(t, err)
+			require.Equal(t, []string{"resource", "resource.cluster"}, collisions)
+
+			tc.expected["@timestamp"] = "2020-10-07T12:00:00Z"
+			tc.expected["severity"] = "default"
+			require.Equal(t, tc.expected, doc)
+		})
+	}
+}
+
+func TestElasticsearchOutputBuildFailure(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*ElasticOutputConfig)
+		errorMsg string
+	}{
+		{"IndexAndIndexField", func(c *ElasticOutputConfig) { f := entry.NewRecordField("index"); c.IndexField = &f }, "index and index_field cannot both be set"},
+		{"InvalidIndex", func(c *ElasticOutputConfig) { c.Index = "logs-%Q" }, "invalid index"},
+		{"InvalidDocument", func(c *ElasticOutputConfig) { c.Document = "nested" }, "invalid document 'nested'"},
+		{"InvalidLabelCollision", func(c *ElasticOutputConfig) { c.LabelCollision = "merge" }, "invalid label_collision 'merge'"},
+		{"CertWithoutKey", func(c *ElasticOutputConfig) { c.TLS = &helper.TLSConfig{CertFile: "cert.pem"} }, "tls cert_file cert.pem requires key_file"},
+		{"MissingCA", func(c *ElasticOutputConfig) { c.TLS = &helper.TLSConfig{CAFile: "missing.pem"} }, "read ca_file: open missing.pem"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewElasticsearchOutputConfig("test")
+			cfg.Addresses = []string{"http://localhost:9200"}
+			tc.modify(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+// bulkServer is an elasticsearch server that records the bulk requests it
+// receives, and replies with the next of its responses
+type bulkServer struct {
+	*httptest.Server
+	mux       sync.Mutex
+	requests  [][]string
+	responses []func(http.ResponseWriter, int)
+}
+
+func newBulkServer(t *testing.T, responses ...func(http.ResponseWriter, int)) *bulkServer {
+	s := &bulkServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/_bulk", r.URL.Path)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var lines []string
+		scanner := bufio.NewScanner(strings.NewReader(string(body)))
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+
+		s.mux.Lock()
+		s.requests = append(s.requests, lines)
+		respond := s.responses[0]
+		if len(s.responses) > 1 {
+			s.responses = s.responses[1:]
+		}
+		s.mux.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		respond(w, len(lines)/2)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *bulkServer) Requests() [][]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.requests
+}
+
+// bulkItems replies with an item of each status, or 201 for items beyond them
+func bulkItems(statuses ...int) func(http.ResponseWriter, int) {
+	return func(w http.ResponseWriter, n int) {
+		items := make([]map[string]interface{}, n)
+		errors := false
+		for i := range items {
+			result := map[string]interface{}{"status": 201}
+			if i < len(statuses) && statuses[i] >= 300 {
+				errors = true
+				result["status"] = statuses[i]
+				result["error"] = map[string]string{"type": "test_exception", "reason": "test"}
+			}
+			items[i] = map[string]interface{}{"index": result}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "errors": errors, "items": items})
+	}
+}
+
+func bulkStatus(status int) func(http.ResponseWriter, int) {
+	return func(w http.ResponseWriter, n int) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":"test"}`))
+	}
+}
+
+func newTestElasticsearchOutput(t *testing.T, address string) *ElasticOutput {
+	cfg := NewElasticsearchOutputConfig("test")
+	cfg.Addresses = []string{address}
+	cfg.FlusherConfig.MaxWait.Duration = 10 * time.Millisecond
+	bc := testutil.NewBuildContext(t)
+	bc.CollectStats = true
+	ops, err := cfg.Build(bc)
+	require.NoError(t, err)
+	return ops[0].(*ElasticOutput)
+}
+
+func newTestEntry(message string) *entry.Entry {
+	e := entry.New()
+	e.Timestamp = time.Date(2020, 10, 7, 12, 0, 0, 0, time.UTC)
+	e.Labels = map[string]string{"env": "prod"}
+	e.Record = message
+	return e
+}
+
+func TestElasticsearchOutputBulkBody(t *testing.T) {
+	server := newBulkServer(t, bulkItems())
+	output := newTestElasticsearchOutput(t, server.URL)
+
+	err := output.ProcessMulti(context.Background(), []*entry.Entry{newTestEntry("a"), newTestEntry("b")})
+	require.NoError(t, err)
+
+	requests := server.Requests()
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0], 4)
+
+	for i, message := range []string{"a", "b"} {
+		var directive map[string]map[string]string
+		require.NoError(t, json.Unmarshal([]byte(requests[0][i*2]), &directive))
+		require.Equal(t, "logs-2020.10.07", directive["index"]["_index"])
+		require.NotEmpty(t, directive["index"]["_id"])
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(requests[0][i*2+1]), &doc))
+		require.Equal(t, map[string]interface{}{
+			"@timestamp": "2020-10-07T12:00:00Z",
+			"severity":   "default",
+			"env":        "prod",
+			"message":    message,
+		}, doc)
+	}
+}
+
+func TestElasticsearchOutputPartialFailure(t *testing.T) {
+	server := newBulkServer(t, bulkItems(201, 429, 400, 503))
+	output := newTestElasticsearchOutput(t, server.URL)
+
+	entries := []*entry.Entry{newTestEntry("ok"), newTestEntry("throttled"), newTestEntry("mapping"), newTestEntry("unavailable")}
+	require.NoError(t, output.ProcessMulti(context.Background(), entries))
+
+	// Items that can be retried are added to the buffer again
+	requeued := make([]*entry.Entry, 10)
+	_, n, err := output.Buffer.Read(requeued)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, "throttled", requeued[0].Record)
+	require.Equal(t, "unavailable", requeued[1].Record)
+
+	// The rest of the failed items are dropped
+	require.Equal(t, uint64(1), output.OperatorStats().Snapshot().Dropped)
+}
+
+func TestElasticsearchOutputRequeueFull(t *testing.T) {
+	defer func(timeout time.Duration) { requeueTimeout = timeout }(requeueTimeout)
+	requeueTimeout = 10 * time.Millisecond
+
+	server := newBulkServer(t, bulkItems(201, 429, 503))
+	cfg := NewElasticsearchOutputConfig("test")
+	cfg.Addresses = []string{server.URL}
+	cfg.BufferConfig = buffer.Config{Builder: &buffer.MemoryBufferConfig{Type: "memory", MaxEntries: 1}}
+	bc := testutil.NewBuildContext(t)
+	bc.CollectStats = true
+	ops, err := cfg.Build(bc)
+	require.NoError(t, err)
+	output := ops[0].(*ElasticOutput)
+
+	// The indexed item is not sent again, so the chunk is not retried, and
+	// the item that does not fit in the buffer is dropped
+	entries := []*entry.Entry{newTestEntry("ok"), newTestEntry("throttled"), newTestEntry("unavailable")}
+	require.NoError(t, output.ProcessMulti(context.Background(), entries))
+	require.Equal(t, uint64(1), output.OperatorStats().Snapshot().Dropped)
+
+	requeued := make([]*entry.Entry, 10)
+	_, n, err := output.Buffer.Read(requeued)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, "throttled", requeued[0].Record)
+}
+
+func TestElasticsearchOutputRetry(t *testing.T) {
+	server := newBulkServer(t, bulkStatus(http.StatusTooManyRequests), bulkItems(429), bulkItems())
+	output := newTestElasticsearchOutput(t, server.URL)
+	require.NoError(t, output.Start())
+	defer output.Stop()
+
+	require.NoError(t, output.Process(context.Background(), newTestEntry("a")))
+
+	// The chunk is retried with a backoff when the request fails, and when
+	// every item of it fails with a status that can be retried
+	require.Eventually(t, func() bool {
+		return len(server.Requests()) == 3
+	}, 10*time.Second, 10*time.Millisecond)
+
+	for _, request := range server.Requests() {
+		require.Len(t, request, 2)
+		require.Contains(t, request[1], `"message":"a"`)
+	}
+	require.Equal(t, uint64(0), output.OperatorStats().Snapshot().Dropped)
+}
+
+func TestElasticsearchOutputConnectivityCheck(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		errorMsg string
+	}{
+		{"Reachable", http.StatusOK, ""},
+		{"Unauthorized", http.StatusUnauthorized, "401"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var methods []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				methods = append(methods, r.Method+" "+r.URL.Path)
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			output := newTestElasticsearchOutput(t, server.URL)
+			err := output.ConnectivityCheck(context.Background())
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, []string{"HEAD /"}, methods)
+		})
+	}
+
+	t.Run("Unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		output := newTestElasticsearchOutput(t, server.URL)
+		require.Error(t, output.ConnectivityCheck(context.Background()))
+	})
+}
@@ -1,18 +1,25 @@
 package file
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"html/template"
-	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
 )
 
+// FormatJSON writes each entry as a line of JSON
+const FormatJSON = "json"
+
 func init() {
 	operator.Register("file_output", func() operator.Builder { return NewFileOutputConfig("") })
 }
@@ -20,7 +27,10 @@ func init() {
 // NewFileOutputConfig creates a new file output config with default values
 func NewFileOutputConfig(operatorID string) *FileOutputConfig {
 	return &FileOutputConfig{
-		OutputConfig: helper.NewOutputConfig(operatorID, "file_output"),
+		OutputConfig:  helper.NewOutputConfig(operatorID, "file_output"),
+		MaxBackups:    5,
+		IdleTimeout:   helper.Duration{Duration: 5 * time.Minute},
+		FlushInterval: helper.Duration{Duration: 100 * time.Millisecond},
 	}
 }
 
@@ -28,19 +38,26 @@ func NewFileOutputConfig(operatorID string) *FileOutputConfig {
 type FileOutputConfig struct {
 	helper.OutputConfig `yaml:",inline"`
 
-	Path   string `json:"path" yaml:"path"`
-	Format string `json:"format,omitempty" path:"format,omitempty"`
+	helper.JSONKeyOrderConfig `yaml:",inline"`
+
+	Path          string                   `json:"path"                     yaml:"path" required:"true"`
+	Format        string                   `json:"format,omitempty"         yaml:"format,omitempty"`
+	Compression   helper.CompressionConfig `json:"compression,omitempty"    yaml:"compression,omitempty"`
+	MaxSizeMB     int                      `json:"max_size_mb,omitempty"    yaml:"max_size_mb,omitempty"`
+	MaxBackups    int                      `json:"max_backups,omitempty"    yaml:"max_backups,omitempty"`
+	IdleTimeout   helper.Duration          `json:"idle_timeout,omitempty"   yaml:"idle_timeout,omitempty"`
+	FlushInterval helper.Duration          `json:"flush_interval,omitempty" yaml:"flush_interval,omitempty"`
 }
 
 // Build will build a file output operator.
 func (c FileOutputConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
-	outputOperator, err := c.OutputConfig.Build(context)
+	outputOperator, err := c.OutputConfig.BuildWithoutFlusher(context)
 	if err != nil {
 		return nil, err
 	}
 
 	var tmpl *template.Template
-	if c.Format != "" {
+	if c.Format != "" && c.Format != FormatJSON {
 		tmpl, err = template.New("file").Parse(c.Format)
 		if err != nil {
 			return nil, err
@@ -51,63 +68,268 @@ func (c FileOutputConfig) Build(context operator.BuildContext) ([]operator.Opera
 		return nil, fmt.Errorf("must provide a path to output to")
 	}
 
+	// A path without template actions is the same for every entry
+	var pathTmpl *template.Template
+	if strings.Contains(c.Path, "{{") {
+		pathTmpl, err = template.New("path").Option("missingkey=error").Parse(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("parse path template: %s", err)
+		}
+	}
+
+	if c.MaxSizeMB < 0 {
+		return nil, fmt.Errorf("invalid max_size_mb '%d', must not be negative", c.MaxSizeMB)
+	}
+	if c.MaxSizeMB > 0 && c.MaxBackups < 1 {
+		return nil, fmt.Errorf("invalid max_backups '%d', must be at least 1", c.MaxBackups)
+	}
+	if c.IdleTimeout.Raw() <= 0 {
+		return nil, fmt.Errorf("invalid idle_timeout '%s', must be positive", c.IdleTimeout.Raw())
+	}
+	if c.FlushInterval.Raw() <= 0 {
+		return nil, fmt.Errorf("invalid flush_interval '%s', must be positive", c.FlushInterval.Raw())
+	}
+
+	compressor, err := c.Compression.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	fileOutput := &FileOutput{
 		OutputOperator: outputOperator,
 		path:           c.Path,
+		pathTmpl:       pathTmpl,
 		tmpl:           tmpl,
+		ordered:        c.JSONKeyOrderConfig.Build(),
+		compressor:     compressor,
+		maxSize:        int64(c.MaxSizeMB) * 1024 * 1024,
+		maxBackups:     c.MaxBackups,
+		idleTimeout:    c.IdleTimeout.Raw(),
+		flushInterval:  c.FlushInterval.Raw(),
+		files:          make(map[string]*outputFile),
 	}
 
 	return []operator.Operator{fileOutput}, nil
 }
 
-// FileOutput is an operator that writes logs to a file.
+// FileOutput is an operator that writes logs to files. Each file is opened
+// when the first entry is written to it, and closed once it has been idle
+// for the idle timeout.
 type FileOutput struct {
 	helper.OutputOperator
 
-	path    string
-	tmpl    *template.Template
-	encoder *json.Encoder
-	file    *os.File
-	mux     sync.Mutex
+	path          string
+	pathTmpl      *template.Template
+	tmpl          *template.Template
+	ordered       *helper.OrderedJSONEncoder
+	compressor    *helper.Compressor
+	maxSize       int64
+	maxBackups    int
+	idleTimeout   time.Duration
+	flushInterval time.Duration
+
+	files  map[string]*outputFile
+	buf    bytes.Buffer
+	mux    sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-// Start will open the output file.
+// Start will open the output file, unless its path is a template, and start
+// flushing the open files.
 func (fo *FileOutput) Start() error {
-	var err error
-	fo.file, err = os.OpenFile(fo.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
-	if err != nil {
-		return err
+	if fo.pathTmpl == nil {
+		fo.mux.Lock()
+		_, err := fo.open(fo.path)
+		fo.mux.Unlock()
+		if err != nil {
+			return err
+		}
 	}
 
-	fo.encoder = json.NewEncoder(fo.file)
-
+	ctx, cancel := context.WithCancel(context.Background())
+	fo.cancel = cancel
+	fo.wg.Add(1)
+	go func() {
+		defer fo.wg.Done()
+		fo.flushPeriodically(ctx)
+	}()
 	return nil
 }
 
-// Stop will close the output file.
+// Stop will flush and close the output files.
 func (fo *FileOutput) Stop() error {
-	if fo.file != nil {
-		fo.file.Close()
+	if fo.cancel != nil {
+		fo.cancel()
+		fo.wg.Wait()
+	}
+
+	fo.mux.Lock()
+	defer fo.mux.Unlock()
+
+	for path, file := range fo.files {
+		if err := file.close(); err != nil {
+			fo.Errorw("Failed to close file", "path", path, zap.Error(err))
+		}
+		delete(fo.files, path)
 	}
 	return nil
 }
 
-// Process will write an entry to the output file.
+// Process will write an entry to its output file.
 func (fo *FileOutput) Process(ctx context.Context, entry *entry.Entry) error {
+	path, err := fo.resolvePath(entry)
+	if err != nil {
+		return err
+	}
+
 	fo.mux.Lock()
 	defer fo.mux.Unlock()
 
-	if fo.tmpl != nil {
-		err := fo.tmpl.Execute(fo.file, entry)
-		if err != nil {
-			return err
+	fo.buf.Reset()
+	if err := fo.encode(entry); err != nil {
+		return err
+	}
+
+	file, err := fo.open(path)
+	if err != nil {
+		return err
+	}
+
+	if fo.maxSize > 0 && file.size > 0 && file.size+int64(fo.buf.Len()) > fo.maxSize {
+		if err := file.rotate(fo.maxBackups); err != nil {
+			return fmt.Errorf("rotate %s: %s", path, err)
 		}
-	} else {
-		err := fo.encoder.Encode(entry)
+	}
+
+	return file.write(fo.buf.Bytes())
+}
+
+// encode renders an entry into the buffer of the operator
+func (fo *FileOutput) encode(entry *entry.Entry) error {
+	switch {
+	case fo.tmpl != nil:
+		return fo.tmpl.Execute(&fo.buf, entry)
+	case fo.ordered != nil:
+		line, err := fo.ordered.Marshal(entry)
 		if err != nil {
 			return err
 		}
+		fo.buf.Write(line)
+		fo.buf.WriteByte('\n')
+		return nil
+	default:
+		return json.NewEncoder(&fo.buf).Encode(entry)
 	}
+}
 
-	return nil
+// resolvePath returns the path of the file that an entry is written to
+func (fo *FileOutput) resolvePath(entry *entry.Entry) (string, error) {
+	if fo.pathTmpl == nil {
+		return fo.path, nil
+	}
+
+	var b strings.Builder
+	if err := fo.pathTmpl.Execute(&b, pathData(entry)); err != nil {
+		return "", fmt.Errorf("resolve path: %s", err)
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("resolve path: path template resolved to an empty path")
+	}
+	path := b.String()
+	if hasEmptyElement(path) {
+		return "", fmt.Errorf("resolve path: path template resolved to '%s', which has an empty element", path)
+	}
+	return path, nil
+}
+
+// hasEmptyElement returns whether a path has an empty element between its
+// separators, such as a template action that rendered an empty string
+func hasEmptyElement(path string) bool {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	path = strings.ReplaceAll(path, `\`, "/")
+	for _, element := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if element == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// open returns the open file of a path, opening it if it is not open. It
+// must be called with the lock held.
+func (fo *FileOutput) open(path string) (*outputFile, error) {
+	if file, ok := fo.files[path]; ok {
+		return file, nil
+	}
+
+	file, err := openOutputFile(path, fo.compressor)
+	if err != nil {
+		return nil, err
+	}
+	fo.files[path] = file
+	return file, nil
+}
+
+// flushPeriodically flushes the writes to the open files at the flush
+// interval, and closes the files that have been idle for the idle timeout
+func (fo *FileOutput) flushPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(fo.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fo.flushAndCloseIdle(time.Now())
+		}
+	}
+}
+
+// flushAndCloseIdle flushes the open files, and closes the files that have
+// not been written to since the idle timeout
+func (fo *FileOutput) flushAndCloseIdle(now time.Time) {
+	fo.mux.Lock()
+	defer fo.mux.Unlock()
+
+	for path, file := range fo.files {
+		// The file of a path that is not a template is kept open
+		if fo.pathTmpl != nil && now.Sub(file.lastWrite) >= fo.idleTimeout {
+			if err := file.close(); err != nil {
+				fo.Errorw("Failed to close idle file", "path", path, zap.Error(err))
+			}
+			delete(fo.files, path)
+			continue
+		}
+		if err := file.flush(); err != nil {
+			fo.Errorw("Failed to flush file", "path", path, zap.Error(err))
+		}
+	}
+}
+
+// pathSanitizer replaces the path separators in the values of labels, so
+// that a label cannot write outside of the directory of a path template
+var pathSanitizer = strings.NewReplacer("/", "_", "\\", "_")
+
+// pathData is the data that a path template is executed with
+func pathData(e *entry.Entry) map[string]interface{} {
+	return map[string]interface{}{
+		"labels":    sanitizeValues(e.Labels),
+		"resource":  sanitizeValues(e.Resource),
+		"timestamp": e.Timestamp,
+		"severity":  e.Severity.String(),
+	}
+}
+
+func sanitizeValues(values map[string]string) map[string]string {
+	sanitized := make(map[string]string, len(values))
+	for key, value := range values {
+		value = pathSanitizer.Replace(value)
+		if value == "" || value == "." || value == ".." {
+			value = "_"
+		}
+		sanitized[key] = value
+	}
+	return sanitized
 }
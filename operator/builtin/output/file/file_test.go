@@ -0,0 +1,260 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileOutput(t *testing.T, cfg *FileOutputConfig) *FileOutput {
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	return ops[0].(*FileOutput)
+}
+
+func newTestEntry(record string, labels map[string]string) *entry.Entry {
+	e := entry.New()
+	e.Record = record
+	e.Labels = labels
+	return e
+}
+
+func readLines(t *testing.T, path string) []string {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestFileOutputBuild(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*FileOutputConfig)
+		errorMsg string
+	}{
+		{"Default", func(cfg *FileOutputConfig) {}, ""},
+		{"FormatJSON", func(cfg *FileOutputConfig) { cfg.Format = "json" }, ""},
+		{"PathTemplate", func(cfg *FileOutputConfig) { cfg.Path = "/tmp/{{ .labels.app }}.log" }, ""},
+		{"MissingPath", func(cfg *FileOutputConfig) { cfg.Path = "" }, "must provide a path"},
+		{"InvalidPathTemplate", func(cfg *FileOutputConfig) { cfg.Path = "/tmp/{{ .labels" }, "parse path template"},
+		{"NegativeMaxSize", func(cfg *FileOutputConfig) { cfg.MaxSizeMB = -1 }, "invalid max_size_mb"},
+		{"ZeroMaxBackups", func(cfg *FileOutputConfig) { cfg.MaxSizeMB = 1; cfg.MaxBackups = 0 }, "invalid max_backups"},
+		{"ZeroIdleTimeout", func(cfg *FileOutputConfig) { cfg.IdleTimeout.Duration = 0 }, "invalid idle_timeout"},
+		{"ZeroFlushInterval", func(cfg *FileOutputConfig) { cfg.FlushInterval.Duration = 0 }, "invalid flush_interval"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewFileOutputConfig("test")
+			cfg.Path = "/tmp/test.log"
+			tc.modify(cfg)
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.errorMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestFileOutputFormat(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = filepath.Join(tempDir, "out.log")
+	cfg.Format = "{{ .Record }} <{{ index .Labels \"app\" }}>\n"
+
+	op := newTestFileOutput(t, cfg)
+	require.NoError(t, op.Start())
+	require.NoError(t, op.Process(context.Background(), newTestEntry("a & b", map[string]string{"app": "web"})))
+	require.NoError(t, op.Stop())
+
+	// The format is not escaped as HTML
+	require.Equal(t, []string{"a & b <web>"}, readLines(t, cfg.Path))
+}
+
+func TestFileOutputTemplatedPaths(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = filepath.Join(tempDir, "{{ .labels.app }}.log")
+	cfg.Format = "{{ .Record }}\n"
+
+	op := newTestFileOutput(t, cfg)
+	require.NoError(t, op.Start())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			labels := map[string]string{"app": fmt.Sprintf("app%d", i)}
+			for j := 0; j < 100; j++ {
+				e := newTestEntry(fmt.Sprintf("app%d-%d", i, j), labels)
+				require.NoError(t, op.Process(context.Background(), e))
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, op.Stop())
+
+	for i := 0; i < 10; i++ {
+		lines := readLines(t, filepath.Join(tempDir, fmt.Sprintf("app%d.log", i)))
+		require.Len(t, lines, 100)
+		for j, line := range lines {
+			require.Equal(t, fmt.Sprintf("app%d-%d", i, j), line)
+		}
+	}
+}
+
+func TestFileOutputSanitizedPath(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = filepath.Join(tempDir, "{{ .labels.app }}.log")
+	cfg.Format = "{{ .Record }}\n"
+
+	op := newTestFileOutput(t, cfg)
+	require.NoError(t, op.Start())
+	require.NoError(t, op.Process(context.Background(), newTestEntry("a", map[string]string{"app": "../escape"})))
+	require.NoError(t, op.Process(context.Background(), newTestEntry("b", map[string]string{"app": ""})))
+	require.NoError(t, op.Stop())
+
+	require.Equal(t, []string{"a"}, readLines(t, filepath.Join(tempDir, ".._escape.log")))
+	require.Equal(t, []string{"b"}, readLines(t, filepath.Join(tempDir, "_.log")))
+}
+
+func TestFileOutputEmptyPathElement(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	cases := []struct {
+		name     string
+		path     string
+		labels   map[string]string
+		errorMsg string
+	}{
+		{"MissingLabel", "{{ .labels.app }}.log", nil, "no entry for key"},
+		{"EmptyDirectory", `{{ index .labels "dir" }}/out.log`, map[string]string{"app": "web"}, "empty element"},
+		{"TrailingSeparator", "{{ .labels.app }}/", map[string]string{"app": "web"}, "empty element"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewFileOutputConfig("test")
+			cfg.Path = tempDir + "/" + tc.path
+
+			op := newTestFileOutput(t, cfg)
+			require.NoError(t, op.Start())
+			defer op.Stop()
+
+			err := op.Process(context.Background(), newTestEntry("a", tc.labels))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestFileOutputRotation(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	path := filepath.Join(tempDir, "out.log")
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = path
+	cfg.Format = "{{ .Record }}\n"
+	cfg.MaxSizeMB = 1
+	cfg.MaxBackups = 2
+
+	op := newTestFileOutput(t, cfg)
+	op.maxSize = 8
+	require.NoError(t, op.Start())
+	for i := 0; i < 5; i++ {
+		require.NoError(t, op.Process(context.Background(), newTestEntry(fmt.Sprintf("line%d", i), nil)))
+	}
+	require.NoError(t, op.Stop())
+
+	// Each line fills a file, and the oldest backup is removed
+	require.Equal(t, []string{"line4"}, readLines(t, path))
+	require.Equal(t, []string{"line3"}, readLines(t, path+".1"))
+	require.Equal(t, []string{"line2"}, readLines(t, path+".2"))
+	require.NoFileExists(t, path+".3")
+}
+
+func TestFileOutputRestartAppends(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	path := filepath.Join(tempDir, "out.log")
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = path
+	cfg.Format = "{{ .Record }}\n"
+	cfg.MaxSizeMB = 1
+	cfg.MaxBackups = 1
+
+	op := newTestFileOutput(t, cfg)
+	op.maxSize = 12
+	require.NoError(t, op.Start())
+	require.NoError(t, op.Process(context.Background(), newTestEntry("line0", nil)))
+	require.NoError(t, op.Stop())
+
+	// The size of the existing file counts toward the next rotation
+	op = newTestFileOutput(t, cfg)
+	op.maxSize = 12
+	require.NoError(t, op.Start())
+	require.NoError(t, op.Process(context.Background(), newTestEntry("line1", nil)))
+	require.NoError(t, op.Process(context.Background(), newTestEntry("line2", nil)))
+	require.NoError(t, op.Stop())
+
+	require.Equal(t, []string{"line0", "line1"}, readLines(t, path+".1"))
+	require.Equal(t, []string{"line2"}, readLines(t, path))
+}
+
+func TestFileOutputIdleClose(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = filepath.Join(tempDir, "{{ .labels.app }}.log")
+	cfg.Format = "{{ .Record }}\n"
+
+	op := newTestFileOutput(t, cfg)
+	require.NoError(t, op.Start())
+	defer op.Stop()
+	require.NoError(t, op.Process(context.Background(), newTestEntry("a", map[string]string{"app": "web"})))
+
+	// Buffered writes are flushed before the file is closed
+	file := op.files[filepath.Join(tempDir, "web.log")]
+	op.flushAndCloseIdle(file.lastWrite.Add(op.idleTimeout))
+	require.Empty(t, op.files)
+	require.Equal(t, []string{"a"}, readLines(t, filepath.Join(tempDir, "web.log")))
+}
+
+func TestFileOutputFlushCompressed(t *testing.T) {
+	tempDir := testutil.NewTempDir(t)
+	cfg := NewFileOutputConfig("test")
+	cfg.Path = filepath.Join(tempDir, "out.log.gz")
+	cfg.Format = "{{ .Record }}\n"
+	cfg.Compression = helper.NewCompressionConfig(helper.CompressionGzip)
+
+	op := newTestFileOutput(t, cfg)
+	require.NoError(t, op.Start())
+	defer op.Stop()
+	require.NoError(t, op.Process(context.Background(), newTestEntry("a", nil)))
+
+	// A periodic flush writes the entries held by the compressor, without
+	// ending the stream
+	op.flushAndCloseIdle(time.Now())
+	f, err := os.Open(cfg.Path)
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "a\n", line)
+}
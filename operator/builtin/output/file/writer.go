@@ -0,0 +1,146 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// outputFile is a file that entries are written to. Writes are buffered, and
+// the size of the file is tracked so that it can be rotated.
+type outputFile struct {
+	path       string
+	compressor *helper.Compressor
+
+	file      *os.File
+	buffered  *bufio.Writer
+	writer    io.WriteCloser
+	size      int64
+	lastWrite time.Time
+}
+
+// openOutputFile opens a file for appending, so that the entries written by
+// an earlier run are kept
+func openOutputFile(path string, compressor *helper.Compressor) (*outputFile, error) {
+	f := &outputFile{
+		path:       path,
+		compressor: compressor,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *outputFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.buffered = bufio.NewWriter(file)
+
+	// Each open appends a new compressed stream to the file. The size counts
+	// the bytes that are buffered, as well as those written to the file.
+	f.writer, err = f.compressor.NewWriter(&countingWriter{w: f.buffered, n: &f.size})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.lastWrite = time.Now()
+	return nil
+}
+
+// write writes the bytes of an entry to the file. The buffer is flushed
+// before an entry that does not fit in it, so that a reader of the file
+// does not see a partial entry.
+func (f *outputFile) write(b []byte) error {
+	f.lastWrite = time.Now()
+	if len(b) > f.buffered.Available() {
+		if err := f.buffered.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := f.writer.Write(b)
+	return err
+}
+
+// flusher is a compressed writer that can write the data it holds without
+// ending its stream
+type flusher interface {
+	Flush() error
+}
+
+// flush writes the bytes held by the compressor and the buffer to the file,
+// so that the entries written so far can be read from it
+func (f *outputFile) flush() error {
+	if compressed, ok := f.writer.(flusher); ok {
+		if err := compressed.Flush(); err != nil {
+			return err
+		}
+	}
+	return f.buffered.Flush()
+}
+
+// close ends the compressed stream, flushes the buffered bytes and closes the file
+func (f *outputFile) close() error {
+	if err := f.writer.Close(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("close compressed stream: %s", err)
+	}
+	if err := f.buffered.Flush(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("flush: %s", err)
+	}
+	return f.file.Close()
+}
+
+// rotate closes the file, and renames it to path.1, after renaming each of
+// the backups path.N to path.N+1. The oldest backup beyond max backups is
+// removed. A new file is opened at the path.
+func (f *outputFile) rotate(maxBackups int) error {
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(backupPath(f.path, maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(f.path, i), backupPath(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, backupPath(f.path, 1)); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// countingWriter counts the bytes written to a writer
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
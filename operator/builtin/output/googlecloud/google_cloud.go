@@ -2,6 +2,7 @@ package googlecloud
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -68,11 +69,10 @@ func (c GoogleCloudOutputConfig) Build(buildContext operator.BuildContext) ([]op
 	}
 
 	googleCloudOutput := &GoogleCloudOutput{
-		OutputOperator:  outputOperator,
+		Output:          buffer.NewOutput(outputOperator, newBuffer),
 		credentials:     c.Credentials,
 		credentialsFile: c.CredentialsFile,
 		projectID:       c.ProjectID,
-		buffer:          newBuffer,
 		logNameField:    c.LogNameField,
 		traceField:      c.TraceField,
 		spanIDField:     c.SpanIDField,
@@ -80,16 +80,23 @@ func (c GoogleCloudOutputConfig) Build(buildContext operator.BuildContext) ([]op
 		useCompression:  c.UseCompression,
 	}
 
-	newFlusher := c.FlusherConfig.Build(newBuffer, googleCloudOutput.ProcessMulti, outputOperator.SugaredLogger)
+	newFlusher, err := c.FlusherConfig.Build(newBuffer, googleCloudOutput.ProcessMulti, outputOperator.SugaredLogger)
+	if err != nil {
+		_ = newBuffer.Close()
+		return nil, err
+	}
 	googleCloudOutput.flusher = newFlusher
+	googleCloudOutput.flusher.SetDeliveryWindow(outputOperator.DeliveryWindow)
+	googleCloudOutput.flusher.SetMaintenance(outputOperator.Maintenance)
+	googleCloudOutput.flusher.SetRetrier(outputOperator.Retrier)
+	googleCloudOutput.flusher.SetStats(outputOperator.OperatorStats())
 
 	return []operator.Operator{googleCloudOutput}, nil
 }
 
 // GoogleCloudOutput is an operator that sends logs to google cloud logging.
 type GoogleCloudOutput struct {
-	helper.OutputOperator
-	buffer  buffer.Buffer
+	buffer.Output
 	flusher *flusher.Flusher
 
 	credentials     string
@@ -105,33 +112,59 @@ type GoogleCloudOutput struct {
 	timeout time.Duration
 }
 
-// Start will start the google cloud logger.
-func (p *GoogleCloudOutput) Start() error {
-	var credentials *google.Credentials
-	var err error
+// ConnectivityCheck fetches an access token with the configured credentials,
+// which checks that they are valid without writing any entries
+func (p *GoogleCloudOutput) ConnectivityCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	credentials, err := p.findCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := credentials.TokenSource.Token(); err != nil {
+		return fmt.Errorf("get access token: %s", err)
+	}
+	return nil
+}
+
+// findCredentials returns the configured credentials, or the default
+// credentials if none are configured
+func (p *GoogleCloudOutput) findCredentials(ctx context.Context) (*google.Credentials, error) {
 	scope := "https://www.googleapis.com/auth/logging.write"
 	switch {
 	case p.credentials != "" && p.credentialsFile != "":
-		return errors.NewError("at most one of credentials or credentials_file can be configured", "")
+		return nil, errors.NewError("at most one of credentials or credentials_file can be configured", "")
 	case p.credentials != "":
-		credentials, err = google.CredentialsFromJSON(context.Background(), []byte(p.credentials), scope)
+		credentials, err := google.CredentialsFromJSON(ctx, []byte(p.credentials), scope)
 		if err != nil {
-			return fmt.Errorf("parse credentials: %s", err)
+			return nil, fmt.Errorf("parse credentials: %s", err)
 		}
+		return credentials, nil
 	case p.credentialsFile != "":
 		credentialsBytes, err := ioutil.ReadFile(p.credentialsFile)
 		if err != nil {
-			return fmt.Errorf("read credentials file: %s", err)
+			return nil, fmt.Errorf("read credentials file: %s", err)
 		}
-		credentials, err = google.CredentialsFromJSON(context.Background(), credentialsBytes, scope)
+		credentials, err := google.CredentialsFromJSON(ctx, credentialsBytes, scope)
 		if err != nil {
-			return fmt.Errorf("parse credentials: %s", err)
+			return nil, fmt.Errorf("parse credentials: %s", err)
 		}
+		return credentials, nil
 	default:
-		credentials, err = google.FindDefaultCredentials(context.Background(), scope)
+		credentials, err := google.FindDefaultCredentials(ctx, scope)
 		if err != nil {
-			return fmt.Errorf("get default credentials: %s", err)
+			return nil, fmt.Errorf("get default credentials: %s", err)
 		}
+		return credentials, nil
+	}
+}
+
+// Start will start the google cloud logger.
+func (p *GoogleCloudOutput) Start() error {
+	credentials, err := p.findCredentials(context.Background())
+	if err != nil {
+		return err
 	}
 
 	if p.projectID == "" && credentials.ProjectID == "" {
@@ -182,7 +215,7 @@ func (p *GoogleCloudOutput) TestConnection(ctx context.Context) error {
 // Stop will flush the google cloud logger and close the underlying connection
 func (p *GoogleCloudOutput) Stop() error {
 	p.flusher.Stop()
-	if err := p.buffer.Close(); err != nil {
+	if err := p.Buffer.Close(); err != nil {
 		return err
 	}
 	return p.client.Close()
@@ -190,7 +223,10 @@ func (p *GoogleCloudOutput) Stop() error {
 
 // Process processes an entry
 func (p *GoogleCloudOutput) Process(ctx context.Context, e *entry.Entry) error {
-	return p.buffer.Add(ctx, e)
+	if p.DeliveryWindow.Bypass(e) {
+		return p.flusher.FlushNow(ctx, []*entry.Entry{e})
+	}
+	return p.Buffer.Add(ctx, e)
 }
 
 // ProcessMulti will process multiple log entries and send them in batch to google cloud logging.
@@ -274,6 +310,17 @@ func (p *GoogleCloudOutput) createProtobufEntry(e *entry.Entry) (newEntry *logpb
 		}
 	}
 
+	// The trace context of the entry is used unless it is set from a field
+	if newEntry.Trace == "" && len(e.TraceID) > 0 {
+		newEntry.Trace = fmt.Sprintf("projects/%s/traces/%s", p.projectID, hex.EncodeToString(e.TraceID))
+	}
+	if newEntry.SpanId == "" && len(e.SpanID) > 0 {
+		newEntry.SpanId = hex.EncodeToString(e.SpanID)
+	}
+	if len(e.TraceFlags) > 0 {
+		newEntry.TraceSampled = e.TraceFlags[0]&1 == 1
+	}
+
 	newEntry.Severity = convertSeverity(e.Severity)
 	err = setPayload(newEntry, e.Record)
 	if err != nil {
@@ -111,6 +111,34 @@ func TestGoogleCloudOutput(t *testing.T) {
 				return req
 			}(),
 		},
+		{
+			"TraceContext",
+			googleCloudBasicConfig(),
+			&entry.Entry{
+				Timestamp:  now,
+				TraceID:    []byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+				SpanID:     []byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+				TraceFlags: []byte{0x01},
+				Record: map[string]interface{}{
+					"message": "test message",
+				},
+			},
+			func() *logpb.WriteLogEntriesRequest {
+				req := googleCloudBasicWriteEntriesRequest()
+				req.Entries = []*logpb.LogEntry{
+					{
+						Trace:        "projects/test_project_id/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+						SpanId:       "00f067aa0ba902b7",
+						TraceSampled: true,
+						Timestamp:    protoTs,
+						Payload: &logpb.LogEntry_JsonPayload{JsonPayload: jsonMapToProtoStruct(map[string]interface{}{
+							"message": "test message",
+						})},
+					},
+				}
+				return req
+			}(),
+		},
 		{
 			"Labels",
 			func() *GoogleCloudOutputConfig {
@@ -504,3 +532,48 @@ func mapOfSize(keys, depth int) map[string]interface{} {
 	}
 	return m
 }
+
+func TestGoogleCloudConnectivityCheck(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*GoogleCloudOutputConfig)
+		expected string
+	}{
+		{
+			"ConflictingCredentials",
+			func(cfg *GoogleCloudOutputConfig) {
+				cfg.Credentials = "{}"
+				cfg.CredentialsFile = "credentials.json"
+			},
+			"at most one of credentials or credentials_file can be configured",
+		},
+		{
+			"InvalidCredentials",
+			func(cfg *GoogleCloudOutputConfig) {
+				cfg.Credentials = "not json"
+			},
+			"parse credentials",
+		},
+		{
+			"MissingCredentialsFile",
+			func(cfg *GoogleCloudOutputConfig) {
+				cfg.CredentialsFile = "/does/not/exist.json"
+			},
+			"read credentials file",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := googleCloudBasicConfig()
+			tc.modify(cfg)
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			op := ops[0].(*GoogleCloudOutput)
+
+			err = op.ConnectivityCheck(context.Background())
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
@@ -2,7 +2,6 @@ package newrelic
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -32,6 +31,7 @@ func NewNewRelicOutputConfig(operatorID string) *NewRelicOutputConfig {
 		BaseURI:       "https://log-api.newrelic.com/log/v1",
 		Timeout:       helper.NewDuration(10 * time.Second),
 		MessageField:  entry.NewRecordField(),
+		Compression:   helper.NewCompressionConfig(helper.CompressionGzip),
 	}
 }
 
@@ -46,6 +46,8 @@ type NewRelicOutputConfig struct {
 	LicenseKey   string          `json:"license_key,omitempty"   yaml:"license_key,omitempty"`
 	Timeout      helper.Duration `json:"timeout,omitempty"       yaml:"timeout,omitempty"`
 	MessageField entry.Field     `json:"message_field,omitempty" yaml:"message_field,omitempty"`
+
+	Compression helper.CompressionConfig `json:"compression,omitempty" yaml:"compression,omitempty"`
 }
 
 // Build will build a new NewRelicOutput
@@ -55,12 +57,27 @@ func (c NewRelicOutputConfig) Build(context operator.BuildContext) ([]operator.O
 		return nil, err
 	}
 
-	headers, err := c.getHeaders()
+	compressor, err := c.Compression.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	// The New Relic Log API only accepts gzip compressed or uncompressed payloads
+	switch compressor.Codec() {
+	case helper.CompressionGzip, helper.CompressionNone:
+	default:
+		return nil, errors.NewError(
+			fmt.Sprintf("compression codec '%s' is not supported by New Relic", compressor.Codec()),
+			"use the 'gzip' or 'none' codec",
+		)
+	}
+
+	headers, err := c.getHeaders(compressor)
 	if err != nil {
 		return nil, err
 	}
 
-	buffer, err := c.BufferConfig.Build(context, c.ID())
+	outputBuffer, err := c.BufferConfig.Build(context, c.ID())
 	if err != nil {
 		return nil, err
 	}
@@ -71,24 +88,35 @@ func (c NewRelicOutputConfig) Build(context operator.BuildContext) ([]operator.O
 	}
 
 	nro := &NewRelicOutput{
-		OutputOperator: outputOperator,
-		buffer:         buffer,
-		client:         &http.Client{},
-		headers:        headers,
-		url:            url,
-		timeout:        c.Timeout.Raw(),
-		messageField:   c.MessageField,
+		Output:       buffer.NewOutput(outputOperator, outputBuffer),
+		client:       &http.Client{},
+		headers:      headers,
+		url:          url,
+		timeout:      c.Timeout.Raw(),
+		messageField: c.MessageField,
+		compressor:   compressor,
 	}
 
-	nro.flusher = c.FlusherConfig.Build(buffer, nro.ProcessMulti, nro.SugaredLogger)
+	nro.flusher, err = c.FlusherConfig.Build(outputBuffer, nro.ProcessMulti, nro.SugaredLogger)
+	if err != nil {
+		_ = outputBuffer.Close()
+		return nil, err
+	}
+	nro.flusher.SetDeliveryWindow(nro.DeliveryWindow)
+	nro.flusher.SetMaintenance(nro.Maintenance)
+	nro.flusher.SetRetrier(nro.Retrier)
+	nro.flusher.SetStats(outputOperator.OperatorStats())
 
 	return []operator.Operator{nro}, nil
 }
 
-func (c NewRelicOutputConfig) getHeaders() (http.Header, error) {
+func (c NewRelicOutputConfig) getHeaders(compressor *helper.Compressor) (http.Header, error) {
 	headers := http.Header{
-		"X-Event-Source":   []string{"logs"},
-		"Content-Encoding": []string{"gzip"},
+		"X-Event-Source": []string{"logs"},
+	}
+
+	if encoding := compressor.ContentEncoding(); encoding != "" {
+		headers["Content-Encoding"] = []string{encoding}
 	}
 
 	if c.APIKey == "" && c.LicenseKey == "" {
@@ -104,8 +132,7 @@ func (c NewRelicOutputConfig) getHeaders() (http.Header, error) {
 
 // NewRelicOutput is an operator that sends entries to the New Relic Logs platform
 type NewRelicOutput struct {
-	helper.OutputOperator
-	buffer  buffer.Buffer
+	buffer.Output
 	flusher *flusher.Flusher
 
 	client       *http.Client
@@ -113,16 +140,25 @@ type NewRelicOutput struct {
 	headers      http.Header
 	timeout      time.Duration
 	messageField entry.Field
+	compressor   *helper.Compressor
 }
 
-// Start tests the connection to New Relic and begins flushing entries
-func (nro *NewRelicOutput) Start() error {
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), nro.timeout)
+// ConnectivityCheck sends an empty payload to New Relic, which checks
+// the endpoint and license key without sending any entries
+func (nro *NewRelicOutput) ConnectivityCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, nro.timeout)
 	defer cancel()
 	if err := nro.ProcessMulti(ctx, nil); err != nil {
 		return errors.Wrap(err, "test connection")
 	}
+	return nil
+}
+
+// Start tests the connection to New Relic and begins flushing entries
+func (nro *NewRelicOutput) Start() error {
+	if err := nro.ConnectivityCheck(context.Background()); err != nil {
+		return err
+	}
 
 	nro.flusher.Start()
 	return nil
@@ -131,12 +167,15 @@ func (nro *NewRelicOutput) Start() error {
 // Stop tells the NewRelicOutput to stop gracefully
 func (nro *NewRelicOutput) Stop() error {
 	nro.flusher.Stop()
-	return nro.buffer.Close()
+	return nro.Buffer.Close()
 }
 
 // Process adds an entry to the output's buffer
-func (nro *NewRelicOutput) Process(ctx context.Context, entry *entry.Entry) error {
-	return nro.buffer.Add(ctx, entry)
+func (nro *NewRelicOutput) Process(ctx context.Context, e *entry.Entry) error {
+	if nro.DeliveryWindow.Bypass(e) {
+		return nro.flusher.FlushNow(ctx, []*entry.Entry{e})
+	}
+	return nro.Buffer.Add(ctx, e)
 }
 
 // ProcessMulti will send a chunk of entries to New Relic
@@ -147,7 +186,8 @@ func (nro *NewRelicOutput) ProcessMulti(ctx context.Context, entries []*entry.En
 	defer cancel()
 	req, err := nro.newRequest(ctx, lp)
 	if err != nil {
-		return errors.Wrap(err, "create request")
+		// A payload that cannot be encoded fails the same way on each retry
+		return helper.NewPermanentError(errors.Wrap(err, "create request"))
 	}
 
 	res, err := nro.client.Do(req)
@@ -161,7 +201,10 @@ func (nro *NewRelicOutput) ProcessMulti(ctx context.Context, entries []*entry.En
 // newRequest creates a new http.Request with the given context and payload
 func (nro *NewRelicOutput) newRequest(ctx context.Context, payload LogPayload) (*http.Request, error) {
 	var buf bytes.Buffer
-	wr := gzip.NewWriter(&buf)
+	wr, err := nro.compressor.NewWriter(&buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "create compressor")
+	}
 	enc := json.NewEncoder(wr)
 	if err := enc.Encode(payload); err != nil {
 		return nil, errors.Wrap(err, "encode payload")
@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -40,6 +41,15 @@ func TestNewRelicConfigBuild(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "is not a valid URL")
 	})
+
+	t.Run("UnsupportedCompression", func(t *testing.T) {
+		cfg := NewNewRelicOutputConfig("test")
+		cfg.LicenseKey = "testkey"
+		cfg.Compression = helper.NewCompressionConfig(helper.CompressionZstd)
+		_, err := cfg.Build(testutil.NewBuildContext(t))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not supported by New Relic")
+	})
 }
 
 func TestNewRelicOutput(t *testing.T) {
@@ -84,6 +94,17 @@ func TestNewRelicOutput(t *testing.T) {
 			}},
 			`[{"common":{"attributes":{"plugin":{"type":"stanza","version":"unknown"}}},"logs":[{"timestamp":1476089932000,"attributes":{"labels":null,"record":{"log":"testlog","message":"testmessage"},"resource":null,"severity":"default"},"message":"testlog"}]}]` + "\n",
 		},
+		{
+			"Uncompressed",
+			func(cfg *NewRelicOutputConfig) {
+				cfg.Compression = helper.NewCompressionConfig(helper.CompressionNone)
+			},
+			[]*entry.Entry{{
+				Timestamp: time.Date(2016, 10, 10, 8, 58, 52, 0, time.UTC),
+				Record:    "test",
+			}},
+			`[{"common":{"attributes":{"plugin":{"type":"stanza","version":"unknown"}}},"logs":[{"timestamp":1476089932000,"attributes":{"labels":null,"record":"test","resource":null,"severity":"default"},"message":"test"}]}]` + "\n",
+		},
 	}
 
 	for _, tc := range cases {
@@ -183,9 +204,13 @@ func handle(ch chan []byte) func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(200)
 		rw.Write([]byte(`{}`))
 
-		rd, err := gzip.NewReader(req.Body)
-		if err != nil {
-			panic(err)
+		var rd io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(req.Body)
+			if err != nil {
+				panic(err)
+			}
+			rd = gzipReader
 		}
 		body, err := ioutil.ReadAll(rd)
 		if err != nil {
@@ -28,19 +28,22 @@ func NewStdoutConfig(operatorID string) *StdoutConfig {
 
 // StdoutConfig is the configuration of the Stdout operator
 type StdoutConfig struct {
-	helper.OutputConfig `yaml:",inline"`
+	helper.OutputConfig       `yaml:",inline"`
+	helper.JSONKeyOrderConfig `yaml:",inline"`
 }
 
 // Build will build a stdout operator.
 func (c StdoutConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
-	outputOperator, err := c.OutputConfig.Build(context)
+	outputOperator, err := c.OutputConfig.BuildWithoutFlusher(context)
 	if err != nil {
 		return nil, err
 	}
 
 	op := &StdoutOperator{
 		OutputOperator: outputOperator,
+		writer:         Stdout,
 		encoder:        json.NewEncoder(Stdout),
+		ordered:        c.JSONKeyOrderConfig.Build(),
 	}
 	return []operator.Operator{op}, nil
 }
@@ -48,14 +51,16 @@ func (c StdoutConfig) Build(context operator.BuildContext) ([]operator.Operator,
 // StdoutOperator is an operator that logs entries using stdout.
 type StdoutOperator struct {
 	helper.OutputOperator
+	writer  io.Writer
 	encoder *json.Encoder
+	ordered *helper.OrderedJSONEncoder
 	mux     sync.Mutex
 }
 
 // Process will log entries received.
 func (o *StdoutOperator) Process(ctx context.Context, entry *entry.Entry) error {
 	o.mux.Lock()
-	err := o.encoder.Encode(entry)
+	err := o.encode(entry)
 	if err != nil {
 		o.mux.Unlock()
 		o.Errorf("Failed to process entry: %s, $s", err, entry.Record)
@@ -64,3 +69,17 @@ func (o *StdoutOperator) Process(ctx context.Context, entry *entry.Entry) error
 	o.mux.Unlock()
 	return nil
 }
+
+// encode will write an entry to stdout as a line of JSON.
+func (o *StdoutOperator) encode(e *entry.Entry) error {
+	if o.ordered == nil {
+		return o.encoder.Encode(e)
+	}
+
+	line, err := o.ordered.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = o.writer.Write(append(line, '\n'))
+	return err
+}
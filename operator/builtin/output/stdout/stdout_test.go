@@ -44,3 +44,30 @@ func TestStdoutOperator(t *testing.T) {
 	expected := `{"timestamp":` + string(marshalledTimestamp) + `,"severity":0,"record":"test record"}` + "\n"
 	require.Equal(t, expected, buf.String())
 }
+
+func TestStdoutOperatorKeyOrder(t *testing.T) {
+	cfg := NewStdoutConfig("test_operator_id")
+	cfg.KeyOrder = []string{"message", "level"}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0].(*StdoutOperator)
+
+	var buf bytes.Buffer
+	op.writer = &buf
+
+	e := &entry.Entry{
+		Timestamp: time.Unix(1591042864, 0).UTC(),
+		Record: map[string]interface{}{
+			"b":       1,
+			"a":       2,
+			"level":   "info",
+			"message": "hello",
+		},
+	}
+	err = op.Process(context.Background(), e)
+	require.NoError(t, err)
+
+	expected := `{"timestamp":"2020-06-01T20:21:04Z","severity":0,"record":{"message":"hello","level":"info","a":2,"b":1}}` + "\n"
+	require.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,177 @@
+package hybrid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+func init() {
+	operator.Register("hybrid_parser", func() operator.Builder { return NewHybridParserConfig("") })
+}
+
+// NewHybridParserConfig creates a new hybrid parser config with default values
+func NewHybridParserConfig(operatorID string) *HybridParserConfig {
+	return &HybridParserConfig{
+		ParserConfig: helper.NewParserConfig(operatorID, "hybrid_parser"),
+	}
+}
+
+// HybridParserConfig is the configuration of a hybrid parser operator.
+type HybridParserConfig struct {
+	helper.ParserConfig `yaml:",inline"`
+
+	Regex          string `json:"regex"                      yaml:"regex" required:"true"`
+	MaxMatchLength int    `json:"max_match_length,omitempty" yaml:"max_match_length,omitempty"`
+}
+
+// Build will build a hybrid parser operator.
+func (c HybridParserConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	parserOperator, err := c.ParserConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Regex == "" {
+		return nil, fmt.Errorf("missing required field 'regex'")
+	}
+
+	r, err := helper.NewRegexMatcher(c.Regex, c.MaxMatchLength, parserOperator.SugaredLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	namedCaptureGroups := 0
+	for _, groupName := range r.SubexpNames() {
+		if groupName != "" {
+			namedCaptureGroups++
+		}
+	}
+	if namedCaptureGroups == 0 {
+		return nil, errors.NewError(
+			"no named capture groups in regex pattern",
+			"use named capture groups like '^(?P<my_key>.*)$' to specify the key name for the parsed field",
+		)
+	}
+
+	hybridParser := &HybridParser{
+		ParserOperator: parserOperator,
+		regexp:         r,
+	}
+
+	return []operator.Operator{hybridParser}, nil
+}
+
+// HybridParser is an operator that parses a text prefix with a regex, and a
+// JSON object that follows the prefix at the end of the value.
+type HybridParser struct {
+	helper.ParserOperator
+	regexp *helper.RegexMatcher
+}
+
+// Process will parse an entry with a text prefix and a trailing JSON object.
+func (h *HybridParser) Process(ctx context.Context, entry *entry.Entry) error {
+	return h.ParserOperator.ProcessWith(ctx, entry, h.parse)
+}
+
+// parse will parse the prefix of a value with the regex, and the JSON object
+// at the end of the value, if there is one. The named capture groups take
+// precedence over JSON keys of the same name.
+func (h *HybridParser) parse(value interface{}) (interface{}, error) {
+	var s string
+	switch m := value.(type) {
+	case string:
+		s = m
+	case []byte:
+		s = string(m)
+	default:
+		return nil, fmt.Errorf("type '%T' cannot be parsed as hybrid", value)
+	}
+
+	prefix, object := splitTrailingJSON(s)
+
+	matches, err := h.regexp.FindStringSubmatch(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if matches == nil {
+		return nil, fmt.Errorf("regex pattern does not match")
+	}
+
+	parsedValues := make(map[string]interface{}, len(object)+len(matches))
+	for key, value := range object {
+		parsedValues[key] = value
+	}
+	for i, subexp := range h.regexp.SubexpNames() {
+		if i == 0 {
+			// Skip whole match
+			continue
+		}
+		if subexp != "" {
+			parsedValues[subexp] = matches[i]
+		}
+	}
+
+	return parsedValues, nil
+}
+
+// Counters returns the number of values that exceeded the match budget,
+// and the invalid values of the trace context, or nil if there is neither a
+// budget nor a trace context
+func (h *HybridParser) Counters() map[string]uint64 {
+	counters := h.ParserOperator.Counters()
+	if !h.regexp.HasBudget() {
+		return counters
+	}
+	if counters == nil {
+		counters = make(map[string]uint64, 1)
+	}
+	counters[helper.RegexBudgetExceededCounter] = h.regexp.Exceeded()
+	return counters
+}
+
+// splitTrailingJSON splits a value into its text prefix and the JSON object
+// that ends it. The object starts at the first '{' from which a JSON object
+// can be decoded up to the end of the value, so braces in the prefix or in
+// quoted strings of the object do not split it in the wrong place. A value
+// that does not end with a JSON object is returned whole as the prefix.
+func splitTrailingJSON(s string) (string, map[string]interface{}) {
+	trimmed := strings.TrimRight(s, " \t\r\n")
+	if !strings.HasSuffix(trimmed, "}") {
+		return s, nil
+	}
+
+	for start := strings.IndexByte(trimmed, '{'); start >= 0; {
+		if object, ok := decodeObject(trimmed[start:]); ok {
+			return strings.TrimRight(trimmed[:start], " \t"), object
+		}
+
+		next := strings.IndexByte(trimmed[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return s, nil
+}
+
+// decodeObject decodes a JSON object that must span the whole string
+func decodeObject(s string) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(s))
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, false
+	}
+
+	// The decoder stops at the end of the object, which must be the end of the value
+	if decoder.InputOffset() != int64(len(s)) {
+		return nil, false
+	}
+	return object, true
+}
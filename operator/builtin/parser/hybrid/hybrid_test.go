@@ -0,0 +1,206 @@
+package hybrid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegex = `^(?P<time>\S+ \S+) (?P<severity>\w+) (?P<message>.*)$`
+
+func newTestParser(t *testing.T, regex string) *HybridParser {
+	cfg := NewHybridParserConfig("test")
+	cfg.Regex = regex
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0]
+	return op.(*HybridParser)
+}
+
+func TestHybridParserStringFailure(t *testing.T) {
+	parser := newTestParser(t, testRegex)
+	_, err := parser.parse(`invalid {"port":8080}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "regex pattern does not match")
+}
+
+func TestHybridParserInvalidType(t *testing.T) {
+	parser := newTestParser(t, testRegex)
+	_, err := parser.parse([]int{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "type '[]int' cannot be parsed as hybrid")
+}
+
+func TestHybridParser(t *testing.T) {
+	cases := []struct {
+		name         string
+		inputRecord  interface{}
+		outputRecord interface{}
+	}{
+		{
+			"PrefixAndJSON",
+			`2024-05-12 10:00:00 INFO service started {"port":8080,"env":"prod"}`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "service started",
+				"port":     float64(8080),
+				"env":      "prod",
+			},
+		},
+		{
+			"Bytes",
+			[]byte(`2024-05-12 10:00:00 INFO service started {"port":8080}`),
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "service started",
+				"port":     float64(8080),
+			},
+		},
+		{
+			"NoJSON",
+			`2024-05-12 10:00:00 INFO service started`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "service started",
+			},
+		},
+		{
+			"BracesInPrefix",
+			`2024-05-12 10:00:00 INFO handler {main} started {"port":8080}`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "handler {main} started",
+				"port":     float64(8080),
+			},
+		},
+		{
+			"BracesInQuotedStrings",
+			`2024-05-12 10:00:00 WARN template failed {"template":"{{ .name }","error":"unexpected \"}\""}`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "WARN",
+				"message":  "template failed",
+				"template": "{{ .name }",
+				"error":    `unexpected "}"`,
+			},
+		},
+		{
+			"NestedObject",
+			`2024-05-12 10:00:00 INFO request {"http":{"method":"GET","status":200}}`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "request",
+				"http": map[string]interface{}{
+					"method": "GET",
+					"status": float64(200),
+				},
+			},
+		},
+		{
+			"TrailingWhitespace",
+			"2024-05-12 10:00:00 INFO service started {\"port\":8080}  \r\n",
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "service started",
+				"port":     float64(8080),
+			},
+		},
+		{
+			"InvalidJSON",
+			`2024-05-12 10:00:00 INFO service started {"port":8080,}`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  `service started {"port":8080,}`,
+			},
+		},
+		{
+			"TextAfterJSON",
+			`2024-05-12 10:00:00 INFO service started {"port":8080} done`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  `service started {"port":8080} done`,
+			},
+		},
+		{
+			"CaptureGroupsTakePrecedence",
+			`2024-05-12 10:00:00 INFO service started {"severity":"debug","port":8080}`,
+			map[string]interface{}{
+				"time":     "2024-05-12 10:00:00",
+				"severity": "INFO",
+				"message":  "service started",
+				"port":     float64(8080),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewHybridParserConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Regex = testRegex
+
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			op := ops[0]
+
+			fake := testutil.NewFakeOutput(t)
+			op.SetOutputs([]operator.Operator{fake})
+
+			entry := entry.New()
+			entry.Record = tc.inputRecord
+			err = op.Process(context.Background(), entry)
+			require.NoError(t, err)
+
+			fake.ExpectRecord(t, tc.outputRecord)
+		})
+	}
+}
+
+func TestBuildHybridParser(t *testing.T) {
+	newBasicHybridParser := func() *HybridParserConfig {
+		cfg := NewHybridParserConfig("test")
+		cfg.OutputIDs = []string{"test"}
+		cfg.Regex = "(?P<all>.*)"
+		return cfg
+	}
+
+	t.Run("BasicConfig", func(t *testing.T) {
+		c := newBasicHybridParser()
+		_, err := c.Build(testutil.NewBuildContext(t))
+		require.NoError(t, err)
+	})
+
+	t.Run("MissingRegexField", func(t *testing.T) {
+		c := newBasicHybridParser()
+		c.Regex = ""
+		_, err := c.Build(testutil.NewBuildContext(t))
+		require.Error(t, err)
+	})
+
+	t.Run("InvalidRegexField", func(t *testing.T) {
+		c := newBasicHybridParser()
+		c.Regex = "())()"
+		_, err := c.Build(testutil.NewBuildContext(t))
+		require.Error(t, err)
+	})
+
+	t.Run("NoNamedGroups", func(t *testing.T) {
+		c := newBasicHybridParser()
+		c.Regex = ".*"
+		_, err := c.Build(testutil.NewBuildContext(t))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no named capture groups")
+	})
+}
@@ -2,6 +2,7 @@ package json
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	jsoniter "github.com/json-iterator/go"
@@ -10,6 +11,16 @@ import (
 	"github.com/observiq/stanza/operator/helper"
 )
 
+const (
+	// NumberTypeFloat64 parses numbers as float64, which loses the precision
+	// of integers larger than 2^53
+	NumberTypeFloat64 = "float64"
+	// NumberTypeInt64 parses integers as int64 and other numbers as float64
+	NumberTypeInt64 = "int64"
+	// NumberTypeJSONNumber keeps numbers as json.Number, the string of the number
+	NumberTypeJSONNumber = "json_number"
+)
+
 func init() {
 	operator.Register("json_parser", func() operator.Builder { return NewJSONParserConfig("") })
 }
@@ -18,12 +29,18 @@ func init() {
 func NewJSONParserConfig(operatorID string) *JSONParserConfig {
 	return &JSONParserConfig{
 		ParserConfig: helper.NewParserConfig(operatorID, "json_parser"),
+		NumberType:   NumberTypeFloat64,
 	}
 }
 
 // JSONParserConfig is the configuration of a JSON parser operator.
 type JSONParserConfig struct {
 	helper.ParserConfig `yaml:",inline"`
+
+	Flatten    bool         `json:"flatten,omitempty"     yaml:"flatten,omitempty"`
+	MaxDepth   int          `json:"max_depth,omitempty"   yaml:"max_depth,omitempty"`
+	NumberType string       `json:"number_type,omitempty" yaml:"number_type,omitempty"`
+	RawField   *entry.Field `json:"raw_field,omitempty"   yaml:"raw_field,omitempty"`
 }
 
 // Build will build a JSON parser operator.
@@ -33,9 +50,31 @@ func (c JSONParserConfig) Build(context operator.BuildContext) ([]operator.Opera
 		return nil, err
 	}
 
+	if c.MaxDepth < 0 {
+		return nil, fmt.Errorf("invalid max_depth '%d', must not be negative", c.MaxDepth)
+	}
+
+	api := jsoniter.ConfigFastest
+	switch c.NumberType {
+	case NumberTypeFloat64, "":
+	case NumberTypeInt64, NumberTypeJSONNumber:
+		api = jsoniter.Config{
+			EscapeHTML:                    false,
+			MarshalFloatWith6Digits:       true,
+			ObjectFieldMustBeSimpleString: true,
+			UseNumber:                     true,
+		}.Froze()
+	default:
+		return nil, fmt.Errorf("invalid number_type '%s'", c.NumberType)
+	}
+
 	jsonParser := &JSONParser{
 		ParserOperator: parserOperator,
-		json:           jsoniter.ConfigFastest,
+		json:           api,
+		flatten:        c.Flatten,
+		maxDepth:       c.MaxDepth,
+		int64Numbers:   c.NumberType == NumberTypeInt64,
+		rawField:       c.RawField,
 	}
 
 	return []operator.Operator{jsonParser}, nil
@@ -44,12 +83,36 @@ func (c JSONParserConfig) Build(context operator.BuildContext) ([]operator.Opera
 // JSONParser is an operator that parses JSON.
 type JSONParser struct {
 	helper.ParserOperator
-	json jsoniter.API
+	json         jsoniter.API
+	flatten      bool
+	maxDepth     int
+	int64Numbers bool
+	rawField     *entry.Field
 }
 
 // Process will parse an entry for JSON.
 func (j *JSONParser) Process(ctx context.Context, entry *entry.Entry) error {
-	return j.ParserOperator.ProcessWith(ctx, entry, j.parse)
+	if j.rawField == nil {
+		return j.ParserOperator.ProcessWith(ctx, entry, j.parse)
+	}
+
+	return j.ParserOperator.ProcessWith(ctx, entry, func(value interface{}) (interface{}, error) {
+		parsed, err := j.parse(value)
+		if err != nil {
+			j.preserveRaw(entry, value)
+		}
+		return parsed, err
+	})
+}
+
+// preserveRaw writes a value that could not be parsed to the raw field
+func (j *JSONParser) preserveRaw(e *entry.Entry, value interface{}) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if err := e.Set(*j.rawField, value); err != nil {
+		j.Debugw("Failed to preserve unparsed value", "raw_field", j.rawField.String(), "error", err)
+	}
 }
 
 // parse will parse a value as JSON.
@@ -57,11 +120,17 @@ func (j *JSONParser) parse(value interface{}) (interface{}, error) {
 	var parsedValue map[string]interface{}
 	switch m := value.(type) {
 	case string:
+		if err := j.checkDepth([]byte(m)); err != nil {
+			return nil, err
+		}
 		err := j.json.UnmarshalFromString(m, &parsedValue)
 		if err != nil {
 			return nil, err
 		}
 	case []byte:
+		if err := j.checkDepth(m); err != nil {
+			return nil, err
+		}
 		err := j.json.Unmarshal(m, &parsedValue)
 		if err != nil {
 			return nil, err
@@ -69,5 +138,87 @@ func (j *JSONParser) parse(value interface{}) (interface{}, error) {
 	default:
 		return nil, fmt.Errorf("type %T cannot be parsed as JSON", value)
 	}
+
+	if j.int64Numbers {
+		convertNumbers(parsedValue)
+	}
+	if j.flatten {
+		flattened := make(map[string]interface{}, len(parsedValue))
+		flatten("", parsedValue, flattened)
+		return flattened, nil
+	}
 	return parsedValue, nil
 }
+
+// checkDepth returns an error if objects and arrays are nested deeper than
+// the max depth, before the value is parsed
+func (j *JSONParser) checkDepth(data []byte) error {
+	if j.maxDepth == 0 {
+		return nil
+	}
+
+	depth := 0
+	inString, escaped := false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > j.maxDepth {
+				return fmt.Errorf("value is nested deeper than max_depth %d", j.maxDepth)
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// convertNumbers replaces the numbers of a parsed value with int64 if they
+// are integers, or float64 otherwise
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = convertNumbers(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = convertNumbers(nested)
+		}
+	}
+	return value
+}
+
+// flatten writes the values of nested objects to a single map, under their
+// keys joined with dots. Arrays are kept as they are.
+func flatten(prefix string, value map[string]interface{}, flattened map[string]interface{}) {
+	for key, nested := range value {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if m, ok := nested.(map[string]interface{}); ok && len(m) > 0 {
+			flatten(key, m, flattened)
+			continue
+		}
+		flattened[key] = nested
+	}
+}
@@ -2,6 +2,8 @@ package json
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,6 +42,27 @@ func TestJSONParserConfigBuildFailure(t *testing.T) {
 	require.Contains(t, err.Error(), "invalid `on_error` field")
 }
 
+func TestJSONParserConfigBuildOptionsFailure(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*JSONParserConfig)
+		errorMsg string
+	}{
+		{"NegativeMaxDepth", func(c *JSONParserConfig) { c.MaxDepth = -1 }, "invalid max_depth '-1'"},
+		{"InvalidNumberType", func(c *JSONParserConfig) { c.NumberType = "int32" }, "invalid number_type 'int32'"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewJSONParserConfig("test")
+			tc.modify(config)
+			_, err := config.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
 func TestJSONParserStringFailure(t *testing.T) {
 	parser := newTestParser(t)
 	_, err := parser.parse("invalid")
@@ -215,3 +238,173 @@ func TestJSONParserWithEmbeddedTimeParser(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONParserOptions(t *testing.T) {
+	deeplyNested := strings.Repeat(`{"a":`, 20) + "1" + strings.Repeat("}", 20)
+
+	cases := []struct {
+		name     string
+		modify   func(*JSONParserConfig)
+		input    string
+		expected map[string]interface{}
+		errorMsg string
+	}{
+		{
+			"Flatten",
+			func(c *JSONParserConfig) { c.Flatten = true },
+			`{"a":{"b":{"c":"d"},"e":"f"},"g":"h","empty":{}}`,
+			map[string]interface{}{
+				"a.b.c": "d",
+				"a.e":   "f",
+				"g":     "h",
+				"empty": map[string]interface{}{},
+			},
+			"",
+		},
+		{
+			"FlattenArrayOfObjects",
+			func(c *JSONParserConfig) { c.Flatten = true },
+			`{"spans":[{"id":1,"tags":{"k":"v"}},{"id":2}]}`,
+			map[string]interface{}{
+				"spans": []interface{}{
+					map[string]interface{}{"id": float64(1), "tags": map[string]interface{}{"k": "v"}},
+					map[string]interface{}{"id": float64(2)},
+				},
+			},
+			"",
+		},
+		{
+			"DeeplyNested",
+			func(c *JSONParserConfig) {},
+			deeplyNested,
+			nil,
+			"",
+		},
+		{
+			"MaxDepth",
+			func(c *JSONParserConfig) { c.MaxDepth = 2 },
+			`{"a":{"b":"c"},"d":["{{{{"]}`,
+			map[string]interface{}{
+				"a": map[string]interface{}{"b": "c"},
+				"d": []interface{}{"{{{{"},
+			},
+			"",
+		},
+		{
+			"MaxDepthExceeded",
+			func(c *JSONParserConfig) { c.MaxDepth = 10 },
+			deeplyNested,
+			nil,
+			"nested deeper than max_depth 10",
+		},
+		{
+			"MaxDepthExceededArray",
+			func(c *JSONParserConfig) { c.MaxDepth = 2 },
+			`{"a":[[1]]}`,
+			nil,
+			"nested deeper than max_depth 2",
+		},
+		{
+			"NumberTypeFloat64",
+			func(c *JSONParserConfig) {},
+			`{"trace_id":12345678901234567891,"n":1}`,
+			map[string]interface{}{"trace_id": float64(12345678901234567891), "n": float64(1)},
+			"",
+		},
+		{
+			"NumberTypeInt64",
+			func(c *JSONParserConfig) { c.NumberType = NumberTypeInt64 },
+			`{"trace_id":1234567890123456789,"ratio":0.5,"nested":[{"n":2}]}`,
+			map[string]interface{}{
+				"trace_id": int64(1234567890123456789),
+				"ratio":    0.5,
+				"nested":   []interface{}{map[string]interface{}{"n": int64(2)}},
+			},
+			"",
+		},
+		{
+			"NumberTypeJSONNumber",
+			func(c *JSONParserConfig) { c.NumberType = NumberTypeJSONNumber },
+			`{"trace_id":12345678901234567891,"ratio":0.5}`,
+			map[string]interface{}{
+				"trace_id": json.Number("12345678901234567891"),
+				"ratio":    json.Number("0.5"),
+			},
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewJSONParserConfig("test")
+			tc.modify(config)
+			ops, err := config.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			parser := ops[0].(*JSONParser)
+
+			parsed, err := parser.parse(tc.input)
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expected != nil {
+				require.Equal(t, tc.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestJSONParserRawField(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    interface{}
+		expected map[string]interface{}
+	}{
+		{
+			"Invalid",
+			`{"key":`,
+			map[string]interface{}{
+				"message": `{"key":`,
+				"raw":     `{"key":`,
+			},
+		},
+		{
+			"InvalidBytes",
+			[]byte("invalid"),
+			map[string]interface{}{
+				"message": []byte("invalid"),
+				"raw":     "invalid",
+			},
+		},
+		{
+			"Valid",
+			`{"key":"val"}`,
+			map[string]interface{}{
+				"key": "val",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewJSONParserConfig("test")
+			config.ParseFrom = entry.NewRecordField("message")
+			config.OutputIDs = []string{"fake"}
+			rawField := entry.NewRecordField("raw")
+			config.RawField = &rawField
+
+			ops, err := config.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			parser := ops[0].(*JSONParser)
+			fake := testutil.NewFakeOutput(t)
+			require.NoError(t, parser.SetOutputs([]operator.Operator{fake}))
+
+			e := entry.New()
+			e.Record = map[string]interface{}{"message": tc.input}
+			_ = parser.Process(context.Background(), e)
+			fake.ExpectRecord(t, tc.expected)
+		})
+	}
+}
@@ -3,7 +3,7 @@ package regex
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"sync/atomic"
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/errors"
@@ -26,7 +26,9 @@ func NewRegexParserConfig(operatorID string) *RegexParserConfig {
 type RegexParserConfig struct {
 	helper.ParserConfig `yaml:",inline"`
 
-	Regex string `json:"regex" yaml:"regex"`
+	Regex          string         `json:"regex"                      yaml:"regex" required:"true"`
+	MaxMatchLength int            `json:"max_match_length,omitempty" yaml:"max_match_length,omitempty"`
+	Repeat         []RepeatConfig `json:"repeat,omitempty"           yaml:"repeat,omitempty"`
 }
 
 // Build will build a regex parser operator.
@@ -40,27 +42,42 @@ func (c RegexParserConfig) Build(context operator.BuildContext) ([]operator.Oper
 		return nil, fmt.Errorf("missing required field 'regex'")
 	}
 
-	r, err := regexp.Compile(c.Regex)
+	r, err := helper.NewRegexMatcher(c.Regex, c.MaxMatchLength, parserOperator.SugaredLogger)
 	if err != nil {
-		return nil, fmt.Errorf("compiling regex: %s", err)
+		return nil, err
 	}
 
-	namedCaptureGroups := 0
+	namedCaptureGroups := make(map[string]bool)
 	for _, groupName := range r.SubexpNames() {
 		if groupName != "" {
-			namedCaptureGroups++
+			namedCaptureGroups[groupName] = true
 		}
 	}
-	if namedCaptureGroups == 0 {
+	if len(namedCaptureGroups) == 0 {
 		return nil, errors.NewError(
 			"no named capture groups in regex pattern",
 			"use named capture groups like '^(?P<my_key>.*)$' to specify the key name for the parsed field",
 		)
 	}
 
+	repeats := make([]*repeat, 0, len(c.Repeat))
+	destinations := make(map[string]bool, len(c.Repeat))
+	for i, repeatConfig := range c.Repeat {
+		repeat, err := repeatConfig.build(namedCaptureGroups)
+		if err != nil {
+			return nil, fmt.Errorf("repeat %d: %s", i, err)
+		}
+		if destinations[repeat.to] {
+			return nil, fmt.Errorf("repeat %d: more than one repeat is parsed to '%s'", i, repeat.to)
+		}
+		destinations[repeat.to] = true
+		repeats = append(repeats, repeat)
+	}
+
 	regexParser := &RegexParser{
 		ParserOperator: parserOperator,
 		regexp:         r,
+		repeats:        repeats,
 	}
 
 	return []operator.Operator{regexParser}, nil
@@ -69,7 +86,8 @@ func (c RegexParserConfig) Build(context operator.BuildContext) ([]operator.Oper
 // RegexParser is an operator that parses regex in an entry.
 type RegexParser struct {
 	helper.ParserOperator
-	regexp *regexp.Regexp
+	regexp  *helper.RegexMatcher
+	repeats []*repeat
 }
 
 // Process will parse an entry for regex.
@@ -82,12 +100,19 @@ func (r *RegexParser) parse(value interface{}) (interface{}, error) {
 	var matches []string
 	switch m := value.(type) {
 	case string:
-		matches = r.regexp.FindStringSubmatch(m)
+		var err error
+		matches, err = r.regexp.FindStringSubmatch(m)
+		if err != nil {
+			return nil, err
+		}
 		if matches == nil {
 			return nil, fmt.Errorf("regex pattern does not match")
 		}
 	case []byte:
-		byteMatches := r.regexp.FindSubmatch(m)
+		byteMatches, err := r.regexp.FindSubmatch(m)
+		if err != nil {
+			return nil, err
+		}
 		if byteMatches == nil {
 			return nil, fmt.Errorf("regex pattern does not match")
 		}
@@ -111,5 +136,40 @@ func (r *RegexParser) parse(value interface{}) (interface{}, error) {
 		}
 	}
 
+	// Repeats are parsed from the captured values, so that a repeat can
+	// replace the value it is parsed from
+	captured := make(map[string]string, len(r.repeats))
+	for _, repeat := range r.repeats {
+		captured[repeat.from] = parsedValues[repeat.from].(string)
+	}
+	for _, repeat := range r.repeats {
+		parsedValues[repeat.to] = repeat.parse(captured[repeat.from])
+	}
+
 	return parsedValues, nil
 }
+
+// Counters returns the number of values that exceeded the match budget,
+// the number of values whose repeats were truncated, and the invalid values
+// of the trace context, or nil if there are neither a budget, repeats nor a
+// trace context
+func (r *RegexParser) Counters() map[string]uint64 {
+	counters := r.ParserOperator.Counters()
+	if !r.regexp.HasBudget() && len(r.repeats) == 0 {
+		return counters
+	}
+	if counters == nil {
+		counters = make(map[string]uint64, 2)
+	}
+	if r.regexp.HasBudget() {
+		counters[helper.RegexBudgetExceededCounter] = r.regexp.Exceeded()
+	}
+	if len(r.repeats) > 0 {
+		var truncated uint64
+		for _, repeat := range r.repeats {
+			truncated += atomic.LoadUint64(&repeat.truncated)
+		}
+		counters[RepeatTruncatedCounter] = truncated
+	}
+	return counters
+}
@@ -2,12 +2,18 @@ package regex
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func newTestParser(t *testing.T, regex string) *RegexParser {
@@ -144,3 +150,237 @@ func TestBuildParserRegex(t *testing.T) {
 		require.Contains(t, err.Error(), "no named capture groups")
 	})
 }
+
+func TestRegexParserTimestamp(t *testing.T) {
+	cfg := NewRegexParserConfig("test")
+	cfg.OutputIDs = []string{"fake"}
+	cfg.Regex = `^(?P<time>\S+) (?P<level>\w+) (?P<message>.*)$`
+	parseFrom := entry.NewRecordField("time")
+	cfg.TimeParser = &helper.TimeParser{
+		ParseFrom:  &parseFrom,
+		LayoutType: helper.GotimeKey,
+		Layout:     time.RFC3339,
+	}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0]
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+	e := entry.New()
+	e.Record = "2020-06-10T13:01:02Z info request served"
+	require.NoError(t, op.Process(context.Background(), e))
+
+	select {
+	case e := <-fake.Received:
+		require.Equal(t, map[string]interface{}{"level": "info", "message": "request served"}, e.Record)
+		require.Equal(t, time.Date(2020, 6, 10, 13, 1, 2, 0, time.UTC), e.Timestamp.UTC())
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for entry")
+	}
+}
+
+func TestRegexParserTrace(t *testing.T) {
+	cfg := NewRegexParserConfig("test")
+	cfg.OutputIDs = []string{"fake"}
+	cfg.Regex = `^(?P<trace_id>\S+) (?P<span_id>\S+) (?P<message>.*)$`
+	cfg.TraceParserConfig = &helper.TraceParserConfig{}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0]
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+	e := entry.New()
+	e.Record = "4bf92f3577b34da6a3ce929d0e0e4736 invalid request served"
+	require.NoError(t, op.Process(context.Background(), e))
+
+	select {
+	case e := <-fake.Received:
+		require.Equal(t, map[string]interface{}{"message": "request served"}, e.Record)
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(e.TraceID))
+		require.Nil(t, e.SpanID)
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for entry")
+	}
+
+	counters := op.(*RegexParser).Counters()
+	require.Equal(t, uint64(1), counters[helper.InvalidSpanIDCounter])
+}
+
+func TestRegexParserErrorLabel(t *testing.T) {
+	cfg := NewRegexParserConfig("test")
+	cfg.OutputIDs = []string{"fake"}
+	cfg.Regex = `^(?P<key>\w+)=(?P<value>\w+)$`
+	cfg.ErrorLabel = "parse_error"
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0]
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+	e := entry.New()
+	e.Record = "not a key value pair"
+	require.NoError(t, op.Process(context.Background(), e))
+
+	select {
+	case e := <-fake.Received:
+		require.Equal(t, "not a key value pair", e.Record)
+		require.Equal(t, "regex pattern does not match", e.Labels["parse_error"])
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for entry")
+	}
+}
+
+// slowRegex takes a few milliseconds per kilobyte of a value that does not match
+const slowRegex = `(?P<key>.{0,1000}.{0,1000})=(?P<value>\S*)$`
+
+func TestRegexParserMatchBudget(t *testing.T) {
+	cfg := NewRegexParserConfig("test")
+	cfg.OutputIDs = []string{"fake"}
+	cfg.Regex = slowRegex
+	cfg.MaxMatchLength = 1000
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0]
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+	e := entry.New()
+	e.Record = "key=value"
+	require.NoError(t, op.Process(context.Background(), e))
+	fake.ExpectRecord(t, map[string]interface{}{"key": "key", "value": "value"})
+
+	// The entry is sent on unparsed, the same as other parsing errors
+	slow := strings.Repeat("ab", 10000)
+	e = entry.New()
+	e.Record = slow
+	require.NoError(t, op.Process(context.Background(), e))
+	fake.ExpectRecord(t, slow)
+
+	require.Equal(t, map[string]uint64{helper.RegexBudgetExceededCounter: 1}, op.(*RegexParser).Counters())
+}
+
+func TestRegexParserCountersWithoutBudget(t *testing.T) {
+	parser := newTestParser(t, "^(?P<key>.*)$")
+	require.Nil(t, parser.Counters())
+}
+
+// BenchmarkRegexParserMatchBudget parses entries of which one in a hundred
+// is a long value that the regex is slow to reject. Without a budget, that
+// entry holds up the others for as long as it takes to match, and with a
+// budget it is sent on without being matched.
+func BenchmarkRegexParserMatchBudget(b *testing.B) {
+	entries := make([]string, 100)
+	for i := range entries {
+		entries[i] = fmt.Sprintf("key%d=value%d", i, i)
+	}
+	entries[50] = strings.Repeat("ab", 10000)
+
+	cases := []struct {
+		name      string
+		maxLength int
+	}{
+		{"NoBudget", 0},
+		{"Budget", 1000},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			cfg := NewRegexParserConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Regex = slowRegex
+			cfg.MaxMatchLength = tc.maxLength
+
+			ops, err := cfg.Build(operator.NewBuildContext(testutil.NewTestDatabase(b), zap.NewNop().Sugar()))
+			require.NoError(b, err)
+			op := ops[0]
+			fake := testutil.NewFakeOutput(b)
+			require.NoError(b, op.SetOutputs([]operator.Operator{fake}))
+
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				for {
+					select {
+					case <-fake.Received:
+					case <-done:
+						return
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, record := range entries {
+					e := entry.New()
+					e.Record = record
+					_ = op.Process(context.Background(), e)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRegexParser parses access log lines into fields, with and
+// without parsing the timestamp from a captured group
+func BenchmarkRegexParser(b *testing.B) {
+	const line = `10.33.121.119 - - [11/Aug/2020:00:00:00 -0400] "GET /index.html HTTP/1.1" 404 498`
+	const regex = `^(?P<remote_addr>[^ ]*) (?P<remote_host>[^ ]*) (?P<remote_user>[^ ]*) \[(?P<time>[^\]]*)\] "(?P<method>\S+) (?P<path>[^"]*) (?P<protocol>[^"]*)" (?P<status>\d*) (?P<bytes_sent>\d*)$`
+
+	cases := []struct {
+		name      string
+		timestamp bool
+	}{
+		{"Fields", false},
+		{"FieldsAndTimestamp", true},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			cfg := NewRegexParserConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Regex = regex
+			if tc.timestamp {
+				parseFrom := entry.NewRecordField("time")
+				cfg.TimeParser = &helper.TimeParser{
+					ParseFrom:  &parseFrom,
+					LayoutType: helper.StrptimeKey,
+					Layout:     "%d/%b/%Y:%H:%M:%S %z",
+				}
+			}
+
+			ops, err := cfg.Build(operator.NewBuildContext(testutil.NewTestDatabase(b), zap.NewNop().Sugar()))
+			require.NoError(b, err)
+			op := ops[0]
+			fake := testutil.NewFakeOutput(b)
+			require.NoError(b, op.SetOutputs([]operator.Operator{fake}))
+
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				for {
+					select {
+					case <-fake.Received:
+					case <-done:
+						return
+					}
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				e := entry.New()
+				e.Record = line
+				if err := op.Process(context.Background(), e); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+const (
+	// DefaultMaxMatches is the default number of matches of a repeat per entry
+	DefaultMaxMatches = 100
+
+	// RepeatTruncatedCounter is the counter of values whose repeat matches
+	// were cut off at max_matches
+	RepeatTruncatedCounter = "repeat_truncated"
+)
+
+// RepeatConfig is the configuration of a pattern that is matched repeatedly
+// against a capture group of the regex of the parser
+type RepeatConfig struct {
+	From       string `json:"from"                  yaml:"from"`
+	Regex      string `json:"regex"                 yaml:"regex"`
+	To         string `json:"to,omitempty"          yaml:"to,omitempty"`
+	Key        string `json:"key,omitempty"         yaml:"key,omitempty"`
+	Value      string `json:"value,omitempty"       yaml:"value,omitempty"`
+	MaxMatches int    `json:"max_matches,omitempty" yaml:"max_matches,omitempty"`
+}
+
+// build builds a repeat for the named capture groups of the regex of the parser
+func (c RepeatConfig) build(groups map[string]bool) (*repeat, error) {
+	if c.From == "" {
+		return nil, fmt.Errorf("missing required field 'from'")
+	}
+	if !groups[c.From] {
+		return nil, fmt.Errorf("'from' must be a named capture group of 'regex', but '%s' is not", c.From)
+	}
+	if c.Regex == "" {
+		return nil, fmt.Errorf("missing required field 'regex'")
+	}
+
+	r, err := regexp.Compile(c.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regex: %s", err)
+	}
+
+	repeatGroups := make(map[string]bool)
+	for _, name := range r.SubexpNames() {
+		if name != "" {
+			repeatGroups[name] = true
+		}
+	}
+	if len(repeatGroups) == 0 {
+		return nil, fmt.Errorf("no named capture groups in regex pattern")
+	}
+	if c.Key != "" && !repeatGroups[c.Key] {
+		return nil, fmt.Errorf("'key' must be a named capture group of the repeat regex, but '%s' is not", c.Key)
+	}
+	if c.Value != "" {
+		if c.Key == "" {
+			return nil, fmt.Errorf("'value' can only be used with 'key'")
+		}
+		if !repeatGroups[c.Value] {
+			return nil, fmt.Errorf("'value' must be a named capture group of the repeat regex, but '%s' is not", c.Value)
+		}
+	}
+
+	maxMatches := c.MaxMatches
+	switch {
+	case maxMatches < 0:
+		return nil, fmt.Errorf("max_matches must not be negative")
+	case maxMatches == 0:
+		maxMatches = DefaultMaxMatches
+	}
+
+	to := c.To
+	if to == "" {
+		to = c.From
+	}
+
+	return &repeat{
+		from:       c.From,
+		to:         to,
+		regexp:     r,
+		key:        c.Key,
+		value:      c.Value,
+		maxMatches: maxMatches,
+	}, nil
+}
+
+// repeat finds every match of a pattern in a captured value. Each match is
+// an object of its named groups, or the matches are a map when a key group
+// is set.
+type repeat struct {
+	from       string
+	to         string
+	regexp     *regexp.Regexp
+	key        string
+	value      string
+	maxMatches int
+	truncated  uint64
+}
+
+// parse returns the matches of a captured value
+func (r *repeat) parse(value string) interface{} {
+	// One more match than the limit is found, to tell if any were cut off
+	matches := r.regexp.FindAllStringSubmatch(value, r.maxMatches+1)
+	if len(matches) > r.maxMatches {
+		atomic.AddUint64(&r.truncated, 1)
+		matches = matches[:r.maxMatches]
+	}
+
+	names := r.regexp.SubexpNames()
+	if r.key == "" {
+		objects := make([]interface{}, 0, len(matches))
+		for _, match := range matches {
+			objects = append(objects, r.object(names, match))
+		}
+		return objects
+	}
+
+	// A key that matches more than once keeps its last value
+	parsed := make(map[string]interface{}, len(matches))
+	for _, match := range matches {
+		object := r.object(names, match)
+		key := object[r.key].(string)
+		if r.value != "" {
+			parsed[key] = object[r.value]
+			continue
+		}
+		delete(object, r.key)
+		parsed[key] = object
+	}
+	return parsed
+}
+
+// object returns the named groups of a match
+func (r *repeat) object(names []string, match []string) map[string]interface{} {
+	object := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if i > 0 && name != "" {
+			object[name] = match[i]
+		}
+	}
+	return object
+}
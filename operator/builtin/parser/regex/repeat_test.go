@@ -0,0 +1,183 @@
+package regex
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const proxyRegex = `^(?P<method>\w+) (?P<path>\S+)(?P<headers>.*)$`
+
+func TestBuildRegexRepeat(t *testing.T) {
+	cases := []struct {
+		name     string
+		repeat   []RepeatConfig
+		errorMsg string
+	}{
+		{"Objects", []RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)=(?P<value>\S*)`}}, ""},
+		{"Map", []RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)=(?P<value>\S*)`, Key: "name", Value: "value"}}, ""},
+		{"MissingFrom", []RepeatConfig{{Regex: `(?P<name>\w+)`}}, "missing required field 'from'"},
+		{"UnknownFrom", []RepeatConfig{{From: "other", Regex: `(?P<name>\w+)`}}, "'other' is not"},
+		{"MissingRegex", []RepeatConfig{{From: "headers"}}, "missing required field 'regex'"},
+		{"InvalidRegex", []RepeatConfig{{From: "headers", Regex: `(`}}, "compiling regex"},
+		{"NoNamedGroups", []RepeatConfig{{From: "headers", Regex: `(\w+)`}}, "no named capture groups"},
+		{"UnknownKey", []RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)`, Key: "other"}}, "'key' must be a named capture group"},
+		{"ValueWithoutKey", []RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)`, Value: "name"}}, "'value' can only be used with 'key'"},
+		{"UnknownValue", []RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)`, Key: "name", Value: "other"}}, "'value' must be a named capture group"},
+		{"NegativeMaxMatches", []RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)`, MaxMatches: -1}}, "max_matches must not be negative"},
+		{
+			"DuplicateTo",
+			[]RepeatConfig{
+				{From: "headers", Regex: `(?P<name>\w+)`},
+				{From: "path", Regex: `(?P<segment>\w+)`, To: "headers"},
+			},
+			"repeat 1: more than one repeat is parsed to 'headers'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRegexParserConfig("test")
+			cfg.Regex = proxyRegex
+			cfg.Repeat = tc.repeat
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.errorMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestRegexRepeat(t *testing.T) {
+	headers := RepeatConfig{From: "headers", Regex: `header_(?P<name>\w+)=(?P<value>\S*)`}
+	headerMap := headers
+	headerMap.Key, headerMap.Value = "name", "value"
+	segments := RepeatConfig{From: "path", Regex: `/(?P<segment>[^/]+)`, To: "segments"}
+
+	cases := []struct {
+		name     string
+		repeat   []RepeatConfig
+		input    string
+		expected map[string]interface{}
+	}{
+		{
+			"Zero",
+			[]RepeatConfig{headers},
+			"GET /",
+			map[string]interface{}{"method": "GET", "path": "/", "headers": []interface{}{}},
+		},
+		{
+			"One",
+			[]RepeatConfig{headers},
+			"GET / header_host=example.com",
+			map[string]interface{}{
+				"method":  "GET",
+				"path":    "/",
+				"headers": []interface{}{map[string]interface{}{"name": "host", "value": "example.com"}},
+			},
+		},
+		{
+			"Many",
+			[]RepeatConfig{headers},
+			"GET / header_host=example.com header_accept=*/* header_empty=",
+			map[string]interface{}{
+				"method": "GET",
+				"path":   "/",
+				"headers": []interface{}{
+					map[string]interface{}{"name": "host", "value": "example.com"},
+					map[string]interface{}{"name": "accept", "value": "*/*"},
+					map[string]interface{}{"name": "empty", "value": ""},
+				},
+			},
+		},
+		{
+			"MapZero",
+			[]RepeatConfig{headerMap},
+			"GET /",
+			map[string]interface{}{"method": "GET", "path": "/", "headers": map[string]interface{}{}},
+		},
+		{
+			"MapMany",
+			[]RepeatConfig{headerMap},
+			"GET / header_host=example.com header_accept=*/* header_host=other.com",
+			map[string]interface{}{
+				"method":  "GET",
+				"path":    "/",
+				"headers": map[string]interface{}{"host": "other.com", "accept": "*/*"},
+			},
+		},
+		{
+			"MapOfObjects",
+			[]RepeatConfig{{From: "headers", Regex: `(?P<name>\w+)=(?P<value>\w*);(?P<flag>\w*)`, Key: "name"}},
+			"GET / a=1;x b=2;",
+			map[string]interface{}{
+				"method": "GET",
+				"path":   "/",
+				"headers": map[string]interface{}{
+					"a": map[string]interface{}{"value": "1", "flag": "x"},
+					"b": map[string]interface{}{"value": "2", "flag": ""},
+				},
+			},
+		},
+		{
+			"SeparateDestination",
+			[]RepeatConfig{headerMap, segments},
+			"GET /api/v1 header_host=example.com",
+			map[string]interface{}{
+				"method":  "GET",
+				"path":    "/api/v1",
+				"headers": map[string]interface{}{"host": "example.com"},
+				"segments": []interface{}{
+					map[string]interface{}{"segment": "api"},
+					map[string]interface{}{"segment": "v1"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRegexParserConfig("test")
+			cfg.Regex = proxyRegex
+			cfg.Repeat = tc.repeat
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+
+			parsed, err := ops[0].(*RegexParser).parse(tc.input)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, parsed)
+		})
+	}
+}
+
+func TestRegexRepeatMaxMatches(t *testing.T) {
+	cfg := NewRegexParserConfig("test")
+	cfg.Regex = proxyRegex
+	cfg.Repeat = []RepeatConfig{{From: "headers", Regex: `header_(?P<name>\w+)`, MaxMatches: 2}}
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	parser := ops[0].(*RegexParser)
+
+	parsed, err := parser.parse("GET / header_a header_b")
+	require.NoError(t, err)
+	require.Len(t, parsed.(map[string]interface{})["headers"], 2)
+	require.Equal(t, map[string]uint64{RepeatTruncatedCounter: 0}, parser.Counters())
+
+	many := make([]string, 10)
+	for i := range many {
+		many[i] = fmt.Sprintf("header_%d", i)
+	}
+	parsed, err = parser.parse("GET / " + strings.Join(many, " "))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"name": "0"},
+		map[string]interface{}{"name": "1"},
+	}, parsed.(map[string]interface{})["headers"])
+	require.Equal(t, map[string]uint64{RepeatTruncatedCounter: 1}, parser.Counters())
+}
@@ -24,6 +24,15 @@ func NewSyslogParserConfig(operatorID string) *SyslogParserConfig {
 	}
 }
 
+const (
+	// RFC3164 is the protocol of BSD syslog messages
+	RFC3164 = "rfc3164"
+	// RFC5424 is the protocol of IETF syslog messages
+	RFC5424 = "rfc5424"
+	// Auto detects the protocol of each message from its version field
+	Auto = "auto"
+)
+
 // SyslogParserConfig is the configuration of a syslog parser operator.
 type SyslogParserConfig struct {
 	helper.ParserConfig `yaml:",inline"`
@@ -41,28 +50,60 @@ func (c SyslogParserConfig) Build(context operator.BuildContext) ([]operator.Ope
 		}
 	}
 
+	if c.ParserConfig.SeverityParserConfig == nil {
+		parseFromField := entry.NewRecordField("severity")
+		c.ParserConfig.SeverityParserConfig = &helper.SeverityParserConfig{
+			ParseFrom: &parseFromField,
+			Preserve:  true,
+			Preset:    "none",
+			Mapping:   severityMapping,
+		}
+	}
+
 	parserOperator, err := c.ParserConfig.Build(context)
 	if err != nil {
 		return nil, err
 	}
 
-	if c.Protocol == "" {
+	switch c.Protocol {
+	case RFC3164, RFC5424, Auto:
+	case "":
 		return nil, fmt.Errorf("missing field 'protocol'")
+	default:
+		return nil, fmt.Errorf("invalid protocol %s", c.Protocol)
 	}
 
 	syslogParser := &SyslogParser{
 		ParserOperator: parserOperator,
 		protocol:       c.Protocol,
+		location:       context.DefaultLocation,
 	}
 
 	return []operator.Operator{syslogParser}, nil
 }
 
-func buildMachine(protocol string) (sl.Machine, error) {
+// severityMapping maps the syslog severity levels to entry severities
+var severityMapping = map[interface{}]interface{}{
+	"emergency": 0,
+	"alert":     1,
+	"critical":  2,
+	"error":     3,
+	"warning":   4,
+	"notice":    5,
+	"info":      6,
+	"debug":     7,
+}
+
+// buildMachine builds a parser for a protocol. RFC 3164 timestamps do not
+// have a time zone, so they are parsed in the location, if any.
+func buildMachine(protocol string, location *time.Location) (sl.Machine, error) {
 	switch protocol {
-	case "rfc3164":
+	case RFC3164:
+		if location != nil {
+			return rfc3164.NewMachine(rfc3164.WithLocaleTimezone(location)), nil
+		}
 		return rfc3164.NewMachine(), nil
-	case "rfc5424":
+	case RFC5424:
 		return rfc5424.NewMachine(), nil
 	default:
 		return nil, fmt.Errorf("invalid protocol %s", protocol)
@@ -73,6 +114,7 @@ func buildMachine(protocol string) (sl.Machine, error) {
 type SyslogParser struct {
 	helper.ParserOperator
 	protocol string
+	location *time.Location
 }
 
 // Process will parse an entry field as syslog.
@@ -87,7 +129,12 @@ func (s *SyslogParser) parse(value interface{}) (interface{}, error) {
 		return nil, err
 	}
 
-	machine, err := buildMachine(s.protocol)
+	protocol := s.protocol
+	if protocol == Auto {
+		protocol = detectProtocol(bytes)
+	}
+
+	machine, err := buildMachine(protocol, s.location)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +226,32 @@ func (s *SyslogParser) toSafeMap(message map[string]interface{}) (map[string]int
 	return message, nil
 }
 
+// detectProtocol returns the protocol of a syslog message. RFC5424 messages
+// have a version number after the priority, which RFC3164 messages lack.
+func detectProtocol(message []byte) string {
+	if len(message) == 0 || message[0] != '<' {
+		return RFC3164
+	}
+
+	i := 1
+	for i < len(message) && message[i] >= '0' && message[i] <= '9' {
+		i++
+	}
+	if i == 1 || i >= len(message) || message[i] != '>' {
+		return RFC3164
+	}
+
+	i++
+	start := i
+	for i < len(message) && message[i] >= '0' && message[i] <= '9' {
+		i++
+	}
+	if i > start && i < len(message) && message[i] == ' ' {
+		return RFC5424
+	}
+	return RFC3164
+}
+
 func toBytes(value interface{}) ([]byte, error) {
 	switch v := value.(type) {
 	case string:
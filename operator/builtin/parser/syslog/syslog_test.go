@@ -7,6 +7,7 @@ import (
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +24,7 @@ func TestSyslogParser(t *testing.T) {
 		config            *SyslogParserConfig
 		inputRecord       interface{}
 		expectedTimestamp time.Time
+		expectedSeverity  entry.Severity
 		expectedRecord    interface{}
 	}{
 		{
@@ -34,6 +36,7 @@ func TestSyslogParser(t *testing.T) {
 			}(),
 			"<34>Jan 12 06:30:00 1.2.3.4 apache_server: test message",
 			time.Date(time.Now().Year(), 1, 12, 6, 30, 0, 0, time.UTC),
+			entry.Critical,
 			map[string]interface{}{
 				"appname":  "apache_server",
 				"facility": 4,
@@ -52,6 +55,7 @@ func TestSyslogParser(t *testing.T) {
 			}(),
 			[]byte("<34>Jan 12 06:30:00 1.2.3.4 apache_server: test message"),
 			time.Date(time.Now().Year(), 1, 12, 6, 30, 0, 0, time.UTC),
+			entry.Critical,
 			map[string]interface{}{
 				"appname":  "apache_server",
 				"facility": 4,
@@ -70,6 +74,7 @@ func TestSyslogParser(t *testing.T) {
 			}(),
 			`<86>1 2015-08-05T21:58:59.693Z 192.168.2.132 SecureAuth0 23108 ID52020 [SecureAuth@27389 UserHostAddress="192.168.2.132" Realm="SecureAuth0" UserID="Tester2" PEN="27389"] Found the user for retrieving user's profile`,
 			time.Date(2015, 8, 5, 21, 58, 59, 693000000, time.UTC),
+			entry.Info,
 			map[string]interface{}{
 				"appname":  "SecureAuth0",
 				"facility": 10,
@@ -99,6 +104,7 @@ func TestSyslogParser(t *testing.T) {
 			}(),
 			`<86>1 2015-08-05T21:58:59.693Z 192.168.2.132 SecureAuth0 23108 ID52020 [verylongsdnamethatisgreaterthan32bytes@12345 UserHostAddress="192.168.2.132"] my message`,
 			time.Date(2015, 8, 5, 21, 58, 59, 693000000, time.UTC),
+			entry.Info,
 			map[string]interface{}{
 				"appname":  "SecureAuth0",
 				"facility": 10,
@@ -116,6 +122,93 @@ func TestSyslogParser(t *testing.T) {
 				"version": 1,
 			},
 		},
+		{
+			"RFC3164Example",
+			func() *SyslogParserConfig {
+				cfg := basicConfig()
+				cfg.Protocol = RFC3164
+				return cfg
+			}(),
+			"<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lucas on /dev/pts/8",
+			time.Date(rfc3164Year(10, 11), 10, 11, 22, 14, 15, 0, time.UTC),
+			entry.Critical,
+			map[string]interface{}{
+				"appname":  "su",
+				"facility": 4,
+				"hostname": "mymachine",
+				"message":  "'su root' failed for lucas on /dev/pts/8",
+				"priority": 34,
+				"severity": 2,
+			},
+		},
+		{
+			"RFC5424Example",
+			func() *SyslogParserConfig {
+				cfg := basicConfig()
+				cfg.Protocol = RFC5424
+				return cfg
+			}(),
+			`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`,
+			time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+			entry.Notice,
+			map[string]interface{}{
+				"appname":  "evntslog",
+				"facility": 20,
+				"hostname": "mymachine.example.com",
+				"message":  "An application event log entry...",
+				"msg_id":   "ID47",
+				"priority": 165,
+				"severity": 5,
+				"structured_data": map[string]map[string]string{
+					"exampleSDID@32473": {
+						"iut":         "3",
+						"eventSource": "Application",
+						"eventID":     "1011",
+					},
+				},
+				"version": 1,
+			},
+		},
+		{
+			"AutoRFC3164",
+			func() *SyslogParserConfig {
+				cfg := basicConfig()
+				cfg.Protocol = Auto
+				return cfg
+			}(),
+			"<15>Jan 12 06:30:00 1.2.3.4 apache_server: test message",
+			time.Date(time.Now().Year(), 1, 12, 6, 30, 0, 0, time.UTC),
+			entry.Debug,
+			map[string]interface{}{
+				"appname":  "apache_server",
+				"facility": 1,
+				"hostname": "1.2.3.4",
+				"message":  "test message",
+				"priority": 15,
+				"severity": 7,
+			},
+		},
+		{
+			"AutoRFC5424",
+			func() *SyslogParserConfig {
+				cfg := basicConfig()
+				cfg.Protocol = Auto
+				return cfg
+			}(),
+			`<8>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lucas on /dev/pts/8`,
+			time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+			entry.Emergency,
+			map[string]interface{}{
+				"appname":  "su",
+				"facility": 1,
+				"hostname": "mymachine.example.com",
+				"message":  "'su root' failed for lucas on /dev/pts/8",
+				"msg_id":   "ID47",
+				"priority": 8,
+				"severity": 0,
+				"version":  1,
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -137,9 +230,141 @@ func TestSyslogParser(t *testing.T) {
 			case e := <-fake.Received:
 				require.Equal(t, e.Record, tc.expectedRecord)
 				require.Equal(t, tc.expectedTimestamp, e.Timestamp)
+				require.Equal(t, tc.expectedSeverity, e.Severity)
 			case <-time.After(time.Second):
 				require.FailNow(t, "Timed out waiting for entry to be processed")
 			}
 		})
 	}
 }
+
+// rfc3164Year returns the year expected for an RFC3164 timestamp, which
+// is assumed to be from last year if it would be in the future
+func rfc3164Year(month time.Month, day int) int {
+	now := time.Now()
+	if time.Date(now.Year(), month, day, 0, 0, 0, 0, time.UTC).After(now.AddDate(0, 0, 7)) {
+		return now.Year() - 1
+	}
+	return now.Year()
+}
+
+func TestSyslogParserInvalid(t *testing.T) {
+	cases := []struct {
+		name     string
+		protocol string
+		input    interface{}
+	}{
+		{"Empty3164", RFC3164, ""},
+		{"Empty5424", RFC5424, ""},
+		{"Garbage3164", RFC3164, "this is not syslog"},
+		{"Garbage5424", RFC5424, "this is not syslog"},
+		{"GarbageAuto", Auto, "this is not syslog"},
+		{"BadPriority", Auto, "<999>1 2003-10-11T22:14:15.003Z host app - - - message"},
+		{"BadTimestamp5424", RFC5424, "<34>1 yesterday host app - - - message"},
+		{"Truncated5424", Auto, "<34>1 2003-10-11T22:14:15.003Z"},
+		{"WrongType", Auto, 12},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewSyslogParserConfig("test_operator_id")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Protocol = tc.protocol
+			cfg.OnError = "drop"
+
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			op := ops[0]
+
+			fake := testutil.NewFakeOutput(t)
+			require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+			newEntry := entry.New()
+			newEntry.Record = tc.input
+			require.Error(t, op.Process(context.Background(), newEntry))
+			select {
+			case e := <-fake.Received:
+				require.FailNow(t, "Unexpected entry", e.Record)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestSyslogParserConfigProtocol(t *testing.T) {
+	cases := []struct {
+		protocol    string
+		expectError bool
+	}{
+		{RFC3164, false},
+		{RFC5424, false},
+		{Auto, false},
+		{"", true},
+		{"rfc1234", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.protocol, func(t *testing.T) {
+			cfg := NewSyslogParserConfig("test_operator_id")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Protocol = tc.protocol
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDetectProtocol(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - message", RFC5424},
+		{"<34>Oct 11 22:14:15 mymachine su: message", RFC3164},
+		{"<34>", RFC3164},
+		{"<34>1", RFC3164},
+		{"<>1 message", RFC3164},
+		{"34>1 message", RFC3164},
+		{"", RFC3164},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			require.Equal(t, tc.expected, detectProtocol([]byte(tc.input)))
+		})
+	}
+}
+
+func TestSyslogParserDefaultLocation(t *testing.T) {
+	location, err := helper.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	cfg := NewSyslogParserConfig("test_operator_id")
+	cfg.OutputIDs = []string{"fake"}
+	cfg.Protocol = RFC3164
+	buildContext := testutil.NewBuildContext(t)
+	buildContext.DefaultLocation = location
+	ops, err := cfg.Build(buildContext)
+	require.NoError(t, err)
+	op := ops[0]
+
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+	newEntry := entry.New()
+	newEntry.Record = "<34>Jan 12 06:30:00 1.2.3.4 apache_server: test message"
+	require.NoError(t, op.Process(context.Background(), newEntry))
+
+	select {
+	case e := <-fake.Received:
+		expected := time.Date(time.Now().Year(), 1, 12, 6, 30, 0, 0, location)
+		require.True(t, expected.Equal(e.Timestamp), e.Timestamp.String())
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for entry to be processed")
+	}
+}
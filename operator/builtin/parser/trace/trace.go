@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+func init() {
+	operator.Register("trace_parser", func() operator.Builder { return NewTraceParserConfig("") })
+}
+
+// NewTraceParserConfig creates a new trace parser config with default values
+func NewTraceParserConfig(operatorID string) *TraceParserConfig {
+	return &TraceParserConfig{
+		TransformerConfig: helper.NewTransformerConfig(operatorID, "trace_parser"),
+		TraceParserConfig: helper.NewTraceParserConfig(),
+	}
+}
+
+// TraceParserConfig is the configuration of a trace parser operator.
+type TraceParserConfig struct {
+	helper.TransformerConfig `yaml:",inline"`
+	helper.TraceParserConfig `yaml:",omitempty,inline"`
+}
+
+// Build will build a trace parser operator.
+func (c TraceParserConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	transformerOperator, err := c.TransformerConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	traceParser, err := c.TraceParserConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	traceOperator := &TraceParserOperator{
+		TransformerOperator: transformerOperator,
+		TraceParser:         traceParser,
+	}
+
+	return []operator.Operator{traceOperator}, nil
+}
+
+// TraceParserOperator is an operator that parses the trace context of an entry.
+type TraceParserOperator struct {
+	helper.TransformerOperator
+	helper.TraceParser
+}
+
+// Process will parse the trace context of an entry.
+func (p *TraceParserOperator) Process(ctx context.Context, entry *entry.Entry) error {
+	if err := p.Parse(ctx, entry); err != nil {
+		return p.HandleEntryError(ctx, entry, errors.Wrap(err, "parse trace"))
+	}
+
+	p.Write(ctx, entry)
+	return nil
+}
@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceParserBuildFailure(t *testing.T) {
+	cfg := NewTraceParserConfig("test")
+	cfg.Regex = `(?P<trace_id>\w+)`
+	_, err := cfg.Build(testutil.NewBuildContext(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "regex requires parse_from")
+}
+
+func TestTraceParserOperator(t *testing.T) {
+	cases := []struct {
+		name       string
+		message    interface{}
+		traceID    string
+		spanID     string
+		traceFlags string
+		sent       bool
+	}{
+		{"Traceparent", "traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 done", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", "01", true},
+		{"InvalidSpanID", "trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=abc", "4bf92f3577b34da6a3ce929d0e0e4736", "", "", true},
+		{"NoTrace", "done", "", "", "", true},
+		{"InvalidType", 1, "", "", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewTraceParserConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.OnError = helper.DropOnError
+			field := entry.NewRecordField("message")
+			cfg.ParseFrom = &field
+
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			op := ops[0]
+			fake := testutil.NewFakeOutput(t)
+			require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+			e := entry.New()
+			e.Record = map[string]interface{}{"message": tc.message}
+			_ = op.Process(context.Background(), e)
+
+			if !tc.sent {
+				select {
+				case <-fake.Received:
+					require.FailNow(t, "Received an unexpected entry")
+				case <-time.After(100 * time.Millisecond):
+				}
+				return
+			}
+
+			select {
+			case e := <-fake.Received:
+				require.Equal(t, map[string]interface{}{"message": tc.message}, e.Record)
+				require.Equal(t, tc.traceID, hex.EncodeToString(e.TraceID))
+				require.Equal(t, tc.spanID, hex.EncodeToString(e.SpanID))
+				require.Equal(t, tc.traceFlags, hex.EncodeToString(e.TraceFlags))
+			case <-time.After(time.Second):
+				require.FailNow(t, "Timed out waiting for entry")
+			}
+		})
+	}
+}
+
+func TestTraceParserOperatorCounters(t *testing.T) {
+	cfg := NewTraceParserConfig("test")
+	cfg.OutputIDs = []string{"fake"}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0]
+	require.NoError(t, op.SetOutputs([]operator.Operator{testutil.NewFakeOutput(t)}))
+
+	for _, traceID := range []string{"abc", "4bf92f3577b34da6a3ce929d0e0e4736", "xyz"} {
+		e := entry.New()
+		e.Record = map[string]interface{}{"trace_id": traceID}
+		require.NoError(t, op.Process(context.Background(), e))
+	}
+
+	reporter, ok := op.(helper.CounterReporter)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), reporter.Counters()[helper.InvalidTraceIDCounter])
+}
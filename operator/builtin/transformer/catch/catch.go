@@ -0,0 +1,111 @@
+package catch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+func init() {
+	operator.Register("catch", func() operator.Builder { return NewCatchOperatorConfig("") })
+}
+
+const (
+	// OperatorLabel is the label that holds the ID of the operator that failed
+	// to process a caught entry
+	OperatorLabel = "error_operator"
+	// ErrorLabel is the label that holds the error of a caught entry
+	ErrorLabel = "error_message"
+	// FailedCounter is the counter of caught entries that failed again in the
+	// catch chain and were dropped
+	FailedCounter = "failed"
+)
+
+// NewCatchOperatorConfig creates a new catch operator config with default values
+func NewCatchOperatorConfig(operatorID string) *CatchOperatorConfig {
+	return &CatchOperatorConfig{
+		WriterConfig: helper.NewWriterConfig(operatorID, "catch"),
+	}
+}
+
+// CatchOperatorConfig is the configuration of a catch operator
+type CatchOperatorConfig struct {
+	helper.WriterConfig `yaml:",inline"`
+}
+
+// Build will build a catch operator
+func (c CatchOperatorConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	writerOperator, err := c.WriterConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	catchOperator := &CatchOperator{
+		WriterOperator: writerOperator,
+		caught:         make(map[string]uint64),
+	}
+	return []operator.Operator{catchOperator}, nil
+}
+
+// CatchOperator receives the entries that other operators in the pipeline
+// fail to process, labels them with the error, and sends them to its outputs
+type CatchOperator struct {
+	helper.WriterOperator
+
+	mux    sync.Mutex
+	caught map[string]uint64
+	failed uint64
+}
+
+var _ helper.Catcher = (*CatchOperator)(nil)
+
+// CanProcess will always return true for a catch operator
+func (c *CatchOperator) CanProcess() bool {
+	return true
+}
+
+// Process will send an entry to the outputs of the catch operator
+func (c *CatchOperator) Process(ctx context.Context, entry *entry.Entry) error {
+	c.Write(ctx, entry)
+	return nil
+}
+
+// Catch labels an entry that an operator failed to process with the error and
+// sends it to the catch chain. An entry that fails again in the catch chain is
+// not accepted, so that it cannot loop back through the chain.
+func (c *CatchOperator) Catch(ctx context.Context, e *entry.Entry, operatorID string, err error) bool {
+	if helper.IsCaught(ctx) {
+		c.mux.Lock()
+		c.failed++
+		c.mux.Unlock()
+		c.Warnw("Dropped entry that failed in the catch chain", "operator_id", operatorID, "error", err)
+		return false
+	}
+
+	c.mux.Lock()
+	c.caught[operatorID]++
+	c.mux.Unlock()
+
+	e.AddLabel(OperatorLabel, operatorID)
+	e.AddLabel(ErrorLabel, err.Error())
+	helper.RecordReceived(c)
+	c.Write(helper.WithCaught(ctx), e)
+	return true
+}
+
+// Counters returns the number of entries caught from each operator, keyed by
+// operator ID, and the number of entries that failed in the catch chain
+func (c *CatchOperator) Counters() map[string]uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	counters := make(map[string]uint64, len(c.caught)+1)
+	for id, count := range c.caught {
+		counters[id] = count
+	}
+	counters[FailedCounter] = c.failed
+	return counters
+}
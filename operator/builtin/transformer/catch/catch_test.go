@@ -0,0 +1,161 @@
+package catch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// failingOperator fails to process every entry with a transform function
+type failingOperator struct {
+	helper.TransformerOperator
+	transform helper.TransformFunction
+}
+
+func (f *failingOperator) Process(ctx context.Context, e *entry.Entry) error {
+	return f.ProcessWith(ctx, e, f.transform)
+}
+
+func newFailingOperator(t *testing.T, id string, transform helper.TransformFunction) *failingOperator {
+	cfg := helper.NewTransformerConfig(id, "failing")
+	cfg.OnError = helper.DropOnError
+	bc := testutil.NewBuildContext(t)
+	bc.CollectStats = true
+	transformer, err := cfg.Build(bc)
+	require.NoError(t, err)
+	return &failingOperator{TransformerOperator: transformer, transform: transform}
+}
+
+func newTestCatch(t *testing.T) (*CatchOperator, *testutil.FakeOutput) {
+	cfg := NewCatchOperatorConfig("catch")
+	cfg.OutputIDs = []string{"fake"}
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, ops[0].SetOutputs([]operator.Operator{fake}))
+	return ops[0].(*CatchOperator), fake
+}
+
+func TestCatch(t *testing.T) {
+	cases := []struct {
+		name          string
+		transform     helper.TransformFunction
+		expectedError string
+	}{
+		{
+			"Error",
+			func(e *entry.Entry) (*entry.Entry, error) {
+				return nil, fmt.Errorf("failed to parse")
+			},
+			"failed to parse",
+		},
+		{
+			"Panic",
+			func(e *entry.Entry) (*entry.Entry, error) {
+				panic("unexpected record")
+			},
+			"recovered from panic: unexpected record",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			catch, fake := newTestCatch(t)
+			failing := newFailingOperator(t, "failing", tc.transform)
+			failing.SetCatcher(catch)
+
+			e := entry.New()
+			e.Record = "test"
+			require.Error(t, failing.Process(context.Background(), e))
+
+			select {
+			case received := <-fake.Received:
+				require.Equal(t, "test", received.Record)
+				require.Equal(t, "$.failing", received.Labels[OperatorLabel])
+				require.Equal(t, tc.expectedError, received.Labels[ErrorLabel])
+			default:
+				require.FailNow(t, "Expected caught entry")
+			}
+
+			require.Equal(t, map[string]uint64{"$.failing": 1, FailedCounter: 0}, catch.Counters())
+			require.Equal(t, helper.OperatorStats{Errored: 1}, failing.OperatorStats().Snapshot())
+		})
+	}
+}
+
+func TestCatchFailureInCatchChain(t *testing.T) {
+	catch, fake := newTestCatch(t)
+	fail := func(e *entry.Entry) (*entry.Entry, error) {
+		return nil, fmt.Errorf("failed to parse")
+	}
+	failing := newFailingOperator(t, "failing", fail)
+	failing.SetCatcher(catch)
+
+	// The catch chain also fails to process the entry
+	chained := newFailingOperator(t, "chained", fail)
+	chained.OutputIDs = []string{"$.fake"}
+	require.NoError(t, chained.SetOutputs([]operator.Operator{fake}))
+	chained.SetCatcher(catch)
+	catch.OutputIDs = []string{"$.chained"}
+	require.NoError(t, catch.SetOutputs([]operator.Operator{chained}))
+
+	require.Error(t, failing.Process(context.Background(), entry.New()))
+
+	select {
+	case <-fake.Received:
+		require.FailNow(t, "Expected entry to be dropped")
+	default:
+	}
+	require.Equal(t, map[string]uint64{"$.failing": 1, FailedCounter: 1}, catch.Counters())
+	require.Equal(t, helper.OperatorStats{EntriesIn: 1, Errored: 1, Dropped: 1}, chained.OperatorStats().Snapshot())
+}
+
+func TestCatchDefaultOnError(t *testing.T) {
+	catch, caught := newTestCatch(t)
+	failing := newFailingOperator(t, "failing", func(e *entry.Entry) (*entry.Entry, error) {
+		return nil, fmt.Errorf("failed to parse")
+	})
+	failing.OnError = helper.NewTransformerConfig("failing", "failing").OnError
+	failing.SetCatcher(catch)
+
+	fake := testutil.NewFakeOutput(t)
+	failing.OutputIDs = []string{"$.fake"}
+	require.NoError(t, failing.SetOutputs([]operator.Operator{fake}))
+
+	// With on_error unset, the entry is caught rather than sent on
+	e := entry.New()
+	require.Error(t, failing.Process(context.Background(), e))
+	caught.ExpectEntry(t, e)
+	select {
+	case <-fake.Received:
+		require.FailNow(t, "Expected entry to be caught instead of sent on")
+	default:
+	}
+	require.Equal(t, map[string]uint64{"$.failing": 1, FailedCounter: 0}, catch.Counters())
+}
+
+func TestCatchSendOnError(t *testing.T) {
+	catch, caught := newTestCatch(t)
+	failing := newFailingOperator(t, "failing", func(e *entry.Entry) (*entry.Entry, error) {
+		return nil, fmt.Errorf("failed to parse")
+	})
+	failing.OnError = helper.SendOnError
+	failing.SetCatcher(catch)
+
+	fake := testutil.NewFakeOutput(t)
+	failing.OutputIDs = []string{"$.fake"}
+	require.NoError(t, failing.SetOutputs([]operator.Operator{fake}))
+
+	// The catch operator takes precedence over on_error: send
+	e := entry.New()
+	require.Error(t, failing.Process(context.Background(), e))
+	caught.ExpectEntry(t, e)
+	require.Equal(t, map[string]uint64{"$.failing": 1, FailedCounter: 0}, catch.Counters())
+}
@@ -0,0 +1,87 @@
+package execenrich
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// resultCache is a cache of command results keyed by the enrichment key. A
+// result expires after a TTL, and the least recently used result is evicted
+// when the cache is full.
+type resultCache struct {
+	mux     sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	order   *list.List
+	items   map[string]*list.Element
+	now     func() time.Time
+}
+
+type cacheItem struct {
+	key     string
+	fields  map[string]interface{}
+	expires time.Time
+}
+
+func newResultCache(ttl time.Duration, maxSize int) *resultCache {
+	return &resultCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached result of a key, if it has not expired
+func (c *resultCache) get(key string) (map[string]interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := element.Value.(*cacheItem)
+	if !c.now().Before(item.expires) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return item.fields, true
+}
+
+// put caches the result of a key, evicting the least recently used result if
+// the cache is full
+func (c *resultCache) put(key string, fields map[string]interface{}) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*cacheItem)
+		item.fields, item.expires = fields, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	for c.order.Len() >= c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheItem).key)
+	}
+
+	c.items[key] = c.order.PushFront(&cacheItem{key: key, fields: fields, expires: expires})
+}
+
+// len returns the number of cached results, including expired ones that have
+// not been removed yet
+func (c *resultCache) len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,332 @@
+package execenrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"golang.org/x/sync/semaphore"
+)
+
+func init() {
+	operator.Register("exec_enrich", func() operator.Builder { return NewExecEnrichConfig("") })
+}
+
+const (
+	// KeyInputArgument passes the key to the command as its last argument
+	KeyInputArgument = "argument"
+	// KeyInputStdin writes the key to the standard input of the command
+	KeyInputStdin = "stdin"
+
+	// CacheHitsCounter is the counter of entries enriched from the cache
+	CacheHitsCounter = "cache_hits"
+	// CacheMissesCounter is the counter of entries that required running the command
+	CacheMissesCounter = "cache_misses"
+	// CacheHitPercentCounter is the percentage of entries enriched from the cache
+	CacheHitPercentCounter = "cache_hit_percent"
+	// ExecutionsCounter is the counter of times the command was run
+	ExecutionsCounter = "executions"
+	// ExecErrorsCounter is the counter of runs of the command that failed,
+	// including runs that timed out
+	ExecErrorsCounter = "exec_errors"
+	// ExecTimeoutsCounter is the counter of runs of the command that timed out
+	ExecTimeoutsCounter = "exec_timeouts"
+	// ExecLatencyAvgCounter is the average time in milliseconds that a run of the command took
+	ExecLatencyAvgCounter = "exec_latency_avg_ms"
+	// ExecLatencyMaxCounter is the longest time in milliseconds that a run of the command took
+	ExecLatencyMaxCounter = "exec_latency_max_ms"
+
+	// maxStderr is the number of bytes of the standard error of a failed
+	// command that are included in its error
+	maxStderr = 512
+)
+
+// NewExecEnrichConfig creates a new exec enrich config with default values
+func NewExecEnrichConfig(operatorID string) *ExecEnrichConfig {
+	return &ExecEnrichConfig{
+		TransformerConfig: helper.NewTransformerConfig(operatorID, "exec_enrich"),
+		KeyInput:          KeyInputArgument,
+		EnrichTo:          entry.NewRecordField(),
+		CacheTTL:          helper.Duration{Duration: 5 * time.Minute},
+		CacheMaxSize:      1000,
+		MaxConcurrent:     4,
+		Timeout:           helper.Duration{Duration: 5 * time.Second},
+	}
+}
+
+// ExecEnrichConfig is the configuration of an exec enrich operator
+type ExecEnrichConfig struct {
+	helper.TransformerConfig `yaml:",inline"`
+
+	Command       []string        `json:"command"                   yaml:"command"`
+	KeyField      entry.Field     `json:"key_field"                 yaml:"key_field"`
+	KeyInput      string          `json:"key_input,omitempty"       yaml:"key_input,omitempty"`
+	EnrichTo      entry.Field     `json:"enrich_to,omitempty"       yaml:"enrich_to,omitempty"`
+	CacheTTL      helper.Duration `json:"cache_ttl,omitempty"       yaml:"cache_ttl,omitempty"`
+	CacheMaxSize  int             `json:"cache_max_size,omitempty"  yaml:"cache_max_size,omitempty"`
+	MaxConcurrent int             `json:"max_concurrent,omitempty"  yaml:"max_concurrent,omitempty"`
+	Timeout       helper.Duration `json:"timeout,omitempty"         yaml:"timeout,omitempty"`
+}
+
+// Build will build an exec enrich operator
+func (c ExecEnrichConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	transformerOperator, err := c.TransformerConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(c.Command) == 0 || c.Command[0] == "":
+		return nil, fmt.Errorf("missing required field 'command'")
+	case c.KeyField.FieldInterface == nil:
+		return nil, fmt.Errorf("missing required field 'key_field'")
+	case c.KeyInput != KeyInputArgument && c.KeyInput != KeyInputStdin:
+		return nil, fmt.Errorf("invalid key_input '%s': must be '%s' or '%s'", c.KeyInput, KeyInputArgument, KeyInputStdin)
+	case c.CacheTTL.Raw() < 0:
+		return nil, fmt.Errorf("cache_ttl must not be negative")
+	case c.CacheMaxSize < 0:
+		return nil, fmt.Errorf("cache_max_size must not be negative")
+	case c.MaxConcurrent <= 0:
+		return nil, fmt.Errorf("max_concurrent must be greater than zero")
+	case c.Timeout.Raw() <= 0:
+		return nil, fmt.Errorf("timeout must be greater than zero")
+	}
+
+	execEnrich := &ExecEnrichOperator{
+		TransformerOperator: transformerOperator,
+		command:             c.Command,
+		keyField:            c.KeyField,
+		keyInput:            c.KeyInput,
+		enrichTo:            c.EnrichTo,
+		sem:                 semaphore.NewWeighted(int64(c.MaxConcurrent)),
+		timeout:             c.Timeout.Raw(),
+	}
+	if c.CacheTTL.Raw() > 0 && c.CacheMaxSize > 0 {
+		execEnrich.cache = newResultCache(c.CacheTTL.Raw(), c.CacheMaxSize)
+	}
+
+	return []operator.Operator{execEnrich}, nil
+}
+
+// ExecEnrichOperator is an operator that enriches entries with the JSON output
+// of a local command, run with a key read from each entry
+type ExecEnrichOperator struct {
+	helper.TransformerOperator
+
+	command  []string
+	keyField entry.Field
+	keyInput string
+	enrichTo entry.Field
+	cache    *resultCache
+	sem      *semaphore.Weighted
+	timeout  time.Duration
+
+	mux        sync.Mutex
+	hits       uint64
+	misses     uint64
+	executions uint64
+	execErrors uint64
+	timeouts   uint64
+	latency    time.Duration
+	maxLatency time.Duration
+}
+
+// Process will enrich an entry with the result of the command for its key
+func (e *ExecEnrichOperator) Process(ctx context.Context, entry *entry.Entry) error {
+	var key string
+	if err := entry.Read(e.keyField, &key); err != nil {
+		return e.HandleEntryError(ctx, entry, errors.Wrap(err, "read key").WithDetails("key_field", e.keyField.String()))
+	}
+
+	fields, err := e.lookup(ctx, key)
+	if err != nil {
+		return e.HandleEntryError(ctx, entry, err)
+	}
+
+	if err := e.enrich(entry, fields); err != nil {
+		return e.HandleEntryError(ctx, entry, err)
+	}
+
+	e.Write(ctx, entry)
+	return nil
+}
+
+// lookup returns the fields for a key, from the cache or by running the command
+func (e *ExecEnrichOperator) lookup(ctx context.Context, key string) (map[string]interface{}, error) {
+	if e.cache != nil {
+		if fields, ok := e.cache.get(key); ok {
+			e.count(&e.hits)
+			return fields, nil
+		}
+	}
+	e.count(&e.misses)
+
+	fields, err := e.run(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.cache != nil {
+		e.cache.put(key, fields)
+	}
+	return fields, nil
+}
+
+// run runs the command for a key and parses its output, waiting for a free
+// execution slot if max_concurrent commands are already running
+func (e *ExecEnrichOperator) run(ctx context.Context, key string) (map[string]interface{}, error) {
+	if err := e.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer e.sem.Release(1)
+
+	runCtx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	args := e.command[1:]
+	if e.keyInput == KeyInputArgument {
+		args = append(append([]string{}, args...), key)
+	}
+	cmd := exec.CommandContext(runCtx, e.command[0], args...)
+	if e.keyInput == KeyInputStdin {
+		cmd.Stdin = strings.NewReader(key + "\n")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	fields, err := parseOutput(cmd.Run(), &stdout, &stderr)
+	timedOut := runCtx.Err() == context.DeadlineExceeded
+	e.recordExecution(time.Since(start), err != nil, timedOut)
+
+	if timedOut {
+		return nil, errors.NewError(
+			"command timed out",
+			"increase the timeout, or ensure that the command returns promptly",
+			"key", key,
+			"timeout", e.timeout.String(),
+		)
+	}
+	if err != nil {
+		return nil, errors.WithDetails(err, "key", key)
+	}
+	return fields, nil
+}
+
+// parseOutput parses the standard output of a command that succeeded as a
+// JSON object
+func parseOutput(runErr error, stdout, stderr *bytes.Buffer) (map[string]interface{}, error) {
+	if runErr != nil {
+		return nil, errors.Wrap(runErr, "run command").WithDetails("stderr", truncate(stderr.String(), maxStderr))
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &fields); err != nil {
+		return nil, errors.Wrap(err, "parse command output as a JSON object")
+	}
+	return fields, nil
+}
+
+// enrich merges fields into the enrich_to field of an entry. A value at the
+// field that is not a map is replaced.
+func (e *ExecEnrichOperator) enrich(entry *entry.Entry, fields map[string]interface{}) error {
+	merged := make(map[string]interface{}, len(fields))
+	if current, ok := e.enrichTo.Get(entry); ok {
+		if currentMap, ok := current.(map[string]interface{}); ok {
+			for k, v := range currentMap {
+				merged[k] = v
+			}
+		}
+	}
+
+	// Cached results are shared between entries, so each entry gets a copy
+	for k, v := range fields {
+		merged[k] = copyValue(v)
+	}
+	return entry.Set(e.enrichTo, merged)
+}
+
+// copyValue returns a copy of a value decoded from JSON
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			copied[k] = copyValue(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = copyValue(child)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// count increments a counter of the operator
+func (e *ExecEnrichOperator) count(counter *uint64) {
+	e.mux.Lock()
+	*counter++
+	e.mux.Unlock()
+}
+
+// recordExecution counts a run of the command and its latency
+func (e *ExecEnrichOperator) recordExecution(latency time.Duration, failed, timedOut bool) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.executions++
+	e.latency += latency
+	if latency > e.maxLatency {
+		e.maxLatency = latency
+	}
+	if failed || timedOut {
+		e.execErrors++
+	}
+	if timedOut {
+		e.timeouts++
+	}
+}
+
+// Counters returns the cache hit ratio and the number and latency of runs of the command
+func (e *ExecEnrichOperator) Counters() map[string]uint64 {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	counters := map[string]uint64{
+		CacheHitsCounter:      e.hits,
+		CacheMissesCounter:    e.misses,
+		ExecutionsCounter:     e.executions,
+		ExecErrorsCounter:     e.execErrors,
+		ExecTimeoutsCounter:   e.timeouts,
+		ExecLatencyMaxCounter: uint64(e.maxLatency / time.Millisecond),
+	}
+	if lookups := e.hits + e.misses; lookups > 0 {
+		counters[CacheHitPercentCounter] = e.hits * 100 / lookups
+	}
+	if e.executions > 0 {
+		counters[ExecLatencyAvgCounter] = uint64(e.latency/time.Millisecond) / e.executions
+	}
+	return counters
+}
+
+// truncate shortens a string to at most max bytes
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
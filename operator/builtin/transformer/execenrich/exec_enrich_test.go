@@ -0,0 +1,222 @@
+// +build !windows
+
+package execenrich
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// ownerScript prints the owner of the host passed as its first argument
+const ownerScript = `echo "{\"owner\": \"team-$1\", \"tags\": [\"$1\"]}"`
+
+func newTestExecEnrich(t *testing.T, cfgMod func(*ExecEnrichConfig)) (*ExecEnrichOperator, *testutil.FakeOutput) {
+	cfg := NewExecEnrichConfig("test")
+	cfg.Command = []string{"sh", "-c", ownerScript, "sh"}
+	cfg.KeyField = entry.NewRecordField("host")
+	if cfgMod != nil {
+		cfgMod(cfg)
+	}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0].(*ExecEnrichOperator)
+
+	fake := testutil.NewFakeOutput(t)
+	op.OutputOperators = []operator.Operator{fake}
+	return op, fake
+}
+
+func hostEntry(host string) *entry.Entry {
+	e := entry.New()
+	e.Record = map[string]interface{}{"host": host, "message": "test"}
+	return e
+}
+
+func TestExecEnrichBuild(t *testing.T) {
+	cases := []struct {
+		name      string
+		modify    func(*ExecEnrichConfig)
+		expectErr bool
+	}{
+		{"Default", func(cfg *ExecEnrichConfig) {}, false},
+		{"Stdin", func(cfg *ExecEnrichConfig) { cfg.KeyInput = KeyInputStdin }, false},
+		{"NoCache", func(cfg *ExecEnrichConfig) { cfg.CacheMaxSize = 0 }, false},
+		{"MissingCommand", func(cfg *ExecEnrichConfig) { cfg.Command = nil }, true},
+		{"MissingKeyField", func(cfg *ExecEnrichConfig) { cfg.KeyField = entry.Field{} }, true},
+		{"InvalidKeyInput", func(cfg *ExecEnrichConfig) { cfg.KeyInput = "env" }, true},
+		{"NegativeTTL", func(cfg *ExecEnrichConfig) { cfg.CacheTTL = helper.Duration{Duration: -time.Second} }, true},
+		{"ZeroConcurrent", func(cfg *ExecEnrichConfig) { cfg.MaxConcurrent = 0 }, true},
+		{"ZeroTimeout", func(cfg *ExecEnrichConfig) { cfg.Timeout = helper.Duration{} }, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewExecEnrichConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Command = []string{"lookup"}
+			cfg.KeyField = entry.NewRecordField("host")
+			tc.modify(cfg)
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestExecEnrich(t *testing.T) {
+	op, fake := newTestExecEnrich(t, nil)
+
+	for _, host := range []string{"web1", "web1", "db1"} {
+		require.NoError(t, op.Process(context.Background(), hostEntry(host)))
+	}
+
+	expected := []map[string]interface{}{
+		{"host": "web1", "message": "test", "owner": "team-web1", "tags": []interface{}{"web1"}},
+		{"host": "web1", "message": "test", "owner": "team-web1", "tags": []interface{}{"web1"}},
+		{"host": "db1", "message": "test", "owner": "team-db1", "tags": []interface{}{"db1"}},
+	}
+	received := make([]*entry.Entry, 0, len(expected))
+	for _, record := range expected {
+		e := <-fake.Received
+		require.Equal(t, record, e.Record)
+		received = append(received, e)
+	}
+
+	// Entries enriched from the cache do not share values
+	received[0].Record.(map[string]interface{})["tags"].([]interface{})[0] = "changed"
+	require.Equal(t, []interface{}{"web1"}, received[1].Record.(map[string]interface{})["tags"])
+
+	counters := op.Counters()
+	require.Equal(t, uint64(1), counters[CacheHitsCounter])
+	require.Equal(t, uint64(2), counters[CacheMissesCounter])
+	require.Equal(t, uint64(33), counters[CacheHitPercentCounter])
+	require.Equal(t, uint64(2), counters[ExecutionsCounter])
+	require.Equal(t, uint64(0), counters[ExecErrorsCounter])
+}
+
+func TestExecEnrichStdin(t *testing.T) {
+	op, fake := newTestExecEnrich(t, func(cfg *ExecEnrichConfig) {
+		cfg.Command = []string{"sh", "-c", `read host; echo "{\"owner\": \"team-$host\"}"`}
+		cfg.KeyInput = KeyInputStdin
+		cfg.EnrichTo = entry.NewRecordField("asset")
+	})
+
+	require.NoError(t, op.Process(context.Background(), hostEntry("web1")))
+	e := <-fake.Received
+	require.Equal(t, map[string]interface{}{
+		"host":    "web1",
+		"message": "test",
+		"asset":   map[string]interface{}{"owner": "team-web1"},
+	}, e.Record)
+}
+
+func TestExecEnrichErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		command  []string
+		timeout  bool
+		errorMsg string
+	}{
+		{"ExitCode", []string{"sh", "-c", "echo failed >&2; exit 1"}, false, "run command"},
+		{"NotJSON", []string{"echo", "not json"}, false, "parse command output"},
+		{"NotObject", []string{"echo", "[1, 2]"}, false, "parse command output"},
+		{"Timeout", []string{"sh", "-c", "exec sleep 5"}, true, "command timed out"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			op, fake := newTestExecEnrich(t, func(cfg *ExecEnrichConfig) {
+				cfg.Command = tc.command
+				cfg.Timeout = helper.Duration{Duration: 100 * time.Millisecond}
+				cfg.OnError = helper.DropOnError
+			})
+
+			err := op.Process(context.Background(), hostEntry("web1"))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+			select {
+			case e := <-fake.Received:
+				t.Fatalf("Unexpected entry: %v", e)
+			default:
+			}
+
+			counters := op.Counters()
+			require.Equal(t, uint64(1), counters[ExecErrorsCounter])
+			if tc.timeout {
+				require.Equal(t, uint64(1), counters[ExecTimeoutsCounter])
+			}
+		})
+	}
+}
+
+func TestExecEnrichSendOnError(t *testing.T) {
+	op, fake := newTestExecEnrich(t, func(cfg *ExecEnrichConfig) {
+		cfg.Command = []string{"false"}
+	})
+
+	require.NoError(t, op.Process(context.Background(), hostEntry("web1")))
+	e := <-fake.Received
+	require.Equal(t, map[string]interface{}{"host": "web1", "message": "test"}, e.Record)
+}
+
+func TestExecEnrichMaxConcurrent(t *testing.T) {
+	op, fake := newTestExecEnrich(t, func(cfg *ExecEnrichConfig) {
+		cfg.Command = []string{"sh", "-c", `sleep 0.2; echo "{}"`, "sh"}
+		cfg.MaxConcurrent = 1
+		cfg.CacheMaxSize = 0
+	})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, host := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			require.NoError(t, op.Process(context.Background(), hostEntry(host)))
+		}(host)
+	}
+	wg.Wait()
+
+	// The commands run one at a time
+	require.True(t, time.Since(start) >= 400*time.Millisecond)
+	<-fake.Received
+	<-fake.Received
+}
+
+func TestResultCache(t *testing.T) {
+	now := time.Now()
+	cache := newResultCache(time.Minute, 2)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", map[string]interface{}{"n": 1})
+	cache.put("b", map[string]interface{}{"n": 2})
+	_, ok := cache.get("a")
+	require.True(t, ok)
+
+	// The least recently used result is evicted
+	cache.put("c", map[string]interface{}{"n": 3})
+	_, ok = cache.get("b")
+	require.False(t, ok)
+	require.Equal(t, 2, cache.len())
+
+	// Results expire after the TTL
+	now = now.Add(time.Minute)
+	_, ok = cache.get("a")
+	require.False(t, ok)
+	require.Equal(t, 1, cache.len())
+}
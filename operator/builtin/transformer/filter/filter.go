@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/antonmedv/expr"
 	"github.com/antonmedv/expr/vm"
 	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
 	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/operator/helper"
 	"go.uber.org/zap"
@@ -22,14 +26,17 @@ func NewFilterOperatorConfig(operatorID string) *FilterOperatorConfig {
 	return &FilterOperatorConfig{
 		TransformerConfig: helper.NewTransformerConfig(operatorID, "filter"),
 		DropRatio:         1,
+		ReportInterval:    helper.Duration{Duration: time.Minute},
 	}
 }
 
 // FilterOperatorConfig is the configuration of a filter operator
 type FilterOperatorConfig struct {
-	helper.TransformerConfig `yaml:",inline"`
-	Expression               string  `json:"expr"   yaml:"expr"`
-	DropRatio                float64 `json:"drop_ratio"   yaml:"drop_ratio"`
+	helper.TransformerConfig  `yaml:",inline"`
+	helper.SeverityExprConfig `yaml:",inline"`
+	Expression                string          `json:"expr"   yaml:"expr"`
+	DropRatio                 float64         `json:"drop_ratio"   yaml:"drop_ratio"`
+	ReportInterval            helper.Duration `json:"report_interval,omitempty" yaml:"report_interval,omitempty"`
 }
 
 // Build will build a filter operator from the supplied configuration
@@ -39,19 +46,43 @@ func (c FilterOperatorConfig) Build(context operator.BuildContext) ([]operator.O
 		return nil, err
 	}
 
-	compiledExpression, err := expr.Compile(c.Expression, expr.AsBool(), expr.AllowUndefinedVariables())
+	if c.Expression == "" {
+		return nil, fmt.Errorf("missing required field 'expr'")
+	}
+
+	// The expression is not compiled with AsBool, since the type of a field is
+	// only known once an entry is evaluated. An expression that does not
+	// return a boolean keeps the entry.
+	compiledExpression, err := expr.Compile(c.Expression, expr.AllowUndefinedVariables())
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile expression '%s': %w", c.Expression, err)
+		return nil, errors.NewError(
+			fmt.Sprintf("failed to compile expression '%s'", c.Expression),
+			"fix the 'expr' field of the filter operator. The error shows the line and column of the problem in the expression",
+			"operator_id", c.ID(),
+			"field", "expr",
+			"error", err.Error(),
+		)
 	}
 
 	if c.DropRatio < 0.0 || c.DropRatio > 1.0 {
 		return nil, fmt.Errorf("drop_ratio must be a number between 0 and 1")
 	}
 
+	if c.ReportInterval.Raw() <= 0 {
+		return nil, fmt.Errorf("report_interval must be greater than zero")
+	}
+
+	severityExpr, err := c.SeverityExprConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	filterOperator := &FilterOperator{
 		TransformerOperator: transformer,
 		expression:          compiledExpression,
 		dropRatio:           c.DropRatio,
+		severityExpr:        severityExpr,
+		reportInterval:      c.ReportInterval.Raw(),
 	}
 
 	return []operator.Operator{filterOperator}, nil
@@ -60,30 +91,102 @@ func (c FilterOperatorConfig) Build(context operator.BuildContext) ([]operator.O
 // FilterOperator is an operator that filters entries based on matching expressions
 type FilterOperator struct {
 	helper.TransformerOperator
-	expression *vm.Program
-	dropRatio  float64
+	expression   *vm.Program
+	dropRatio    float64
+	severityExpr *helper.SeverityExpr
+
+	// processed and dropped count the entries since the last report
+	processed      uint64
+	dropped        uint64
+	reportInterval time.Duration
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
 }
 
-// Process will drop incoming entries that match the filter expression
+// Start will start reporting the entries dropped by the filter
+func (f *FilterOperator) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.reportPeriodically(ctx)
+	}()
+	return nil
+}
+
+// Stop will stop reporting the entries dropped by the filter
+func (f *FilterOperator) Stop() error {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.wg.Wait()
+	return nil
+}
+
+// Process will drop incoming entries that match the filter expression.
+// Entries for which the expression fails are kept.
 func (f *FilterOperator) Process(ctx context.Context, entry *entry.Entry) error {
-	env := helper.GetExprEnv(entry)
-	defer helper.PutExprEnv(env)
+	atomic.AddUint64(&f.processed, 1)
 
-	matches, err := vm.Run(f.expression, env)
+	env := f.severityExpr.GetExprEnv(entry)
+	defer f.severityExpr.PutExprEnv(env)
+
+	result, err := vm.Run(f.expression, env)
 	if err != nil {
-		f.Errorf("Running expressing returned an error", zap.Error(err))
+		f.Warnw("Running expression returned an error. Keeping the entry", zap.Error(err))
+		f.OperatorStats().AddErrored(1)
+		f.Write(ctx, entry)
 		return nil
 	}
 
-	filtered, ok := matches.(bool)
+	matches, ok := result.(bool)
 	if !ok {
-		f.Errorf("Expression did not compile as a boolean")
+		f.Warnw("Expression did not return a boolean. Keeping the entry", "result", result)
+		f.OperatorStats().AddErrored(1)
+		f.Write(ctx, entry)
 		return nil
 	}
 
-	if !filtered || rand.Float64() > f.dropRatio {
+	if !matches || rand.Float64() > f.dropRatio {
 		f.Write(ctx, entry)
+		return nil
 	}
 
+	atomic.AddUint64(&f.dropped, 1)
+	f.OperatorStats().AddDropped(1)
 	return nil
 }
+
+// reportPeriodically logs the number of entries dropped in each report interval
+func (f *FilterOperator) reportPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(f.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.report()
+			return
+		case <-ticker.C:
+			f.report()
+		}
+	}
+}
+
+// report logs the number of entries dropped since the last report, and the
+// percentage of the processed entries that they were
+func (f *FilterOperator) report() {
+	processed := atomic.SwapUint64(&f.processed, 0)
+	dropped := atomic.SwapUint64(&f.dropped, 0)
+	if dropped == 0 {
+		return
+	}
+
+	f.Infow("Dropped entries",
+		"dropped", dropped,
+		"processed", processed,
+		"drop_percent", float64(dropped)/float64(processed)*100,
+	)
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestFilterOperator(t *testing.T) {
@@ -66,6 +68,30 @@ func TestFilterOperator(t *testing.T) {
 			`$labels.key == "value"`,
 			false,
 		},
+		{
+			"MatchNestedRecord",
+			&entry.Entry{
+				Record: map[string]interface{}{
+					"req": map[string]interface{}{
+						"path": "/healthz",
+					},
+				},
+			},
+			`$record.req.path == "/healthz"`,
+			true,
+		},
+		{
+			"NoMatchNestedRecord",
+			&entry.Entry{
+				Record: map[string]interface{}{
+					"req": map[string]interface{}{
+						"path": "/users",
+					},
+				},
+			},
+			`$record.req.path == "/healthz"`,
+			false,
+		},
 		{
 			"MatchEnv",
 			&entry.Entry{
@@ -121,6 +147,7 @@ func TestFilterDropRatio(t *testing.T) {
 	cfg.Expression = `$.message == "test_message"`
 	cfg.DropRatio = 0.5
 	buildContext := testutil.NewBuildContext(t)
+	buildContext.CollectStats = true
 	ops, err := cfg.Build(buildContext)
 	require.NoError(t, err)
 	op := ops[0]
@@ -154,4 +181,206 @@ func TestFilterDropRatio(t *testing.T) {
 	}
 
 	require.Equal(t, 10, processedEntries)
+
+	stats := filterOperator.OperatorStats().Snapshot()
+	require.Equal(t, uint64(10), stats.EntriesOut)
+	require.Equal(t, uint64(10), stats.Dropped)
+}
+
+func TestFilterSeverity(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfgMod   func(*FilterOperatorConfig)
+		severity entry.Severity
+		filtered bool
+	}{
+		{"Above", nil, entry.Error, true},
+		{"Below", nil, entry.Info, false},
+		{"UnsetDefault", nil, entry.Default, false},
+		{
+			"UnsetOverride",
+			func(cfg *FilterOperatorConfig) {
+				cfg.UnsetSeverity = "error"
+			},
+			entry.Default,
+			true,
+		},
+		{
+			"CustomLevel",
+			func(cfg *FilterOperatorConfig) {
+				cfg.Expression = `$severity >= noisy`
+				cfg.SeverityLevels = map[string]int{"noisy": 25}
+			},
+			entry.Info,
+			true,
+		},
+		{
+			"OverriddenLevel",
+			func(cfg *FilterOperatorConfig) {
+				cfg.SeverityLevels = map[string]int{"warning": 65}
+			},
+			entry.Error,
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewFilterOperatorConfig("test")
+			cfg.Expression = `$severity >= warning`
+			if tc.cfgMod != nil {
+				tc.cfgMod(cfg)
+			}
+
+			ops, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+
+			filtered := true
+			mockOutput := testutil.NewMockOperator("output")
+			mockOutput.On("Process", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				filtered = false
+			})
+
+			filterOperator := ops[0].(*FilterOperator)
+			filterOperator.OutputOperators = []operator.Operator{mockOutput}
+
+			e := entry.New()
+			e.Severity = tc.severity
+			require.NoError(t, filterOperator.Process(context.Background(), e))
+			require.Equal(t, tc.filtered, filtered)
+		})
+	}
+}
+
+func TestFilterBuildInvalid(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+		errText    string
+	}{
+		{"Missing", "", "missing required field 'expr'"},
+		{"Syntax", `$record.message ==`, "failed to compile expression"},
+		{"Unclosed", `$labels.key == "value`, "failed to compile expression"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewFilterOperatorConfig("test_filter")
+			cfg.Expression = tc.expression
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errText)
+			if tc.expression != "" {
+				require.Contains(t, err.Error(), "test_filter")
+				require.Contains(t, err.Error(), `"field":"expr"`)
+			}
+		})
+	}
+}
+
+func TestFilterEvaluationErrorKeepsEntry(t *testing.T) {
+	cfg := NewFilterOperatorConfig("test")
+	cfg.Expression = `int($record.count) > 1`
+	buildContext := testutil.NewBuildContext(t)
+	buildContext.CollectStats = true
+	ops, err := cfg.Build(buildContext)
+	require.NoError(t, err)
+
+	filterOperator := ops[0].(*FilterOperator)
+	core, logs := observer.New(zap.WarnLevel)
+	filterOperator.SugaredLogger = zap.New(core).Sugar()
+
+	processed := 0
+	mockOutput := testutil.NewMockOperator("output")
+	mockOutput.On("Process", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		processed++
+	})
+	filterOperator.OutputOperators = []operator.Operator{mockOutput}
+
+	e := entry.New()
+	e.Record = map[string]interface{}{"count": []interface{}{"a"}}
+	require.NoError(t, filterOperator.Process(context.Background(), e))
+
+	require.Equal(t, 1, processed)
+	require.Equal(t, 1, logs.FilterMessage("Running expression returned an error. Keeping the entry").Len())
+	stats := filterOperator.OperatorStats().Snapshot()
+	require.Equal(t, uint64(1), stats.Errored)
+	require.Equal(t, uint64(0), stats.Dropped)
+}
+
+func TestFilterNotBoolKeepsEntry(t *testing.T) {
+	cases := []struct {
+		name       string
+		expression string
+	}{
+		{"MissingField", `$record.missing`},
+		{"String", `$record.message`},
+		{"Number", `len($record.message)`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewFilterOperatorConfig("test")
+			cfg.Expression = tc.expression
+			buildContext := testutil.NewBuildContext(t)
+			buildContext.CollectStats = true
+			ops, err := cfg.Build(buildContext)
+			require.NoError(t, err)
+
+			filterOperator := ops[0].(*FilterOperator)
+			core, logs := observer.New(zap.WarnLevel)
+			filterOperator.SugaredLogger = zap.New(core).Sugar()
+
+			processed := 0
+			mockOutput := testutil.NewMockOperator("output")
+			mockOutput.On("Process", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				processed++
+			})
+			filterOperator.OutputOperators = []operator.Operator{mockOutput}
+
+			e := entry.New()
+			e.Record = map[string]interface{}{"message": "test"}
+			require.NoError(t, filterOperator.Process(context.Background(), e))
+
+			require.Equal(t, 1, processed)
+			require.Equal(t, 1, logs.FilterMessage("Expression did not return a boolean. Keeping the entry").Len())
+			stats := filterOperator.OperatorStats().Snapshot()
+			require.Equal(t, uint64(1), stats.Errored)
+			require.Equal(t, uint64(0), stats.Dropped)
+		})
+	}
+}
+
+func TestFilterReportDropped(t *testing.T) {
+	cfg := NewFilterOperatorConfig("test")
+	cfg.Expression = `$record.message == "drop"`
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	filterOperator := ops[0].(*FilterOperator)
+	core, logs := observer.New(zap.InfoLevel)
+	filterOperator.SugaredLogger = zap.New(core).Sugar()
+
+	mockOutput := testutil.NewMockOperator("output")
+	mockOutput.On("Process", mock.Anything, mock.Anything).Return(nil)
+	filterOperator.OutputOperators = []operator.Operator{mockOutput}
+
+	for _, message := range []string{"drop", "keep", "drop", "keep"} {
+		e := entry.New()
+		e.Record = map[string]interface{}{"message": message}
+		require.NoError(t, filterOperator.Process(context.Background(), e))
+	}
+
+	filterOperator.report()
+	reports := logs.FilterMessage("Dropped entries").All()
+	require.Len(t, reports, 1)
+	fields := reports[0].ContextMap()
+	require.Equal(t, uint64(2), fields["dropped"])
+	require.Equal(t, uint64(4), fields["processed"])
+	require.Equal(t, float64(50), fields["drop_percent"])
+
+	// Nothing is reported when no entries were dropped since the last report
+	filterOperator.report()
+	require.Equal(t, 1, logs.FilterMessage("Dropped entries").Len())
 }
@@ -0,0 +1,159 @@
+package pseudonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+const (
+	// defaultKeyIDLabel is the label that records the ID of the key that
+	// produced the pseudonyms of an entry
+	defaultKeyIDLabel = "key_id"
+
+	// minKeySize is the smallest key accepted, in bytes
+	minKeySize = 16
+)
+
+func init() {
+	operator.Register("pseudonymize", func() operator.Builder { return NewPseudonymizeConfig("") })
+}
+
+// NewPseudonymizeConfig creates a new pseudonymize config with default values
+func NewPseudonymizeConfig(operatorID string) *PseudonymizeConfig {
+	return &PseudonymizeConfig{
+		TransformerConfig: helper.NewTransformerConfig(operatorID, "pseudonymize"),
+		Length:            sha256.Size,
+		KeyIDLabel:        defaultKeyIDLabel,
+	}
+}
+
+// PseudonymizeConfig is the configuration of a pseudonymize operator
+type PseudonymizeConfig struct {
+	helper.TransformerConfig `yaml:",inline"`
+
+	Fields     []entry.Field `json:"fields"                 yaml:"fields"`
+	Key        KeyConfig     `json:"key"                    yaml:"key"`
+	Length     int           `json:"length,omitempty"       yaml:"length,omitempty"`
+	KeyIDLabel string        `json:"key_id_label,omitempty" yaml:"key_id_label,omitempty"`
+}
+
+// KeyConfig is the key that values are pseudonymized with, and the ID that
+// is recorded with its pseudonyms. The ID must change whenever the key does,
+// since the pseudonyms of a value change with the key.
+type KeyConfig struct {
+	ID                  string `json:"id" yaml:"id"`
+	helper.SecretConfig `yaml:",inline"`
+}
+
+// Build will build a pseudonymize operator
+func (c PseudonymizeConfig) Build(context operator.BuildContext) ([]operator.Operator, error) {
+	transformerOperator, err := c.TransformerConfig.Build(context)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Fields) == 0 {
+		return nil, fmt.Errorf("at least one field is required")
+	}
+	if c.Key.ID == "" {
+		return nil, fmt.Errorf("key.id is required")
+	}
+	if c.KeyIDLabel == "" {
+		return nil, fmt.Errorf("key_id_label cannot be empty")
+	}
+	if c.Length < 1 || c.Length > sha256.Size {
+		return nil, fmt.Errorf("invalid length %d: must be between 1 and %d", c.Length, sha256.Size)
+	}
+
+	key, err := c.Key.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read key")
+	}
+	if len(key) < minKeySize {
+		return nil, fmt.Errorf("key must be at least %d bytes", minKeySize)
+	}
+
+	pseudonymizeOperator := &PseudonymizeOperator{
+		TransformerOperator: transformerOperator,
+		fields:              c.Fields,
+		key:                 key,
+		keyID:               c.Key.ID,
+		length:              c.Length,
+		keyIDLabel:          c.KeyIDLabel,
+	}
+
+	return []operator.Operator{pseudonymizeOperator}, nil
+}
+
+// PseudonymizeOperator is an operator that replaces the values of fields
+// with a keyed hash of them. A value has the same pseudonym on every agent
+// that has the same key, so entries of the same user can be correlated
+// across hosts without the value leaving the host.
+type PseudonymizeOperator struct {
+	helper.TransformerOperator
+	fields     []entry.Field
+	key        []byte
+	keyID      string
+	length     int
+	keyIDLabel string
+}
+
+// Process will pseudonymize the fields of an entry
+func (p *PseudonymizeOperator) Process(ctx context.Context, entry *entry.Entry) error {
+	return p.ProcessWith(ctx, entry, p.Transform)
+}
+
+// Transform replaces the value of each field that an entry has with its
+// pseudonym, and labels the entry with the ID of the key. It never fails, since
+// a failed entry would be logged with its values. A value that cannot be
+// replaced is removed instead.
+func (p *PseudonymizeOperator) Transform(e *entry.Entry) (*entry.Entry, error) {
+	replaced := false
+	for _, field := range p.fields {
+		value, ok := e.Get(field)
+		if !ok {
+			continue
+		}
+		if err := e.Set(field, p.pseudonym(value)); err != nil {
+			e.Delete(field)
+			continue
+		}
+		replaced = true
+	}
+
+	if replaced {
+		e.AddLabel(p.keyIDLabel, p.keyID)
+	}
+	return e, nil
+}
+
+// pseudonym returns the hex encoded HMAC-SHA256 of a value, truncated to the
+// configured number of bytes. Values other than strings are hashed as JSON.
+func (p *PseudonymizeOperator) pseudonym(value interface{}) string {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%v", v))
+		}
+		data = encoded
+	}
+
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)[:p.length])
+}
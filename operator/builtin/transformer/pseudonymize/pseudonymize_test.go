@@ -0,0 +1,207 @@
+package pseudonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/logger"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const (
+	testKey        = "0123456789abcdef-first-key"
+	testRotatedKey = "0123456789abcdef-second-key"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("TEST_PSEUDONYMIZE_KEY", testKey)
+	os.Setenv("TEST_PSEUDONYMIZE_ROTATED_KEY", testRotatedKey)
+	os.Setenv("TEST_PSEUDONYMIZE_SHORT_KEY", "short")
+	os.Exit(m.Run())
+}
+
+func newTestConfig(keyID, env string) *PseudonymizeConfig {
+	cfg := NewPseudonymizeConfig("test")
+	cfg.Fields = []entry.Field{entry.NewRecordField("user"), entry.NewLabelField("user")}
+	cfg.Key = KeyConfig{ID: keyID, SecretConfig: helper.SecretConfig{Env: env}}
+	cfg.OutputIDs = []string{"fake"}
+	return cfg
+}
+
+func newTestOperator(t *testing.T, cfg *PseudonymizeConfig) (*PseudonymizeOperator, *testutil.FakeOutput) {
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := ops[0].(*PseudonymizeOperator)
+
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+	return op, fake
+}
+
+// receive returns the next entry written to a fake output
+func receive(t *testing.T, out *testutil.FakeOutput) *entry.Entry {
+	select {
+	case e := <-out.Received:
+		return e
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for entry")
+		return nil
+	}
+}
+
+func expectedPseudonym(key, value string, length int) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:length])
+}
+
+func TestPseudonymizeBuild(t *testing.T) {
+	cases := []struct {
+		name    string
+		modify  func(*PseudonymizeConfig)
+		wantErr string
+	}{
+		{"Default", func(cfg *PseudonymizeConfig) {}, ""},
+		{"NoFields", func(cfg *PseudonymizeConfig) { cfg.Fields = nil }, "at least one field is required"},
+		{"NoKeyID", func(cfg *PseudonymizeConfig) { cfg.Key.ID = "" }, "key.id is required"},
+		{"NoKey", func(cfg *PseudonymizeConfig) { cfg.Key.Env = "" }, "one of 'file' or 'env' must be set"},
+		{"MissingKey", func(cfg *PseudonymizeConfig) { cfg.Key.Env = "TEST_PSEUDONYMIZE_MISSING_KEY" }, "is not set"},
+		{"ShortKey", func(cfg *PseudonymizeConfig) { cfg.Key.Env = "TEST_PSEUDONYMIZE_SHORT_KEY" }, "key must be at least 16 bytes"},
+		{"ZeroLength", func(cfg *PseudonymizeConfig) { cfg.Length = 0 }, "invalid length 0"},
+		{"LongLength", func(cfg *PseudonymizeConfig) { cfg.Length = 33 }, "invalid length 33"},
+		{"EmptyKeyIDLabel", func(cfg *PseudonymizeConfig) { cfg.KeyIDLabel = "" }, "key_id_label cannot be empty"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newTestConfig("1", "TEST_PSEUDONYMIZE_KEY")
+			tc.modify(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.wantErr)
+			require.NotContains(t, err.Error(), "short")
+		})
+	}
+}
+
+func TestPseudonymizeDeterministic(t *testing.T) {
+	// Operators with the same key, as on two hosts, give a value the same pseudonym
+	first, firstOut := newTestOperator(t, newTestConfig("1", "TEST_PSEUDONYMIZE_KEY"))
+	second, secondOut := newTestOperator(t, newTestConfig("1", "TEST_PSEUDONYMIZE_KEY"))
+
+	for _, op := range []*PseudonymizeOperator{first, second} {
+		e := entry.New()
+		e.Record = map[string]interface{}{"user": "alice", "message": "logged in"}
+		e.AddLabel("user", "alice")
+		require.NoError(t, op.Process(context.Background(), e))
+	}
+
+	expected := expectedPseudonym(testKey, "alice", sha256.Size)
+	for _, out := range []*testutil.FakeOutput{firstOut, secondOut} {
+		e := receive(t, out)
+		require.Equal(t, map[string]interface{}{"user": expected, "message": "logged in"}, e.Record)
+		require.Equal(t, map[string]string{"user": expected, "key_id": "1"}, e.Labels)
+	}
+}
+
+func TestPseudonymizeValues(t *testing.T) {
+	cfg := newTestConfig("1", "TEST_PSEUDONYMIZE_KEY")
+	cfg.Fields = append(cfg.Fields, entry.NewRecordField("uid"))
+	cfg.Length = 8
+	op, out := newTestOperator(t, cfg)
+
+	e := entry.New()
+	e.Record = map[string]interface{}{"user": "alice", "uid": 1000}
+	require.NoError(t, op.Process(context.Background(), e))
+	e = receive(t, out)
+	record := e.Record.(map[string]interface{})
+	require.Equal(t, expectedPseudonym(testKey, "alice", 8), record["user"])
+	require.Len(t, record["user"], 16)
+	// Values other than strings are hashed as JSON
+	require.Equal(t, expectedPseudonym(testKey, "1000", 8), record["uid"])
+
+	// Entries without any of the fields are not labeled
+	e = entry.New()
+	e.Record = map[string]interface{}{"message": "started"}
+	require.NoError(t, op.Process(context.Background(), e))
+	e = receive(t, out)
+	require.Equal(t, map[string]interface{}{"message": "started"}, e.Record)
+	require.Empty(t, e.Labels)
+}
+
+func TestPseudonymizeRotation(t *testing.T) {
+	before, beforeOut := newTestOperator(t, newTestConfig("2020-09", "TEST_PSEUDONYMIZE_KEY"))
+	cfg := newTestConfig("2020-10", "TEST_PSEUDONYMIZE_ROTATED_KEY")
+	cfg.KeyIDLabel = "pseudonym_key"
+	after, afterOut := newTestOperator(t, cfg)
+
+	for _, op := range []*PseudonymizeOperator{before, after} {
+		e := entry.New()
+		e.Record = map[string]interface{}{"user": "alice"}
+		require.NoError(t, op.Process(context.Background(), e))
+	}
+
+	old := receive(t, beforeOut)
+	rotated := receive(t, afterOut)
+	require.Equal(t, "2020-09", old.Labels["key_id"])
+	require.Equal(t, "2020-10", rotated.Labels["pseudonym_key"])
+	require.NotEqual(t, old.Record, rotated.Record)
+	require.Equal(t, expectedPseudonym(testRotatedKey, "alice", sha256.Size), rotated.Record.(map[string]interface{})["user"])
+}
+
+func TestPseudonymizeNeverLeaks(t *testing.T) {
+	const raw = "alice.secret-user"
+
+	core, logs := observer.New(zap.DebugLevel)
+	bc := testutil.NewBuildContext(t)
+	bc.Logger = logger.New(zap.New(core).Sugar())
+
+	cfg := newTestConfig("1", "TEST_PSEUDONYMIZE_KEY")
+	cfg.Fields = append(cfg.Fields, entry.NewRecordField("nested", "user"), entry.NewRecordField("nested", "user", "name"))
+	ops, err := cfg.Build(bc)
+	require.NoError(t, err)
+	op := ops[0].(*PseudonymizeOperator)
+	out := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{out}))
+
+	inputs := []interface{}{
+		map[string]interface{}{"user": raw},
+		map[string]interface{}{"nested": map[string]interface{}{"user": raw}},
+		// The second nested field no longer exists once its parent is replaced
+		map[string]interface{}{"nested": map[string]interface{}{"user": map[string]interface{}{"name": raw}}},
+	}
+	for _, input := range inputs {
+		e := entry.New()
+		e.Record = input
+		e.AddLabel("user", raw)
+		require.NoError(t, op.Process(context.Background(), e))
+
+		written := receive(t, out)
+		encoded, err := json.Marshal(written)
+		require.NoError(t, err)
+		require.NotContains(t, string(encoded), "alice")
+	}
+
+	for _, log := range logs.All() {
+		encoded, err := json.Marshal(log.ContextMap())
+		require.NoError(t, err)
+		require.NotContains(t, log.Message+string(encoded), "alice")
+		require.NotContains(t, log.Message+string(encoded), testKey)
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"container/list"
+	"time"
+)
+
+// keyStates holds the state of each key of a rate limit. The least recently
+// used key is evicted when it is full, so that the keys of a field with many
+// values do not grow without bound. An evicted key starts again with a full
+// burst.
+type keyStates struct {
+	maxSize int
+	order   *list.List
+	items   map[string]*list.Element
+}
+
+// keyState is the rate limit or sample of a key
+type keyState struct {
+	key     string
+	tokens  float64
+	updated time.Time
+	count   uint64
+	dropped uint64
+}
+
+func newKeyStates(maxSize int) *keyStates {
+	return &keyStates{
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// get returns the state of a key, and true if the state was created
+func (k *keyStates) get(key string) (*keyState, bool) {
+	if element, ok := k.items[key]; ok {
+		k.order.MoveToFront(element)
+		return element.Value.(*keyState), false
+	}
+
+	for k.order.Len() >= k.maxSize {
+		oldest := k.order.Back()
+		k.order.Remove(oldest)
+		delete(k.items, oldest.Value.(*keyState).key)
+	}
+
+	state := &keyState{key: key}
+	k.items[key] = k.order.PushFront(state)
+	return state, true
+}
+
+// takeDropped returns the number of entries dropped for each key since it
+// was last called
+func (k *keyStates) takeDropped() map[string]uint64 {
+	dropped := make(map[string]uint64)
+	for key, element := range k.items {
+		state := element.Value.(*keyState)
+		if state.dropped > 0 {
+			dropped[key] = state.dropped
+			state.dropped = 0
+		}
+	}
+	return dropped
+}
+
+// len returns the number of keys
+func (k *keyStates) len() int {
+	return k.order.Len()
+}
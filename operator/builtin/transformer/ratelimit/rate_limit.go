@@ -3,7 +3,9 @@ package ratelimit
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/observiq/stanza/entry"
@@ -11,6 +13,15 @@ import (
 	"github.com/observiq/stanza/operator/helper"
 )
 
+const (
+	// ModeDelay holds entries beyond the rate until the rate allows them
+	ModeDelay = "delay"
+	// ModeDrop drops entries beyond the rate
+	ModeDrop = "drop"
+	// ModeSample keeps a fraction of entries, and drops the rest
+	ModeSample = "sample"
+)
+
 func init() {
 	operator.Register("rate_limit", func() operator.Builder { return NewRateLimitConfig("") })
 }
@@ -19,6 +30,9 @@ func init() {
 func NewRateLimitConfig(operatorID string) *RateLimitConfig {
 	return &RateLimitConfig{
 		TransformerConfig: helper.NewTransformerConfig(operatorID, "rate_limit"),
+		Mode:              ModeDelay,
+		MaxKeys:           1000,
+		ReportInterval:    helper.Duration{Duration: time.Minute},
 	}
 }
 
@@ -29,6 +43,14 @@ type RateLimitConfig struct {
 	Rate     float64         `json:"rate,omitempty"     yaml:"rate,omitempty"`
 	Interval helper.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
 	Burst    uint            `json:"burst,omitempty"    yaml:"burst,omitempty"`
+	Mode     string          `json:"mode,omitempty"     yaml:"mode,omitempty"`
+
+	Every   uint    `json:"every,omitempty"   yaml:"every,omitempty"`
+	Percent float64 `json:"percent,omitempty" yaml:"percent,omitempty"`
+
+	KeyField       *entry.Field    `json:"key_field,omitempty"       yaml:"key_field,omitempty"`
+	MaxKeys        int             `json:"max_keys,omitempty"        yaml:"max_keys,omitempty"`
+	ReportInterval helper.Duration `json:"report_interval,omitempty" yaml:"report_interval,omitempty"`
 }
 
 // Build will build a rate limit operator.
@@ -38,89 +60,273 @@ func (c RateLimitConfig) Build(context operator.BuildContext) ([]operator.Operat
 		return nil, err
 	}
 
-	var interval time.Duration
-	switch {
-	case c.Rate != 0 && c.Interval.Raw() != 0:
-		return nil, fmt.Errorf("only one of 'rate' or 'interval' can be defined")
-	case c.Rate < 0 || c.Interval.Raw() < 0:
-		return nil, fmt.Errorf("rate and interval must be greater than zero")
-	case c.Rate > 0:
-		interval = time.Second / time.Duration(c.Rate)
+	rateLimitOperator := &RateLimitOperator{
+		TransformerOperator: transformerOperator,
+		mode:                c.Mode,
+		every:               uint64(c.Every),
+		percent:             c.Percent,
+		keyField:            c.KeyField,
+		reportInterval:      c.ReportInterval.Raw(),
+		now:                 time.Now,
+		random:              rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	switch c.Mode {
+	case ModeDelay, ModeDrop:
+		if c.Every != 0 || c.Percent != 0 {
+			return nil, fmt.Errorf("'every' and 'percent' can only be used with mode '%s'", ModeSample)
+		}
+		switch {
+		case c.Rate != 0 && c.Interval.Raw() != 0:
+			return nil, fmt.Errorf("only one of 'rate' or 'interval' can be defined")
+		case c.Rate < 0 || c.Interval.Raw() < 0:
+			return nil, fmt.Errorf("rate and interval must be greater than zero")
+		case c.Rate > 0:
+			rateLimitOperator.rate = c.Rate
+		case c.Interval.Raw() > 0:
+			rateLimitOperator.rate = float64(time.Second) / float64(c.Interval.Raw())
+		default:
+			return nil, fmt.Errorf("one of 'rate' or 'interval' must be defined")
+		}
+		rateLimitOperator.capacity = float64(c.Burst)
+		if rateLimitOperator.capacity < 1 {
+			rateLimitOperator.capacity = 1
+		}
+	case ModeSample:
+		if c.Rate != 0 || c.Interval.Raw() != 0 || c.Burst != 0 {
+			return nil, fmt.Errorf("'rate', 'interval' and 'burst' cannot be used with mode '%s'", ModeSample)
+		}
+		switch {
+		case c.Every != 0 && c.Percent != 0:
+			return nil, fmt.Errorf("only one of 'every' or 'percent' can be defined")
+		case c.Percent < 0 || c.Percent > 100:
+			return nil, fmt.Errorf("percent must be between 0 and 100")
+		case c.Every == 0 && c.Percent == 0:
+			return nil, fmt.Errorf("one of 'every' or 'percent' must be defined")
+		}
 	default:
-		interval = c.Interval.Raw()
+		return nil, fmt.Errorf("invalid mode '%s': must be '%s', '%s' or '%s'", c.Mode, ModeDelay, ModeDrop, ModeSample)
 	}
 
-	rateLimitOperator := &RateLimitOperator{
-		TransformerOperator: transformerOperator,
-		interval:            interval,
-		burst:               c.Burst,
+	if c.MaxKeys <= 0 {
+		return nil, fmt.Errorf("max_keys must be greater than zero")
 	}
+	if c.ReportInterval.Raw() <= 0 {
+		return nil, fmt.Errorf("report_interval must be greater than zero")
+	}
+	rateLimitOperator.keys = newKeyStates(c.MaxKeys)
 
 	return []operator.Operator{rateLimitOperator}, nil
 }
 
 // RateLimitOperator is an operator that limits the rate of log consumption between operators.
+// Entries beyond the rate are either delayed or dropped, or a sample of the
+// entries is kept. Each value of the key field is limited separately.
 type RateLimitOperator struct {
 	helper.TransformerOperator
 
-	interval time.Duration
-	burst    uint
-	isReady  chan struct{}
-	cancel   context.CancelFunc
-	wg       sync.WaitGroup
+	mode     string
+	rate     float64
+	capacity float64
+	every    uint64
+	percent  float64
+	keyField *entry.Field
+
+	// keys holds the state of each key, and random the source of samples.
+	// Both are guarded by mux.
+	mux    sync.Mutex
+	keys   *keyStates
+	random *rand.Rand
+	now    func() time.Time
+
+	// dropped is the number of entries dropped since the last report
+	dropped        uint64
+	reportInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-// Process will wait until a rate is met before sending an entry to the output.
+// Process will wait until a rate is met before sending an entry to the
+// output, or drop the entry if it is beyond the rate or not sampled.
 func (p *RateLimitOperator) Process(ctx context.Context, entry *entry.Entry) error {
-	select {
-	case <-p.isReady:
-		p.Write(ctx, entry)
-		return nil
-	case <-ctx.Done():
+	key := p.key(entry)
+
+	var keep bool
+	var wait time.Duration
+	switch p.mode {
+	case ModeDelay:
+		keep, wait = p.reserve(key)
+	case ModeDrop:
+		keep = p.allow(key)
+	case ModeSample:
+		keep = p.sample(key)
+	}
+
+	if !keep {
+		p.drop(key)
 		return nil
 	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil
+		case <-p.ctx.Done():
+			return nil
+		}
+	}
+
+	p.Write(ctx, entry)
+	return nil
+}
+
+// key returns the value of the key field of an entry, or an empty key
+func (p *RateLimitOperator) key(e *entry.Entry) string {
+	if p.keyField == nil {
+		return ""
+	}
+	value, ok := e.Get(p.keyField)
+	if !ok {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// reserve takes a token for an entry, and returns how long the entry must
+// wait for the token to be available
+func (p *RateLimitOperator) reserve(key string) (bool, time.Duration) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	state := p.refill(key)
+	state.tokens--
+	if state.tokens >= 0 {
+		return true, 0
+	}
+	return true, time.Duration(-state.tokens / p.rate * float64(time.Second))
+}
+
+// allow takes a token for an entry if one is available
+func (p *RateLimitOperator) allow(key string) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	state := p.refill(key)
+	if state.tokens < 1 {
+		return false
+	}
+	state.tokens--
+	return true
+}
+
+// refill adds the tokens earned by a key since it was last updated
+func (p *RateLimitOperator) refill(key string) *keyState {
+	now := p.now()
+	state, created := p.keys.get(key)
+	if created {
+		state.tokens = p.capacity
+		state.updated = now
+		return state
+	}
+
+	if elapsed := now.Sub(state.updated); elapsed > 0 {
+		state.tokens += elapsed.Seconds() * p.rate
+		if state.tokens > p.capacity {
+			state.tokens = p.capacity
+		}
+		state.updated = now
+	}
+	return state
+}
+
+// sample returns true if an entry is kept. One of every N entries of a key
+// is kept, starting with the first, or each entry is kept at random with a percentage.
+func (p *RateLimitOperator) sample(key string) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.every > 0 {
+		state, _ := p.keys.get(key)
+		state.count++
+		return (state.count-1)%p.every == 0
+	}
+	return p.random.Float64()*100 < p.percent
+}
+
+// drop counts an entry that was dropped
+func (p *RateLimitOperator) drop(key string) {
+	atomic.AddUint64(&p.dropped, 1)
+	p.OperatorStats().AddDropped(1)
+
+	if p.keyField != nil {
+		p.mux.Lock()
+		state, _ := p.keys.get(key)
+		state.dropped++
+		p.mux.Unlock()
+	}
 }
 
 // Start will start the rate limit operator.
 func (p *RateLimitOperator) Start() error {
-	p.isReady = make(chan struct{}, p.burst)
-	ticker := time.NewTicker(p.interval)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	p.cancel = cancel
+	p.ctx, p.cancel = context.WithCancel(context.Background())
 
-	// Buffer the ticker ticks in isReady to allow bursts
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
-		defer ticker.Stop()
-		defer close(p.isReady)
-
-		for {
-			select {
-			case <-ticker.C:
-				p.increment(ctx)
-			case <-ctx.Done():
-				return
-			}
-		}
+		p.reportPeriodically()
 	}()
 
 	return nil
 }
 
-func (p *RateLimitOperator) increment(ctx context.Context) {
-	select {
-	case p.isReady <- struct{}{}:
+// reportPeriodically logs the number of entries dropped in each report interval
+func (p *RateLimitOperator) reportPeriodically() {
+	ticker := time.NewTicker(p.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			p.report()
+			return
+		case <-ticker.C:
+			p.report()
+		}
+	}
+}
+
+// report logs the number of entries dropped since the last report, and the
+// keys that they were dropped for
+func (p *RateLimitOperator) report() {
+	dropped := atomic.SwapUint64(&p.dropped, 0)
+	if dropped == 0 {
 		return
-	case <-ctx.Done():
+	}
+
+	if p.keyField == nil {
+		p.Infow("Dropped entries", "dropped", dropped, "mode", p.mode)
 		return
 	}
+
+	p.mux.Lock()
+	keys := p.keys.takeDropped()
+	p.mux.Unlock()
+	p.Infow("Dropped entries", "dropped", dropped, "mode", p.mode, "keys", keys)
 }
 
 // Stop will stop the rate limit operator.
 func (p *RateLimitOperator) Stop() error {
-	p.cancel()
+	if p.cancel != nil {
+		p.cancel()
+	}
 	p.wg.Wait()
 	return nil
 }
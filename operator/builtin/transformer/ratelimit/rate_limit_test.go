@@ -2,6 +2,7 @@ package ratelimit
 
 import (
 	"context"
+	"fmt"
 	"runtime"
 	"sync"
 	"testing"
@@ -68,3 +69,193 @@ func TestRateLimit(t *testing.T) {
 		require.InEpsilon(t, elapsed.Nanoseconds(), time.Second.Nanoseconds(), 0.2)
 	}
 }
+
+func TestRateLimitBuild(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*RateLimitConfig)
+		errorMsg string
+	}{
+		{"Rate", func(cfg *RateLimitConfig) { cfg.Rate = 10 }, ""},
+		{"FractionalRate", func(cfg *RateLimitConfig) { cfg.Rate = 0.5 }, ""},
+		{"Interval", func(cfg *RateLimitConfig) { cfg.Interval.Duration = time.Second }, ""},
+		{"RateAndInterval", func(cfg *RateLimitConfig) { cfg.Rate = 10; cfg.Interval.Duration = time.Second }, "only one of 'rate' or 'interval'"},
+		{"NoRate", func(cfg *RateLimitConfig) {}, "one of 'rate' or 'interval' must be defined"},
+		{"NegativeRate", func(cfg *RateLimitConfig) { cfg.Rate = -1 }, "must be greater than zero"},
+		{"Drop", func(cfg *RateLimitConfig) { cfg.Mode = ModeDrop; cfg.Rate = 10 }, ""},
+		{"DropWithEvery", func(cfg *RateLimitConfig) { cfg.Mode = ModeDrop; cfg.Rate = 10; cfg.Every = 2 }, "can only be used with mode 'sample'"},
+		{"SampleEvery", func(cfg *RateLimitConfig) { cfg.Mode = ModeSample; cfg.Every = 10 }, ""},
+		{"SamplePercent", func(cfg *RateLimitConfig) { cfg.Mode = ModeSample; cfg.Percent = 10 }, ""},
+		{"SampleBoth", func(cfg *RateLimitConfig) { cfg.Mode = ModeSample; cfg.Every = 10; cfg.Percent = 10 }, "only one of 'every' or 'percent'"},
+		{"SampleNeither", func(cfg *RateLimitConfig) { cfg.Mode = ModeSample }, "one of 'every' or 'percent' must be defined"},
+		{"SampleInvalidPercent", func(cfg *RateLimitConfig) { cfg.Mode = ModeSample; cfg.Percent = 101 }, "percent must be between 0 and 100"},
+		{"SampleWithRate", func(cfg *RateLimitConfig) { cfg.Mode = ModeSample; cfg.Every = 10; cfg.Rate = 10 }, "cannot be used with mode 'sample'"},
+		{"InvalidMode", func(cfg *RateLimitConfig) { cfg.Mode = "other"; cfg.Rate = 10 }, "invalid mode 'other'"},
+		{"InvalidMaxKeys", func(cfg *RateLimitConfig) { cfg.Rate = 10; cfg.MaxKeys = 0 }, "max_keys must be greater than zero"},
+		{"InvalidReportInterval", func(cfg *RateLimitConfig) { cfg.Rate = 10; cfg.ReportInterval.Duration = 0 }, "report_interval must be greater than zero"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRateLimitConfig("test")
+			tc.modify(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.errorMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+// fakeClock is a clock that is advanced by the test
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestRateLimit(t *testing.T, cfg *RateLimitConfig) (*RateLimitOperator, *testutil.FakeOutput, *fakeClock) {
+	cfg.OutputIDs = []string{"fake"}
+	bc := testutil.NewBuildContext(t)
+	bc.CollectStats = true
+	ops, err := cfg.Build(bc)
+	require.NoError(t, err)
+	op := ops[0].(*RateLimitOperator)
+
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	op.now = clock.Now
+
+	fake := testutil.NewFakeOutput(t)
+	fake.Received = make(chan *entry.Entry, 100000)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+	require.NoError(t, op.Start())
+	t.Cleanup(func() { op.Stop() })
+	return op, fake, clock
+}
+
+func newKeyedEntry(key string) *entry.Entry {
+	e := entry.New()
+	e.Labels = map[string]string{"file_name": key}
+	return e
+}
+
+// TestRateLimitDropFlood floods the operator with 10 seconds of entries, and
+// checks that only the rate and the initial burst are kept
+func TestRateLimitDropFlood(t *testing.T) {
+	cfg := NewRateLimitConfig("test")
+	cfg.Mode = ModeDrop
+	cfg.Rate = 100
+	cfg.Burst = 10
+	op, fake, clock := newTestRateLimit(t, cfg)
+
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, op.Process(context.Background(), entry.New()))
+		clock.now = clock.now.Add(time.Millisecond)
+	}
+
+	kept := len(fake.Received)
+	require.InDelta(t, 1010, kept, 1)
+	require.Equal(t, uint64(10000-kept), op.OperatorStats().Snapshot().Dropped)
+}
+
+func TestRateLimitKeyed(t *testing.T) {
+	field := entry.NewLabelField("file_name")
+	cfg := NewRateLimitConfig("test")
+	cfg.Mode = ModeDrop
+	cfg.Rate = 10
+	cfg.Burst = 1
+	cfg.KeyField = &field
+	op, fake, clock := newTestRateLimit(t, cfg)
+
+	// The noisy file uses its own budget, so every entry of the quiet file is kept
+	quiet := 0
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, op.Process(context.Background(), newKeyedEntry("noisy.log")))
+		if i%100 == 0 {
+			require.NoError(t, op.Process(context.Background(), newKeyedEntry("quiet.log")))
+			quiet++
+		}
+		clock.now = clock.now.Add(time.Millisecond)
+	}
+
+	counts := map[string]int{}
+	for len(fake.Received) > 0 {
+		e := <-fake.Received
+		counts[e.Labels["file_name"]]++
+	}
+	require.Equal(t, quiet, counts["quiet.log"])
+	require.Equal(t, 10, counts["noisy.log"])
+
+	op.mux.Lock()
+	dropped := op.keys.takeDropped()
+	op.mux.Unlock()
+	require.Equal(t, map[string]uint64{"noisy.log": 990}, dropped)
+}
+
+func TestRateLimitMaxKeys(t *testing.T) {
+	field := entry.NewLabelField("file_name")
+	cfg := NewRateLimitConfig("test")
+	cfg.Mode = ModeDrop
+	cfg.Rate = 1
+	cfg.KeyField = &field
+	cfg.MaxKeys = 10
+	op, fake, _ := newTestRateLimit(t, cfg)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, op.Process(context.Background(), newKeyedEntry(fmt.Sprint(i))))
+	}
+	require.Equal(t, 10, op.keys.len())
+	require.Equal(t, 100, len(fake.Received))
+}
+
+func TestRateLimitSampleEvery(t *testing.T) {
+	field := entry.NewLabelField("file_name")
+	cfg := NewRateLimitConfig("test")
+	cfg.Mode = ModeSample
+	cfg.Every = 10
+	cfg.KeyField = &field
+	op, fake, _ := newTestRateLimit(t, cfg)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, op.Process(context.Background(), newKeyedEntry("a")))
+		require.NoError(t, op.Process(context.Background(), newKeyedEntry("b")))
+	}
+	require.Equal(t, 20, len(fake.Received))
+	require.Equal(t, uint64(180), op.OperatorStats().Snapshot().Dropped)
+}
+
+func TestRateLimitSamplePercent(t *testing.T) {
+	cfg := NewRateLimitConfig("test")
+	cfg.Mode = ModeSample
+	cfg.Percent = 25
+	op, fake, _ := newTestRateLimit(t, cfg)
+
+	for i := 0; i < 10000; i++ {
+		require.NoError(t, op.Process(context.Background(), entry.New()))
+	}
+	require.InDelta(t, 2500, len(fake.Received), 250)
+}
+
+func TestRateLimitDelayKeyed(t *testing.T) {
+	field := entry.NewLabelField("file_name")
+	cfg := NewRateLimitConfig("test")
+	cfg.Rate = 100
+	cfg.Burst = 1
+	cfg.KeyField = &field
+	op, _, clock := newTestRateLimit(t, cfg)
+
+	// Each key waits only for its own tokens
+	_, wait := op.reserve("a")
+	require.Equal(t, time.Duration(0), wait)
+	_, wait = op.reserve("a")
+	require.Equal(t, 10*time.Millisecond, wait)
+	_, wait = op.reserve("b")
+	require.Equal(t, time.Duration(0), wait)
+
+	clock.now = clock.now.Add(20 * time.Millisecond)
+	_, wait = op.reserve("a")
+	require.Equal(t, time.Duration(0), wait)
+}
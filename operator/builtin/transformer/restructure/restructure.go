@@ -13,6 +13,13 @@ import (
 	"github.com/observiq/stanza/operator/helper"
 )
 
+const (
+	// MissingFieldsError fails an entry when an op refers to a field that does not exist
+	MissingFieldsError = "error"
+	// MissingFieldsSkip skips the ops that refer to a field that does not exist
+	MissingFieldsSkip = "skip"
+)
+
 func init() {
 	operator.Register("restructure", func() operator.Builder { return NewRestructureOperatorConfig("") })
 }
@@ -28,7 +35,8 @@ func NewRestructureOperatorConfig(operatorID string) *RestructureOperatorConfig
 type RestructureOperatorConfig struct {
 	helper.TransformerConfig `yaml:",inline"`
 
-	Ops []Op `json:"ops" yaml:"ops"`
+	Ops           []Op   `json:"ops"                      yaml:"ops"`
+	MissingFields string `json:"missing_fields,omitempty" yaml:"missing_fields,omitempty"`
 }
 
 // Build will build a restructure operator from the supplied configuration
@@ -38,9 +46,25 @@ func (c RestructureOperatorConfig) Build(context operator.BuildContext) ([]opera
 		return nil, err
 	}
 
+	switch c.MissingFields {
+	case "", MissingFieldsError, MissingFieldsSkip:
+	default:
+		return nil, fmt.Errorf("invalid missing_fields '%s'", c.MissingFields)
+	}
+
+	for i, op := range c.Ops {
+		if op.OpApplier == nil {
+			return nil, fmt.Errorf("op %d has no type", i)
+		}
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("op %d: %s", i, err)
+		}
+	}
+
 	restructureOperator := &RestructureOperator{
 		TransformerOperator: transformerOperator,
 		ops:                 c.Ops,
+		skipMissing:         c.MissingFields == MissingFieldsSkip,
 	}
 
 	return []operator.Operator{restructureOperator}, nil
@@ -49,7 +73,8 @@ func (c RestructureOperatorConfig) Build(context operator.BuildContext) ([]opera
 // RestructureOperator is an operator that can restructure incoming entries using operations
 type RestructureOperator struct {
 	helper.TransformerOperator
-	ops []Op
+	ops         []Op
+	skipMissing bool
 }
 
 // Process will process an entry with a restructure transformation.
@@ -61,6 +86,9 @@ func (p *RestructureOperator) Process(ctx context.Context, entry *entry.Entry) e
 func (p *RestructureOperator) Transform(entry *entry.Entry) (*entry.Entry, error) {
 	for _, op := range p.ops {
 		err := op.Apply(entry)
+		if _, ok := err.(*missingFieldError); ok && p.skipMissing {
+			continue
+		}
 		if err != nil {
 			return entry, err
 		}
@@ -83,6 +111,50 @@ type OpApplier interface {
 	Type() string
 }
 
+// validate checks that the fields required by the op are set
+func (o Op) validate() error {
+	var missing string
+	switch op := o.OpApplier.(type) {
+	case *OpAdd:
+		if op.Field.FieldInterface == nil {
+			missing = "field"
+		}
+	case *OpRemove:
+		if op.Field.FieldInterface == nil {
+			missing = "field"
+		}
+	case *OpMove:
+		switch {
+		case op.From.FieldInterface == nil:
+			missing = "from"
+		case op.To.FieldInterface == nil:
+			missing = "to"
+		}
+	case *OpRename:
+		switch {
+		case len(op.Field.Keys) == 0:
+			missing = "field"
+		case op.To == "":
+			missing = "to"
+		}
+	}
+
+	if missing != "" {
+		return fmt.Errorf("%s op requires '%s'", o.Type(), missing)
+	}
+	return nil
+}
+
+// missingFieldError is returned when an op refers to a field that does not exist
+type missingFieldError struct {
+	op    string
+	field fmt.Stringer
+}
+
+func (e *missingFieldError) Error() string {
+	return fmt.Sprintf("apply %s: field %s does not exist on record", e.op, e.field)
+}
+
 // UnmarshalJSON will unmarshal JSON into an operation
 func (o *Op) UnmarshalJSON(raw []byte) error {
 	var typeDecoder map[string]rawMessage
@@ -167,6 +239,10 @@ func (o *Op) getOpApplier(opType string, rawMessage rawMessage) (OpApplier, erro
 		var remove OpRemove
 		err := rawMessage.Unmarshal(&remove)
 		return &remove, err
+	case "rename":
+		var rename OpRename
+		err := rawMessage.Unmarshal(&rename)
+		return &rename, err
 	case "retain":
 		var retain OpRetain
 		err := rawMessage.Unmarshal(&retain)
@@ -399,7 +475,7 @@ type OpMove struct {
 func (op *OpMove) Apply(e *entry.Entry) error {
 	val, ok := e.Delete(op.From)
 	if !ok {
-		return fmt.Errorf("apply move: field %s does not exist on record", op.From)
+		return &missingFieldError{op: "move", field: op.From}
 	}
 
 	return e.Set(op.To, val)
@@ -410,6 +486,31 @@ func (op *OpMove) Type() string {
 	return "move"
 }
 
+/*********
+  Rename
+*********/
+
+// OpRename is an operation for renaming a record field, which keeps its parent
+type OpRename struct {
+	Field entry.RecordField `json:"field" yaml:"field,flow"`
+	To    string            `json:"to"    yaml:"to"`
+}
+
+// Apply will perform the rename operation on an entry
+func (op *OpRename) Apply(e *entry.Entry) error {
+	val, ok := e.Delete(op.Field)
+	if !ok {
+		return &missingFieldError{op: "rename", field: op.Field}
+	}
+
+	return e.Set(op.Field.Parent().Child(op.To), val)
+}
+
+// Type will return the type of operation
+func (op *OpRename) Type() string {
+	return "rename"
+}
+
 /**********
   Flatten
 **********/
@@ -424,8 +525,7 @@ func (op *OpFlatten) Apply(e *entry.Entry) error {
 	parent := op.Field.Parent()
 	val, ok := e.Delete(op.Field)
 	if !ok {
-		// The field doesn't exist, so ignore it
-		return fmt.Errorf("apply flatten: field %s does not exist on record", op.Field)
+		return &missingFieldError{op: "flatten", field: op.Field}
 	}
 
 	valMap, ok := val.(map[string]interface{})
@@ -175,6 +175,57 @@ func TestRestructureOperator(t *testing.T) {
 				return e
 			}(),
 		},
+		{
+			name: "Rename",
+			ops: []Op{
+				{
+					&OpRename{
+						Field: entry.RecordField{Keys: []string{"nested", "nestedkey"}},
+						To:    "renamed",
+					},
+				},
+			},
+			input: newTestEntry(),
+			output: func() *entry.Entry {
+				e := newTestEntry()
+				e.Record = map[string]interface{}{
+					"key": "val",
+					"nested": map[string]interface{}{
+						"renamed": "nestedval",
+					},
+				}
+				return e
+			}(),
+		},
+		{
+			name: "RenameThenAddOldName",
+			ops: []Op{
+				{
+					&OpRename{
+						Field: entry.RecordField{Keys: []string{"key"}},
+						To:    "newkey",
+					},
+				},
+				{
+					&OpAdd{
+						Field: entry.NewRecordField("key"),
+						Value: "added",
+					},
+				},
+			},
+			input: newTestEntry(),
+			output: func() *entry.Entry {
+				e := newTestEntry()
+				e.Record = map[string]interface{}{
+					"key":    "added",
+					"newkey": "val",
+					"nested": map[string]interface{}{
+						"nestedkey": "nestedval",
+					},
+				}
+				return e
+			}(),
+		},
 		{
 			name: "Flatten",
 			ops: []Op{
@@ -428,6 +479,10 @@ func TestOpType(t *testing.T) {
 			&OpMove{},
 			"move",
 		},
+		{
+			&OpRename{},
+			"rename",
+		},
 		{
 			&OpFlatten{},
 			"flatten",
@@ -448,3 +503,146 @@ func TestOpType(t *testing.T) {
 		require.Contains(t, err.Error(), "unknown op type")
 	})
 }
+
+func TestRestructureBuildFailure(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*RestructureOperatorConfig)
+		errorMsg string
+	}{
+		{
+			"InvalidMissingFields",
+			func(cfg *RestructureOperatorConfig) { cfg.MissingFields = "ignore" },
+			"invalid missing_fields 'ignore'",
+		},
+		{
+			"NoType",
+			func(cfg *RestructureOperatorConfig) { cfg.Ops = []Op{{}} },
+			"op 0 has no type",
+		},
+		{
+			"RenameWithoutTo",
+			func(cfg *RestructureOperatorConfig) {
+				cfg.Ops = []Op{{&OpRename{Field: entry.RecordField{Keys: []string{"key"}}}}}
+			},
+			"op 0: rename op requires 'to'",
+		},
+		{
+			"MoveWithoutTo",
+			func(cfg *RestructureOperatorConfig) {
+				cfg.Ops = []Op{
+					{&OpRemove{Field: entry.NewRecordField("key")}},
+					{&OpMove{From: entry.NewRecordField("key")}},
+				}
+			},
+			"op 1: move op requires 'to'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRestructureOperatorConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			tc.modify(cfg)
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestRestructureMissingFields(t *testing.T) {
+	ops := []Op{
+		{&OpMove{From: entry.NewRecordField("missing"), To: entry.NewRecordField("moved")}},
+		{&OpRename{Field: entry.RecordField{Keys: []string{"missing"}}, To: "renamed"}},
+		{&OpFlatten{Field: entry.RecordField{Keys: []string{"missing"}}}},
+		{&OpAdd{Field: entry.NewRecordField("added"), Value: "val"}},
+	}
+
+	cases := []struct {
+		name          string
+		missingFields string
+		errorMsg      string
+		record        map[string]interface{}
+	}{
+		{"Default", "", "apply move: field missing does not exist on record", map[string]interface{}{"key": "val"}},
+		{"Error", MissingFieldsError, "apply move: field missing does not exist on record", map[string]interface{}{"key": "val"}},
+		{"Skip", MissingFieldsSkip, "", map[string]interface{}{"key": "val", "added": "val"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRestructureOperatorConfig("test")
+			cfg.OutputIDs = []string{"fake"}
+			cfg.Ops = ops
+			cfg.MissingFields = tc.missingFields
+			cfg.ErrorLabel = "restructure_error"
+
+			built, err := cfg.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+			op := built[0]
+			fake := testutil.NewFakeOutput(t)
+			require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+			e := entry.New()
+			e.Record = map[string]interface{}{"key": "val"}
+			require.NoError(t, op.Process(context.Background(), e))
+
+			select {
+			case e := <-fake.Received:
+				require.Equal(t, tc.record, e.Record)
+				if tc.errorMsg == "" {
+					require.Empty(t, e.Labels)
+				} else {
+					require.Equal(t, tc.errorMsg, e.Labels["restructure_error"])
+				}
+			case <-time.After(time.Second):
+				require.FailNow(t, "Timed out waiting for entry")
+			}
+		})
+	}
+}
+
+func TestRestructurePipelineYAML(t *testing.T) {
+	configYAML := `
+type: restructure
+output: fake
+ops:
+  - rename:
+      field: msg
+      to: message
+  - remove: password
+  - add:
+      field: env
+      value: prod
+  - add:
+      field: msg
+      value_expr: '$record.message + " (" + $record.env + ")"'
+`
+
+	var cfg operator.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(configYAML), &cfg))
+
+	built, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	op := built[0]
+	fake := testutil.NewFakeOutput(t)
+	require.NoError(t, op.SetOutputs([]operator.Operator{fake}))
+
+	e := entry.New()
+	e.Record = map[string]interface{}{
+		"msg":      "user logged in",
+		"password": "hunter2",
+		"user":     "admin",
+	}
+	require.NoError(t, op.Process(context.Background(), e))
+
+	// The last op reads the fields written by the ops before it, so each op
+	// must have been applied in order
+	fake.ExpectRecord(t, map[string]interface{}{
+		"message": "user logged in",
+		"env":     "prod",
+		"user":    "admin",
+		"msg":     "user logged in (prod)",
+	})
+}
@@ -3,6 +3,9 @@ package router
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/antonmedv/expr"
 	"github.com/antonmedv/expr/vm"
@@ -25,17 +28,34 @@ func NewRouterOperatorConfig(operatorID string) *RouterOperatorConfig {
 
 // RouterOperatorConfig is the configuration of a router operator
 type RouterOperatorConfig struct {
-	helper.BasicConfig `yaml:",inline"`
-	Routes             []*RouterOperatorRouteConfig `json:"routes" yaml:"routes"`
+	helper.BasicConfig        `yaml:",inline"`
+	helper.SeverityExprConfig `yaml:",inline"`
+	Routes                    []*RouterOperatorRouteConfig `json:"routes"                yaml:"routes"`
+	Default                   helper.OutputIDs             `json:"default,omitempty"     yaml:"default,omitempty"`
+	TraceRoute                bool                         `json:"trace_route,omitempty" yaml:"trace_route,omitempty"`
 }
 
 // RouterOperatorRouteConfig is the configuration of a route on a router operator
 type RouterOperatorRouteConfig struct {
 	helper.LabelerConfig `yaml:",inline"`
-	Expression           string           `json:"expr"   yaml:"expr"`
-	OutputIDs            helper.OutputIDs `json:"output" yaml:"output"`
+	Expression           string            `json:"expr"               yaml:"expr"`
+	OutputIDs            helper.OutputIDs  `json:"output"             yaml:"output"`
+	Name                 string            `json:"name,omitempty"     yaml:"name,omitempty"`
+	Pipeline             []operator.Config `json:"pipeline,omitempty" yaml:"pipeline,omitempty"`
 }
 
+// RouteLabel is the label that holds the name of the matched route when
+// routes are traced
+const RouteLabel = "route"
+
+// DefaultRouteName is the name of the route of the entries that match no
+// other route, when a default route is configured
+const DefaultRouteName = "default"
+
+// UnmatchedCounter is the counter of the entries that match no route and are
+// dropped
+const UnmatchedCounter = "unmatched"
+
 // Build will build a router operator from the supplied configuration
 func (c RouterOperatorConfig) Build(bc operator.BuildContext) ([]operator.Operator, error) {
 	basicOperator, err := c.BasicConfig.Build(bc)
@@ -43,8 +63,27 @@ func (c RouterOperatorConfig) Build(bc operator.BuildContext) ([]operator.Operat
 		return nil, err
 	}
 
+	severityExpr, err := c.SeverityExprConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+
 	routes := make([]*RouterOperatorRoute, 0, len(c.Routes))
-	for _, routeConfig := range c.Routes {
+	names := make(map[string]struct{}, len(c.Routes))
+	var pipelineOperators []operator.Operator
+	for i, routeConfig := range c.Routes {
+		name := routeConfig.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("duplicate route name '%s'", name)
+		}
+		if name == UnmatchedCounter {
+			return nil, fmt.Errorf("route name '%s' is reserved", name)
+		}
+		names[name] = struct{}{}
+
 		compiled, err := expr.Compile(routeConfig.Expression, expr.AsBool(), expr.AllowUndefinedVariables())
 		if err != nil {
 			return nil, fmt.Errorf("failed to compile expression '%s': %w", routeConfig.Expression, err)
@@ -55,30 +94,139 @@ func (c RouterOperatorConfig) Build(bc operator.BuildContext) ([]operator.Operat
 			return nil, fmt.Errorf("failed to build labeler for route '%s': %w", routeConfig.Expression, err)
 		}
 
+		outputIDs := routeConfig.OutputIDs.WithNamespace(bc)
+		if len(routeConfig.Pipeline) > 0 {
+			operators, firstID, err := c.buildRoutePipeline(bc, name, routeConfig)
+			if err != nil {
+				return nil, err
+			}
+			pipelineOperators = append(pipelineOperators, operators...)
+			outputIDs = helper.OutputIDs{firstID}
+		}
+
 		route := RouterOperatorRoute{
+			Name:       name,
 			Labeler:    labeler,
 			Expression: compiled,
-			OutputIDs:  routeConfig.OutputIDs.WithNamespace(bc),
+			OutputIDs:  outputIDs,
 		}
 		routes = append(routes, &route)
 	}
 
+	var defaultRoute *RouterOperatorRoute
+	if len(c.Default) > 0 {
+		if _, ok := names[DefaultRouteName]; ok {
+			return nil, fmt.Errorf("duplicate route name '%s'. The name is used by the default route", DefaultRouteName)
+		}
+		defaultRoute = &RouterOperatorRoute{
+			Name:      DefaultRouteName,
+			OutputIDs: c.Default.WithNamespace(bc),
+		}
+	}
+
+	for i, earlier := range unreachableRoutes(c.Routes) {
+		if earlier >= 0 {
+			basicOperator.Warnw("Route is unreachable because an earlier route matches every entry it would match",
+				"route", routes[i].Name, "earlier_route", routes[earlier].Name)
+		}
+	}
+
 	routerOperator := &RouterOperator{
 		BasicOperator: basicOperator,
 		routes:        routes,
+		defaultRoute:  defaultRoute,
+		routeMatches:  make([]uint64, len(routes)),
+		traceRoute:    c.TraceRoute,
+		severityExpr:  severityExpr,
+	}
+
+	return append([]operator.Operator{routerOperator}, pipelineOperators...), nil
+}
+
+// buildRoutePipeline builds the operators of the inline pipeline of a route,
+// and returns them with the ID of the first one. The operators are namespaced
+// by the router and the name of the route, such as `$.router.errors.output`,
+// so their IDs stay the same across restarts as long as the route keeps its
+// name. Each operator outputs to the next one by default. The last one has no
+// default output, so it must be an operator that does not output entries, or
+// one that sets its own output.
+func (c RouterOperatorConfig) buildRoutePipeline(bc operator.BuildContext, name string, routeConfig *RouterOperatorRouteConfig) ([]operator.Operator, string, error) {
+	if len(routeConfig.OutputIDs) > 0 {
+		return nil, "", fmt.Errorf("route '%s' cannot have both an output and a pipeline", name)
+	}
+	if strings.Contains(name, ".") {
+		return nil, "", fmt.Errorf("route name '%s' cannot contain '.', since it namespaces the operators of the route's pipeline", name)
+	}
+
+	pbc := bc.WithSubNamespace(c.ID()).WithSubNamespace(name)
+	configs := routeConfig.Pipeline
+	operators := make([]operator.Operator, 0, len(configs))
+	for i, config := range configs {
+		defaultOutputIDs := []string{}
+		if i+1 < len(configs) {
+			defaultOutputIDs = []string{pbc.PrependNamespace(configs[i+1].ID())}
+		}
+		built, err := config.Build(pbc.WithDefaultOutputIDs(defaultOutputIDs))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to build operator '%s' of route '%s': %w", pbc.PrependNamespace(config.ID()), name, err)
+		}
+		operators = append(operators, built...)
+
+		// The last operator has no default output, so an operator that
+		// outputs entries would drop every entry of the route unless it sets
+		// its own output
+		if i+1 == len(configs) && len(built) > 0 && built[0].CanOutput() && !hasOutputIDs(built[0]) {
+			return nil, "", fmt.Errorf("the last operator '%s' of route '%s' outputs entries, but has no output. End the pipeline with an output operator, or set the output of the operator", built[0].ID(), name)
+		}
 	}
+	return operators, pbc.PrependNamespace(configs[0].ID()), nil
+}
+
+// outputIDer is an operator that is configured with the IDs of its outputs
+type outputIDer interface {
+	GetOutputIDs() []string
+}
 
-	return []operator.Operator{routerOperator}, nil
+// hasOutputIDs returns whether an operator is configured with outputs
+func hasOutputIDs(op operator.Operator) bool {
+	withIDs, ok := op.(outputIDer)
+	return ok && len(withIDs.GetOutputIDs()) > 0
+}
+
+// unreachableRoutes returns, for each route, the index of an earlier route
+// that matches every entry the route would match, or -1. Only the trivial
+// cases are detected: an earlier route with the same expression, or an earlier
+// route whose expression is `true`.
+func unreachableRoutes(routes []*RouterOperatorRouteConfig) []int {
+	unreachable := make([]int, len(routes))
+	for i, route := range routes {
+		unreachable[i] = -1
+		for j := 0; j < i; j++ {
+			earlier := strings.TrimSpace(routes[j].Expression)
+			if earlier == "true" || earlier == strings.TrimSpace(route.Expression) {
+				unreachable[i] = j
+				break
+			}
+		}
+	}
+	return unreachable
 }
 
 // RouterOperator is an operator that routes entries based on matching expressions
 type RouterOperator struct {
 	helper.BasicOperator
-	routes []*RouterOperatorRoute
+	routes       []*RouterOperatorRoute
+	defaultRoute *RouterOperatorRoute
+	routeMatches []uint64
+	defaultCount uint64
+	unmatched    uint64
+	traceRoute   bool
+	severityExpr *helper.SeverityExpr
 }
 
 // RouterOperatorRoute is a route on a router operator
 type RouterOperatorRoute struct {
+	Name string
 	helper.Labeler
 	Expression      *vm.Program
 	OutputIDs       helper.OutputIDs
@@ -92,10 +240,10 @@ func (p *RouterOperator) CanProcess() bool {
 
 // Process will route incoming entries based on matching expressions
 func (p *RouterOperator) Process(ctx context.Context, entry *entry.Entry) error {
-	env := helper.GetExprEnv(entry)
-	defer helper.PutExprEnv(env)
+	env := p.severityExpr.GetExprEnv(entry)
+	defer p.severityExpr.PutExprEnv(env)
 
-	for _, route := range p.routes {
+	for i, route := range p.routes {
 		matches, err := vm.Run(route.Expression, env)
 		if err != nil {
 			p.Warnw("Running expression returned an error", zap.Error(err))
@@ -104,21 +252,58 @@ func (p *RouterOperator) Process(ctx context.Context, entry *entry.Entry) error
 
 		// we compile the expression with "AsBool", so this should be safe
 		if matches.(bool) {
-			if err := route.Label(entry); err != nil {
-				p.Errorf("Failed to label entry: %s", err)
-				return err
-			}
-
-			for _, output := range route.OutputOperators {
-				_ = output.Process(ctx, entry)
-			}
-			break
+			atomic.AddUint64(&p.routeMatches[i], 1)
+			return p.route(ctx, route, entry)
 		}
 	}
 
+	if p.defaultRoute != nil {
+		atomic.AddUint64(&p.defaultCount, 1)
+		return p.route(ctx, p.defaultRoute, entry)
+	}
+
+	// Entries that do not match a route are dropped
+	atomic.AddUint64(&p.unmatched, 1)
+	p.OperatorStats().AddDropped(1)
+	return nil
+}
+
+// route labels an entry for a route, and sends it to the outputs of the route
+func (p *RouterOperator) route(ctx context.Context, route *RouterOperatorRoute, entry *entry.Entry) error {
+	if err := route.Label(entry); err != nil {
+		p.Errorf("Failed to label entry: %s", err)
+		p.OperatorStats().AddErrored(1)
+		return err
+	}
+	if p.traceRoute {
+		entry.AddLabel(RouteLabel, route.Name)
+	}
+
+	p.OperatorStats().AddOut(1)
+	for _, output := range route.OutputOperators {
+		helper.RecordReceived(output)
+		_ = output.Process(ctx, entry)
+	}
 	return nil
 }
 
+// Counters returns the number of entries matched by each route, by route name,
+// and the number of entries dropped because they matched no route, once any
+// have been
+func (p *RouterOperator) Counters() map[string]uint64 {
+	counters := make(map[string]uint64, len(p.routes)+1)
+	for i, route := range p.routes {
+		counters[route.Name] = atomic.LoadUint64(&p.routeMatches[i])
+	}
+	if p.defaultRoute != nil {
+		counters[p.defaultRoute.Name] = atomic.LoadUint64(&p.defaultCount)
+	}
+	if unmatched := atomic.LoadUint64(&p.unmatched); unmatched > 0 {
+		counters[UnmatchedCounter] = unmatched
+	}
+	return counters
+}
+
 // CanOutput will always return true for a router operator
 func (p *RouterOperator) CanOutput() bool {
 	return true
@@ -127,24 +312,42 @@ func (p *RouterOperator) CanOutput() bool {
 // Outputs will return all connected operators.
 func (p *RouterOperator) Outputs() []operator.Operator {
 	outputs := make([]operator.Operator, 0, len(p.routes))
-	for _, route := range p.routes {
+	for _, route := range p.allRoutes() {
 		outputs = append(outputs, route.OutputOperators...)
 	}
 	return outputs
 }
 
+// GetOutputIDs returns the IDs of the outputs of every route
+func (p *RouterOperator) GetOutputIDs() []string {
+	ids := make([]string, 0, len(p.routes))
+	for _, route := range p.allRoutes() {
+		ids = append(ids, route.OutputIDs...)
+	}
+	return ids
+}
+
 // SetOutputs will set the outputs of the router operator.
 func (p *RouterOperator) SetOutputs(operators []operator.Operator) error {
-	for _, route := range p.routes {
+	for _, route := range p.allRoutes() {
 		outputOperators, err := p.findOperators(operators, route.OutputIDs)
 		if err != nil {
-			return fmt.Errorf("failed to set outputs on route: %s", err)
+			return fmt.Errorf("failed to set outputs on route '%s': %s", route.Name, err)
 		}
 		route.OutputOperators = outputOperators
 	}
 	return nil
 }
 
+// allRoutes returns the routes of the router, followed by the default route
+// if it is configured
+func (p *RouterOperator) allRoutes() []*RouterOperatorRoute {
+	if p.defaultRoute == nil {
+		return p.routes
+	}
+	return append(p.routes[:len(p.routes):len(p.routes)], p.defaultRoute)
+}
+
 // findOperators will find a subset of operators from a collection.
 func (p *RouterOperator) findOperators(operators []operator.Operator, operatorIDs []string) ([]operator.Operator, error) {
 	result := make([]operator.Operator, 0)
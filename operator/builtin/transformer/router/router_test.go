@@ -7,10 +7,13 @@ import (
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
+	_ "github.com/observiq/stanza/operator/builtin/output/drop"
+	"github.com/observiq/stanza/operator/builtin/transformer/noop"
 	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestRouterOperator(t *testing.T) {
@@ -41,6 +44,8 @@ func TestRouterOperator(t *testing.T) {
 					helper.NewLabelerConfig(),
 					"true",
 					[]string{"output1"},
+					"",
+					nil,
 				},
 			},
 			map[string]int{"output1": 1},
@@ -54,6 +59,8 @@ func TestRouterOperator(t *testing.T) {
 					helper.NewLabelerConfig(),
 					`false`,
 					[]string{"output1"},
+					"",
+					nil,
 				},
 			},
 			map[string]int{},
@@ -71,11 +78,15 @@ func TestRouterOperator(t *testing.T) {
 					helper.NewLabelerConfig(),
 					`$.message == "non_match"`,
 					[]string{"output1"},
+					"",
+					nil,
 				},
 				{
 					helper.NewLabelerConfig(),
 					`$.message == "test_message"`,
 					[]string{"output2"},
+					"",
+					nil,
 				},
 			},
 			map[string]int{"output2": 1},
@@ -93,6 +104,8 @@ func TestRouterOperator(t *testing.T) {
 					helper.NewLabelerConfig(),
 					`$.message == "non_match"`,
 					[]string{"output1"},
+					"",
+					nil,
 				},
 				{
 					helper.LabelerConfig{
@@ -102,6 +115,8 @@ func TestRouterOperator(t *testing.T) {
 					},
 					`$.message == "test_message"`,
 					[]string{"output2"},
+					"",
+					nil,
 				},
 			},
 			map[string]int{"output2": 1},
@@ -121,16 +136,44 @@ func TestRouterOperator(t *testing.T) {
 					helper.NewLabelerConfig(),
 					`env("TEST_ROUTER_PLUGIN_ENV") == "foo"`,
 					[]string{"output1"},
+					"",
+					nil,
 				},
 				{
 					helper.NewLabelerConfig(),
 					`true`,
 					[]string{"output2"},
+					"",
+					nil,
 				},
 			},
 			map[string]int{"output1": 1},
 			nil,
 		},
+		{
+			"MatchSeverity",
+			&entry.Entry{
+				Severity: entry.Error,
+			},
+			[]*RouterOperatorRouteConfig{
+				{
+					helper.NewLabelerConfig(),
+					`$severity >= critical`,
+					[]string{"output1"},
+					"",
+					nil,
+				},
+				{
+					helper.NewLabelerConfig(),
+					`$severity >= warn`,
+					[]string{"output2"},
+					"",
+					nil,
+				},
+			},
+			map[string]int{"output2": 1},
+			nil,
+		},
 	}
 
 	for _, tc := range cases {
@@ -139,6 +182,7 @@ func TestRouterOperator(t *testing.T) {
 			cfg.Routes = tc.routes
 
 			buildContext := testutil.NewBuildContext(t)
+			buildContext.CollectStats = true
 			ops, err := cfg.Build(buildContext)
 			require.NoError(t, err)
 			op := ops[0]
@@ -170,6 +214,390 @@ func TestRouterOperator(t *testing.T) {
 
 			require.Equal(t, tc.expectedCounts, results)
 			require.Equal(t, tc.expectedLabels, labels)
+
+			stats := routerOperator.OperatorStats().Snapshot()
+			if len(tc.expectedCounts) == 0 {
+				require.Equal(t, helper.OperatorStats{Dropped: 1}, stats)
+			} else {
+				require.Equal(t, helper.OperatorStats{EntriesOut: 1}, stats)
+			}
+		})
+	}
+}
+
+func TestRouterOperatorUnsetSeverity(t *testing.T) {
+	cfg := NewRouterOperatorConfig("test_operator_id")
+	cfg.UnsetSeverity = "trace"
+	cfg.Routes = []*RouterOperatorRouteConfig{
+		{
+			helper.NewLabelerConfig(),
+			`$severity == trace`,
+			[]string{"output1"},
+			"",
+			nil,
+		},
+	}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	processed := 0
+	mock1 := testutil.NewMockOperator("$.output1")
+	mock1.On("Process", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		processed++
+	})
+
+	routerOperator := ops[0].(*RouterOperator)
+	require.NoError(t, routerOperator.SetOutputs([]operator.Operator{mock1}))
+
+	require.NoError(t, routerOperator.Process(context.Background(), entry.New()))
+	require.Equal(t, 1, processed)
+}
+
+func TestRouterOperatorTraceRoute(t *testing.T) {
+	cfg := NewRouterOperatorConfig("test_operator_id")
+	cfg.TraceRoute = true
+	cfg.Routes = []*RouterOperatorRouteConfig{
+		{
+			helper.NewLabelerConfig(),
+			`$.message == "json"`,
+			[]string{"output1"},
+			"json",
+			nil,
+		},
+		{
+			helper.NewLabelerConfig(),
+			`true`,
+			[]string{"output2"},
+			"",
+			nil,
+		},
+	}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	var labels []map[string]string
+	mock1 := testutil.NewMockOperator("$.output1")
+	mock2 := testutil.NewMockOperator("$.output2")
+	for _, mockOutput := range []*testutil.Operator{mock1, mock2} {
+		mockOutput.On("Process", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			labels = append(labels, args[1].(*entry.Entry).Labels)
+		})
+	}
+
+	routerOperator := ops[0].(*RouterOperator)
+	require.NoError(t, routerOperator.SetOutputs([]operator.Operator{mock1, mock2}))
+
+	for _, message := range []string{"json", "text", "text"} {
+		e := entry.New()
+		e.Record = map[string]interface{}{"message": message}
+		require.NoError(t, routerOperator.Process(context.Background(), e))
+	}
+
+	expectedLabels := []map[string]string{
+		{RouteLabel: "json"},
+		{RouteLabel: "1"},
+		{RouteLabel: "1"},
+	}
+	require.Equal(t, expectedLabels, labels)
+	require.Equal(t, map[string]uint64{"json": 1, "1": 2}, routerOperator.Counters())
+}
+
+func TestRouterOperatorDuplicateRouteName(t *testing.T) {
+	cfg := NewRouterOperatorConfig("test_operator_id")
+	cfg.Routes = []*RouterOperatorRouteConfig{
+		{
+			helper.NewLabelerConfig(),
+			`$.message == "json"`,
+			[]string{"output1"},
+			"1",
+			nil,
+		},
+		{
+			helper.NewLabelerConfig(),
+			`true`,
+			[]string{"output2"},
+			"",
+			nil,
+		},
+	}
+
+	_, err := cfg.Build(testutil.NewBuildContext(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate route name '1'")
+}
+
+func TestUnreachableRoutes(t *testing.T) {
+	cases := []struct {
+		name        string
+		expressions []string
+		expected    []int
+	}{
+		{
+			"Reachable",
+			[]string{`$.format == "json"`, `$.format == "syslog"`, `true`},
+			[]int{-1, -1, -1},
+		},
+		{
+			"IdenticalExpression",
+			[]string{`$.format == "json"`, `$.format == "syslog"`, ` $.format == "json" `},
+			[]int{-1, -1, 0},
+		},
+		{
+			"AfterCatchAll",
+			[]string{`$.format == "json"`, `true`, `$.format == "syslog"`, `true`},
+			[]int{-1, -1, 1, 1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			routes := make([]*RouterOperatorRouteConfig, 0, len(tc.expressions))
+			for _, expression := range tc.expressions {
+				routes = append(routes, &RouterOperatorRouteConfig{Expression: expression})
+			}
+			require.Equal(t, tc.expected, unreachableRoutes(routes))
+		})
+	}
+}
+
+func TestRouterOperatorThreeRoutes(t *testing.T) {
+	cases := []struct {
+		name             string
+		defaultOutput    []string
+		expectedOutputs  map[string][]string
+		expectedCounters map[string]uint64
+	}{
+		{
+			"NoDefault",
+			nil,
+			map[string][]string{
+				"audit":   {"login"},
+				"elastic": {"request"},
+				"errors":  {"panic"},
+			},
+			map[string]uint64{"audit": 1, "app": 1, "errors": 1, UnmatchedCounter: 1},
+		},
+		{
+			"Default",
+			[]string{"catchall"},
+			map[string][]string{
+				"audit":    {"login"},
+				"elastic":  {"request"},
+				"errors":   {"panic"},
+				"catchall": {"debug"},
+			},
+			map[string]uint64{"audit": 1, "app": 1, "errors": 1, DefaultRouteName: 1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRouterOperatorConfig("test_operator_id")
+			cfg.Routes = []*RouterOperatorRouteConfig{
+				{helper.NewLabelerConfig(), `$labels.source == "audit"`, []string{"audit"}, "audit", nil},
+				{helper.NewLabelerConfig(), `$labels.source == "app" and $severity < error`, []string{"elastic"}, "app", nil},
+				{helper.NewLabelerConfig(), `$severity >= error`, []string{"errors"}, "errors", nil},
+			}
+			cfg.Default = tc.defaultOutput
+
+			buildContext := testutil.NewBuildContext(t)
+			buildContext.CollectStats = true
+			ops, err := cfg.Build(buildContext)
+			require.NoError(t, err)
+
+			received := map[string][]string{}
+			outputs := []operator.Operator{}
+			for _, id := range []string{"audit", "elastic", "errors", "catchall"} {
+				id := id
+				output := testutil.NewMockOperator("$." + id)
+				output.On("Process", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+					e := args[1].(*entry.Entry)
+					received[id] = append(received[id], e.Record.(string))
+				})
+				outputs = append(outputs, output)
+			}
+
+			routerOperator := ops[0].(*RouterOperator)
+			require.NoError(t, routerOperator.SetOutputs(outputs))
+
+			entries := []struct {
+				record   string
+				source   string
+				severity entry.Severity
+			}{
+				{"login", "audit", entry.Info},
+				{"request", "app", entry.Info},
+				{"panic", "app", entry.Error},
+				{"debug", "system", entry.Debug},
+			}
+			for _, e := range entries {
+				ent := entry.New()
+				ent.Record = e.record
+				ent.Labels = map[string]string{"source": e.source}
+				ent.Severity = e.severity
+				require.NoError(t, routerOperator.Process(context.Background(), ent))
+			}
+
+			require.Equal(t, tc.expectedOutputs, received)
+			require.Equal(t, tc.expectedCounters, routerOperator.Counters())
+
+			stats := routerOperator.OperatorStats().Snapshot()
+			if tc.defaultOutput == nil {
+				require.Equal(t, uint64(1), stats.Dropped)
+			} else {
+				require.Equal(t, uint64(0), stats.Dropped)
+			}
+		})
+	}
+}
+
+func TestRouterOperatorMissingOutput(t *testing.T) {
+	cfg := NewRouterOperatorConfig("test_operator_id")
+	cfg.Routes = []*RouterOperatorRouteConfig{
+		{helper.NewLabelerConfig(), `true`, []string{"output1"}, "all", nil},
+	}
+	cfg.Default = []string{"missing"}
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	routerOperator := ops[0].(*RouterOperator)
+	err = routerOperator.SetOutputs([]operator.Operator{testutil.NewMockOperator("$.output1")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "route 'default'")
+	require.Contains(t, err.Error(), "$.missing does not exist")
+}
+
+func TestRouterOperatorReservedRouteName(t *testing.T) {
+	cases := []struct {
+		name          string
+		routeName     string
+		defaultOutput []string
+		errText       string
+	}{
+		{"Unmatched", UnmatchedCounter, nil, "route name 'unmatched' is reserved"},
+		{"DefaultWithDefaultRoute", DefaultRouteName, []string{"output2"}, "duplicate route name 'default'"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewRouterOperatorConfig("test_operator_id")
+			cfg.Routes = []*RouterOperatorRouteConfig{
+				{helper.NewLabelerConfig(), `true`, []string{"output1"}, tc.routeName, nil},
+			}
+			cfg.Default = tc.defaultOutput
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errText)
+		})
+	}
+
+	// A route may be named default when no default route is configured
+	cfg := NewRouterOperatorConfig("test_operator_id")
+	cfg.Routes = []*RouterOperatorRouteConfig{
+		{helper.NewLabelerConfig(), `true`, []string{"output1"}, DefaultRouteName, nil},
+	}
+	_, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+}
+
+func TestRouterOperatorPipeline(t *testing.T) {
+	var cfg operator.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+type: router
+routes:
+  - name: errors
+    expr: '$severity >= error'
+    pipeline:
+      - type: noop
+      - type: drop_output
+  - expr: 'true'
+    pipeline:
+      - id: sink
+        type: drop_output
+`), &cfg))
+
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(ops))
+	for _, op := range ops {
+		ids = append(ids, op.ID())
+	}
+	require.Equal(t, []string{"$.router", "$.router.errors.noop", "$.router.errors.drop_output", "$.router.1.sink"}, ids)
+
+	// The operators of a pipeline output to the next one
+	require.Equal(t, helper.OutputIDs{"$.router.errors.drop_output"}, ops[1].(*noop.NoopOperator).OutputIDs)
+
+	routerOperator := ops[0].(*RouterOperator)
+	require.NoError(t, routerOperator.SetOutputs(ops))
+	require.Equal(t, []operator.Operator{ops[1], ops[3]}, routerOperator.Outputs())
+}
+
+func TestRouterOperatorPipelineExplicitOutput(t *testing.T) {
+	var cfg operator.Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+type: router
+routes:
+  - name: errors
+    expr: '$severity >= error'
+    pipeline:
+      - type: noop
+        output: $.other_output
+`), &cfg))
+
+	// The last operator of a pipeline may output to an operator elsewhere
+	ops, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	require.Equal(t, helper.OutputIDs{"$.other_output"}, ops[1].(*noop.NoopOperator).OutputIDs)
+}
+
+func TestRouterOperatorPipelineInvalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		route   *RouterOperatorRouteConfig
+		errText string
+	}{
+		{
+			"OutputAndPipeline",
+			&RouterOperatorRouteConfig{Name: "errors", OutputIDs: []string{"output1"}, Pipeline: []operator.Config{{Builder: noop.NewNoopOperatorConfig("")}}},
+			"route 'errors' cannot have both an output and a pipeline",
+		},
+		{
+			"DottedName",
+			&RouterOperatorRouteConfig{Name: "app.errors", Pipeline: []operator.Config{{Builder: noop.NewNoopOperatorConfig("")}}},
+			"route name 'app.errors' cannot contain '.'",
+		},
+		{
+			"InvalidOperator",
+			&RouterOperatorRouteConfig{Name: "errors", Pipeline: []operator.Config{{Builder: func() *RouterOperatorConfig {
+				nested := NewRouterOperatorConfig("nested")
+				nested.Routes = []*RouterOperatorRouteConfig{{Expression: "invalid expr ("}}
+				return nested
+			}()}}},
+			"failed to build operator '$.test_operator_id.errors.nested' of route 'errors'",
+		},
+		{
+			"LastOperatorOutputs",
+			&RouterOperatorRouteConfig{Name: "errors", Pipeline: []operator.Config{{Builder: noop.NewNoopOperatorConfig("")}}},
+			"the last operator '$.test_operator_id.errors.noop' of route 'errors' outputs entries, but has no output",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.route.LabelerConfig = helper.NewLabelerConfig()
+			tc.route.Expression = "true"
+			cfg := NewRouterOperatorConfig("test_operator_id")
+			cfg.Routes = []*RouterOperatorRouteConfig{tc.route}
+
+			_, err := cfg.Build(testutil.NewBuildContext(t))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errText)
 		})
 	}
 }
@@ -10,6 +10,10 @@ import (
 // Config is the configuration of an operator
 type Config struct {
 	Builder
+
+	// Expect are the expectations of the operator, which the validate
+	// command checks
+	Expect []Expectation `json:"-" yaml:"-"`
 }
 
 // Builder is an entity that can build a single operator
@@ -38,15 +42,46 @@ func (c *Config) UnmarshalJSON(bytes []byte) error {
 		return fmt.Errorf("unsupported type '%s'", typeUnmarshaller.Type)
 	}
 
+	var expectUnmarshaller struct {
+		Expect []Expectation `json:"expect"`
+	}
+	if err := json.Unmarshal(bytes, &expectUnmarshaller); err != nil {
+		return fmt.Errorf("unmarshal expect of %s: %s", typeUnmarshaller.Type, err)
+	}
+
 	builder := builderFunc()
-	if err := json.Unmarshal(bytes, builder); err != nil {
+	mark := markCollected()
+	if err := unmarshalBuilderJSON(bytes, builder); err != nil {
 		return fmt.Errorf("unmarshal to %s: %s", typeUnmarshaller.Type, err)
 	}
+	setOperatorID(mark, builder.ID())
 
 	c.Builder = builder
+	c.Expect = expectUnmarshaller.Expect
 	return nil
 }
 
+// unmarshalBuilderJSON unmarshals JSON to a builder, renaming any deprecated fields
+func unmarshalBuilderJSON(bytes []byte, builder Builder) error {
+	if _, ok := builder.(Deprecator); !ok {
+		return json.Unmarshal(bytes, builder)
+	}
+
+	rawConfig := map[string]interface{}{}
+	if err := json.Unmarshal(bytes, &rawConfig); err != nil {
+		return err
+	}
+
+	renamed, err := RenameDeprecatedFields(rawConfig, builder, "")
+	if err != nil {
+		return err
+	}
+	if !renamed {
+		return json.Unmarshal(bytes, builder)
+	}
+	return UnmarshalRenamedJSON(rawConfig, builder)
+}
+
 // MarshalJSON will marshal a config to JSON.
 func (c Config) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.Builder)
@@ -75,12 +110,36 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return fmt.Errorf("unsupported type '%s'", typeString)
 	}
 
+	// The expect block is not a field of the builder, so the builder is
+	// unmarshalled from the rest of the config
+	_, hasExpect := rawConfig["expect"]
+	expect, err := unmarshalExpectYAML(rawConfig)
+	if err != nil {
+		return fmt.Errorf("unmarshal to %s: %s", typeString, err)
+	}
+
 	builder := builderFunc()
-	if err = unmarshal(builder); err != nil {
+	mark := markCollected()
+	renamed, err := RenameDeprecatedFields(rawConfig, builder, "")
+	if err != nil {
+		return fmt.Errorf("unmarshal to %s: %s", typeString, err)
+	}
+
+	if renamed || hasExpect {
+		err = UnmarshalRenamedYAML(rawConfig, builder)
+	} else {
+		err = unmarshal(builder)
+	}
+	if err != nil {
+		if unknownErr := unknownFieldsError(rawConfig, NewSchema(typeString, builder)); unknownErr != nil {
+			return fmt.Errorf("unmarshal to %s: %s (%s)", typeString, unknownErr, err)
+		}
 		return fmt.Errorf("unmarshal to %s: %s", typeString, err)
 	}
+	setOperatorID(mark, builder.ID())
 
 	c.Builder = builder
+	c.Expect = expect
 	return nil
 }
 
@@ -145,3 +145,63 @@ func TestMarshalYAML(t *testing.T) {
 	expected := "id: plugin\ntype: plugin\narray:\n- test\n"
 	require.Equal(t, expected, string(out))
 }
+
+func TestUnmarshalExpect(t *testing.T) {
+	t.Cleanup(func() {
+		DefaultRegistry = NewRegistry()
+	})
+	Register("fake_operator", func() Builder { return &FakeBuilder{} })
+
+	expected := []Expectation{
+		{
+			Name:   "info",
+			Input:  "INFO started",
+			Fields: map[string]interface{}{"level": "INFO", "$labels.env": nil},
+		},
+		{Input: "DEBUG", Dropped: true},
+	}
+
+	t.Run("YAML", func(t *testing.T) {
+		raw := `
+type: fake_operator
+array: [a]
+expect:
+  - name: info
+    input: INFO started
+    fields:
+      level: INFO
+      $labels.env: null
+  - input: DEBUG
+    dropped: true
+`
+		var cfg Config
+		require.NoError(t, yaml.UnmarshalStrict([]byte(raw), &cfg))
+		require.Equal(t, []string{"a"}, cfg.Builder.(*FakeBuilder).Array)
+		require.Equal(t, expected, cfg.Expect)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		raw := `{"type":"fake_operator","array":["a"],"expect":[` +
+			`{"name":"info","input":"INFO started","fields":{"level":"INFO","$labels.env":null}},` +
+			`{"input":"DEBUG","dropped":true}]}`
+		var cfg Config
+		require.NoError(t, json.Unmarshal([]byte(raw), &cfg))
+		require.Equal(t, []string{"a"}, cfg.Builder.(*FakeBuilder).Array)
+		require.Equal(t, expected, cfg.Expect)
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		raw := "type: fake_operator\nexpect:\n  - input: a\n    output: b\n"
+		var cfg Config
+		err := yaml.UnmarshalStrict([]byte(raw), &cfg)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unmarshal expect")
+	})
+
+	t.Run("NotMarshalled", func(t *testing.T) {
+		cfg := Config{Builder: &FakeBuilder{OperatorType: "fake_operator"}, Expect: expected}
+		out, err := json.Marshal(cfg)
+		require.NoError(t, err)
+		require.NotContains(t, string(out), "expect")
+	})
+}
@@ -0,0 +1,147 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DeprecatedField is a config field that has been renamed. Configs that use
+// the old name continue to work, but each use is reported.
+type DeprecatedField struct {
+	Name        string
+	Replacement string
+}
+
+// Deprecator is implemented by config structs that have deprecated fields
+type Deprecator interface {
+	DeprecatedFields() []DeprecatedField
+}
+
+// Deprecation is a use of a deprecated field in a config
+type Deprecation struct {
+	File        string
+	OperatorID  string
+	Field       string
+	Replacement string
+}
+
+// String returns a description of the deprecated field and its replacement
+func (d Deprecation) String() string {
+	location := d.OperatorID
+	if d.File != "" {
+		location = fmt.Sprintf("%s (%s)", d.OperatorID, d.File)
+	}
+	return fmt.Sprintf("%s: '%s' is deprecated, use '%s' instead", location, d.Field, d.Replacement)
+}
+
+// deprecations collects the uses of deprecated fields while configs are
+// unmarshaled by CollectDeprecations. Its mutex guards the collected state,
+// which is read by every config that is unmarshaled, on any goroutine.
+var deprecations struct {
+	sync.Mutex
+	active    bool
+	collected []Deprecation
+}
+
+// collectMux keeps calls to CollectDeprecations from running at the same time
+var collectMux sync.Mutex
+
+// CollectDeprecations calls a function that unmarshals configs, and returns
+// the uses of deprecated fields found while it ran. Configs unmarshaled by
+// other goroutines while it runs are collected as well.
+func CollectDeprecations(unmarshal func() error) ([]Deprecation, error) {
+	collectMux.Lock()
+	defer collectMux.Unlock()
+
+	deprecations.Lock()
+	deprecations.active = true
+	deprecations.collected = nil
+	deprecations.Unlock()
+
+	err := unmarshal()
+
+	deprecations.Lock()
+	defer deprecations.Unlock()
+	collected := deprecations.collected
+	deprecations.active = false
+	deprecations.collected = nil
+	return collected, err
+}
+
+// markCollected returns the number of deprecations collected so far
+func markCollected() int {
+	deprecations.Lock()
+	defer deprecations.Unlock()
+	return len(deprecations.collected)
+}
+
+// setOperatorID sets the operator ID of the deprecations collected since a mark
+func setOperatorID(mark int, operatorID string) {
+	deprecations.Lock()
+	defer deprecations.Unlock()
+	for i := mark; i < len(deprecations.collected); i++ {
+		if deprecations.collected[i].OperatorID == "" {
+			deprecations.collected[i].OperatorID = operatorID
+		}
+	}
+}
+
+// RenameDeprecatedFields moves the values of deprecated fields in a raw config
+// to their replacements, if the config is a Deprecator. It returns true if any
+// fields were renamed, in which case the raw config should be unmarshaled in
+// place of the original. The prefix is added to the reported field names of
+// nested configs.
+func RenameDeprecatedFields(raw map[string]interface{}, config interface{}, prefix string) (bool, error) {
+	deprecator, ok := config.(Deprecator)
+	if !ok {
+		return false, nil
+	}
+
+	renamed := false
+	for _, field := range deprecator.DeprecatedFields() {
+		value, ok := raw[field.Name]
+		if !ok {
+			continue
+		}
+		if _, ok := raw[field.Replacement]; ok {
+			return false, fmt.Errorf("'%s' is deprecated and cannot be used with its replacement '%s'", field.Name, field.Replacement)
+		}
+
+		delete(raw, field.Name)
+		raw[field.Replacement] = value
+		renamed = true
+
+		deprecations.Lock()
+		if deprecations.active {
+			deprecations.collected = append(deprecations.collected, Deprecation{
+				Field:       prefix + field.Name,
+				Replacement: prefix + field.Replacement,
+			})
+		}
+		deprecations.Unlock()
+	}
+	return renamed, nil
+}
+
+// UnmarshalRenamedJSON unmarshals a raw config decoded from JSON after its
+// deprecated fields have been renamed
+func UnmarshalRenamedJSON(raw map[string]interface{}, dst interface{}) error {
+	bytes, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, dst)
+}
+
+// UnmarshalRenamedYAML unmarshals a raw config decoded from YAML after its
+// deprecated fields have been renamed
+func UnmarshalRenamedYAML(raw map[string]interface{}, dst interface{}) error {
+	bytes, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(bytes, dst)
+}
@@ -0,0 +1,164 @@
+package operator
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type DeprecatedBuilder struct {
+	FakeBuilder `yaml:",inline"`
+	Size        int `json:"size" yaml:"size"`
+}
+
+func (d *DeprecatedBuilder) DeprecatedFields() []DeprecatedField {
+	return []DeprecatedField{
+		{Name: "max_size", Replacement: "size"},
+	}
+}
+
+func TestUnmarshalDeprecatedFields(t *testing.T) {
+	t.Cleanup(func() {
+		DefaultRegistry = NewRegistry()
+	})
+	Register("deprecated_operator", func() Builder { return &DeprecatedBuilder{} })
+
+	cases := []struct {
+		name                 string
+		yaml                 string
+		json                 string
+		expectedSize         int
+		expectedDeprecations []Deprecation
+		expectedError        string
+	}{
+		{
+			"Replacement",
+			"type: deprecated_operator\nsize: 10\n",
+			`{"type": "deprecated_operator", "size": 10}`,
+			10,
+			nil,
+			"",
+		},
+		{
+			"Deprecated",
+			"type: deprecated_operator\nmax_size: 10\n",
+			`{"type": "deprecated_operator", "max_size": 10}`,
+			10,
+			[]Deprecation{{OperatorID: "plugin", Field: "max_size", Replacement: "size"}},
+			"",
+		},
+		{
+			"Both",
+			"type: deprecated_operator\nmax_size: 10\nsize: 10\n",
+			`{"type": "deprecated_operator", "max_size": 10, "size": 10}`,
+			0,
+			nil,
+			"cannot be used with its replacement 'size'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("YAML", func(t *testing.T) {
+				var cfg Config
+				deprecations, err := CollectDeprecations(func() error {
+					return yaml.UnmarshalStrict([]byte(tc.yaml), &cfg)
+				})
+				if tc.expectedError != "" {
+					require.Error(t, err)
+					require.Contains(t, err.Error(), tc.expectedError)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedSize, cfg.Builder.(*DeprecatedBuilder).Size)
+				require.Equal(t, tc.expectedDeprecations, deprecations)
+			})
+
+			t.Run("JSON", func(t *testing.T) {
+				var cfg Config
+				deprecations, err := CollectDeprecations(func() error {
+					return json.Unmarshal([]byte(tc.json), &cfg)
+				})
+				if tc.expectedError != "" {
+					require.Error(t, err)
+					require.Contains(t, err.Error(), tc.expectedError)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedSize, cfg.Builder.(*DeprecatedBuilder).Size)
+				require.Equal(t, tc.expectedDeprecations, deprecations)
+			})
+		})
+	}
+}
+
+func TestUnmarshalDeprecatedFieldsWithoutCollecting(t *testing.T) {
+	t.Cleanup(func() {
+		DefaultRegistry = NewRegistry()
+	})
+	Register("deprecated_operator", func() Builder { return &DeprecatedBuilder{} })
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("type: deprecated_operator\nmax_size: 10\n"), &cfg))
+	require.Equal(t, 10, cfg.Builder.(*DeprecatedBuilder).Size)
+
+	deprecations, err := CollectDeprecations(func() error { return nil })
+	require.NoError(t, err)
+	require.Empty(t, deprecations)
+}
+
+func TestUnmarshalDeprecatedFieldsConcurrently(t *testing.T) {
+	t.Cleanup(func() {
+		DefaultRegistry = NewRegistry()
+	})
+	Register("deprecated_operator", func() Builder { return &DeprecatedBuilder{} })
+
+	// Configs unmarshaled outside of a collection, such as by a remote config
+	// update, can run at the same time as a collection
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			var cfg Config
+			require.NoError(t, yaml.Unmarshal([]byte("type: deprecated_operator\nmax_size: 10\n"), &cfg))
+		}()
+		go func() {
+			defer wg.Done()
+			var cfg Config
+			deprecations, err := CollectDeprecations(func() error {
+				return yaml.Unmarshal([]byte("type: deprecated_operator\nmax_size: 10\n"), &cfg)
+			})
+			require.NoError(t, err)
+			require.NotEmpty(t, deprecations)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUnmarshalDeprecatedFieldsUnknownField(t *testing.T) {
+	t.Cleanup(func() {
+		DefaultRegistry = NewRegistry()
+	})
+	Register("deprecated_operator", func() Builder { return &DeprecatedBuilder{} })
+
+	var cfg Config
+	err := yaml.UnmarshalStrict([]byte("type: deprecated_operator\nmax_size: 10\nunknown: 10\n"), &cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field unknown not found")
+}
+
+func TestDeprecationString(t *testing.T) {
+	deprecation := Deprecation{
+		OperatorID:  "elastic_output",
+		Field:       "buffer.max_size",
+		Replacement: "buffer.max_bytes",
+	}
+	require.Equal(t, "elastic_output: 'buffer.max_size' is deprecated, use 'buffer.max_bytes' instead", deprecation.String())
+
+	deprecation.File = "/etc/stanza/config.yaml"
+	require.Equal(t, "elastic_output (/etc/stanza/config.yaml): 'buffer.max_size' is deprecated, use 'buffer.max_bytes' instead", deprecation.String())
+}
@@ -0,0 +1,51 @@
+package operator
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Expectation is a sample input of an operator, and the fields of the entry
+// that the operator must write for it. Expectations are set in the `expect`
+// block of an operator, and are checked by the validate command. They are
+// ignored when the agent runs.
+type Expectation struct {
+	// Name identifies the expectation in failures. It defaults to the
+	// position of the expectation in the block.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Input is the record of the entry sent to the operator, and Labels are
+	// its labels
+	Input  interface{}       `json:"input"            yaml:"input"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// Fields are the values that the fields of the entry written by the
+	// operator must have, by field, such as $labels.env or level. A field
+	// with a null value must not exist.
+	Fields map[string]interface{} `json:"fields,omitempty" yaml:"fields,omitempty"`
+
+	// Dropped expects the operator to write no entry
+	Dropped bool `json:"dropped,omitempty" yaml:"dropped,omitempty"`
+}
+
+// unmarshalExpectYAML removes the expect block from a raw config decoded from
+// YAML, and unmarshals it
+func unmarshalExpectYAML(raw map[string]interface{}) ([]Expectation, error) {
+	value, ok := raw["expect"]
+	if !ok {
+		return nil, nil
+	}
+	delete(raw, "expect")
+
+	bytes, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var expect []Expectation
+	if err := yaml.UnmarshalStrict(bytes, &expect); err != nil {
+		return nil, fmt.Errorf("unmarshal expect: %s", err)
+	}
+	return expect, nil
+}
@@ -2,11 +2,12 @@ package flusher
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	backoff "github.com/cenkalti/backoff/v4"
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator/buffer"
 	"github.com/observiq/stanza/operator/helper"
@@ -28,7 +29,14 @@ type Config struct {
 	// Defaults to 1000.
 	MaxChunkEntries int `json:"max_chunk_entries" yaml:"max_chunk_entries"`
 
-	// TODO configurable retry
+	// AlignToInterval schedules flushes at wall clock instants that are multiples
+	// of MaxWait, rather than MaxWait after each read starts. Defaults to false.
+	AlignToInterval bool `json:"align_to_interval,omitempty" yaml:"align_to_interval,omitempty"`
+
+	// AlignJitter is the maximum random offset applied to aligned flush instants,
+	// so that a fleet of agents does not flush at the same instant. The offset is
+	// chosen once per flusher and is capped at MaxWait. Defaults to 0.
+	AlignJitter helper.Duration `json:"align_jitter,omitempty" yaml:"align_jitter,omitempty"`
 }
 
 // NewConfig creates a new default flusher config
@@ -43,20 +51,40 @@ func NewConfig() Config {
 }
 
 // Build uses a Config to build a new Flusher
-func (c *Config) Build(buf buffer.Buffer, f FlushFunc, logger *zap.SugaredLogger) *Flusher {
+func (c *Config) Build(buf buffer.Buffer, f FlushFunc, logger *zap.SugaredLogger) (*Flusher, error) {
+	if c.MaxWait.Raw() <= 0 {
+		return nil, fmt.Errorf("max_wait must be greater than zero")
+	}
+
+	// A buffer that releases batches on its own interval waits that long instead
+	waitTime := c.MaxWait.Raw()
+	if interval := buffer.FlushInterval(buf); interval > 0 {
+		waitTime = interval
+	}
+
+	var alignOffset time.Duration
+	if c.AlignToInterval {
+		alignOffset = jitterOffset(rand.New(rand.NewSource(time.Now().UnixNano())), c.AlignJitter.Raw(), waitTime)
+	}
+
 	return &Flusher{
 		buffer:        buf,
 		sem:           semaphore.NewWeighted(int64(c.MaxConcurrent)),
+		maxConcurrent: int64(c.MaxConcurrent),
 		flush:         f,
 		SugaredLogger: logger,
-		waitTime:      c.MaxWait.Duration,
+		waitTime:      waitTime,
+		align:         c.AlignToInterval,
+		alignOffset:   alignOffset,
+		now:           time.Now,
+		retrier:       newDefaultRetrier(logger),
 		entrySlicePool: sync.Pool{
 			New: func() interface{} {
 				slice := make([]*entry.Entry, c.MaxChunkEntries)
 				return &slice
 			},
 		},
-	}
+	}, nil
 }
 
 // Flusher is used to flush entries from a buffer concurrently. It handles max concurrenty,
@@ -70,6 +98,16 @@ type Flusher struct {
 	flush          FlushFunc
 	waitTime       time.Duration
 	entrySlicePool sync.Pool
+	window         *helper.DeliveryWindow
+	stats          *helper.OperatorStats
+	maintenance    *helper.Maintenance
+	retrier        *helper.Retrier
+	maxConcurrent  int64
+	rampMux        sync.Mutex
+	held           int64
+	align          bool
+	alignOffset    time.Duration
+	now            func() time.Time
 	*zap.SugaredLogger
 }
 
@@ -88,13 +126,60 @@ func (f *Flusher) Start() {
 	}()
 }
 
+// SetDeliveryWindow restricts flushing to the times when the window is open.
+// Entries keep accumulating in the buffer while the window is closed.
+func (f *Flusher) SetDeliveryWindow(window *helper.DeliveryWindow) {
+	f.window = window
+}
+
+// SetRetrier sets how failed flushes are retried, such as with the
+// retry_on_failure of the output. Failed flushes are retried with the default
+// backoff until they succeed if it is not set.
+func (f *Flusher) SetRetrier(retrier *helper.Retrier) {
+	if retrier != nil {
+		f.retrier = retrier
+	}
+}
+
+// SetMaintenance stops flushing while the output is parked for maintenance.
+// Entries keep accumulating in the buffer while the output is parked, and
+// once it resumes, the number of concurrent flushes ramps up gradually so that
+// the destination is not flooded with the backlog.
+func (f *Flusher) SetMaintenance(maintenance *helper.Maintenance) {
+	if maintenance == nil {
+		return
+	}
+	maintenance.Attach(buffer.IsMemory(f.buffer))
+	f.maintenance = maintenance
+}
+
+// SetStats counts the entries that the buffer drops because it is full, and
+// the entries that expire in the delivery window, in the dropped stat of the
+// output. The entries dropped by the buffer are logged with the flusher's logger.
+func (f *Flusher) SetStats(stats *helper.OperatorStats) {
+	f.stats = stats
+	buffer.ReportDrops(f.buffer, stats, f.SugaredLogger)
+}
+
+// FlushNow flushes entries immediately, bypassing the buffer and any delivery
+// window. It returns only after the entries have been flushed or the context
+// has been cancelled.
+func (f *Flusher) FlushNow(ctx context.Context, entries []*entry.Entry) error {
+	return f.flushWithRetry(ctx, entries)
+}
+
 // Stop cancels all the in-progress flushers and waits until they have returned
 func (f *Flusher) Stop() {
 	f.cancel()
 	f.wg.Wait()
+
+	f.rampMux.Lock()
+	defer f.rampMux.Unlock()
+	f.releaseHeld(f.held)
 }
 
 func (f *Flusher) read(ctx context.Context) {
+	parked := false
 	for {
 		select {
 		case <-ctx.Done():
@@ -102,9 +187,49 @@ func (f *Flusher) read(ctx context.Context) {
 		default:
 		}
 
+		// Idle while the output is parked for maintenance
+		if wait, changed := f.maintenance.Remaining(); wait > 0 {
+			if !parked {
+				parked = true
+				f.Infow("Output parked for maintenance. Buffering entries until it resumes", "wait_time", wait)
+				if f.maintenance.Status().MemoryBuffer {
+					f.Warnw("Output parked for maintenance with a memory buffer. Buffered entries are lost if the agent stops")
+				}
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-changed:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+		if parked {
+			parked = false
+			f.Infow("Maintenance ended. Resuming delivery")
+			if err := f.holdFlushes(ctx); err != nil {
+				// Context cancelled
+				return
+			}
+		}
+
+		// Idle until the delivery window opens
+		if wait := f.window.UntilOpen(); wait > 0 {
+			f.Debugw("Delivery window closed. Waiting to flush", "wait_time", wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+
 		// Fill a slice of entries
 		entries := f.getEntrySlice()
-		readCtx, cancel := context.WithTimeout(ctx, f.waitTime)
+		readCtx, cancel := context.WithDeadline(ctx, f.readDeadline())
 		markFlushed, n, err := f.buffer.ReadWait(readCtx, entries)
 		cancel()
 		if err != nil {
@@ -116,6 +241,15 @@ func (f *Flusher) read(ctx context.Context) {
 			continue
 		}
 
+		// Entries that expired while the window was closed are not delivered
+		if n = f.dropExpired(entries[:n]); n == 0 {
+			if err := markFlushed(); err != nil {
+				f.Errorw("Failed while marking entries flushed", zap.Error(err))
+			}
+			f.putEntrySlice(entries)
+			continue
+		}
+
 		// Wait until we have free flusher goroutines
 		err = f.sem.Acquire(ctx, 1)
 		if err != nil {
@@ -134,36 +268,129 @@ func (f *Flusher) read(ctx context.Context) {
 				if err := markFlushed(); err != nil {
 					f.Errorw("Failed while marking entries flushed", zap.Error(err))
 				}
+				f.rampUp()
 			}
 		}()
 	}
 }
 
-// flushWithRetry will continue trying to call Flusher.flushFunc with the entries passed
-// in until either flushFunc returns no error or the context is cancelled. It will only
-// return an error in the case that the context was cancelled. If no error was returned,
-// it is safe to mark the entries in the buffer as flushed.
-func (f *Flusher) flushWithRetry(ctx context.Context, entries []*entry.Entry) error {
-	chunkID := atomic.AddUint64(&f.chunkIDCounter, 1)
-	b := newExponentialBackoff()
-	for {
-		err := f.flush(ctx, entries)
-		if err == nil {
-			return nil
+// dropExpired moves the entries that have not expired in the delivery window
+// to the front of the slice, and returns their number. The expired entries are
+// counted as dropped.
+func (f *Flusher) dropExpired(entries []*entry.Entry) int {
+	kept := 0
+	for _, e := range entries {
+		if f.window.Expired(e) {
+			continue
 		}
+		entries[kept] = e
+		kept++
+	}
 
-		waitTime := b.NextBackOff()
-		if waitTime == b.Stop {
-			f.Errorw("Reached max backoff time during chunk flush retry. Dropping logs in chunk", "chunk_id", chunkID)
-			return nil
-		}
-		f.Warnw("Failed flushing chunk. Waiting before retry", "error", err, "wait_time", waitTime)
+	if expired := len(entries) - kept; expired > 0 {
+		f.stats.AddDropped(uint64(expired))
+		f.Warnw("Dropped buffered entries older than the ttl of the delivery window", "dropped", expired)
+	}
+	return kept
+}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(waitTime):
-		}
+// holdFlushes limits the flusher to a single concurrent flush, by holding the
+// rest of the flush slots. The slots are released by rampUp.
+func (f *Flusher) holdFlushes(ctx context.Context) error {
+	f.rampMux.Lock()
+	hold := f.maxConcurrent - 1 - f.held
+	f.rampMux.Unlock()
+	if hold <= 0 {
+		return nil
+	}
+
+	// Wait for in-progress flushes to finish
+	if err := f.sem.Acquire(ctx, hold); err != nil {
+		return err
+	}
+
+	f.rampMux.Lock()
+	f.held += hold
+	f.rampMux.Unlock()
+	return nil
+}
+
+// rampUp doubles the number of concurrent flushes after a successful flush,
+// until every flush slot has been released
+func (f *Flusher) rampUp() {
+	f.rampMux.Lock()
+	defer f.rampMux.Unlock()
+
+	release := f.maxConcurrent - f.held
+	if release > f.held {
+		release = f.held
+	}
+	f.releaseHeld(release)
+}
+
+// releaseHeld releases held flush slots. It must be called with rampMux held.
+func (f *Flusher) releaseHeld(n int64) {
+	if n <= 0 {
+		return
+	}
+	f.sem.Release(n)
+	f.held -= n
+}
+
+// readDeadline returns the time at which the current read from the buffer
+// should stop waiting for a full slice of entries and flush what it has
+func (f *Flusher) readDeadline() time.Time {
+	now := f.now()
+	if !f.align {
+		return now.Add(f.waitTime)
+	}
+	return nextAlignedFlush(now, f.waitTime, f.alignOffset)
+}
+
+// nextAlignedFlush returns the first instant after now that is offset from a
+// multiple of the interval by the given offset. Without a positive interval,
+// there is no instant to align to, so it returns now.
+func nextAlignedFlush(now time.Time, interval, offset time.Duration) time.Time {
+	if interval <= 0 {
+		return now
+	}
+	next := now.Truncate(interval).Add(offset)
+	for !next.After(now) {
+		next = next.Add(interval)
+	}
+	return next
+}
+
+// jitterOffset returns a random offset in the range [0, jitter), capped at the interval
+func jitterOffset(r *rand.Rand, jitter, interval time.Duration) time.Duration {
+	if jitter > interval {
+		jitter = interval
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(r.Int63n(int64(jitter)))
+}
+
+// flushWithRetry will retry calling Flusher.flushFunc with the entries passed
+// in until either flushFunc returns no error, the retrier gives up, or the
+// context is cancelled. It will only return an error in the case that the
+// context was cancelled. If no error was returned, it is safe to mark the
+// entries in the buffer as flushed, including entries that were dropped
+// because the retrier gave up.
+func (f *Flusher) flushWithRetry(ctx context.Context, entries []*entry.Entry) error {
+	chunkID := atomic.AddUint64(&f.chunkIDCounter, 1)
+	err := f.retrier.Do(ctx, func() error {
+		return f.flush(ctx, entries)
+	})
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		f.Errorw("Failed to flush chunk. Dropping logs in chunk", "chunk_id", chunkID, "entries", len(entries), zap.Error(err))
+		return nil
 	}
 }
 
@@ -175,17 +402,12 @@ func (f *Flusher) putEntrySlice(slice []*entry.Entry) {
 	f.entrySlicePool.Put(&slice)
 }
 
-// newExponentialBackoff returns a default ExponentialBackOff
-func newExponentialBackoff() *backoff.ExponentialBackOff {
-	b := &backoff.ExponentialBackOff{
-		InitialInterval:     backoff.DefaultInitialInterval,
-		RandomizationFactor: backoff.DefaultRandomizationFactor,
-		Multiplier:          backoff.DefaultMultiplier,
-		MaxInterval:         10 * time.Minute,
-		MaxElapsedTime:      time.Duration(0),
-		Stop:                backoff.Stop,
-		Clock:               backoff.SystemClock,
+// newDefaultRetrier returns a retrier with the default retry config
+func newDefaultRetrier(logger *zap.SugaredLogger) *helper.Retrier {
+	retrier, err := helper.NewRetryConfig().Build(logger)
+	if err != nil {
+		// The default config is always valid
+		panic(err)
 	}
-	b.Reset()
-	return b
+	return retrier
 }
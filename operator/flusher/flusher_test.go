@@ -2,6 +2,8 @@ package flusher
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
@@ -34,7 +36,8 @@ func TestFlusher(t *testing.T) {
 	flusherCfg.MaxWait = helper.Duration{
 		Duration: 10 * time.Millisecond,
 	}
-	flusher := flusherCfg.Build(buf, flushFunc, nil)
+	flusher, err := flusherCfg.Build(buf, flushFunc, nil)
+	require.NoError(t, err)
 
 	for i := 0; i < 100; i++ {
 		err := buf.Add(context.Background(), entry.New())
@@ -51,3 +54,324 @@ func TestFlusher(t *testing.T) {
 		}
 	}
 }
+
+func TestFlusherDeliveryWindow(t *testing.T) {
+	buildContext := testutil.NewBuildContext(t)
+	buf, err := buffer.NewConfig().Build(buildContext, "testID")
+	require.NoError(t, err)
+	defer buf.Close()
+
+	flushed := make(chan struct{}, 10)
+	flushFunc := func(ctx context.Context, entries []*entry.Entry) error {
+		for i := 0; i < len(entries); i++ {
+			flushed <- struct{}{}
+		}
+		return nil
+	}
+
+	now := time.Now().UTC()
+	windowCfg := &helper.DeliveryWindowConfig{
+		Start:    now.Add(2 * time.Hour).Format("15:04"),
+		End:      now.Add(3 * time.Hour).Format("15:04"),
+		Timezone: "UTC",
+	}
+	window, err := windowCfg.Build()
+	require.NoError(t, err)
+
+	flusherCfg := NewConfig()
+	flusherCfg.MaxWait = helper.NewDuration(10 * time.Millisecond)
+	flusher, err := flusherCfg.Build(buf, flushFunc, buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+	flusher.SetDeliveryWindow(window)
+
+	err = buf.Add(context.Background(), entry.New())
+	require.NoError(t, err)
+
+	flusher.Start()
+	defer flusher.Stop()
+
+	select {
+	case <-flushed:
+		require.FailNow(t, "flushed while delivery window was closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = flusher.FlushNow(context.Background(), []*entry.Entry{entry.New()})
+	require.NoError(t, err)
+	require.Len(t, flushed, 1)
+}
+
+func TestFlusherDeliveryWindowTTL(t *testing.T) {
+	buildContext := testutil.NewBuildContext(t)
+	buf, err := buffer.NewConfig().Build(buildContext, "testID")
+	require.NoError(t, err)
+	defer buf.Close()
+
+	flushed := make(chan *entry.Entry, 10)
+	flushFunc := func(ctx context.Context, entries []*entry.Entry) error {
+		for _, e := range entries {
+			flushed <- e
+		}
+		return nil
+	}
+
+	now := time.Now().UTC()
+	windowCfg := &helper.DeliveryWindowConfig{
+		Start:    now.Add(-time.Hour).Format("15:04"),
+		End:      now.Add(time.Hour).Format("15:04"),
+		Timezone: "UTC",
+		TTL:      helper.NewDuration(time.Hour),
+	}
+	window, err := windowCfg.Build()
+	require.NoError(t, err)
+
+	flusherCfg := NewConfig()
+	flusherCfg.MaxWait = helper.NewDuration(10 * time.Millisecond)
+	flusher, err := flusherCfg.Build(buf, flushFunc, buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+	flusher.SetDeliveryWindow(window)
+	stats := &helper.OperatorStats{}
+	flusher.SetStats(stats)
+
+	stale := entry.New()
+	stale.Timestamp = now.Add(-2 * time.Hour)
+	stale.Record = "stale"
+	fresh := entry.New()
+	fresh.Record = "fresh"
+	require.NoError(t, buf.Add(context.Background(), stale))
+	require.NoError(t, buf.Add(context.Background(), fresh))
+
+	flusher.Start()
+	defer flusher.Stop()
+
+	// The entry older than the ttl is dropped rather than delivered
+	select {
+	case e := <-flushed:
+		require.Equal(t, "fresh", e.Record)
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out")
+	}
+	select {
+	case e := <-flushed:
+		require.FailNow(t, "flushed an expired entry", e.Record)
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.Equal(t, uint64(1), stats.Snapshot().Dropped)
+}
+
+func TestFlusherMaintenance(t *testing.T) {
+	buildContext := testutil.NewBuildContext(t)
+	buf, err := buffer.NewConfig().Build(buildContext, "testID")
+	require.NoError(t, err)
+	defer buf.Close()
+
+	flushed := make(chan struct{}, 10)
+	flushFunc := func(ctx context.Context, entries []*entry.Entry) error {
+		for i := 0; i < len(entries); i++ {
+			flushed <- struct{}{}
+		}
+		return nil
+	}
+
+	maintenance := helper.NewMaintenance(time.Now().Add(time.Hour), nil)
+
+	flusherCfg := NewConfig()
+	flusherCfg.MaxWait = helper.NewDuration(10 * time.Millisecond)
+	flusher, err := flusherCfg.Build(buf, flushFunc, buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+	flusher.SetMaintenance(maintenance)
+	require.True(t, maintenance.Attached())
+
+	err = buf.Add(context.Background(), entry.New())
+	require.NoError(t, err)
+
+	flusher.Start()
+	defer flusher.Stop()
+
+	select {
+	case <-flushed:
+		require.FailNow(t, "flushed while parked for maintenance")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	maintenance.Resume()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for flush after maintenance")
+	}
+}
+
+func TestFlusherRampUp(t *testing.T) {
+	flusherCfg := NewConfig()
+	flusherCfg.MaxConcurrent = 8
+	flusher, err := flusherCfg.Build(nil, nil, nil)
+	require.NoError(t, err)
+
+	// After maintenance, a single flush may run, and each successful flush
+	// doubles the number of concurrent flushes
+	require.NoError(t, flusher.holdFlushes(context.Background()))
+	require.Equal(t, int64(7), flusher.held)
+	for _, expected := range []int64{6, 4, 0, 0} {
+		flusher.rampUp()
+		require.Equal(t, expected, flusher.held)
+	}
+	require.True(t, flusher.sem.TryAcquire(8))
+}
+
+func TestFlusherReadDeadline(t *testing.T) {
+	base := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		align    bool
+		offset   time.Duration
+		now      time.Time
+		expected time.Time
+	}{
+		{"Unaligned", false, 0, base.Add(30 * time.Second), base.Add(90 * time.Second)},
+		{"Aligned", true, 0, base.Add(30 * time.Second), base.Add(time.Minute)},
+		{"AlignedAtBoundary", true, 0, base.Add(time.Minute), base.Add(2 * time.Minute)},
+		{"AlignedJustAfterBoundary", true, 0, base.Add(time.Nanosecond), base.Add(time.Minute)},
+		{"AlignedWithOffset", true, 5 * time.Second, base.Add(3 * time.Second), base.Add(5 * time.Second)},
+		{"AlignedWithOffsetPassed", true, 5 * time.Second, base.Add(30 * time.Second), base.Add(65 * time.Second)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			flusherCfg := NewConfig()
+			flusherCfg.MaxWait = helper.NewDuration(time.Minute)
+			flusherCfg.AlignToInterval = tc.align
+			flusher, err := flusherCfg.Build(nil, nil, nil)
+			require.NoError(t, err)
+			flusher.alignOffset = tc.offset
+			flusher.now = func() time.Time { return tc.now }
+
+			require.Equal(t, tc.expected, flusher.readDeadline())
+		})
+	}
+}
+
+func TestFlusherBuildInvalidMaxWait(t *testing.T) {
+	for _, maxWait := range []time.Duration{0, -time.Second} {
+		flusherCfg := NewConfig()
+		flusherCfg.MaxWait = helper.NewDuration(maxWait)
+		flusherCfg.AlignToInterval = true
+		_, err := flusherCfg.Build(nil, nil, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "max_wait must be greater than zero")
+	}
+}
+
+func TestNextAlignedFlushNoInterval(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 30, 0, time.UTC)
+	require.Equal(t, now, nextAlignedFlush(now, 0, 0))
+	require.Equal(t, now, nextAlignedFlush(now, -time.Minute, time.Second))
+}
+
+func TestJitterOffset(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	t.Run("Zero", func(t *testing.T) {
+		require.Equal(t, time.Duration(0), jitterOffset(r, 0, time.Minute))
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			require.Less(t, int64(jitterOffset(r, time.Hour, time.Minute)), int64(time.Minute))
+		}
+	})
+
+	t.Run("Uniform", func(t *testing.T) {
+		jitter := 10 * time.Second
+		buckets := make([]int, 10)
+		for i := 0; i < 10000; i++ {
+			offset := jitterOffset(r, jitter, time.Minute)
+			require.True(t, offset >= 0 && offset < jitter)
+			buckets[offset/time.Second]++
+		}
+
+		// Each bucket expects 1000 offsets
+		for _, count := range buckets {
+			require.InDelta(t, 1000, count, 150)
+		}
+	})
+}
+
+func TestFlusherRetryGivesUp(t *testing.T) {
+	buildContext := testutil.NewBuildContext(t)
+	buf, err := buffer.NewConfig().Build(buildContext, "testID")
+	require.NoError(t, err)
+	defer buf.Close()
+
+	attempts := 0
+	flushFunc := func(ctx context.Context, entries []*entry.Entry) error {
+		attempts++
+		return fmt.Errorf("destination unavailable")
+	}
+
+	retryCfg := helper.NewRetryConfig()
+	retryCfg.InitialInterval = helper.NewDuration(time.Millisecond)
+	retryCfg.MaxElapsedTime = helper.NewDuration(50 * time.Millisecond)
+	retrier, err := retryCfg.Build(buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+
+	flusherCfg := NewConfig()
+	flusher, err := flusherCfg.Build(buf, flushFunc, buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+	flusher.SetRetrier(retrier)
+
+	// Entries that are given up on are dropped, so they can be marked flushed
+	err = flusher.FlushNow(context.Background(), []*entry.Entry{entry.New()})
+	require.NoError(t, err)
+	require.Greater(t, attempts, 1)
+	require.Equal(t, uint64(1), retrier.Counters()["retry_failures"])
+}
+
+func TestFlusherStopDuringRetry(t *testing.T) {
+	buildContext := testutil.NewBuildContext(t)
+	buf, err := buffer.NewConfig().Build(buildContext, "testID")
+	require.NoError(t, err)
+	defer buf.Close()
+
+	attempted := make(chan struct{}, 1)
+	flushFunc := func(ctx context.Context, entries []*entry.Entry) error {
+		select {
+		case attempted <- struct{}{}:
+		default:
+		}
+		return fmt.Errorf("destination unavailable")
+	}
+
+	retryCfg := helper.NewRetryConfig()
+	retryCfg.InitialInterval = helper.NewDuration(time.Hour)
+	retryCfg.MaxInterval = helper.NewDuration(time.Hour)
+	retrier, err := retryCfg.Build(buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+
+	flusherCfg := NewConfig()
+	flusherCfg.MaxWait = helper.NewDuration(10 * time.Millisecond)
+	flusher, err := flusherCfg.Build(buf, flushFunc, buildContext.Logger.SugaredLogger)
+	require.NoError(t, err)
+	flusher.SetRetrier(retrier)
+
+	require.NoError(t, buf.Add(context.Background(), entry.New()))
+	flusher.Start()
+
+	select {
+	case <-attempted:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for a flush")
+	}
+
+	// Stop does not wait for the retry
+	stopped := make(chan struct{})
+	go func() {
+		flusher.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.FailNow(t, "flusher did not stop while waiting to retry")
+	}
+}
@@ -0,0 +1,74 @@
+package helper
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BackpressureSampleRate is the number of writes per timed write when
+// back-pressure sampling is enabled.
+const BackpressureSampleRate = 64
+
+// BackpressureReporter is implemented by operators that sample the time spent
+// handing entries off to their outputs.
+type BackpressureReporter interface {
+	BackpressureRatios() map[string]float64
+}
+
+// BackpressureSampler estimates how long a writer spends blocked on each of its
+// outputs. Only one in every BackpressureSampleRate writes is timed, and the
+// result is extrapolated to estimate the total blocked time.
+type BackpressureSampler struct {
+	writes uint64
+	start  time.Time
+	now    func() time.Time
+
+	mux     sync.Mutex
+	blocked map[string]time.Duration
+}
+
+// NewBackpressureSampler creates a new back-pressure sampler.
+func NewBackpressureSampler() *BackpressureSampler {
+	return &BackpressureSampler{
+		start:   time.Now(),
+		now:     time.Now,
+		blocked: make(map[string]time.Duration),
+	}
+}
+
+// ShouldSample returns true if the current write should be timed.
+func (s *BackpressureSampler) ShouldSample() bool {
+	return atomic.AddUint64(&s.writes, 1)%BackpressureSampleRate == 0
+}
+
+// Record records the time a sampled write to an output was blocked.
+func (s *BackpressureSampler) Record(outputID string, d time.Duration) {
+	s.mux.Lock()
+	s.blocked[outputID] += d * BackpressureSampleRate
+	s.mux.Unlock()
+}
+
+// Ratios returns the estimated fraction of time spent blocked on each output
+// since the sampler was created.
+func (s *BackpressureSampler) Ratios() map[string]float64 {
+	elapsed := s.now().Sub(s.start)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	ratios := make(map[string]float64, len(s.blocked))
+	for outputID, blocked := range s.blocked {
+		if elapsed <= 0 {
+			ratios[outputID] = 0
+			continue
+		}
+
+		ratio := float64(blocked) / float64(elapsed)
+		if ratio > 1 {
+			ratio = 1
+		}
+		ratios[outputID] = ratio
+	}
+	return ratios
+}
@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackpressureSamplerShouldSample(t *testing.T) {
+	sampler := NewBackpressureSampler()
+
+	sampled := 0
+	for i := 0; i < BackpressureSampleRate*10; i++ {
+		if sampler.ShouldSample() {
+			sampled++
+		}
+	}
+	require.Equal(t, 10, sampled)
+}
+
+func TestBackpressureSamplerRatios(t *testing.T) {
+	sampler := NewBackpressureSampler()
+	start := sampler.start
+	sampler.now = func() time.Time { return start.Add(BackpressureSampleRate * time.Second) }
+
+	sampler.Record("fast", 100*time.Millisecond)
+	sampler.Record("slow", 500*time.Millisecond)
+	sampler.Record("stuck", 2*time.Second)
+
+	ratios := sampler.Ratios()
+	require.InDelta(t, 0.1, ratios["fast"], 0.0001)
+	require.InDelta(t, 0.5, ratios["slow"], 0.0001)
+	require.Equal(t, 1.0, ratios["stuck"])
+}
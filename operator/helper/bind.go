@@ -0,0 +1,9 @@
+package helper
+
+// Binder is implemented by operators that listen on network addresses. Bind
+// opens the listeners of the operator before the pipeline starts, such as
+// while the agent still has the privileges to bind to ports below 1024.
+// Start uses listeners that are already bound, and binds them otherwise.
+type Binder interface {
+	Bind() error
+}
@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/observiq/stanza/entry"
+)
+
+// Catcher is implemented by the catch operator of a pipeline, which receives
+// the entries that other operators fail to process and would otherwise drop.
+// Catch returns false if the entry was not accepted because it already failed
+// once and is being processed by the catch chain, in which case it is dropped.
+type Catcher interface {
+	Catch(ctx context.Context, e *entry.Entry, operatorID string, err error) bool
+}
+
+// Catchable is implemented by operators that send the entries they fail to
+// process to the catch operator of their pipeline
+type Catchable interface {
+	SetCatcher(Catcher)
+}
+
+type caughtKey struct{}
+
+// WithCaught returns a context for processing an entry in the catch chain
+func WithCaught(ctx context.Context) context.Context {
+	return context.WithValue(ctx, caughtKey{}, true)
+}
+
+// IsCaught returns true if an entry is being processed by the catch chain
+// after it failed once
+func IsCaught(ctx context.Context) bool {
+	caught, _ := ctx.Value(caughtKey{}).(bool)
+	return caught
+}
+
+// recoverTransform calls a transform function, returning a panic in the
+// function as an error
+func recoverTransform(e *entry.Entry, transform TransformFunction) (newEntry *entry.Entry, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			newEntry, err = nil, fmt.Errorf("recovered from panic: %v", r)
+		}
+	}()
+	return transform(e)
+}
+
+// recoverParse calls a parse function, returning a panic in the function as
+// an error
+func recoverParse(value interface{}, parse ParseFunction) (newValue interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			newValue, err = nil, fmt.Errorf("recovered from panic: %v", r)
+		}
+	}()
+	return parse(value)
+}
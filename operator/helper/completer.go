@@ -0,0 +1,9 @@
+package helper
+
+// Completer is implemented by operators that finish their work, such as file
+// inputs that backfill a set of files. Completed returns a channel that is
+// closed once the operator has finished, or nil if the agent should keep
+// running once the operator has finished.
+type Completer interface {
+	Completed() <-chan struct{}
+}
@@ -0,0 +1,156 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/observiq/stanza/errors"
+)
+
+// Supported compression codecs
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// NewCompressionConfig creates a new compression config with the given codec
+// and its default level
+func NewCompressionConfig(codec string) CompressionConfig {
+	return CompressionConfig{
+		Codec: codec,
+	}
+}
+
+// CompressionConfig is the configuration of the codec used by an output to
+// compress batches of entries.
+type CompressionConfig struct {
+	Codec string `json:"codec,omitempty" yaml:"codec,omitempty"`
+	Level int    `json:"level,omitempty" yaml:"level,omitempty"`
+}
+
+// Build will build a compressor from the config.
+func (c CompressionConfig) Build() (*Compressor, error) {
+	switch c.Codec {
+	case "", CompressionNone:
+		if c.Level != 0 {
+			return nil, levelError(c.Codec, "the none codec does not have levels")
+		}
+		return &Compressor{codec: CompressionNone}, nil
+	case CompressionGzip:
+		if c.Level < 0 || c.Level > gzip.BestCompression {
+			return nil, levelError(c.Codec, "use a level between 1 and 9, or 0 for the default")
+		}
+		level := c.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return &Compressor{codec: c.Codec, level: level}, nil
+	case CompressionZstd:
+		if c.Level < 0 || c.Level > 22 {
+			return nil, levelError(c.Codec, "use a level between 1 and 22, or 0 for the default")
+		}
+		level := zstd.SpeedDefault
+		if c.Level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.Level)
+		}
+		// A single encoder is shared by all batches, since creating one is expensive
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, errors.Wrap(err, "create zstd encoder")
+		}
+		return &Compressor{codec: c.Codec, level: int(level), zstd: encoder}, nil
+	case CompressionSnappy:
+		if c.Level != 0 {
+			return nil, levelError(c.Codec, "the snappy codec does not have levels")
+		}
+		return &Compressor{codec: c.Codec}, nil
+	default:
+		return nil, errors.NewError(
+			fmt.Sprintf("unsupported compression codec '%s'", c.Codec),
+			"use one of 'none', 'gzip', 'zstd', or 'snappy'",
+		)
+	}
+}
+
+// levelError returns an error for an invalid compression level.
+func levelError(codec, suggestion string) error {
+	return errors.NewError(
+		fmt.Sprintf("invalid compression level for codec '%s'", codec),
+		suggestion,
+	)
+}
+
+// Compressor compresses data with a configured codec and level.
+type Compressor struct {
+	codec string
+	level int
+	zstd  *zstd.Encoder
+}
+
+// Codec returns the name of the codec used by the compressor.
+func (c *Compressor) Codec() string {
+	return c.codec
+}
+
+// ContentEncoding returns the HTTP Content-Encoding of data compressed by the
+// compressor. It returns an empty string if the data is not compressed.
+func (c *Compressor) ContentEncoding() string {
+	if c.codec == CompressionNone {
+		return ""
+	}
+	return c.codec
+}
+
+// NewWriter returns a writer that compresses data written to it into w. The
+// writer must be closed to write any buffered data and the end of the stream.
+func (c *Compressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.codec {
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, c.level)
+	case CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevel(c.level)))
+	case CompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// Compress returns the compressed form of a batch of data.
+func (c *Compressor) Compress(data []byte) ([]byte, error) {
+	switch c.codec {
+	case CompressionNone:
+		return data, nil
+	case CompressionZstd:
+		return c.zstd.EncodeAll(data, make([]byte, 0, len(data)/4)), nil
+	}
+
+	var buf bytes.Buffer
+	wr, err := c.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := wr.Write(data); err != nil {
+		return nil, err
+	}
+	if err := wr.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// nopWriteCloser is a writer with a Close method that does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
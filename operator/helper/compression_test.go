@@ -0,0 +1,180 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func decompress(t testing.TB, codec string, data []byte) []byte {
+	var rd io.Reader
+	switch codec {
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		rd = gzipReader
+	case CompressionZstd:
+		zstdReader, err := zstd.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer zstdReader.Close()
+		rd = zstdReader
+	case CompressionSnappy:
+		rd = snappy.NewReader(bytes.NewReader(data))
+	default:
+		rd = bytes.NewReader(data)
+	}
+
+	decompressed, err := ioutil.ReadAll(rd)
+	require.NoError(t, err)
+	return decompressed
+}
+
+func TestCompressionConfigBuild(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      CompressionConfig
+		expectedErr string
+	}{
+		{"Default", CompressionConfig{}, ""},
+		{"None", NewCompressionConfig(CompressionNone), ""},
+		{"Gzip", NewCompressionConfig(CompressionGzip), ""},
+		{"GzipLevel", CompressionConfig{Codec: CompressionGzip, Level: 9}, ""},
+		{"GzipBadLevel", CompressionConfig{Codec: CompressionGzip, Level: 10}, "invalid compression level"},
+		{"Zstd", NewCompressionConfig(CompressionZstd), ""},
+		{"ZstdLevel", CompressionConfig{Codec: CompressionZstd, Level: 19}, ""},
+		{"ZstdBadLevel", CompressionConfig{Codec: CompressionZstd, Level: -1}, "invalid compression level"},
+		{"Snappy", NewCompressionConfig(CompressionSnappy), ""},
+		{"SnappyLevel", CompressionConfig{Codec: CompressionSnappy, Level: 1}, "invalid compression level"},
+		{"NoneLevel", CompressionConfig{Codec: CompressionNone, Level: 1}, "invalid compression level"},
+		{"Unknown", NewCompressionConfig("lz4"), "unsupported compression codec"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			compressor, err := tc.config.Build()
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, compressor)
+		})
+	}
+}
+
+func TestCompressorRoundTrip(t *testing.T) {
+	corpus := logCorpus(1000)
+	for _, codec := range []string{CompressionNone, CompressionGzip, CompressionZstd, CompressionSnappy} {
+		t.Run(codec, func(t *testing.T) {
+			compressor, err := NewCompressionConfig(codec).Build()
+			require.NoError(t, err)
+
+			compressed, err := compressor.Compress(corpus)
+			require.NoError(t, err)
+			if codec != CompressionNone {
+				require.Less(t, len(compressed), len(corpus))
+			}
+			require.Equal(t, corpus, decompress(t, codec, compressed))
+		})
+	}
+}
+
+func TestCompressorContentEncoding(t *testing.T) {
+	cases := []struct {
+		codec    string
+		expected string
+	}{
+		{CompressionNone, ""},
+		{CompressionGzip, "gzip"},
+		{CompressionZstd, "zstd"},
+		{CompressionSnappy, "snappy"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.codec, func(t *testing.T) {
+			compressor, err := NewCompressionConfig(tc.codec).Build()
+			require.NoError(t, err)
+			require.Equal(t, tc.codec, compressor.Codec())
+			require.Equal(t, tc.expected, compressor.ContentEncoding())
+		})
+	}
+}
+
+// logCorpus generates a representative mix of syslog, access log, and JSON
+// application log lines
+func logCorpus(lines int) []byte {
+	r := rand.New(rand.NewSource(1))
+	hosts := []string{"web-01", "web-02", "db-01", "cache-01"}
+	paths := []string{"/", "/api/v1/users", "/api/v1/orders", "/static/app.js", "/healthz"}
+	levels := []string{"debug", "info", "info", "info", "warn", "error"}
+	timestamp := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	for i := 0; i < lines; i++ {
+		timestamp = timestamp.Add(time.Duration(r.Intn(1000)) * time.Millisecond)
+		host := hosts[r.Intn(len(hosts))]
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&buf, "<%d>%s %s sshd[%d]: Accepted publickey for user%d from 10.0.%d.%d port %d ssh2\n",
+				r.Intn(191), timestamp.Format(time.Stamp), host, r.Intn(65535), r.Intn(50), r.Intn(256), r.Intn(256), 1024+r.Intn(60000))
+		case 1:
+			fmt.Fprintf(&buf, "10.0.%d.%d - - [%s] \"GET %s HTTP/1.1\" %d %d \"-\" \"Mozilla/5.0\"\n",
+				r.Intn(256), r.Intn(256), timestamp.Format("02/Jan/2006:15:04:05 -0700"), paths[r.Intn(len(paths))], 200+r.Intn(4)*100, r.Intn(100000))
+		default:
+			fmt.Fprintf(&buf, `{"ts":"%s","level":"%s","host":"%s","msg":"request completed","duration_ms":%d,"request_id":"%016x"}`+"\n",
+				timestamp.Format(time.RFC3339Nano), levels[r.Intn(len(levels))], host, r.Intn(5000), r.Uint64())
+		}
+	}
+	return buf.Bytes()
+}
+
+func benchmarkCompressor(b *testing.B, config CompressionConfig) {
+	corpus := logCorpus(10000)
+	compressor, err := config.Build()
+	require.NoError(b, err)
+
+	var compressed []byte
+	b.SetBytes(int64(len(corpus)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compressed, err = compressor.Compress(corpus)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(corpus))/float64(len(compressed)), "ratio")
+}
+
+func BenchmarkCompressorGzipDefault(b *testing.B) {
+	benchmarkCompressor(b, NewCompressionConfig(CompressionGzip))
+}
+
+func BenchmarkCompressorGzipFastest(b *testing.B) {
+	benchmarkCompressor(b, CompressionConfig{Codec: CompressionGzip, Level: gzip.BestSpeed})
+}
+
+func BenchmarkCompressorZstdDefault(b *testing.B) {
+	benchmarkCompressor(b, NewCompressionConfig(CompressionZstd))
+}
+
+func BenchmarkCompressorZstdFastest(b *testing.B) {
+	benchmarkCompressor(b, CompressionConfig{Codec: CompressionZstd, Level: 1})
+}
+
+func BenchmarkCompressorZstdBest(b *testing.B) {
+	benchmarkCompressor(b, CompressionConfig{Codec: CompressionZstd, Level: 19})
+}
+
+func BenchmarkCompressorSnappy(b *testing.B) {
+	benchmarkCompressor(b, NewCompressionConfig(CompressionSnappy))
+}
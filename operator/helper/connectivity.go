@@ -0,0 +1,12 @@
+package helper
+
+import "context"
+
+// ConnectivityChecker is implemented by outputs that can check that they
+// reach their destination without starting or sending any entries, such as
+// with a TLS handshake or an authenticated ping. ConnectivityCheck must be
+// safe to call on an operator that was built but not started, and returns an
+// error if the destination cannot be reached or refuses the credentials.
+type ConnectivityChecker interface {
+	ConnectivityCheck(ctx context.Context) error
+}
@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// MaxDebugSample is the maximum number of entries per minute that an
+	// operator logs with debug_sample
+	MaxDebugSample = 60
+
+	// maxDebugSampleSize is the maximum size in bytes of a logged entry.
+	// Longer renderings are truncated.
+	maxDebugSampleSize = 4096
+
+	// redacted replaces the values of fields that may hold secrets
+	redacted = "[REDACTED]"
+)
+
+// secretKeys are substrings of field names whose values are redacted from sampled entries
+var secretKeys = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "authorization", "credential", "private_key"}
+
+// ValidateDebugSample checks that a debug sample rate is within its limits
+func ValidateDebugSample(rate int) error {
+	if rate < 0 || rate > MaxDebugSample {
+		return fmt.Errorf("debug_sample must be between 0 and %d", MaxDebugSample)
+	}
+	return nil
+}
+
+// DebugSampler logs a sample of the entries written by an operator at the
+// debug level, up to a number of entries per minute. Entries are only rendered
+// while debug logs are enabled for the operator, so a sampler costs little
+// until the level of the operator is lowered to debug.
+type DebugSampler struct {
+	configured int64
+	rate       int64
+	logger     *zap.SugaredLogger
+	core       zapcore.Core
+
+	mux         sync.Mutex
+	windowStart time.Time
+	count       int64
+	now         func() time.Time
+}
+
+// NewDebugSampler creates a sampler that logs up to rate entries per minute with logger
+func NewDebugSampler(rate int, logger *zap.SugaredLogger) *DebugSampler {
+	return &DebugSampler{
+		configured: int64(rate),
+		rate:       int64(rate),
+		logger:     logger,
+		core:       logger.Desugar().Core(),
+		now:        time.Now,
+	}
+}
+
+// DebugSampleReporter is implemented by operators that can log a sample of their entries
+type DebugSampleReporter interface {
+	DebugSample() *DebugSampler
+}
+
+// Rate returns the number of entries logged per minute
+func (s *DebugSampler) Rate() int {
+	return int(atomic.LoadInt64(&s.rate))
+}
+
+// SetRate changes the number of entries logged per minute
+func (s *DebugSampler) SetRate(rate int) error {
+	if err := ValidateDebugSample(rate); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&s.rate, int64(rate))
+	return nil
+}
+
+// Reset returns the sampler to its configured rate
+func (s *DebugSampler) Reset() {
+	atomic.StoreInt64(&s.rate, s.configured)
+}
+
+// Sample logs an entry if the rate allows it and debug logs are enabled
+func (s *DebugSampler) Sample(e *entry.Entry) {
+	rate := atomic.LoadInt64(&s.rate)
+	if rate == 0 || !s.core.Enabled(zap.DebugLevel) || !s.take(rate) {
+		return
+	}
+	s.logger.Debugw("Sampled entry", "entry", renderSample(e))
+}
+
+// take returns true if another entry can be logged in the current minute
+func (s *DebugSampler) take(rate int64) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.count = 0
+	}
+	if s.count >= rate {
+		return false
+	}
+	s.count++
+	return true
+}
+
+// renderSample renders an entry as JSON, with the values of fields that may
+// hold secrets redacted, truncated to maxDebugSampleSize
+func renderSample(e *entry.Entry) string {
+	sample := e.Copy()
+	sample.Record = redact(sample.Record)
+	for k := range sample.Labels {
+		if isSecretKey(k) {
+			sample.AddLabel(k, redacted)
+		}
+	}
+
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Sprintf("failed to render entry: %s", err)
+	}
+	if len(data) > maxDebugSampleSize {
+		return string(data[:maxDebugSampleSize]) + "...(truncated)"
+	}
+	return string(data)
+}
+
+// redact replaces the values of map keys that may hold secrets
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if isSecretKey(k) {
+				v[k] = redacted
+				continue
+			}
+			v[k] = redact(child)
+		}
+		return v
+	case map[string]string:
+		for k := range v {
+			if isSecretKey(k) {
+				v[k] = redacted
+			}
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redact(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// isSecretKey returns true if a field name suggests that its value is a secret
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
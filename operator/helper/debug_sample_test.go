@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/logger"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDebugSamplerRate(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	now := time.Now()
+	sampler := NewDebugSampler(2, logger)
+	sampler.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		sampler.Sample(entry.New())
+	}
+	require.Equal(t, 2, logs.Len())
+
+	// The budget is renewed every minute
+	now = now.Add(time.Minute)
+	for i := 0; i < 5; i++ {
+		sampler.Sample(entry.New())
+	}
+	require.Equal(t, 4, logs.Len())
+
+	// A rate of zero turns sampling off
+	require.NoError(t, sampler.SetRate(0))
+	now = now.Add(time.Minute)
+	sampler.Sample(entry.New())
+	require.Equal(t, 4, logs.Len())
+
+	require.Error(t, sampler.SetRate(MaxDebugSample+1))
+	sampler.Reset()
+	require.Equal(t, 2, sampler.Rate())
+}
+
+func TestDebugSamplerRequiresDebug(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	sampler := NewDebugSampler(10, zap.New(core).Sugar())
+	sampler.Sample(entry.New())
+	require.Equal(t, 0, logs.Len())
+}
+
+func TestRenderSample(t *testing.T) {
+	e := entry.New()
+	e.Labels = map[string]string{"env": "prod", "api_token": "abc"}
+	e.Record = map[string]interface{}{
+		"message": "login",
+		"user": map[string]interface{}{
+			"name":     "admin",
+			"Password": "hunter2",
+		},
+		"headers": []interface{}{map[string]interface{}{"Authorization": "Bearer abc"}},
+	}
+
+	rendered := renderSample(e)
+	require.NotContains(t, rendered, "hunter2")
+	require.NotContains(t, rendered, "abc")
+	require.Contains(t, rendered, `"name":"admin"`)
+	require.Contains(t, rendered, `"env":"prod"`)
+
+	// The entry itself is not redacted
+	require.Equal(t, "hunter2", e.Record.(map[string]interface{})["user"].(map[string]interface{})["Password"])
+	require.Equal(t, "abc", e.Labels["api_token"])
+
+	e.Record = strings.Repeat("a", 2*maxDebugSampleSize)
+	rendered = renderSample(e)
+	require.True(t, strings.HasSuffix(rendered, "...(truncated)"))
+	require.Len(t, rendered, maxDebugSampleSize+len("...(truncated)"))
+}
+
+func TestWriterDebugSample(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	bc := testutil.NewBuildContext(t)
+	bc.Logger = logger.New(zap.New(core).Sugar())
+
+	cfg := NewWriterConfig("test", "test")
+	cfg.DebugSample = 10
+	writer, err := cfg.Build(bc)
+	require.NoError(t, err)
+	writer.OutputOperators = []operator.Operator{testutil.NewFakeOutput(t)}
+
+	// Sampled entries are logged once the operator logs at the debug level
+	writer.Write(context.Background(), entry.New())
+	require.Equal(t, 0, logs.Len())
+
+	writer.OperatorLogLevel().Set(zapcore.DebugLevel)
+	writer.Write(context.Background(), entry.New())
+	require.Equal(t, 1, logs.FilterMessage("Sampled entry").Len())
+
+	writer.OperatorLogLevel().Reset()
+	writer.Write(context.Background(), entry.New())
+	require.Equal(t, 1, logs.Len())
+
+	// Sampling can be turned on for an operator that does not set debug_sample
+	cfg.DebugSample = 0
+	writer, err = cfg.Build(bc)
+	require.NoError(t, err)
+	writer.OutputOperators = []operator.Operator{testutil.NewFakeOutput(t)}
+	writer.OperatorLogLevel().Set(zapcore.DebugLevel)
+	require.Equal(t, 0, writer.DebugSample().Rate())
+	writer.Write(context.Background(), entry.New())
+	require.Equal(t, 1, logs.FilterMessage("Sampled entry").Len())
+
+	require.NoError(t, writer.DebugSample().SetRate(10))
+	writer.Write(context.Background(), entry.New())
+	require.Equal(t, 2, logs.FilterMessage("Sampled entry").Len())
+
+	cfg.DebugSample = MaxDebugSample + 1
+	_, err = cfg.Build(bc)
+	require.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package helper
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+)
+
+// DeliveryWindowConfig is the configuration of a window of time during which
+// an output delivers buffered entries.
+type DeliveryWindowConfig struct {
+	Start          string `json:"start"                     yaml:"start"`
+	End            string `json:"end"                       yaml:"end"`
+	Timezone       string `json:"timezone,omitempty"        yaml:"timezone,omitempty"`
+	BypassSeverity string `json:"bypass_severity,omitempty" yaml:"bypass_severity,omitempty"`
+
+	// TTL is the age beyond which a buffered entry is dropped rather than
+	// delivered once the window opens. Entries never expire if it is zero.
+	TTL Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+}
+
+// Build will build a delivery window from the config.
+func (c *DeliveryWindowConfig) Build() (*DeliveryWindow, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	start, err := parseTimeOfDay(c.Start)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse delivery_window start")
+	}
+
+	end, err := parseTimeOfDay(c.End)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse delivery_window end")
+	}
+
+	if start == end {
+		return nil, errors.NewError(
+			"delivery_window start and end must differ",
+			"remove the delivery_window to deliver entries at all times",
+		)
+	}
+
+	location := time.Local
+	if c.Timezone != "" {
+		location, err = LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, errors.Wrap(err, "load delivery_window timezone")
+		}
+	}
+
+	bypass := entry.Severity(-1)
+	if c.BypassSeverity != "" {
+		bypass, err = parseSeverityThreshold(c.BypassSeverity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.TTL.Raw() < 0 {
+		return nil, errors.NewError(
+			fmt.Sprintf("invalid delivery_window ttl '%s'", c.TTL.Raw()),
+			"set ttl to a positive duration, or remove it so that entries never expire",
+		)
+	}
+
+	return &DeliveryWindow{
+		start:          start,
+		end:            end,
+		location:       location,
+		bypassSeverity: bypass,
+		ttl:            c.TTL.Raw(),
+		now:            time.Now,
+	}, nil
+}
+
+// DeliveryWindow is a daily window of time during which an output delivers
+// buffered entries. Entries at or above the bypass severity are delivered
+// immediately, even when the window is closed, and buffered entries older
+// than the ttl are dropped when they are read from the buffer.
+type DeliveryWindow struct {
+	start          time.Duration
+	end            time.Duration
+	location       *time.Location
+	bypassSeverity entry.Severity
+	ttl            time.Duration
+	now            func() time.Time
+}
+
+// IsOpen returns true if the window is currently open. A nil window is always open.
+func (w *DeliveryWindow) IsOpen() bool {
+	if w == nil {
+		return true
+	}
+	return w.isOpenAt(w.now())
+}
+
+// Bypass returns true if the entry should skip the buffer and be delivered
+// immediately because the window is closed and the entry is severe enough.
+func (w *DeliveryWindow) Bypass(e *entry.Entry) bool {
+	if w == nil || w.bypassSeverity < 0 {
+		return false
+	}
+	return e.Severity >= w.bypassSeverity && !w.IsOpen()
+}
+
+// Expired returns true if an entry is older than the ttl of the window, and
+// should be dropped rather than delivered. The age of an entry is measured
+// from its timestamp. Entries never expire in a nil window or without a ttl.
+func (w *DeliveryWindow) Expired(e *entry.Entry) bool {
+	if w == nil || w.ttl <= 0 {
+		return false
+	}
+	return w.now().Sub(e.Timestamp) > w.ttl
+}
+
+// UntilOpen returns the amount of time until the window next opens. It
+// returns zero if the window is currently open.
+func (w *DeliveryWindow) UntilOpen() time.Duration {
+	if w == nil {
+		return 0
+	}
+
+	now := w.now().In(w.location)
+	if w.isOpenAt(now) {
+		return 0
+	}
+
+	offset := sinceMidnight(now)
+	if offset < w.start {
+		return w.start - offset
+	}
+	return 24*time.Hour - offset + w.start
+}
+
+// isOpenAt returns true if the window is open at the given time.
+func (w *DeliveryWindow) isOpenAt(t time.Time) bool {
+	offset := sinceMidnight(t.In(w.location))
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+
+	// The window wraps around midnight
+	return offset >= w.start || offset < w.end
+}
+
+// sinceMidnight returns the time elapsed since midnight on the day of t.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+// parseTimeOfDay parses a time of day in the format HH:MM.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time of day '%s' must be in the format HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseSeverityThreshold parses a severity name or number.
+func parseSeverityThreshold(value string) (entry.Severity, error) {
+	if severity, ok := getBuiltinMapping("default")[value]; ok {
+		return severity, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < minSeverity || number > maxSeverity {
+		return 0, errors.NewError(
+			fmt.Sprintf("invalid severity '%s'", value),
+			"use a severity name such as 'error' or a number between 0 and 100",
+		)
+	}
+	return entry.Severity(number), nil
+}
@@ -0,0 +1,131 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryWindowConfigBuild(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      *DeliveryWindowConfig
+		expectedErr string
+	}{
+		{"Nil", nil, ""},
+		{"Valid", &DeliveryWindowConfig{Start: "00:00", End: "06:00"}, ""},
+		{"ValidBypass", &DeliveryWindowConfig{Start: "00:00", End: "06:00", BypassSeverity: "error"}, ""},
+		{"ValidBypassNumber", &DeliveryWindowConfig{Start: "00:00", End: "06:00", BypassSeverity: "55"}, ""},
+		{"ValidTimezone", &DeliveryWindowConfig{Start: "00:00", End: "06:00", Timezone: "UTC"}, ""},
+		{"InvalidStart", &DeliveryWindowConfig{Start: "0:00am", End: "06:00"}, "parse delivery_window start"},
+		{"InvalidEnd", &DeliveryWindowConfig{Start: "00:00", End: "25:00"}, "parse delivery_window end"},
+		{"Empty", &DeliveryWindowConfig{Start: "06:00", End: "06:00"}, "start and end must differ"},
+		{"InvalidTimezone", &DeliveryWindowConfig{Start: "00:00", End: "06:00", Timezone: "Mars/Olympus"}, "load delivery_window timezone"},
+		{"InvalidBypass", &DeliveryWindowConfig{Start: "00:00", End: "06:00", BypassSeverity: "loud"}, "invalid severity"},
+		{"ValidTTL", &DeliveryWindowConfig{Start: "00:00", End: "06:00", TTL: NewDuration(24 * time.Hour)}, ""},
+		{"NegativeTTL", &DeliveryWindowConfig{Start: "00:00", End: "06:00", TTL: NewDuration(-time.Hour)}, "invalid delivery_window ttl"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			window, err := tc.config.Build()
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			if tc.config == nil {
+				require.Nil(t, window)
+			}
+		})
+	}
+}
+
+func TestDeliveryWindow(t *testing.T) {
+	cases := []struct {
+		name      string
+		start     string
+		end       string
+		now       string
+		open      bool
+		untilOpen time.Duration
+	}{
+		{"BeforeOpen", "00:00", "06:00", "23:30", false, 30 * time.Minute},
+		{"Open", "00:00", "06:00", "03:00", true, 0},
+		{"AtStart", "00:00", "06:00", "00:00", true, 0},
+		{"AtEnd", "00:00", "06:00", "06:00", false, 18 * time.Hour},
+		{"WrappedOpenLate", "22:00", "02:00", "23:00", true, 0},
+		{"WrappedOpenEarly", "22:00", "02:00", "01:00", true, 0},
+		{"WrappedClosed", "22:00", "02:00", "12:00", false, 10 * time.Hour},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &DeliveryWindowConfig{Start: tc.start, End: tc.end, Timezone: "UTC"}
+			window, err := config.Build()
+			require.NoError(t, err)
+
+			now, err := time.Parse("15:04", tc.now)
+			require.NoError(t, err)
+			window.now = func() time.Time { return now }
+
+			require.Equal(t, tc.open, window.IsOpen())
+			require.Equal(t, tc.untilOpen, window.UntilOpen())
+		})
+	}
+}
+
+func TestDeliveryWindowBypass(t *testing.T) {
+	config := &DeliveryWindowConfig{Start: "00:00", End: "06:00", Timezone: "UTC", BypassSeverity: "error"}
+	window, err := config.Build()
+	require.NoError(t, err)
+
+	info := entry.New()
+	info.Severity = entry.Info
+	errorEntry := entry.New()
+	errorEntry.Severity = entry.Error
+
+	closed, _ := time.Parse("15:04", "12:00")
+	window.now = func() time.Time { return closed }
+	require.False(t, window.Bypass(info))
+	require.True(t, window.Bypass(errorEntry))
+
+	open, _ := time.Parse("15:04", "03:00")
+	window.now = func() time.Time { return open }
+	require.False(t, window.Bypass(info))
+	require.False(t, window.Bypass(errorEntry))
+}
+
+func TestDeliveryWindowExpired(t *testing.T) {
+	config := &DeliveryWindowConfig{Start: "00:00", End: "06:00", Timezone: "UTC", TTL: NewDuration(12 * time.Hour)}
+	window, err := config.Build()
+	require.NoError(t, err)
+
+	now, _ := time.Parse("15:04", "03:00")
+	window.now = func() time.Time { return now }
+
+	fresh := entry.New()
+	fresh.Timestamp = now.Add(-time.Hour)
+	stale := entry.New()
+	stale.Timestamp = now.Add(-13 * time.Hour)
+	require.False(t, window.Expired(fresh))
+	require.True(t, window.Expired(stale))
+
+	// Entries never expire without a ttl
+	config.TTL = Duration{}
+	window, err = config.Build()
+	require.NoError(t, err)
+	window.now = func() time.Time { return now }
+	require.False(t, window.Expired(stale))
+}
+
+func TestDeliveryWindowNil(t *testing.T) {
+	var window *DeliveryWindow
+	require.True(t, window.IsOpen())
+	require.False(t, window.Bypass(entry.New()))
+	require.False(t, window.Expired(entry.New()))
+	require.Equal(t, time.Duration(0), window.UntilOpen())
+}
@@ -0,0 +1,104 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+)
+
+// severityLiterals are the severity names available to every expression,
+// mapped to their numeric values
+var severityLiterals = func() map[string]int {
+	literals := make(map[string]int)
+	for name, severity := range getBuiltinMapping("default") {
+		literals[name] = int(severity)
+	}
+	return literals
+}()
+
+var severityLevelName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SeverityExprConfig is the configuration of how severity is exposed to the
+// expressions of an operator.
+type SeverityExprConfig struct {
+	UnsetSeverity  string         `json:"unset_severity,omitempty"  yaml:"unset_severity,omitempty"`
+	SeverityLevels map[string]int `json:"severity_levels,omitempty" yaml:"severity_levels,omitempty"`
+}
+
+// Build will build a severity expression environment from the config.
+func (c SeverityExprConfig) Build() (*SeverityExpr, error) {
+	for name, level := range c.SeverityLevels {
+		if !severityLevelName.MatchString(name) || name == "env" {
+			return nil, errors.NewError(
+				fmt.Sprintf("invalid severity level name '%s'", name),
+				"use a name other than 'env' made of letters, digits, and underscores that does not start with a digit",
+			)
+		}
+		if level < minSeverity || level > maxSeverity {
+			return nil, errors.NewError(
+				fmt.Sprintf("invalid value %d for severity level '%s'", level, name),
+				fmt.Sprintf("use a number between %d and %d", minSeverity, maxSeverity),
+			)
+		}
+	}
+
+	unset := int(entry.Default)
+	if c.UnsetSeverity != "" {
+		if level, ok := c.SeverityLevels[c.UnsetSeverity]; ok {
+			unset = level
+		} else {
+			severity, err := parseSeverityThreshold(c.UnsetSeverity)
+			if err != nil {
+				return nil, errors.Wrap(err, "parse unset_severity")
+			}
+			unset = int(severity)
+		}
+	}
+
+	return &SeverityExpr{
+		levels: c.SeverityLevels,
+		unset:  unset,
+	}, nil
+}
+
+// SeverityExpr provides expression environments in which the severity of an
+// entry can be compared with severity names, such as `$severity >= error`.
+type SeverityExpr struct {
+	levels map[string]int
+	unset  int
+}
+
+// GetExprEnv returns an environment for evaluating an expression against the
+// entry. Entries without a severity are given the configured unset severity.
+// The environment must be returned with PutExprEnv.
+func (s *SeverityExpr) GetExprEnv(e *entry.Entry) map[string]interface{} {
+	env := GetExprEnv(e)
+	if s == nil {
+		return env
+	}
+
+	if e.Severity == entry.Default {
+		env["$severity"] = s.unset
+	}
+	for name, level := range s.levels {
+		env[name] = level
+	}
+	return env
+}
+
+// PutExprEnv returns an environment to the pool, restoring any severity
+// levels that were overridden by the operator.
+func (s *SeverityExpr) PutExprEnv(env map[string]interface{}) {
+	if s != nil {
+		for name := range s.levels {
+			if level, ok := severityLiterals[name]; ok {
+				env[name] = level
+			} else {
+				delete(env, name)
+			}
+		}
+	}
+	PutExprEnv(env)
+}
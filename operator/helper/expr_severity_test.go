@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/observiq/stanza/entry"
+	"github.com/stretchr/testify/require"
+)
+
+func runSeverityExpr(t *testing.T, s *SeverityExpr, expression string, e *entry.Entry) bool {
+	program, err := expr.Compile(expression, expr.AsBool(), expr.AllowUndefinedVariables())
+	require.NoError(t, err)
+
+	env := s.GetExprEnv(e)
+	defer s.PutExprEnv(env)
+
+	result, err := vm.Run(program, env)
+	require.NoError(t, err)
+	return result.(bool)
+}
+
+func TestSeverityLiterals(t *testing.T) {
+	for name, severity := range getBuiltinMapping("default") {
+		t.Run(name, func(t *testing.T) {
+			e := entry.New()
+			e.Severity = severity
+
+			require.True(t, runSeverityExpr(t, nil, "$severity == "+name, e))
+			require.True(t, runSeverityExpr(t, nil, "$severity >= "+name, e))
+			require.False(t, runSeverityExpr(t, nil, "$severity > "+name, e))
+
+			e.Severity = severity + 1
+			require.True(t, runSeverityExpr(t, nil, "$severity > "+name, e))
+		})
+	}
+}
+
+func TestSeverityExprConfigBuild(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      SeverityExprConfig
+		expectedErr string
+	}{
+		{"Default", SeverityExprConfig{}, ""},
+		{"UnsetName", SeverityExprConfig{UnsetSeverity: "trace"}, ""},
+		{"UnsetNumber", SeverityExprConfig{UnsetSeverity: "15"}, ""},
+		{"UnsetCustom", SeverityExprConfig{UnsetSeverity: "noisy", SeverityLevels: map[string]int{"noisy": 25}}, ""},
+		{"UnsetInvalid", SeverityExprConfig{UnsetSeverity: "loud"}, "invalid severity"},
+		{"LevelOutOfRange", SeverityExprConfig{SeverityLevels: map[string]int{"noisy": 101}}, "invalid value"},
+		{"LevelBadName", SeverityExprConfig{SeverityLevels: map[string]int{"1noisy": 25}}, "invalid severity level name"},
+		{"LevelReservedName", SeverityExprConfig{SeverityLevels: map[string]int{"env": 25}}, "invalid severity level name"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.config.Build()
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSeverityExprUnset(t *testing.T) {
+	cases := []struct {
+		unset    string
+		expected int
+	}{
+		{"", int(entry.Default)},
+		{"default", int(entry.Default)},
+		{"trace", int(entry.Trace)},
+		{"45", 45},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.unset, func(t *testing.T) {
+			s, err := SeverityExprConfig{UnsetSeverity: tc.unset}.Build()
+			require.NoError(t, err)
+
+			env := s.GetExprEnv(entry.New())
+			defer s.PutExprEnv(env)
+			require.Equal(t, tc.expected, env["$severity"])
+		})
+	}
+
+	t.Run("SetSeverityUnchanged", func(t *testing.T) {
+		s, err := SeverityExprConfig{UnsetSeverity: "trace"}.Build()
+		require.NoError(t, err)
+
+		e := entry.New()
+		e.Severity = entry.Info
+		require.True(t, runSeverityExpr(t, s, "$severity == info", e))
+	})
+}
+
+func TestSeverityExprCustomLevels(t *testing.T) {
+	s, err := SeverityExprConfig{
+		SeverityLevels: map[string]int{
+			"noisy":   25,
+			"warning": 55,
+		},
+	}.Build()
+	require.NoError(t, err)
+
+	e := entry.New()
+	e.Severity = 55
+	require.True(t, runSeverityExpr(t, s, "$severity > noisy", e))
+	require.True(t, runSeverityExpr(t, s, "$severity == warning", e))
+	require.True(t, runSeverityExpr(t, s, "$severity > warn", e))
+
+	// Returned environments do not keep the custom levels
+	env := GetExprEnv(e)
+	defer PutExprEnv(env)
+	require.NotContains(t, env, "noisy")
+	require.Equal(t, int(entry.Warning), env["warning"])
+}
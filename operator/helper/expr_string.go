@@ -117,9 +117,13 @@ func (e *ExprString) Render(env map[string]interface{}) (string, error) {
 
 var envPool = sync.Pool{
 	New: func() interface{} {
-		return map[string]interface{}{
+		env := map[string]interface{}{
 			"env": os.Getenv,
 		}
+		for name, level := range severityLiterals {
+			env[name] = level
+		}
+		return env
 	},
 }
 
@@ -131,6 +135,7 @@ func GetExprEnv(e *entry.Entry) map[string]interface{} {
 	env["$labels"] = e.Labels
 	env["$resource"] = e.Resource
 	env["$timestamp"] = e.Timestamp
+	env["$severity"] = int(e.Severity)
 
 	return env
 }
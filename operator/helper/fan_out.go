@@ -0,0 +1,233 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"go.uber.org/zap"
+)
+
+const (
+	// BlockOnBackpressure waits for an output whose queue is full
+	BlockOnBackpressure = "block"
+	// DropOnBackpressure drops the entries for an output whose queue is full,
+	// so that the other outputs are not held up
+	DropOnBackpressure = "drop"
+
+	// defaultOutputBufferSize is the size of each output's queue when entries
+	// are dropped on backpressure and no size is set
+	defaultOutputBufferSize = 100
+
+	// fanOutLogInterval is the minimum time between warnings about dropped entries
+	fanOutLogInterval = 10 * time.Second
+
+	// drainTimeout is the maximum time to wait for the queued entries when the
+	// operator stops, so that an output that is stuck does not hold up shutdown
+	drainTimeout = 5 * time.Second
+)
+
+// OutputDrainer is implemented by operators that queue entries for their outputs
+type OutputDrainer interface {
+	DrainOutputs()
+}
+
+// fanOut writes entries to each output through a queue of its own, so that an
+// output that can't keep up does not hold up the others
+type fanOut struct {
+	drop       bool
+	bufferSize int
+	logger     *zap.SugaredLogger
+	stats      *OperatorStats
+
+	queues  []*outputQueue
+	mux     sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+
+	// stop is closed when the fan out starts draining, so that writers blocked
+	// on a full queue give up the read lock that drain waits for
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	dropMux sync.Mutex
+	dropped map[string]uint64
+	lastLog time.Time
+}
+
+// outputQueue holds the entries waiting for an output
+type outputQueue struct {
+	output  operator.Operator
+	entries chan queuedEntry
+}
+
+type queuedEntry struct {
+	ctx   context.Context
+	entry *entry.Entry
+}
+
+// newFanOut creates a fan out from the backpressure settings of a writer. It
+// returns nil if entries are written to the outputs directly.
+func newFanOut(onBackpressure string, bufferSize int, logger *zap.SugaredLogger, stats *OperatorStats) (*fanOut, error) {
+	switch onBackpressure {
+	case "", BlockOnBackpressure:
+		if bufferSize == 0 {
+			return nil, nil
+		}
+	case DropOnBackpressure:
+		if bufferSize == 0 {
+			bufferSize = defaultOutputBufferSize
+		}
+	default:
+		return nil, fmt.Errorf("invalid on_backpressure '%s': must be '%s' or '%s'", onBackpressure, BlockOnBackpressure, DropOnBackpressure)
+	}
+	if bufferSize < 0 {
+		return nil, fmt.Errorf("output_buffer_size must not be negative")
+	}
+
+	return &fanOut{
+		drop:       onBackpressure == DropOnBackpressure,
+		bufferSize: bufferSize,
+		logger:     logger,
+		stats:      stats,
+		stop:       make(chan struct{}),
+		dropped:    make(map[string]uint64),
+	}, nil
+}
+
+// setOutputs creates a queue for each output and starts writing the queued entries
+func (f *fanOut) setOutputs(outputs []operator.Operator) {
+	f.queues = make([]*outputQueue, 0, len(outputs))
+	for _, output := range outputs {
+		queue := &outputQueue{
+			output:  output,
+			entries: make(chan queuedEntry, f.bufferSize),
+		}
+		f.queues = append(f.queues, queue)
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			for queued := range queue.entries {
+				RecordReceived(queue.output)
+				_ = queue.output.Process(queued.ctx, queued.entry)
+			}
+		}()
+	}
+}
+
+// write queues an entry for each output. If the queue of an output is full,
+// it blocks or drops the entry for that output. A writer blocked on a full
+// queue drops the entry once the fan out starts draining. If a sampler is
+// given, the time spent handing the entry off to each queue is recorded.
+func (f *fanOut) write(ctx context.Context, e *entry.Entry, sampler *BackpressureSampler) {
+	f.mux.RLock()
+	if f.stopped {
+		f.mux.RUnlock()
+		f.writeDirect(ctx, e)
+		return
+	}
+	defer f.mux.RUnlock()
+
+	for i, queue := range f.queues {
+		toWrite := e
+		if i != len(f.queues)-1 {
+			toWrite = e.Copy()
+		}
+
+		if sampler == nil {
+			f.enqueue(ctx, queue, toWrite)
+			continue
+		}
+		start := time.Now()
+		f.enqueue(ctx, queue, toWrite)
+		sampler.Record(queue.output.ID(), time.Since(start))
+	}
+}
+
+// enqueue queues an entry for an output, blocking or dropping it if the queue
+// is full. It must be called with the read lock held.
+func (f *fanOut) enqueue(ctx context.Context, queue *outputQueue, e *entry.Entry) {
+	queued := queuedEntry{ctx: ctx, entry: e}
+	select {
+	case queue.entries <- queued:
+		return
+	default:
+	}
+
+	if f.drop {
+		f.countDropped(queue.output.ID())
+		return
+	}
+
+	select {
+	case queue.entries <- queued:
+	case <-f.stop:
+		f.countDropped(queue.output.ID())
+	}
+}
+
+// writeDirect writes an entry to each output once the queues are stopped
+func (f *fanOut) writeDirect(ctx context.Context, e *entry.Entry) {
+	for i, queue := range f.queues {
+		toWrite := e
+		if i != len(f.queues)-1 {
+			toWrite = e.Copy()
+		}
+		RecordReceived(queue.output)
+		_ = queue.output.Process(ctx, toWrite)
+	}
+}
+
+// countDropped counts an entry dropped for an output, and logs the entries
+// dropped for each output at most once per fanOutLogInterval
+func (f *fanOut) countDropped(outputID string) {
+	f.stats.AddDropped(1)
+
+	f.dropMux.Lock()
+	defer f.dropMux.Unlock()
+	f.dropped[outputID]++
+	if now := time.Now(); now.Sub(f.lastLog) >= fanOutLogInterval {
+		f.logger.Warnw("Outputs could not keep up, so entries were dropped for them", "dropped", f.dropped)
+		f.dropped = make(map[string]uint64)
+		f.lastLog = now
+	}
+}
+
+// drain stops the queues and waits up to the timeout for the queued entries to
+// be written. Entries written after this are passed to the outputs directly.
+func (f *fanOut) drain(timeout time.Duration) {
+	f.stopOnce.Do(func() { close(f.stop) })
+	expired := time.After(timeout)
+
+	// The lock is taken once the writers blocked on full queues have given up,
+	// which is also bounded by the timeout
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.mux.Lock()
+		if f.stopped {
+			f.mux.Unlock()
+			return
+		}
+		f.stopped = true
+		for _, queue := range f.queues {
+			close(queue.entries)
+		}
+		f.mux.Unlock()
+		f.wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-expired:
+		pending := make(map[string]int, len(f.queues))
+		for _, queue := range f.queues {
+			pending[queue.output.ID()] = len(queue.entries)
+		}
+		f.logger.Warnw("Stopped before the entries queued for outputs were written", "pending", pending)
+	}
+}
@@ -0,0 +1,203 @@
+package helper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// namedOutput is a fake output with its own ID
+type namedOutput struct {
+	*testutil.FakeOutput
+	id string
+}
+
+func (o namedOutput) ID() string { return o.id }
+
+// stuckOutput is an output that never finishes processing an entry until it is released
+type stuckOutput struct {
+	namedOutput
+	processing chan struct{}
+	release    chan struct{}
+}
+
+func (o stuckOutput) Process(ctx context.Context, e *entry.Entry) error {
+	select {
+	case o.processing <- struct{}{}:
+	default:
+	}
+	<-o.release
+	return nil
+}
+
+func newFanOutWriter(t *testing.T, onBackpressure string, bufferSize int) (*WriterOperator, namedOutput, stuckOutput) {
+	healthy := namedOutput{testutil.NewFakeOutput(t), "$.healthy"}
+	healthy.Received = make(chan *entry.Entry, 1000)
+	stuck := stuckOutput{namedOutput{testutil.NewFakeOutput(t), "$.stuck"}, make(chan struct{}, 1), make(chan struct{})}
+
+	cfg := NewWriterConfig("test", "test")
+	cfg.OutputIDs = []string{"$.stuck", "$.healthy"}
+	cfg.OnBackpressure = onBackpressure
+	cfg.OutputBufferSize = bufferSize
+	bc := testutil.NewBuildContext(t)
+	bc.CollectStats = true
+	writer, err := cfg.Build(bc)
+	require.NoError(t, err)
+	require.NoError(t, writer.SetOutputs([]operator.Operator{healthy, stuck}))
+	return &writer, healthy, stuck
+}
+
+func TestWriterFanOutDrop(t *testing.T) {
+	writer, healthy, stuck := newFanOutWriter(t, DropOnBackpressure, 10)
+
+	// The healthy output receives every entry, while the stuck output never
+	// finishes processing its first entry
+	for i := 0; i < 500; i++ {
+		writer.Write(context.Background(), entry.New())
+		select {
+		case <-healthy.Received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Healthy output received only %d entries", i)
+		}
+		if i == 0 {
+			<-stuck.processing
+		}
+	}
+
+	// The entries that did not fit in the stuck output's queue were dropped.
+	// One entry is being processed, and the queue holds 10 more.
+	require.Equal(t, uint64(500-11), writer.OperatorStats().Snapshot().Dropped)
+
+	close(stuck.release)
+	writer.DrainOutputs()
+}
+
+func TestWriterFanOutBlock(t *testing.T) {
+	writer, healthy, stuck := newFanOutWriter(t, BlockOnBackpressure, 10)
+
+	// The writer is not held up until the stuck output's queue is full
+	writer.Write(context.Background(), entry.New())
+	<-stuck.processing
+	for i := 0; i < 10; i++ {
+		writer.Write(context.Background(), entry.New())
+	}
+
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		writer.Write(context.Background(), entry.New())
+	}()
+
+	select {
+	case <-blocked:
+		t.Fatal("Expected the writer to block on the full queue")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(stuck.release)
+	<-blocked
+	writer.DrainOutputs()
+	require.Len(t, healthy.Received, 12)
+	require.Equal(t, uint64(0), writer.OperatorStats().Snapshot().Dropped)
+}
+
+func TestWriterFanOutDrainTimeout(t *testing.T) {
+	writer, _, stuck := newFanOutWriter(t, DropOnBackpressure, 10)
+	defer close(stuck.release)
+	writer.Write(context.Background(), entry.New())
+
+	start := time.Now()
+	writer.fanOut.drain(50 * time.Millisecond)
+	require.True(t, time.Since(start) < time.Second)
+}
+
+func TestWriterFanOutDrainBlockedWriter(t *testing.T) {
+	writer, _, stuck := newFanOutWriter(t, BlockOnBackpressure, 10)
+	writer.Write(context.Background(), entry.New())
+	<-stuck.processing
+	for i := 0; i < 10; i++ {
+		writer.Write(context.Background(), entry.New())
+	}
+
+	// A writer blocked on the full queue must not hold up the drain
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		writer.Write(context.Background(), entry.New())
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		writer.fanOut.drain(50 * time.Millisecond)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the drain")
+	}
+
+	// The blocked writer gives up on the stuck output rather than waiting for it
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the blocked writer")
+	}
+	require.Equal(t, uint64(1), writer.OperatorStats().Snapshot().Dropped)
+	close(stuck.release)
+}
+
+func TestWriterFanOutBackpressure(t *testing.T) {
+	writer, _, stuck := newFanOutWriter(t, DropOnBackpressure, 10)
+	writer.backpressure = NewBackpressureSampler()
+
+	// The hand-offs to both queues are sampled, including the hand-offs of
+	// the entries dropped for the stuck output
+	for i := 0; i < BackpressureSampleRate; i++ {
+		writer.Write(context.Background(), entry.New())
+	}
+	require.Contains(t, writer.BackpressureRatios(), "$.stuck")
+	require.Contains(t, writer.BackpressureRatios(), "$.healthy")
+
+	close(stuck.release)
+	writer.DrainOutputs()
+}
+
+func TestWriterFanOutConfig(t *testing.T) {
+	cases := []struct {
+		name           string
+		onBackpressure string
+		bufferSize     int
+		expectFanOut   bool
+		expectErr      bool
+	}{
+		{"Default", "", 0, false, false},
+		{"Block", BlockOnBackpressure, 0, false, false},
+		{"BlockBuffered", BlockOnBackpressure, 5, true, false},
+		{"Drop", DropOnBackpressure, 0, true, false},
+		{"Invalid", "skip", 0, false, true},
+		{"NegativeBuffer", DropOnBackpressure, -1, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewWriterConfig("test", "test")
+			cfg.OnBackpressure = tc.onBackpressure
+			cfg.OutputBufferSize = tc.bufferSize
+			writer, err := cfg.Build(testutil.NewBuildContext(t))
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectFanOut, writer.fanOut != nil)
+		})
+	}
+}
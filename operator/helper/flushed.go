@@ -0,0 +1,42 @@
+package helper
+
+import (
+	"context"
+
+	"github.com/observiq/stanza/operator"
+)
+
+// FlushWaiter is implemented by outputs that buffer entries before sending
+// them. WaitFlushed blocks until every entry the output received before the
+// call has been sent, or until the context is done.
+type FlushWaiter interface {
+	WaitFlushed(context.Context) error
+}
+
+// WaitFlushed blocks until the entries received by the operators, and by
+// every operator downstream of them, have been sent by any outputs that
+// buffer entries. Outputs that do not buffer send entries as they receive
+// them, so there is nothing to wait for.
+func WaitFlushed(ctx context.Context, operators []operator.Operator) error {
+	visited := make(map[string]bool)
+	var wait func([]operator.Operator) error
+	wait = func(operators []operator.Operator) error {
+		for _, op := range operators {
+			if visited[op.ID()] {
+				continue
+			}
+			visited[op.ID()] = true
+
+			if waiter, ok := op.(FlushWaiter); ok {
+				if err := waiter.WaitFlushed(ctx); err != nil {
+					return err
+				}
+			}
+			if err := wait(op.Outputs()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return wait(operators)
+}
@@ -0,0 +1,49 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type flushWaitingOperator struct {
+	*testutil.Operator
+	err   error
+	waits int
+}
+
+func (o *flushWaitingOperator) WaitFlushed(ctx context.Context) error {
+	o.waits++
+	return o.err
+}
+
+func newFlushWaitingOperator(id string, outputs ...operator.Operator) *flushWaitingOperator {
+	op := &testutil.Operator{}
+	op.On("ID").Return(id)
+	op.On("Outputs").Return(outputs)
+	return &flushWaitingOperator{Operator: op}
+}
+
+func TestWaitFlushed(t *testing.T) {
+	output1 := newFlushWaitingOperator("output1")
+	output2 := newFlushWaitingOperator("output2")
+
+	router := &testutil.Operator{}
+	router.On("ID").Return("router")
+	router.On("Outputs").Return([]operator.Operator{output1, output2})
+	transformer := &testutil.Operator{}
+	transformer.On("ID").Return("transformer")
+	transformer.On("Outputs").Return([]operator.Operator{output1})
+
+	require.NoError(t, WaitFlushed(context.Background(), []operator.Operator{router, transformer}))
+	require.Equal(t, 1, output1.waits)
+	require.Equal(t, 1, output2.waits)
+
+	output2.err = fmt.Errorf("context canceled")
+	err := WaitFlushed(context.Background(), []operator.Operator{router})
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/errors"
@@ -25,6 +26,7 @@ type InputConfig struct {
 	IdentifierConfig `yaml:",inline"`
 	WriterConfig     `yaml:",inline"`
 	WriteTo          entry.Field `json:"write_to" yaml:"write_to"`
+	Throttle         string      `json:"throttle,omitempty" yaml:"throttle,omitempty"`
 }
 
 // Build will build a base producer.
@@ -44,11 +46,25 @@ func (c InputConfig) Build(context operator.BuildContext) (InputOperator, error)
 		return InputOperator{}, errors.WithDetails(err, "operator_id", c.ID())
 	}
 
+	var throttle *operator.Throttle
+	if c.Throttle != "" {
+		var ok bool
+		throttle, ok = context.Throttles.Get(c.Throttle)
+		if !ok {
+			return InputOperator{}, errors.NewError(
+				fmt.Sprintf("throttle '%s' is not defined", c.Throttle),
+				"define the throttle in the throttles section of the config",
+				"operator_id", c.ID(),
+			)
+		}
+	}
+
 	inputOperator := InputOperator{
 		Labeler:        labeler,
 		Identifier:     identifier,
 		WriterOperator: writerOperator,
 		WriteTo:        c.WriteTo,
+		Throttle:       throttle,
 	}
 
 	return inputOperator, nil
@@ -60,6 +76,10 @@ type InputOperator struct {
 	Identifier
 	WriterOperator
 	WriteTo entry.Field
+
+	// Throttle is the budget shared with the other inputs of a pipeline, or
+	// nil if the input is not throttled
+	Throttle *operator.Throttle
 }
 
 // NewEntry will create a new entry using the `write_to`, `labels`, and `resource` configuration.
@@ -80,6 +100,13 @@ func (i *InputOperator) NewEntry(value interface{}) (*entry.Entry, error) {
 	return entry, nil
 }
 
+// Write will write an entry to the outputs of the input, once its throttle
+// has budget for the entry
+func (i *InputOperator) Write(ctx context.Context, e *entry.Entry) {
+	i.Throttle.Wait(ctx)
+	i.WriterOperator.Write(ctx, e)
+}
+
 // CanProcess will always return false for an input operator.
 func (i *InputOperator) CanProcess() bool {
 	return false
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -53,6 +54,33 @@ func TestInputConfigValid(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestInputConfigThrottle(t *testing.T) {
+	config := InputConfig{
+		WriteTo: entry.Field{},
+		WriterConfig: WriterConfig{
+			BasicConfig: BasicConfig{
+				OperatorID:   "test-id",
+				OperatorType: "test-type",
+			},
+			OutputIDs: []string{"test-output"},
+		},
+		Throttle: "replay",
+	}
+
+	context := testutil.NewBuildContext(t)
+	_, err := config.Build(context)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "throttle 'replay' is not defined")
+
+	context.Throttles, err = operator.NewThrottles(map[string]operator.ThrottleConfig{
+		"replay": {MaxEntriesPerSecond: 10},
+	})
+	require.NoError(t, err)
+	input, err := config.Build(context)
+	require.NoError(t, err)
+	require.Equal(t, "replay", input.Throttle.Name())
+}
+
 func TestInputOperatorCanProcess(t *testing.T) {
 	buildContext := testutil.NewBuildContext(t)
 	input := InputOperator{
@@ -1,6 +1,8 @@
 package helper
 
 import (
+	"strings"
+
 	"github.com/observiq/stanza/entry"
 )
 
@@ -22,25 +24,42 @@ func (c LabelerConfig) Build() (Labeler, error) {
 		labels: make(map[string]*ExprString),
 	}
 
+	static := make(map[string]string)
 	for k, v := range c.Labels {
 		exprString, err := v.Build()
 		if err != nil {
 			return labeler, err
 		}
 
+		if len(exprString.SubExprs) == 0 {
+			static[k] = strings.Join(exprString.SubStrings, "")
+			continue
+		}
 		labeler.labels[k] = exprString
 	}
 
+	if len(static) > 0 {
+		labeler.static = entry.NewLabelSet(static)
+	}
 	return labeler, nil
 }
 
-// Labeler is a helper that adds labels to an entry
+// Labeler is a helper that adds labels to an entry. Labels without
+// expressions are the same for every entry, so entries share them.
 type Labeler struct {
+	static *entry.LabelSet
 	labels map[string]*ExprString
 }
 
+// LabelSet returns the labels without expressions, which every entry is
+// given, or nil if there are none
+func (l *Labeler) LabelSet() *entry.LabelSet {
+	return l.static
+}
+
 // Label will add labels to an entry
 func (l *Labeler) Label(e *entry.Entry) error {
+	e.AddLabelSet(l.static)
 	if len(l.labels) == 0 {
 		return nil
 	}
@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogLevel overrides the level of an operator's logger at runtime, so that
+// debug logs can be enabled for a single operator without restarting the agent
+type LogLevel struct {
+	mux      sync.RWMutex
+	override *zapcore.Level
+}
+
+// LogLevelReporter is implemented by operators whose log level can be changed at runtime
+type LogLevelReporter interface {
+	OperatorLogLevel() *LogLevel
+}
+
+// Set overrides the level of the operator's logger
+func (l *LogLevel) Set(level zapcore.Level) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.override = &level
+}
+
+// Reset returns the operator's logger to the level of the agent's logger
+func (l *LogLevel) Reset() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.override = nil
+}
+
+// Level returns the overridden level, and false if the level is not overridden
+func (l *LogLevel) Level() (zapcore.Level, bool) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	if l.override == nil {
+		return zapcore.InfoLevel, false
+	}
+	return *l.override, true
+}
+
+// wrap returns a logger that applies the overridden level instead of the level
+// of logger, if one is set
+func (l *LogLevel) wrap(logger *zap.SugaredLogger) *zap.SugaredLogger {
+	return logger.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: l}
+	})).Sugar()
+}
+
+// levelCore is a core that checks entries against an overridden level
+type levelCore struct {
+	zapcore.Core
+	level *LogLevel
+}
+
+// Enabled returns true if the overridden level, or the level of the core, is enabled
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	if override, ok := c.level.Level(); ok {
+		return level >= override
+	}
+	return c.Core.Enabled(level)
+}
+
+// Check adds the core to the checked entry if its level is enabled
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	override, ok := c.level.Level()
+	if !ok {
+		return c.Core.Check(ent, ce)
+	}
+	if ent.Level >= override {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// With adds fields to the core
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
@@ -0,0 +1,155 @@
+package helper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Maintenance parks a buffered output until a time, such as while its
+// destination is down for maintenance. While the output is parked, its flusher
+// idles and entries accumulate in its buffer.
+type Maintenance struct {
+	mux      sync.Mutex
+	until    time.Time
+	changed  chan struct{}
+	stats    *OperatorStats
+	parkedIn uint64
+	attached bool
+	memory   bool
+	now      func() time.Time
+}
+
+// MaintenanceStatus is the maintenance state of an output
+type MaintenanceStatus struct {
+	Parked bool       `json:"parked"`
+	Until  *time.Time `json:"until,omitempty"`
+
+	// Backlog is the number of entries the output has received since it was
+	// parked. It is only counted if the agent collects operator stats.
+	Backlog uint64 `json:"backlog,omitempty"`
+
+	// MemoryBuffer is true if the entries are buffered in memory, and are
+	// lost if the agent stops while the output is parked
+	MemoryBuffer bool `json:"memory_buffer,omitempty"`
+}
+
+// MaintenanceReporter is implemented by outputs that can be parked for maintenance
+type MaintenanceReporter interface {
+	MaintenanceMode() *Maintenance
+}
+
+// NewMaintenance creates a maintenance that parks an output until a time. A
+// zero time does not park the output. The backlog is counted from the stats,
+// which may be nil.
+func NewMaintenance(until time.Time, stats *OperatorStats) *Maintenance {
+	return &Maintenance{
+		until:   until,
+		changed: make(chan struct{}),
+		stats:   stats,
+		now:     time.Now,
+	}
+}
+
+// parseMaintenanceUntil parses the maintenance_until of an output
+func parseMaintenanceUntil(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("maintenance_until '%s' must be an RFC 3339 timestamp, such as 2006-01-02T15:04:05Z", value)
+	}
+	return until, nil
+}
+
+// Attach marks the maintenance as honored by the flusher of an output. An
+// output can only be parked at runtime once it is attached.
+func (m *Maintenance) Attach(memoryBuffer bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.attached = true
+	m.memory = memoryBuffer
+}
+
+// Attached returns true if the maintenance is honored by a flusher
+func (m *Maintenance) Attached() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.attached
+}
+
+// Park parks the output until a time
+func (m *Maintenance) Park(until time.Time) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if !m.parkedAt(m.now()) {
+		m.parkedIn = m.entriesIn()
+	}
+	m.until = until
+	m.notify()
+}
+
+// Resume ends the maintenance, and the output resumes delivery
+func (m *Maintenance) Resume() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.until = time.Time{}
+	m.notify()
+}
+
+// Remaining returns the time left until the maintenance ends, and a channel
+// that is closed when the maintenance is changed. It returns zero if the
+// output is not parked. A nil maintenance is never parked.
+func (m *Maintenance) Remaining() (time.Duration, <-chan struct{}) {
+	if m == nil {
+		return 0, nil
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	remaining := m.until.Sub(m.now())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, m.changed
+}
+
+// Status returns the maintenance state of the output
+func (m *Maintenance) Status() MaintenanceStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if !m.parkedAt(m.now()) {
+		return MaintenanceStatus{}
+	}
+
+	until := m.until
+	return MaintenanceStatus{
+		Parked:       true,
+		Until:        &until,
+		Backlog:      m.entriesIn() - m.parkedIn,
+		MemoryBuffer: m.memory,
+	}
+}
+
+// parkedAt returns true if the output is parked at a time
+func (m *Maintenance) parkedAt(t time.Time) bool {
+	return t.Before(m.until)
+}
+
+// entriesIn returns the number of entries received by the output
+func (m *Maintenance) entriesIn() uint64 {
+	if m.stats == nil {
+		return 0
+	}
+	return m.stats.Snapshot().EntriesIn
+}
+
+// notify wakes up anything waiting for the maintenance to change
+func (m *Maintenance) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
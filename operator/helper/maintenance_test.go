@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaintenanceUntil(t *testing.T) {
+	until, err := parseMaintenanceUntil("")
+	require.NoError(t, err)
+	require.True(t, until.IsZero())
+
+	until, err = parseMaintenanceUntil("2020-10-01T02:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 10, 1, 2, 0, 0, 0, time.UTC), until)
+
+	_, err = parseMaintenanceUntil("02:00")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be an RFC 3339 timestamp")
+}
+
+func TestMaintenance(t *testing.T) {
+	now := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	stats := &OperatorStats{}
+	stats.AddIn(5)
+
+	m := NewMaintenance(time.Time{}, stats)
+	m.now = func() time.Time { return now }
+
+	remaining, _ := m.Remaining()
+	require.Equal(t, time.Duration(0), remaining)
+	require.Equal(t, MaintenanceStatus{}, m.Status())
+
+	// Parking wakes up waiters, and the backlog counts from the time the
+	// output was parked
+	_, changed := m.Remaining()
+	until := now.Add(time.Hour)
+	m.Park(until)
+	select {
+	case <-changed:
+	default:
+		require.FailNow(t, "parking did not signal a change")
+	}
+
+	stats.AddIn(3)
+	remaining, _ = m.Remaining()
+	require.Equal(t, time.Hour, remaining)
+	require.Equal(t, MaintenanceStatus{Parked: true, Until: &until, Backlog: 3}, m.Status())
+
+	// Extending the maintenance keeps the backlog
+	until = now.Add(2 * time.Hour)
+	m.Park(until)
+	require.Equal(t, uint64(3), m.Status().Backlog)
+
+	// The output resumes when the maintenance ends
+	now = now.Add(3 * time.Hour)
+	remaining, _ = m.Remaining()
+	require.Equal(t, time.Duration(0), remaining)
+	require.False(t, m.Status().Parked)
+
+	m.Park(now.Add(time.Hour))
+	m.Resume()
+	require.False(t, m.Status().Parked)
+}
+
+func TestNilMaintenance(t *testing.T) {
+	var m *Maintenance
+	remaining, changed := m.Remaining()
+	require.Equal(t, time.Duration(0), remaining)
+	require.Nil(t, changed)
+}
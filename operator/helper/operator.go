@@ -17,7 +17,7 @@ func NewBasicConfig(operatorID, operatorType string) BasicConfig {
 // BasicConfig provides a basic implemention for an operator config.
 type BasicConfig struct {
 	OperatorID   string `json:"id"   yaml:"id"`
-	OperatorType string `json:"type" yaml:"type"`
+	OperatorType string `json:"type" yaml:"type" required:"true"`
 }
 
 // ID will return the operator id.
@@ -53,10 +53,15 @@ func (c BasicConfig) Build(context operator.BuildContext) (BasicOperator, error)
 	}
 
 	namespacedID := context.PrependNamespace(c.ID())
+	logLevel := &LogLevel{}
 	operator := BasicOperator{
 		OperatorID:    namespacedID,
 		OperatorType:  c.Type(),
-		SugaredLogger: context.Logger.With("operator_id", namespacedID, "operator_type", c.Type()),
+		SugaredLogger: logLevel.wrap(context.Logger.SugaredLogger).With("operator_id", namespacedID, "operator_type", c.Type()),
+	}
+
+	if context.CollectStats {
+		operator.stats = &OperatorStats{}
 	}
 
 	return operator, nil
@@ -67,6 +72,8 @@ type BasicOperator struct {
 	OperatorID   string
 	OperatorType string
 	*zap.SugaredLogger
+
+	stats *OperatorStats
 }
 
 // ID will return the operator id.
@@ -87,6 +94,24 @@ func (p *BasicOperator) Logger() *zap.SugaredLogger {
 	return p.SugaredLogger
 }
 
+// OperatorStats returns the counters of the entries handled by the operator.
+// It returns nil if stats are not collected.
+func (p *BasicOperator) OperatorStats() *OperatorStats {
+	return p.stats
+}
+
+// OperatorLogLevel returns the runtime override of the level of the operator's
+// logger. It returns nil if the logger was not built from a config.
+func (p *BasicOperator) OperatorLogLevel() *LogLevel {
+	if p.SugaredLogger == nil {
+		return nil
+	}
+	if core, ok := p.Desugar().Core().(*levelCore); ok {
+		return core.level
+	}
+	return nil
+}
+
 // Start will start the operator.
 func (p *BasicOperator) Start() error {
 	return nil
@@ -65,6 +65,19 @@ func TestBasicConfigBuildValid(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "$.test-id", operator.OperatorID)
 	require.Equal(t, "test-type", operator.OperatorType)
+	require.Nil(t, operator.OperatorStats())
+}
+
+func TestBasicConfigBuildCollectStats(t *testing.T) {
+	config := BasicConfig{
+		OperatorID:   "test-id",
+		OperatorType: "test-type",
+	}
+	context := testutil.NewBuildContext(t)
+	context.CollectStats = true
+	operator, err := config.Build(context)
+	require.NoError(t, err)
+	require.NotNil(t, operator.OperatorStats())
 }
 
 func TestBasicOperatorID(t *testing.T) {
@@ -0,0 +1,303 @@
+package helper
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/observiq/stanza/entry"
+)
+
+// JSONKeyOrderConfig is the configuration of the key order used when an
+// output encodes entries as JSON.
+type JSONKeyOrderConfig struct {
+	SortKeys bool     `json:"sort_keys,omitempty" yaml:"sort_keys,omitempty"`
+	KeyOrder []string `json:"key_order,omitempty" yaml:"key_order,omitempty"`
+}
+
+// Build will build an ordered JSON encoder. It returns nil if no ordering is
+// configured, in which case the default encoding should be used.
+func (c JSONKeyOrderConfig) Build() *OrderedJSONEncoder {
+	if !c.SortKeys && len(c.KeyOrder) == 0 {
+		return nil
+	}
+
+	rank := make(map[string]int, len(c.KeyOrder))
+	for i, key := range c.KeyOrder {
+		if _, ok := rank[key]; !ok {
+			rank[key] = i
+		}
+	}
+	return &OrderedJSONEncoder{rank: rank}
+}
+
+// OrderedJSONEncoder encodes entries as JSON with a deterministic key order.
+// Keys of the record are emitted in the configured order, followed by the
+// remaining keys in sorted order. Keys of all other objects are sorted.
+type OrderedJSONEncoder struct {
+	rank map[string]int
+}
+
+// Marshal returns the JSON encoding of the entry.
+func (o *OrderedJSONEncoder) Marshal(e *entry.Entry) ([]byte, error) {
+	return o.AppendEntry(make([]byte, 0, 256), e)
+}
+
+// AppendEntry appends the JSON encoding of the entry to dst.
+func (o *OrderedJSONEncoder) AppendEntry(dst []byte, e *entry.Entry) ([]byte, error) {
+	var err error
+
+	dst = append(dst, `{"timestamp":`...)
+	dst = appendTime(dst, e.Timestamp)
+	dst = append(dst, `,"severity":`...)
+	dst = strconv.AppendInt(dst, int64(e.Severity), 10)
+	if len(e.Labels) > 0 {
+		dst = append(dst, `,"labels":`...)
+		dst = appendStringMap(dst, e.Labels)
+	}
+	if len(e.Resource) > 0 {
+		dst = append(dst, `,"resource":`...)
+		dst = appendStringMap(dst, e.Resource)
+	}
+	if len(e.TraceID) > 0 {
+		dst = append(dst, `,"trace_id":`...)
+		dst = appendHex(dst, e.TraceID)
+	}
+	if len(e.SpanID) > 0 {
+		dst = append(dst, `,"span_id":`...)
+		dst = appendHex(dst, e.SpanID)
+	}
+	if len(e.TraceFlags) > 0 {
+		dst = append(dst, `,"trace_flags":`...)
+		dst = appendHex(dst, e.TraceFlags)
+	}
+	dst = append(dst, `,"record":`...)
+	if record, ok := e.Record.(map[string]interface{}); ok {
+		dst, err = o.appendRecord(dst, record)
+	} else {
+		dst, err = appendValue(dst, e.Record)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, '}'), nil
+}
+
+// appendHex appends bytes as a quoted hex string, as they are encoded by
+// entry.HexBytes
+func appendHex(dst []byte, b []byte) []byte {
+	dst = append(dst, '"')
+	start := len(dst)
+	dst = append(dst, make([]byte, hex.EncodedLen(len(b)))...)
+	hex.Encode(dst[start:], b)
+	return append(dst, '"')
+}
+
+// appendRecord appends a record with its keys in the configured order.
+func (o *OrderedJSONEncoder) appendRecord(dst []byte, record map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ri, iRanked := o.rank[keys[i]]
+		rj, jRanked := o.rank[keys[j]]
+		switch {
+		case iRanked && jRanked:
+			return ri < rj
+		case iRanked != jRanked:
+			return iRanked
+		default:
+			return keys[i] < keys[j]
+		}
+	})
+
+	return appendObject(dst, keys, record)
+}
+
+// appendValue appends the JSON encoding of a value to dst.
+func appendValue(dst []byte, v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case string:
+		return appendString(dst, value), nil
+	case bool:
+		return strconv.AppendBool(dst, value), nil
+	case int:
+		return strconv.AppendInt(dst, int64(value), 10), nil
+	case int32:
+		return strconv.AppendInt(dst, int64(value), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, value, 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, value, 10), nil
+	case float64:
+		return appendFloat(dst, value, 64)
+	case float32:
+		return appendFloat(dst, float64(value), 32)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return appendObject(dst, keys, value)
+	case map[string]string:
+		return appendStringMap(dst, value), nil
+	case []interface{}:
+		var err error
+		dst = append(dst, '[')
+		for i, item := range value {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = appendValue(dst, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+	case []string:
+		dst = append(dst, '[')
+		for i, item := range value {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendString(dst, item)
+		}
+		return append(dst, ']'), nil
+	default:
+		// Uncommon types fall back to the standard encoder, which sorts map keys
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return append(dst, encoded...), nil
+	}
+}
+
+// appendObject appends an object with the given keys in order.
+func appendObject(dst []byte, keys []string, m map[string]interface{}) ([]byte, error) {
+	var err error
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendString(dst, key)
+		dst = append(dst, ':')
+		if dst, err = appendValue(dst, m[key]); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendStringMap appends a map of strings with sorted keys.
+func appendStringMap(dst []byte, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendString(dst, key)
+		dst = append(dst, ':')
+		dst = appendString(dst, m[key])
+	}
+	return append(dst, '}')
+}
+
+// appendTime appends a time in the same format as time.Time.MarshalJSON.
+func appendTime(dst []byte, t time.Time) []byte {
+	dst = append(dst, '"')
+	dst = t.AppendFormat(dst, time.RFC3339Nano)
+	return append(dst, '"')
+}
+
+// appendFloat appends a float in the same format as encoding/json.
+func appendFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	start := len(dst)
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst) - start
+		if n >= 4 && dst[len(dst)-4] == 'e' && dst[len(dst)-3] == '-' && dst[len(dst)-2] == '0' {
+			dst[len(dst)-2] = dst[len(dst)-1]
+			dst = dst[:len(dst)-1]
+		}
+	}
+	return dst, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends a quoted string escaped in the same way as encoding/json.
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
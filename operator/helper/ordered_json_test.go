@@ -0,0 +1,149 @@
+package helper
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONKeyOrderConfigBuild(t *testing.T) {
+	require.Nil(t, JSONKeyOrderConfig{}.Build())
+	require.NotNil(t, JSONKeyOrderConfig{SortKeys: true}.Build())
+	require.NotNil(t, JSONKeyOrderConfig{KeyOrder: []string{"message"}}.Build())
+}
+
+func TestOrderedJSONEncoderMatchesStandard(t *testing.T) {
+	ts := time.Date(2020, 10, 7, 12, 30, 45, 123456789, time.FixedZone("test", -5*3600))
+	cases := []struct {
+		name  string
+		entry *entry.Entry
+	}{
+		{
+			"NilRecord",
+			&entry.Entry{Timestamp: ts},
+		},
+		{
+			"StringRecord",
+			&entry.Entry{Timestamp: ts, Severity: entry.Error, Record: "line with \"quotes\", <html> & \\ \n\t\x01 \u2028 \u2029 \u00e9"},
+		},
+		{
+			"LabelsAndResource",
+			&entry.Entry{
+				Timestamp: ts,
+				Labels:    map[string]string{"z": "1", "a": "2", "m": "3"},
+				Resource:  map[string]string{"host": "a", "cluster": "b"},
+				Record:    "message",
+			},
+		},
+		{
+			"TraceContext",
+			&entry.Entry{
+				Timestamp:  ts,
+				TraceID:    testTraceID,
+				SpanID:     testSpanID,
+				TraceFlags: testTraceFlags,
+				Record:     "message",
+			},
+		},
+		{
+			"NestedRecord",
+			&entry.Entry{
+				Timestamp: ts,
+				Record: map[string]interface{}{
+					"zeta":   "last",
+					"alpha":  []interface{}{"x", 1, 2.5, true, nil, map[string]interface{}{"y": 1, "b": 2}},
+					"nested": map[string]interface{}{"c": map[string]interface{}{"z": 1, "a": 2}, "b": []string{"s"}},
+					"labels": map[string]string{"k2": "v", "k1": "v"},
+					"floats": []interface{}{0.0, 1e21, 1e-7, 123456.789, -0.000001, float32(1.5)},
+					"ints":   []interface{}{int32(-3), int64(1) << 62, uint64(math.MaxUint64)},
+					"bytes":  []byte("raw"),
+				},
+			},
+		},
+	}
+
+	encoder := JSONKeyOrderConfig{SortKeys: true}.Build()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected, err := json.Marshal(tc.entry)
+			require.NoError(t, err)
+
+			actual, err := encoder.Marshal(tc.entry)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestOrderedJSONEncoderKeyOrder(t *testing.T) {
+	encoder := JSONKeyOrderConfig{KeyOrder: []string{"message", "level", "missing"}}.Build()
+	e := &entry.Entry{
+		Timestamp: time.Unix(0, 0).UTC(),
+		Record: map[string]interface{}{
+			"c":       map[string]interface{}{"message": 1, "a": 2},
+			"b":       2,
+			"level":   "info",
+			"message": "hello",
+		},
+	}
+
+	actual, err := encoder.Marshal(e)
+	require.NoError(t, err)
+	expected := `{"timestamp":"1970-01-01T00:00:00Z","severity":0,"record":{"message":"hello","level":"info","b":2,"c":{"a":2,"message":1}}}`
+	require.Equal(t, expected, string(actual))
+}
+
+func TestOrderedJSONEncoderUnsupportedFloat(t *testing.T) {
+	encoder := JSONKeyOrderConfig{SortKeys: true}.Build()
+	_, err := encoder.Marshal(&entry.Entry{Record: math.NaN()})
+	require.Error(t, err)
+}
+
+func newBenchmarkEntry() *entry.Entry {
+	return &entry.Entry{
+		Timestamp: time.Now(),
+		Severity:  entry.Info,
+		Labels:    map[string]string{"file_name": "app.log", "host": "web-1"},
+		Record: map[string]interface{}{
+			"message":  "GET /api/v1/users 200",
+			"method":   "GET",
+			"path":     "/api/v1/users",
+			"status":   200,
+			"duration": 0.0123,
+			"user": map[string]interface{}{
+				"id":    "1234",
+				"roles": []interface{}{"admin", "dev"},
+			},
+		},
+	}
+}
+
+func BenchmarkJSONEncodeStandard(b *testing.B) {
+	e := newBenchmarkEntry()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = json.Marshal(e)
+	}
+}
+
+func BenchmarkJSONEncodeSorted(b *testing.B) {
+	e := newBenchmarkEntry()
+	encoder := JSONKeyOrderConfig{SortKeys: true}.Build()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = encoder.Marshal(e)
+	}
+}
+
+func BenchmarkJSONEncodeKeyOrder(b *testing.B) {
+	e := newBenchmarkEntry()
+	encoder := JSONKeyOrderConfig{KeyOrder: []string{"message", "status", "method"}}.Build()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = encoder.Marshal(e)
+	}
+}
@@ -1,6 +1,8 @@
 package helper
 
 import (
+	"fmt"
+
 	"github.com/observiq/stanza/errors"
 	"github.com/observiq/stanza/operator"
 )
@@ -8,13 +10,17 @@ import (
 // NewOutputConfig creates a new output config
 func NewOutputConfig(operatorID, operatorType string) OutputConfig {
 	return OutputConfig{
-		BasicConfig: NewBasicConfig(operatorID, operatorType),
+		BasicConfig:    NewBasicConfig(operatorID, operatorType),
+		RetryOnFailure: NewRetryConfig(),
 	}
 }
 
 // OutputConfig provides a basic implementation of an output operator config.
 type OutputConfig struct {
-	BasicConfig `mapstructure:",squash" yaml:",inline"`
+	BasicConfig      `mapstructure:",squash" yaml:",inline"`
+	DeliveryWindow   *DeliveryWindowConfig `json:"delivery_window,omitempty" yaml:"delivery_window,omitempty"`
+	MaintenanceUntil string                `json:"maintenance_until,omitempty" yaml:"maintenance_until,omitempty"`
+	RetryOnFailure   RetryConfig           `json:"retry_on_failure,omitempty" yaml:"retry_on_failure,omitempty"`
 }
 
 // Build will build an output operator.
@@ -24,16 +30,88 @@ func (c OutputConfig) Build(context operator.BuildContext) (OutputOperator, erro
 		return OutputOperator{}, err
 	}
 
+	deliveryWindow, err := c.DeliveryWindow.Build()
+	if err != nil {
+		return OutputOperator{}, err
+	}
+
+	maintenanceUntil, err := parseMaintenanceUntil(c.MaintenanceUntil)
+	if err != nil {
+		return OutputOperator{}, err
+	}
+
+	retrier, err := c.RetryOnFailure.Build(basicOperator.SugaredLogger)
+	if err != nil {
+		return OutputOperator{}, err
+	}
+
 	outputOperator := OutputOperator{
-		BasicOperator: basicOperator,
+		BasicOperator:  basicOperator,
+		DeliveryWindow: deliveryWindow,
+		Maintenance:    NewMaintenance(maintenanceUntil, basicOperator.OperatorStats()),
+		Retrier:        retrier,
 	}
 
 	return outputOperator, nil
 }
 
+// BuildWithoutFlusher will build an output operator that sends each entry as
+// it receives it, without a buffer and flusher. The options that only a
+// flusher honors are rejected rather than ignored.
+func (c OutputConfig) BuildWithoutFlusher(context operator.BuildContext) (OutputOperator, error) {
+	var option string
+	switch {
+	case c.DeliveryWindow != nil:
+		option = "delivery_window"
+	case c.MaintenanceUntil != "":
+		option = "maintenance_until"
+	case c.RetryOnFailure != (RetryConfig{}) && c.RetryOnFailure != NewRetryConfig():
+		option = "retry_on_failure"
+	default:
+		return c.Build(context)
+	}
+
+	return OutputOperator{}, errors.NewError(
+		fmt.Sprintf("%s is not supported by the %s operator", option, c.OperatorType),
+		fmt.Sprintf("remove %s, which only applies to outputs with a buffer and flusher", option),
+		"operator_id", c.ID(),
+	)
+}
+
 // OutputOperator provides a basic implementation of an output operator.
 type OutputOperator struct {
 	BasicOperator
+
+	// DeliveryWindow is the window during which buffered entries are
+	// delivered. It is nil if entries should always be delivered.
+	DeliveryWindow *DeliveryWindow
+
+	// Maintenance parks buffered entries while the destination is down for
+	// maintenance. It only applies to outputs with a flusher.
+	Maintenance *Maintenance
+
+	// Retrier retries the failed attempts of the output to send entries
+	Retrier *Retrier
+}
+
+// MaintenanceMode returns the maintenance of the output
+func (o *OutputOperator) MaintenanceMode() *Maintenance {
+	return o.Maintenance
+}
+
+// Status reports the maintenance state of outputs that can be parked
+func (o *OutputOperator) Status() map[string]interface{} {
+	if o.Maintenance == nil || !o.Maintenance.Attached() {
+		return nil
+	}
+	return map[string]interface{}{
+		"maintenance": o.Maintenance.Status(),
+	}
+}
+
+// Counters returns the retries of the output, once it has retried
+func (o *OutputOperator) Counters() map[string]uint64 {
+	return o.Retrier.Counters()
 }
 
 // CanProcess will always return true for an output operator.
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"testing"
+	"time"
 
 	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/testutil"
@@ -28,6 +29,42 @@ func TestOutputConfigBuildValid(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestOutputConfigInvalidRetryOnFailure(t *testing.T) {
+	config := NewOutputConfig("test-id", "test-type")
+	config.RetryOnFailure.Multiplier = 0.5
+	_, err := config.Build(testutil.NewBuildContext(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "retry_on_failure multiplier")
+}
+
+func TestOutputConfigBuildWithoutFlusher(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(*OutputConfig)
+		err    string
+	}{
+		{"Default", func(c *OutputConfig) {}, ""},
+		{"ZeroRetryOnFailure", func(c *OutputConfig) { c.RetryOnFailure = RetryConfig{} }, ""},
+		{"DeliveryWindow", func(c *OutputConfig) { c.DeliveryWindow = &DeliveryWindowConfig{Start: "00:00", End: "06:00"} }, "delivery_window is not supported by the test-type operator"},
+		{"MaintenanceUntil", func(c *OutputConfig) { c.MaintenanceUntil = "2020-10-01T06:00:00Z" }, "maintenance_until is not supported by the test-type operator"},
+		{"RetryOnFailure", func(c *OutputConfig) { c.RetryOnFailure.MaxElapsedTime = NewDuration(time.Minute) }, "retry_on_failure is not supported by the test-type operator"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewOutputConfig("test-id", "test-type")
+			tc.modify(&config)
+			_, err := config.BuildWithoutFlusher(testutil.NewBuildContext(t))
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
 func TestOutputOperatorCanProcess(t *testing.T) {
 	buildContext := testutil.NewBuildContext(t)
 	output := OutputOperator{
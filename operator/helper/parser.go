@@ -27,6 +27,7 @@ type ParserConfig struct {
 	Preserve             bool                  `json:"preserve"   yaml:"preserve"`
 	TimeParser           *TimeParser           `json:"timestamp,omitempty" yaml:"timestamp,omitempty"`
 	SeverityParserConfig *SeverityParserConfig `json:"severity,omitempty" yaml:"severity,omitempty"`
+	TraceParserConfig    *TraceParserConfig    `json:"trace,omitempty"    yaml:"trace,omitempty"`
 }
 
 // Build will build a parser operator.
@@ -66,6 +67,14 @@ func (c ParserConfig) Build(context operator.BuildContext) (ParserOperator, erro
 		parserOperator.SeverityParser = &severityParser
 	}
 
+	if c.TraceParserConfig != nil {
+		traceParser, err := c.TraceParserConfig.Build(context)
+		if err != nil {
+			return ParserOperator{}, err
+		}
+		parserOperator.TraceParser = &traceParser
+	}
+
 	return parserOperator, nil
 }
 
@@ -77,6 +86,7 @@ type ParserOperator struct {
 	Preserve       bool
 	TimeParser     *TimeParser
 	SeverityParser *SeverityParser
+	TraceParser    *TraceParser
 }
 
 // ProcessWith will process an entry with a parser function.
@@ -91,7 +101,7 @@ func (p *ParserOperator) ProcessWith(ctx context.Context, entry *entry.Entry, pa
 		return p.HandleEntryError(ctx, entry, err)
 	}
 
-	newValue, err := parse(value)
+	newValue, err := recoverParse(value, parse)
 	if err != nil {
 		return p.HandleEntryError(ctx, entry, err)
 	}
@@ -114,17 +124,31 @@ func (p *ParserOperator) ProcessWith(ctx context.Context, entry *entry.Entry, pa
 		severityParseErr = p.SeverityParser.Parse(ctx, entry)
 	}
 
-	// Handle time or severity parsing errors after attempting to parse both
+	var traceParseErr error
+	if p.TraceParser != nil {
+		traceParseErr = p.TraceParser.Parse(ctx, entry)
+	}
+
+	// Handle time, severity or trace parsing errors after attempting to parse all of them
 	if timeParseErr != nil {
 		return p.HandleEntryError(ctx, entry, errors.Wrap(timeParseErr, "time parser"))
 	}
 	if severityParseErr != nil {
 		return p.HandleEntryError(ctx, entry, errors.Wrap(severityParseErr, "severity parser"))
 	}
+	if traceParseErr != nil {
+		return p.HandleEntryError(ctx, entry, errors.Wrap(traceParseErr, "trace parser"))
+	}
 
 	p.Write(ctx, entry)
 	return nil
 }
 
+// Counters returns the number of invalid values of the trace context, or nil
+// if the parser does not parse a trace context
+func (p *ParserOperator) Counters() map[string]uint64 {
+	return p.TraceParser.Counters()
+}
+
 // ParseFunction is function that parses a raw value.
 type ParseFunction = func(interface{}) (interface{}, error)
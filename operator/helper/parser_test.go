@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestParserConfigMissingBase(t *testing.T) {
@@ -356,3 +357,34 @@ func TestParserWithoutPreserve(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, "test-value", actualValue)
 }
+
+func TestParserParseFromLabelsAndResource(t *testing.T) {
+	cfg := NewParserConfig("test-id", "test-type")
+	raw := `{"parse_from": "$labels['raw.line']", "parse_to": "$record.parsed"}`
+	require.NoError(t, yaml.Unmarshal([]byte(raw), &cfg))
+	require.Equal(t, entry.NewLabelField("raw.line"), cfg.ParseFrom)
+
+	parser, err := cfg.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	output := &testutil.Operator{}
+	output.On("ID").Return("test-output")
+	output.On("Process", mock.Anything, mock.Anything).Return(nil)
+	parser.OutputOperators = []operator.Operator{output}
+
+	testEntry := entry.New()
+	testEntry.Labels = map[string]string{"raw.line": "value"}
+	testEntry.Resource = map[string]string{"file_path": "/var/log/app.log"}
+	testEntry.Record = map[string]interface{}{"file_path": "kept"}
+
+	err = parser.ProcessWith(context.Background(), testEntry, func(i interface{}) (interface{}, error) {
+		return map[string]interface{}{"file_path": "parsed"}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"file_path": "kept",
+		"parsed":    map[string]interface{}{"file_path": "parsed"},
+	}, testEntry.Record)
+	require.Equal(t, map[string]string{"file_path": "/var/log/app.log"}, testEntry.Resource)
+	_, ok := testEntry.Labels["raw.line"]
+	require.False(t, ok)
+}
@@ -1,10 +1,12 @@
 package helper
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/observiq/stanza/database"
 	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
 )
 
 // Persister is a helper used to persist data
@@ -21,6 +23,10 @@ type ScopedBBoltPersister struct {
 	db       database.Database
 	cache    map[string][]byte
 	cacheMux sync.Mutex
+
+	previousScopes []string
+	logger         *zap.SugaredLogger
+	writeBehind    *database.WriteBehind
 }
 
 // NewScopedDBPersister returns a new ScopedBBoltPersister
@@ -32,6 +38,25 @@ func NewScopedDBPersister(db database.Database, scope string) *ScopedBBoltPersis
 	}
 }
 
+// NewMigratingDBPersister returns a new ScopedBBoltPersister that takes over the
+// state saved under a previous scope, such as a previous ID of its operator. The
+// state is moved to the scope the first time the persister is loaded.
+func NewMigratingDBPersister(db database.Database, scope string, previousScopes []string, logger *zap.SugaredLogger) *ScopedBBoltPersister {
+	p := NewScopedDBPersister(db, scope)
+	p.previousScopes = previousScopes
+	p.logger = logger
+	return p
+}
+
+// WithWriteBehind stages the values set on the persister in a WriteBehind,
+// which commits them with the values of other persisters. Sync waits for the
+// staged values to be committed. A nil WriteBehind leaves Sync writing the
+// values itself.
+func (p *ScopedBBoltPersister) WithWriteBehind(writeBehind *database.WriteBehind) *ScopedBBoltPersister {
+	p.writeBehind = writeBehind
+	return p
+}
+
 // Get retrieves a key from the cache
 func (p *ScopedBBoltPersister) Get(key string) []byte {
 	p.cacheMux.Lock()
@@ -44,6 +69,10 @@ func (p *ScopedBBoltPersister) Set(key string, val []byte) {
 	p.cacheMux.Lock()
 	p.cache[key] = val
 	p.cacheMux.Unlock()
+
+	if p.writeBehind != nil {
+		p.writeBehind.Set([][]byte{OffsetsBucket, p.scope}, key, val)
+	}
 }
 
 // OffsetsBucket is the scope provided to offset persistence
@@ -52,6 +81,10 @@ var OffsetsBucket = []byte(`offsets`)
 // Sync saves the cache to the backend, ensuring values are
 // safely written to disk before returning
 func (p *ScopedBBoltPersister) Sync() error {
+	if p.writeBehind != nil {
+		return p.writeBehind.Sync()
+	}
+
 	return p.db.Update(func(tx *bbolt.Tx) error {
 		offsetBucket, err := tx.CreateBucketIfNotExists(OffsetsBucket)
 		if err != nil {
@@ -89,6 +122,10 @@ func (p *ScopedBBoltPersister) Load() error {
 			return err
 		}
 
+		if err := p.migrate(offsetBucket); err != nil {
+			return err
+		}
+
 		bucket, err := offsetBucket.CreateBucketIfNotExists(p.scope)
 		if err != nil {
 			return err
@@ -100,3 +137,104 @@ func (p *ScopedBBoltPersister) Load() error {
 		})
 	})
 }
+
+// migrate moves the state saved under a previous scope to the scope of the
+// persister. State is never merged, so it is an error if more than one of the
+// scopes has state.
+func (p *ScopedBBoltPersister) migrate(offsetsBucket *bbolt.Bucket) error {
+	if len(p.previousScopes) == 0 {
+		return nil
+	}
+
+	var from string
+	for _, previous := range p.previousScopes {
+		if !hasState(offsetsBucket.Bucket([]byte(previous))) {
+			continue
+		}
+		if from != "" {
+			return fmt.Errorf("previous IDs '%s' and '%s' both have saved state. Clear one of them with `stanza offsets clear`", from, previous)
+		}
+		from = previous
+	}
+
+	if from == "" {
+		return nil
+	}
+	if err := moveScope(offsetsBucket, from, string(p.scope)); err != nil {
+		return err
+	}
+
+	if p.logger != nil {
+		p.logger.Infow("Migrated persisted state from a previous operator ID", "previous_id", from)
+	}
+	return nil
+}
+
+// RenameScope moves the state saved under one scope, such as an operator ID, to
+// another. It is an error if the old scope has no state, or if the new scope
+// already has state.
+func RenameScope(db database.Database, oldScope, newScope string) error {
+	if oldScope == newScope {
+		return fmt.Errorf("the old and new IDs are the same")
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		offsetsBucket := tx.Bucket(OffsetsBucket)
+		if offsetsBucket == nil || offsetsBucket.Bucket([]byte(oldScope)) == nil {
+			return fmt.Errorf("no offsets saved for operator '%s'", oldScope)
+		}
+		return moveScope(offsetsBucket, oldScope, newScope)
+	})
+}
+
+// moveScope moves the bucket of one scope to another. The new scope must not
+// have state, so that the state of two operators is not silently merged.
+func moveScope(offsetsBucket *bbolt.Bucket, from, to string) error {
+	if hasState(offsetsBucket.Bucket([]byte(to))) {
+		return fmt.Errorf(
+			"operator '%s' already has saved offsets, which would be overwritten by those of '%s'. "+
+				"Clear them first with `stanza offsets clear %s`", to, from, to,
+		)
+	}
+
+	if offsetsBucket.Bucket([]byte(to)) != nil {
+		if err := offsetsBucket.DeleteBucket([]byte(to)); err != nil {
+			return err
+		}
+	}
+
+	dst, err := offsetsBucket.CreateBucket([]byte(to))
+	if err != nil {
+		return err
+	}
+	if err := copyBucket(offsetsBucket.Bucket([]byte(from)), dst); err != nil {
+		return err
+	}
+	return offsetsBucket.DeleteBucket([]byte(from))
+}
+
+// copyBucket copies the keys and nested buckets of one bucket into another
+func copyBucket(src, dst *bbolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		// Keys and values point into the source bucket, which is deleted
+		// in the same transaction
+		key := append([]byte{}, k...)
+		if v != nil {
+			return dst.Put(key, append([]byte{}, v...))
+		}
+		nested, err := dst.CreateBucket(key)
+		if err != nil {
+			return err
+		}
+		return copyBucket(src.Bucket(k), nested)
+	})
+}
+
+// hasState returns true if a bucket exists and holds any keys
+func hasState(bucket *bbolt.Bucket) bool {
+	if bucket == nil {
+		return false
+	}
+	k, _ := bucket.Cursor().First()
+	return k != nil
+}
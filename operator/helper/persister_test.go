@@ -3,10 +3,12 @@ package helper
 import (
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/observiq/stanza/database"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
 )
 
 func TestPersisterCache(t *testing.T) {
@@ -33,3 +35,111 @@ func TestPersisterLoad(t *testing.T) {
 	value := newPersister.Get("key")
 	require.Equal(t, []byte("value"), value)
 }
+
+func TestPersisterWriteBehind(t *testing.T) {
+	db := testutil.NewTestDatabase(t)
+	writeBehind := database.NewWriteBehind(db, time.Hour)
+	writeBehind.Start()
+	defer writeBehind.Stop()
+
+	first := NewScopedDBPersister(db, "first").WithWriteBehind(writeBehind)
+	second := NewScopedDBPersister(db, "second").WithWriteBehind(writeBehind)
+	first.Set("key", []byte("first"))
+	second.Set("key", []byte("second"))
+
+	// Staged values are not written until they are committed
+	loaded := NewScopedDBPersister(db, "first")
+	require.NoError(t, loaded.Load())
+	require.Nil(t, loaded.Get("key"))
+
+	require.NoError(t, writeBehind.Checkpoint())
+	for _, scope := range []string{"first", "second"} {
+		loaded := NewScopedDBPersister(db, scope)
+		require.NoError(t, loaded.Load())
+		require.Equal(t, []byte(scope), loaded.Get("key"))
+	}
+}
+
+func TestPersisterMigrate(t *testing.T) {
+	save := func(t *testing.T, db database.Database, scope, value string) {
+		persister := NewScopedDBPersister(db, scope)
+		persister.Set("key", []byte(value))
+		require.NoError(t, persister.Sync())
+	}
+
+	t.Run("FromPreviousID", func(t *testing.T) {
+		db := testutil.NewTestDatabase(t)
+		save(t, db, "old", "value")
+
+		persister := NewMigratingDBPersister(db, "new", []string{"older", "old"}, zaptest.NewLogger(t).Sugar())
+		require.NoError(t, persister.Load())
+		require.Equal(t, []byte("value"), persister.Get("key"))
+
+		// The state is moved, so the previous ID no longer has state
+		err := RenameScope(db, "old", "other")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no offsets saved for operator 'old'")
+		require.NoError(t, persister.Load())
+		require.Equal(t, []byte("value"), persister.Get("key"))
+	})
+
+	t.Run("AlreadyMigrated", func(t *testing.T) {
+		db := testutil.NewTestDatabase(t)
+		save(t, db, "new", "value")
+
+		persister := NewMigratingDBPersister(db, "new", []string{"old"}, nil)
+		require.NoError(t, persister.Load())
+		require.Equal(t, []byte("value"), persister.Get("key"))
+	})
+
+	t.Run("Collision", func(t *testing.T) {
+		db := testutil.NewTestDatabase(t)
+		save(t, db, "old", "old value")
+		save(t, db, "new", "new value")
+
+		persister := NewMigratingDBPersister(db, "new", []string{"old"}, nil)
+		err := persister.Load()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "already has saved offsets")
+
+		// Neither state is changed
+		require.NoError(t, NewScopedDBPersister(db, "old").Load())
+		persister = NewScopedDBPersister(db, "new")
+		require.NoError(t, persister.Load())
+		require.Equal(t, []byte("new value"), persister.Get("key"))
+	})
+
+	t.Run("SeveralPreviousIDs", func(t *testing.T) {
+		db := testutil.NewTestDatabase(t)
+		save(t, db, "old1", "value")
+		save(t, db, "old2", "value")
+
+		persister := NewMigratingDBPersister(db, "new", []string{"old1", "old2"}, nil)
+		err := persister.Load()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "both have saved state")
+	})
+}
+
+func TestRenameScope(t *testing.T) {
+	db := testutil.NewTestDatabase(t)
+	persister := NewScopedDBPersister(db, "old")
+	persister.Set("key", []byte("value"))
+	require.NoError(t, persister.Sync())
+
+	require.NoError(t, RenameScope(db, "old", "new"))
+	renamed := NewScopedDBPersister(db, "new")
+	require.NoError(t, renamed.Load())
+	require.Equal(t, []byte("value"), renamed.Get("key"))
+
+	err := RenameScope(db, "old", "new")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no offsets saved for operator 'old'")
+
+	require.NoError(t, persister.Sync())
+	err = RenameScope(db, "old", "new")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already has saved offsets")
+
+	require.Error(t, RenameScope(db, "old", "old"))
+}
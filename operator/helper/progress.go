@@ -0,0 +1,17 @@
+package helper
+
+// PendingReporter is implemented by operators that know whether work is
+// waiting for them, such as the unread bytes of the files of an input or the
+// unflushed entries of a buffered output. PendingWork returns zero when the
+// operator is idle.
+type PendingReporter interface {
+	PendingWork() int64
+}
+
+// ProgressReporter is implemented by outputs whose progress is not the
+// number of entries they receive, such as buffered outputs, which make
+// progress when they flush entries. Progress is a counter that increases as
+// the output delivers entries.
+type ProgressReporter interface {
+	Progress() uint64
+}
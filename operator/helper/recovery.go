@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"time"
+)
+
+// RecoveryReport summarizes the persisted state restored by an operator at
+// startup.
+type RecoveryReport struct {
+	KnownFiles      int       `json:"known_files"`
+	UnreadBytes     int64     `json:"unread_bytes"`
+	BufferedEntries int64     `json:"buffered_entries"`
+	BufferedBytes   int64     `json:"buffered_bytes"`
+	OldestBuffered  time.Time `json:"oldest_buffered,omitempty"`
+	Discarded       []string  `json:"discarded,omitempty"`
+}
+
+// RecoveryReporter is implemented by operators that restore persisted state
+// when they start. RecoveryReport returns nil if no state was restored.
+type RecoveryReporter interface {
+	RecoveryReport() *RecoveryReport
+}
+
+// Merge adds the restored state of another report to this report.
+func (r *RecoveryReport) Merge(other *RecoveryReport) {
+	if other == nil {
+		return
+	}
+
+	r.KnownFiles += other.KnownFiles
+	r.UnreadBytes += other.UnreadBytes
+	r.BufferedEntries += other.BufferedEntries
+	r.BufferedBytes += other.BufferedBytes
+	if !other.OldestBuffered.IsZero() && (r.OldestBuffered.IsZero() || other.OldestBuffered.Before(r.OldestBuffered)) {
+		r.OldestBuffered = other.OldestBuffered
+	}
+	r.Discarded = append(r.Discarded, other.Discarded...)
+}
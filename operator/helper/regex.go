@@ -0,0 +1,115 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// RegexWarnSize is the size of a compiled regex program above which a
+	// warning is logged when a regex is built. Go regexes match in linear time,
+	// but the time per byte grows with the size of the program.
+	RegexWarnSize = 1000
+
+	// RegexMaxSize is the size of a compiled regex program above which a
+	// regex fails to build
+	RegexMaxSize = 20000
+
+	// RegexBudgetExceededCounter is the counter of values that were not
+	// matched because they are longer than the match budget
+	RegexBudgetExceededCounter = "regex_budget_exceeded"
+)
+
+// RegexMatcher matches a regex, with an optional budget for the length of
+// each value it matches. The time to match a value grows with the length of
+// the value and the size of the program, and the size of the program is
+// limited when the regex is built, so limiting the length of the value
+// limits the work of each match.
+type RegexMatcher struct {
+	*regexp.Regexp
+	maxLength int
+	exceeded  uint64
+}
+
+// NewRegexMatcher compiles a regex, and checks the size of its program. A
+// match of a value longer than a maxLength greater than 0 fails with an error.
+func NewRegexMatcher(pattern string, maxLength int, logger *zap.SugaredLogger) (*RegexMatcher, error) {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regex: %s", err)
+	}
+
+	size, err := RegexProgramSize(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regex: %s", err)
+	}
+	if size > RegexMaxSize {
+		return nil, fmt.Errorf("regex is too complex: its program has %d instructions, more than the limit of %d", size, RegexMaxSize)
+	}
+	if size > RegexWarnSize {
+		logger.Warnw("Regex is complex, and may be slow to match long values. Consider simplifying it or setting max_match_length",
+			"instructions", size, "warn_size", RegexWarnSize)
+	}
+
+	if maxLength < 0 {
+		return nil, fmt.Errorf("max_match_length must not be negative")
+	}
+
+	return &RegexMatcher{
+		Regexp:    r,
+		maxLength: maxLength,
+	}, nil
+}
+
+// RegexProgramSize returns the number of instructions in the compiled program of a regex
+func RegexProgramSize(pattern string) (int, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0, err
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return 0, err
+	}
+	return len(prog.Inst), nil
+}
+
+// FindStringSubmatch matches a string within the budget
+func (m *RegexMatcher) FindStringSubmatch(s string) ([]string, error) {
+	if err := m.checkBudget(len(s)); err != nil {
+		return nil, err
+	}
+	return m.Regexp.FindStringSubmatch(s), nil
+}
+
+// FindSubmatch matches a byte slice within the budget
+func (m *RegexMatcher) FindSubmatch(b []byte) ([][]byte, error) {
+	if err := m.checkBudget(len(b)); err != nil {
+		return nil, err
+	}
+	return m.Regexp.FindSubmatch(b), nil
+}
+
+// HasBudget returns true if matched values have a length budget
+func (m *RegexMatcher) HasBudget() bool {
+	return m.maxLength > 0
+}
+
+// Exceeded returns the number of values that exceeded the budget
+func (m *RegexMatcher) Exceeded() uint64 {
+	return atomic.LoadUint64(&m.exceeded)
+}
+
+// checkBudget returns an error if a value of the given length is too long
+// to match within the budget
+func (m *RegexMatcher) checkBudget(length int) error {
+	if m.maxLength <= 0 || length <= m.maxLength {
+		return nil
+	}
+	atomic.AddUint64(&m.exceeded, 1)
+	return fmt.Errorf("regex match skipped: the value is %d bytes long, more than the max_match_length of %d", length, m.maxLength)
+}
@@ -0,0 +1,116 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// slowRegex takes a few milliseconds per kilobyte of input that does not match
+const slowRegex = `(?P<value>.{0,1000}.{0,1000}x)`
+
+func TestNewRegexMatcher(t *testing.T) {
+	cases := []struct {
+		name      string
+		pattern   string
+		maxLength int
+		warns     bool
+		errorMsg  string
+	}{
+		{
+			"Simple",
+			`^(?P<key>\w+)=(?P<value>.*)$`,
+			0,
+			false,
+			"",
+		},
+		{
+			"Invalid",
+			`(?P<key>`,
+			0,
+			false,
+			"compiling regex",
+		},
+		{
+			"Complex",
+			slowRegex,
+			1000,
+			true,
+			"",
+		},
+		{
+			"TooComplex",
+			strings.Repeat(".{0,1000}", 11),
+			0,
+			false,
+			"regex is too complex",
+		},
+		{
+			"NegativeMaxLength",
+			`(?P<value>.*)`,
+			-1,
+			false,
+			"max_match_length must not be negative",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			matcher, err := NewRegexMatcher(tc.pattern, tc.maxLength, zap.New(core).Sugar())
+			if tc.errorMsg != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, matcher)
+			if tc.warns {
+				require.Equal(t, 1, logs.FilterMessageSnippet("Regex is complex").Len())
+			} else {
+				require.Equal(t, 0, logs.Len())
+			}
+		})
+	}
+}
+
+func TestRegexMatcherBudget(t *testing.T) {
+	matcher, err := NewRegexMatcher(slowRegex, 10, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+
+	matches, err := matcher.FindStringSubmatch("abcx")
+	require.NoError(t, err)
+	require.Equal(t, []string{"abcx", "abcx"}, matches)
+
+	byteMatches, err := matcher.FindSubmatch([]byte("abcx"))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("abcx"), []byte("abcx")}, byteMatches)
+
+	// A value of exactly the budget is matched
+	matches, err = matcher.FindStringSubmatch("abcdefghix")
+	require.NoError(t, err)
+	require.Equal(t, []string{"abcdefghix", "abcdefghix"}, matches)
+	require.Equal(t, uint64(0), matcher.Exceeded())
+
+	// A longer value is not matched at all
+	_, err = matcher.FindStringSubmatch("abcdefghijx")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the value is 11 bytes long, more than the max_match_length of 10")
+	_, err = matcher.FindSubmatch([]byte(strings.Repeat("ab", 10000)))
+	require.Error(t, err)
+	require.Equal(t, uint64(2), matcher.Exceeded())
+}
+
+func TestRegexMatcherWithoutBudget(t *testing.T) {
+	matcher, err := NewRegexMatcher(slowRegex, 0, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+
+	matches, err := matcher.FindStringSubmatch(strings.Repeat("ab", 1000))
+	require.NoError(t, err)
+	require.Nil(t, matches)
+	require.Equal(t, uint64(0), matcher.Exceeded())
+}
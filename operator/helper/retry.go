@@ -0,0 +1,221 @@
+package helper
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/observiq/stanza/errors"
+	"go.uber.org/zap"
+)
+
+// NewRetryConfig creates a new retry config with default values
+func NewRetryConfig() RetryConfig {
+	return RetryConfig{
+		InitialInterval: NewDuration(backoff.DefaultInitialInterval),
+		MaxInterval:     NewDuration(10 * time.Minute),
+		Multiplier:      backoff.DefaultMultiplier,
+		Jitter:          backoff.DefaultRandomizationFactor,
+	}
+}
+
+// RetryConfig is the configuration of retrying an operation that failed,
+// such as sending entries to a destination, with an exponential backoff.
+// Attempts are retried until they succeed if MaxElapsedTime is zero.
+type RetryConfig struct {
+	InitialInterval Duration `json:"initial_interval,omitempty" yaml:"initial_interval,omitempty"`
+	MaxInterval     Duration `json:"max_interval,omitempty"     yaml:"max_interval,omitempty"`
+	MaxElapsedTime  Duration `json:"max_elapsed_time,omitempty" yaml:"max_elapsed_time,omitempty"`
+	Multiplier      float64  `json:"multiplier,omitempty"       yaml:"multiplier,omitempty"`
+
+	// Jitter is the share of each interval by which it is randomly lengthened
+	// or shortened, so that agents do not retry in lockstep
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+}
+
+// Build will build a retrier from the config. A config without any fields
+// set, such as one that was not created with NewRetryConfig, builds a
+// retrier with the default values.
+func (c RetryConfig) Build(logger *zap.SugaredLogger) (*Retrier, error) {
+	config := c
+	if config == (RetryConfig{}) {
+		config = NewRetryConfig()
+	}
+
+	switch {
+	case config.InitialInterval.Raw() < 0:
+		return nil, errors.NewError("retry_on_failure initial_interval must not be negative", "")
+	case config.MaxInterval.Raw() < config.InitialInterval.Raw():
+		return nil, errors.NewError(
+			"retry_on_failure max_interval must not be less than initial_interval",
+			"raise max_interval or lower initial_interval",
+		)
+	case config.MaxElapsedTime.Raw() < 0:
+		return nil, errors.NewError(
+			"retry_on_failure max_elapsed_time must not be negative",
+			"set max_elapsed_time to 0 to retry until the attempt succeeds",
+		)
+	case config.Multiplier < 1:
+		return nil, errors.NewError("retry_on_failure multiplier must be at least 1", "")
+	case config.Jitter < 0 || config.Jitter > 1:
+		return nil, errors.NewError("retry_on_failure jitter must be between 0 and 1", "")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+
+	return &Retrier{
+		config:        config,
+		clock:         systemClock{},
+		SugaredLogger: logger,
+	}, nil
+}
+
+// retryClock is the source of time of a retrier, which tests replace
+type retryClock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+// systemClock is the clock of the system
+type systemClock struct{}
+
+// Now returns the current time
+func (systemClock) Now() time.Time { return time.Now() }
+
+// After returns a channel that receives the time once the duration elapses
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Retrier retries operations that fail with an exponential backoff. It is
+// safe to use from multiple goroutines, and each call to Do has a backoff of
+// its own.
+type Retrier struct {
+	retries  uint64
+	failures uint64
+
+	config RetryConfig
+	clock  retryClock
+
+	*zap.SugaredLogger
+}
+
+// PermanentError is an error that retrying cannot fix, such as a destination
+// rejecting a payload as invalid
+type PermanentError struct {
+	Err error
+}
+
+// NewPermanentError marks an error as one that retrying cannot fix. A
+// retrier returns a permanent error without retrying the operation.
+func NewPermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Error returns the message of the error
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error that was marked as permanent
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent returns true if an error, or an error it wraps, is permanent
+func IsPermanent(err error) bool {
+	for err != nil {
+		if _, ok := err.(*PermanentError); ok {
+			return true
+		}
+		unwrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = unwrapper.Unwrap()
+	}
+	return false
+}
+
+// Do calls the operation until it succeeds. A failed attempt is retried after
+// an interval that grows with each attempt, until the operation returns a
+// permanent error, the next retry would start after the max elapsed time, or
+// the context is done, in which case the last error, or the error of the
+// context, is returned.
+func (r *Retrier) Do(ctx context.Context, operation func() error) error {
+	b := r.newBackOff()
+	start := r.clock.Now()
+	maxElapsed := r.config.MaxElapsedTime.Raw()
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil {
+			if attempt > 1 {
+				r.Debugw("Attempt succeeded after retries", "attempts", attempt)
+			}
+			return nil
+		}
+
+		if IsPermanent(err) {
+			atomic.AddUint64(&r.failures, 1)
+			r.Errorw("Attempt failed with an error that cannot be retried", "attempts", attempt, zap.Error(err))
+			return err
+		}
+
+		// A retry that would start after the max elapsed time is not waited for
+		wait := b.NextBackOff()
+		if maxElapsed > 0 && r.clock.Now().Sub(start)+wait > maxElapsed {
+			atomic.AddUint64(&r.failures, 1)
+			r.Errorw("Attempt failed and the next retry would pass max_elapsed_time. Giving up",
+				"attempts", attempt,
+				"max_elapsed_time", r.config.MaxElapsedTime.Raw(),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		atomic.AddUint64(&r.retries, 1)
+		r.Warnw("Attempt failed. Waiting before retry", "attempt", attempt, "wait_time", wait, zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.clock.After(wait):
+		}
+	}
+}
+
+// Counters returns the number of retries, and the number of operations that
+// failed without being retried again. It returns nil until an operation has
+// failed, so operations that never fail add no counters.
+func (r *Retrier) Counters() map[string]uint64 {
+	if r == nil {
+		return nil
+	}
+	retries, failures := atomic.LoadUint64(&r.retries), atomic.LoadUint64(&r.failures)
+	if retries == 0 && failures == 0 {
+		return nil
+	}
+	return map[string]uint64{
+		"retries":        retries,
+		"retry_failures": failures,
+	}
+}
+
+// newBackOff returns the backoff of a single call to Do
+func (r *Retrier) newBackOff() *backoff.ExponentialBackOff {
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     r.config.InitialInterval.Raw(),
+		RandomizationFactor: r.config.Jitter,
+		Multiplier:          r.config.Multiplier,
+		MaxInterval:         r.config.MaxInterval.Raw(),
+		MaxElapsedTime:      0,
+		Stop:                backoff.Stop,
+		Clock:               r.clock,
+	}
+	b.Reset()
+	return b
+}
@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeClock is a clock that advances by each wait as soon as it is waited on
+type fakeClock struct {
+	mux   sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// blockingClock is a clock whose waits never end, which signals each wait
+type blockingClock struct {
+	waiting chan time.Duration
+}
+
+func (c *blockingClock) Now() time.Time { return time.Time{} }
+
+func (c *blockingClock) After(d time.Duration) <-chan time.Time {
+	c.waiting <- d
+	return make(chan time.Time)
+}
+
+// newTestRetrier builds a retrier without jitter that waits on a clock
+func newTestRetrier(t *testing.T, config RetryConfig, clock retryClock) *Retrier {
+	config.Jitter = 0
+	retrier, err := config.Build(zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	retrier.clock = clock
+	return retrier
+}
+
+// failTimes returns an operation that fails a number of times before it
+// succeeds, and counts its attempts
+func failTimes(n int, attempts *int) func() error {
+	return func() error {
+		*attempts++
+		if *attempts <= n {
+			return fmt.Errorf("attempt %d failed", *attempts)
+		}
+		return nil
+	}
+}
+
+func TestRetrierBackoff(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	config := RetryConfig{
+		InitialInterval: NewDuration(time.Second),
+		MaxInterval:     NewDuration(5 * time.Second),
+		Multiplier:      2,
+	}
+	retrier := newTestRetrier(t, config, clock)
+	require.Nil(t, retrier.Counters())
+
+	attempts := 0
+	require.NoError(t, retrier.Do(context.Background(), failTimes(5, &attempts)))
+	require.Equal(t, 6, attempts)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, clock.waits)
+	require.Equal(t, map[string]uint64{"retries": 5, "retry_failures": 0}, retrier.Counters())
+
+	// Each call starts again from the initial interval
+	clock.waits = nil
+	attempts = 0
+	require.NoError(t, retrier.Do(context.Background(), failTimes(1, &attempts)))
+	require.Equal(t, []time.Duration{time.Second}, clock.waits)
+}
+
+func TestRetrierMaxElapsedTime(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	config := RetryConfig{
+		InitialInterval: NewDuration(time.Second),
+		MaxInterval:     NewDuration(time.Minute),
+		MaxElapsedTime:  NewDuration(10 * time.Second),
+		Multiplier:      2,
+	}
+	retrier := newTestRetrier(t, config, clock)
+
+	attempts := 0
+	err := retrier.Do(context.Background(), failTimes(100, &attempts))
+	require.Error(t, err)
+	require.Equal(t, "attempt 4 failed", err.Error())
+	require.Equal(t, 4, attempts)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, clock.waits)
+	require.Equal(t, map[string]uint64{"retries": 3, "retry_failures": 1}, retrier.Counters())
+}
+
+func TestRetrierPermanentError(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	retrier := newTestRetrier(t, NewRetryConfig(), clock)
+
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{"Permanent", NewPermanentError(fmt.Errorf("rejected"))},
+		{"Wrapped", fmt.Errorf("send: %w", NewPermanentError(fmt.Errorf("rejected")))},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			err := retrier.Do(context.Background(), func() error {
+				attempts++
+				return tc.err
+			})
+			require.Equal(t, tc.err, err)
+			require.Equal(t, 1, attempts)
+			require.Empty(t, clock.waits)
+		})
+	}
+	require.Equal(t, map[string]uint64{"retries": 0, "retry_failures": 2}, retrier.Counters())
+}
+
+func TestRetrierCancelDuringBackoff(t *testing.T) {
+	clock := &blockingClock{waiting: make(chan time.Duration, 1)}
+	retrier := newTestRetrier(t, NewRetryConfig(), clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	attempts := 0
+	go func() {
+		done <- retrier.Do(ctx, failTimes(100, &attempts))
+	}()
+
+	select {
+	case <-clock.waiting:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for the retrier to back off")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		require.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "retrier did not return when its context was cancelled")
+	}
+	require.Equal(t, 1, attempts)
+}
+
+func TestIsPermanent(t *testing.T) {
+	require.False(t, IsPermanent(nil))
+	require.False(t, IsPermanent(fmt.Errorf("transient")))
+	require.True(t, IsPermanent(NewPermanentError(fmt.Errorf("permanent"))))
+	require.True(t, IsPermanent(fmt.Errorf("context: %w", NewPermanentError(fmt.Errorf("permanent")))))
+	require.False(t, IsPermanent(errors.Wrap(fmt.Errorf("transient"), "context")))
+	require.Nil(t, NewPermanentError(nil))
+}
+
+func TestRetryConfigBuild(t *testing.T) {
+	cases := []struct {
+		name     string
+		modify   func(*RetryConfig)
+		expected string
+	}{
+		{"Default", func(*RetryConfig) {}, ""},
+		{"Empty", func(c *RetryConfig) { *c = RetryConfig{} }, ""},
+		{"NoJitter", func(c *RetryConfig) { c.Jitter = 0 }, ""},
+		{
+			"NegativeInitialInterval",
+			func(c *RetryConfig) { c.InitialInterval = NewDuration(-time.Second) },
+			"initial_interval must not be negative",
+		},
+		{
+			"MaxIntervalBelowInitial",
+			func(c *RetryConfig) { c.MaxInterval = NewDuration(time.Millisecond) },
+			"max_interval must not be less than initial_interval",
+		},
+		{
+			"NegativeMaxElapsedTime",
+			func(c *RetryConfig) { c.MaxElapsedTime = NewDuration(-time.Second) },
+			"max_elapsed_time must not be negative",
+		},
+		{
+			"MultiplierBelowOne",
+			func(c *RetryConfig) { c.Multiplier = 0.5 },
+			"multiplier must be at least 1",
+		},
+		{
+			"JitterAboveOne",
+			func(c *RetryConfig) { c.Jitter = 1.5 },
+			"jitter must be between 0 and 1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := NewRetryConfig()
+			tc.modify(&config)
+			retrier, err := config.Build(nil)
+			if tc.expected != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expected)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, retrier)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package helper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// SecretConfig is a secret that an operator reads from a file or from an
+// environment variable, so that it is not written in the config itself
+type SecretConfig struct {
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	Env  string `json:"env,omitempty"  yaml:"env,omitempty"`
+}
+
+// Read reads the secret, without the whitespace around it, such as the
+// trailing newline of a file. The errors it returns never include the secret.
+func (c SecretConfig) Read() ([]byte, error) {
+	var secret string
+	switch {
+	case c.File != "" && c.Env != "":
+		return nil, fmt.Errorf("only one of 'file' or 'env' can be set")
+	case c.File != "":
+		contents, err := ioutil.ReadFile(c.File)
+		if err != nil {
+			return nil, fmt.Errorf("read secret file: %s", err)
+		}
+		secret = string(contents)
+	case c.Env != "":
+		value, ok := os.LookupEnv(c.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", c.Env)
+		}
+		secret = value
+	default:
+		return nil, fmt.Errorf("one of 'file' or 'env' must be set")
+	}
+
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return nil, fmt.Errorf("secret is empty")
+	}
+	return []byte(secret), nil
+}
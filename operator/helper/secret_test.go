@@ -0,0 +1,50 @@
+package helper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretConfigRead(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+	file := filepath.Join(dir, "secret")
+	require.NoError(t, ioutil.WriteFile(file, []byte("from-file\n"), 0600))
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, ioutil.WriteFile(empty, []byte("\n"), 0600))
+
+	os.Setenv("TEST_SECRET_CONFIG", "from-env")
+	defer os.Unsetenv("TEST_SECRET_CONFIG")
+
+	cases := []struct {
+		name     string
+		config   SecretConfig
+		expected string
+		err      string
+	}{
+		{"File", SecretConfig{File: file}, "from-file", ""},
+		{"Env", SecretConfig{Env: "TEST_SECRET_CONFIG"}, "from-env", ""},
+		{"Neither", SecretConfig{}, "", "one of 'file' or 'env' must be set"},
+		{"Both", SecretConfig{File: file, Env: "TEST_SECRET_CONFIG"}, "", "only one of 'file' or 'env'"},
+		{"MissingFile", SecretConfig{File: filepath.Join(dir, "missing")}, "", "read secret file"},
+		{"MissingEnv", SecretConfig{Env: "TEST_SECRET_CONFIG_MISSING"}, "", "TEST_SECRET_CONFIG_MISSING is not set"},
+		{"Empty", SecretConfig{File: empty}, "", "secret is empty"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret, err := tc.config.Read()
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(secret))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package helper
 import (
 	"context"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -15,6 +16,7 @@ type SeverityParser struct {
 	ParseFrom entry.Field
 	Preserve  bool
 	Mapping   severityMap
+	Default   entry.Severity
 }
 
 // Parse will parse severity from a field and attach it to the entry
@@ -33,7 +35,7 @@ func (p *SeverityParser) Parse(ctx context.Context, ent *entry.Entry) error {
 		return errors.Wrap(err, "parse")
 	}
 	if severity == entry.Nil {
-		severity = entry.Default
+		severity = p.Default
 	}
 	ent.Severity = severity
 
@@ -47,23 +49,27 @@ func (p *SeverityParser) Parse(ctx context.Context, ent *entry.Entry) error {
 type severityMap map[string]entry.Severity
 
 func (m severityMap) find(value interface{}) (entry.Severity, error) {
+	var key string
 	switch v := value.(type) {
-	case int:
-		if severity, ok := m[strconv.Itoa(v)]; ok {
-			return severity, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		key = fmt.Sprintf("%d", v)
+	case float64:
+		// Numbers parsed from JSON are float64, and match the integers of a
+		// mapping if they are whole numbers
+		if v != math.Trunc(v) || math.Abs(v) >= 1<<53 {
+			return entry.Nil, fmt.Errorf("%v cannot be a severity", v)
 		}
-		return entry.Nil, nil
+		key = strconv.FormatInt(int64(v), 10)
 	case string:
-		if severity, ok := m[strings.ToLower(v)]; ok {
-			return severity, nil
-		}
-		return entry.Nil, nil
+		key = strings.ToLower(v)
 	case []byte:
-		if severity, ok := m[strings.ToLower(string(v))]; ok {
-			return severity, nil
-		}
-		return entry.Nil, nil
+		key = strings.ToLower(string(v))
 	default:
 		return entry.Nil, fmt.Errorf("type %T cannot be a severity", v)
 	}
+
+	if severity, ok := m[key]; ok {
+		return severity, nil
+	}
+	return entry.Nil, nil
 }
@@ -71,6 +71,7 @@ type SeverityParserConfig struct {
 	Preserve  bool                        `json:"preserve,omitempty"   yaml:"preserve,omitempty"`
 	Preset    string                      `json:"preset,omitempty"     yaml:"preset,omitempty"`
 	Mapping   map[interface{}]interface{} `json:"mapping,omitempty"    yaml:"mapping,omitempty"`
+	Default   interface{}                 `json:"default,omitempty"    yaml:"default,omitempty"`
 }
 
 // Build builds a SeverityParser from a SeverityParserConfig
@@ -105,10 +106,20 @@ func (c *SeverityParserConfig) Build(context operator.BuildContext) (SeverityPar
 		return SeverityParser{}, fmt.Errorf("missing required field 'parse_from'")
 	}
 
+	defaultSeverity := entry.Default
+	if c.Default != nil {
+		sev, err := validateSeverity(c.Default)
+		if err != nil {
+			return SeverityParser{}, fmt.Errorf("invalid default severity: %s", err)
+		}
+		defaultSeverity = sev
+	}
+
 	p := SeverityParser{
 		ParseFrom: *c.ParseFrom,
 		Preserve:  c.Preserve,
 		Mapping:   operatorMapping,
+		Default:   defaultSeverity,
 	}
 
 	return p, nil
@@ -126,6 +137,12 @@ func validateSeverity(severity interface{}) (entry.Severity, error) {
 	switch s := severity.(type) {
 	case int:
 		intSev = s
+	case float64:
+		// Numbers parsed from JSON are float64
+		if s != float64(int(s)) {
+			return entry.Nil, fmt.Errorf("%v cannot be used as a severity", severity)
+		}
+		intSev = int(s)
 	case string:
 		i, err := strconv.ParseInt(s, 10, 8)
 		if err != nil {
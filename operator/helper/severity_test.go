@@ -14,6 +14,7 @@ type severityTestCase struct {
 	sample     interface{}
 	mappingSet string
 	mapping    map[interface{}]interface{}
+	fallback   interface{}
 	buildErr   bool
 	parseErr   bool
 	expected   entry.Severity
@@ -270,6 +271,76 @@ func TestSeverityParser(t *testing.T) {
 			},
 			expected: entry.Default,
 		},
+		{
+			name:     "warn-alias",
+			sample:   "WARN",
+			expected: entry.Warning,
+		},
+		{
+			name:     "crit-alias",
+			sample:   "Crit",
+			expected: entry.Critical,
+		},
+		{
+			name:     "unknown-fallback",
+			sample:   "blah",
+			fallback: "warning",
+			expected: entry.Warning,
+		},
+		{
+			name:     "unknown-fallback-int",
+			sample:   "blah",
+			fallback: 36,
+			expected: entry.Severity(36),
+		},
+		{
+			name:     "known-ignores-fallback",
+			sample:   "error",
+			fallback: "info",
+			expected: entry.Error,
+		},
+		{
+			name:     "fallback-invalid",
+			sample:   "blah",
+			fallback: "nope",
+			buildErr: true,
+		},
+		{
+			name:     "fallback-out-of-range",
+			sample:   "blah",
+			fallback: 101,
+			buildErr: true,
+		},
+		{
+			name:     "json-number",
+			sample:   float64(404),
+			mapping:  map[interface{}]interface{}{"error": 404},
+			expected: entry.Error,
+		},
+		{
+			name:     "json-number-5xx",
+			sample:   float64(503),
+			mapping:  map[interface{}]interface{}{"critical": "5xx"},
+			expected: entry.Critical,
+		},
+		{
+			name:     "int64-range",
+			sample:   int64(9010),
+			mapping:  map[interface{}]interface{}{"alert": map[interface{}]interface{}{"min": 9001, "max": 9050}},
+			expected: entry.Alert,
+		},
+		{
+			name:     "fractional-number",
+			sample:   404.5,
+			mapping:  map[interface{}]interface{}{"error": 404},
+			fallback: "info",
+			parseErr: true,
+		},
+		{
+			name:     "unsupported-type",
+			sample:   true,
+			parseErr: true,
+		},
 		{
 			name:       "base-mapping-none",
 			sample:     "error",
@@ -299,6 +370,7 @@ func (tc severityTestCase) run(t *testing.T, parseFrom entry.Field) func(*testin
 			ParseFrom: &parseFrom,
 			Preset:    tc.mappingSet,
 			Mapping:   tc.mapping,
+			Default:   tc.fallback,
 		}
 
 		severityParser, err := cfg.Build(buildContext)
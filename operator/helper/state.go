@@ -0,0 +1,10 @@
+package helper
+
+// StateSaver is implemented by operators that persist state, such as offsets,
+// bookmarks, and buffer metadata, which they resume from after a restart.
+// SaveState persists the current state without stopping the operator, so the
+// agent can save the state of every operator before it drains the pipeline
+// when it has little time to stop.
+type StateSaver interface {
+	SaveState() error
+}
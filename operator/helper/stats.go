@@ -0,0 +1,108 @@
+package helper
+
+import (
+	"sync/atomic"
+
+	"github.com/observiq/stanza/operator"
+)
+
+// OperatorStats are the counters of the entries handled by an operator since
+// it was built. The counters are updated atomically, and the methods are safe
+// to call on a nil value, in which case nothing is counted.
+type OperatorStats struct {
+	EntriesIn  uint64 `json:"entries_in"`
+	EntriesOut uint64 `json:"entries_out"`
+	Dropped    uint64 `json:"dropped"`
+	Errored    uint64 `json:"errored"`
+	Bytes      uint64 `json:"bytes,omitempty"`
+}
+
+// StatsReporter is implemented by operators that count the entries they
+// handle. OperatorStats returns nil if the operator does not count entries.
+type StatsReporter interface {
+	OperatorStats() *OperatorStats
+}
+
+// CounterReporter is implemented by operators that keep named counters in
+// addition to their OperatorStats, such as the matches of each route of a router.
+// Operators without counters, such as when an option is disabled, return nil.
+type CounterReporter interface {
+	Counters() map[string]uint64
+}
+
+// AddIn counts entries received by the operator.
+func (s *OperatorStats) AddIn(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.EntriesIn, n)
+	}
+}
+
+// AddOut counts entries sent by the operator.
+func (s *OperatorStats) AddOut(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.EntriesOut, n)
+	}
+}
+
+// AddDropped counts entries dropped by the operator.
+func (s *OperatorStats) AddDropped(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.Dropped, n)
+	}
+}
+
+// AddErrored counts entries the operator failed to process.
+func (s *OperatorStats) AddErrored(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.Errored, n)
+	}
+}
+
+// AddBytes counts bytes read or written by the operator.
+func (s *OperatorStats) AddBytes(n uint64) {
+	if s != nil {
+		atomic.AddUint64(&s.Bytes, n)
+	}
+}
+
+// Snapshot returns a copy of the current counters.
+func (s *OperatorStats) Snapshot() OperatorStats {
+	if s == nil {
+		return OperatorStats{}
+	}
+	return OperatorStats{
+		EntriesIn:  atomic.LoadUint64(&s.EntriesIn),
+		EntriesOut: atomic.LoadUint64(&s.EntriesOut),
+		Dropped:    atomic.LoadUint64(&s.Dropped),
+		Errored:    atomic.LoadUint64(&s.Errored),
+		Bytes:      atomic.LoadUint64(&s.Bytes),
+	}
+}
+
+// Add adds the counters of another snapshot to this one.
+func (s *OperatorStats) Add(other OperatorStats) {
+	s.EntriesIn += other.EntriesIn
+	s.EntriesOut += other.EntriesOut
+	s.Dropped += other.Dropped
+	s.Errored += other.Errored
+	s.Bytes += other.Bytes
+}
+
+// Sub returns the counters of this snapshot minus those of an earlier one.
+func (s OperatorStats) Sub(earlier OperatorStats) OperatorStats {
+	return OperatorStats{
+		EntriesIn:  s.EntriesIn - earlier.EntriesIn,
+		EntriesOut: s.EntriesOut - earlier.EntriesOut,
+		Dropped:    s.Dropped - earlier.Dropped,
+		Errored:    s.Errored - earlier.Errored,
+		Bytes:      s.Bytes - earlier.Bytes,
+	}
+}
+
+// RecordReceived counts an entry received by an operator, if the operator
+// counts entries.
+func RecordReceived(op operator.Operator) {
+	if reporter, ok := op.(StatsReporter); ok {
+		reporter.OperatorStats().AddIn(1)
+	}
+}
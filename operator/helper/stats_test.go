@@ -0,0 +1,44 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperatorStatsNil(t *testing.T) {
+	var stats *OperatorStats
+	stats.AddIn(1)
+	stats.AddOut(1)
+	stats.AddDropped(1)
+	stats.AddErrored(1)
+	stats.AddBytes(1)
+	require.Equal(t, OperatorStats{}, stats.Snapshot())
+}
+
+func TestOperatorStatsSnapshot(t *testing.T) {
+	stats := &OperatorStats{}
+	stats.AddIn(5)
+	stats.AddOut(4)
+	stats.AddDropped(1)
+	stats.AddErrored(2)
+	stats.AddBytes(100)
+
+	snapshot := stats.Snapshot()
+	require.Equal(t, OperatorStats{EntriesIn: 5, EntriesOut: 4, Dropped: 1, Errored: 2, Bytes: 100}, snapshot)
+
+	// The snapshot does not change with the counters
+	stats.AddIn(1)
+	require.Equal(t, uint64(5), snapshot.EntriesIn)
+}
+
+func TestOperatorStatsArithmetic(t *testing.T) {
+	earlier := OperatorStats{EntriesIn: 5, EntriesOut: 4, Dropped: 1, Errored: 1, Bytes: 100}
+	later := OperatorStats{EntriesIn: 8, EntriesOut: 6, Dropped: 2, Errored: 1, Bytes: 150}
+
+	delta := later.Sub(earlier)
+	require.Equal(t, OperatorStats{EntriesIn: 3, EntriesOut: 2, Dropped: 1, Bytes: 50}, delta)
+
+	delta.Add(earlier)
+	require.Equal(t, later, delta)
+}
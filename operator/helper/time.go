@@ -39,6 +39,8 @@ type TimeParser struct {
 	Layout     string       `json:"layout,omitempty"      yaml:"layout,omitempty"`
 	LayoutType string       `json:"layout_type,omitempty" yaml:"layout_type,omitempty"`
 	Preserve   bool         `json:"preserve"              yaml:"preserve"`
+
+	location *time.Location
 }
 
 // IsZero returns true if the TimeParser is not a valid config
@@ -60,6 +62,8 @@ func (t *TimeParser) Validate(context operator.BuildContext) error {
 		t.LayoutType = StrptimeKey
 	}
 
+	t.location = context.DefaultLocation
+
 	switch t.LayoutType {
 	case NativeKey, GotimeKey: // ok
 	case StrptimeKey:
@@ -130,11 +134,16 @@ func (t *TimeParser) Parse(ctx context.Context, entry *entry.Entry) error {
 }
 
 func (t *TimeParser) parseGotime(value interface{}) (time.Time, error) {
+	location := t.location
+	if location == nil {
+		location = time.Local
+	}
+
 	switch v := value.(type) {
 	case string:
-		return time.ParseInLocation(t.Layout, v, time.Local)
+		return time.ParseInLocation(t.Layout, v, location)
 	case []byte:
-		return time.ParseInLocation(t.Layout, string(v), time.Local)
+		return time.ParseInLocation(t.Layout, string(v), location)
 	default:
 		return time.Time{}, fmt.Errorf("type %T cannot be parsed as a time", value)
 	}
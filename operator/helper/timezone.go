@@ -0,0 +1,36 @@
+package helper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/observiq/stanza/errors"
+)
+
+// loadLocation loads a location from the time zone database. Tests replace
+// it to simulate a system without the database.
+var loadLocation = time.LoadLocation
+
+// LoadLocation loads a time zone by its name in the IANA time zone database,
+// such as America/New_York. Container images built from scratch do not have
+// the database, so if it is missing, the error says how to provide it.
+func LoadLocation(name string) (*time.Location, error) {
+	location, err := loadLocation(name)
+	if err == nil {
+		return location, nil
+	}
+
+	if _, dbErr := loadLocation("Etc/UTC"); dbErr != nil {
+		return nil, errors.NewError(
+			fmt.Sprintf("failed to load time zone '%s' because the time zone database was not found", name),
+			"install the tzdata package, set the ZONEINFO environment variable to the path of a zoneinfo directory or zip file, or build stanza with the tzdata build tag to embed the database",
+			"timezone", name,
+		)
+	}
+
+	return nil, errors.NewError(
+		fmt.Sprintf("unknown time zone '%s'", name),
+		"use a name from the IANA time zone database, such as America/New_York or UTC",
+		"timezone", name,
+	)
+}
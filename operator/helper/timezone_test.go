@@ -0,0 +1,118 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// withoutZoneDatabase simulates a container image built from scratch by
+// pointing TZDIR and ZONEINFO at an empty directory. Go always searches the
+// system zoneinfo directories as well, so zones are only loaded from ZONEINFO
+// while the test runs.
+func withoutZoneDatabase(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+	for _, key := range []string{"TZDIR", "ZONEINFO"} {
+		previous, ok := os.LookupEnv(key)
+		require.NoError(t, os.Setenv(key, dir))
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+
+	t.Cleanup(func() { loadLocation = time.LoadLocation })
+	loadLocation = func(name string) (*time.Location, error) {
+		if name == "" || name == "UTC" || name == "Local" {
+			return time.LoadLocation(name)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(os.Getenv("ZONEINFO"), name))
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %s", name)
+		}
+		return time.LoadLocationFromTZData(name, data)
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		location, err := LoadLocation("America/New_York")
+		require.NoError(t, err)
+		require.Equal(t, "America/New_York", location.String())
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := LoadLocation("Mars/Olympus")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown time zone 'Mars/Olympus'")
+	})
+
+	t.Run("MissingDatabase", func(t *testing.T) {
+		withoutZoneDatabase(t)
+		_, err := LoadLocation("America/New_York")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the time zone database was not found")
+		agentErr, ok := err.(errors.AgentError)
+		require.True(t, ok)
+		require.Contains(t, agentErr.Suggestion, "tzdata")
+	})
+
+	t.Run("UTCWithoutDatabase", func(t *testing.T) {
+		withoutZoneDatabase(t)
+		location, err := LoadLocation("UTC")
+		require.NoError(t, err)
+		require.Equal(t, time.UTC, location)
+	})
+}
+
+func TestTimeParserDefaultLocation(t *testing.T) {
+	location, err := LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		layout   string
+		value    string
+		expected time.Time
+	}{
+		{
+			"WithoutZone",
+			"%Y-%m-%d %H:%M:%S",
+			"2020-06-01 12:00:00",
+			time.Date(2020, 6, 1, 12, 0, 0, 0, location),
+		},
+		{
+			"WithZone",
+			"%Y-%m-%d %H:%M:%S %z",
+			"2020-06-01 12:00:00 +0000",
+			time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buildContext := testutil.NewBuildContext(t)
+			buildContext.DefaultLocation = location
+
+			timeParser := parseTimeTestConfig(StrptimeKey, tc.layout, entry.NewRecordField("timestamp"))
+			require.NoError(t, timeParser.Validate(buildContext))
+
+			ent := makeTestEntry(entry.NewRecordField("timestamp"), tc.value)
+			require.NoError(t, timeParser.Parse(context.Background(), ent))
+			require.True(t, tc.expected.Equal(ent.Timestamp), ent.Timestamp.String())
+		})
+	}
+}
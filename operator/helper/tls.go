@@ -0,0 +1,312 @@
+package helper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsVersions are the names of the TLS versions that can be configured
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSVersion is a version of TLS, such as 1.2
+type TLSVersion uint16
+
+// NewTLSVersion returns the TLS version with a name, such as 1.2
+func NewTLSVersion(name string) (TLSVersion, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid tls version '%s': must be one of 1.0, 1.1, 1.2, or 1.3", name)
+	}
+	return TLSVersion(version), nil
+}
+
+// String returns the name of the version
+func (v TLSVersion) String() string {
+	for name, version := range tlsVersions {
+		if uint16(v) == version {
+			return name
+		}
+	}
+	return ""
+}
+
+// MarshalJSON will marshal the version as a json string
+func (v TLSVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+// UnmarshalJSON will unmarshal a version from a json string or number
+func (v *TLSVersion) UnmarshalJSON(raw []byte) error {
+	name := strings.Trim(string(raw), `"`)
+	version, err := NewTLSVersion(name)
+	if err != nil {
+		return err
+	}
+	*v = version
+	return nil
+}
+
+// MarshalYAML will marshal the version as a yaml string
+func (v TLSVersion) MarshalYAML() (interface{}, error) {
+	return v.String(), nil
+}
+
+// UnmarshalYAML will unmarshal a version from a yaml string or number
+func (v *TLSVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	version, err := NewTLSVersion(name)
+	if err != nil {
+		return err
+	}
+	*v = version
+	return nil
+}
+
+// TLSConfig is the TLS configuration of an operator that listens for or
+// dials connections
+type TLSConfig struct {
+	// CertFile and KeyFile are the certificate and private key that the
+	// operator presents to its peers
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"  yaml:"key_file,omitempty"`
+
+	// CAFile is a bundle of certificate authorities that the certificates of
+	// servers are verified with, instead of the system roots
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+
+	// ClientCA is a bundle of certificate authorities. When it is set,
+	// clients must present a certificate signed by one of them.
+	ClientCA string `json:"client_ca,omitempty" yaml:"client_ca,omitempty"`
+
+	// InsecureSkipVerify disables the verification of the certificates of servers
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+
+	// MinVersion is the lowest version of TLS that is accepted, which is 1.2
+	// if it is not set
+	MinVersion TLSVersion `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+
+	// ReloadInterval is how often the certificate and client CAs are checked
+	// for changes on disk, and reloaded if they changed. They are never
+	// reloaded if it is not set.
+	ReloadInterval Duration `json:"reload_interval,omitempty" yaml:"reload_interval,omitempty"`
+}
+
+// LoadTLSConfig loads the certificates of the config. The errors returned
+// name the file that could not be loaded.
+func (c TLSConfig) LoadTLSConfig() (*tls.Config, error) {
+	files, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		RootCAs:            files.rootCAs,
+		InsecureSkipVerify: c.InsecureSkipVerify, // #nosec G402 - opt in for test servers
+	}
+	if c.MinVersion != 0 {
+		config.MinVersion = uint16(c.MinVersion)
+	}
+	if files.cert != nil {
+		config.Certificates = []tls.Certificate{*files.cert}
+	}
+	if files.clientCAs != nil {
+		config.ClientCAs = files.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if c.ReloadInterval.Raw() > 0 && (c.CertFile != "" || c.ClientCA != "") {
+		reloader := newTLSReloader(c, config, files)
+		if c.CertFile != "" {
+			config.GetClientCertificate = reloader.getClientCertificate
+		}
+		config.GetConfigForClient = reloader.getConfigForClient
+	}
+
+	return config, nil
+}
+
+// tlsFiles are the certificates loaded from the files of a config
+type tlsFiles struct {
+	cert      *tls.Certificate
+	rootCAs   *x509.CertPool
+	clientCAs *x509.CertPool
+}
+
+// load loads the files of the config
+func (c TLSConfig) load() (*tlsFiles, error) {
+	files := &tlsFiles{}
+
+	switch {
+	case c.CertFile != "" && c.KeyFile == "":
+		return nil, fmt.Errorf("tls cert_file %s requires key_file", c.CertFile)
+	case c.CertFile == "" && c.KeyFile != "":
+		return nil, fmt.Errorf("tls key_file %s requires cert_file", c.KeyFile)
+	case c.CertFile != "":
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls certificate %s: %s", c.CertFile, err)
+		}
+		files.cert = &cert
+	}
+
+	var err error
+	if c.CAFile != "" {
+		if files.rootCAs, err = loadCertPool("ca_file", c.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if c.ClientCA != "" {
+		if files.clientCAs, err = loadCertPool("client_ca", c.ClientCA); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// loadCertPool loads a bundle of certificate authorities
+func loadCertPool(field, path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %s", field, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s %s holds no certificates", field, path)
+	}
+	return pool, nil
+}
+
+// tlsReloader reloads the certificate and client CAs of a config when their
+// files change. The files are checked during handshakes, at most once per
+// reload interval, so a reloader needs no goroutine of its own.
+type tlsReloader struct {
+	config   TLSConfig
+	base     *tls.Config
+	interval time.Duration
+
+	mux      sync.Mutex
+	checked  time.Time
+	modTimes []time.Time
+	files    *tlsFiles
+	server   *tls.Config
+}
+
+// newTLSReloader creates a reloader of the files of a config, which were
+// loaded into a base tls config
+func newTLSReloader(config TLSConfig, base *tls.Config, files *tlsFiles) *tlsReloader {
+	r := &tlsReloader{
+		config:   config,
+		base:     base,
+		interval: config.ReloadInterval.Raw(),
+		checked:  time.Now(),
+	}
+	r.modTimes = r.stat()
+	r.setFiles(files)
+	return r
+}
+
+// paths returns the files that are reloaded
+func (r *tlsReloader) paths() []string {
+	return []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCA}
+}
+
+// stat returns the modification times of the files that are reloaded
+func (r *tlsReloader) stat() []time.Time {
+	paths := r.paths()
+	modTimes := make([]time.Time, len(paths))
+	for i, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// setFiles sets the files the reloader serves, and the config that servers
+// use for handshakes
+func (r *tlsReloader) setFiles(files *tlsFiles) {
+	server := r.base.Clone()
+	server.GetConfigForClient = nil
+	server.GetClientCertificate = nil
+	if files.cert != nil {
+		server.Certificates = []tls.Certificate{*files.cert}
+	}
+	if files.clientCAs != nil {
+		server.ClientCAs = files.clientCAs
+	}
+
+	r.files = files
+	r.server = server
+}
+
+// current returns the files to use for a handshake, after reloading them if
+// the interval has passed and they changed. If they cannot be loaded, such
+// as while a certificate has been replaced but its key has not, the files
+// that were loaded last are used until the next check.
+func (r *tlsReloader) current() (*tlsFiles, *tls.Config) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.checked) < r.interval {
+		return r.files, r.server
+	}
+	r.checked = now
+
+	modTimes := r.stat()
+	if timesEqual(modTimes, r.modTimes) {
+		return r.files, r.server
+	}
+
+	files, err := r.config.load()
+	if err != nil {
+		return r.files, r.server
+	}
+	r.modTimes = modTimes
+	r.setFiles(files)
+	return r.files, r.server
+}
+
+// getConfigForClient returns the config of a server handshake
+func (r *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	_, server := r.current()
+	return server, nil
+}
+
+// getClientCertificate returns the certificate of a client handshake
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	files, _ := r.current()
+	return files.cert, nil
+}
+
+// timesEqual returns true if two lists of times are equal
+func timesEqual(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,323 @@
+package helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// testCA is a certificate authority that signs test certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+// newTestCA creates a certificate authority, and writes its certificate to a file
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "stanza test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &testCA{cert: cert, key: key, path: path}
+}
+
+// writeCert writes a certificate signed by the authority, and its key, to
+// files named after the certificate
+func (ca *testCA) writeCert(t *testing.T, dir, name string, serial int64) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+// handshake connects a client to a server, and returns the serial number of
+// the certificate the server presented
+func handshake(t *testing.T, server, client *tls.Config) (*big.Int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), client)
+	if err != nil {
+		<-serverErr
+		return nil, err
+	}
+	defer conn.Close()
+	if err := <-serverErr; err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber, nil
+}
+
+func TestTLSVersion(t *testing.T) {
+	cases := []struct {
+		name      string
+		unmarshal func(*TLSVersion) error
+		expected  TLSVersion
+		expectErr bool
+	}{
+		{"JSONString", func(v *TLSVersion) error { return json.Unmarshal([]byte(`"1.3"`), v) }, tls.VersionTLS13, false},
+		{"JSONNumber", func(v *TLSVersion) error { return json.Unmarshal([]byte(`1.2`), v) }, tls.VersionTLS12, false},
+		{"YAMLString", func(v *TLSVersion) error { return yaml.Unmarshal([]byte(`"1.1"`), v) }, tls.VersionTLS11, false},
+		{"YAMLNumber", func(v *TLSVersion) error { return yaml.Unmarshal([]byte(`1.0`), v) }, tls.VersionTLS10, false},
+		{"Invalid", func(v *TLSVersion) error { return yaml.Unmarshal([]byte(`"1.4"`), v) }, 0, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var version TLSVersion
+			err := tc.unmarshal(&version)
+			if tc.expectErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "invalid tls version '1.4'")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, version)
+		})
+	}
+
+	marshalled, err := json.Marshal(TLSConfig{MinVersion: tls.VersionTLS13})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"min_version": "1.3", "reload_interval": "0s"}`, string(marshalled))
+}
+
+func TestLoadTLSConfigErrors(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.writeCert(t, dir, "server", 2)
+	missing := filepath.Join(dir, "missing.pem")
+
+	cases := []struct {
+		name     string
+		config   TLSConfig
+		expected string
+	}{
+		{"CertWithoutKey", TLSConfig{CertFile: certFile}, "tls cert_file " + certFile + " requires key_file"},
+		{"KeyWithoutCert", TLSConfig{KeyFile: keyFile}, "tls key_file " + keyFile + " requires cert_file"},
+		{"MissingCert", TLSConfig{CertFile: missing, KeyFile: keyFile}, "load tls certificate " + missing},
+		{"MismatchedKey", TLSConfig{CertFile: certFile, KeyFile: ca.path}, "load tls certificate " + certFile},
+		{"MissingCA", TLSConfig{CAFile: missing}, "read ca_file: open " + missing},
+		{"InvalidCA", TLSConfig{CAFile: keyFile}, "ca_file " + keyFile + " holds no certificates"},
+		{"MissingClientCA", TLSConfig{ClientCA: missing}, "read client_ca: open " + missing},
+		{"InvalidClientCA", TLSConfig{ClientCA: keyFile}, "client_ca " + keyFile + " holds no certificates"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.config.LoadTLSConfig()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.writeCert(t, dir, "server", 2)
+	clientCert, clientKey := ca.writeCert(t, dir, "client", 3)
+
+	t.Run("Server", func(t *testing.T) {
+		server, err := TLSConfig{CertFile: serverCert, KeyFile: serverKey}.LoadTLSConfig()
+		require.NoError(t, err)
+		require.Equal(t, uint16(tls.VersionTLS12), server.MinVersion)
+
+		client, err := TLSConfig{CAFile: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+		serial, err := handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), serial.Int64())
+
+		// The system roots do not trust the test authority
+		client, err = TLSConfig{}.LoadTLSConfig()
+		require.NoError(t, err)
+		_, err = handshake(t, server, client)
+		require.Error(t, err)
+
+		client, err = TLSConfig{InsecureSkipVerify: true}.LoadTLSConfig()
+		require.NoError(t, err)
+		_, err = handshake(t, server, client)
+		require.NoError(t, err)
+	})
+
+	t.Run("Mutual", func(t *testing.T) {
+		server, err := TLSConfig{CertFile: serverCert, KeyFile: serverKey, ClientCA: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+		require.Equal(t, tls.RequireAndVerifyClientCert, server.ClientAuth)
+
+		client, err := TLSConfig{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+		_, err = handshake(t, server, client)
+		require.NoError(t, err)
+
+		client, err = TLSConfig{CAFile: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+		_, err = handshake(t, server, client)
+		require.Error(t, err)
+	})
+
+	t.Run("MinVersion", func(t *testing.T) {
+		server, err := TLSConfig{CertFile: serverCert, KeyFile: serverKey, MinVersion: tls.VersionTLS13}.LoadTLSConfig()
+		require.NoError(t, err)
+
+		client, err := TLSConfig{CAFile: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+		client.MaxVersion = tls.VersionTLS12
+		_, err = handshake(t, server, client)
+		require.Error(t, err)
+	})
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	dir := testutil.NewTempDir(t)
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.writeCert(t, dir, "server", 2)
+	clientCert, clientKey := ca.writeCert(t, dir, "client", 3)
+
+	// rotate writes a new certificate over the old one, and moves its
+	// modification time forward in case the file system is coarse
+	rotate := func(name string, serial int64) {
+		certFile, keyFile := ca.writeCert(t, dir, name, serial)
+		later := time.Now().Add(time.Duration(serial) * time.Second)
+		require.NoError(t, os.Chtimes(certFile, later, later))
+		require.NoError(t, os.Chtimes(keyFile, later, later))
+	}
+
+	t.Run("Server", func(t *testing.T) {
+		server, err := TLSConfig{
+			CertFile:       serverCert,
+			KeyFile:        serverKey,
+			ReloadInterval: NewDuration(time.Millisecond),
+		}.LoadTLSConfig()
+		require.NoError(t, err)
+		client, err := TLSConfig{CAFile: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+
+		serial, err := handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), serial.Int64())
+
+		rotate("server", 4)
+		time.Sleep(5 * time.Millisecond)
+		serial, err = handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, int64(4), serial.Int64())
+
+		// A certificate that does not match its key yet is not loaded, so
+		// the last certificate is used until the key is replaced too
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, ioutil.WriteFile(serverKey, []byte("partial"), 0600))
+		require.NoError(t, os.Chtimes(serverKey, later, later))
+		time.Sleep(5 * time.Millisecond)
+		serial, err = handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, int64(4), serial.Int64())
+
+		rotate("server", 5)
+		time.Sleep(5 * time.Millisecond)
+		serial, err = handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), serial.Int64())
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		var presented []int64
+		server, err := TLSConfig{CertFile: serverCert, KeyFile: serverKey, ClientCA: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+		server.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			presented = append(presented, chains[0][0].SerialNumber.Int64())
+			return nil
+		}
+
+		client, err := TLSConfig{
+			CertFile:       clientCert,
+			KeyFile:        clientKey,
+			CAFile:         ca.path,
+			ReloadInterval: NewDuration(time.Millisecond),
+		}.LoadTLSConfig()
+		require.NoError(t, err)
+
+		_, err = handshake(t, server, client)
+		require.NoError(t, err)
+		rotate("client", 6)
+		time.Sleep(5 * time.Millisecond)
+		_, err = handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, []int64{3, 6}, presented)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		certFile, keyFile := ca.writeCert(t, dir, "static", 7)
+		server, err := TLSConfig{CertFile: certFile, KeyFile: keyFile}.LoadTLSConfig()
+		require.NoError(t, err)
+		client, err := TLSConfig{CAFile: ca.path}.LoadTLSConfig()
+		require.NoError(t, err)
+
+		rotate("static", 8)
+		serial, err := handshake(t, server, client)
+		require.NoError(t, err)
+		require.Equal(t, int64(7), serial.Int64())
+	})
+}
@@ -0,0 +1,309 @@
+package helper
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+)
+
+const (
+	// DefaultTraceRegex matches key value pairs such as trace_id=abc,
+	// spanId: def or "traceId":"abc", and W3C traceparent values, anywhere in a string
+	DefaultTraceRegex = `\b(?i:trace_?id)"?[=:]\s*"?(?P<trace_id>\w+)|\b(?i:span_?id)"?[=:]\s*"?(?P<span_id>\w+)|\b(?i:trace_?flags)"?[=:]\s*"?(?P<trace_flags>\w+)|\b(?P<traceparent>[0-9a-fA-F]{2}-[0-9a-fA-F]{32}-[0-9a-fA-F]{16}-[0-9a-fA-F]{2})\b`
+
+	traceIDSize    = 16
+	spanIDSize     = 8
+	traceFlagsSize = 1
+
+	// InvalidTraceIDCounter is the counter of trace IDs that were not set on
+	// an entry because they were not 32 hex characters
+	InvalidTraceIDCounter = "invalid_trace_id"
+	// InvalidSpanIDCounter is the counter of span IDs that were not set on
+	// an entry because they were not 16 hex characters
+	InvalidSpanIDCounter = "invalid_span_id"
+	// InvalidTraceFlagsCounter is the counter of trace flags that were not
+	// set on an entry because they were not 2 hex characters
+	InvalidTraceFlagsCounter = "invalid_trace_flags"
+	// InvalidTraceparentCounter is the counter of W3C traceparent values that
+	// were not set on an entry because they were malformed
+	InvalidTraceparentCounter = "invalid_traceparent"
+)
+
+// traceGroups are the regex groups from which the trace context is extracted
+var traceGroups = []string{"trace_id", "span_id", "trace_flags", "traceparent"}
+
+// NewTraceParserConfig creates a new trace parser config
+func NewTraceParserConfig() TraceParserConfig {
+	return TraceParserConfig{}
+}
+
+// TraceParserConfig allows users to specify how to parse the trace context of an entry.
+type TraceParserConfig struct {
+	ParseFrom   *entry.Field      `json:"parse_from,omitempty"  yaml:"parse_from,omitempty"`
+	Regex       string            `json:"regex,omitempty"       yaml:"regex,omitempty"`
+	TraceID     *TraceFieldConfig `json:"trace_id,omitempty"    yaml:"trace_id,omitempty"`
+	SpanID      *TraceFieldConfig `json:"span_id,omitempty"     yaml:"span_id,omitempty"`
+	TraceFlags  *TraceFieldConfig `json:"trace_flags,omitempty" yaml:"trace_flags,omitempty"`
+	Traceparent *TraceFieldConfig `json:"traceparent,omitempty" yaml:"traceparent,omitempty"`
+	Preserve    bool              `json:"preserve,omitempty"    yaml:"preserve,omitempty"`
+}
+
+// TraceFieldConfig is the field from which a part of the trace context is parsed.
+type TraceFieldConfig struct {
+	ParseFrom *entry.Field `json:"parse_from,omitempty" yaml:"parse_from,omitempty"`
+}
+
+// Build builds a TraceParser from a TraceParserConfig
+func (c *TraceParserConfig) Build(context operator.BuildContext) (TraceParser, error) {
+	parser := TraceParser{
+		Preserve: c.Preserve,
+		counters: &traceCounters{},
+	}
+
+	if c.ParseFrom == nil {
+		if c.Regex != "" {
+			return TraceParser{}, fmt.Errorf("regex requires parse_from")
+		}
+		parser.TraceID = fieldOrDefault(c.TraceID, "trace_id")
+		parser.SpanID = fieldOrDefault(c.SpanID, "span_id")
+		parser.TraceFlags = fieldOrDefault(c.TraceFlags, "trace_flags")
+		if c.Traceparent != nil {
+			parser.Traceparent = c.Traceparent.ParseFrom
+		}
+		return parser, nil
+	}
+
+	if c.TraceID != nil || c.SpanID != nil || c.TraceFlags != nil || c.Traceparent != nil {
+		return TraceParser{}, fmt.Errorf("parse_from cannot be used with trace_id, span_id, trace_flags or traceparent")
+	}
+
+	pattern := c.Regex
+	if pattern == "" {
+		pattern = DefaultTraceRegex
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return TraceParser{}, fmt.Errorf("compiling trace regex: %s", err)
+	}
+
+	hasGroup := false
+	for _, name := range r.SubexpNames() {
+		for _, group := range traceGroups {
+			hasGroup = hasGroup || name == group
+		}
+	}
+	if !hasGroup {
+		return TraceParser{}, fmt.Errorf("trace regex must have a named capture group trace_id, span_id, trace_flags or traceparent")
+	}
+
+	parser.ParseFrom = c.ParseFrom
+	parser.Regex = r
+	return parser, nil
+}
+
+// fieldOrDefault returns the field of a config, or a record field with a default name
+func fieldOrDefault(config *TraceFieldConfig, name string) *entry.Field {
+	if config != nil && config.ParseFrom != nil {
+		return config.ParseFrom
+	}
+	field := entry.NewRecordField(name)
+	return &field
+}
+
+// TraceParser is a helper that parses the trace context of an entry, either
+// from the fields of the trace context, or with a regex that is matched
+// against a single field. Invalid values are not set on the entry, and are
+// counted instead of failing the entry.
+type TraceParser struct {
+	ParseFrom *entry.Field
+	Regex     *regexp.Regexp
+
+	TraceID     *entry.Field
+	SpanID      *entry.Field
+	TraceFlags  *entry.Field
+	Traceparent *entry.Field
+	Preserve    bool
+
+	counters *traceCounters
+}
+
+// traceCounters count the values that were not set on entries because they were invalid
+type traceCounters struct {
+	traceID     uint64
+	spanID      uint64
+	traceFlags  uint64
+	traceparent uint64
+}
+
+// Parse will parse the trace context of an entry and set it on the entry
+func (p *TraceParser) Parse(ctx context.Context, ent *entry.Entry) error {
+	if p.Regex != nil {
+		return p.parseRegex(ent)
+	}
+
+	if p.Traceparent != nil {
+		if value, ok := p.get(ent, p.Traceparent); ok {
+			p.setTraceparent(ent, value)
+		}
+	}
+	if value, ok := p.get(ent, p.TraceID); ok {
+		p.set(ent, value, traceIDSize, &ent.TraceID, &p.counters.traceID)
+	}
+	if value, ok := p.get(ent, p.SpanID); ok {
+		p.set(ent, value, spanIDSize, &ent.SpanID, &p.counters.spanID)
+	}
+	if value, ok := p.get(ent, p.TraceFlags); ok {
+		p.set(ent, value, traceFlagsSize, &ent.TraceFlags, &p.counters.traceFlags)
+	}
+	return nil
+}
+
+// get returns the value of a field as a string, and deletes the field
+// unless it is preserved
+func (p *TraceParser) get(ent *entry.Entry, field *entry.Field) (string, bool) {
+	value, ok := ent.Get(field)
+	if !ok {
+		return "", false
+	}
+	if !p.Preserve {
+		ent.Delete(field)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	default:
+		// A value that is not a string is invalid, so it is counted
+		return fmt.Sprintf("%v", v), true
+	}
+}
+
+// parseRegex parses the trace context from the matches of the regex in a
+// field. Each group is taken from the first match in which it is set.
+func (p *TraceParser) parseRegex(ent *entry.Entry) error {
+	value, ok := ent.Get(p.ParseFrom)
+	if !ok {
+		return nil
+	}
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("type '%T' cannot be parsed for a trace context", value)
+	}
+
+	values := make(map[string]string, len(traceGroups))
+	names := p.Regex.SubexpNames()
+	for _, match := range p.Regex.FindAllStringSubmatch(s, -1) {
+		for i, name := range names {
+			if i > 0 && name != "" && match[i] != "" {
+				if _, ok := values[name]; !ok {
+					values[name] = match[i]
+				}
+			}
+		}
+	}
+
+	if value, ok := values["traceparent"]; ok {
+		p.setTraceparent(ent, value)
+	}
+	if value, ok := values["trace_id"]; ok {
+		p.set(ent, value, traceIDSize, &ent.TraceID, &p.counters.traceID)
+	}
+	if value, ok := values["span_id"]; ok {
+		p.set(ent, value, spanIDSize, &ent.SpanID, &p.counters.spanID)
+	}
+	if value, ok := values["trace_flags"]; ok {
+		p.set(ent, value, traceFlagsSize, &ent.TraceFlags, &p.counters.traceFlags)
+	}
+	return nil
+}
+
+// set decodes a hex value of a size in bytes to a field of the entry, or
+// counts it as invalid
+func (p *TraceParser) set(ent *entry.Entry, value string, size int, dest *entry.HexBytes, invalid *uint64) {
+	decoded, ok := decodeTraceHex(value, size)
+	if !ok {
+		atomic.AddUint64(invalid, 1)
+		return
+	}
+	*dest = decoded
+}
+
+// setTraceparent sets the trace context from a W3C traceparent value, such
+// as 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (p *TraceParser) setTraceparent(ent *entry.Entry, value string) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || strings.EqualFold(parts[0], "ff") || (parts[0] == "00" && len(parts) != 4) {
+		atomic.AddUint64(&p.counters.traceparent, 1)
+		return
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		atomic.AddUint64(&p.counters.traceparent, 1)
+		return
+	}
+
+	traceID, okTrace := decodeTraceHex(parts[1], traceIDSize)
+	spanID, okSpan := decodeTraceHex(parts[2], spanIDSize)
+	traceFlags, okFlags := decodeTraceHex(parts[3], traceFlagsSize)
+	if !okTrace || !okSpan || !okFlags {
+		atomic.AddUint64(&p.counters.traceparent, 1)
+		return
+	}
+
+	ent.TraceID = traceID
+	ent.SpanID = spanID
+	ent.TraceFlags = traceFlags
+}
+
+// decodeTraceHex decodes a hex value of either case that is exactly size
+// bytes long. IDs of all zeros are invalid, as in the W3C trace context.
+func decodeTraceHex(value string, size int) ([]byte, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) != size*2 {
+		return nil, false
+	}
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	if size > traceFlagsSize && isZero(decoded) {
+		return nil, false
+	}
+	return decoded, true
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Counters returns the number of values of each part of the trace context
+// that were not set on entries because they were invalid
+func (p *TraceParser) Counters() map[string]uint64 {
+	if p == nil || p.counters == nil {
+		return nil
+	}
+	return map[string]uint64{
+		InvalidTraceIDCounter:     atomic.LoadUint64(&p.counters.traceID),
+		InvalidSpanIDCounter:      atomic.LoadUint64(&p.counters.spanID),
+		InvalidTraceFlagsCounter:  atomic.LoadUint64(&p.counters.traceFlags),
+		InvalidTraceparentCounter: atomic.LoadUint64(&p.counters.traceparent),
+	}
+}
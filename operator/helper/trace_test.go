@@ -0,0 +1,235 @@
+package helper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testTraceID    = entry.HexBytes{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	testSpanID     = entry.HexBytes{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	testTraceFlags = entry.HexBytes{0x01}
+)
+
+func TestTraceParserConfigBuild(t *testing.T) {
+	field := entry.NewRecordField("message")
+
+	cases := []struct {
+		name     string
+		config   TraceParserConfig
+		errorMsg string
+	}{
+		{"Default", TraceParserConfig{}, ""},
+		{"DefaultRegex", TraceParserConfig{ParseFrom: &field}, ""},
+		{"RegexWithoutParseFrom", TraceParserConfig{Regex: `(?P<trace_id>\w+)`}, "regex requires parse_from"},
+		{"ParseFromWithFields", TraceParserConfig{ParseFrom: &field, TraceID: &TraceFieldConfig{}}, "cannot be used with trace_id"},
+		{"InvalidRegex", TraceParserConfig{ParseFrom: &field, Regex: `(`}, "compiling trace regex"},
+		{"RegexWithoutGroups", TraceParserConfig{ParseFrom: &field, Regex: `(?P<other>\w+)`}, "must have a named capture group"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.config.Build(testutil.NewBuildContext(t))
+			if tc.errorMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestTraceParser(t *testing.T) {
+	messageField := entry.NewRecordField("message")
+	traceparentField := entry.NewRecordField("traceparent")
+
+	cases := []struct {
+		name           string
+		config         TraceParserConfig
+		record         map[string]interface{}
+		expectedRecord map[string]interface{}
+		traceID        entry.HexBytes
+		spanID         entry.HexBytes
+		traceFlags     entry.HexBytes
+		invalid        map[string]uint64
+	}{
+		{
+			name:   "Fields",
+			config: TraceParserConfig{},
+			record: map[string]interface{}{
+				"trace_id":    "4BF92F3577B34DA6A3CE929D0E0E4736",
+				"span_id":     "00f067aa0ba902b7",
+				"trace_flags": "01",
+				"message":     "test",
+			},
+			expectedRecord: map[string]interface{}{"message": "test"},
+			traceID:        testTraceID,
+			spanID:         testSpanID,
+			traceFlags:     testTraceFlags,
+		},
+		{
+			name:   "FieldsPreserved",
+			config: TraceParserConfig{Preserve: true},
+			record: map[string]interface{}{
+				"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+			expectedRecord: map[string]interface{}{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"},
+			traceID:        testTraceID,
+		},
+		{
+			name:   "InvalidFields",
+			config: TraceParserConfig{},
+			record: map[string]interface{}{
+				"trace_id":    "4bf92f3577b34da6",
+				"span_id":     "00000000000000000",
+				"trace_flags": 1,
+				"message":     "test",
+			},
+			expectedRecord: map[string]interface{}{"message": "test"},
+			invalid: map[string]uint64{
+				InvalidTraceIDCounter:    1,
+				InvalidSpanIDCounter:     1,
+				InvalidTraceFlagsCounter: 1,
+			},
+		},
+		{
+			name:   "ZeroTraceID",
+			config: TraceParserConfig{},
+			record: map[string]interface{}{
+				"trace_id": "00000000000000000000000000000000",
+				"span_id":  "00f067aa0ba902b7",
+			},
+			expectedRecord: map[string]interface{}{},
+			spanID:         testSpanID,
+			invalid:        map[string]uint64{InvalidTraceIDCounter: 1},
+		},
+		{
+			name:   "TraceparentField",
+			config: TraceParserConfig{Traceparent: &TraceFieldConfig{ParseFrom: &traceparentField}},
+			record: map[string]interface{}{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedRecord: map[string]interface{}{},
+			traceID:        testTraceID,
+			spanID:         testSpanID,
+			traceFlags:     testTraceFlags,
+		},
+		{
+			name:   "InvalidTraceparentField",
+			config: TraceParserConfig{Traceparent: &TraceFieldConfig{ParseFrom: &traceparentField}},
+			record: map[string]interface{}{
+				"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedRecord: map[string]interface{}{},
+			invalid:        map[string]uint64{InvalidTraceparentCounter: 1},
+		},
+		{
+			name:   "RegexKeyValues",
+			config: TraceParserConfig{ParseFrom: &messageField},
+			record: map[string]interface{}{
+				"message": "request done trace_id=4bf92f3577b34da6a3ce929d0e0e4736 parent_span_id=1111111111111111 span_id=00F067AA0BA902B7",
+			},
+			expectedRecord: map[string]interface{}{
+				"message": "request done trace_id=4bf92f3577b34da6a3ce929d0e0e4736 parent_span_id=1111111111111111 span_id=00F067AA0BA902B7",
+			},
+			traceID: testTraceID,
+			spanID:  testSpanID,
+		},
+		{
+			name:   "RegexJSON",
+			config: TraceParserConfig{ParseFrom: &messageField},
+			record: map[string]interface{}{
+				"message": `{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"}`,
+			},
+			expectedRecord: map[string]interface{}{
+				"message": `{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"}`,
+			},
+			traceID: testTraceID,
+			spanID:  testSpanID,
+		},
+		{
+			name:   "RegexTraceparent",
+			config: TraceParserConfig{ParseFrom: &messageField},
+			record: map[string]interface{}{
+				"message": "GET / traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			expectedRecord: map[string]interface{}{
+				"message": "GET / traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			traceID:    testTraceID,
+			spanID:     testSpanID,
+			traceFlags: testTraceFlags,
+		},
+		{
+			name:   "RegexInvalid",
+			config: TraceParserConfig{ParseFrom: &messageField},
+			record: map[string]interface{}{
+				"message": "trace_id=xyz span_id=00f067aa0ba902b7",
+			},
+			expectedRecord: map[string]interface{}{
+				"message": "trace_id=xyz span_id=00f067aa0ba902b7",
+			},
+			spanID:  testSpanID,
+			invalid: map[string]uint64{InvalidTraceIDCounter: 1},
+		},
+		{
+			name:   "CustomRegex",
+			config: TraceParserConfig{ParseFrom: &messageField, Regex: `\[(?P<trace_id>[^/\]]+)/(?P<span_id>[^\]]+)\]`},
+			record: map[string]interface{}{
+				"message": "[4bf92f3577b34da6a3ce929d0e0e4736/00f067aa0ba902b7] done",
+			},
+			expectedRecord: map[string]interface{}{
+				"message": "[4bf92f3577b34da6a3ce929d0e0e4736/00f067aa0ba902b7] done",
+			},
+			traceID: testTraceID,
+			spanID:  testSpanID,
+		},
+		{
+			name:   "Missing",
+			config: TraceParserConfig{ParseFrom: &messageField},
+			record: map[string]interface{}{
+				"other": "value",
+			},
+			expectedRecord: map[string]interface{}{"other": "value"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parser, err := tc.config.Build(testutil.NewBuildContext(t))
+			require.NoError(t, err)
+
+			e := entry.New()
+			e.Record = tc.record
+			require.NoError(t, parser.Parse(context.Background(), e))
+
+			require.Equal(t, tc.expectedRecord, e.Record)
+			require.Equal(t, tc.traceID, e.TraceID)
+			require.Equal(t, tc.spanID, e.SpanID)
+			require.Equal(t, tc.traceFlags, e.TraceFlags)
+
+			counters := parser.Counters()
+			for _, name := range []string{InvalidTraceIDCounter, InvalidSpanIDCounter, InvalidTraceFlagsCounter, InvalidTraceparentCounter} {
+				require.Equal(t, tc.invalid[name], counters[name], name)
+			}
+		})
+	}
+}
+
+func TestTraceParserInvalidType(t *testing.T) {
+	field := entry.NewRecordField("message")
+	config := TraceParserConfig{ParseFrom: &field}
+	parser, err := config.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+
+	e := entry.New()
+	e.Record = map[string]interface{}{"message": 1}
+	err = parser.Parse(context.Background(), e)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot be parsed for a trace context")
+}
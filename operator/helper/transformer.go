@@ -20,7 +20,8 @@ func NewTransformerConfig(operatorID, operatorType string) TransformerConfig {
 // TransformerConfig provides a basic implementation of a transformer config.
 type TransformerConfig struct {
 	WriterConfig `yaml:",inline"`
-	OnError      string `json:"on_error" yaml:"on_error"`
+	OnError      string `json:"on_error"              yaml:"on_error"`
+	ErrorLabel   string `json:"error_label,omitempty" yaml:"error_label,omitempty"`
 }
 
 // Build will build a transformer operator.
@@ -43,6 +44,7 @@ func (c TransformerConfig) Build(context operator.BuildContext) (TransformerOper
 	transformerOperator := TransformerOperator{
 		WriterOperator: writerOperator,
 		OnError:        c.OnError,
+		ErrorLabel:     c.ErrorLabel,
 	}
 
 	return transformerOperator, nil
@@ -52,6 +54,12 @@ func (c TransformerConfig) Build(context operator.BuildContext) (TransformerOper
 type TransformerOperator struct {
 	WriterOperator
 	OnError string
+
+	// ErrorLabel is the label that holds the error of an entry that is sent
+	// on after it failed to process
+	ErrorLabel string
+
+	catcher Catcher
 }
 
 // CanProcess will always return true for a transformer operator.
@@ -61,7 +69,7 @@ func (t *TransformerOperator) CanProcess() bool {
 
 // ProcessWith will process an entry with a transform function.
 func (t *TransformerOperator) ProcessWith(ctx context.Context, entry *entry.Entry, transform TransformFunction) error {
-	newEntry, err := transform(entry)
+	newEntry, err := recoverTransform(entry, transform)
 	if err != nil {
 		return t.HandleEntryError(ctx, entry, err)
 	}
@@ -70,15 +78,35 @@ func (t *TransformerOperator) ProcessWith(ctx context.Context, entry *entry.Entr
 }
 
 // HandleEntryError will handle an entry error using the on_error strategy.
+// If the pipeline has a catch operator, the entry is given to it instead,
+// whatever the strategy is. An entry that fails again in the catch chain is
+// always dropped.
 func (t *TransformerOperator) HandleEntryError(ctx context.Context, entry *entry.Entry, err error) error {
 	t.Errorw("Failed to process entry", zap.Any("error", err), zap.Any("action", t.OnError), zap.Any("entry", entry))
+	t.stats.AddErrored(1)
+	if t.catcher != nil {
+		if !t.catcher.Catch(ctx, entry, t.ID(), err) {
+			t.stats.AddDropped(1)
+		}
+		return err
+	}
 	if t.OnError == SendOnError {
+		if t.ErrorLabel != "" {
+			entry.AddLabel(t.ErrorLabel, err.Error())
+		}
 		t.Write(ctx, entry)
 		return nil
 	}
+	t.stats.AddDropped(1)
 	return err
 }
 
+// SetCatcher sets the catch operator that receives the entries this operator
+// fails to process.
+func (t *TransformerOperator) SetCatcher(catcher Catcher) {
+	t.catcher = catcher
+}
+
 // TransformFunction is function that transforms an entry.
 type TransformFunction = func(*entry.Entry) (*entry.Entry, error)
 
@@ -67,6 +67,7 @@ func TestTransformerDropOnError(t *testing.T) {
 				OperatorID:    "test-id",
 				OperatorType:  "test-type",
 				SugaredLogger: buildContext.Logger.SugaredLogger,
+				stats:         &OperatorStats{},
 			},
 			OutputOperators: []operator.Operator{output},
 			OutputIDs:       []string{"test-output"},
@@ -81,6 +82,7 @@ func TestTransformerDropOnError(t *testing.T) {
 	err := transformer.ProcessWith(ctx, testEntry, transform)
 	require.Error(t, err)
 	output.AssertNotCalled(t, "Process", mock.Anything, mock.Anything)
+	require.Equal(t, OperatorStats{Errored: 1, Dropped: 1}, transformer.OperatorStats().Snapshot())
 }
 
 func TestTransformerSendOnError(t *testing.T) {
@@ -95,6 +97,7 @@ func TestTransformerSendOnError(t *testing.T) {
 				OperatorID:    "test-id",
 				OperatorType:  "test-type",
 				SugaredLogger: buildContext.Logger.SugaredLogger,
+				stats:         &OperatorStats{},
 			},
 			OutputOperators: []operator.Operator{output},
 			OutputIDs:       []string{"test-output"},
@@ -109,6 +112,38 @@ func TestTransformerSendOnError(t *testing.T) {
 	err := transformer.ProcessWith(ctx, testEntry, transform)
 	require.NoError(t, err)
 	output.AssertCalled(t, "Process", mock.Anything, mock.Anything)
+	require.Equal(t, OperatorStats{EntriesOut: 1, Errored: 1}, transformer.OperatorStats().Snapshot())
+}
+
+func TestTransformerSendOnErrorLabel(t *testing.T) {
+	output := &testutil.Operator{}
+	output.On("ID").Return("test-output")
+	output.On("Process", mock.Anything, mock.Anything).Return(nil)
+	buildContext := testutil.NewBuildContext(t)
+	transformer := TransformerOperator{
+		OnError:    SendOnError,
+		ErrorLabel: "parse_error",
+		WriterOperator: WriterOperator{
+			BasicOperator: BasicOperator{
+				OperatorID:    "test-id",
+				OperatorType:  "test-type",
+				SugaredLogger: buildContext.Logger.SugaredLogger,
+				stats:         &OperatorStats{},
+			},
+			OutputOperators: []operator.Operator{output},
+			OutputIDs:       []string{"test-output"},
+		},
+	}
+	ctx := context.Background()
+	testEntry := entry.New()
+	transform := func(e *entry.Entry) (*entry.Entry, error) {
+		return e, fmt.Errorf("Failure")
+	}
+
+	err := transformer.ProcessWith(ctx, testEntry, transform)
+	require.NoError(t, err)
+	output.AssertCalled(t, "Process", mock.Anything, mock.Anything)
+	require.Equal(t, map[string]string{"parse_error": "Failure"}, testEntry.Labels)
 }
 
 func TestTransformerProcessWithValid(t *testing.T) {
@@ -123,6 +158,7 @@ func TestTransformerProcessWithValid(t *testing.T) {
 				OperatorID:    "test-id",
 				OperatorType:  "test-type",
 				SugaredLogger: buildContext.Logger.SugaredLogger,
+				stats:         &OperatorStats{},
 			},
 			OutputOperators: []operator.Operator{output},
 			OutputIDs:       []string{"test-output"},
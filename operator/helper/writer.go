@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/observiq/stanza/entry"
 	"github.com/observiq/stanza/operator"
@@ -20,6 +21,14 @@ func NewWriterConfig(operatorID, operatorType string) WriterConfig {
 type WriterConfig struct {
 	BasicConfig `yaml:",inline"`
 	OutputIDs   OutputIDs `json:"output" yaml:"output"`
+	DebugSample int       `json:"debug_sample,omitempty" yaml:"debug_sample,omitempty"`
+
+	// OnBackpressure is what happens to an entry when the queue of an output is full
+	OnBackpressure string `json:"on_backpressure,omitempty" yaml:"on_backpressure,omitempty"`
+
+	// OutputBufferSize is the number of entries queued for each output, so that
+	// an output that can't keep up does not hold up the others
+	OutputBufferSize int `json:"output_buffer_size,omitempty" yaml:"output_buffer_size,omitempty"`
 }
 
 // Build will build a writer operator from the config.
@@ -29,15 +38,32 @@ func (c WriterConfig) Build(bc operator.BuildContext) (WriterOperator, error) {
 		return WriterOperator{}, err
 	}
 
+	if err := ValidateDebugSample(c.DebugSample); err != nil {
+		return WriterOperator{}, err
+	}
+
+	fanOut, err := newFanOut(c.OnBackpressure, c.OutputBufferSize, basicOperator.SugaredLogger, basicOperator.OperatorStats())
+	if err != nil {
+		return WriterOperator{}, err
+	}
+
 	// Namespace all the output IDs
 	namespacedIDs := c.OutputIDs.WithNamespace(bc)
 	if len(namespacedIDs) == 0 {
 		namespacedIDs = bc.DefaultOutputIDs
 	}
 
+	// The sampler is built even when debug_sample is not set, so that sampling
+	// can be turned on at runtime
 	writer := WriterOperator{
 		OutputIDs:     namespacedIDs,
 		BasicOperator: basicOperator,
+		debugSample:   NewDebugSampler(c.DebugSample, basicOperator.SugaredLogger),
+		fanOut:        fanOut,
+	}
+
+	if bc.SampleBackpressure {
+		writer.backpressure = NewBackpressureSampler()
 	}
 	return writer, nil
 }
@@ -47,11 +73,36 @@ type WriterOperator struct {
 	BasicOperator
 	OutputIDs       OutputIDs
 	OutputOperators []operator.Operator
+
+	backpressure *BackpressureSampler
+	debugSample  *DebugSampler
+	fanOut       *fanOut
 }
 
 // Write will write an entry to the outputs of the operator.
 func (w *WriterOperator) Write(ctx context.Context, e *entry.Entry) {
+	w.stats.AddOut(1)
+	if w.debugSample != nil {
+		w.debugSample.Sample(e)
+	}
+	var sampler *BackpressureSampler
+	if w.backpressure != nil && w.backpressure.ShouldSample() {
+		sampler = w.backpressure
+	}
+
+	// With a fan out, the time sampled is how long the hand-off to the queue
+	// of each output blocks
+	if w.fanOut != nil {
+		w.fanOut.write(ctx, e, sampler)
+		return
+	}
+	if sampler != nil {
+		w.sampledWrite(ctx, e)
+		return
+	}
+
 	for i, operator := range w.OutputOperators {
+		RecordReceived(operator)
 		if i == len(w.OutputOperators)-1 {
 			_ = operator.Process(ctx, e)
 			return
@@ -60,6 +111,37 @@ func (w *WriterOperator) Write(ctx context.Context, e *entry.Entry) {
 	}
 }
 
+// sampledWrite will write an entry to the outputs of the operator while
+// recording how long each output blocked the hand-off.
+func (w *WriterOperator) sampledWrite(ctx context.Context, e *entry.Entry) {
+	for i, operator := range w.OutputOperators {
+		toWrite := e
+		if i != len(w.OutputOperators)-1 {
+			toWrite = e.Copy()
+		}
+
+		RecordReceived(operator)
+		start := time.Now()
+		_ = operator.Process(ctx, toWrite)
+		w.backpressure.Record(operator.ID(), time.Since(start))
+	}
+}
+
+// BackpressureRatios returns the estimated fraction of time this operator has
+// spent blocked on each of its outputs. It returns nil if sampling is disabled.
+func (w *WriterOperator) BackpressureRatios() map[string]float64 {
+	if w.backpressure == nil {
+		return nil
+	}
+	return w.backpressure.Ratios()
+}
+
+// DebugSample returns the sampler that logs the entries written by the operator.
+// Its rate is zero if debug_sample is not set.
+func (w *WriterOperator) DebugSample() *DebugSampler {
+	return w.debugSample
+}
+
 // CanOutput always returns true for a writer operator.
 func (w *WriterOperator) CanOutput() bool {
 	return true
@@ -70,6 +152,11 @@ func (w *WriterOperator) Outputs() []operator.Operator {
 	return w.OutputOperators
 }
 
+// GetOutputIDs returns the IDs of the outputs of the writer operator.
+func (w *WriterOperator) GetOutputIDs() []string {
+	return w.OutputIDs
+}
+
 // SetOutputs will set the outputs of the operator.
 func (w *WriterOperator) SetOutputs(operators []operator.Operator) error {
 	outputOperators := make([]operator.Operator, 0)
@@ -88,9 +175,21 @@ func (w *WriterOperator) SetOutputs(operators []operator.Operator) error {
 	}
 
 	w.OutputOperators = outputOperators
+	if w.fanOut != nil {
+		w.fanOut.setOutputs(outputOperators)
+	}
 	return nil
 }
 
+// DrainOutputs waits for the entries queued for each output to be processed,
+// giving up on an output that is stuck after a timeout. It does nothing if
+// entries are written to the outputs directly.
+func (w *WriterOperator) DrainOutputs() {
+	if w.fanOut != nil {
+		w.fanOut.drain(drainTimeout)
+	}
+}
+
 // FindOperator will find an operator matching the supplied id.
 func (w *WriterOperator) findOperator(operators []operator.Operator, operatorID string) (operator.Operator, bool) {
 	for _, operator := range operators {
@@ -3,6 +3,7 @@ package helper
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/observiq/stanza/entry"
@@ -53,6 +54,120 @@ func TestWriterOperatorWrite(t *testing.T) {
 	output2.AssertCalled(t, "Process", ctx, mock.Anything)
 }
 
+func TestWriterOperatorWriteIsolatesOutputs(t *testing.T) {
+	// The first output mutates the nested record of the entry it receives
+	output1 := &testutil.Operator{}
+	output1.On("Process", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		e := args.Get(1).(*entry.Entry)
+		nested := e.Record.(map[string]interface{})["nested"].(map[string]interface{})
+		nested["key"] = "mutated"
+		e.Labels["label"] = "mutated"
+	}).Return(nil)
+
+	var received *entry.Entry
+	output2 := &testutil.Operator{}
+	output2.On("Process", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		received = args.Get(1).(*entry.Entry)
+	}).Return(nil)
+
+	writer := WriterOperator{
+		OutputOperators: []operator.Operator{output1, output2},
+	}
+
+	testEntry := entry.New()
+	testEntry.Labels = map[string]string{"label": "value"}
+	testEntry.Record = map[string]interface{}{
+		"nested": map[string]interface{}{"key": "value"},
+	}
+	writer.Write(context.Background(), testEntry)
+
+	require.Equal(t, map[string]interface{}{
+		"nested": map[string]interface{}{"key": "value"},
+	}, received.Record)
+	require.Equal(t, map[string]string{"label": "value"}, received.Labels)
+}
+
+type countingOperator struct {
+	*testutil.Operator
+	stats *OperatorStats
+}
+
+func (o countingOperator) OperatorStats() *OperatorStats {
+	return o.stats
+}
+
+func TestWriterOperatorWriteStats(t *testing.T) {
+	output1 := countingOperator{Operator: &testutil.Operator{}, stats: &OperatorStats{}}
+	output1.On("Process", mock.Anything, mock.Anything).Return(nil)
+	output2 := &testutil.Operator{}
+	output2.On("Process", mock.Anything, mock.Anything).Return(nil)
+	writer := WriterOperator{
+		BasicOperator:   BasicOperator{stats: &OperatorStats{}},
+		OutputOperators: []operator.Operator{output1, output2},
+	}
+
+	ctx := context.Background()
+	writer.Write(ctx, entry.New())
+	writer.Write(ctx, entry.New())
+
+	require.Equal(t, OperatorStats{EntriesOut: 2}, writer.OperatorStats().Snapshot())
+	require.Equal(t, OperatorStats{EntriesIn: 2}, output1.stats.Snapshot())
+}
+
+func TestWriterOperatorWriteSampled(t *testing.T) {
+	output := testutil.NewMockOperator("output")
+	output.On("Process", mock.Anything, mock.Anything).Return(nil)
+
+	writer := WriterOperator{
+		OutputOperators: []operator.Operator{output},
+		backpressure:    NewBackpressureSampler(),
+	}
+
+	ctx := context.Background()
+	for i := 0; i < BackpressureSampleRate; i++ {
+		writer.Write(ctx, entry.New())
+	}
+
+	output.AssertNumberOfCalls(t, "Process", BackpressureSampleRate)
+	require.Contains(t, writer.BackpressureRatios(), "output")
+}
+
+func TestWriterOperatorBackpressureDisabled(t *testing.T) {
+	config := NewWriterConfig("test_id", "test_type")
+	writer, err := config.Build(testutil.NewBuildContext(t))
+	require.NoError(t, err)
+	require.Nil(t, writer.BackpressureRatios())
+}
+
+func BenchmarkWriterOperatorWrite(b *testing.B) {
+	for _, sampled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Sampled=%t", sampled), func(b *testing.B) {
+			writer := WriterOperator{
+				OutputOperators: []operator.Operator{&nopOperator{id: "output"}},
+			}
+			if sampled {
+				writer.backpressure = NewBackpressureSampler()
+			}
+
+			ctx := context.Background()
+			e := entry.New()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				writer.Write(ctx, e)
+			}
+		})
+	}
+}
+
+// nopOperator is an operator that discards entries without recording calls.
+type nopOperator struct {
+	operator.Operator
+	id string
+}
+
+func (o *nopOperator) ID() string                                      { return o.id }
+func (o *nopOperator) Process(_ context.Context, _ *entry.Entry) error { return nil }
+
 func TestWriterOperatorCanOutput(t *testing.T) {
 	writer := WriterOperator{}
 	require.True(t, writer.CanOutput())
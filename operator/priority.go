@@ -0,0 +1,151 @@
+package operator
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// The I/O priority classes of reads
+const (
+	// IOPriorityBestEffort reads at the lowest level of the best effort
+	// class, which still gets a share of the disk when it is busy
+	IOPriorityBestEffort = "best_effort"
+
+	// IOPriorityIdle reads only when no other process uses the disk
+	IOPriorityIdle = "idle"
+)
+
+// maxNice is the lowest CPU priority of a thread
+const maxNice = 19
+
+// PriorityConfig is the configuration of the I/O and CPU priority of reads,
+// so that reading large amounts of logs, such as archived logs during a
+// backfill, does not compete with the other processes of the host. The
+// priority is only applied on Linux.
+type PriorityConfig struct {
+	IOPriority string `json:"io_priority,omitempty" yaml:"io_priority,omitempty"`
+	Nice       int    `json:"nice,omitempty"        yaml:"nice,omitempty"`
+}
+
+// Validate checks that the priority is one that reads can be lowered to
+func (c PriorityConfig) Validate() error {
+	switch c.IOPriority {
+	case "", IOPriorityBestEffort, IOPriorityIdle:
+	default:
+		return fmt.Errorf("invalid io_priority '%s': must be '%s' or '%s'", c.IOPriority, IOPriorityBestEffort, IOPriorityIdle)
+	}
+	if c.Nice < 0 || c.Nice > maxNice {
+		return fmt.Errorf("invalid nice %d: must be between 0 and %d", c.Nice, maxNice)
+	}
+	return nil
+}
+
+// PriorityPool runs work on goroutines that are each locked to an OS thread
+// with a lowered priority. Go moves goroutines between threads, so work only
+// runs with the priority while it runs in the pool. The threads exit when the
+// pool stops, so their priority is never given to other goroutines.
+type PriorityPool struct {
+	config PriorityConfig
+	size   int
+	logger *zap.SugaredLogger
+
+	mux     sync.RWMutex
+	work    chan func()
+	wg      sync.WaitGroup
+	warning sync.Once
+}
+
+// NewPriorityPool creates a pool of a number of threads with a priority. The
+// threads are started by Start.
+func NewPriorityPool(config PriorityConfig, size int, logger *zap.SugaredLogger) (*PriorityPool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		size = 1
+	}
+	if logger == nil {
+		logger = zap.NewNop().Sugar()
+	}
+	return &PriorityPool{
+		config: config,
+		size:   size,
+		logger: logger,
+	}, nil
+}
+
+// Start starts the threads of the pool
+func (p *PriorityPool) Start() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.work != nil {
+		return
+	}
+
+	work := make(chan func())
+	p.work = work
+	p.wg.Add(p.size)
+	for i := 0; i < p.size; i++ {
+		go p.worker(work)
+	}
+}
+
+// Stop waits for the work in progress, and stops the threads of the pool
+func (p *PriorityPool) Stop() {
+	p.mux.Lock()
+	work := p.work
+	p.work = nil
+	p.mux.Unlock()
+
+	if work == nil {
+		return
+	}
+	close(work)
+	p.wg.Wait()
+}
+
+// Run runs a function on a thread of the pool, and waits for it to return.
+// The function runs on the calling goroutine if the pool is not started.
+func (p *PriorityPool) Run(f func()) {
+	// The work is sent while the pool is read locked, so that Stop cannot
+	// close the channel of work in between
+	p.mux.RLock()
+	if p.work == nil {
+		p.mux.RUnlock()
+		f()
+		return
+	}
+
+	done := make(chan struct{})
+	p.work <- func() {
+		defer close(done)
+		f()
+	}
+	p.mux.RUnlock()
+	<-done
+}
+
+// worker locks its goroutine to a thread, lowers the priority of the thread,
+// and runs work until the pool stops. The goroutine exits without unlocking
+// the thread, so the thread exits with it.
+func (p *PriorityPool) worker(work chan func()) {
+	defer p.wg.Done()
+	runtime.LockOSThread()
+
+	if err := setThreadPriority(p.config); err != nil {
+		p.warning.Do(func() {
+			p.logger.Warnw("Failed to lower the priority of reads. Reading at normal priority",
+				"io_priority", p.config.IOPriority,
+				"nice", p.config.Nice,
+				zap.Error(err),
+			)
+		})
+	}
+
+	for f := range work {
+		f()
+	}
+}
@@ -0,0 +1,42 @@
+// +build linux
+
+package operator
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// The values of ioprio_set, which x/sys does not define
+const (
+	ioprioWhoProcess      = 1
+	ioprioClassShift      = 13
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+	ioprioLowestLevel     = 7
+)
+
+// setThreadPriority lowers the I/O and CPU priority of the current thread.
+// Linux applies both to a single thread when it is given by its thread ID.
+func setThreadPriority(config PriorityConfig) error {
+	tid := unix.Gettid()
+
+	var ioprio uintptr
+	switch config.IOPriority {
+	case IOPriorityBestEffort:
+		ioprio = ioprioClassBestEffort<<ioprioClassShift | ioprioLowestLevel
+	case IOPriorityIdle:
+		ioprio = ioprioClassIdle << ioprioClassShift
+	}
+	if ioprio != 0 {
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprio); errno != 0 {
+			return errno
+		}
+	}
+
+	if config.Nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, config.Nice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package operator
+
+// setThreadPriority does nothing on platforms other than Linux
+func setThreadPriority(config PriorityConfig) error {
+	return nil
+}
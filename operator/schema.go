@@ -0,0 +1,265 @@
+package operator
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Schema describes the config fields accepted by an operator type
+type Schema struct {
+	Type       string        `json:"type"                 yaml:"type"`
+	Fields     []FieldSchema `json:"fields"               yaml:"fields"`
+	Deprecated []string      `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+}
+
+// FieldSchema describes a config field. The type of a field is a Go kind,
+// such as string or []string, an object with nested fields, or the name of
+// a type with its own format, such as helper.Duration.
+type FieldSchema struct {
+	Name     string        `json:"name"               yaml:"name"`
+	Type     string        `json:"type"               yaml:"type"`
+	Default  interface{}   `json:"default,omitempty"  yaml:"default,omitempty"`
+	Required bool          `json:"required,omitempty" yaml:"required,omitempty"`
+	Fields   []FieldSchema `json:"fields,omitempty"   yaml:"fields,omitempty"`
+}
+
+// Types returns the registered operator types, sorted by name
+func (r *Registry) Types() []string {
+	types := make([]string, 0, len(r.operators))
+	for operatorType := range r.operators {
+		types = append(types, operatorType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Schema returns the schema of a registered operator type. The schema is
+// derived from the yaml tags of the config struct, and the defaults are the
+// values of a new config. Fields tagged with `required:"true"` are required.
+func (r *Registry) Schema(operatorType string) (*Schema, bool) {
+	newBuilder, ok := r.Lookup(operatorType)
+	if !ok {
+		return nil, false
+	}
+	return NewSchema(operatorType, newBuilder()), true
+}
+
+// NewSchema creates the schema of an operator config
+func NewSchema(operatorType string, builder Builder) *Schema {
+	schema := &Schema{
+		Type:   operatorType,
+		Fields: structFields(reflect.ValueOf(builder)),
+	}
+	if deprecator, ok := builder.(Deprecator); ok {
+		for _, field := range deprecator.DeprecatedFields() {
+			schema.Deprecated = append(schema.Deprecated, field.Name)
+		}
+	}
+	return schema
+}
+
+// FieldNames returns the names of the top level fields of the schema
+func (s *Schema) FieldNames() []string {
+	names := make([]string, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// structFields returns the schemas of the fields of a struct value, including
+// the fields of inlined structs
+func structFields(v reflect.Value) []FieldSchema {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make([]FieldSchema, 0, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		name, inline := fieldName(structField)
+		if inline {
+			fields = append(fields, structFields(v.Field(i))...)
+			continue
+		}
+		if name == "" || structField.PkgPath != "" {
+			continue
+		}
+
+		value := v.Field(i)
+		field := FieldSchema{
+			Name:     name,
+			Type:     typeName(structField.Type),
+			Required: structField.Tag.Get("required") == "true",
+		}
+		if field.Type == "object" {
+			field.Fields = structFields(valueOrNew(value))
+		} else if !value.IsZero() {
+			field.Default = value.Interface()
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// fieldName returns the config name of a struct field from its yaml tag, or
+// its json tag if it has no yaml tag, and whether the field is inlined
+func fieldName(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup("yaml")
+	if !ok {
+		tag, ok = field.Tag.Lookup("json")
+	}
+	if !ok {
+		return "", field.Anonymous
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if option == "inline" {
+			return "", true
+		}
+	}
+	if parts[0] == "-" {
+		return "", false
+	}
+	return parts[0], false
+}
+
+// typeName returns the schema type of a Go type
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Types that unmarshal themselves have their own format
+	if t.Name() != "" && t.PkgPath() != "" {
+		ptr := reflect.PtrTo(t)
+		if ptr.Implements(jsonUnmarshalerType) || ptr.Implements(yamlUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+			return t.String()
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		return "[]" + typeName(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", typeName(t.Key()), typeName(t.Elem()))
+	case reflect.Struct:
+		return "object"
+	default:
+		return "any"
+	}
+}
+
+// valueOrNew returns the value, or a new zero value if it is a nil pointer
+func valueOrNew(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return reflect.New(v.Type().Elem())
+	}
+	return v
+}
+
+// unknownFieldsError returns an error naming the fields of a raw config that
+// are not in the schema of its operator type, with the closest known field
+// as a suggestion. It returns nil if all fields are known.
+func unknownFieldsError(raw map[string]interface{}, schema *Schema) error {
+	known := make(map[string]bool, len(schema.Fields))
+	for _, name := range schema.FieldNames() {
+		known[name] = true
+	}
+	for _, name := range schema.Deprecated {
+		known[name] = true
+	}
+
+	unknown := make([]string, 0)
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	messages := make([]string, 0, len(unknown))
+	for _, key := range unknown {
+		message := fmt.Sprintf("field '%s' not recognized", key)
+		if suggestion, ok := closestName(key, schema.FieldNames()); ok {
+			message += fmt.Sprintf("; did you mean '%s'?", suggestion)
+		}
+		messages = append(messages, message)
+	}
+	return fmt.Errorf("%s", strings.Join(messages, ", "))
+}
+
+// closestName returns the name closest to a misspelled name, if one is close
+// enough to be a likely match
+func closestName(name string, names []string) (string, bool) {
+	best, bestDistance := "", len(name)/2+1
+	for _, candidate := range names {
+		if distance := editDistance(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,114 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type schemaDuration struct {
+	time.Duration
+}
+
+func (d *schemaDuration) UnmarshalYAML(unmarshal func(interface{}) error) error { return nil }
+
+type schemaBase struct {
+	OperatorID   string `json:"id"   yaml:"id"`
+	OperatorType string `json:"type" yaml:"type" required:"true"`
+}
+
+type schemaBuilder struct {
+	schemaBase `yaml:",inline"`
+	Path       string            `json:"path"              yaml:"path"              required:"true"`
+	Labels     map[string]string `json:"labels,omitempty"  yaml:"labels,omitempty"`
+	Interval   schemaDuration    `json:"interval"          yaml:"interval"`
+	Retries    int               `json:"retries"           yaml:"retries"`
+	Nested     *struct {
+		Enabled bool `json:"enabled" yaml:"enabled"`
+	} `json:"nested,omitempty" yaml:"nested,omitempty"`
+	Ignored  string `json:"-" yaml:"-"`
+	internal string
+}
+
+func (s *schemaBuilder) Build(context BuildContext) ([]Operator, error) { return nil, nil }
+func (s *schemaBuilder) ID() string                                     { return s.OperatorID }
+func (s *schemaBuilder) Type() string                                   { return s.OperatorType }
+func (s *schemaBuilder) DeprecatedFields() []DeprecatedField {
+	return []DeprecatedField{{Name: "file", Replacement: "path"}}
+}
+
+func newSchemaBuilder() Builder {
+	return &schemaBuilder{
+		schemaBase: schemaBase{OperatorID: "schema_operator", OperatorType: "schema_operator"},
+		Interval:   schemaDuration{time.Second},
+		Retries:    3,
+	}
+}
+
+func TestSchema(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("schema_operator", newSchemaBuilder)
+	registry.Register("another_operator", newSchemaBuilder)
+	require.Equal(t, []string{"another_operator", "schema_operator"}, registry.Types())
+
+	_, ok := registry.Schema("missing")
+	require.False(t, ok)
+
+	schema, ok := registry.Schema("schema_operator")
+	require.True(t, ok)
+	expected := &Schema{
+		Type: "schema_operator",
+		Fields: []FieldSchema{
+			{Name: "id", Type: "string", Default: "schema_operator"},
+			{Name: "type", Type: "string", Default: "schema_operator", Required: true},
+			{Name: "path", Type: "string", Required: true},
+			{Name: "labels", Type: "map[string]string"},
+			{Name: "interval", Type: "operator.schemaDuration", Default: schemaDuration{time.Second}},
+			{Name: "retries", Type: "int", Default: 3},
+			{Name: "nested", Type: "object", Fields: []FieldSchema{
+				{Name: "enabled", Type: "bool"},
+			}},
+		},
+		Deprecated: []string{"file"},
+	}
+	require.Equal(t, expected, schema)
+}
+
+func TestClosestName(t *testing.T) {
+	names := []string{"id", "type", "path", "include", "exclude"}
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"pathz", "path"},
+		{"inclde", "include"},
+		{"excludes", "exclude"},
+		{"tpye", "type"},
+		{"compression", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			suggestion, ok := closestName(tc.name, names)
+			require.Equal(t, tc.expected != "", ok)
+			require.Equal(t, tc.expected, suggestion)
+		})
+	}
+}
+
+func TestUnmarshalUnknownField(t *testing.T) {
+	t.Cleanup(func() {
+		DefaultRegistry = NewRegistry()
+	})
+	Register("schema_operator", newSchemaBuilder)
+
+	var cfg Config
+	err := yaml.UnmarshalStrict([]byte("type: schema_operator\npathz: /var/log\n"), &cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field 'pathz' not recognized; did you mean 'path'?")
+
+	// Deprecated fields are recognized
+	require.NoError(t, yaml.UnmarshalStrict([]byte("type: schema_operator\nfile: /var/log\n"), &cfg))
+}
@@ -0,0 +1,25 @@
+package operator
+
+// OperatorStatus is the status of an operator in a running pipeline
+type OperatorStatus struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Started    bool   `json:"started"`
+	EntriesIn  uint64 `json:"entries_in"`
+	EntriesOut uint64 `json:"entries_out"`
+	Dropped    uint64 `json:"dropped"`
+	Errored    uint64 `json:"errored"`
+
+	// Backpressure is the sampled fraction of time the operator spent blocked
+	// on each of its outputs, keyed by output ID, if it samples back-pressure
+	Backpressure map[string]float64 `json:"backpressure,omitempty"`
+
+	// Details holds the state reported by operators that implement Statuser
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Statuser is implemented by operators that report details of their state
+// in the status of the agent. Status returns nil if there is nothing to report.
+type Statuser interface {
+	Status() map[string]interface{}
+}
@@ -0,0 +1,318 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig is the configuration of a throttle, a budget of work shared
+// by the inputs of a pipeline. A budget of zero is unlimited.
+type ThrottleConfig struct {
+	MaxEntriesPerSecond float64 `json:"max_entries_per_second,omitempty" yaml:"max_entries_per_second,omitempty"`
+	MaxConcurrentReads  int     `json:"max_concurrent_reads,omitempty"   yaml:"max_concurrent_reads,omitempty"`
+}
+
+// Throttles is a set of named throttles. Their budgets are soft: a throttle
+// that has used its budget borrows the budget of throttles that are idle, so
+// that the work of one pipeline is only held back while another needs the room.
+type Throttles struct {
+	mux       sync.Mutex
+	throttles map[string]*Throttle
+	names     []string
+
+	// released is closed and replaced whenever a read is released, waking the
+	// throttles that are waiting for a read
+	released chan struct{}
+}
+
+// NewThrottles creates a set of throttles from their configs
+func NewThrottles(configs map[string]ThrottleConfig) (*Throttles, error) {
+	t := &Throttles{
+		throttles: make(map[string]*Throttle, len(configs)),
+		names:     make([]string, 0, len(configs)),
+		released:  make(chan struct{}),
+	}
+
+	for name, config := range configs {
+		if config.MaxEntriesPerSecond < 0 {
+			return nil, fmt.Errorf("throttle '%s': max_entries_per_second must not be negative", name)
+		}
+		if config.MaxConcurrentReads < 0 {
+			return nil, fmt.Errorf("throttle '%s': max_concurrent_reads must not be negative", name)
+		}
+
+		capacity := config.MaxEntriesPerSecond
+		if capacity > 0 && capacity < 1 {
+			capacity = 1
+		}
+		t.throttles[name] = &Throttle{
+			name:     name,
+			group:    t,
+			rate:     config.MaxEntriesPerSecond,
+			capacity: capacity,
+			tokens:   capacity,
+			updated:  time.Now(),
+			maxReads: config.MaxConcurrentReads,
+		}
+		t.names = append(t.names, name)
+	}
+
+	// Throttles are searched in order of name when borrowing, so that
+	// lending does not depend on the order of the map
+	sort.Strings(t.names)
+	return t, nil
+}
+
+// Get returns the throttle with a name
+func (t *Throttles) Get(name string) (*Throttle, bool) {
+	if t == nil {
+		return nil, false
+	}
+	throttle, ok := t.throttles[name]
+	return throttle, ok
+}
+
+// Counters returns the counters of each throttle, keyed by throttle name
+func (t *Throttles) Counters() map[string]map[string]uint64 {
+	if t == nil {
+		return nil
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	counters := make(map[string]map[string]uint64, len(t.throttles))
+	for name, throttle := range t.throttles {
+		counters[name] = throttle.counters.toMap()
+	}
+	return counters
+}
+
+// Throttle is a budget of entries per second and concurrent file reads.
+// The methods of a nil throttle never wait.
+type Throttle struct {
+	name  string
+	group *Throttles
+
+	rate     float64
+	capacity float64
+	tokens   float64
+	updated  time.Time
+	lastUsed time.Time
+
+	maxReads int
+	// usedReads is the number of reads that use the budget of this throttle,
+	// including those lent to other throttles. activeReads is the number of
+	// reads done for this throttle, including those that use borrowed budget.
+	usedReads   int
+	activeReads int
+
+	counters throttleCounters
+}
+
+// throttleCounters counts how often a throttle held back work
+type throttleCounters struct {
+	entries          uint64
+	entriesBorrowed  uint64
+	entriesThrottled uint64
+	waitNanos        uint64
+	reads            uint64
+	readsBorrowed    uint64
+	readsThrottled   uint64
+}
+
+func (c throttleCounters) toMap() map[string]uint64 {
+	return map[string]uint64{
+		"entries":           c.entries,
+		"entries_borrowed":  c.entriesBorrowed,
+		"entries_throttled": c.entriesThrottled,
+		"wait_ms":           c.waitNanos / uint64(time.Millisecond),
+		"reads":             c.reads,
+		"reads_borrowed":    c.readsBorrowed,
+		"reads_throttled":   c.readsThrottled,
+	}
+}
+
+// Name returns the name of the throttle
+func (t *Throttle) Name() string {
+	return t.name
+}
+
+// Wait blocks until the throttle has budget for an entry, or until the
+// context is done. Entries are never dropped by a throttle, only delayed.
+func (t *Throttle) Wait(ctx context.Context) {
+	if t == nil {
+		return
+	}
+
+	var start time.Time
+	for {
+		delay := t.group.takeEntry(t, !start.IsZero())
+		if delay == 0 {
+			break
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			t.group.addWait(t, time.Since(start))
+			return
+		case <-timer.C:
+		}
+	}
+
+	if !start.IsZero() {
+		t.group.addWait(t, time.Since(start))
+	}
+}
+
+// AcquireRead blocks until the throttle has budget for another concurrent
+// read, and returns a function that releases it once the read is done. It
+// returns false if the context is done first.
+func (t *Throttle) AcquireRead(ctx context.Context) (release func(), ok bool) {
+	if t == nil {
+		return func() {}, true
+	}
+
+	throttled := false
+	for {
+		release, released := t.group.takeRead(t, throttled)
+		if release != nil {
+			return release, true
+		}
+		throttled = true
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-released:
+		}
+	}
+}
+
+// takeEntry takes the budget for an entry from a throttle, or from an idle
+// throttle if its own budget is used. Otherwise it returns how long to wait
+// for the throttle's next entry.
+func (t *Throttles) takeEntry(throttle *Throttle, waited bool) time.Duration {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if throttle.rate <= 0 {
+		throttle.counters.entries++
+		return 0
+	}
+
+	now := time.Now()
+	throttle.refill(now)
+	if throttle.tokens >= 1 {
+		throttle.tokens--
+		throttle.lastUsed = now
+		throttle.counters.entries++
+		return 0
+	}
+
+	// A throttle that has not had entries of its own for a second lends its
+	// budget until it has entries again
+	delay := time.Duration((1 - throttle.tokens) / throttle.rate * float64(time.Second))
+	for _, name := range t.names {
+		lender := t.throttles[name]
+		if lender == throttle || lender.rate <= 0 || now.Sub(lender.lastUsed) < time.Second {
+			continue
+		}
+		lender.refill(now)
+		if lender.tokens >= 1 {
+			lender.tokens--
+			throttle.counters.entries++
+			throttle.counters.entriesBorrowed++
+			return 0
+		}
+		if lenderDelay := time.Duration((1 - lender.tokens) / lender.rate * float64(time.Second)); lenderDelay < delay {
+			delay = lenderDelay
+		}
+	}
+
+	if !waited {
+		throttle.counters.entriesThrottled++
+	}
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
+
+// takeRead takes the budget for a read from a throttle, or from an idle
+// throttle if its own budget is used. Otherwise it returns a channel that is
+// closed when a read is released.
+func (t *Throttles) takeRead(throttle *Throttle, waited bool) (func(), <-chan struct{}) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	owner := throttle
+	if throttle.maxReads > 0 && throttle.usedReads >= throttle.maxReads {
+		owner = nil
+		for _, name := range t.names {
+			lender := t.throttles[name]
+			if lender == throttle || lender.maxReads == 0 {
+				continue
+			}
+			if lender.activeReads == 0 && lender.usedReads < lender.maxReads {
+				owner = lender
+				break
+			}
+		}
+	}
+
+	if owner == nil {
+		if !waited {
+			throttle.counters.readsThrottled++
+		}
+		return nil, t.released
+	}
+
+	owner.usedReads++
+	throttle.activeReads++
+	throttle.counters.reads++
+	if owner != throttle {
+		throttle.counters.readsBorrowed++
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			t.mux.Lock()
+			defer t.mux.Unlock()
+			owner.usedReads--
+			throttle.activeReads--
+			close(t.released)
+			t.released = make(chan struct{})
+		})
+	}
+	return release, nil
+}
+
+// addWait adds the time an entry waited to the counters of a throttle
+func (t *Throttles) addWait(throttle *Throttle, wait time.Duration) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	throttle.counters.waitNanos += uint64(wait)
+}
+
+// refill adds the budget earned since the last refill, up to one second's worth
+func (t *Throttle) refill(now time.Time) {
+	elapsed := now.Sub(t.updated).Seconds()
+	t.updated = now
+	if elapsed <= 0 {
+		return
+	}
+	t.tokens += elapsed * t.rate
+	if t.tokens > t.capacity {
+		t.tokens = t.capacity
+	}
+}
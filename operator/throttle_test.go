@@ -0,0 +1,175 @@
+package operator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewThrottlesInvalid(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   ThrottleConfig
+		expected string
+	}{
+		{
+			"NegativeEntries",
+			ThrottleConfig{MaxEntriesPerSecond: -1},
+			"max_entries_per_second must not be negative",
+		},
+		{
+			"NegativeReads",
+			ThrottleConfig{MaxConcurrentReads: -1},
+			"max_concurrent_reads must not be negative",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewThrottles(map[string]ThrottleConfig{"replay": tc.config})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
+
+func TestThrottleNil(t *testing.T) {
+	var throttles *Throttles
+	throttle, ok := throttles.Get("replay")
+	require.False(t, ok)
+	require.Nil(t, throttle)
+	require.Nil(t, throttles.Counters())
+
+	throttle.Wait(context.Background())
+	release, ok := throttle.AcquireRead(context.Background())
+	require.True(t, ok)
+	release()
+}
+
+func TestThrottleEntries(t *testing.T) {
+	throttles, err := NewThrottles(map[string]ThrottleConfig{
+		"replay": {MaxEntriesPerSecond: 10},
+	})
+	require.NoError(t, err)
+	throttle, ok := throttles.Get("replay")
+	require.True(t, ok)
+
+	// The first second of budget is available immediately
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		throttle.Wait(context.Background())
+	}
+	require.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	// Later entries wait for the budget to refill
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		throttle.Wait(context.Background())
+	}
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(250*time.Millisecond))
+
+	counters := throttles.Counters()["replay"]
+	require.Equal(t, uint64(13), counters["entries"])
+	require.Equal(t, uint64(3), counters["entries_throttled"])
+	require.Equal(t, uint64(0), counters["entries_borrowed"])
+	require.Greater(t, counters["wait_ms"], uint64(0))
+}
+
+func TestThrottleEntriesCancelled(t *testing.T) {
+	throttles, err := NewThrottles(map[string]ThrottleConfig{
+		"replay": {MaxEntriesPerSecond: 0.1},
+	})
+	require.NoError(t, err)
+	throttle, _ := throttles.Get("replay")
+
+	throttle.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	throttle.Wait(ctx)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestThrottleBorrowsEntriesFromIdle(t *testing.T) {
+	throttles, err := NewThrottles(map[string]ThrottleConfig{
+		"live":   {MaxEntriesPerSecond: 100},
+		"replay": {MaxEntriesPerSecond: 10},
+	})
+	require.NoError(t, err)
+	live, _ := throttles.Get("live")
+	replay, _ := throttles.Get("replay")
+
+	// While the live pipeline is idle, the replay uses its budget
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		replay.Wait(context.Background())
+	}
+	require.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+
+	// Once the live pipeline has used its budget, it no longer lends it
+	live.Wait(context.Background())
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		replay.Wait(context.Background())
+	}
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(400*time.Millisecond))
+
+	counters := throttles.Counters()
+	require.Equal(t, uint64(1), counters["live"]["entries"])
+	require.Equal(t, uint64(55), counters["replay"]["entries"])
+	require.GreaterOrEqual(t, counters["replay"]["entries_borrowed"], uint64(40))
+}
+
+func TestThrottleReads(t *testing.T) {
+	throttles, err := NewThrottles(map[string]ThrottleConfig{
+		"live":   {MaxConcurrentReads: 1},
+		"replay": {MaxConcurrentReads: 1},
+	})
+	require.NoError(t, err)
+	live, _ := throttles.Get("live")
+	replay, _ := throttles.Get("replay")
+
+	// The replay borrows the read of the idle live pipeline
+	releaseOwn, ok := replay.AcquireRead(context.Background())
+	require.True(t, ok)
+	releaseBorrowed, ok := replay.AcquireRead(context.Background())
+	require.True(t, ok)
+
+	// Both reads are in use, so the next read waits for one to be released
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, ok = replay.AcquireRead(ctx)
+	require.False(t, ok)
+
+	acquired := make(chan func())
+	go func() {
+		release, _ := live.AcquireRead(context.Background())
+		acquired <- release
+	}()
+
+	select {
+	case <-acquired:
+		require.FailNow(t, "Acquired a read that was lent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseBorrowed()
+	releaseBorrowed()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		require.FailNow(t, "Timed out waiting for a released read")
+	}
+	releaseOwn()
+
+	counters := throttles.Counters()
+	require.Equal(t, uint64(2), counters["replay"]["reads"])
+	require.Equal(t, uint64(1), counters["replay"]["reads_borrowed"])
+	require.Equal(t, uint64(1), counters["replay"]["reads_throttled"])
+	require.Equal(t, uint64(1), counters["live"]["reads"])
+	require.Equal(t, uint64(1), counters["live"]["reads_throttled"])
+}
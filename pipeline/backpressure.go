@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// Backpressure returns the sampled blocked time ratio of each edge in the
+// pipeline, keyed by the sending operator ID and then the receiving operator ID.
+// Operators that do not sample back-pressure are omitted.
+func (p *DirectedPipeline) Backpressure() map[string]map[string]float64 {
+	result := make(map[string]map[string]float64)
+	for _, op := range p.Operators() {
+		reporter, ok := op.(helper.BackpressureReporter)
+		if !ok {
+			continue
+		}
+
+		ratios := reporter.BackpressureRatios()
+		if ratios == nil {
+			continue
+		}
+		result[op.ID()] = ratios
+	}
+	return result
+}
+
+// BackpressureOf returns the blocked time ratio of each edge reported in the
+// status of the operators of an agent, keyed the same as Backpressure
+func BackpressureOf(statuses []operator.OperatorStatus) map[string]map[string]float64 {
+	result := make(map[string]map[string]float64)
+	for _, status := range statuses {
+		if status.Backpressure != nil {
+			result[status.ID] = status.Backpressure
+		}
+	}
+	return result
+}
+
+// RenderAnnotated renders a pipeline as a dot graph, the same as RenderAs,
+// with each edge that has a sampled blocked time ratio labeled and colored
+// by it
+func RenderAnnotated(p Pipeline, backpressure map[string]map[string]float64) []byte {
+	return newRenderCluster(p).dotWith(func(from, to string) string {
+		ratio, ok := backpressure[from][to]
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf(`label="%.1f%%", color=%s`, ratio*100, backpressureColor(ratio))
+	})
+}
+
+// backpressureColor returns the color used to render an edge with the given
+// blocked time ratio.
+func backpressureColor(ratio float64) string {
+	switch {
+	case ratio >= 0.5:
+		return "red"
+	case ratio >= 0.1:
+		return "orange"
+	default:
+		return "green"
+	}
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type reportingOperator struct {
+	*testutil.Operator
+	ratios map[string]float64
+}
+
+func (o reportingOperator) BackpressureRatios() map[string]float64 {
+	return o.ratios
+}
+
+func TestPipelineRenderAnnotated(t *testing.T) {
+	mockOperator1 := testutil.NewMockOperator("operator1")
+	mockOperator2 := testutil.NewMockOperator("operator2")
+	mockOperator3 := testutil.NewMockOperator("operator3")
+
+	operator1 := reportingOperator{mockOperator1, map[string]float64{"operator2": 0.75}}
+	operator2 := reportingOperator{mockOperator2, nil}
+
+	mockOperator1.On("Outputs").Return([]operator.Operator{operator2})
+	mockOperator2.On("Outputs").Return([]operator.Operator{mockOperator3})
+	mockOperator3.On("Outputs").Return(nil)
+
+	mockOperator1.On("SetOutputs", mock.Anything).Return(nil)
+	mockOperator2.On("SetOutputs", mock.Anything).Return(nil)
+	mockOperator3.On("SetOutputs", mock.Anything).Return(nil)
+
+	pipeline, err := NewDirectedPipeline([]operator.Operator{operator1, operator2, mockOperator3})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]map[string]float64{
+		"operator1": {"operator2": 0.75},
+	}, pipeline.Backpressure())
+
+	mockOperator1.On("Type").Return("reporter")
+	mockOperator2.On("Type").Return("reporter")
+	mockOperator3.On("Type").Return("mock")
+	statuses := pipeline.Status()
+	require.Equal(t, map[string]float64{"operator2": 0.75}, statuses[0].Backpressure)
+	require.Nil(t, statuses[1].Backpressure)
+	require.Equal(t, pipeline.Backpressure(), BackpressureOf(statuses))
+
+	dotGraph := RenderAnnotated(pipeline, pipeline.Backpressure())
+	require.Contains(t, string(dotGraph), `"operator1" -> "operator2" [label="75.0%", color=red];`)
+	require.Contains(t, string(dotGraph), `"operator2" -> "operator3";`)
+}
+
+func TestBackpressureColor(t *testing.T) {
+	require.Equal(t, "green", backpressureColor(0.01))
+	require.Equal(t, "orange", backpressureColor(0.2))
+	require.Equal(t, "red", backpressureColor(0.9))
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// setCatcher gives the catch operator of the pipeline, if there is one, to
+// every operator that sends the entries it fails to process to a catcher
+func setCatcher(operators []operator.Operator) error {
+	var catcher operator.Operator
+	for _, op := range operators {
+		if _, ok := op.(helper.Catcher); !ok {
+			continue
+		}
+		if catcher != nil {
+			return errors.NewError(
+				"pipeline has more than one catch operator",
+				"ensure that the pipeline has a single operator of type `catch`",
+				"catch_operators", catcher.ID()+", "+op.ID(),
+			)
+		}
+		catcher = op
+	}
+
+	if catcher == nil {
+		return nil
+	}
+
+	for _, op := range operators {
+		if catchable, ok := op.(helper.Catchable); ok {
+			catchable.SetCatcher(catcher.(helper.Catcher))
+		}
+	}
+	return nil
+}
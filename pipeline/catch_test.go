@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCatcher struct {
+	*testutil.Operator
+}
+
+func (m *mockCatcher) Catch(ctx context.Context, e *entry.Entry, operatorID string, err error) bool {
+	return true
+}
+
+type mockCatchable struct {
+	*testutil.Operator
+	catcher helper.Catcher
+}
+
+func (m *mockCatchable) SetCatcher(catcher helper.Catcher) {
+	m.catcher = catcher
+}
+
+func TestSetCatcher(t *testing.T) {
+	t.Run("Single", func(t *testing.T) {
+		catcher := &mockCatcher{testutil.NewMockOperator("$.catch")}
+		catchable := &mockCatchable{Operator: testutil.NewMockOperator("$.parser")}
+		require.NoError(t, setCatcher([]operator.Operator{catchable, catcher}))
+		require.Equal(t, catcher, catchable.catcher)
+	})
+
+	t.Run("None", func(t *testing.T) {
+		catchable := &mockCatchable{Operator: testutil.NewMockOperator("$.parser")}
+		require.NoError(t, setCatcher([]operator.Operator{catchable}))
+		require.Nil(t, catchable.catcher)
+	})
+
+	t.Run("Multiple", func(t *testing.T) {
+		catcher1 := &mockCatcher{testutil.NewMockOperator("$.catch1")}
+		catcher2 := &mockCatcher{testutil.NewMockOperator("$.catch2")}
+		err := setCatcher([]operator.Operator{catcher1, catcher2})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "more than one catch operator")
+	})
+}
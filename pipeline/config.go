@@ -1,7 +1,9 @@
 package pipeline
 
 import (
+	"github.com/observiq/stanza/errors"
 	"github.com/observiq/stanza/operator"
+	"go.uber.org/zap"
 )
 
 // Config is the configuration of a pipeline.
@@ -32,11 +34,71 @@ func (c Config) BuildPipeline(bc operator.BuildContext, defaultOperator operator
 		return nil, err
 	}
 
+	var logger *zap.SugaredLogger
+	if bc.Logger != nil {
+		logger = bc.Logger.SugaredLogger
+	}
+	if err := checkOverlaps(operators, logger); err != nil {
+		return nil, err
+	}
+
 	if defaultOperator != nil {
 		operators = append(operators, defaultOperator)
 	}
 
-	return NewDirectedPipeline(operators)
+	pipeline, err := NewDirectedPipeline(operators)
+	if err != nil {
+		return nil, err
+	}
+	warnOrphans(pipeline, defaultOperator, logger)
+	return pipeline, nil
+}
+
+// Validate builds the operators of the config and connects them, without
+// starting them, and returns each error that it finds. Each operator is built
+// on its own, so an operator that fails to build does not hide the errors of
+// the operators after it. The operators are only connected once they all
+// build.
+func (c Config) Validate(bc operator.BuildContext) []error {
+	errs := make([]error, 0)
+	operators := make([]operator.Operator, 0, len(c))
+	for i, builder := range c {
+		nbc := getBuildContextWithDefaultOutput(c, i, bc)
+		op, err := builder.Build(nbc)
+		if err != nil {
+			errs = append(errs, withOperatorID(err, bc.PrependNamespace(builder.ID())))
+			continue
+		}
+		operators = append(operators, op...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	var logger *zap.SugaredLogger
+	if bc.Logger != nil {
+		logger = bc.Logger.SugaredLogger
+	}
+	if err := checkOverlaps(operators, logger); err != nil {
+		return []error{err}
+	}
+
+	pipeline, err := NewDirectedPipeline(operators)
+	if err != nil {
+		return []error{err}
+	}
+	warnOrphans(pipeline, nil, logger)
+	return nil
+}
+
+// withOperatorID adds the ID of the operator that failed to build to an
+// error, unless the error already names an operator, such as an operator of a
+// plugin
+func withOperatorID(err error, operatorID string) error {
+	if agentErr, ok := err.(errors.AgentError); ok && agentErr.Details["operator_id"] != "" {
+		return err
+	}
+	return errors.WithDetails(err, "operator_id", operatorID)
 }
 
 func getBuildContextWithDefaultOutput(configs []operator.Config, i int, bc operator.BuildContext) operator.BuildContext {
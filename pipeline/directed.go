@@ -2,11 +2,13 @@ package pipeline
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/observiq/stanza/errors"
 	"github.com/observiq/stanza/operator"
-	"gonum.org/v1/gonum/graph/encoding/dot"
+	"github.com/observiq/stanza/operator/helper"
 	"gonum.org/v1/gonum/graph/simple"
 	"gonum.org/v1/gonum/graph/topo"
 )
@@ -16,6 +18,12 @@ var _ Pipeline = (*DirectedPipeline)(nil)
 // DirectedPipeline is a pipeline backed by a directed graph
 type DirectedPipeline struct {
 	Graph *simple.DirectedGraph
+
+	// started holds the IDs of the operators that have started, and is
+	// guarded by mux so that the status can be read while the pipeline starts
+	// and stops
+	started map[string]bool
+	mux     sync.Mutex
 }
 
 // Start will start the operators in a pipeline in reverse topological order
@@ -27,28 +35,81 @@ func (p *DirectedPipeline) Start() error {
 		if err := operator.Start(); err != nil {
 			return err
 		}
+		p.setStarted(operator.ID(), true)
 		operator.Logger().Debug("Started operator")
 	}
 
 	return nil
 }
 
-// Stop will stop the operators in a pipeline in topological order
+// Stop will stop the operators in a pipeline in topological order. Once an
+// operator stops, the entries it queued for its outputs are written before
+// the outputs are stopped.
 func (p *DirectedPipeline) Stop() error {
 	sortedNodes, _ := topo.Sort(p.Graph)
 	for _, node := range sortedNodes {
 		operator := node.(OperatorNode).Operator()
 		operator.Logger().Debug("Stopping operator")
 		_ = operator.Stop()
+		if drainer, ok := operator.(helper.OutputDrainer); ok {
+			drainer.DrainOutputs()
+		}
+		p.setStarted(operator.ID(), false)
 		operator.Logger().Debug("Stopped operator")
 	}
 
 	return nil
 }
 
+// setStarted records whether an operator has started
+func (p *DirectedPipeline) setStarted(operatorID string, started bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.started == nil {
+		p.started = make(map[string]bool)
+	}
+	p.started[operatorID] = started
+}
+
+// Status returns the status of each operator in the pipeline, sorted by ID
+func (p *DirectedPipeline) Status() []operator.OperatorStatus {
+	operators := p.Operators()
+	statuses := make([]operator.OperatorStatus, 0, len(operators))
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, op := range operators {
+		status := operator.OperatorStatus{
+			ID:      op.ID(),
+			Type:    op.Type(),
+			Started: p.started[op.ID()],
+		}
+
+		if reporter, ok := op.(helper.StatsReporter); ok {
+			if stats := reporter.OperatorStats(); stats != nil {
+				snapshot := stats.Snapshot()
+				status.EntriesIn = snapshot.EntriesIn
+				status.EntriesOut = snapshot.EntriesOut
+				status.Dropped = snapshot.Dropped
+				status.Errored = snapshot.Errored
+			}
+		}
+		if reporter, ok := op.(helper.BackpressureReporter); ok {
+			status.Backpressure = reporter.BackpressureRatios()
+		}
+		if statuser, ok := op.(operator.Statuser); ok {
+			status.Details = statuser.Status()
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
 // Render will render the pipeline as a dot graph
 func (p *DirectedPipeline) Render() ([]byte, error) {
-	return dot.Marshal(p.Graph, "G", "", " ")
+	return RenderAs(p, DotFormat)
 }
 
 // Operators returns a slice of operators that make up the pipeline graph
@@ -91,7 +152,7 @@ func connectNodes(graph *simple.DirectedGraph) error {
 		return errors.NewError(
 			"pipeline has a circular dependency",
 			"ensure that all operators are connected in a straight, acyclic line",
-			"cycles", unorderableToCycles(err.(topo.Unorderable)),
+			"cycles", unorderableToCycles(orderCycles(graph, err.(topo.Unorderable))),
 		)
 	}
 
@@ -110,6 +171,16 @@ func connectNode(graph *simple.DirectedGraph, inputNode OperatorNode) error {
 			)
 		}
 
+		// A graph cannot have an edge from a node to itself, so an operator
+		// that outputs to itself is reported as the shortest cycle
+		if outputNodeID == inputNode.ID() {
+			return errors.NewError(
+				"pipeline has a circular dependency",
+				"ensure that all operators are connected in a straight, acyclic line",
+				"cycles", unorderableToCycles(topo.Unorderable{{inputNode}}),
+			)
+		}
+
 		outputNode := graph.Node(outputNodeID).(OperatorNode)
 		if !outputNode.Operator().CanProcess() {
 			return errors.NewError(
@@ -156,6 +227,10 @@ func NewDirectedPipeline(operators []operator.Operator) (*DirectedPipeline, erro
 		return nil, err
 	}
 
+	if err := setCatcher(operators); err != nil {
+		return nil, err
+	}
+
 	graph := simple.NewDirectedGraph()
 	if err := addNodes(graph, operators); err != nil {
 		return nil, err
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/testutil"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -261,6 +262,10 @@ func TestPipelineRender(t *testing.T) {
 	mockOperator2.On("SetOutputs", mock.Anything).Return(nil)
 	mockOperator3.On("SetOutputs", mock.Anything).Return(nil)
 
+	mockOperator1.On("Type").Return("generate_input")
+	mockOperator2.On("Type").Return("json_parser")
+	mockOperator3.On("Type").Return("stdout")
+
 	pipeline, err := NewDirectedPipeline([]operator.Operator{mockOperator1, mockOperator2, mockOperator3})
 	require.NoError(t, err)
 
@@ -268,13 +273,13 @@ func TestPipelineRender(t *testing.T) {
 	require.NoError(t, err)
 	expected := `strict digraph G {
  // Node definitions.
- operator1;
- operator3;
- operator2;
+ "operator1" [label="operator1\ngenerate_input"];
+ "operator2" [label="operator2\njson_parser"];
+ "operator3" [label="operator3\nstdout"];
 
  // Edge definitions.
- operator1 -> operator2;
- operator2 -> operator3;
+ "operator1" -> "operator2";
+ "operator2" -> "operator3";
 }`
 	require.Equal(t, expected, string(dotGraph))
 }
@@ -298,3 +303,55 @@ func TestPipelineOperators(t *testing.T) {
 	operators := pipeline.Operators()
 	require.ElementsMatch(t, []operator.Operator{mockOperator1, mockOperator2, mockOperator3}, operators)
 }
+
+type statusOperator struct {
+	*testutil.Operator
+	stats *helper.OperatorStats
+}
+
+func (o statusOperator) OperatorStats() *helper.OperatorStats {
+	return o.stats
+}
+
+func (o statusOperator) Status() map[string]interface{} {
+	return map[string]interface{}{"known_files": 2}
+}
+
+func TestPipelineStatus(t *testing.T) {
+	mockOperator1 := testutil.NewMockOperator("operator1")
+	mockOperator2 := statusOperator{
+		Operator: testutil.NewMockOperator("operator2"),
+		stats:    &helper.OperatorStats{EntriesIn: 3, EntriesOut: 2, Dropped: 4, Errored: 1},
+	}
+
+	mockOperator1.On("Outputs").Return([]operator.Operator{mockOperator2})
+	mockOperator2.On("Outputs").Return(nil)
+	mockOperator1.On("SetOutputs", mock.Anything).Return(nil)
+	mockOperator2.On("SetOutputs", mock.Anything).Return(nil)
+	mockOperator1.On("Logger", mock.Anything).Return(zap.NewNop().Sugar())
+	mockOperator2.On("Logger", mock.Anything).Return(zap.NewNop().Sugar())
+	mockOperator1.On("Type").Return("mock")
+	mockOperator2.On("Type").Return("status")
+
+	mockOperator1.On("Start").Return(fmt.Errorf("operator 1 failed to start"))
+	mockOperator2.On("Start").Return(nil)
+	mockOperator1.On("Stop").Return(nil)
+	mockOperator2.On("Stop").Return(nil)
+
+	pipeline, err := NewDirectedPipeline([]operator.Operator{mockOperator1, mockOperator2})
+	require.NoError(t, err)
+
+	expected := []operator.OperatorStatus{
+		{ID: "operator1", Type: "mock"},
+		{ID: "operator2", Type: "status", EntriesIn: 3, EntriesOut: 2, Dropped: 4, Errored: 1, Details: map[string]interface{}{"known_files": 2}},
+	}
+	require.Equal(t, expected, pipeline.Status())
+
+	require.Error(t, pipeline.Start())
+	expected[1].Started = true
+	require.Equal(t, expected, pipeline.Status())
+
+	require.NoError(t, pipeline.Stop())
+	expected[1].Started = false
+	require.Equal(t, expected, pipeline.Status())
+}
@@ -0,0 +1,238 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// expectOutputType is the type of the operators that collect the entries
+// written by an operator under test
+const expectOutputType = "expect_output"
+
+// CheckExpectations runs the expectations of each operator of the config,
+// and returns an error for each expectation that fails. Each expectation is
+// run against an operator built on its own, with its outputs replaced by
+// operators that collect the entries it writes, so no entry leaves the
+// operator and nothing else in the pipeline is built or started.
+func (c Config) CheckExpectations(bc operator.BuildContext) []error {
+	errs := make([]error, 0)
+	for _, config := range c {
+		for i, expectation := range config.Expect {
+			name := expectation.Name
+			if name == "" {
+				name = fmt.Sprintf("%d", i+1)
+			}
+
+			operatorID := bc.PrependNamespace(config.ID())
+			failures, err := c.runExpectation(bc, config, expectation)
+			if err != nil {
+				errs = append(errs, errors.Wrap(err, fmt.Sprintf("run expect case '%s'", name)).
+					WithDetails("operator_id", operatorID))
+				continue
+			}
+			if len(failures) > 0 {
+				errs = append(errs, errors.NewError(
+					fmt.Sprintf("expect case '%s' failed: %s", name, strings.Join(failures, "; ")),
+					"fix the operator config, or update the expected fields if the change is intended",
+					"operator_id", operatorID,
+				))
+			}
+		}
+	}
+	return errs
+}
+
+// runExpectation builds and starts the operator of a config, sends it the
+// input of an expectation, and compares the entries it writes to the
+// expectation once it is stopped
+func (c Config) runExpectation(bc operator.BuildContext, config operator.Config, expectation operator.Expectation) ([]string, error) {
+	collector := &expectCollector{}
+	outputIDs := make([]string, 0, len(c))
+	for _, other := range c {
+		if other.ID() != config.ID() {
+			outputIDs = append(outputIDs, other.ID())
+		}
+	}
+	outputIDs = append(outputIDs, expectOutputType)
+
+	// Entries that the operator would write to the next operator by default
+	// are collected as well
+	operators, err := config.Build(bc.WithDefaultOutputIDs([]string{bc.PrependNamespace(expectOutputType)}))
+	if err != nil {
+		return nil, err
+	}
+	if len(operators) != 1 || !operators[0].CanProcess() || !operators[0].CanOutput() {
+		return nil, errors.NewError(
+			"expect is only supported by operators that process entries and write them to outputs",
+			"move the expect block to a parser or transformer",
+		)
+	}
+	op := operators[0]
+
+	outputs := make([]operator.Operator, 0, len(outputIDs))
+	for _, id := range outputIDs {
+		output, err := helper.NewOutputConfig(id, expectOutputType).Build(bc)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, &expectOutput{OutputOperator: output, collector: collector})
+	}
+	if err := op.SetOutputs(outputs); err != nil {
+		return nil, err
+	}
+
+	if err := op.Start(); err != nil {
+		return nil, fmt.Errorf("start operator: %s", err)
+	}
+
+	e := entry.New()
+	e.Record = stringKeys(expectation.Input)
+	for k, v := range expectation.Labels {
+		e.AddLabel(k, v)
+	}
+	processErr := op.Process(context.Background(), e)
+
+	// Stopping the operator flushes the entries it holds
+	if err := op.Stop(); err != nil {
+		return nil, fmt.Errorf("stop operator: %s", err)
+	}
+
+	failures := make([]string, 0)
+	if processErr != nil {
+		failures = append(failures, fmt.Sprintf("processing failed: %s", processErr))
+	}
+	return append(failures, compareExpectation(expectation, collector.entries())...), nil
+}
+
+// compareExpectation describes the differences between an expectation and
+// the entries an operator wrote. Values are compared as JSON, so that numbers
+// and maps parsed from yaml match those of entries.
+func compareExpectation(expectation operator.Expectation, written []*entry.Entry) []string {
+	if expectation.Dropped {
+		if len(written) > 0 {
+			return []string{fmt.Sprintf("expected the entry to be dropped, got %d entries", len(written))}
+		}
+		return nil
+	}
+	if len(written) != 1 {
+		return []string{fmt.Sprintf("expected 1 entry, got %d", len(written))}
+	}
+
+	keys := make([]string, 0, len(expectation.Fields))
+	for key := range expectation.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	failures := make([]string, 0)
+	for _, key := range keys {
+		field, err := entry.ParseField(key)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid field %s: %s", key, err))
+			continue
+		}
+
+		expected := normalizeValue(expectation.Fields[key])
+		value, ok := written[0].Get(field)
+		switch {
+		case expected == nil && ok:
+			failures = append(failures, fmt.Sprintf("%s: expected no value, got %s", key, valueJSON(value)))
+		case expected == nil:
+		case !ok:
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got no value", key, valueJSON(expected)))
+		case !reflect.DeepEqual(expected, normalizeValue(value)):
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got %s", key, valueJSON(expected), valueJSON(value)))
+		}
+	}
+	return failures
+}
+
+// normalizeValue converts a value to its JSON representation, with the maps
+// parsed from yaml converted to maps with string keys
+func normalizeValue(value interface{}) interface{} {
+	data, err := json.Marshal(stringKeys(value))
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+// stringKeys converts the maps parsed from yaml, which have keys of any type,
+// to maps with string keys
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprintf("%v", k)] = stringKeys(child)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = stringKeys(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for _, child := range v {
+			s = append(s, stringKeys(child))
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func valueJSON(value interface{}) string {
+	data, err := json.Marshal(stringKeys(value))
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// expectCollector collects the entries written by an operator under test to
+// any of its outputs
+type expectCollector struct {
+	mux     sync.Mutex
+	written []*entry.Entry
+}
+
+func (c *expectCollector) add(e *entry.Entry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.written = append(c.written, e)
+}
+
+func (c *expectCollector) entries() []*entry.Entry {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.written
+}
+
+// expectOutput is an output of an operator under test
+type expectOutput struct {
+	helper.OutputOperator
+	collector *expectCollector
+}
+
+// Process collects an entry
+func (o *expectOutput) Process(_ context.Context, e *entry.Entry) error {
+	o.collector.add(e)
+	return nil
+}
@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+
+	_ "github.com/observiq/stanza/operator/builtin/input/generate"
+	_ "github.com/observiq/stanza/operator/builtin/output/drop"
+	_ "github.com/observiq/stanza/operator/builtin/transformer/noop"
+	_ "github.com/observiq/stanza/operator/builtin/transformer/router"
+)
+
+func TestCheckExpectations(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			"NoExpectations",
+			`
+- type: noop
+- type: drop_output
+`,
+			nil,
+		},
+		{
+			"Passed",
+			`
+- type: noop
+  expect:
+    - input:
+        message: started
+        nested:
+          count: 1
+      labels:
+        env: prod
+      fields:
+        message: started
+        nested: {count: 1}
+        $labels.env: prod
+        $labels.missing: null
+- type: drop_output
+`,
+			nil,
+		},
+		{
+			"Failed",
+			`
+- type: noop
+  expect:
+    - name: values
+      input:
+        count: 1
+      fields:
+        count: 2
+        missing: value
+        $record.count: null
+- type: drop_output
+`,
+			[]string{
+				`expect case 'values' failed: $record.count: expected no value, got 1; count: expected 2, got 1; missing: expected "value", got no value`,
+			},
+		},
+		{
+			"Routes",
+			`
+- type: router
+  routes:
+    - expr: '$record.level == "error"'
+      output: errors
+      labels:
+        route: errors
+  expect:
+    - name: routed
+      input: {level: error}
+      fields:
+        $labels.route: errors
+    - name: unrouted
+      input: {level: info}
+      dropped: true
+    - name: wrong
+      input: {level: info}
+      fields:
+        level: info
+- id: errors
+  type: drop_output
+`,
+			[]string{
+				"expect case 'wrong' failed: expected 1 entry, got 0",
+			},
+		},
+		{
+			"Unsupported",
+			`
+- type: generate_input
+  entry:
+    record: test
+  expect:
+    - input: test
+- type: drop_output
+`,
+			[]string{
+				"run expect case '1': expect is only supported by operators that process entries and write them to outputs",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var config Config
+			require.NoError(t, yaml.UnmarshalStrict([]byte(tc.config), &config))
+
+			errs := config.CheckExpectations(testutil.NewBuildContext(t))
+			require.Len(t, errs, len(tc.expected))
+			for i, expected := range tc.expected {
+				require.Contains(t, errs[i].Error(), expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"go.uber.org/zap"
+)
+
+var _ Pipeline = (*Group)(nil)
+
+// Group is a pipeline made of independent named pipelines. Each pipeline
+// starts on its own, so a pipeline that fails to start is stopped and logged,
+// and does not keep the other pipelines from running.
+type Group struct {
+	names     []string
+	pipelines map[string]*DirectedPipeline
+	failed    map[string]bool
+
+	*zap.SugaredLogger
+}
+
+// NewGroup creates an empty group of pipelines
+func NewGroup(logger *zap.SugaredLogger) *Group {
+	return &Group{
+		pipelines:     make(map[string]*DirectedPipeline),
+		failed:        make(map[string]bool),
+		SugaredLogger: logger,
+	}
+}
+
+// Add adds a named pipeline to the group
+func (g *Group) Add(name string, pipeline *DirectedPipeline) {
+	if _, ok := g.pipelines[name]; !ok {
+		g.names = append(g.names, name)
+	}
+	g.pipelines[name] = pipeline
+}
+
+// Names returns the names of the pipelines in the group, in the order they
+// were added
+func (g *Group) Names() []string {
+	return g.names
+}
+
+// Pipeline returns a pipeline of the group by name
+func (g *Group) Pipeline(name string) (*DirectedPipeline, bool) {
+	pipeline, ok := g.pipelines[name]
+	return pipeline, ok
+}
+
+// Start starts each pipeline of the group. A pipeline that fails to start is
+// stopped, and its error is logged with the name of the pipeline. Start only
+// returns an error if no pipeline started.
+func (g *Group) Start() error {
+	var firstErr error
+	started := 0
+	for _, name := range g.names {
+		pipeline := g.pipelines[name]
+		if err := pipeline.Start(); err != nil {
+			_ = pipeline.Stop()
+			g.failed[name] = true
+			err = errors.WithDetails(err, "pipeline", name)
+			g.Errorw("Failed to start pipeline", "pipeline", name, zap.Any("error", err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		g.failed[name] = false
+		started++
+	}
+
+	if started == 0 && firstErr != nil {
+		return firstErr
+	}
+	return nil
+}
+
+// Stop stops each pipeline of the group that started
+func (g *Group) Stop() error {
+	var firstErr error
+	for _, name := range g.names {
+		if g.failed[name] {
+			continue
+		}
+		if err := g.pipelines[name].Stop(); err != nil && firstErr == nil {
+			firstErr = errors.WithDetails(err, "pipeline", name)
+		}
+	}
+	return firstErr
+}
+
+// Operators returns the operators of every pipeline in the group
+func (g *Group) Operators() []operator.Operator {
+	operators := make([]operator.Operator, 0)
+	for _, name := range g.names {
+		operators = append(operators, g.pipelines[name].Operators()...)
+	}
+	return operators
+}
+
+// Status returns the status of each operator of every pipeline in the
+// group, sorted by ID
+func (g *Group) Status() []operator.OperatorStatus {
+	statuses := make([]operator.OperatorStatus, 0)
+	for _, name := range g.names {
+		statuses = append(statuses, g.pipelines[name].Status()...)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// Render will render the group as a dot graph, with each pipeline as a
+// subgraph labeled with its name
+func (g *Group) Render() ([]byte, error) {
+	return RenderAs(g, DotFormat)
+}
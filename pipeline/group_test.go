@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newGroupTestPipeline creates a pipeline of an input and an output, where
+// the input fails to start if startErr is not nil
+func newGroupTestPipeline(t *testing.T, namespace string, startErr error) (*DirectedPipeline, *testutil.Operator) {
+	input := testutil.NewMockOperator(namespace + ".input")
+	output := testutil.NewMockOperator(namespace + ".output")
+	input.On("Outputs").Return([]operator.Operator{output})
+	output.On("Outputs").Return(nil)
+	for _, op := range []*testutil.Operator{input, output} {
+		op.On("SetOutputs", mock.Anything).Return(nil)
+		op.On("Logger", mock.Anything).Return(zap.NewNop().Sugar())
+		op.On("Type").Return("mock")
+		op.On("Stop").Return(nil)
+	}
+	input.On("Start").Return(startErr)
+	output.On("Start").Return(nil)
+
+	pipeline, err := NewDirectedPipeline([]operator.Operator{input, output})
+	require.NoError(t, err)
+	return pipeline, input
+}
+
+func TestGroupStart(t *testing.T) {
+	t.Run("AllStart", func(t *testing.T) {
+		system, systemInput := newGroupTestPipeline(t, "$.system", nil)
+		app, appInput := newGroupTestPipeline(t, "$.app", nil)
+		group := NewGroup(zap.NewNop().Sugar())
+		group.Add("system", system)
+		group.Add("app", app)
+
+		require.NoError(t, group.Start())
+		systemInput.AssertCalled(t, "Start")
+		appInput.AssertCalled(t, "Start")
+
+		require.NoError(t, group.Stop())
+		systemInput.AssertCalled(t, "Stop")
+		appInput.AssertCalled(t, "Stop")
+	})
+
+	t.Run("OneFails", func(t *testing.T) {
+		system, systemInput := newGroupTestPipeline(t, "$.system", fmt.Errorf("input failed"))
+		app, appInput := newGroupTestPipeline(t, "$.app", nil)
+		group := NewGroup(zap.NewNop().Sugar())
+		group.Add("system", system)
+		group.Add("app", app)
+
+		require.NoError(t, group.Start())
+		appInput.AssertCalled(t, "Start")
+
+		statuses := group.Status()
+		require.Len(t, statuses, 4)
+		for _, status := range statuses {
+			require.Equal(t, strings.HasPrefix(status.ID, "$.app."), status.Started, status.ID)
+		}
+
+		// The failed pipeline was stopped when it failed to start
+		systemInput.AssertNumberOfCalls(t, "Stop", 1)
+		require.NoError(t, group.Stop())
+		systemInput.AssertNumberOfCalls(t, "Stop", 1)
+		appInput.AssertNumberOfCalls(t, "Stop", 1)
+	})
+
+	t.Run("AllFail", func(t *testing.T) {
+		system, _ := newGroupTestPipeline(t, "$.system", fmt.Errorf("input failed"))
+		group := NewGroup(zap.NewNop().Sugar())
+		group.Add("system", system)
+
+		err := group.Start()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "input failed")
+		require.Contains(t, err.Error(), "system")
+	})
+}
+
+func TestGroupOperators(t *testing.T) {
+	system, _ := newGroupTestPipeline(t, "$.system", nil)
+	app, _ := newGroupTestPipeline(t, "$.app", nil)
+	group := NewGroup(zap.NewNop().Sugar())
+	group.Add("system", system)
+	group.Add("app", app)
+
+	require.Equal(t, []string{"system", "app"}, group.Names())
+	ids := make([]string, 0)
+	for _, op := range group.Operators() {
+		ids = append(ids, op.ID())
+	}
+	require.ElementsMatch(t, []string{"$.system.input", "$.system.output", "$.app.input", "$.app.output"}, ids)
+
+	pipeline, ok := group.Pipeline("app")
+	require.True(t, ok)
+	require.Equal(t, app, pipeline)
+}
+
+func TestGroupRender(t *testing.T) {
+	system, _ := newGroupTestPipeline(t, "$.system", nil)
+	app, _ := newGroupTestPipeline(t, "$.app", nil)
+	group := NewGroup(zap.NewNop().Sugar())
+	group.Add("system", system)
+	group.Add("app", app)
+
+	dotGraph, err := group.Render()
+	require.NoError(t, err)
+	expected := `strict digraph G {
+ // Node definitions.
+ subgraph "cluster_system" {
+  label="system";
+  "$.system.input" [label="$.system.input\nmock"];
+  "$.system.output" [label="$.system.output\nmock"];
+ }
+ subgraph "cluster_app" {
+  label="app";
+  "$.app.input" [label="$.app.input\nmock"];
+  "$.app.output" [label="$.app.output\nmock"];
+ }
+
+ // Edge definitions.
+ "$.app.input" -> "$.app.output";
+ "$.system.input" -> "$.system.output";
+}`
+	require.Equal(t, expected, string(dotGraph))
+}
@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+	"go.uber.org/zap"
+)
+
+// OverlapDetector is implemented by operators that can detect when they
+// collect the same data as another operator in the pipeline.
+type OverlapDetector interface {
+	// Overlap returns a description of the data collected by both operators.
+	// It returns false if the operators do not overlap.
+	Overlap(other operator.Operator) (string, bool)
+
+	// StrictOverlap returns true if an overlap should fail the build.
+	StrictOverlap() bool
+}
+
+// checkOverlaps will warn about each pair of operators that collect the same
+// data. If either operator of a pair is strict, an error is returned instead.
+func checkOverlaps(operators []operator.Operator, logger *zap.SugaredLogger) error {
+	for i, op := range operators {
+		for _, other := range operators[i+1:] {
+			if err := checkOverlap(op, other, logger); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckOverlapsBetween checks each pair of operators of different pipelines,
+// such as the named pipelines of an agent, for overlapping data. The pairs
+// within a pipeline are checked when the pipeline is built.
+func CheckOverlapsBetween(pipelines [][]operator.Operator, logger *zap.SugaredLogger) error {
+	for i, operators := range pipelines {
+		for _, others := range pipelines[i+1:] {
+			for _, op := range operators {
+				for _, other := range others {
+					if err := checkOverlap(op, other, logger); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkOverlap warns if two operators collect the same data, or returns an
+// error if either of them is strict
+func checkOverlap(op, other operator.Operator, logger *zap.SugaredLogger) error {
+	detector, ok := op.(OverlapDetector)
+	if !ok {
+		return nil
+	}
+
+	description, overlaps := detector.Overlap(other)
+	if !overlaps {
+		return nil
+	}
+
+	otherDetector, ok := other.(OverlapDetector)
+	if detector.StrictOverlap() || (ok && otherDetector.StrictOverlap()) {
+		return errors.NewError(
+			"operators collect overlapping data",
+			"ensure that the operators do not read the same sources, or disable strict checking",
+			"first_operator", op.ID(),
+			"second_operator", other.ID(),
+			"overlap", description,
+		)
+	}
+
+	if logger != nil {
+		logger.Warnw("Operators collect overlapping data, which may be ingested twice",
+			"first_operator", op.ID(),
+			"second_operator", other.ID(),
+			"overlap", description,
+		)
+	}
+	return nil
+}
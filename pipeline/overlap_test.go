@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type overlappingOperator struct {
+	*testutil.Operator
+	overlaps map[string]string
+	strict   bool
+}
+
+func (o overlappingOperator) Overlap(other operator.Operator) (string, bool) {
+	description, ok := o.overlaps[other.ID()]
+	return description, ok
+}
+
+func (o overlappingOperator) StrictOverlap() bool {
+	return o.strict
+}
+
+func TestCheckOverlaps(t *testing.T) {
+	cases := []struct {
+		name        string
+		strict1     bool
+		strict2     bool
+		overlaps    map[string]string
+		expectError bool
+	}{
+		{"NoOverlap", true, true, nil, false},
+		{"Overlap", false, false, map[string]string{"operator2": "same files"}, false},
+		{"OverlapStrictFirst", true, false, map[string]string{"operator2": "same files"}, true},
+		{"OverlapStrictSecond", false, true, map[string]string{"operator2": "same files"}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			operator1 := overlappingOperator{testutil.NewMockOperator("operator1"), tc.overlaps, tc.strict1}
+			operator2 := overlappingOperator{testutil.NewMockOperator("operator2"), nil, tc.strict2}
+			operator3 := testutil.NewMockOperator("operator3")
+
+			err := checkOverlaps([]operator.Operator{operator1, operator2, operator3}, zap.NewNop().Sugar())
+			if tc.expectError {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "overlapping")
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCheckOverlapsBetween(t *testing.T) {
+	operator1 := overlappingOperator{testutil.NewMockOperator("operator1"), map[string]string{"operator2": "same files"}, true}
+	operator2 := overlappingOperator{testutil.NewMockOperator("operator2"), nil, false}
+	operator3 := testutil.NewMockOperator("operator3")
+
+	// The operators of a single pipeline are not checked against each other
+	err := CheckOverlapsBetween([][]operator.Operator{{operator1, operator2}, {operator3}}, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	err = CheckOverlapsBetween([][]operator.Operator{{operator1, operator3}, {operator2}}, zap.NewNop().Sugar())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "overlapping")
+}
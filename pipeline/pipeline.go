@@ -10,4 +10,5 @@ type Pipeline interface {
 	Stop() error
 	Operators() []operator.Operator
 	Render() ([]byte, error)
+	Status() []operator.OperatorStatus
 }
@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/observiq/stanza/errors"
+	"github.com/observiq/stanza/operator"
+)
+
+// The formats a pipeline can be rendered in
+const (
+	DotFormat     = "dot"
+	MermaidFormat = "mermaid"
+)
+
+// RenderAs renders the operators of a pipeline as a graph in the given
+// format. Each node is labeled with the ID and type of its operator. Each
+// pipeline of a group is drawn in a box labeled with its name, and the
+// operators a plugin expanded to are drawn in a box labeled with the ID of
+// the plugin.
+func RenderAs(p Pipeline, format string) ([]byte, error) {
+	root := newRenderCluster(p)
+	switch format {
+	case DotFormat:
+		return root.dot(), nil
+	case MermaidFormat:
+		return root.mermaid(), nil
+	default:
+		return nil, errors.NewError(
+			fmt.Sprintf("unsupported graph format '%s'", format),
+			"use one of dot or mermaid",
+		)
+	}
+}
+
+// renderCluster is a group of operators drawn together, such as a pipeline
+// or the operators a plugin expanded to
+type renderCluster struct {
+	label     string
+	operators []operator.Operator
+	clusters  []*renderCluster
+}
+
+// newRenderCluster creates the root cluster of a pipeline. A group has a
+// cluster for each of its pipelines.
+func newRenderCluster(p Pipeline) *renderCluster {
+	group, ok := p.(*Group)
+	if !ok {
+		return splitNamespaces("$", "", p.Operators())
+	}
+
+	root := &renderCluster{}
+	for _, name := range group.names {
+		operators := group.pipelines[name].Operators()
+		cluster := splitNamespaces(pipelineNamespace(name, operators), name, operators)
+		root.clusters = append(root.clusters, cluster)
+	}
+	return root
+}
+
+// pipelineNamespace returns the namespace of a pipeline of a group. A named
+// pipeline namespaces its operators with its name, while the top-level
+// pipeline does not.
+func pipelineNamespace(name string, operators []operator.Operator) string {
+	namespace := "$." + name
+	for _, op := range operators {
+		if !strings.HasPrefix(op.ID(), namespace+".") {
+			return "$"
+		}
+	}
+	return namespace
+}
+
+// splitNamespaces creates a cluster for the operators of a namespace, with a
+// nested cluster for the operators of each namespace below it. A plugin
+// usually gives its first operator the ID of the plugin, so an operator with
+// the ID of a nested namespace is put in its cluster.
+func splitNamespaces(namespace, label string, operators []operator.Operator) *renderCluster {
+	cluster := &renderCluster{label: label}
+	nested := make(map[string][]operator.Operator)
+	own := make([]operator.Operator, 0, len(operators))
+	for _, op := range operators {
+		name := strings.TrimPrefix(op.ID(), namespace+".")
+		i := strings.Index(name, ".")
+		if name == op.ID() || i < 0 {
+			own = append(own, op)
+			continue
+		}
+		subNamespace := namespace + "." + name[:i]
+		nested[subNamespace] = append(nested[subNamespace], op)
+	}
+	for _, op := range own {
+		if _, ok := nested[op.ID()]; ok {
+			nested[op.ID()] = append(nested[op.ID()], op)
+			continue
+		}
+		cluster.operators = append(cluster.operators, op)
+	}
+
+	sortOperators(cluster.operators)
+	subNamespaces := make([]string, 0, len(nested))
+	for subNamespace := range nested {
+		subNamespaces = append(subNamespaces, subNamespace)
+	}
+	sort.Strings(subNamespaces)
+	for _, subNamespace := range subNamespaces {
+		cluster.clusters = append(cluster.clusters, splitNamespaces(subNamespace, subNamespace, nested[subNamespace]))
+	}
+	return cluster
+}
+
+// all returns the operators of the cluster and its nested clusters
+func (c *renderCluster) all() []operator.Operator {
+	operators := append([]operator.Operator{}, c.operators...)
+	for _, cluster := range c.clusters {
+		operators = append(operators, cluster.all()...)
+	}
+	return operators
+}
+
+// edges returns the IDs of each operator and its outputs, sorted
+func (c *renderCluster) edges() [][2]string {
+	edges := make([][2]string, 0)
+	for _, op := range c.all() {
+		if !op.CanOutput() {
+			continue
+		}
+		for _, output := range op.Outputs() {
+			edges = append(edges, [2]string{op.ID(), output.ID()})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+	return edges
+}
+
+// dot renders the cluster as a dot graph
+func (c *renderCluster) dot() []byte {
+	return c.dotWith(func(string, string) string { return "" })
+}
+
+// dotWith renders the cluster as a dot graph, with the attributes returned
+// by edgeAttributes for each edge
+func (c *renderCluster) dotWith(edgeAttributes func(from, to string) string) []byte {
+	var b strings.Builder
+	b.WriteString("strict digraph G {\n")
+	c.writeDot(&b, " ")
+	b.WriteString("\n // Edge definitions.\n")
+	for _, edge := range c.edges() {
+		if attributes := edgeAttributes(edge[0], edge[1]); attributes != "" {
+			fmt.Fprintf(&b, " %s -> %s [%s];\n", dotQuote(edge[0]), dotQuote(edge[1]), attributes)
+			continue
+		}
+		fmt.Fprintf(&b, " %s -> %s;\n", dotQuote(edge[0]), dotQuote(edge[1]))
+	}
+	b.WriteString("}")
+	return []byte(b.String())
+}
+
+// writeDot writes the nodes of the cluster and a subgraph for each nested
+// cluster. The cluster prefix of a subgraph draws it in a box.
+func (c *renderCluster) writeDot(b *strings.Builder, indent string) {
+	if indent == " " {
+		b.WriteString(" // Node definitions.\n")
+	}
+	for _, op := range c.operators {
+		label := dotEscape(op.ID()) + `\n` + dotEscape(op.Type())
+		fmt.Fprintf(b, "%s%s [label=\"%s\"];\n", indent, dotQuote(op.ID()), label)
+	}
+	for _, cluster := range c.clusters {
+		fmt.Fprintf(b, "%ssubgraph %s {\n", indent, dotQuote("cluster_"+cluster.label))
+		fmt.Fprintf(b, "%s label=%s;\n", indent, dotQuote(cluster.label))
+		cluster.writeDot(b, indent+" ")
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+}
+
+// mermaid renders the cluster as a mermaid flowchart. Mermaid does not
+// allow the characters of operator IDs in node IDs, so each node is given
+// an ID from its position.
+func (c *renderCluster) mermaid() []byte {
+	nodeIDs := make(map[string]string)
+	for i, op := range c.all() {
+		nodeIDs[op.ID()] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	clusterCount := 0
+	c.writeMermaid(&b, "  ", nodeIDs, &clusterCount)
+	for _, edge := range c.edges() {
+		fmt.Fprintf(&b, "  %s --> %s\n", nodeIDs[edge[0]], nodeIDs[edge[1]])
+	}
+	return []byte(b.String())
+}
+
+// writeMermaid writes the nodes of the cluster and a subgraph for each
+// nested cluster
+func (c *renderCluster) writeMermaid(b *strings.Builder, indent string, nodeIDs map[string]string, clusterCount *int) {
+	for _, op := range c.operators {
+		label := mermaidEscape(op.ID()) + "<br>" + mermaidEscape(op.Type())
+		fmt.Fprintf(b, "%s%s[\"%s\"]\n", indent, nodeIDs[op.ID()], label)
+	}
+	for _, cluster := range c.clusters {
+		fmt.Fprintf(b, "%ssubgraph c%d [\"%s\"]\n", indent, *clusterCount, mermaidEscape(cluster.label))
+		*clusterCount++
+		cluster.writeMermaid(b, indent+"  ", nodeIDs, clusterCount)
+		fmt.Fprintf(b, "%send\n", indent)
+	}
+}
+
+// sortOperators sorts operators by ID
+func sortOperators(operators []operator.Operator) {
+	sort.Slice(operators, func(i, j int) bool {
+		return operators[i].ID() < operators[j].ID()
+	})
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func newRenderTestPipeline() *testutil.Pipeline {
+	newOperator := func(id, operatorType string, outputs ...operator.Operator) *testutil.Operator {
+		op := testutil.NewMockOperator(id)
+		op.On("Type").Return(operatorType)
+		op.On("Outputs").Return(outputs)
+		return op
+	}
+
+	output := newOperator("$.output", "stdout")
+	router := newOperator("$.my_plugin.nested.router", "router", output)
+	parser := newOperator("$.my_plugin.parser", "regex_parser", router)
+	pluginInput := newOperator("$.my_plugin", "json_parser", parser)
+	input := newOperator("$.input", "file_input", pluginInput)
+	unused := newOperator("$.unused", "drop_output")
+
+	p := &testutil.Pipeline{}
+	p.On("Operators").Return([]operator.Operator{output, router, parser, pluginInput, input, unused})
+	return p
+}
+
+func TestRenderAs(t *testing.T) {
+	t.Run("Dot", func(t *testing.T) {
+		graph, err := RenderAs(newRenderTestPipeline(), DotFormat)
+		require.NoError(t, err)
+		expected := `strict digraph G {
+ // Node definitions.
+ "$.input" [label="$.input\nfile_input"];
+ "$.output" [label="$.output\nstdout"];
+ "$.unused" [label="$.unused\ndrop_output"];
+ subgraph "cluster_$.my_plugin" {
+  label="$.my_plugin";
+  "$.my_plugin" [label="$.my_plugin\njson_parser"];
+  "$.my_plugin.parser" [label="$.my_plugin.parser\nregex_parser"];
+  subgraph "cluster_$.my_plugin.nested" {
+   label="$.my_plugin.nested";
+   "$.my_plugin.nested.router" [label="$.my_plugin.nested.router\nrouter"];
+  }
+ }
+
+ // Edge definitions.
+ "$.input" -> "$.my_plugin";
+ "$.my_plugin" -> "$.my_plugin.parser";
+ "$.my_plugin.nested.router" -> "$.output";
+ "$.my_plugin.parser" -> "$.my_plugin.nested.router";
+}`
+		require.Equal(t, expected, string(graph))
+	})
+
+	t.Run("Mermaid", func(t *testing.T) {
+		graph, err := RenderAs(newRenderTestPipeline(), MermaidFormat)
+		require.NoError(t, err)
+		expected := `flowchart LR
+  n0["$.input<br>file_input"]
+  n1["$.output<br>stdout"]
+  n2["$.unused<br>drop_output"]
+  subgraph c0 ["$.my_plugin"]
+    n3["$.my_plugin<br>json_parser"]
+    n4["$.my_plugin.parser<br>regex_parser"]
+    subgraph c1 ["$.my_plugin.nested"]
+      n5["$.my_plugin.nested.router<br>router"]
+    end
+  end
+  n0 --> n3
+  n3 --> n4
+  n5 --> n1
+  n4 --> n5
+`
+		require.Equal(t, expected, string(graph))
+	})
+
+	t.Run("UnsupportedFormat", func(t *testing.T) {
+		_, err := RenderAs(newRenderTestPipeline(), "png")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported graph format 'png'")
+	})
+}
+
+// RouterPipeline tests that the operators of the inline pipelines of router
+// routes are drawn in a cluster for each route, under the router
+func TestRenderRouterPipeline(t *testing.T) {
+	var config Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(`
+- type: generate_input
+  entry:
+    record: test
+- type: router
+  routes:
+    - name: errors
+      expr: '$severity >= error'
+      pipeline:
+        - type: noop
+        - type: drop_output
+    - expr: 'true'
+      pipeline:
+        - type: drop_output
+`), &config))
+
+	pipeline, err := config.BuildPipeline(testutil.NewBuildContext(t), nil)
+	require.NoError(t, err)
+
+	graph, err := RenderAs(pipeline, DotFormat)
+	require.NoError(t, err)
+	expected := `strict digraph G {
+ // Node definitions.
+ "$.generate_input" [label="$.generate_input\ngenerate_input"];
+ subgraph "cluster_$.router" {
+  label="$.router";
+  "$.router" [label="$.router\nrouter"];
+  subgraph "cluster_$.router.1" {
+   label="$.router.1";
+   "$.router.1.drop_output" [label="$.router.1.drop_output\ndrop_output"];
+  }
+  subgraph "cluster_$.router.errors" {
+   label="$.router.errors";
+   "$.router.errors.drop_output" [label="$.router.errors.drop_output\ndrop_output"];
+   "$.router.errors.noop" [label="$.router.errors.noop\nnoop"];
+  }
+ }
+
+ // Edge definitions.
+ "$.generate_input" -> "$.router";
+ "$.router" -> "$.router.1.drop_output";
+ "$.router" -> "$.router.errors.noop";
+ "$.router.errors.noop" -> "$.router.errors.drop_output";
+}`
+	require.Equal(t, expected, string(graph))
+}
@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+)
+
+// WithoutInputs returns the operators of a list that are not inputs, and the
+// operators that the inputs send entries to. Entries can be injected into
+// those operators in place of the inputs, such as to replay a file through a
+// pipeline. The entry points are sorted by ID.
+func WithoutInputs(operators []operator.Operator) (processors []operator.Operator, entryPoints []operator.Operator) {
+	processors = make([]operator.Operator, 0, len(operators))
+	targets := make(map[string]operator.Operator)
+	for _, op := range operators {
+		if op.CanProcess() {
+			processors = append(processors, op)
+			continue
+		}
+		if !op.CanOutput() {
+			continue
+		}
+		for _, output := range op.Outputs() {
+			targets[output.ID()] = output
+		}
+	}
+
+	entryPoints = make([]operator.Operator, 0, len(targets))
+	for _, target := range targets {
+		entryPoints = append(entryPoints, target)
+	}
+	sortOperators(entryPoints)
+	return processors, entryPoints
+}
+
+// ReplaceOutputs returns a list of operators with each output replaced by
+// the operator that replace returns for it. The replacement must have the ID
+// of the output, so that connecting the list with NewDirectedPipeline sends
+// the entries of each output to its replacement.
+func ReplaceOutputs(operators []operator.Operator, replace func(output operator.Operator) (operator.Operator, error)) ([]operator.Operator, error) {
+	replaced := make([]operator.Operator, 0, len(operators))
+	for _, op := range operators {
+		if !op.CanProcess() || op.CanOutput() {
+			replaced = append(replaced, op)
+			continue
+		}
+
+		replacement, err := replace(op)
+		if err != nil {
+			return nil, fmt.Errorf("replace output %s: %s", op.ID(), err)
+		}
+		if replacement.ID() != op.ID() {
+			return nil, fmt.Errorf("replacement of output %s has the ID %s", op.ID(), replacement.ID())
+		}
+		replaced = append(replaced, replacement)
+	}
+	return replaced, nil
+}
+
+// FindOperator returns the operator of a list with an ID. IDs without a
+// namespace are looked up in the top-level namespace.
+func FindOperator(operators []operator.Operator, id string) (operator.Operator, bool) {
+	namespaced := operator.BuildContext{Namespace: "$"}.PrependNamespace(id)
+	for _, op := range operators {
+		if op.ID() == namespaced {
+			return op, true
+		}
+	}
+	return nil, false
+}
+
+// Inject sends an entry to an operator, as an input would, and counts it as
+// received by the operator
+func Inject(ctx context.Context, op operator.Operator, e *entry.Entry) error {
+	helper.RecordReceived(op)
+	return op.Process(ctx, e)
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newReplayTestOperator(id string, canProcess, canOutput bool, outputs ...operator.Operator) *testutil.Operator {
+	op := &testutil.Operator{}
+	op.On("ID").Return(id)
+	op.On("CanProcess").Return(canProcess)
+	op.On("CanOutput").Return(canOutput)
+	op.On("Outputs").Return(outputs)
+	op.On("SetOutputs", mock.Anything).Return(nil)
+	return op
+}
+
+func TestWithoutInputs(t *testing.T) {
+	output := newReplayTestOperator("$.output", true, false)
+	parser := newReplayTestOperator("$.parser", true, true, output)
+	router := newReplayTestOperator("$.router", true, true, output)
+	input1 := newReplayTestOperator("$.input1", false, true, parser)
+	input2 := newReplayTestOperator("$.input2", false, true, router, parser)
+
+	processors, entryPoints := WithoutInputs([]operator.Operator{input1, parser, router, input2, output})
+	require.Equal(t, []operator.Operator{parser, router, output}, processors)
+	require.Equal(t, []operator.Operator{parser, router}, entryPoints)
+}
+
+func TestReplaceOutputs(t *testing.T) {
+	output := newReplayTestOperator("$.output", true, false)
+	parser := newReplayTestOperator("$.parser", true, true, output)
+	input := newReplayTestOperator("$.input", false, true, parser)
+
+	t.Run("Replaced", func(t *testing.T) {
+		replacement := newReplayTestOperator("$.output", true, false)
+		replaced, err := ReplaceOutputs([]operator.Operator{input, parser, output}, func(op operator.Operator) (operator.Operator, error) {
+			require.Equal(t, output, op)
+			return replacement, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []operator.Operator{input, parser, replacement}, replaced)
+	})
+
+	t.Run("DifferentID", func(t *testing.T) {
+		_, err := ReplaceOutputs([]operator.Operator{parser, output}, func(op operator.Operator) (operator.Operator, error) {
+			return newReplayTestOperator("$.other", true, false), nil
+		})
+		require.EqualError(t, err, "replacement of output $.output has the ID $.other")
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := ReplaceOutputs([]operator.Operator{parser, output}, func(op operator.Operator) (operator.Operator, error) {
+			return nil, fmt.Errorf("failed")
+		})
+		require.EqualError(t, err, "replace output $.output: failed")
+	})
+}
+
+func TestFindOperator(t *testing.T) {
+	parser := newReplayTestOperator("$.parser", true, true)
+	nested := newReplayTestOperator("$.app.parser", true, true)
+	operators := []operator.Operator{parser, nested}
+
+	op, ok := FindOperator(operators, "parser")
+	require.True(t, ok)
+	require.Equal(t, parser, op)
+
+	op, ok = FindOperator(operators, "$.app.parser")
+	require.True(t, ok)
+	require.Equal(t, nested, op)
+
+	_, ok = FindOperator(operators, "missing")
+	require.False(t, ok)
+}
+
+func TestInject(t *testing.T) {
+	fake := testutil.NewFakeOutput(t)
+	e := entry.New()
+	e.Record = "test"
+	require.NoError(t, Inject(context.Background(), fake, e))
+	fake.ExpectRecord(t, "test")
+}
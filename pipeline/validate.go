@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"go.uber.org/zap"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// orderCycles replaces each strongly connected component of a graph that
+// cannot be sorted with a cycle through it, in the order of its edges. Each
+// cycle starts at the operator with the lowest ID of its component, and the
+// cycles are sorted by that ID, so the same config fails with the same error.
+func orderCycles(g *simple.DirectedGraph, components topo.Unorderable) topo.Unorderable {
+	cycles := make(topo.Unorderable, 0, len(components))
+	for _, component := range components {
+		cycles = append(cycles, findCycle(g, component))
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return operatorID(cycles[i][0]) < operatorID(cycles[j][0])
+	})
+	return cycles
+}
+
+// findCycle returns the shortest cycle from the operator with the lowest ID
+// of a strongly connected component back to itself
+func findCycle(g *simple.DirectedGraph, component []graph.Node) []graph.Node {
+	members := make(map[int64]bool, len(component))
+	start := component[0]
+	for _, node := range component {
+		members[node.ID()] = true
+		if operatorID(node) < operatorID(start) {
+			start = node
+		}
+	}
+
+	// Search breadth first for an edge back to the start, visiting the
+	// outputs of each operator in the order of their IDs
+	previous := make(map[int64]graph.Node)
+	queue := []graph.Node{start}
+	var last graph.Node
+	for len(queue) > 0 && last == nil {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range sortedOutputs(g, node) {
+			if !members[next.ID()] {
+				continue
+			}
+			if next.ID() == start.ID() {
+				last = node
+				break
+			}
+			if _, ok := previous[next.ID()]; ok {
+				continue
+			}
+			previous[next.ID()] = node
+			queue = append(queue, next)
+		}
+	}
+
+	if last == nil {
+		return component
+	}
+
+	cycle := make([]graph.Node, 0, len(component))
+	for node := last; node.ID() != start.ID(); node = previous[node.ID()] {
+		cycle = append(cycle, node)
+	}
+	cycle = append(cycle, start)
+	for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+		cycle[i], cycle[j] = cycle[j], cycle[i]
+	}
+	return cycle
+}
+
+// sortedOutputs returns the nodes that a node has edges to, sorted by ID
+func sortedOutputs(g *simple.DirectedGraph, node graph.Node) []graph.Node {
+	outputs := graph.NodesOf(g.From(node.ID()))
+	sort.Slice(outputs, func(i, j int) bool {
+		return operatorID(outputs[i]) < operatorID(outputs[j])
+	})
+	return outputs
+}
+
+// orphanedOperators returns the IDs of the operators of a graph that can
+// process entries, but are not an output of any operator, so they never
+// receive entries. The catch operator receives the entries that other
+// operators fail to process, so it is not orphaned.
+func orphanedOperators(g *simple.DirectedGraph) []string {
+	orphans := make([]string, 0)
+	nodes := g.Nodes()
+	for nodes.Next() {
+		op := nodes.Node().(OperatorNode).Operator()
+		if !op.CanProcess() {
+			continue
+		}
+		if _, ok := op.(helper.Catcher); ok {
+			continue
+		}
+		if g.To(nodes.Node().ID()).Len() == 0 {
+			orphans = append(orphans, op.ID())
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// warnOrphans warns about each operator of a pipeline that never receives
+// entries, such as when the output of the operator meant to send them to it
+// is misspelled. The default operator is only used by operators without an
+// output, so it is not reported.
+func warnOrphans(pipeline *DirectedPipeline, defaultOperator operator.Operator, logger *zap.SugaredLogger) {
+	if logger == nil {
+		return
+	}
+	for _, id := range orphanedOperators(pipeline.Graph) {
+		if defaultOperator != nil && id == defaultOperator.ID() {
+			continue
+		}
+		logger.Warnw("Operator is not an output of any operator, so it will not receive entries",
+			"operator_id", id,
+		)
+	}
+}
+
+func operatorID(node graph.Node) string {
+	return node.(OperatorNode).Operator().ID()
+}
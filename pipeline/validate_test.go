@@ -0,0 +1,262 @@
+package pipeline
+
+import (
+	"testing"
+
+	_ "github.com/observiq/stanza/operator/builtin/input/generate"
+	_ "github.com/observiq/stanza/operator/builtin/output/drop"
+	_ "github.com/observiq/stanza/operator/builtin/transformer/catch"
+	_ "github.com/observiq/stanza/operator/builtin/transformer/noop"
+	_ "github.com/observiq/stanza/operator/builtin/transformer/router"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestValidateInvalidConfigs(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			"TwoOperatorCycle",
+			`
+- type: generate_input
+  output: a
+  entry:
+    record: test
+- id: a
+  type: noop
+  output: b
+- id: b
+  type: noop
+  output: a
+`,
+			`pipeline has a circular dependency: {"cycles":"($.a -> $.b -> $.a)"}`,
+		},
+		{
+			"ThreeOperatorCycle",
+			`
+- type: generate_input
+  output: c
+  entry:
+    record: test
+- id: c
+  type: noop
+  output: a
+- id: a
+  type: noop
+  output: b
+- id: b
+  type: noop
+  output: c
+`,
+			`pipeline has a circular dependency: {"cycles":"($.a -> $.b -> $.c -> $.a)"}`,
+		},
+		{
+			"TwoCycles",
+			`
+- type: generate_input
+  output: router
+  entry:
+    record: test
+- id: router
+  type: router
+  routes:
+    - expr: 'true'
+      output: [c, a]
+- id: c
+  type: noop
+  output: d
+- id: d
+  type: noop
+  output: c
+- id: a
+  type: noop
+  output: b
+- id: b
+  type: noop
+  output: a
+`,
+			`pipeline has a circular dependency: {"cycles":"($.a -> $.b -> $.a),($.c -> $.d -> $.c)"}`,
+		},
+		{
+			"CycleWithBranch",
+			`
+- type: generate_input
+  output: a
+  entry:
+    record: test
+- id: a
+  type: router
+  routes:
+    - expr: 'true'
+      output: [b, c]
+- id: b
+  type: noop
+  output: d
+- id: c
+  type: noop
+  output: d
+- id: d
+  type: noop
+  output: a
+`,
+			`pipeline has a circular dependency: {"cycles":"($.a -> $.b -> $.d -> $.a)"}`,
+		},
+		{
+			"SelfReference",
+			`
+- type: generate_input
+  output: a
+  entry:
+    record: test
+- id: a
+  type: noop
+  output: a
+`,
+			`pipeline has a circular dependency: {"cycles":"($.a -> $.a)"}`,
+		},
+		{
+			"MissingOutput",
+			`
+- type: generate_input
+  output: parser
+  entry:
+    record: test
+- type: drop_output
+`,
+			`operator '$.parser' does not exist: {"operator_id":"$.generate_input"}`,
+		},
+		{
+			"MissingRouteOutput",
+			`
+- type: generate_input
+  output: router
+  entry:
+    record: test
+- id: router
+  type: router
+  routes:
+    - expr: 'true'
+      output: missing
+- type: drop_output
+`,
+			`failed to set outputs on route '0': operator $.missing does not exist: {"operator_id":"$.router"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var config Config
+			require.NoError(t, yaml.UnmarshalStrict([]byte(tc.config), &config))
+
+			_, err := config.BuildPipeline(testutil.NewBuildContext(t), nil)
+			require.Error(t, err)
+			require.Equal(t, tc.expected, err.Error())
+		})
+	}
+}
+
+func TestWarnOrphans(t *testing.T) {
+	config := `
+- type: generate_input
+  output: drop_output
+  entry:
+    record: test
+- id: misspelled
+  type: noop
+- type: catch
+- type: drop_output
+`
+	var cfg Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(config), &cfg))
+
+	core, logs := observer.New(zap.WarnLevel)
+	bc := testutil.NewBuildContext(t)
+	bc.Logger.SugaredLogger = zap.New(core).Sugar()
+	defaultOutput := testutil.NewMockOperator("$.default")
+	defaultOutput.On("SetOutputs", mock.Anything).Return(nil)
+	defaultOutput.On("Outputs").Return(nil)
+
+	_, err := cfg.BuildPipeline(bc, defaultOutput)
+	require.NoError(t, err)
+
+	entries := logs.FilterMessage("Operator is not an output of any operator, so it will not receive entries").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "$.misspelled", entries[0].ContextMap()["operator_id"])
+}
+
+func TestOrphanedOperatorsSkipsInputsAndCatcher(t *testing.T) {
+	config := `
+- type: generate_input
+  entry:
+    record: test
+- type: catch
+  output: drop_output
+- type: drop_output
+`
+	var cfg Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(config), &cfg))
+
+	pipeline, err := cfg.BuildPipeline(testutil.NewBuildContext(t), nil)
+	require.NoError(t, err)
+	require.Empty(t, orphanedOperators(pipeline.Graph))
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		var config Config
+		require.NoError(t, yaml.UnmarshalStrict([]byte(`
+- type: generate_input
+  entry:
+    record: test
+- type: drop_output
+`), &config))
+		require.Empty(t, config.Validate(testutil.NewBuildContext(t)))
+	})
+
+	t.Run("EachOperator", func(t *testing.T) {
+		var config Config
+		require.NoError(t, yaml.UnmarshalStrict([]byte(`
+- type: generate_input
+  entry:
+    record: test
+- id: first
+  type: router
+  routes:
+    - expr: 'invalid expr ('
+      output: drop_output
+- id: second
+  type: router
+  routes:
+    - expr: 'invalid expr ('
+      output: drop_output
+- type: drop_output
+`), &config))
+
+		errs := config.Validate(testutil.NewBuildContext(t))
+		require.Len(t, errs, 2)
+		require.Contains(t, errs[0].Error(), `"operator_id":"$.first"`)
+		require.Contains(t, errs[1].Error(), `"operator_id":"$.second"`)
+	})
+
+	t.Run("Graph", func(t *testing.T) {
+		var config Config
+		require.NoError(t, yaml.UnmarshalStrict([]byte(`
+- type: generate_input
+  output: missing
+  entry:
+    record: test
+- type: drop_output
+`), &config))
+
+		errs := config.Validate(testutil.NewBuildContext(t))
+		require.Len(t, errs, 1)
+		require.Equal(t, `operator '$.missing' does not exist: {"operator_id":"$.generate_input"}`, errs[0].Error())
+	})
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/observiq/stanza/operator"
 	"github.com/observiq/stanza/operator/helper"
 	"github.com/observiq/stanza/pipeline"
-	yaml "gopkg.in/yaml.v2"
 )
 
 // Enforce that Config implements operator.Builder
@@ -28,21 +27,19 @@ func (c *Config) Build(bc operator.BuildContext) ([]operator.Operator, error) {
 		return nil, errors.NewError("reached max plugin depth", "ensure that there are no recursive dependencies in plugins")
 	}
 
-	params := c.getRenderParams(bc)
-	pipelineConfigBytes, err := c.Plugin.Render(params)
+	pipelineConfig, _, err := c.Render(bc)
 	if err != nil {
 		return nil, err
 	}
 
-	var pipelineConfig struct {
-		Pipeline pipeline.Config
-	}
-	if err := yaml.Unmarshal(pipelineConfigBytes, &pipelineConfig); err != nil {
-		return nil, err
-	}
-
 	nbc := bc.WithSubNamespace(c.ID()).WithIncrementedDepth()
-	return pipelineConfig.Pipeline.BuildOperators(nbc)
+	return pipelineConfig.BuildOperators(nbc)
+}
+
+// Render renders the pipeline of the plugin as it is built with this config,
+// returning the parsed pipeline and the rendered template
+func (c *Config) Render(bc operator.BuildContext) (pipeline.Config, []byte, error) {
+	return c.Plugin.RenderPipeline(c.getRenderParams(bc))
 }
 
 func (c *Config) getRenderParams(bc operator.BuildContext) map[string]interface{} {
@@ -0,0 +1,279 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+
+	"github.com/observiq/stanza/entry"
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/helper"
+	"github.com/observiq/stanza/pipeline"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fixtureOutputID is the ID of the operator that collects the entries written by a plugin under test
+const fixtureOutputID = "plugin_test_output"
+
+// Fixture holds the parameters of a plugin, and tests that run input lines
+// through the pipeline rendered with them
+type Fixture struct {
+	Parameters map[string]interface{} `yaml:"parameters"`
+	Tests      []FixtureTest          `yaml:"tests"`
+}
+
+// FixtureTest is a test of the entries a plugin writes for input lines
+type FixtureTest struct {
+	Name string `yaml:"name"`
+
+	// Operator is the ID of the operator in the plugin's pipeline that the
+	// lines are sent to. If it is an input, the lines are sent to its outputs.
+	// It defaults to the operator with the ID of the plugin's input, or else
+	// the only input of the plugin.
+	Operator string `yaml:"operator,omitempty"`
+
+	Input    []string        `yaml:"input"`
+	Expected []ExpectedEntry `yaml:"expected"`
+}
+
+// ExpectedEntry is an entry a plugin is expected to write. Labels are
+// only compared if they are set.
+type ExpectedEntry struct {
+	Record interface{}       `yaml:"record"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// FixtureResult is the result of a fixture test
+type FixtureResult struct {
+	Name     string
+	Failures []string
+}
+
+// Passed returns true if the test had no failures
+func (r FixtureResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// NewFixtureFromFile reads a fixture from a yaml file
+func NewFixtureFromFile(path string) (*Fixture, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	if err := yaml.UnmarshalStrict(contents, &fixture); err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %s", path, err)
+	}
+	return &fixture, nil
+}
+
+// NewTestConfig creates a config for testing a plugin with the given parameters
+func (p *Plugin) NewTestConfig(params map[string]interface{}) *Config {
+	config := &Config{
+		Plugin:     p,
+		Parameters: params,
+	}
+	config.OperatorID = p.ID
+	config.OperatorType = p.ID
+	config.OutputIDs = []string{fixtureOutputID}
+	return config
+}
+
+// RunFixtureTest builds the plugin with the parameters of a fixture, sends
+// the input lines of a test through it, and compares the entries it writes
+// to the expected entries. Input operators of the plugin are not started.
+func (p *Plugin) RunFixtureTest(bc operator.BuildContext, params map[string]interface{}, test FixtureTest) (FixtureResult, error) {
+	result := FixtureResult{Name: test.Name}
+
+	operators, err := p.NewTestConfig(params).Build(bc)
+	if err != nil {
+		return result, err
+	}
+
+	outputOperator, err := helper.NewOutputConfig(fixtureOutputID, "plugin_test_output").Build(bc)
+	if err != nil {
+		return result, err
+	}
+	output := &fixtureOutput{OutputOperator: outputOperator}
+	operators = append(operators, output)
+
+	// Wiring the operators into a pipeline sets their outputs
+	if _, err := pipeline.NewDirectedPipeline(operators); err != nil {
+		return result, err
+	}
+
+	targets, err := p.fixtureTargets(bc, operators, test.Operator)
+	if err != nil {
+		return result, err
+	}
+
+	started := make([]operator.Operator, 0, len(operators))
+	defer func() {
+		for _, op := range started {
+			_ = op.Stop()
+		}
+	}()
+	for _, op := range operators {
+		if !op.CanProcess() {
+			continue
+		}
+		if err := op.Start(); err != nil {
+			return result, fmt.Errorf("start operator %s: %s", op.ID(), err)
+		}
+		started = append(started, op)
+	}
+
+	ctx := context.Background()
+	for _, line := range test.Input {
+		e := entry.New()
+		e.Record = line
+		for _, target := range targets {
+			helper.RecordReceived(target)
+			_ = target.Process(ctx, e.Copy())
+		}
+	}
+
+	// Stopping the operators flushes the entries they hold
+	for _, op := range started {
+		_ = op.Stop()
+	}
+	started = nil
+
+	result.Failures = compareFixtureEntries(test.Expected, output.entries())
+	return result, nil
+}
+
+// fixtureTargets returns the operators that the input lines of a test are sent to
+func (p *Plugin) fixtureTargets(bc operator.BuildContext, operators []operator.Operator, operatorID string) ([]operator.Operator, error) {
+	var target operator.Operator
+	if operatorID != "" {
+		namespaced := bc.WithSubNamespace(p.ID).PrependNamespace(operatorID)
+		for _, op := range operators {
+			if op.ID() == namespaced || op.ID() == bc.PrependNamespace(operatorID) {
+				target = op
+				break
+			}
+		}
+		if target == nil {
+			return nil, fmt.Errorf("operator '%s' is not in the pipeline of plugin '%s'", operatorID, p.ID)
+		}
+	} else {
+		inputs := make([]operator.Operator, 0, 1)
+		for _, op := range operators {
+			if op.ID() == bc.PrependNamespace(p.ID) && op.CanProcess() {
+				target = op
+				break
+			}
+			if !op.CanProcess() {
+				inputs = append(inputs, op)
+			}
+		}
+		if target == nil {
+			if len(inputs) != 1 {
+				return nil, fmt.Errorf("plugin '%s' has %d inputs, so the test must set the operator to send lines to", p.ID, len(inputs))
+			}
+			target = inputs[0]
+		}
+	}
+
+	if target.CanProcess() {
+		return []operator.Operator{target}, nil
+	}
+	return target.Outputs(), nil
+}
+
+// compareFixtureEntries describes the differences between the expected and
+// actual entries. Records are compared as JSON, so that numbers and maps
+// parsed from yaml match those of entries.
+func compareFixtureEntries(expected []ExpectedEntry, actual []*entry.Entry) []string {
+	failures := make([]string, 0)
+	if len(expected) != len(actual) {
+		failures = append(failures, fmt.Sprintf("expected %d entries, got %d", len(expected), len(actual)))
+	}
+
+	for i := 0; i < len(expected) && i < len(actual); i++ {
+		expectedRecord := normalizeFixtureValue(expected[i].Record)
+		actualRecord := normalizeFixtureValue(actual[i].Record)
+		if !reflect.DeepEqual(expectedRecord, actualRecord) {
+			failures = append(failures, fmt.Sprintf("entry %d: expected record %s, got %s", i, fixtureJSON(expectedRecord), fixtureJSON(actualRecord)))
+		}
+		for k, v := range expected[i].Labels {
+			if actual[i].Labels[k] != v {
+				failures = append(failures, fmt.Sprintf("entry %d: expected label %s to be '%s', got '%s'", i, k, v, actual[i].Labels[k]))
+			}
+		}
+	}
+	return failures
+}
+
+// normalizeFixtureValue converts a value to its JSON representation, with the
+// maps parsed from yaml converted to maps with string keys
+func normalizeFixtureValue(value interface{}) interface{} {
+	data, err := json.Marshal(stringKeys(value))
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprintf("%v", k)] = stringKeys(child)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = stringKeys(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for _, child := range v {
+			s = append(s, stringKeys(child))
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func fixtureJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// fixtureOutput collects the entries written by a plugin under test
+type fixtureOutput struct {
+	helper.OutputOperator
+	mux      sync.Mutex
+	received []*entry.Entry
+}
+
+// Process collects an entry
+func (o *fixtureOutput) Process(_ context.Context, e *entry.Entry) error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.received = append(o.received, e)
+	return nil
+}
+
+func (o *fixtureOutput) entries() []*entry.Entry {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return o.received
+}
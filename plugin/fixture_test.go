@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/operator/builtin/input/generate"
+	"github.com/observiq/stanza/operator/builtin/parser/regex"
+	"github.com/observiq/stanza/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var fixturePlugin = []byte(`
+parameters:
+  pattern:
+    type: string
+    required: true
+pipeline:
+  - id: source
+    type: generate_input
+    record: unused
+  - id: parser
+    type: regex_parser
+    regex: '{{ .pattern }}'
+    output: {{ .output }}
+`)
+
+func registerFixtureOperators() {
+	// Other tests replace the default registry, so the operators used by the
+	// plugin are registered again
+	operator.Register("generate_input", func() operator.Builder { return generate.NewGenerateInputConfig("") })
+	operator.Register("regex_parser", func() operator.Builder { return regex.NewRegexParserConfig("") })
+}
+
+func TestRunFixtureTest(t *testing.T) {
+	registerFixtureOperators()
+	plugin, err := NewPlugin("access", fixturePlugin)
+	require.NoError(t, err)
+
+	tempDir := testutil.NewTempDir(t)
+	path := filepath.Join(tempDir, "access.params.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+parameters:
+  pattern: '^(?P<method>\w+) (?P<status>\d+)$'
+tests:
+  - name: parses requests
+    input:
+      - GET 200
+      - POST 500
+    expected:
+      - record:
+          method: GET
+          status: "200"
+      - record:
+          method: POST
+          status: "500"
+  - name: wrong status
+    input:
+      - GET 404
+    expected:
+      - record:
+          method: GET
+          status: "200"
+`), 0666))
+
+	fixture, err := NewFixtureFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, fixture.Tests, 2)
+
+	result, err := plugin.RunFixtureTest(testutil.NewBuildContext(t), fixture.Parameters, fixture.Tests[0])
+	require.NoError(t, err)
+	require.True(t, result.Passed(), result.Failures)
+
+	result, err = plugin.RunFixtureTest(testutil.NewBuildContext(t), fixture.Parameters, fixture.Tests[1])
+	require.NoError(t, err)
+	require.False(t, result.Passed())
+	require.Equal(t, []string{`entry 0: expected record {"method":"GET","status":"200"}, got {"method":"GET","status":"404"}`}, result.Failures)
+}
+
+func TestRunFixtureTestTargets(t *testing.T) {
+	registerFixtureOperators()
+	params := map[string]interface{}{"pattern": `^(?P<word>\w+)$`}
+
+	cases := []struct {
+		name      string
+		template  string
+		operator  string
+		expected  int
+		expectErr bool
+	}{
+		{
+			"PluginInput",
+			"pipeline:\n  - id: '{{ .input }}'\n    type: regex_parser\n    regex: '{{ .pattern }}'\n    output: {{ .output }}\n",
+			"", 1, false,
+		},
+		{
+			"NamedOperator",
+			string(fixturePlugin),
+			"parser", 1, false,
+		},
+		{
+			"MissingOperator",
+			string(fixturePlugin),
+			"missing", 0, true,
+		},
+		{
+			"SeveralInputs",
+			"pipeline:\n  - type: generate_input\n    id: a\n    output: {{ .output }}\n  - type: generate_input\n    id: b\n    output: {{ .output }}\n    pattern: '{{ .pattern }}'\n",
+			"", 0, true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plugin, err := NewPlugin("words", []byte(tc.template))
+			require.NoError(t, err)
+
+			test := FixtureTest{
+				Operator: tc.operator,
+				Input:    []string{"hello"},
+				Expected: []ExpectedEntry{{Record: map[interface{}]interface{}{"word": "hello"}}},
+			}
+			result, err := plugin.RunFixtureTest(testutil.NewBuildContext(t), params, test)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, result.Passed(), result.Failures)
+		})
+	}
+}
+
+func TestCompareFixtureEntriesCount(t *testing.T) {
+	failures := compareFixtureEntries([]ExpectedEntry{{Record: "a"}}, nil)
+	require.Equal(t, []string{"expected 1 entries, got 0"}, failures)
+}
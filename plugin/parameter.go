@@ -2,6 +2,8 @@ package plugin
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/observiq/stanza/errors"
 )
@@ -24,6 +26,8 @@ type Parameter struct {
 	Default     interface{} // Must be valid according to Type & ValidValues
 }
 
+// validateValue checks a value against the type of the parameter. Its errors
+// complete a sentence that starts with the name of the parameter.
 func (p Parameter) validateValue(value interface{}) error {
 	switch p.Type {
 	case stringType:
@@ -37,27 +41,33 @@ func (p Parameter) validateValue(value interface{}) error {
 	case enumType:
 		return p.validateEnumValue(value)
 	default:
-		return fmt.Errorf("invalid parameter type: %s", p.Type)
+		return fmt.Errorf("has an invalid type: %s", p.Type)
 	}
 }
 
 func (p Parameter) validateStringValue(value interface{}) error {
 	if _, ok := value.(string); !ok {
-		return fmt.Errorf("parameter must be a string")
+		return fmt.Errorf("must be a string, got %s", describeValue(value))
 	}
 	return nil
 }
 
 func (p Parameter) validateIntValue(value interface{}) error {
-	if _, ok := value.(int); !ok {
-		return fmt.Errorf("parameter must be an integer")
+	switch v := value.(type) {
+	case int, int32, int64, uint64:
+		return nil
+	case float64:
+		// Numbers decoded from JSON are floats
+		if v == math.Trunc(v) {
+			return nil
+		}
 	}
-	return nil
+	return fmt.Errorf("must be an int, got %s", describeValue(value))
 }
 
 func (p Parameter) validateBoolValue(value interface{}) error {
 	if _, ok := value.(bool); !ok {
-		return fmt.Errorf("parameter must be a bool")
+		return fmt.Errorf("must be a bool, got %s", describeValue(value))
 	}
 	return nil
 }
@@ -69,12 +79,12 @@ func (p Parameter) validateStringsValue(value interface{}) error {
 
 	array, ok := value.([]interface{})
 	if !ok {
-		return fmt.Errorf("parameter must be an array of strings")
+		return fmt.Errorf("must be an array of strings, got %s", describeValue(value))
 	}
 
-	for _, v := range array {
+	for i, v := range array {
 		if _, ok := v.(string); !ok {
-			return fmt.Errorf("parameter contains a non string value")
+			return fmt.Errorf("must be an array of strings, got %s at index %d", describeValue(v), i)
 		}
 	}
 
@@ -84,7 +94,7 @@ func (p Parameter) validateStringsValue(value interface{}) error {
 func (p Parameter) validateEnumValue(value interface{}) error {
 	enum, ok := value.(string)
 	if !ok {
-		return fmt.Errorf("parameter must be a string")
+		return fmt.Errorf("must be a string, got %s", describeValue(value))
 	}
 
 	for _, v := range p.ValidValues {
@@ -93,7 +103,20 @@ func (p Parameter) validateEnumValue(value interface{}) error {
 		}
 	}
 
-	return fmt.Errorf("parameter must be one of the following values: %v", p.ValidValues)
+	return fmt.Errorf("must be one of %s, got %s", strings.Join(p.ValidValues, ", "), describeValue(value))
+}
+
+// describeValue describes a value in an error, quoting it so that an empty
+// string or a number given as a string can be told apart
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return fmt.Sprintf("'%s'", value)
+	case nil:
+		return "nothing"
+	default:
+		return fmt.Sprintf("'%v' (%T)", value, value)
+	}
 }
 
 func (p Parameter) validateDefinition() error {
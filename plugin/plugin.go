@@ -2,14 +2,18 @@ package plugin
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/observiq/stanza/errors"
 	"github.com/observiq/stanza/operator"
+	"github.com/observiq/stanza/pipeline"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -21,8 +25,23 @@ type Plugin struct {
 	Description string
 	Parameters  map[string]Parameter
 	Template    *template.Template
+
+	// templateLines are the lines of the template, which start after
+	// templateOffset lines of metadata in the plugin file
+	templateLines  []string
+	templateOffset int
 }
 
+// templateErrorRegexp matches the line of the template in the errors of text/template
+var templateErrorRegexp = regexp.MustCompile(`^template: .*?:(\d+):`)
+
+// unclosedErrorRegexp matches the line where an unclosed action started, which
+// text/template reports along with the line where the template ended
+var unclosedErrorRegexp = regexp.MustCompile(`started at .*?:(\d+)$`)
+
+// renderedErrorRegexp matches the line of the rendered pipeline in yaml errors
+var renderedErrorRegexp = regexp.MustCompile(`line (\d+):`)
+
 // NewBuilder creates a new, empty config that can build into an operator
 func (p *Plugin) NewBuilder() operator.Builder {
 	return &Config{
@@ -30,11 +49,13 @@ func (p *Plugin) NewBuilder() operator.Builder {
 	}
 }
 
-// Render will render a plugin's template with the given parameters
+// Render will render a plugin's template with the given parameters, and the
+// defaults of the optional parameters that are not given
 func (p *Plugin) Render(params map[string]interface{}) ([]byte, error) {
 	if err := p.Validate(params); err != nil {
 		return nil, err
 	}
+	params = p.withDefaults(params)
 
 	var writer bytes.Buffer
 	if err := p.Template.Execute(&writer, params); err != nil {
@@ -43,15 +64,108 @@ func (p *Plugin) Render(params map[string]interface{}) ([]byte, error) {
 			"ensure that all parameters are valid for the plugin",
 			"plugin_type", p.ID,
 			"error_message", err.Error(),
+			"template_line", p.templateLine(err),
 		)
 	}
 
 	return writer.Bytes(), nil
 }
 
-// Validate checks the provided params against the parameter definitions to ensure they are valid
+// RenderPipeline renders a plugin's template with the given parameters, and
+// parses the pipeline it defines. The rendered template is returned even if
+// it can't be parsed, so that it can be inspected.
+func (p *Plugin) RenderPipeline(params map[string]interface{}) (pipeline.Config, []byte, error) {
+	rendered, err := p.Render(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pipelineConfig struct {
+		Pipeline pipeline.Config
+	}
+	if err := yaml.Unmarshal(rendered, &pipelineConfig); err != nil {
+		return nil, rendered, errors.NewError(
+			"failed to parse the rendered pipeline of plugin",
+			"ensure that the template renders valid yaml for the parameters",
+			"plugin_type", p.ID,
+			"error_message", err.Error(),
+			"rendered_line", renderedLine(err, rendered),
+		)
+	}
+	return pipelineConfig.Pipeline, rendered, nil
+}
+
+// templateLine returns the line of the template where an error occurred,
+// numbered as a line of the plugin file, or an empty string if it is unknown
+func (p *Plugin) templateLine(err error) string {
+	match := unclosedErrorRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		match = templateErrorRegexp.FindStringSubmatch(err.Error())
+	}
+	if match == nil {
+		return ""
+	}
+	line, _ := strconv.Atoi(match[1])
+	if line < 1 || line > len(p.templateLines) {
+		return ""
+	}
+	return fmt.Sprintf("%d: %s", line+p.templateOffset, strings.TrimSpace(p.templateLines[line-1]))
+}
+
+// renderedLine returns the line of a rendered pipeline where a yaml error
+// occurred, or an empty string if it is unknown
+func renderedLine(err error, rendered []byte) string {
+	match := renderedErrorRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ""
+	}
+	line, _ := strconv.Atoi(match[1])
+	lines := strings.Split(string(rendered), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return fmt.Sprintf("%d: %s", line, strings.TrimSpace(lines[line-1]))
+}
+
+// reservedParameters are the parameters that are set for every plugin from
+// the config of the operator, rather than declared by the plugin
+var reservedParameters = map[string]bool{
+	"id":     true,
+	"input":  true,
+	"output": true,
+}
+
+// Validate checks the provided params against the parameter definitions to ensure they are valid.
+// Parameters that are not defined are rejected, unless the plugin does not define any parameters.
 func (p *Plugin) Validate(params map[string]interface{}) error {
-	for name, param := range p.Parameters {
+	names := make([]string, 0, len(p.Parameters))
+	for name := range p.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(p.Parameters) > 0 {
+		unknown := make([]string, 0)
+		for name := range params {
+			if _, ok := p.Parameters[name]; !ok && !reservedParameters[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+
+		if len(unknown) > 0 {
+			return errors.NewError(
+				fmt.Sprintf("plugin %s: unknown parameter '%s'", p.ID, unknown[0]),
+				"remove the parameter, or check it for typos against the parameters of the plugin",
+				"plugin_type", p.ID,
+				"plugin_parameter", unknown[0],
+				"valid_parameters", strings.Join(names, ", "),
+			)
+		}
+	}
+
+	for _, name := range names {
+		param := p.Parameters[name]
 		value, ok := params[name]
 		if !ok && !param.Required {
 			continue
@@ -59,7 +173,7 @@ func (p *Plugin) Validate(params map[string]interface{}) error {
 
 		if !ok && param.Required {
 			return errors.NewError(
-				"missing required parameter for plugin",
+				fmt.Sprintf("plugin %s: missing required parameter '%s'", p.ID, name),
 				"ensure that the parameter is defined for the plugin",
 				"plugin_type", p.ID,
 				"plugin_parameter", name,
@@ -68,11 +182,10 @@ func (p *Plugin) Validate(params map[string]interface{}) error {
 
 		if err := param.validateValue(value); err != nil {
 			return errors.NewError(
-				"plugin parameter failed validation",
-				"review the underlying error message for details",
+				fmt.Sprintf("plugin %s: parameter '%s' %s", p.ID, name, err),
+				"set the parameter to a value of its type",
 				"plugin_type", p.ID,
 				"plugin_parameter", name,
-				"error_message", err.Error(),
 			)
 		}
 	}
@@ -80,6 +193,21 @@ func (p *Plugin) Validate(params map[string]interface{}) error {
 	return nil
 }
 
+// withDefaults returns a copy of the params with the default of each
+// optional parameter that is not set
+func (p *Plugin) withDefaults(params map[string]interface{}) map[string]interface{} {
+	withDefaults := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		withDefaults[name] = value
+	}
+	for name, param := range p.Parameters {
+		if _, ok := withDefaults[name]; !ok && param.Default != nil {
+			withDefaults[name] = param.Default
+		}
+	}
+	return withDefaults
+}
+
 // UnmarshalText unmarshals a plugin from a text file
 func (p *Plugin) UnmarshalText(text []byte) error {
 	metadataBytes, templateBytes, err := splitPluginFile(text)
@@ -91,10 +219,20 @@ func (p *Plugin) UnmarshalText(text []byte) error {
 		return err
 	}
 
+	p.templateLines = strings.Split(string(templateBytes), "\n")
+	p.templateOffset = bytes.Count(metadataBytes, []byte("\n"))
 	p.Template, err = template.New(p.Title).
 		Funcs(pluginFuncs()).
 		Parse(string(templateBytes))
-	return err
+	if err != nil {
+		return errors.NewError(
+			"failed to parse template for plugin",
+			"ensure that the template is valid go template syntax",
+			"error_message", err.Error(),
+			"template_line", p.templateLine(err),
+		)
+	}
+	return nil
 }
 
 func splitPluginFile(text []byte) (metadata, template []byte, err error) {
@@ -65,6 +65,31 @@ func TestPluginRender(t *testing.T) {
 	})
 }
 
+func TestPluginTemplateLine(t *testing.T) {
+	t.Run("ParseError", func(t *testing.T) {
+		_, err := NewPlugin("broken", []byte("version: 0.0.1\npipeline:\n  - type: noop\n    id: {{ .id \n"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"template_line":"4: id: {{ .id"`)
+	})
+
+	t.Run("ExecError", func(t *testing.T) {
+		plugin, err := NewPlugin("broken", []byte("version: 0.0.1\npipeline:\n  - type: noop\n    id: {{ .id.name }}\n"))
+		require.NoError(t, err)
+		_, err = plugin.Render(map[string]interface{}{"id": "test"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"template_line":"4: id: {{ .id.name }}"`)
+	})
+
+	t.Run("RenderedError", func(t *testing.T) {
+		plugin, err := NewPlugin("broken", []byte("pipeline:\n  - type: noop\n    id: [{{ .id }}\n"))
+		require.NoError(t, err)
+		_, rendered, err := plugin.RenderPipeline(map[string]interface{}{"id": "test"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"rendered_line":"3: id: [test"`)
+		require.Contains(t, string(rendered), "id: [test")
+	})
+}
+
 func clearRegistry() {
 	operator.DefaultRegistry = operator.NewRegistry()
 }
@@ -624,7 +649,7 @@ pipeline:
 	require.NoError(t, err)
 	_, err = plugin.Render(map[string]interface{}{})
 	require.Error(t, err)
-	require.Contains(t, err.Error(), "missing required parameter for plugin")
+	require.Contains(t, err.Error(), "plugin plugin: missing required parameter 'path'")
 }
 
 func TestRenderWithInvalidParameter(t *testing.T) {
@@ -643,7 +668,86 @@ pipeline:
 	require.NoError(t, err)
 	_, err = plugin.Render(map[string]interface{}{"path": "test"})
 	require.Error(t, err)
-	require.Contains(t, err.Error(), "plugin parameter failed validation")
+	require.Contains(t, err.Error(), "plugin plugin: parameter 'path' must be an int, got 'test'")
+}
+
+func TestRenderParameters(t *testing.T) {
+	plugin, err := NewPlugin("my_nginx", []byte(`
+parameters:
+  path:
+    type: string
+    required: true
+  port:
+    type: int
+    default: 8080
+  tls:
+    type: bool
+    default: false
+  hosts:
+    type: strings
+    default: [localhost]
+  level:
+    type: enum
+    valid_values: [debug, info]
+    default: info
+pipeline:
+  - type: noop
+    id: {{ .id }}
+    path: {{ .path }}
+    port: {{ .port }}
+    tls: {{ .tls }}
+    hosts: {{ range .hosts }}{{ . }} {{ end }}
+    level: {{ .level }}
+`))
+	require.NoError(t, err)
+
+	t.Run("Defaults", func(t *testing.T) {
+		rendered, err := plugin.Render(map[string]interface{}{"id": "nginx", "path": "/var/log/nginx.log"})
+		require.NoError(t, err)
+		require.Contains(t, string(rendered), "port: 8080\n")
+		require.Contains(t, string(rendered), "tls: false\n")
+		require.Contains(t, string(rendered), "hosts: localhost \n")
+		require.Contains(t, string(rendered), "level: info\n")
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		rendered, err := plugin.Render(map[string]interface{}{
+			"id":    "nginx",
+			"path":  "/var/log/nginx.log",
+			"port":  float64(443),
+			"tls":   true,
+			"hosts": []interface{}{"a", "b"},
+			"level": "debug",
+		})
+		require.NoError(t, err)
+		require.Contains(t, string(rendered), "port: 443\n")
+		require.Contains(t, string(rendered), "tls: true\n")
+		require.Contains(t, string(rendered), "hosts: a b \n")
+		require.Contains(t, string(rendered), "level: debug\n")
+	})
+
+	cases := []struct {
+		name   string
+		params map[string]interface{}
+		err    string
+	}{
+		{"MissingRequired", map[string]interface{}{}, "plugin my_nginx: missing required parameter 'path'"},
+		{"String", map[string]interface{}{"path": 5}, "plugin my_nginx: parameter 'path' must be a string, got '5' (int)"},
+		{"Int", map[string]interface{}{"path": "p", "port": "abc"}, "plugin my_nginx: parameter 'port' must be an int, got 'abc'"},
+		{"Fraction", map[string]interface{}{"path": "p", "port": 1.5}, "plugin my_nginx: parameter 'port' must be an int, got '1.5' (float64)"},
+		{"Bool", map[string]interface{}{"path": "p", "tls": "yes"}, "plugin my_nginx: parameter 'tls' must be a bool, got 'yes'"},
+		{"Strings", map[string]interface{}{"path": "p", "hosts": []interface{}{"a", 5}}, "plugin my_nginx: parameter 'hosts' must be an array of strings, got '5' (int) at index 1"},
+		{"Enum", map[string]interface{}{"path": "p", "level": "trace"}, "plugin my_nginx: parameter 'level' must be one of debug, info, got 'trace'"},
+		{"Unknown", map[string]interface{}{"path": "p", "prot": 80}, "plugin my_nginx: unknown parameter 'prot'"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := plugin.Render(tc.params)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
 }
 
 func TestDefaultPluginFuncWithValue(t *testing.T) {
@@ -78,3 +78,19 @@ func (_m *Pipeline) Stop() error {
 
 	return r0
 }
+
+// Status provides a mock function with given fields:
+func (_m *Pipeline) Status() []operator.OperatorStatus {
+	ret := _m.Called()
+
+	var r0 []operator.OperatorStatus
+	if rf, ok := ret.Get(0).(func() []operator.OperatorStatus); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]operator.OperatorStatus)
+		}
+	}
+
+	return r0
+}